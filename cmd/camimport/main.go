@@ -0,0 +1,74 @@
+// Command camimport registers cameras in bulk from a CSV file or a MediaMTX
+// configuration by posting it to a running server's import endpoint.
+//
+//	camimport -server http://localhost:8080 cameras.csv
+//	camimport -format mediamtx mediamtx.yml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the streaming server")
+	format := flag.String("format", "", "csv or mediamtx (default: from the file extension)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*server, *format, flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "camimport:", err)
+		os.Exit(1)
+	}
+}
+
+func run(server, format, path string) error {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".yml", ".yaml":
+			format = "mediamtx"
+		default:
+			return fmt.Errorf("cannot tell the format of %s, pass -format", path)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	endpoint := strings.TrimRight(server, "/") + "/api/cameras/import?format=" + url.QueryEscape(format)
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Post(endpoint, "application/octet-stream", file)
+	if err != nil {
+		return fmt.Errorf("import request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Println(string(body))
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package analytics feeds decoded frames of a stream to external analytics
+// sidecars and relays the detections they return to viewers and the event
+// bus.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/media"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxFPS bounds the frame rate a sidecar may ask for; decoding costs
+	// CPU for every subscriber
+	MaxFPS = 15
+	// maxDetections bounds a single report
+	maxDetections = 256
+)
+
+// Options controls the frames a sidecar receives.
+type Options struct {
+	FPS float64
+	// Width scales frames down, keeping the aspect ratio; 0 keeps the
+	// stream's size
+	Width int
+}
+
+func (o Options) Validate() error {
+	if o.FPS <= 0 || o.FPS > MaxFPS {
+		return fmt.Errorf("frame rate must be above 0 and at most %d", MaxFPS)
+	}
+	if o.Width < 0 || o.Width%2 != 0 {
+		return fmt.Errorf("width must be even and not negative")
+	}
+	return nil
+}
+
+// Frame is one decoded picture sent to a sidecar.
+type Frame struct {
+	Seq       uint64
+	Timestamp time.Time
+	JPEG      []byte
+}
+
+// Box is a bounding box in coordinates relative to the frame, from 0 to 1,
+// with the origin at the top left.
+type Box struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Detection is one object a sidecar found in a frame.
+type Detection struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+	Box        Box     `json:"box"`
+	// TrackID identifies the same object across frames, if the sidecar tracks
+	TrackID string `json:"track_id,omitempty"`
+}
+
+// Detections is what a sidecar found in the frame with sequence number Seq.
+type Detections struct {
+	Stream     string      `json:"stream"`
+	Seq        uint64      `json:"seq"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Detections []Detection `json:"detections"`
+}
+
+func (d Detections) Validate() error {
+	if len(d.Detections) > maxDetections {
+		return fmt.Errorf("at most %d detections per frame", maxDetections)
+	}
+	for i, det := range d.Detections {
+		if det.Label == "" {
+			return fmt.Errorf("detection %d has no label", i)
+		}
+		if det.Confidence < 0 || det.Confidence > 1 || math.IsNaN(det.Confidence) {
+			return fmt.Errorf("detection %d: confidence must be between 0 and 1", i)
+		}
+		b := det.Box
+		if !inUnit(b.X) || !inUnit(b.Y) || b.Width <= 0 || b.Height <= 0 || !inUnit(b.X+b.Width) || !inUnit(b.Y+b.Height) {
+			return fmt.Errorf("detection %d: box must lie within the frame, in relative coordinates", i)
+		}
+	}
+	return nil
+}
+
+func inUnit(v float64) bool {
+	return v >= 0 && v <= 1
+}
+
+// Hub connects the streams' media buses to the sidecars subscribed to them.
+type Hub struct {
+	sinks map[string]*Sink
+	// defaults apply to sidecars that do not choose their own options
+	defaults Options
+	// acquire keeps a source running while a sidecar is subscribed
+	acquire      func(streamID, consumer string) (func(), error)
+	onDetections []func(Detections)
+	events       *events.Bus
+	overlay      *Overlay
+	mu           sync.Mutex
+}
+
+func NewHub(defaults Options, acquire func(streamID, consumer string) (func(), error)) (*Hub, error) {
+	if err := defaults.Validate(); err != nil {
+		return nil, err
+	}
+	return &Hub{
+		sinks:    make(map[string]*Sink),
+		defaults: defaults,
+		acquire:  acquire,
+	}, nil
+}
+
+// Defaults returns the frame options of sidecars that do not choose their own.
+func (h *Hub) Defaults() Options {
+	return h.defaults
+}
+
+// SetEvents publishes reported detections on bus.
+func (h *Hub) SetEvents(bus *events.Bus) {
+	h.mu.Lock()
+	h.events = bus
+	h.mu.Unlock()
+}
+
+// SetOverlay draws reported detections onto the video of the streams
+// overlay is enabled for.
+func (h *Hub) SetOverlay(overlay *Overlay) {
+	h.mu.Lock()
+	h.overlay = overlay
+	h.mu.Unlock()
+}
+
+// OnDetections registers a callback for every accepted report, e.g. to
+// forward it to viewers.
+func (h *Hub) OnDetections(fn func(Detections)) {
+	h.mu.Lock()
+	h.onDetections = append(h.onDetections, fn)
+	h.mu.Unlock()
+}
+
+// Sink returns the analytics output of a stream, to attach to its source.
+func (h *Hub) Sink(streamID string) *Sink {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sink, ok := h.sinks[streamID]
+	if !ok {
+		sink = &Sink{streamID: streamID, enabled: true, decoders: make(map[*decoder]bool)}
+		h.sinks[streamID] = sink
+	}
+	return sink
+}
+
+// Subscribe decodes a stream for a sidecar until ctx is done. Frames the
+// sidecar is too slow to take are dropped.
+func (h *Hub) Subscribe(ctx context.Context, streamID string, opts Options) (<-chan Frame, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	sink, ok := h.sinks[streamID]
+	h.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("stream %s has no analytics output", streamID)
+	}
+	if !sink.IsRunning() {
+		return nil, fmt.Errorf("analytics output of %s is disabled", streamID)
+	}
+
+	release, err := h.acquire(streamID, "analytics")
+	if err != nil {
+		return nil, err
+	}
+	d, err := startDecoder(ctx, opts)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	sink.add(d)
+	go func() {
+		<-d.done
+		sink.remove(d)
+		release()
+	}()
+	return d.frames, nil
+}
+
+// Report accepts the detections a sidecar found in a frame of a stream.
+func (h *Hub) Report(d Detections) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if d.Timestamp.IsZero() {
+		d.Timestamp = time.Now()
+	}
+	if d.Detections == nil {
+		d.Detections = []Detection{}
+	}
+
+	h.mu.Lock()
+	callbacks := append([]func(Detections){}, h.onDetections...)
+	bus := h.events
+	overlay := h.overlay
+	sink := h.sinks[d.Stream]
+	h.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(d)
+	}
+	if overlay != nil && sink != nil {
+		if err := overlay.Draw(d, sink.frameSize()); err != nil {
+			logrus.Warnf("Failed to draw analytics overlay of %s: %v", d.Stream, err)
+		}
+	}
+	// Empty reports only matter to viewers, which clear their overlay
+	if len(d.Detections) > 0 {
+		bus.Publish(events.Event{
+			Type:   events.AnalyticsDetections,
+			Stream: d.Stream,
+			Data:   map[string]interface{}{"seq": d.Seq, "detections": d.Detections},
+		})
+	}
+	logrus.Debugf("Analytics reported %d detections in frame %d of %s", len(d.Detections), d.Seq, d.Stream)
+	return nil
+}
+
+// Sink feeds a stream's access units to the decoders of its sidecars.
+type Sink struct {
+	streamID string
+	enabled  bool
+	decoders map[*decoder]bool
+	mu       sync.RWMutex
+}
+
+func (s *Sink) Name() string { return "analytics" }
+
+func (s *Sink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.enabled = true
+	s.mu.Unlock()
+	return nil
+}
+
+// Stop disables the output and disconnects its sidecars.
+func (s *Sink) Stop() error {
+	s.mu.Lock()
+	s.enabled = false
+	decoders := s.decoders
+	s.decoders = make(map[*decoder]bool)
+	s.mu.Unlock()
+
+	for d := range decoders {
+		d.stop()
+	}
+	return nil
+}
+
+func (s *Sink) IsRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled
+}
+
+func (s *Sink) WriteAccessUnit(au media.AccessUnit) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for d := range s.decoders {
+		d.write(au)
+	}
+}
+
+// frameSize returns the size of the frames sidecars receive, scaled or not;
+// all have the stream's aspect ratio.
+func (s *Sink) frameSize() image.Point {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for d := range s.decoders {
+		if size := d.frameSize(); size != (image.Point{}) {
+			return size
+		}
+	}
+	return image.Point{}
+}
+
+func (s *Sink) add(d *decoder) {
+	s.mu.Lock()
+	s.decoders[d] = true
+	s.mu.Unlock()
+}
+
+func (s *Sink) remove(d *decoder) {
+	s.mu.Lock()
+	delete(s.decoders, d)
+	s.mu.Unlock()
+}
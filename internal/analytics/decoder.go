@@ -0,0 +1,190 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxJPEGSize bounds a decoded frame, so a corrupt stream cannot grow the
+// output buffer without end
+const maxJPEGSize = 8 << 20
+
+// decoder turns a stream's H.264 into JPEG frames for one sidecar with an
+// ffmpeg process of its own.
+type decoder struct {
+	input  chan media.AccessUnit
+	frames chan Frame
+	cancel context.CancelFunc
+	// done is closed once ffmpeg has exited
+	done chan struct{}
+	// started is set from the first keyframe on; ffmpeg cannot decode
+	// anything before it
+	started bool
+	// size is that of the frames, once the first was decoded
+	size image.Point
+	mu   sync.Mutex
+}
+
+func startDecoder(ctx context.Context, opts Options) (*decoder, error) {
+	filter := fmt.Sprintf("fps=%g", opts.FPS)
+	if opts.Width > 0 {
+		filter += fmt.Sprintf(",scale=%d:-2", opts.Width)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := ffmpeg.CommandContext(ctx,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "h264", "-i", "pipe:0",
+		"-vf", filter,
+		"-c:v", "mjpeg", "-q:v", "5",
+		"-f", "image2pipe", "pipe:1",
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		cancel()
+		return nil, fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	d := &decoder{
+		input:  make(chan media.AccessUnit, media.FrameBuffer),
+		frames: make(chan Frame, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go d.feed(ctx, stdin)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Warnf("FFmpeg (analytics): %s", scanner.Text())
+		}
+	}()
+	go func() {
+		d.readFrames(stdout)
+		_ = cmd.Wait()
+		cancel()
+		close(d.frames)
+		close(d.done)
+	}()
+	return d, nil
+}
+
+// write queues an access unit without blocking the media bus.
+func (d *decoder) write(au media.AccessUnit) {
+	d.mu.Lock()
+	if !d.started && !au.Keyframe {
+		d.mu.Unlock()
+		return
+	}
+	d.started = true
+	d.mu.Unlock()
+	media.Send(d.input, au)
+}
+
+// frameSize returns the size of the decoded frames, or zero before the first.
+func (d *decoder) frameSize() image.Point {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
+
+func (d *decoder) stop() {
+	d.cancel()
+}
+
+// feed writes queued access units to ffmpeg until ctx is done.
+func (d *decoder) feed(ctx context.Context, stdin io.WriteCloser) {
+	defer stdin.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case au := <-d.input:
+			if _, err := stdin.Write(au.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readFrames splits ffmpeg's MJPEG output into JPEG images. The sequence
+// number counts every frame decoded, so dropped frames leave gaps.
+func (d *decoder) readFrames(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 256<<10), maxJPEGSize)
+	scanner.Split(splitJPEG)
+
+	var seq uint64
+	for scanner.Scan() {
+		seq++
+		frame := Frame{Seq: seq, Timestamp: time.Now(), JPEG: append([]byte(nil), scanner.Bytes()...)}
+		if seq == 1 {
+			if cfg, err := jpeg.DecodeConfig(bytes.NewReader(frame.JPEG)); err == nil {
+				d.mu.Lock()
+				d.size = image.Pt(cfg.Width, cfg.Height)
+				d.mu.Unlock()
+			}
+		}
+		select {
+		case d.frames <- frame:
+		default:
+			// The sidecar has not taken the previous frame yet
+		}
+	}
+	if err := scanner.Err(); err != nil && !strings.Contains(err.Error(), "file already closed") {
+		logrus.Warnf("Failed to read analytics frames: %v", err)
+	}
+}
+
+var (
+	jpegStart = []byte{0xFF, 0xD8}
+	jpegEnd   = []byte{0xFF, 0xD9}
+)
+
+// splitJPEG is a bufio.SplitFunc returning one JPEG image, from its start
+// to its end marker, at a time. Entropy-coded data never contains the end
+// marker, as ffmpeg stuffs every 0xFF in it.
+func splitJPEG(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.Index(data, jpegStart)
+	if start < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+	end := bytes.Index(data[start+2:], jpegEnd)
+	if end < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return start, nil, nil
+	}
+	end += start + 2 + len(jpegEnd)
+	return end, data[start:end], nil
+}
@@ -0,0 +1,197 @@
+package analytics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// overlayWidth is the width overlay images are drawn at; ffmpeg stretches
+	// them to the video's size
+	overlayWidth = 1280
+	// boxStroke is the line width of a box, and labelScale the size of a
+	// font pixel, at overlayWidth
+	boxStroke  = 3
+	labelScale = 2
+	labelPad   = 3
+)
+
+// overlayColors are picked by label, so the same kind of object always has
+// the same color.
+var overlayColors = []color.RGBA{
+	{230, 25, 75, 255},
+	{60, 180, 75, 255},
+	{0, 130, 200, 255},
+	{245, 130, 48, 255},
+	{145, 30, 180, 255},
+	{240, 50, 230, 255},
+	{0, 128, 128, 255},
+	{170, 110, 40, 255},
+}
+
+// Overlay draws the detections of streams into images their pipelines
+// composite onto the video, so HLS, recordings, and other non-WebRTC
+// consumers see them too.
+type Overlay struct {
+	dir string
+	// streams have an overlay; "*" stands for all
+	streams map[string]bool
+	// ttl clears the detections of a stream that were not followed by
+	// another report, e.g. because its sidecar left
+	ttl time.Duration
+	// drawn counts the images written per stream, so a clear does not
+	// overwrite newer detections
+	drawn map[string]uint64
+	mu    sync.Mutex
+}
+
+func NewOverlay(dir string, streams []string, ttl time.Duration) (*Overlay, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("overlay duration must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create overlay directory: %w", err)
+	}
+	set := make(map[string]bool)
+	for _, s := range streams {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			set[s] = true
+		}
+	}
+	return &Overlay{dir: dir, streams: set, ttl: ttl, drawn: make(map[string]uint64)}, nil
+}
+
+// Enabled reports whether a stream has an overlay.
+func (o *Overlay) Enabled(streamID string) bool {
+	return o.streams["*"] || o.streams[strings.ToLower(streamID)]
+}
+
+// Path returns the overlay image of a stream, creating an empty one for
+// ffmpeg to open if there is none yet.
+func (o *Overlay) Path(streamID string) (string, error) {
+	path := o.path(streamID)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := o.write(path, image.NewRGBA(image.Rect(0, 0, overlayWidth, overlayWidth*9/16))); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (o *Overlay) path(streamID string) string {
+	return filepath.Join(o.dir, strings.ToLower(streamID)+".png")
+}
+
+// Draw replaces the overlay of d's stream with its detections, on a canvas
+// with the aspect ratio of frames of size, until the next report or ttl.
+func (o *Overlay) Draw(d Detections, size image.Point) error {
+	if !o.Enabled(d.Stream) {
+		return nil
+	}
+	height := overlayWidth * 9 / 16
+	if size.X > 0 && size.Y > 0 {
+		height = overlayWidth * size.Y / size.X
+	}
+	img := image.NewRGBA(image.Rect(0, 0, overlayWidth, height))
+	for _, det := range d.Detections {
+		drawDetection(img, det)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.write(o.path(d.Stream), img); err != nil {
+		return err
+	}
+	o.drawn[d.Stream]++
+	if len(d.Detections) > 0 {
+		drawn := o.drawn[d.Stream]
+		time.AfterFunc(o.ttl, func() { o.clear(d.Stream, drawn, img.Bounds()) })
+	}
+	return nil
+}
+
+// clear empties the overlay of a stream unless it was drawn again since.
+func (o *Overlay) clear(streamID string, drawn uint64, bounds image.Rectangle) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drawn[streamID] != drawn {
+		return
+	}
+	if err := o.write(o.path(streamID), image.NewRGBA(bounds)); err != nil {
+		logrus.Warnf("Failed to clear analytics overlay of %s: %v", streamID, err)
+		return
+	}
+	o.drawn[streamID]++
+}
+
+// write replaces the image at path atomically, as ffmpeg may read it at any
+// time. Callers must hold mu.
+func (o *Overlay) write(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(o.dir, ".overlay-*.png")
+	if err != nil {
+		return fmt.Errorf("create overlay: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encode overlay: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write overlay: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace overlay: %w", err)
+	}
+	return nil
+}
+
+// drawDetection draws the box of det with its label and confidence above
+// it, or inside it at the top of the image.
+func drawDetection(img *image.RGBA, det Detection) {
+	bounds := img.Bounds()
+	box := image.Rect(
+		int(det.Box.X*float64(bounds.Dx())),
+		int(det.Box.Y*float64(bounds.Dy())),
+		int((det.Box.X+det.Box.Width)*float64(bounds.Dx())),
+		int((det.Box.Y+det.Box.Height)*float64(bounds.Dy())),
+	)
+	h := fnv.New32a()
+	h.Write([]byte(det.Label))
+	src := image.NewUniform(overlayColors[h.Sum32()%uint32(len(overlayColors))])
+
+	for _, edge := range []image.Rectangle{
+		image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+boxStroke),
+		image.Rect(box.Min.X, box.Max.Y-boxStroke, box.Max.X, box.Max.Y),
+		image.Rect(box.Min.X, box.Min.Y, box.Min.X+boxStroke, box.Max.Y),
+		image.Rect(box.Max.X-boxStroke, box.Min.Y, box.Max.X, box.Max.Y),
+	} {
+		draw.Draw(img, edge.Intersect(bounds), src, image.Point{}, draw.Src)
+	}
+
+	text := fmt.Sprintf("%s %d%%", det.Label, int(det.Confidence*100+0.5))
+	size := textSize(text, labelScale).Add(image.Pt(2*labelPad, 2*labelPad))
+	label := image.Rectangle{Min: image.Pt(box.Min.X, box.Min.Y-size.Y), Max: image.Pt(box.Min.X+size.X, box.Min.Y)}
+	if label.Min.Y < 0 {
+		label = label.Add(image.Pt(0, size.Y))
+	}
+	if label.Max.X > bounds.Max.X {
+		label = label.Sub(image.Pt(label.Max.X-bounds.Max.X, 0))
+	}
+	draw.Draw(img, label.Intersect(bounds), src, image.Point{}, draw.Src)
+	drawText(img, label.Min.Add(image.Pt(labelPad, labelPad)), text, labelScale, color.White)
+}
@@ -0,0 +1,221 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+
+	"github.com/sirupsen/logrus"
+)
+
+// listenerBuffer is how many chunks a listener may fall behind before it is
+// disconnected, a few seconds of audio
+const listenerBuffer = 64
+
+// broadcastChunk is the size of the reads from ffmpeg handed to listeners
+const broadcastChunk = 4096
+
+// Format is the encoding of an audio-only HTTP stream.
+type Format string
+
+const (
+	FormatMP3 Format = "mp3"
+	FormatAAC Format = "aac"
+)
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == FormatAAC {
+		return "audio/aac"
+	}
+	return "audio/mpeg"
+}
+
+// encoderArgs returns the ffmpeg output arguments of the format, MP3 or
+// AAC in ADTS frames, which players can join at any point.
+func (f Format) encoderArgs(bitrateKbps int) []string {
+	rate := strconv.Itoa(bitrateKbps) + "k"
+	if f == FormatAAC {
+		return []string{"-c:a", "aac", "-b:a", rate, "-f", "adts"}
+	}
+	return []string{"-c:a", "libmp3lame", "-b:a", rate, "-ar", "44100", "-f", "mp3"}
+}
+
+// Broadcaster transcodes a stream's audio once per format and hands it to
+// every listener, like an Icecast mount. ffmpeg runs while a stream has
+// listeners, reading the source's Feed rather than the source itself.
+type Broadcaster struct {
+	bitrateKbps int
+	broadcasts  map[string]*broadcast
+	mu          sync.Mutex
+}
+
+func NewBroadcaster(bitrateKbps int) (*Broadcaster, error) {
+	if bitrateKbps <= 0 {
+		return nil, fmt.Errorf("audio stream bitrate must be positive")
+	}
+	return &Broadcaster{bitrateKbps: bitrateKbps, broadcasts: make(map[string]*broadcast)}, nil
+}
+
+// BitrateKbps returns the bitrate the audio is encoded at.
+func (b *Broadcaster) BitrateKbps() int {
+	return b.bitrateKbps
+}
+
+// broadcast is one running ffmpeg and its listeners.
+type broadcast struct {
+	streamID  string
+	format    Format
+	cancel    context.CancelFunc
+	listeners map[chan []byte]struct{}
+}
+
+// Listen subscribes to the audio of streamID, read from feed, in format.
+// The channel is closed when the stream's audio ends or the listener fell
+// behind; stop unsubscribes.
+func (b *Broadcaster) Listen(streamID string, feed *Feed, format Format) (<-chan []byte, func()) {
+	key := streamID + "." + string(format)
+	ch := make(chan []byte, listenerBuffer)
+
+	b.mu.Lock()
+	bc, ok := b.broadcasts[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		bc = &broadcast{streamID: streamID, format: format, cancel: cancel, listeners: make(map[chan []byte]struct{})}
+		b.broadcasts[key] = bc
+		go b.run(ctx, key, bc, feed, format)
+	}
+	bc.listeners[ch] = struct{}{}
+	logrus.Infof("🎧 Audio listener joined %s (%d listening)", key, len(bc.listeners))
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := bc.listeners[ch]; ok {
+				b.removeLocked(key, bc, ch)
+				logrus.Infof("Audio listener left %s (%d listening)", key, len(bc.listeners))
+			}
+		})
+	}
+}
+
+// Listeners returns how many listeners each stream has per format.
+func (b *Broadcaster) Listeners() map[string]map[Format]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string]map[Format]int)
+	for _, bc := range b.broadcasts {
+		if out[bc.streamID] == nil {
+			out[bc.streamID] = make(map[Format]int)
+		}
+		out[bc.streamID][bc.format] = len(bc.listeners)
+	}
+	return out
+}
+
+// run transcodes until the last listener leaves or the audio ends, which
+// disconnects the remaining listeners.
+func (b *Broadcaster) run(ctx context.Context, key string, bc *broadcast, feed *Feed, format Format) {
+	pages, unsubscribe := feed.Subscribe()
+	defer func() {
+		unsubscribe()
+		b.mu.Lock()
+		if b.broadcasts[key] == bc {
+			delete(b.broadcasts, key)
+		}
+		for ch := range bc.listeners {
+			delete(bc.listeners, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+		bc.cancel()
+	}()
+
+	// Transcode only once the source sends audio
+	var first []byte
+	select {
+	case page, ok := <-pages:
+		if !ok {
+			return
+		}
+		first = page
+	case <-ctx.Done():
+		return
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", "ogg", "-i", "pipe:0", "-map", "0:a:0"}
+	args = append(args, format.encoderArgs(b.bitrateKbps)...)
+	args = append(args, "pipe:1")
+	cmd := ffmpeg.CommandContext(ctx, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logrus.Errorf("Audio stream %s: stdin pipe: %v", key, err)
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logrus.Errorf("Audio stream %s: stdout pipe: %v", key, err)
+		return
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		logrus.Errorf("Audio stream %s: start ffmpeg: %v", key, err)
+		return
+	}
+	go pipePages(stdin, first, pages)
+	logrus.Infof("Started audio stream %s", key)
+
+	for {
+		buf := make([]byte, broadcastChunk)
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			b.deliver(key, bc, buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				logrus.Warnf("Audio stream %s: %v", key, err)
+			}
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Warnf("Audio stream %s ended: %v", key, err)
+	} else {
+		logrus.Infof("Audio stream %s stopped", key)
+	}
+}
+
+// deliver hands a chunk to every listener, disconnecting those whose
+// buffer is full.
+func (b *Broadcaster) deliver(key string, bc *broadcast, chunk []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range bc.listeners {
+		select {
+		case ch <- chunk:
+		default:
+			b.removeLocked(key, bc, ch)
+			logrus.Warnf("Disconnected an audio listener of %s that fell behind", key)
+		}
+	}
+}
+
+// removeLocked disconnects a listener, and stops ffmpeg once there are none
+// left. Callers hold mu.
+func (b *Broadcaster) removeLocked(key string, bc *broadcast, ch chan []byte) {
+	delete(bc.listeners, ch)
+	close(ch)
+	if len(bc.listeners) == 0 {
+		if b.broadcasts[key] == bc {
+			delete(b.broadcasts, key)
+		}
+		bc.cancel()
+	}
+}
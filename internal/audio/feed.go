@@ -0,0 +1,109 @@
+package audio
+
+import (
+	"io"
+	"sync"
+)
+
+// feedBuffer is how many Ogg pages a subscriber may fall behind before it
+// is dropped, a few seconds of audio at one 20ms frame per page
+const feedBuffer = 256
+
+// Feed hands on the Ogg Opus audio a source's ffmpeg writes next to its
+// video, so the level meter and audio-only streams decode it locally
+// instead of pulling the source again. Subscribers joining during an ffmpeg
+// session get the session's header pages first.
+type Feed struct {
+	mu sync.Mutex
+	// headers are the OpusHead and OpusTags pages of the current session
+	headers [][]byte
+	// inHeaders is set until the first page of audio of a session
+	inHeaders bool
+	subs      map[chan []byte]struct{}
+}
+
+func NewFeed() *Feed {
+	return &Feed{subs: make(map[chan []byte]struct{})}
+}
+
+// Subscribe returns the Ogg bitstream of the current ffmpeg session from its
+// headers on, or of the next session if none is running. The channel is
+// closed when the session ends or the subscriber fell behind; stop
+// unsubscribes.
+func (f *Feed) Subscribe() (<-chan []byte, func()) {
+	f.mu.Lock()
+	ch := make(chan []byte, feedBuffer+len(f.headers))
+	for _, page := range f.headers {
+		ch <- page
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			f.removeLocked(ch)
+			f.mu.Unlock()
+		})
+	}
+}
+
+// begin starts a new session, whose headers replace those of the last.
+func (f *Feed) begin() {
+	f.mu.Lock()
+	f.headers, f.inHeaders = nil, true
+	f.mu.Unlock()
+}
+
+// write hands a page to every subscriber, dropping those whose buffer is
+// full. Pages before the first carrying audio are kept for subscribers
+// joining later.
+func (f *Feed) write(page []byte, hasAudio bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if hasAudio {
+		f.inHeaders = false
+	} else if f.inHeaders {
+		f.headers = append(f.headers, page)
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- page:
+		default:
+			f.removeLocked(ch)
+		}
+	}
+}
+
+// end closes the subscriptions to a session, whose decoders finish with it.
+func (f *Feed) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.headers, f.inHeaders = nil, false
+	for ch := range f.subs {
+		f.removeLocked(ch)
+	}
+}
+
+// removeLocked closes a subscription. Callers hold mu.
+func (f *Feed) removeLocked(ch chan []byte) {
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// pipePages writes first and then every page of a subscription to the
+// stdin of a decoding ffmpeg, and closes it when the subscription ends.
+func pipePages(w io.WriteCloser, first []byte, pages <-chan []byte) {
+	defer w.Close()
+	if _, err := w.Write(first); err != nil {
+		return
+	}
+	for page := range pages {
+		if _, err := w.Write(page); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFeedReplaysHeaders(t *testing.T) {
+	f := NewFeed()
+	f.begin()
+	f.write([]byte("head"), false)
+	f.write([]byte("tags"), false)
+	f.write([]byte("audio1"), true)
+	// Pages after the first audio are not headers, even without packets
+	f.write([]byte("continued"), false)
+
+	pages, stop := f.Subscribe()
+	defer stop()
+	f.write([]byte("audio2"), true)
+	for _, want := range []string{"head", "tags", "audio2"} {
+		if got := <-pages; !bytes.Equal(got, []byte(want)) {
+			t.Fatalf("page = %q, want %q", got, want)
+		}
+	}
+
+	f.end()
+	if _, ok := <-pages; ok {
+		t.Fatal("subscription still open after the session ended")
+	}
+	stop()
+}
+
+func TestFeedDropsSlowSubscribers(t *testing.T) {
+	f := NewFeed()
+	f.begin()
+	pages, stop := f.Subscribe()
+	defer stop()
+	for i := 0; i <= feedBuffer; i++ {
+		f.write([]byte("audio"), true)
+	}
+	n := 0
+	for range pages {
+		n++
+	}
+	if n != feedBuffer {
+		t.Errorf("got %d pages before the subscription closed, want %d", n, feedBuffer)
+	}
+}
+
+func TestFeedNextSession(t *testing.T) {
+	f := NewFeed()
+	f.begin()
+	f.write([]byte("old head"), false)
+	f.end()
+
+	pages, stop := f.Subscribe()
+	defer stop()
+	f.begin()
+	f.write([]byte("new head"), false)
+	if got := <-pages; !bytes.Equal(got, []byte("new head")) {
+		t.Errorf("page = %q, want the next session's header", got)
+	}
+}
@@ -0,0 +1,100 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Level is a single audio level measurement over one reporting interval.
+type Level struct {
+	RMSdBFS  float64   `json:"rms_dbfs"`
+	PeakdBFS float64   `json:"peak_dbfs"`
+	Silent   bool      `json:"silent"`
+	Time     time.Time `json:"time"`
+}
+
+// MeterConfig controls how often levels are reported and when a source is
+// considered silent.
+type MeterConfig struct {
+	Interval         time.Duration
+	SilenceThreshold float64 // dBFS below which audio counts as silence
+	SilenceDuration  time.Duration
+}
+
+// silenceFloor is reported for digital silence instead of -Inf
+const silenceFloor = -96.0
+
+// Meter computes RMS and peak levels from signed 16-bit PCM and reports them
+// once per interval.
+type Meter struct {
+	cfg      MeterConfig
+	onLevel  func(Level)
+	mu       sync.Mutex
+	sumSq    float64
+	peak     float64
+	count    int
+	started  time.Time
+	quietFor time.Duration
+}
+
+func NewMeter(cfg MeterConfig, onLevel func(Level)) *Meter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 500 * time.Millisecond
+	}
+	return &Meter{cfg: cfg, onLevel: onLevel}
+}
+
+// WritePCM accumulates samples and emits a Level when the interval elapses.
+func (m *Meter) WritePCM(samples []int16) {
+	m.mu.Lock()
+	now := time.Now()
+	if m.started.IsZero() {
+		m.started = now
+	}
+	for _, sample := range samples {
+		v := float64(sample) / 32768.0
+		m.sumSq += v * v
+		if a := math.Abs(v); a > m.peak {
+			m.peak = a
+		}
+	}
+	m.count += len(samples)
+
+	elapsed := now.Sub(m.started)
+	if elapsed < m.cfg.Interval || m.count == 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	level := Level{
+		RMSdBFS:  toDBFS(math.Sqrt(m.sumSq / float64(m.count))),
+		PeakdBFS: toDBFS(m.peak),
+		Time:     now,
+	}
+	if level.RMSdBFS < m.cfg.SilenceThreshold {
+		m.quietFor += elapsed
+	} else {
+		m.quietFor = 0
+	}
+	level.Silent = m.cfg.SilenceDuration > 0 && m.quietFor >= m.cfg.SilenceDuration
+
+	m.sumSq, m.peak, m.count = 0, 0, 0
+	m.started = now
+	m.mu.Unlock()
+
+	if m.onLevel != nil {
+		m.onLevel(level)
+	}
+}
+
+func toDBFS(v float64) float64 {
+	if v <= 0 {
+		return silenceFloor
+	}
+	db := 20 * math.Log10(v)
+	if db < silenceFloor {
+		return silenceFloor
+	}
+	return math.Round(db*10) / 10
+}
@@ -0,0 +1,140 @@
+package audio
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+
+	"github.com/sirupsen/logrus"
+)
+
+// monitorSampleRate is deliberately low; level metering does not need fidelity
+const monitorSampleRate = 8000
+
+// Monitor decodes the audio of a source's Feed to mono PCM with ffmpeg and
+// feeds a Meter.
+type Monitor struct {
+	feed    *Feed
+	meter   *Meter
+	cancel  context.CancelFunc
+	running bool
+	mu      sync.Mutex
+}
+
+func NewMonitor(feed *Feed, meter *Meter) *Monitor {
+	return &Monitor{feed: feed, meter: meter}
+}
+
+func (m *Monitor) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return fmt.Errorf("audio monitor is already running")
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.running = true
+	go m.supervise(ctx)
+	return nil
+}
+
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return
+	}
+	m.cancel()
+	m.running = false
+}
+
+func (m *Monitor) supervise(ctx context.Context) {
+	backoff := time.Second * 2
+	const maxBackoff = time.Second * 30
+
+	for {
+		if err := m.runOnce(ctx); err != nil {
+			logrus.Warnf("Audio level monitor error: %v", err)
+		} else {
+			// The source's session ended; meter the next one
+			backoff = time.Second * 2
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+func (m *Monitor) runOnce(ctx context.Context) error {
+	pages, unsubscribe := m.feed.Subscribe()
+	defer unsubscribe()
+
+	// Decode only while the source sends audio
+	var first []byte
+	select {
+	case page, ok := <-pages:
+		if !ok {
+			return nil
+		}
+		first = page
+	case <-ctx.Done():
+		return nil
+	}
+
+	cmd := ffmpeg.CommandContext(ctx,
+		"-f", "ogg",
+		"-i", "pipe:0",
+		"-ac", "1",
+		"-ar", fmt.Sprint(monitorSampleRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+	go pipePages(stdin, first, pages)
+
+	// 20ms of audio per read
+	buf := make([]byte, monitorSampleRate/50*2)
+	samples := make([]int16, len(buf)/2)
+	reader := bufio.NewReader(stdout)
+	for {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			break
+		}
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(buf[i*2:]))
+		}
+		m.meter.WritePCM(samples)
+	}
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("ffmpeg exited: %w", err)
+	}
+	return nil
+}
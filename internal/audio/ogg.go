@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// oggHeaderSize is the size of an Ogg page header up to its segment table
+const oggHeaderSize = 27
+
+// oggReader splits an Ogg bitstream into the packets it carries, which may
+// span pages.
+type oggReader struct {
+	r io.Reader
+	// partial is the start of a packet continued on the next page
+	partial []byte
+}
+
+// oggPage is the packets completed on one page and the granule position
+// of the last of them.
+type oggPage struct {
+	packets [][]byte
+	// granule is the sample count at the end of the last packet; -1 if no
+	// packet ends on the page
+	granule int64
+	// raw is the whole page as read, for handing on to other demuxers
+	raw []byte
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: r}
+}
+
+// next reads the next page.
+func (o *oggReader) next() (oggPage, error) {
+	header := make([]byte, oggHeaderSize)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		return oggPage{}, err
+	}
+	if !bytes.Equal(header[:4], []byte("OggS")) {
+		return oggPage{}, fmt.Errorf("invalid Ogg page signature %q", header[:4])
+	}
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return oggPage{}, err
+	}
+	size := 0
+	for _, lacing := range segments {
+		size += int(lacing)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return oggPage{}, err
+	}
+
+	page := oggPage{granule: int64(binary.LittleEndian.Uint64(header[6:14]))}
+	page.raw = make([]byte, 0, len(header)+len(segments)+len(body))
+	page.raw = append(append(append(page.raw, header...), segments...), body...)
+	// A packet ends at the first lacing value below 255
+	start := 0
+	offset := 0
+	for _, lacing := range segments {
+		offset += int(lacing)
+		if lacing < 255 {
+			packet := append(o.partial, body[start:offset]...)
+			o.partial = nil
+			page.packets = append(page.packets, packet)
+			start = offset
+		}
+	}
+	if start < len(body) {
+		o.partial = append(o.partial, body[start:]...)
+	}
+	return page, nil
+}
@@ -0,0 +1,70 @@
+package audio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpusOptions controls how source audio is encoded to Opus for viewers.
+type OpusOptions struct {
+	BitrateKbps int
+	// FEC embeds redundant data so receivers can conceal lost packets;
+	// libopus only spends bits on it when ExpectedLossPercent is above zero
+	FEC                 bool
+	ExpectedLossPercent int
+	// DTX stops sending during silence
+	DTX    bool
+	Stereo bool
+}
+
+// Validate checks the options against the ranges libopus accepts.
+func (o OpusOptions) Validate() error {
+	if o.BitrateKbps < 6 || o.BitrateKbps > 510 {
+		return fmt.Errorf("opus bitrate must be between 6 and 510 kbps, got %d", o.BitrateKbps)
+	}
+	if o.ExpectedLossPercent < 0 || o.ExpectedLossPercent > 100 {
+		return fmt.Errorf("opus expected loss must be between 0 and 100%%, got %d", o.ExpectedLossPercent)
+	}
+	return nil
+}
+
+// EncoderArgs returns the ffmpeg output arguments that encode audio with libopus.
+func (o OpusOptions) EncoderArgs() []string {
+	channels := "1"
+	if o.Stereo {
+		channels = "2"
+	}
+	args := []string{
+		"-c:a", "libopus",
+		"-application", "voip",
+		"-ar", "48000",
+		"-ac", channels,
+		"-b:a", fmt.Sprintf("%dk", o.BitrateKbps),
+		"-frame_duration", "20",
+		"-fec", boolArg(o.FEC),
+		"-dtx", boolArg(o.DTX),
+	}
+	if o.FEC {
+		args = append(args, "-packet_loss", fmt.Sprint(o.ExpectedLossPercent))
+	}
+	return args
+}
+
+// Fmtp returns the SDP fmtp parameters that announce these options to viewers.
+func (o OpusOptions) Fmtp() string {
+	params := []string{"minptime=10", "useinbandfec=" + boolArg(o.FEC)}
+	if o.DTX {
+		params = append(params, "usedtx=1")
+	}
+	if o.Stereo {
+		params = append(params, "stereo=1", "sprop-stereo=1")
+	}
+	return strings.Join(params, ";")
+}
+
+func boolArg(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/media"
+
+	"github.com/sirupsen/logrus"
+)
+
+// opusFrameSamples is the length of the 20ms frames EncoderArgs asks
+// libopus for, at its 48kHz clock
+const opusFrameSamples = 960
+
+// probeTimeout bounds looking for an audio stream in a source
+const probeTimeout = 15 * time.Second
+
+// OpusOutputArgs returns the ffmpeg output arguments that encode the first
+// audio stream of the first input with opts and write it as Ogg to pipe:3,
+// the first of the command's ExtraFiles. Sources add it to the ffmpeg that
+// reads their video, so audio and video come from one session on one
+// clock. Ogg pages are flushed every frame so packets are not held back.
+func OpusOutputArgs(opts OpusOptions) []string {
+	args := []string{"-map", "0:a:0", "-vn"}
+	args = append(args, opts.EncoderArgs()...)
+	return append(args, "-f", "ogg", "-page_duration", "20000", "-flush_packets", "1", "pipe:3")
+}
+
+// ReadOpus reads the output of OpusOutputArgs until ffmpeg closes it,
+// handing every packet to deliver and every page to feed. Timestamps follow
+// the granule positions from the wall-clock time of the first packet, so
+// gaps in the audio keep it aligned with video. The pipe is drained to the
+// end even after an error, so ffmpeg never blocks on it and stalls the
+// video it also writes.
+func ReadOpus(r io.Reader, feed *Feed, deliver func(media.AudioSample)) error {
+	feed.begin()
+	defer feed.end()
+
+	reader := newOggReader(r)
+	var anchor int64
+	anchored := false
+	packets := 0
+	for {
+		page, err := reader.next()
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				logrus.Debugf("Opus audio ended after %d packets", packets)
+				return nil
+			}
+			io.Copy(io.Discard, r)
+			return err
+		}
+		hasAudio := false
+		for i, packet := range page.packets {
+			// The OpusHead and OpusTags headers are not audio
+			if bytes.HasPrefix(packet, []byte("OpusHead")) || bytes.HasPrefix(packet, []byte("OpusTags")) {
+				continue
+			}
+			hasAudio = true
+			start := page.granule - int64(len(page.packets)-i)*opusFrameSamples
+			if !anchored {
+				anchor = time.Now().UnixMilli() - start/48
+				anchored = true
+			}
+			deliver(media.AudioSample{Data: packet, Timestamp: uint32(anchor + start/48)})
+			packets++
+		}
+		feed.write(page.raw, hasAudio)
+	}
+}
+
+// HasAudio reports whether the ffmpeg input described by input has an audio
+// stream. Sources check before adding OpusOutputArgs, since ffmpeg fails,
+// video and all, on an output left without streams.
+func HasAudio(ctx context.Context, input []string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	args := append([]string{"-v", "error"}, input...)
+	args = append(args, "-select_streams", "a:0", "-show_entries", "stream=codec_type", "-of", "csv=p=0")
+	out, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	if err != nil {
+		return false, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)) != "", nil
+}
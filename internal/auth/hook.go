@@ -0,0 +1,145 @@
+// Package auth decides whether a viewer may start a streaming session,
+// keeping business rules out of the signaling handlers.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request describes a viewer asking to start a session.
+type Request struct {
+	Stream   string `json:"stream"`
+	ClientIP string `json:"client_ip"`
+	Token    string `json:"token,omitempty"`
+	// Endpoint is the signaling endpoint that received the request, e.g. "offer"
+	Endpoint string `json:"endpoint"`
+}
+
+// Decision is a hook's verdict. Tags are attached to the session and show up
+// in peer listings and events; MaxBitrateKbps caps the session's video, e.g.
+// for a metered tenant.
+type Decision struct {
+	Allow          bool              `json:"allow"`
+	Reason         string            `json:"reason,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	MaxBitrateKbps int               `json:"max_bitrate_kbps,omitempty"`
+}
+
+// Hook authorizes session requests. An error means no decision could be
+// made; callers reject the request.
+type Hook interface {
+	Authorize(ctx context.Context, req Request) (Decision, error)
+}
+
+// Allow returns an accepting decision.
+func Allow() Decision { return Decision{Allow: true} }
+
+// Deny returns a rejecting decision with a reason shown to the client.
+func Deny(reason string) Decision { return Decision{Allow: false, Reason: reason} }
+
+// TokenHook accepts requests carrying one of a fixed set of tokens.
+type TokenHook struct {
+	tokens []string
+}
+
+// NewTokenHook creates a hook from a comma-separated token list.
+func NewTokenHook(list string) *TokenHook {
+	h := &TokenHook{}
+	for _, token := range strings.Split(list, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			h.tokens = append(h.tokens, token)
+		}
+	}
+	return h
+}
+
+func (h *TokenHook) Authorize(_ context.Context, req Request) (Decision, error) {
+	if req.Token == "" {
+		return Deny("missing token"), nil
+	}
+	for _, token := range h.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(req.Token)) == 1 {
+			return Allow(), nil
+		}
+	}
+	return Deny("invalid token"), nil
+}
+
+// maxWebhookResponseBytes bounds the decision a webhook may return
+const maxWebhookResponseBytes = 64 * 1024
+
+// WebhookHook delegates decisions to an external service: each Request is
+// POSTed as JSON and the response body is read as a Decision.
+type WebhookHook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookHook creates a hook calling url with the given timeout.
+func NewWebhookHook(url string, timeout time.Duration) *WebhookHook {
+	return &WebhookHook{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (h *WebhookHook) Authorize(ctx context.Context, req Request) (Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to encode auth request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to create auth request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("auth webhook failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A plain 401/403 rejects without requiring a body
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return Deny(resp.Status), nil
+	}
+	if resp.StatusCode >= 300 {
+		return Decision{}, fmt.Errorf("auth webhook returned %s", resp.Status)
+	}
+
+	var decision Decision
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseBytes)).Decode(&decision); err != nil {
+		return Decision{}, fmt.Errorf("invalid auth webhook response: %w", err)
+	}
+	return decision, nil
+}
+
+// Chain requires every hook to allow a request and merges their tags, later
+// hooks overriding earlier ones. The lowest bitrate cap wins.
+type Chain []Hook
+
+func (c Chain) Authorize(ctx context.Context, req Request) (Decision, error) {
+	result := Allow()
+	for _, hook := range c {
+		decision, err := hook.Authorize(ctx, req)
+		if err != nil || !decision.Allow {
+			return decision, err
+		}
+		for k, v := range decision.Tags {
+			if result.Tags == nil {
+				result.Tags = make(map[string]string)
+			}
+			result.Tags[k] = v
+		}
+		if limit := decision.MaxBitrateKbps; limit > 0 && (result.MaxBitrateKbps == 0 || limit < result.MaxBitrateKbps) {
+			result.MaxBitrateKbps = limit
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,220 @@
+package camera
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/state"
+
+	"gopkg.in/yaml.v3"
+)
+
+// csvColumns are the accepted CSV header fields; name and rtsp_uri are required
+var csvColumns = []string{"name", "manufacturer", "model", "rtsp_uri", "username", "password", "stream"}
+
+// ParseCSV reads cameras from CSV with a header row naming the columns in
+// any order, e.g. "name,rtsp_uri,username,password,stream".
+func ParseCSV(r io.Reader) ([]Camera, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("CSV is empty")
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !contains(csvColumns, column) {
+			return nil, fmt.Errorf("unknown CSV column %q, expected %s", column, strings.Join(csvColumns, ", "))
+		}
+		index[column] = i
+	}
+	for _, required := range []string{"name", "rtsp_uri"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing %s", required)
+		}
+	}
+
+	var cameras []Camera
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV line %d: %w", line, err)
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		cameras = append(cameras, Camera{
+			Name:         field("name"),
+			Manufacturer: field("manufacturer"),
+			Model:        field("model"),
+			RTSPURI:      field("rtsp_uri"),
+			Username:     field("username"),
+			Password:     field("password"),
+			Stream:       field("stream"),
+		})
+	}
+	return cameras, nil
+}
+
+// mediaMTXConfig is the part of a MediaMTX configuration file describing paths.
+type mediaMTXConfig struct {
+	Paths map[string]struct {
+		Source string `yaml:"source"`
+	} `yaml:"paths"`
+}
+
+// ParseMediaMTX reads the paths of a MediaMTX configuration (mediamtx.yml)
+// and returns one camera per path pulling from an RTSP source. Credentials in
+// the source URL are moved to username and password. Paths fed by publishers,
+// redirects, or regular expressions are skipped.
+func ParseMediaMTX(r io.Reader) ([]Camera, error) {
+	var cfg mediaMTXConfig
+	if err := yaml.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse MediaMTX configuration: %w", err)
+	}
+
+	names := make([]string, 0, len(cfg.Paths))
+	for name := range cfg.Paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var cameras []Camera
+	for _, name := range names {
+		if strings.HasPrefix(name, "~") || name == "all" || name == "all_others" {
+			continue
+		}
+		u, err := url.Parse(cfg.Paths[name].Source)
+		if err != nil || (u.Scheme != "rtsp" && u.Scheme != "rtsps") {
+			continue
+		}
+
+		cam := Camera{Name: name}
+		if u.User != nil {
+			cam.Username = u.User.Username()
+			cam.Password, _ = u.User.Password()
+			u.User = nil
+		}
+		cam.RTSPURI = u.String()
+		cameras = append(cameras, cam)
+	}
+	return cameras, nil
+}
+
+// ImportResult reports what an import changed.
+type ImportResult struct {
+	Created []Camera `json:"created"`
+	Updated []Camera `json:"updated"`
+}
+
+// Import validates a batch of cameras and stores all of them in a single
+// transaction, or none if any is invalid. Cameras are matched to existing
+// ones by name: matches are updated in place, keeping their stored password
+// when none is given, and the rest are created.
+func (s *Store) Import(cameras []Camera) (ImportResult, error) {
+	result := ImportResult{Created: []Camera{}, Updated: []Camera{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byName := make(map[string]Camera, len(s.cameras))
+	for _, cam := range s.cameras {
+		byName[cam.Name] = cam
+	}
+
+	now := time.Now().UTC()
+	seen := make(map[string]int)
+	streams := make(map[string]string)
+	batch := make([]Camera, 0, len(cameras))
+	for i, cam := range cameras {
+		cam.Name = strings.TrimSpace(cam.Name)
+		if err := cam.Validate(); err != nil {
+			return result, fmt.Errorf("camera %d (%s): %w", i+1, cam.Name, err)
+		}
+		if first, dup := seen[cam.Name]; dup {
+			return result, fmt.Errorf("camera %d (%s): duplicates camera %d", i+1, cam.Name, first)
+		}
+		seen[cam.Name] = i + 1
+
+		if existing, ok := byName[cam.Name]; ok {
+			cam.ID, cam.CreatedAt = existing.ID, existing.CreatedAt
+			if cam.Password == "" {
+				cam.Password = existing.Password
+			}
+		} else {
+			id, err := newID()
+			if err != nil {
+				return result, err
+			}
+			cam.ID, cam.CreatedAt = id, now
+		}
+		cam.UpdatedAt = now
+		cam.HasPassword = cam.Password != ""
+
+		if cam.Stream != "" {
+			if other, taken := streams[cam.Stream]; taken {
+				return result, fmt.Errorf("camera %d (%s): stream %s is already fed by %s", i+1, cam.Name, cam.Stream, other)
+			}
+			streams[cam.Stream] = cam.Name
+		}
+		batch = append(batch, cam)
+	}
+
+	// Streams must also be free of cameras outside the batch
+	for _, cam := range s.cameras {
+		if _, inBatch := seen[cam.Name]; inBatch || cam.Stream == "" {
+			continue
+		}
+		if name, taken := streams[cam.Stream]; taken {
+			return result, fmt.Errorf("camera %s: stream %s is already fed by camera %s", name, cam.Stream, cam.Name)
+		}
+	}
+
+	records := make(map[string]interface{}, len(batch))
+	for _, cam := range batch {
+		rec, err := s.seal(cam)
+		if err != nil {
+			return result, err
+		}
+		records[cam.ID] = rec
+	}
+	if err := s.db.PutAll(state.BucketCameras, records); err != nil {
+		return result, err
+	}
+
+	for _, cam := range batch {
+		if _, existed := s.cameras[cam.ID]; existed {
+			result.Updated = append(result.Updated, cam)
+		} else {
+			result.Created = append(result.Created, cam)
+		}
+		s.cameras[cam.ID] = cam
+	}
+	return result, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
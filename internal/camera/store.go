@@ -0,0 +1,252 @@
+package camera
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/secretbox"
+	"golang-webrtc-streaming/internal/state"
+)
+
+// Camera is an inventoried device. The password is write-only: it is
+// accepted on create and update but never serialized back.
+type Camera struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	RTSPURI      string `json:"rtsp_uri"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	HasPassword  bool   `json:"has_password"`
+	// Stream is the source this camera feeds, empty if unassigned
+	Stream    string    `json:"stream,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Redacted returns the camera without its password, for API responses.
+func (c Camera) Redacted() Camera {
+	c.HasPassword = c.Password != ""
+	c.Password = ""
+	return c
+}
+
+// URL returns the RTSP URI with the camera's credentials filled in.
+func (c Camera) URL() (string, error) {
+	u, err := url.Parse(c.RTSPURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid rtsp_uri: %w", err)
+	}
+	switch {
+	case c.Username != "" && c.Password != "":
+		u.User = url.UserPassword(c.Username, c.Password)
+	case c.Username != "":
+		u.User = url.User(c.Username)
+	}
+	return u.String(), nil
+}
+
+// Validate checks the fields an operator must supply.
+func (c Camera) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	u, err := url.Parse(c.RTSPURI)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("rtsp_uri must be an absolute URL")
+	}
+	if u.Scheme != "rtsp" && u.Scheme != "rtsps" {
+		return fmt.Errorf("rtsp_uri must use the rtsp or rtsps scheme")
+	}
+	if u.User != nil {
+		return fmt.Errorf("put credentials in username and password, not in rtsp_uri")
+	}
+	return nil
+}
+
+// record is the persisted form of a camera; Camera.Password is always empty
+// and the password is kept encrypted in PasswordSealed instead.
+type record struct {
+	Camera
+	PasswordSealed string `json:"password_sealed,omitempty"`
+}
+
+// Store is the camera inventory, persisted in the state store with
+// passwords encrypted at rest.
+type Store struct {
+	db      *state.Store
+	box     *secretbox.Box
+	cameras map[string]Camera
+	mu      sync.RWMutex
+}
+
+// NewStore loads the inventory from db, decrypting passwords with box.
+func NewStore(db *state.Store, box *secretbox.Box) (*Store, error) {
+	s := &Store{
+		db:      db,
+		box:     box,
+		cameras: make(map[string]Camera),
+	}
+
+	raw, err := db.List(state.BucketCameras)
+	if err != nil {
+		return nil, err
+	}
+	for id, data := range raw {
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse camera %s: %w", id, err)
+		}
+		cam := rec.Camera
+		if rec.PasswordSealed != "" {
+			if cam.Password, err = box.Open(rec.PasswordSealed); err != nil {
+				return nil, fmt.Errorf("failed to decrypt password of camera %s: %w", id, err)
+			}
+		}
+		s.cameras[id] = cam
+	}
+	return s, nil
+}
+
+// List returns every camera sorted by name.
+func (s *Store) List() []Camera {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Camera, 0, len(s.cameras))
+	for _, cam := range s.cameras {
+		out = append(out, cam)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *Store) Get(id string) (Camera, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cam, ok := s.cameras[id]
+	return cam, ok
+}
+
+// Create validates and stores a new camera, assigning its ID.
+func (s *Store) Create(cam Camera) (Camera, error) {
+	if err := cam.Validate(); err != nil {
+		return Camera{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Camera{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkStream(id, cam.Stream); err != nil {
+		return Camera{}, err
+	}
+	now := time.Now().UTC()
+	cam.ID, cam.CreatedAt, cam.UpdatedAt = id, now, now
+	if err := s.save(cam); err != nil {
+		return Camera{}, err
+	}
+	return cam, nil
+}
+
+// Update replaces a camera. An empty password keeps the stored one, so
+// clients never need to know it to change other fields.
+func (s *Store) Update(id string, cam Camera) (Camera, error) {
+	if err := cam.Validate(); err != nil {
+		return Camera{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.cameras[id]
+	if !ok {
+		return Camera{}, fmt.Errorf("camera %s not found", id)
+	}
+	if err := s.checkStream(id, cam.Stream); err != nil {
+		return Camera{}, err
+	}
+	if cam.Password == "" {
+		cam.Password = existing.Password
+	}
+	cam.ID, cam.CreatedAt, cam.UpdatedAt = id, existing.CreatedAt, time.Now().UTC()
+	if err := s.save(cam); err != nil {
+		return Camera{}, err
+	}
+	return cam, nil
+}
+
+// Delete removes a camera and returns it.
+func (s *Store) Delete(id string) (Camera, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cam, ok := s.cameras[id]
+	if !ok {
+		return Camera{}, fmt.Errorf("camera %s not found", id)
+	}
+	if err := s.db.Delete(state.BucketCameras, id); err != nil {
+		return Camera{}, err
+	}
+	delete(s.cameras, id)
+	return cam, nil
+}
+
+// checkStream rejects assigning a stream that another camera already feeds.
+// Callers must hold mu.
+func (s *Store) checkStream(id, stream string) error {
+	if stream == "" {
+		return nil
+	}
+	for _, other := range s.cameras {
+		if other.ID != id && other.Stream == stream {
+			return fmt.Errorf("stream %s is already fed by camera %s", stream, other.Name)
+		}
+	}
+	return nil
+}
+
+// save encrypts and persists a camera. Callers must hold mu.
+func (s *Store) save(cam Camera) error {
+	rec, err := s.seal(cam)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Put(state.BucketCameras, cam.ID, rec); err != nil {
+		return err
+	}
+	s.cameras[cam.ID] = cam
+	return nil
+}
+
+// seal returns the persisted form of a camera with its password encrypted.
+func (s *Store) seal(cam Camera) (record, error) {
+	rec := record{Camera: cam.Redacted()}
+	if cam.Password != "" {
+		sealed, err := s.box.Seal(cam.Password)
+		if err != nil {
+			return record{}, fmt.Errorf("failed to encrypt camera password: %w", err)
+		}
+		rec.PasswordSealed = sealed
+	}
+	return rec, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate camera ID: %w", err)
+	}
+	return "cam_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,82 @@
+package captions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCuesPerStream bounds memory used by captions for a single stream
+const maxCuesPerStream = 500
+
+// Cue is a single timed caption attached to a stream.
+type Cue struct {
+	Text     string        `json:"text"`
+	Language string        `json:"language,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (c Cue) End() time.Time {
+	return c.Start.Add(c.Duration)
+}
+
+// Store keeps the most recent caption cues per stream.
+type Store struct {
+	mu   sync.RWMutex
+	cues map[string][]Cue
+}
+
+func NewStore() *Store {
+	return &Store{cues: make(map[string][]Cue)}
+}
+
+// Add appends a cue to a stream, evicting the oldest cues beyond the limit.
+func (s *Store) Add(streamID string, cue Cue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cues := append(s.cues[streamID], cue)
+	if len(cues) > maxCuesPerStream {
+		cues = cues[len(cues)-maxCuesPerStream:]
+	}
+	s.cues[streamID] = cues
+}
+
+// Since returns the cues of a stream that end after t.
+func (s *Store) Since(streamID string, t time.Time) []Cue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []Cue
+	for _, cue := range s.cues[streamID] {
+		if cue.End().After(t) {
+			out = append(out, cue)
+		}
+	}
+	return out
+}
+
+// WebVTT renders cues as a WebVTT document. Cue times are relative to origin,
+// which is recorded in a NOTE block so players can map them to wall-clock time.
+func WebVTT(cues []Cue, origin time.Time) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	fmt.Fprintf(&b, "NOTE origin %s\n\n", origin.UTC().Format(time.RFC3339Nano))
+
+	for i, cue := range cues {
+		start := cue.Start.Sub(origin)
+		if start < 0 {
+			start = 0
+		}
+		end := cue.End().Sub(origin)
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, vttTimestamp(start), vttTimestamp(end), cue.Text)
+	}
+	return b.String()
+}
+
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, ms%1000)
+}
@@ -0,0 +1,443 @@
+package composite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWidth and DefaultHeight are the size of a composite stream
+	// unless its encoding sets one
+	DefaultWidth  = 1280
+	DefaultHeight = 720
+)
+
+// Compositor is a source combining the video of its input streams. The
+// inputs are fed to it by the sinks from Sink, and kept running through
+// acquire while it runs.
+type Compositor struct {
+	spec Spec
+	fps  int
+	// acquire keeps an input stream's source running
+	acquire  func(streamID, consumer string) (func(), error)
+	releases []func()
+	inputs   []chan media.AccessUnit
+	encoding ffmpeg.Encoding
+	cmd      *exec.Cmd
+	// feeding is set while an ffmpeg session takes input frames
+	feeding   bool
+	isRunning bool
+	// reconfigured tells the supervisor that ffmpeg was stopped to apply new
+	// settings rather than because it failed
+	reconfigured bool
+	mu           sync.RWMutex
+	stats        *stats.SourceStats
+	frames       chan media.AccessUnit
+	cancel       context.CancelFunc
+}
+
+// New creates the compositor of spec, producing fps frames per second.
+func New(spec Spec, fps int, acquire func(streamID, consumer string) (func(), error)) (*Compositor, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if fps <= 0 {
+		return nil, fmt.Errorf("composite %s: frame rate must be positive", spec.Name)
+	}
+	c := &Compositor{
+		spec:    spec,
+		fps:     fps,
+		acquire: acquire,
+		stats:   stats.NewSourceStats(),
+		frames:  make(chan media.AccessUnit, media.FrameBuffer),
+	}
+	for range spec.Inputs {
+		c.inputs = append(c.inputs, make(chan media.AccessUnit, media.FrameBuffer))
+	}
+	return c, nil
+}
+
+// Spec returns what the compositor combines.
+func (c *Compositor) Spec() Spec {
+	return c.spec
+}
+
+// SinkName is the name of the sinks feeding the compositor.
+func (c *Compositor) SinkName() string {
+	return "composite-" + c.spec.Name
+}
+
+// Sink returns the sink to attach to streamID for the compositor, or nil if
+// the stream is not one of its inputs.
+func (c *Compositor) Sink(streamID string) *Sink {
+	for i, input := range c.spec.Inputs {
+		if input == streamID {
+			return &Sink{compositor: c, index: i, name: c.SinkName(), enabled: true}
+		}
+	}
+	return nil
+}
+
+func (c *Compositor) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.isRunning {
+		c.mu.Unlock()
+		return fmt.Errorf("composite %s is already running", c.spec.Name)
+	}
+	var releases []func()
+	for _, input := range c.spec.Inputs {
+		release, err := c.acquire(input, c.SinkName())
+		if err != nil {
+			c.mu.Unlock()
+			for _, r := range releases {
+				r()
+			}
+			return fmt.Errorf("composite %s input: %w", c.spec.Name, err)
+		}
+		releases = append(releases, release)
+	}
+	c.releases = releases
+	c.isRunning = true
+	// Stop cancels the supervisor so it does not restart ffmpeg
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.mu.Unlock()
+
+	c.stats.MarkStarted()
+	c.stats.SetPipeline("transcode")
+	logrus.Infof("Starting %s composite of %v", c.spec.Layout, c.spec.Inputs)
+
+	go c.supervise(ctx)
+	return nil
+}
+
+func (c *Compositor) supervise(ctx context.Context) {
+	backoff := time.Second * 2
+	const maxBackoff = time.Second * 20
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.runOnce(ctx); err != nil {
+			logrus.Errorf("Composite %s pipeline error: %v", c.spec.Name, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if c.takeReconfigured() {
+			backoff = time.Second * 2
+			continue
+		}
+
+		c.stats.MarkRestart()
+		logrus.Infof("Composite %s restarting in %s...", c.spec.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+// runOnce runs one ffmpeg session, reading every input from a pipe of its
+// own (file descriptors 3 and up).
+func (c *Compositor) runOnce(ctx context.Context) error {
+	enc := c.Encoding()
+	width, height := enc.Width, enc.Height
+	if width == 0 {
+		width = DefaultWidth
+	}
+	if height == 0 {
+		height = DefaultHeight
+	}
+
+	var args []string
+	var readers, writers []*os.File
+	closeAll := func(files []*os.File) {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for i := range c.spec.Inputs {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeAll(readers)
+			closeAll(writers)
+			return fmt.Errorf("input pipe: %w", err)
+		}
+		readers, writers = append(readers, r), append(writers, w)
+		// Raw H.264 has no timestamps; frames are timed as they arrive
+		args = append(args,
+			"-f", "h264",
+			"-use_wallclock_as_timestamps", "1",
+			"-fflags", "nobuffer",
+			"-i", "pipe:"+strconv.Itoa(3+i),
+		)
+	}
+	args = append(args, enc.GraphArgs(c.spec.graph(width, height, c.fps), "out")...)
+	args = append(args, "-f", "h264", "pipe:1")
+
+	cmd := ffmpeg.CommandContext(ctx, args...)
+	cmd.ExtraFiles = readers
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		closeAll(readers)
+		closeAll(writers)
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		closeAll(readers)
+		closeAll(writers)
+		return fmt.Errorf("stderr pipe: %w", err)
+	}
+	err = ffmpeg.Start(cmd)
+	// ffmpeg has its own copies of the read ends
+	closeAll(readers)
+	if err != nil {
+		closeAll(writers)
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+	c.setCmd(cmd)
+	logrus.Infof("FFmpeg process started with PID: %d", cmd.Process.Pid)
+
+	sessionCtx, stopFeeding := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i, w := range writers {
+		wg.Add(1)
+		go func(input chan media.AccessUnit, w *os.File) {
+			defer wg.Done()
+			defer w.Close()
+			feed(sessionCtx, input, w)
+		}(c.inputs[i], w)
+	}
+
+	c.setFeeding(true)
+	c.streamLoop(ctx, stdout, stderr)
+
+	c.setFeeding(false)
+	stopFeeding()
+	// Unblocks writers waiting on a pipe ffmpeg no longer reads
+	cmd.Process.Kill()
+	wg.Wait()
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Warnf("FFmpeg process of composite %s exited: %v", c.spec.Name, err)
+	}
+	c.clearCmd()
+	return nil
+}
+
+// feed writes an input's access units to ffmpeg from its next keyframe on,
+// as nothing before it can be decoded.
+func feed(ctx context.Context, input chan media.AccessUnit, w io.Writer) {
+	// Frames queued before the session are stale
+	for drained := false; !drained; {
+		select {
+		case <-input:
+		default:
+			drained = true
+		}
+	}
+	started := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case au := <-input:
+			if !started && !au.Keyframe {
+				continue
+			}
+			started = true
+			if _, err := w.Write(au.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Compositor) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Debugf("FFmpeg (composite %s): %s", c.spec.Name, scanner.Text())
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(media.SplitH264Frames)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		frameData := scanner.Bytes()
+		if len(frameData) == 0 {
+			continue
+		}
+		c.stats.RecordFrame(frameData)
+		timestamp := uint32(time.Now().UnixNano() / 1000000)
+		media.Send(c.frames, media.NewAccessUnit(frameData, timestamp))
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Errorf("Error reading from FFmpeg stdout (composite %s): %v", c.spec.Name, err)
+	}
+}
+
+// write queues an input's access unit for the running ffmpeg session.
+func (c *Compositor) write(index int, au media.AccessUnit) {
+	c.mu.RLock()
+	feeding := c.feeding
+	c.mu.RUnlock()
+	if feeding {
+		media.Send(c.inputs[index], au)
+	}
+}
+
+func (c *Compositor) setFeeding(v bool) {
+	c.mu.Lock()
+	c.feeding = v
+	c.mu.Unlock()
+}
+
+func (c *Compositor) setCmd(cmd *exec.Cmd) {
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+}
+
+func (c *Compositor) clearCmd() {
+	c.mu.Lock()
+	c.cmd = nil
+	c.mu.Unlock()
+}
+
+// Encoding returns the encoder settings; Width and Height are the size of
+// the composite picture.
+func (c *Compositor) Encoding() ffmpeg.Encoding {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.encoding
+}
+
+// SetEncoding changes the encoder settings and picture size. A running
+// ffmpeg is restarted right away with them.
+func (c *Compositor) SetEncoding(enc ffmpeg.Encoding) error {
+	if err := enc.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoding = enc
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.reconfigured = true
+		c.cmd.Process.Kill()
+		logrus.Infof("Restarting composite %s with new encoding: %+v", c.spec.Name, enc)
+	}
+	return nil
+}
+
+// takeReconfigured reports whether the last ffmpeg session was ended by
+// SetEncoding, and clears it.
+func (c *Compositor) takeReconfigured() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reconfigured := c.reconfigured
+	c.reconfigured = false
+	return reconfigured
+}
+
+func (c *Compositor) Stop() error {
+	c.mu.Lock()
+	if !c.isRunning {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	if c.cmd != nil {
+		c.cmd.Process.Kill()
+	}
+	releases := c.releases
+	c.releases = nil
+	c.isRunning = false
+	c.mu.Unlock()
+
+	for _, release := range releases {
+		release()
+	}
+	c.stats.MarkStopped()
+	logrus.Infof("Composite %s stopped", c.spec.Name)
+	return nil
+}
+
+func (c *Compositor) IsRunning() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isRunning
+}
+
+// Health returns a snapshot of the composite's throughput counters.
+func (c *Compositor) Health() stats.Snapshot {
+	return c.stats.Snapshot()
+}
+
+// Frames returns the access units of the composite picture. The channel is
+// never closed; frames are dropped while nobody is reading.
+func (c *Compositor) Frames() <-chan media.AccessUnit {
+	return c.frames
+}
+
+// Sink feeds one input stream to a compositor. It is a source.FrameSink.
+type Sink struct {
+	compositor *Compositor
+	index      int
+	name       string
+	mu         sync.RWMutex
+	enabled    bool
+}
+
+func (s *Sink) Name() string { return s.name }
+
+func (s *Sink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.enabled = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Sink) Stop() error {
+	s.mu.Lock()
+	s.enabled = false
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Sink) IsRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled
+}
+
+func (s *Sink) WriteAccessUnit(au media.AccessUnit) {
+	s.compositor.write(s.index, au)
+}
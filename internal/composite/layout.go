@@ -0,0 +1,172 @@
+// Package composite combines several streams into one, as a mosaic or as
+// picture-in-picture, with an ffmpeg filter graph.
+package composite
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Layout arranges the inputs of a composite stream.
+type Layout string
+
+const (
+	// LayoutMosaic tiles the inputs in a grid, in order, left to right and
+	// top to bottom
+	LayoutMosaic Layout = "mosaic"
+	// LayoutPiP shows the first input in full and the others as insets in
+	// the bottom right, bottom left, top right, and top left corners
+	LayoutPiP Layout = "pip"
+)
+
+const (
+	// maxMosaicInputs keeps tiles large enough to make out
+	maxMosaicInputs = 16
+	// maxPiPInputs is the full picture and one inset per corner
+	maxPiPInputs = 5
+)
+
+// namePattern keeps composite stream names usable in API paths
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Spec describes a composite stream.
+type Spec struct {
+	Name   string   `json:"name"`
+	Layout Layout   `json:"layout"`
+	Inputs []string `json:"inputs"`
+}
+
+// String returns the spec as written in COMPOSITES, without the name.
+func (s Spec) String() string {
+	return string(s.Layout) + ":" + strings.Join(s.Inputs, "+")
+}
+
+// ParseSpecs reads composite streams configured as
+// "name=layout:input+input,...", e.g. "wall=mosaic:lobby+dock+rtsp".
+func ParseSpecs(spec string) ([]Spec, error) {
+	var specs []Spec
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, def, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid composite %q, expected name=layout:input+input", entry)
+		}
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid composite name %q, use letters, digits, '-' and '_'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("composite %s is listed twice", name)
+		}
+		seen[name] = true
+
+		layout, inputs, ok := strings.Cut(def, ":")
+		if !ok {
+			return nil, fmt.Errorf("composite %s needs a layout and inputs, e.g. mosaic:lobby+dock", name)
+		}
+		s := Spec{Name: name, Layout: Layout(strings.ToLower(strings.TrimSpace(layout)))}
+		for _, input := range strings.Split(inputs, "+") {
+			if input = strings.ToLower(strings.TrimSpace(input)); input != "" {
+				s.Inputs = append(s.Inputs, input)
+			}
+		}
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// Validate checks the layout and that the inputs fit it.
+func (s Spec) Validate() error {
+	limit := 0
+	switch s.Layout {
+	case LayoutMosaic:
+		limit = maxMosaicInputs
+	case LayoutPiP:
+		limit = maxPiPInputs
+	default:
+		return fmt.Errorf("composite %s: unknown layout %q, use mosaic or pip", s.Name, s.Layout)
+	}
+	if len(s.Inputs) < 2 {
+		return fmt.Errorf("composite %s needs at least two inputs", s.Name)
+	}
+	if len(s.Inputs) > limit {
+		return fmt.Errorf("composite %s: %s takes at most %d inputs", s.Name, s.Layout, limit)
+	}
+	seen := make(map[string]bool)
+	for _, input := range s.Inputs {
+		if input == s.Name {
+			return fmt.Errorf("composite %s cannot show itself", s.Name)
+		}
+		if seen[input] {
+			return fmt.Errorf("composite %s lists %s twice", s.Name, input)
+		}
+		seen[input] = true
+	}
+	return nil
+}
+
+// graph returns the filter graph combining the inputs into a width x height
+// picture at fps, labelled "out". Inputs keep their aspect ratio, padded
+// with black.
+func (s Spec) graph(width, height, fps int) string {
+	var chains []string
+	switch s.Layout {
+	case LayoutPiP:
+		chains = append(chains, fmt.Sprintf("[0:v]%s,%s,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1[b0]",
+			timing(fps), fit(width, height), width, height))
+		insetWidth := even(width / 4)
+		margin := even(width / 40)
+		corners := []string{
+			fmt.Sprintf("main_w-overlay_w-%d:main_h-overlay_h-%d", margin, margin),
+			fmt.Sprintf("%d:main_h-overlay_h-%d", margin, margin),
+			fmt.Sprintf("main_w-overlay_w-%d:%d", margin, margin),
+			fmt.Sprintf("%d:%d", margin, margin),
+		}
+		for i := 1; i < len(s.Inputs); i++ {
+			chains = append(chains,
+				fmt.Sprintf("[%d:v]%s,scale=%d:-2,setsar=1[v%d]", i, timing(fps), insetWidth, i),
+				fmt.Sprintf("[b%d][v%d]overlay=%s[b%d]", i-1, i, corners[i-1], i))
+		}
+	default:
+		cols := int(math.Ceil(math.Sqrt(float64(len(s.Inputs)))))
+		rows := (len(s.Inputs) + cols - 1) / cols
+		tileWidth, tileHeight := even(width/cols), even(height/rows)
+		tile := fmt.Sprintf("%s,%s,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+			timing(fps), fit(tileWidth, tileHeight), tileWidth, tileHeight)
+		// The first tile, in the top left corner, is padded to the whole
+		// picture for the others to be drawn onto
+		chains = append(chains, fmt.Sprintf("[0:v]%s,pad=%d:%d:0:0[b0]", tile, width, height))
+		for i := 1; i < len(s.Inputs); i++ {
+			x, y := (i%cols)*tileWidth, (i/cols)*tileHeight
+			chains = append(chains,
+				fmt.Sprintf("[%d:v]%s[v%d]", i, tile, i),
+				fmt.Sprintf("[b%d][v%d]overlay=%d:%d[b%d]", i-1, i, x, y, i))
+		}
+	}
+	chains = append(chains, fmt.Sprintf("[b%d]format=yuv420p[out]", len(s.Inputs)-1))
+	return strings.Join(chains, ";")
+}
+
+// timing restarts an input's timestamps at zero, so inputs that started at
+// different times line up, and evens out its frame rate.
+func timing(fps int) string {
+	return fmt.Sprintf("setpts=PTS-STARTPTS,fps=%d", fps)
+}
+
+// fit scales a picture to fit width x height, keeping its aspect ratio.
+func fit(width, height int) string {
+	return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", width, height)
+}
+
+func even(n int) int {
+	return n &^ 1
+}
@@ -1,19 +1,55 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// defaultSTUNURLs are Google's public STUN servers
+const defaultSTUNURLs = "stun:stun.l.google.com:19302,stun:stun1.l.google.com:19302,stun:stun2.l.google.com:19302,stun:stun3.l.google.com:19302,stun:stun4.l.google.com:19302"
+
 type Config struct {
-	HTTP   HTTPConfig   `json:"http"`
-	RTMP   RTMPConfig   `json:"rtmp"`
-	RTSP   RTSPConfig   `json:"rtsp"`
-	Source SourceConfig `json:"source"`
+	HTTP      HTTPConfig      `json:"http"`
+	RTMP      RTMPConfig      `json:"rtmp"`
+	RTSP      RTSPConfig      `json:"rtsp"`
+	Source    SourceConfig    `json:"source"`
+	Audio     AudioConfig     `json:"audio"`
+	Storage   StorageConfig   `json:"storage"`
+	Recording RecordingConfig `json:"recording"`
+	Health    HealthConfig    `json:"health"`
+	Events    EventsConfig    `json:"events"`
+	Analytics AnalyticsConfig `json:"analytics"`
+	Usage     UsageConfig     `json:"usage"`
+	Auth      AuthConfig      `json:"auth"`
+	WebRTC    WebRTCConfig    `json:"webrtc"`
+	FFmpeg    FFmpegConfig    `json:"ffmpeg"`
+	Uplink    UplinkConfig    `json:"uplink"`
+	WHIP      WHIPConfig      `json:"whip"`
+	SIP       SIPConfig       `json:"sip"`
+	// FeatureFlags turns experimental subsystems on or off, as
+	// comma-separated name=true|false pairs
+	FeatureFlags string `json:"feature_flags"`
 }
 
 type HTTPConfig struct {
-	Port int `json:"port"`
+	Port        int    `json:"port"`
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	// SinglePort serves HTTP(S), ICE-TCP, and ICE-UDP on one port instead of Port
+	SinglePort          int    `json:"single_port"`
+	SinglePortPublicIPs string `json:"single_port_public_ips"` // comma-separated
+	// TrustedProxies are the reverse proxies (comma-separated IPs or CIDRs)
+	// whose RealIPHeaders (comma-separated, in order) name the client
+	TrustedProxies string `json:"trusted_proxies"`
+	RealIPHeaders  string `json:"real_ip_headers"`
+	// StaticCacheSeconds is how long browsers reuse the web client's assets
+	StaticCacheSeconds int `json:"static_cache_seconds"`
+	// AppAPIBase and AppFeatures (comma-separated name=true|false) are
+	// handed to the web client on /app-config.json
+	AppAPIBase  string `json:"app_api_base"`
+	AppFeatures string `json:"app_features"`
 }
 
 type RTMPConfig struct {
@@ -23,34 +59,468 @@ type RTMPConfig struct {
 
 type RTSPConfig struct {
 	URL string `json:"url"`
+	// Upstreams are interchangeable restreamers (comma-separated host:port);
+	// sources pointing at any of them use a healthy one
+	Upstreams            string `json:"upstreams"`
+	UpstreamCheckSeconds int    `json:"upstream_check_seconds"`
+	// PathTemplate rewrites the URL of the rtsp stream; StreamPathTemplates
+	// ("stream=template,...") add RTSP streams with templates of their own
+	PathTemplate        string `json:"path_template"`
+	StreamPathTemplates string `json:"stream_path_templates"`
 }
 
 type SourceConfig struct {
-	Type string `json:"type"` // "rtmp" or "rtsp"
-	URL  string `json:"url"`
+	Type    string `json:"type"` // "rtmp" or "rtsp"
+	URL     string `json:"url"`
+	Streams string `json:"streams"` // name=url pairs, comma-separated
+	// StdinPath feeds the stdin source from a named pipe, "-" for standard input
+	StdinPath string `json:"stdin_path"`
+	// Composites combine streams into a mosaic or picture-in-picture
+	Composites         string `json:"composites"` // name=layout:input+input pairs, comma-separated
+	CompositeFPS       int    `json:"composite_fps"`
+	OnDemand           bool   `json:"on_demand"`
+	IdleTimeoutSeconds int    `json:"idle_timeout_seconds"`
+}
+
+type AudioConfig struct {
+	LevelsEnabled    bool    `json:"levels_enabled"`
+	LevelIntervalMS  int     `json:"level_interval_ms"`
+	SilenceThreshold float64 `json:"silence_threshold_dbfs"`
+	SilenceSeconds   int     `json:"silence_seconds"`
+	// Opus encoding of audio delivered to viewers
+	OpusEnabled             bool `json:"opus_enabled"`
+	OpusBitrateKbps         int  `json:"opus_bitrate_kbps"`
+	OpusFEC                 bool `json:"opus_fec"`
+	OpusExpectedLossPercent int  `json:"opus_expected_loss_percent"`
+	OpusDTX                 bool `json:"opus_dtx"`
+	OpusStereo              bool `json:"opus_stereo"`
+	// Alignment of audio with video for viewers
+	AVSyncOffsetMS        int    `json:"av_sync_offset_ms"`
+	AVSyncStreamOffsets   string `json:"av_sync_stream_offsets"` // stream=ms, comma-separated
+	AVSyncAutoCorrect     bool   `json:"av_sync_auto_correct"`
+	AVSyncMaxCorrectionMS int    `json:"av_sync_max_correction_ms"`
+	// Bitrate of the audio-only MP3/AAC HTTP streams
+	StreamBitrateKbps int `json:"stream_bitrate_kbps"`
+}
+
+type StorageConfig struct {
+	DataDir   string `json:"data_dir"`
+	MediaDir  string `json:"media_dir"`
+	QuotaMB   int    `json:"quota_mb"`
+	MinFreeMB int    `json:"min_free_mb"`
+	Policy    string `json:"policy"` // "rotate" or "stop"
+	// SecretKey encrypts stored credentials; base64, generated in DataDir if empty
+	SecretKey string `json:"-"`
+	// SecretKeyCommand prints SecretKey instead, e.g. by decrypting it with a KMS
+	SecretKeyCommand string `json:"secret_key_command"`
+}
+
+type RecordingConfig struct {
+	SegmentSeconds int    `json:"segment_seconds"`
+	Schedules      string `json:"schedules"`  // see recording.ParseSchedules
+	Renditions     string `json:"renditions"` // see recording.ParseRenditions
+	URLs           string `json:"-"`          // stream=url pairs, comma-separated
+	// Time-lapses sampled from startup, as stream=seconds pairs; other
+	// streams sample every TimelapseIntervalSeconds once enabled
+	TimelapseStreams         string `json:"timelapse_streams"`
+	TimelapseIntervalSeconds int    `json:"timelapse_interval_seconds"`
+	TimelapseAssembleMinutes int    `json:"timelapse_assemble_minutes"`
+	TimelapseFPS             int    `json:"timelapse_fps"`
+}
+
+type HealthConfig struct {
+	IntervalSeconds    int     `json:"interval_seconds"`
+	DegradedThreshold  float64 `json:"degraded_threshold"`
+	UnhealthyThreshold float64 `json:"unhealthy_threshold"`
+	WebhookURL         string  `json:"webhook_url"`
+}
+
+type EventsConfig struct {
+	HistorySize  int    `json:"history_size"`
+	WebhookURL   string `json:"webhook_url"`
+	WebhookTypes string `json:"webhook_types"` // comma-separated, empty for all
+}
+
+// AnalyticsConfig sets the frames analytics sidecars receive unless they ask
+// for others.
+type AnalyticsConfig struct {
+	FPS   float64 `json:"fps"`
+	Width int     `json:"width"`
+	// OverlayStreams get detections drawn onto their video
+	OverlayStreams string  `json:"overlay_streams"` // comma-separated, "*" for all
+	OverlaySeconds float64 `json:"overlay_seconds"`
+}
+
+// UsageConfig sets how bandwidth usage is accounted.
+type UsageConfig struct {
+	PersistSeconds int `json:"persist_seconds"`
+	// TenantTag is the session tag whose value names a viewer's tenant
+	TenantTag string `json:"tenant_tag"`
+}
+
+type AuthConfig struct {
+	Tokens string `json:"-"` // comma-separated
+	// AdminToken guards the endpoints that expose the install, such as
+	// debug bundles; empty disables them
+	AdminToken            string `json:"-"`
+	WebhookURL            string `json:"webhook_url"`
+	WebhookTimeoutSeconds int    `json:"webhook_timeout_seconds"`
+	// Viewers re-authenticate over the data channel after SessionMaxSeconds
+	// (0 = never), or are disconnected SessionReauthGraceSeconds later
+	SessionMaxSeconds         int `json:"session_max_seconds"`
+	SessionReauthGraceSeconds int `json:"session_reauth_grace_seconds"`
+}
+
+type WebRTCConfig struct {
+	VideoCodecs                   string  `json:"video_codecs"` // see webrtc.ParseVideoCodecs
+	OpusFmtp                      string  `json:"opus_fmtp"`    // empty derives it from the Opus encoder options
+	ICERestartEnabled             bool    `json:"ice_restart_enabled"`
+	ICERestartLossThreshold       float64 `json:"ice_restart_loss_threshold"`
+	ICERestartLossSeconds         int     `json:"ice_restart_loss_seconds"`
+	ICERestartDisconnectedSeconds int     `json:"ice_restart_disconnected_seconds"`
+	ICERestartMaxAttempts         int     `json:"ice_restart_max_attempts"`
+	DowngradeEnabled              bool    `json:"downgrade_enabled"`
+	DowngradeLossThreshold        float64 `json:"downgrade_loss_threshold"`
+	DowngradeLossSeconds          int     `json:"downgrade_loss_seconds"`
+	DowngradeRecoverSeconds       int     `json:"downgrade_recover_seconds"`
+	DowngradeWidth                int     `json:"downgrade_width"`
+	DowngradeBitrateKbps          int     `json:"downgrade_bitrate_kbps"`
+	RTCPStaleSeconds              int     `json:"rtcp_stale_seconds"`       // 0 disables stale detection
+	RTCPStaleCloseSeconds         int     `json:"rtcp_stale_close_seconds"` // 0 keeps stale peers
+	RTCPSenderReportIntervalMS    int     `json:"rtcp_sender_report_interval_ms"`
+	KeyframeRequestIntervalMS     int     `json:"keyframe_request_interval_ms"`
+	KeyframeMinDistanceMS         int     `json:"keyframe_min_distance_ms"`
+	QualityMinFPS                 float64 `json:"quality_min_fps"`
+	QualityMaxJitterBufferMS      float64 `json:"quality_max_jitter_buffer_ms"`
+	RelayOnlyStreams              string  `json:"relay_only_streams"` // comma-separated, "*" for all
+	PeerMaxBitrateKbps            int     `json:"peer_max_bitrate_kbps"`
+	PeerResumeGraceSeconds        int     `json:"peer_resume_grace_seconds"`
+	LiveEdgeEnabled               bool    `json:"live_edge_enabled"` // for all viewers, not only those asking
+	LiveEdgeDropNonReference      int     `json:"live_edge_drop_non_reference"`
+	LiveEdgeMaxQueuedFrames       int     `json:"live_edge_max_queued_frames"`
+	STUNURLs                      string  `json:"stun_urls"` // comma-separated
+	TURNURL                       string  `json:"turn_url"`
+	TURNUsername                  string  `json:"turn_username"`
+	TURNPassword                  string  `json:"-"`
+	TURNSecret                    string  `json:"-"`
+	TURNCredentialTTLSeconds      int     `json:"turn_credential_ttl_seconds"`
+	ICEDisconnectedTimeoutMS      int     `json:"ice_disconnected_timeout_ms"`
+	ICEFailedTimeoutMS            int     `json:"ice_failed_timeout_ms"`
+	ICEKeepaliveIntervalMS        int     `json:"ice_keepalive_interval_ms"`
+	ImpairmentEnabled             bool    `json:"impairment_enabled"` // testing only
+	ImpairmentLossPercent         float64 `json:"impairment_loss_percent"`
+	ImpairmentLatencyMS           int     `json:"impairment_latency_ms"`
+	ImpairmentJitterMS            int     `json:"impairment_jitter_ms"`
+	MaxViewers                    int     `json:"max_viewers"`
+	StreamMaxViewers              string  `json:"stream_max_viewers"` // "stream=N,stream2=M"
+	DTLSCertFile                  string  `json:"dtls_cert_file"`     // empty generates one in DataDir
+	SelfTestEnabled               bool    `json:"self_test_enabled"`  // /readyz fails until it passes
+	SelfTestTimeoutSeconds        int     `json:"self_test_timeout_seconds"`
+	SelfTestRetrySeconds          int     `json:"self_test_retry_seconds"`
+	// Limits of viewers' data channel messages; a viewer whose messages are
+	// refused DataChannelMaxViolations times is disconnected (0 = never)
+	DataChannelMaxMessageBytes int     `json:"datachannel_max_message_bytes"`
+	DataChannelRatePerSecond   float64 `json:"datachannel_rate_per_second"`
+	DataChannelBurst           int     `json:"datachannel_burst"`
+	DataChannelMaxViolations   int     `json:"datachannel_max_violations"`
+}
+
+type FFmpegConfig struct {
+	Nice            int    `json:"nice"`
+	CPUAffinity     string `json:"cpu_affinity"` // e.g. "2-3,6"
+	Threads         int    `json:"threads"`
+	Cgroup          string `json:"cgroup"`
+	CgroupCPUMax    string `json:"cgroup_cpu_max"`
+	CgroupMemoryMax string `json:"cgroup_memory_max"`
+	// Encoder is the default video encoder, e.g. "libx264" or "auto"
+	Encoder string `json:"encoder"`
+	// Board selects board-specific pipelines: auto, generic,
+	// raspberry_pi, or jetson
+	Board string `json:"board"`
+}
+
+// UplinkConfig sets how edge instances push streams to a central one.
+type UplinkConfig struct {
+	// URL is the uplink endpoint of the central instance to push to; empty
+	// on instances that do not push
+	URL   string `json:"url"`
+	Token string `json:"-"`
+	// Streams are the local streams pushed, as comma-separated
+	// local[=remote] names
+	Streams string `json:"streams"`
+	// IngestTokens (comma-separated) are accepted from edge instances
+	// pushing to this one; empty refuses all uplinks
+	IngestTokens string `json:"-"`
+}
+
+// WHIPConfig sets which publishers may push streams over WHIP.
+type WHIPConfig struct {
+	// Tokens (comma-separated) are accepted from WHIP publishers; empty
+	// refuses all of them
+	Tokens string `json:"-"`
+}
+
+// SIPConfig sets how door stations and intercoms call in over SIP.
+type SIPConfig struct {
+	Enabled bool `json:"enabled"`
+	// Listen is the UDP address SIP is received on
+	Listen string `json:"listen"`
+	// PublicIP is advertised to door stations; detected when empty
+	PublicIP string `json:"public_ip"`
+	// Server is the SIP server to register with and call through; empty
+	// takes calls directly
+	Server                string `json:"server"`
+	User                  string `json:"user"`
+	Password              string `json:"-"`
+	Domain                string `json:"domain"`
+	RegisterExpirySeconds int    `json:"register_expiry_seconds"`
+	AutoAnswer            bool   `json:"auto_answer"`
+	RingTimeoutSeconds    int    `json:"ring_timeout_seconds"`
+	// AllowedCallers (comma-separated) are the SIP users, user@host
+	// addresses, hosts, or IP addresses calls are taken from
+	AllowedCallers string `json:"allowed_callers"`
+	// DialTargets (comma-separated) are further SIP users, user@host
+	// addresses, hosts, or IP addresses calls may be made to
+	DialTargets string `json:"dial_targets"`
+	// Stream names the stream calls are bridged into
+	Stream string `json:"stream"`
 }
 
 func Load() (*Config, error) {
+	secrets := &secretLoader{}
 	cfg := &Config{
 		HTTP: HTTPConfig{
-			Port: getEnvAsInt("HTTP_PORT", 8080),
+			Port:                getEnvAsInt("HTTP_PORT", 8080),
+			TLSCertFile:         getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),
+			SinglePort:          getEnvAsInt("SINGLE_PORT", 0),
+			SinglePortPublicIPs: getEnv("SINGLE_PORT_PUBLIC_IPS", ""),
+			TrustedProxies:      getEnv("TRUSTED_PROXIES", ""),
+			RealIPHeaders:       getEnv("REAL_IP_HEADERS", "X-Forwarded-For,X-Real-IP"),
+			StaticCacheSeconds:  getEnvAsInt("STATIC_CACHE_SECONDS", 3600),
+			AppAPIBase:          getEnv("APP_API_BASE", "/api"),
+			AppFeatures:         getEnv("APP_FEATURES", ""),
 		},
 		RTMP: RTMPConfig{
 			Port: getEnvAsInt("RTMP_PORT", 1936),
-			URL:  getEnv("RTMP_URL", ""),
+			URL:  secrets.get("RTMP_URL", ""),
 		},
 		RTSP: RTSPConfig{
-			URL: getEnv("RTSP_URL", ""),
+			URL:                  secrets.get("RTSP_URL", ""),
+			Upstreams:            getEnv("RTSP_UPSTREAMS", ""),
+			UpstreamCheckSeconds: getEnvAsInt("RTSP_UPSTREAM_CHECK_SECONDS", 5),
+			PathTemplate:         getEnv("RTSP_PATH_TEMPLATE", ""),
+			StreamPathTemplates:  getEnv("RTSP_STREAM_PATH_TEMPLATES", ""),
 		},
 		Source: SourceConfig{
-			Type: getEnv("SOURCE_TYPE", ""),
-			URL:  getEnv("SOURCE_URL", ""),
+			Type:               getEnv("SOURCE_TYPE", ""),
+			URL:                secrets.get("SOURCE_URL", ""),
+			Streams:            secrets.get("STREAMS", ""),
+			StdinPath:          getEnv("STDIN_PATH", ""),
+			Composites:         getEnv("COMPOSITES", ""),
+			CompositeFPS:       getEnvAsInt("COMPOSITE_FPS", 15),
+			OnDemand:           getEnvAsBool("SOURCE_ON_DEMAND", false),
+			IdleTimeoutSeconds: getEnvAsInt("SOURCE_IDLE_TIMEOUT_SECONDS", 30),
+		},
+		Audio: AudioConfig{
+			LevelsEnabled:           getEnvAsBool("AUDIO_LEVELS_ENABLED", false),
+			LevelIntervalMS:         getEnvAsInt("AUDIO_LEVEL_INTERVAL_MS", 500),
+			SilenceThreshold:        getEnvAsFloat("AUDIO_SILENCE_THRESHOLD_DBFS", -50),
+			SilenceSeconds:          getEnvAsInt("AUDIO_SILENCE_SECONDS", 10),
+			OpusEnabled:             getEnvAsBool("AUDIO_OPUS_ENABLED", true),
+			OpusBitrateKbps:         getEnvAsInt("AUDIO_OPUS_BITRATE_KBPS", 32),
+			OpusFEC:                 getEnvAsBool("AUDIO_OPUS_FEC", true),
+			OpusExpectedLossPercent: getEnvAsInt("AUDIO_OPUS_EXPECTED_LOSS_PERCENT", 10),
+			OpusDTX:                 getEnvAsBool("AUDIO_OPUS_DTX", false),
+			OpusStereo:              getEnvAsBool("AUDIO_OPUS_STEREO", false),
+			AVSyncOffsetMS:          getEnvAsInt("AV_SYNC_OFFSET_MS", 0),
+			AVSyncStreamOffsets:     getEnv("AV_SYNC_STREAM_OFFSETS", ""),
+			AVSyncAutoCorrect:       getEnvAsBool("AV_SYNC_AUTO_CORRECT", true),
+			AVSyncMaxCorrectionMS:   getEnvAsInt("AV_SYNC_MAX_CORRECTION_MS", 500),
+			StreamBitrateKbps:       getEnvAsInt("AUDIO_STREAM_BITRATE_KBPS", 128),
+		},
+		Storage: StorageConfig{
+			DataDir:          getEnv("DATA_DIR", "data"),
+			MediaDir:         getEnv("MEDIA_DIR", "media"),
+			QuotaMB:          getEnvAsInt("STORAGE_QUOTA_MB", 0),
+			MinFreeMB:        getEnvAsInt("STORAGE_MIN_FREE_MB", 1024),
+			SecretKey:        secrets.get("SECRET_KEY", ""),
+			SecretKeyCommand: getEnv("SECRET_KEY_COMMAND", ""),
+			Policy:           getEnv("STORAGE_FULL_POLICY", "rotate"),
+		},
+		Recording: RecordingConfig{
+			SegmentSeconds: getEnvAsInt("RECORDING_SEGMENT_SECONDS", 60),
+			Schedules:      getEnv("RECORDING_SCHEDULES", ""),
+			Renditions:     getEnv("RECORDING_RENDITIONS", ""),
+			URLs:           secrets.get("RECORDING_URLS", ""),
+
+			TimelapseStreams:         getEnv("TIMELAPSE_STREAMS", ""),
+			TimelapseIntervalSeconds: getEnvAsInt("TIMELAPSE_INTERVAL_SECONDS", 60),
+			TimelapseAssembleMinutes: getEnvAsInt("TIMELAPSE_ASSEMBLE_MINUTES", 60),
+			TimelapseFPS:             getEnvAsInt("TIMELAPSE_FPS", 30),
+		},
+		Health: HealthConfig{
+			IntervalSeconds:    getEnvAsInt("HEALTH_CHECK_INTERVAL_SECONDS", 10),
+			DegradedThreshold:  getEnvAsFloat("HEALTH_DEGRADED_THRESHOLD", 70),
+			UnhealthyThreshold: getEnvAsFloat("HEALTH_UNHEALTHY_THRESHOLD", 40),
+			WebhookURL:         secrets.get("HEALTH_WEBHOOK_URL", ""),
+		},
+		Events: EventsConfig{
+			HistorySize:  getEnvAsInt("EVENTS_HISTORY_SIZE", 256),
+			WebhookURL:   secrets.get("EVENTS_WEBHOOK_URL", ""),
+			WebhookTypes: getEnv("EVENTS_WEBHOOK_TYPES", ""),
 		},
+		Analytics: AnalyticsConfig{
+			FPS:            getEnvAsFloat("ANALYTICS_FPS", 2),
+			Width:          getEnvAsInt("ANALYTICS_WIDTH", 640),
+			OverlayStreams: getEnv("ANALYTICS_OVERLAY_STREAMS", ""),
+			OverlaySeconds: getEnvAsFloat("ANALYTICS_OVERLAY_SECONDS", 2),
+		},
+		Usage: UsageConfig{
+			PersistSeconds: getEnvAsInt("USAGE_PERSIST_SECONDS", 60),
+			TenantTag:      getEnv("USAGE_TENANT_TAG", "tenant"),
+		},
+		Auth: AuthConfig{
+			Tokens:                    secrets.get("AUTH_TOKENS", ""),
+			AdminToken:                secrets.get("ADMIN_TOKEN", ""),
+			WebhookURL:                secrets.get("AUTH_WEBHOOK_URL", ""),
+			WebhookTimeoutSeconds:     getEnvAsInt("AUTH_WEBHOOK_TIMEOUT_SECONDS", 5),
+			SessionMaxSeconds:         getEnvAsInt("SESSION_MAX_SECONDS", 0),
+			SessionReauthGraceSeconds: getEnvAsInt("SESSION_REAUTH_GRACE_SECONDS", 60),
+		},
+		WebRTC: WebRTCConfig{
+			VideoCodecs:                   getEnv("WEBRTC_VIDEO_CODECS", "h264:42e01f"),
+			OpusFmtp:                      getEnv("WEBRTC_OPUS_FMTP", ""),
+			ICERestartEnabled:             getEnvAsBool("ICE_RESTART_ENABLED", true),
+			ICERestartLossThreshold:       getEnvAsFloat("ICE_RESTART_LOSS_THRESHOLD", 0.1),
+			ICERestartLossSeconds:         getEnvAsInt("ICE_RESTART_LOSS_SECONDS", 10),
+			ICERestartDisconnectedSeconds: getEnvAsInt("ICE_RESTART_DISCONNECTED_SECONDS", 3),
+			ICERestartMaxAttempts:         getEnvAsInt("ICE_RESTART_MAX_ATTEMPTS", 2),
+			DowngradeEnabled:              getEnvAsBool("DOWNGRADE_ENABLED", true),
+			DowngradeLossThreshold:        getEnvAsFloat("DOWNGRADE_LOSS_THRESHOLD", 0.05),
+			DowngradeLossSeconds:          getEnvAsInt("DOWNGRADE_LOSS_SECONDS", 5),
+			DowngradeRecoverSeconds:       getEnvAsInt("DOWNGRADE_RECOVER_SECONDS", 30),
+			DowngradeWidth:                getEnvAsInt("DOWNGRADE_WIDTH", 640),
+			DowngradeBitrateKbps:          getEnvAsInt("DOWNGRADE_BITRATE_KBPS", 500),
+			RTCPStaleSeconds:              getEnvAsInt("RTCP_STALE_SECONDS", 10),
+			RTCPStaleCloseSeconds:         getEnvAsInt("RTCP_STALE_CLOSE_SECONDS", 20),
+			RTCPSenderReportIntervalMS:    getEnvAsInt("RTCP_SENDER_REPORT_INTERVAL_MS", 1000),
+			KeyframeRequestIntervalMS:     getEnvAsInt("KEYFRAME_REQUEST_INTERVAL_MS", 1000),
+			KeyframeMinDistanceMS:         getEnvAsInt("KEYFRAME_MIN_DISTANCE_MS", 500),
+			QualityMinFPS:                 getEnvAsFloat("QUALITY_MIN_FPS", 15),
+			QualityMaxJitterBufferMS:      getEnvAsFloat("QUALITY_MAX_JITTER_BUFFER_MS", 500),
+			RelayOnlyStreams:              getEnv("RELAY_ONLY_STREAMS", ""),
+			PeerMaxBitrateKbps:            getEnvAsInt("PEER_MAX_BITRATE_KBPS", 0),
+			PeerResumeGraceSeconds:        getEnvAsInt("PEER_RESUME_GRACE_SECONDS", 10),
+			LiveEdgeEnabled:               getEnvAsBool("LIVE_EDGE_ENABLED", false),
+			LiveEdgeDropNonReference:      getEnvAsInt("LIVE_EDGE_DROP_NON_REFERENCE", 3),
+			LiveEdgeMaxQueuedFrames:       getEnvAsInt("LIVE_EDGE_MAX_QUEUED_FRAMES", 30),
+			STUNURLs:                      getEnv("STUN_URLS", defaultSTUNURLs),
+			TURNURL:                       getEnv("TURN_URL", "turn:127.0.0.1:3478"),
+			TURNUsername:                  getEnv("TURN_USERNAME", "webrtc"),
+			TURNPassword:                  secrets.get("TURN_PASSWORD", "webrtc123"),
+			TURNSecret:                    secrets.get("TURN_SECRET", ""),
+			TURNCredentialTTLSeconds:      getEnvAsInt("TURN_CREDENTIAL_TTL_SECONDS", 3600),
+			ICEDisconnectedTimeoutMS:      getEnvAsInt("ICE_DISCONNECTED_TIMEOUT_MS", 5000),
+			ICEFailedTimeoutMS:            getEnvAsInt("ICE_FAILED_TIMEOUT_MS", 25000),
+			ICEKeepaliveIntervalMS:        getEnvAsInt("ICE_KEEPALIVE_INTERVAL_MS", 2000),
+			ImpairmentEnabled:             getEnvAsBool("IMPAIRMENT_ENABLED", false),
+			ImpairmentLossPercent:         getEnvAsFloat("IMPAIRMENT_LOSS_PERCENT", 0),
+			ImpairmentLatencyMS:           getEnvAsInt("IMPAIRMENT_LATENCY_MS", 0),
+			ImpairmentJitterMS:            getEnvAsInt("IMPAIRMENT_JITTER_MS", 0),
+			MaxViewers:                    getEnvAsInt("MAX_VIEWERS", 0),
+			StreamMaxViewers:              getEnv("STREAM_MAX_VIEWERS", ""),
+			DTLSCertFile:                  getEnv("DTLS_CERT_FILE", ""),
+			SelfTestEnabled:               getEnvAsBool("SELF_TEST_ENABLED", true),
+			SelfTestTimeoutSeconds:        getEnvAsInt("SELF_TEST_TIMEOUT_SECONDS", 10),
+			SelfTestRetrySeconds:          getEnvAsInt("SELF_TEST_RETRY_SECONDS", 30),
+			DataChannelMaxMessageBytes:    getEnvAsInt("DATACHANNEL_MAX_MESSAGE_BYTES", 16384),
+			DataChannelRatePerSecond:      getEnvAsFloat("DATACHANNEL_RATE_PER_SECOND", 20),
+			DataChannelBurst:              getEnvAsInt("DATACHANNEL_BURST", 40),
+			DataChannelMaxViolations:      getEnvAsInt("DATACHANNEL_MAX_VIOLATIONS", 50),
+		},
+		FFmpeg: FFmpegConfig{
+			Nice:            getEnvAsInt("FFMPEG_NICE", 0),
+			CPUAffinity:     getEnv("FFMPEG_CPU_AFFINITY", ""),
+			Threads:         getEnvAsInt("FFMPEG_THREADS", 0),
+			Cgroup:          getEnv("FFMPEG_CGROUP", ""),
+			CgroupCPUMax:    getEnv("FFMPEG_CGROUP_CPU_MAX", ""),
+			CgroupMemoryMax: getEnv("FFMPEG_CGROUP_MEMORY_MAX", ""),
+			Encoder:         getEnv("VIDEO_ENCODER", "libx264"),
+			Board:           getEnv("FFMPEG_BOARD", "auto"),
+		},
+		Uplink: UplinkConfig{
+			URL:          getEnv("UPLINK_URL", ""),
+			Token:        secrets.get("UPLINK_TOKEN", ""),
+			Streams:      getEnv("UPLINK_STREAMS", ""),
+			IngestTokens: secrets.get("UPLINK_INGEST_TOKENS", ""),
+		},
+		WHIP: WHIPConfig{
+			Tokens: secrets.get("WHIP_TOKENS", ""),
+		},
+		SIP: SIPConfig{
+			Enabled:               getEnvAsBool("SIP_ENABLED", false),
+			Listen:                getEnv("SIP_LISTEN", ":5060"),
+			PublicIP:              getEnv("SIP_PUBLIC_IP", ""),
+			Server:                getEnv("SIP_SERVER", ""),
+			User:                  getEnv("SIP_USER", ""),
+			Password:              secrets.get("SIP_PASSWORD", ""),
+			Domain:                getEnv("SIP_DOMAIN", ""),
+			RegisterExpirySeconds: getEnvAsInt("SIP_REGISTER_EXPIRY_SECONDS", 300),
+			AutoAnswer:            getEnvAsBool("SIP_AUTO_ANSWER", true),
+			RingTimeoutSeconds:    getEnvAsInt("SIP_RING_TIMEOUT_SECONDS", 60),
+			AllowedCallers:        getEnv("SIP_ALLOWED_CALLERS", ""),
+			DialTargets:           getEnv("SIP_DIAL_TARGETS", ""),
+			Stream:                getEnv("SIP_STREAM", "door"),
+		},
+		FeatureFlags: getEnv("FEATURE_FLAGS", ""),
+	}
+	if secrets.err != nil {
+		return nil, secrets.err
 	}
 
 	return cfg, nil
 }
 
+// Secrets returns the configured values that must never appear in logs or
+// API responses.
+func (c *Config) Secrets() []string {
+	secrets := []string{c.Storage.SecretKey, c.Auth.AdminToken, c.WebRTC.TURNPassword, c.WebRTC.TURNSecret, c.Uplink.Token, c.SIP.Password}
+	for _, token := range strings.Split(c.Auth.Tokens, ",") {
+		secrets = append(secrets, strings.TrimSpace(token))
+	}
+	for _, token := range strings.Split(c.Uplink.IngestTokens, ",") {
+		secrets = append(secrets, strings.TrimSpace(token))
+	}
+	for _, token := range strings.Split(c.WHIP.Tokens, ",") {
+		secrets = append(secrets, strings.TrimSpace(token))
+	}
+	return secrets
+}
+
+// secretLoader reads settings that may hold credentials. Each can also be
+// given as a file through KEY_FILE, as Docker and Kubernetes mount secrets;
+// the first file that cannot be read fails the load.
+type secretLoader struct {
+	err error
+}
+
+func (l *secretLoader) get(key, defaultValue string) string {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return getEnv(key, defaultValue)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if l.err == nil {
+			l.err = fmt.Errorf("failed to read %s_FILE: %w", key, err)
+		}
+		return defaultValue
+	}
+	// Secret files usually end with a newline
+	return strings.TrimRight(string(data), "\r\n")
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -66,3 +536,21 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
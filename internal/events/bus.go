@@ -0,0 +1,183 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Type identifies what happened.
+type Type string
+
+const (
+	SourceStarted        Type = "source.started"
+	SourceStopped        Type = "source.stopped"
+	SourceSwitched       Type = "source.switched"
+	SinkEnabled          Type = "sink.enabled"
+	SinkDisabled         Type = "sink.disabled"
+	PeerConnected        Type = "peer.connected"
+	PeerDisconnected     Type = "peer.disconnected"
+	PeerICERestart       Type = "peer.ice_restart"
+	PeerDowngraded       Type = "peer.downgraded"
+	PeerUpgraded         Type = "peer.upgraded"
+	PeerQualityDegraded  Type = "peer.quality_degraded"
+	PeerQualityRecovered Type = "peer.quality_recovered"
+	PeerRejected         Type = "peer.rejected"
+	PeerResumed          Type = "peer.resumed"
+	PeerReauthRequired   Type = "peer.reauth_required"
+	PeerSessionExpired   Type = "peer.session_expired"
+	PeerStale            Type = "peer.stale"
+	RecordingStarted     Type = "recording.started"
+	RecordingStopped     Type = "recording.stopped"
+	RecordingPaused      Type = "recording.paused"
+	RecordingResumed     Type = "recording.resumed"
+	RecordingSplit       Type = "recording.split"
+	HealthChanged        Type = "health.changed"
+	AnalyticsDetections  Type = "analytics.detections"
+	StreamBlackedOut     Type = "stream.blacked_out"
+	StreamResumed        Type = "stream.resumed"
+	MaintenanceStarted   Type = "maintenance.started"
+	MaintenanceEnded     Type = "maintenance.ended"
+	FlagChanged          Type = "flag.changed"
+	UplinkConnected      Type = "uplink.connected"
+	UplinkDisconnected   Type = "uplink.disconnected"
+	WHIPConnected        Type = "whip.connected"
+	WHIPDisconnected     Type = "whip.disconnected"
+	SIPCallRinging       Type = "sip.call_ringing"
+	SIPCallStarted       Type = "sip.call_started"
+	SIPCallEnded         Type = "sip.call_ended"
+)
+
+// Event is a lifecycle change published on the bus.
+type Event struct {
+	Type   Type                   `json:"type"`
+	Stream string                 `json:"stream,omitempty"`
+	Peer   string                 `json:"peer,omitempty"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+type subscription struct {
+	ch    chan Event
+	types map[Type]bool
+}
+
+func (s *subscription) wants(t Type) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// Bus fans events out to subscribers and keeps a short history. Publishing
+// to or reading from a nil *Bus is valid and does nothing, so components
+// work without one.
+type Bus struct {
+	subs        map[uint64]*subscription
+	nextID      uint64
+	history     []Event
+	historySize int
+	dropped     uint64
+	mu          sync.RWMutex
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		subs:        make(map[uint64]*subscription),
+		historySize: historySize,
+	}
+}
+
+// Publish delivers ev to every interested subscriber without blocking.
+// Subscribers whose buffer is full miss the event.
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	logrus.Debugf("Event %s stream=%s peer=%s", ev.Type, ev.Stream, ev.Peer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.historySize > 0 {
+		b.history = append(b.history, ev)
+		if len(b.history) > b.historySize {
+			b.history = b.history[len(b.history)-b.historySize:]
+		}
+	}
+	for _, sub := range b.subs {
+		if !sub.wants(ev.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			b.dropped++
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events of the given types, or all
+// events if none are given, and a function that ends the subscription and
+// closes the channel.
+func (b *Bus) Subscribe(buffer int, types ...Type) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, buffer), types: make(map[Type]bool)}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			close(sub.ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Recent returns up to limit of the latest events of the given types, oldest
+// first. A limit of 0 returns the whole history.
+func (b *Bus) Recent(limit int, types ...Type) []Event {
+	filter := &subscription{types: make(map[Type]bool)}
+	for _, t := range types {
+		filter.types[t] = true
+	}
+
+	out := make([]Event, 0)
+	if b == nil {
+		return out
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for i := len(b.history) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if filter.wants(b.history[i].Type) {
+			out = append(out, b.history[i])
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// Dropped returns how many deliveries were skipped because a subscriber was
+// not keeping up.
+func (b *Bus) Dropped() uint64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.dropped
+}
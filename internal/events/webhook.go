@@ -0,0 +1,56 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// webhookBuffer is how many events may queue while a delivery is in flight
+const webhookBuffer = 256
+
+// RunWebhook POSTs every event of the given types to url as JSON until ctx
+// is cancelled. Deliveries are sequential, so receivers see events in order.
+func RunWebhook(ctx context.Context, bus *Bus, url string, types ...Type) {
+	ch, unsubscribe := bus.Subscribe(webhookBuffer, types...)
+	defer unsubscribe()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-ch:
+			body, err := json.Marshal(ev)
+			if err != nil {
+				logrus.Errorf("Failed to encode %s event: %v", ev.Type, err)
+				continue
+			}
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				logrus.Errorf("Failed to deliver %s event to webhook: %v", ev.Type, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logrus.Errorf("Event webhook returned %s for %s", resp.Status, ev.Type)
+			}
+		}
+	}
+}
+
+// ParseTypes splits a comma-separated list of event types, ignoring blanks.
+func ParseTypes(list string) []Type {
+	var types []Type
+	for _, part := range strings.Split(list, ",") {
+		if t := strings.TrimSpace(part); t != "" {
+			types = append(types, Type(t))
+		}
+	}
+	return types
+}
@@ -0,0 +1,123 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Board is a family of single-board computers with pipelines of its own.
+type Board string
+
+// Boards with pipelines of their own
+const (
+	BoardGeneric     Board = "generic"
+	BoardRaspberryPi Board = "raspberry_pi"
+	BoardJetson      Board = "jetson"
+)
+
+// ParseBoard parses a board name; "auto" and "" leave the board to be
+// detected from the device tree.
+func ParseBoard(name string) (Board, error) {
+	switch board := Board(strings.ToLower(strings.TrimSpace(name))); board {
+	case "", "auto":
+		return "", nil
+	case BoardGeneric, BoardRaspberryPi, BoardJetson:
+		return board, nil
+	}
+	return "", fmt.Errorf("unknown board %q, expected auto, generic, raspberry_pi, or jetson", name)
+}
+
+// detectBoard tells the board family from a device tree model.
+func detectBoard(model string) Board {
+	switch {
+	case strings.Contains(model, "Raspberry Pi"):
+		return BoardRaspberryPi
+	case strings.Contains(model, "Jetson"):
+		return BoardJetson
+	}
+	return BoardGeneric
+}
+
+// boardPipeline is the argument template of an encoder on a board: how the
+// encoder is driven, and how sources are decoded in hardware to feed it
+// without spending the board's few CPU cores on decoding.
+type boardPipeline struct {
+	// encode are the encoder's arguments, before the keyframe and rate ones
+	encode []string
+	// pixelFormat is forced on frames the encoder gets from system memory
+	pixelFormat string
+	// decode are input arguments decoding the source in hardware. "{codec}"
+	// is replaced by the source's codec; such templates are skipped when
+	// the codec is unknown or not in decodes.
+	decode  []string
+	decodes []string
+	// zeroCopy are input arguments keeping decoded frames in device memory
+	// all the way to the encoder, added when no filter needs them in
+	// system memory
+	zeroCopy []string
+}
+
+// boardPipelines are the argument templates by board and encoder. Encoders
+// without one use their generic arguments.
+var boardPipelines = map[Board]map[string]boardPipeline{
+	BoardRaspberryPi: {
+		// The VideoCore decoder hands DRM PRIME buffers straight to the
+		// V4L2 M2M encoder, as supported by the ffmpeg of Raspberry Pi OS.
+		// The extra buffers keep the encoder from stalling at 1080p30.
+		EncoderV4L2M2M: {
+			encode:      []string{"-c:v", EncoderV4L2M2M, "-num_output_buffers", "32", "-num_capture_buffers", "16"},
+			pixelFormat: "yuv420p",
+			decode:      []string{"-hwaccel", "drm"},
+			zeroCopy:    []string{"-hwaccel_output_format", "drm_prime"},
+		},
+	},
+	BoardJetson: {
+		// jetson-ffmpeg decodes and encodes on the NVDEC and NVENC engines
+		// of Jetson boards; it copies frames out of NVMM buffers between
+		// them, so there is no zero-copy path.
+		EncoderNVMPI: {
+			encode:      []string{"-c:v", EncoderNVMPI, "-preset", "ultrafast", "-profile:v", "baseline"},
+			pixelFormat: "yuv420p",
+			decode:      []string{"-c:v", "{codec}_nvmpi"},
+			decodes:     []string{"h264", "hevc"},
+		},
+	},
+}
+
+// pipelineFor returns the argument template of an encoder on this board.
+func pipelineFor(encoder string) (boardPipeline, bool) {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	p, ok := boardPipelines[board][encoder]
+	return p, ok
+}
+
+// decodeArgs returns the input arguments decoding a source of the given
+// codec in hardware, or nil if the pipeline cannot.
+func (p boardPipeline) decodeArgs(codec string) []string {
+	if len(p.decode) == 0 {
+		return nil
+	}
+	templated := false
+	args := make([]string, len(p.decode))
+	for i, arg := range p.decode {
+		if strings.Contains(arg, "{codec}") {
+			templated = true
+			arg = strings.ReplaceAll(arg, "{codec}", codec)
+		}
+		args[i] = arg
+	}
+	if templated && !contains(p.decodes, codec) {
+		return nil
+	}
+	return args
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
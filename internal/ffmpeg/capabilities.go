@@ -0,0 +1,353 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Video encoders. EncoderAuto picks the best one the platform has.
+const (
+	EncoderAuto     = "auto"
+	EncoderSoftware = "libx264"
+	// EncoderNVENC is NVIDIA's encoder on desktop and server GPUs
+	EncoderNVENC = "h264_nvenc"
+	// EncoderNVMPI is NVIDIA's encoder on Jetson boards, through jetson-ffmpeg
+	EncoderNVMPI = "h264_nvmpi"
+	// EncoderVAAPI is the VA-API encoder of Intel and AMD GPUs
+	EncoderVAAPI = "h264_vaapi"
+	// EncoderV4L2M2M is the V4L2 memory-to-memory encoder of ARM boards such
+	// as the Raspberry Pi
+	EncoderV4L2M2M = "h264_v4l2m2m"
+)
+
+// VAAPIDevice is the DRM render node VA-API encodes on
+const VAAPIDevice = "/dev/dri/renderD128"
+
+// probeTimeout bounds each ffmpeg run of the detection, so a stuck driver
+// cannot hold up startup
+const probeTimeout = 10 * time.Second
+
+type codecInfo struct {
+	name        string
+	description string
+}
+
+// hardwareEncoders are tried by EncoderAuto, most preferred first; the
+// software encoder comes after all of them.
+var hardwareEncoders = []codecInfo{
+	{EncoderNVENC, "NVIDIA NVENC"},
+	{EncoderNVMPI, "NVIDIA Jetson"},
+	{EncoderVAAPI, "VA-API (Intel, AMD)"},
+	{EncoderV4L2M2M, "V4L2 M2M (Raspberry Pi and other ARM boards)"},
+}
+
+// hardwareDecoders are the hardware H.264 decoders reported.
+var hardwareDecoders = []codecInfo{
+	{"h264_cuvid", "NVIDIA CUVID"},
+	{"h264_nvmpi", "NVIDIA Jetson"},
+	{"h264_qsv", "Intel Quick Sync"},
+	{"h264_v4l2m2m", "V4L2 M2M (Raspberry Pi and other ARM boards)"},
+}
+
+// EncoderStatus reports whether an encoder can be used on this host.
+type EncoderStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Hardware    bool   `json:"hardware"`
+	// Compiled is whether ffmpeg was built with the encoder
+	Compiled bool `json:"compiled"`
+	// Available is whether a test encode succeeded
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+	// HardwareDecode and ZeroCopy report the board's pipeline of the
+	// encoder: whether sources are decoded in hardware to feed it, and
+	// whether frames stay in device memory from decoder to encoder
+	HardwareDecode bool `json:"hardware_decode,omitempty"`
+	ZeroCopy       bool `json:"zero_copy,omitempty"`
+}
+
+// DecoderStatus reports whether ffmpeg was built with a decoder.
+type DecoderStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Compiled    bool   `json:"compiled"`
+}
+
+// Capabilities is what the host can encode and decode video with.
+type Capabilities struct {
+	// Platform is the OS and architecture, e.g. "linux/arm64"
+	Platform string `json:"platform"`
+	// Model is the device tree model of single-board computers, e.g.
+	// "Raspberry Pi 4 Model B Rev 1.4"
+	Model string `json:"model,omitempty"`
+	// Board is the family whose pipelines are used
+	Board    Board           `json:"board"`
+	FFmpeg   string          `json:"ffmpeg_version,omitempty"`
+	Encoders []EncoderStatus `json:"encoders"`
+	Decoders []DecoderStatus `json:"decoders"`
+	// HWAccels are ffmpeg's hardware decoding methods
+	HWAccels []string `json:"hwaccels"`
+	// Auto is the encoder EncoderAuto selects
+	Auto string `json:"auto"`
+	// Default is the encoder of encodings that do not pick one
+	Default    string    `json:"default"`
+	DetectedAt time.Time `json:"detected_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	capabilities   Capabilities
+	defaultEncoder = EncoderSoftware
+	board          = BoardGeneric
+	capabilitiesMu sync.RWMutex
+)
+
+// DetectCapabilities finds the hardware encoders and decoders of the host
+// and installs the result, which EncoderAuto selects from. A hardware
+// encoder counts as available only if ffmpeg encodes a few test frames
+// with it, as being compiled in says nothing about the driver or device.
+// The board's pipelines are used from then on; an empty board is detected
+// from the device tree.
+func DetectCapabilities(ctx context.Context, b Board) Capabilities {
+	caps := Capabilities{
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Model:      boardModel(),
+		Board:      b,
+		DetectedAt: time.Now().UTC(),
+	}
+	if caps.Board == "" {
+		caps.Board = detectBoard(caps.Model)
+	}
+	// Encoders are probed with the board's arguments
+	capabilitiesMu.Lock()
+	board = caps.Board
+	capabilitiesMu.Unlock()
+
+	version, err := probe(ctx, "-hide_banner", "-version")
+	if err != nil {
+		caps.Error = fmt.Sprintf("ffmpeg is not usable: %v", err)
+	} else if fields := strings.Fields(version); len(fields) >= 3 && fields[1] == "version" {
+		// "ffmpeg version 6.1.1 Copyright ..."
+		caps.FFmpeg = fields[2]
+	}
+	encoders := listCodecs(ctx, "-encoders")
+	decoders := listCodecs(ctx, "-decoders")
+
+	caps.Auto = EncoderSoftware
+	for _, info := range hardwareEncoders {
+		status := EncoderStatus{Name: info.name, Description: info.description, Hardware: true, Compiled: encoders[info.name]}
+		if p, ok := boardPipelines[caps.Board][info.name]; ok {
+			status.HardwareDecode = len(p.decode) > 0
+			status.ZeroCopy = len(p.zeroCopy) > 0
+		}
+		if status.Compiled {
+			if err := probeEncoder(ctx, info.name); err != nil {
+				status.Error = err.Error()
+			} else {
+				status.Available = true
+				if caps.Auto == EncoderSoftware {
+					caps.Auto = info.name
+				}
+			}
+		}
+		caps.Encoders = append(caps.Encoders, status)
+	}
+	caps.Encoders = append(caps.Encoders, EncoderStatus{
+		Name:        EncoderSoftware,
+		Description: "x264 (software)",
+		Compiled:    encoders[EncoderSoftware],
+		Available:   encoders[EncoderSoftware],
+	})
+	for _, info := range hardwareDecoders {
+		caps.Decoders = append(caps.Decoders, DecoderStatus{Name: info.name, Description: info.description, Compiled: decoders[info.name]})
+	}
+	caps.HWAccels = listHWAccels(ctx)
+
+	capabilitiesMu.Lock()
+	caps.Default = defaultEncoder
+	capabilities = caps
+	capabilitiesMu.Unlock()
+	return caps
+}
+
+// CurrentCapabilities reports the last detection.
+func CurrentCapabilities() Capabilities {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	caps := capabilities
+	caps.Default = defaultEncoder
+	return caps
+}
+
+// SetDefaultEncoder sets the encoder of encodings that do not pick one.
+// A hardware encoder must have been found by DetectCapabilities.
+func SetDefaultEncoder(name string) error {
+	if err := CheckEncoder(name); err != nil {
+		return err
+	}
+	capabilitiesMu.Lock()
+	defaultEncoder = name
+	capabilitiesMu.Unlock()
+	return nil
+}
+
+// CheckEncoder returns an error unless the encoder can be used on this
+// host. The software encoder and EncoderAuto always can.
+func CheckEncoder(name string) error {
+	if err := validEncoder(name); err != nil {
+		return err
+	}
+	if name == "" || name == EncoderAuto || name == EncoderSoftware {
+		return nil
+	}
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	for _, status := range capabilities.Encoders {
+		if status.Name != name {
+			continue
+		}
+		if status.Available {
+			return nil
+		}
+		if status.Error != "" {
+			return fmt.Errorf("encoder %s is not available: %s", name, status.Error)
+		}
+	}
+	return fmt.Errorf("encoder %s is not available on this host", name)
+}
+
+// validEncoder returns an error unless name is an encoder this package
+// knows the arguments of, EncoderAuto, or empty for the default.
+func validEncoder(name string) error {
+	switch name {
+	case "", EncoderAuto, EncoderSoftware:
+		return nil
+	}
+	for _, info := range hardwareEncoders {
+		if info.name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown encoder %q", name)
+}
+
+// resolveEncoder turns the encoder an encoding asks for into the one it
+// runs with. A hardware encoder that went missing falls back to software.
+func resolveEncoder(name string) string {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	if name == "" {
+		name = defaultEncoder
+	}
+	if name == EncoderAuto {
+		if capabilities.Auto == "" {
+			return EncoderSoftware
+		}
+		return capabilities.Auto
+	}
+	if name == EncoderSoftware {
+		return name
+	}
+	for _, status := range capabilities.Encoders {
+		if status.Name == name && status.Available {
+			return name
+		}
+	}
+	logrus.Warnf("Encoder %s is not available, encoding with %s", name, EncoderSoftware)
+	return EncoderSoftware
+}
+
+// probeEncoder encodes a few frames of a test pattern with an encoder.
+func probeEncoder(ctx context.Context, encoder string) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", "lavfi", "-i", "testsrc2=size=320x240:rate=30", "-frames:v", "5"}
+	args = append(args, Encoding{}.outputArgs(encoder, nil, false)...)
+	_, err := probe(ctx, append(args, "-f", "null", "-")...)
+	return err
+}
+
+// probe runs ffmpeg and returns its output. Failures carry the last line
+// ffmpeg logged, which names the cause.
+func probe(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := CommandContext(ctx, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("timed out after %s", probeTimeout)
+		}
+		if msg := lastLine(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// listCodecs parses the codec names of "ffmpeg -encoders" or "-decoders",
+// whose entries look like " V....D libx264   libx264 H.264 ...".
+func listCodecs(ctx context.Context, flag string) map[string]bool {
+	codecs := make(map[string]bool)
+	out, err := probe(ctx, "-hide_banner", flag)
+	if err != nil {
+		return codecs
+	}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	listing := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !listing {
+			// The legend ends with a line of dashes
+			listing = strings.HasPrefix(line, "---")
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			codecs[fields[1]] = true
+		}
+	}
+	return codecs
+}
+
+// listHWAccels parses "ffmpeg -hwaccels", a heading followed by one method
+// per line.
+func listHWAccels(ctx context.Context) []string {
+	accels := []string{}
+	out, err := probe(ctx, "-hide_banner", "-hwaccels")
+	if err != nil {
+		return accels
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasSuffix(line, ":") {
+			accels = append(accels, line)
+		}
+	}
+	return accels
+}
+
+// boardModel reads the model of boards described by a device tree, such
+// as the Raspberry Pi and Jetson.
+func boardModel() string {
+	model, err := os.ReadFile("/proc/device-tree/model")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(model), "\x00"))
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
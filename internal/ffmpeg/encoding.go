@@ -0,0 +1,209 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultGOPFrames is the keyframe interval of transcoded video
+const DefaultGOPFrames = 30
+
+// Encoding is the H.264 encoder configuration of a transcoding pipeline.
+// Zero values keep the encoder's defaults and the source's resolution.
+type Encoding struct {
+	BitrateKbps int `json:"bitrate_kbps"`
+	// Width and Height scale the picture; with only one set the other follows
+	// the aspect ratio
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+	GOPFrames int `json:"gop_frames"`
+	// Encoder is an encoder name such as "h264_nvenc", "auto" for the best
+	// one the host has, or empty for the default encoder
+	Encoder string `json:"encoder,omitempty"`
+}
+
+func (e Encoding) Validate() error {
+	if e.BitrateKbps < 0 || e.Width < 0 || e.Height < 0 || e.GOPFrames < 0 {
+		return fmt.Errorf("encoding values must not be negative")
+	}
+	if e.Width%2 != 0 || e.Height%2 != 0 {
+		return fmt.Errorf("width and height must be even")
+	}
+	return validEncoder(e.Encoder)
+}
+
+// Args returns the ffmpeg output arguments encoding video to WebRTC-friendly
+// H.264 with these settings. filters, such as a Transform's, run before
+// scaling, so Width and Height are those of the output.
+func (e Encoding) Args(filters ...string) []string {
+	return e.outputArgs(resolveEncoder(e.Encoder), e.filters(filters), false)
+}
+
+// Pipeline is Args for a source of the given codec ("" if unknown), which
+// may also be decoded in hardware: input holds the arguments to put before
+// the source's -i. On boards with a pipeline for the encoder the source is
+// decoded on the board's decoder, and with no filters its frames stay in
+// device memory on their way to the encoder.
+func (e Encoding) Pipeline(codec string, filters ...string) (input, output []string) {
+	encoder := resolveEncoder(e.Encoder)
+	filters = e.filters(filters)
+	p, ok := pipelineFor(encoder)
+	if !ok {
+		return nil, e.outputArgs(encoder, filters, false)
+	}
+	input = p.decodeArgs(codec)
+	zeroCopy := input != nil && len(p.zeroCopy) > 0 && len(filters) == 0
+	if zeroCopy {
+		input = append(input, p.zeroCopy...)
+	}
+	return input, e.outputArgs(encoder, filters, zeroCopy)
+}
+
+// outputArgs returns the encoder's arguments and filters; with zeroCopy
+// frames arrive in the encoder's memory and are passed on as they are.
+func (e Encoding) outputArgs(encoder string, filters []string, zeroCopy bool) []string {
+	args := e.codecArgs(encoder, zeroCopy)
+	if upload := uploadFilter(encoder); upload != "" {
+		filters = append(filters, upload)
+	}
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+	return args
+}
+
+// OverlayArgs is Args compositing the second input, an image from
+// OverlayInputArgs, over the first input's video once it is filtered and
+// scaled. The image is stretched to the output's size.
+func (e Encoding) OverlayArgs(filters ...string) []string {
+	chain := "null"
+	if filters = e.filters(filters); len(filters) > 0 {
+		chain = strings.Join(filters, ",")
+	}
+	encoder := resolveEncoder(e.Encoder)
+	format := "format=yuv420p"
+	if upload := uploadFilter(encoder); upload != "" {
+		format = upload
+	}
+	graph := fmt.Sprintf("[0:v]%s[main];[1:v][main]scale2ref[ov][base];[base][ov]overlay=format=auto,%s[out]", chain, format)
+	return append([]string{"-filter_complex", graph, "-map", "[out]"}, e.codecArgs(encoder, false)...)
+}
+
+// GraphArgs encodes the output labelled out of a filter graph, which sets
+// the picture size; Width and Height are not applied.
+func (e Encoding) GraphArgs(graph, out string) []string {
+	encoder := resolveEncoder(e.Encoder)
+	if upload := uploadFilter(encoder); upload != "" {
+		graph += fmt.Sprintf(";[%s]%s[%s_hw]", out, upload, out)
+		out += "_hw"
+	}
+	return append([]string{"-filter_complex", graph, "-map", "[" + out + "]"}, e.codecArgs(encoder, false)...)
+}
+
+// OverlayInputArgs returns the ffmpeg input arguments of an overlay image
+// that changes while ffmpeg runs. The image demuxer reopens the file for
+// every frame, so it must be replaced atomically.
+func OverlayInputArgs(path string) []string {
+	return []string{"-f", "image2", "-loop", "1", "-framerate", "10", "-i", path}
+}
+
+// codecArgs returns the arguments of an encoder tuned for low latency:
+// constant keyframe interval, no B-frames, and the baseline profile where
+// the encoder has profiles. The board's template of the encoder is used if
+// it has one.
+func (e Encoding) codecArgs(encoder string, zeroCopy bool) []string {
+	gop := e.GOPFrames
+	if gop == 0 {
+		gop = DefaultGOPFrames
+	}
+
+	var args []string
+	if p, ok := pipelineFor(encoder); ok {
+		args = append(args, p.encode...)
+		if !zeroCopy && p.pixelFormat != "" {
+			args = append(args, "-pix_fmt", p.pixelFormat)
+		}
+	} else {
+		args = genericCodecArgs(encoder, gop)
+	}
+	args = append(args,
+		"-g", strconv.Itoa(gop), // GOP size for better compatibility
+		"-bf", "0", // No B-frames for lower latency
+	)
+	if e.BitrateKbps > 0 {
+		// Constrain the rate over about one second so viewers see no spikes
+		rate := strconv.Itoa(e.BitrateKbps) + "k"
+		args = append(args, "-b:v", rate, "-maxrate", rate, "-bufsize", rate)
+	}
+	return args
+}
+
+// genericCodecArgs are the arguments of an encoder on boards without a
+// template of it.
+func genericCodecArgs(encoder string, gop int) []string {
+	switch encoder {
+	case EncoderNVENC:
+		return []string{
+			"-c:v", EncoderNVENC,
+			"-preset", "p1", // Fastest preset
+			"-tune", "ull", // Ultra-low latency
+			"-profile:v", "baseline",
+			"-pix_fmt", "yuv420p",
+		}
+	case EncoderNVMPI:
+		return []string{
+			"-c:v", EncoderNVMPI,
+			"-profile:v", "baseline",
+			"-pix_fmt", "yuv420p",
+		}
+	case EncoderVAAPI:
+		// Frames are uploaded to the device by uploadFilter
+		return []string{
+			"-vaapi_device", VAAPIDevice,
+			"-c:v", EncoderVAAPI,
+			"-profile:v", "constrained_baseline",
+		}
+	case EncoderV4L2M2M:
+		return []string{
+			"-c:v", EncoderV4L2M2M,
+			"-pix_fmt", "yuv420p",
+		}
+	default:
+		return []string{
+			"-c:v", "libx264", // Use H.264 encoder
+			"-preset", "veryfast", // Fast encoding
+			"-tune", "zerolatency", // Optimize for low latency
+			"-profile:v", "baseline", // Use baseline profile for compatibility
+			"-level", "3.1", // Level 3.1 for compatibility
+			"-pix_fmt", "yuv420p", // Pixel format
+			"-keyint_min", strconv.Itoa(gop), // Minimum keyframe interval
+			"-sc_threshold", "0", // Disable scene change detection
+			"-flags", "+low_delay", // Low delay flags
+		}
+	}
+}
+
+// uploadFilter is the filter moving frames to the encoder's device, for
+// encoders that only take frames in device memory.
+func uploadFilter(encoder string) string {
+	if encoder == EncoderVAAPI {
+		return "format=nv12,hwupload"
+	}
+	return ""
+}
+
+// filters appends the scaling to the given filters.
+func (e Encoding) filters(filters []string) []string {
+	if e.Width > 0 || e.Height > 0 {
+		width, height := e.Width, e.Height
+		if width == 0 {
+			width = -2
+		}
+		if height == 0 {
+			height = -2
+		}
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", width, height))
+	}
+	return filters
+}
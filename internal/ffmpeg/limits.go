@@ -0,0 +1,139 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Limits constrain every ffmpeg child so a burst of transcodes cannot starve
+// the Go process or the host. Zero values leave the default in place.
+type Limits struct {
+	// Nice is the scheduling priority adjustment (-20..19)
+	Nice int
+	// CPUs restricts ffmpeg to these CPU indexes
+	CPUs []int
+	// Threads caps ffmpeg's decoder and encoder thread pools
+	Threads int
+	// Cgroup is a cgroup v2 directory ffmpeg processes are moved into (Linux only)
+	Cgroup string
+	// CgroupCPUMax and CgroupMemoryMax are written to the cgroup's cpu.max and
+	// memory.max, e.g. "200000 100000" (two CPUs) and "2G"
+	CgroupCPUMax    string
+	CgroupMemoryMax string
+}
+
+var (
+	limits   Limits
+	limitsMu sync.RWMutex
+)
+
+// Configure validates and installs the limits applied to ffmpeg children
+// started afterwards, creating and configuring the cgroup if one is set.
+func Configure(l Limits) error {
+	if l.Nice < -20 || l.Nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19, got %d", l.Nice)
+	}
+	if l.Threads < 0 {
+		return fmt.Errorf("threads must not be negative, got %d", l.Threads)
+	}
+	if err := setupCgroup(l); err != nil {
+		return err
+	}
+
+	limitsMu.Lock()
+	limits = l
+	limitsMu.Unlock()
+
+	if l.Nice != 0 || len(l.CPUs) > 0 || l.Threads > 0 || l.Cgroup != "" {
+		logrus.Infof("FFmpeg limits: nice=%d cpus=%v threads=%d cgroup=%q", l.Nice, l.CPUs, l.Threads, l.Cgroup)
+	}
+	return nil
+}
+
+func current() Limits {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return limits
+}
+
+// Command is exec.Command for ffmpeg with the configured thread limit applied.
+func Command(args ...string) *exec.Cmd {
+	return exec.Command("ffmpeg", withThreads(args, current().Threads)...)
+}
+
+// CommandContext is exec.CommandContext for ffmpeg with the configured thread
+// limit applied.
+func CommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ffmpeg", withThreads(args, current().Threads)...)
+}
+
+// Start starts cmd and applies the process limits to it. Failing to apply a
+// limit is logged rather than returned, so media keeps flowing.
+func Start(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := applyProcessLimits(cmd.Process.Pid, current()); err != nil {
+		logrus.Warnf("Failed to apply limits to ffmpeg (pid %d): %v", cmd.Process.Pid, err)
+	}
+	return nil
+}
+
+// Run starts cmd with limits applied and waits for it to finish.
+func Run(cmd *exec.Cmd) error {
+	if err := Start(cmd); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+// withThreads adds -threads before every input and before the output, which
+// ffmpeg expects to be the last argument.
+func withThreads(args []string, threads int) []string {
+	if threads <= 0 || len(args) == 0 {
+		return args
+	}
+
+	n := strconv.Itoa(threads)
+	out := make([]string, 0, len(args)+6)
+	for i, arg := range args {
+		if arg == "-i" || i == len(args)-1 {
+			out = append(out, "-threads", n)
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// ParseCPUList parses a CPU list such as "0-3,6".
+func ParseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU range %q", part)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
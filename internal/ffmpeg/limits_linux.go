@@ -0,0 +1,58 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+func applyProcessLimits(pid int, l Limits) error {
+	var errs []error
+	if l.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, l.Nice); err != nil {
+			errs = append(errs, fmt.Errorf("setpriority: %w", err))
+		}
+	}
+	if len(l.CPUs) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range l.CPUs {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(pid, &set); err != nil {
+			errs = append(errs, fmt.Errorf("sched_setaffinity: %w", err))
+		}
+	}
+	if l.Cgroup != "" {
+		procs := filepath.Join(l.Cgroup, "cgroup.procs")
+		if err := os.WriteFile(procs, []byte(strconv.Itoa(pid)), 0o644); err != nil {
+			errs = append(errs, fmt.Errorf("join cgroup: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setupCgroup creates the cgroup directory and writes its controller limits.
+// The parent cgroup must delegate the cpu and memory controllers.
+func setupCgroup(l Limits) error {
+	if l.Cgroup == "" {
+		return nil
+	}
+	if err := os.MkdirAll(l.Cgroup, 0o755); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %w", l.Cgroup, err)
+	}
+
+	controls := map[string]string{"cpu.max": l.CgroupCPUMax, "memory.max": l.CgroupMemoryMax}
+	for file, value := range controls {
+		if value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(l.Cgroup, file), []byte(value), 0o644); err != nil {
+			return fmt.Errorf("failed to set %s of cgroup %s: %w", file, l.Cgroup, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package ffmpeg
+
+import (
+	"fmt"
+)
+
+// Process limits are only implemented on Linux; elsewhere they must be unset.
+func applyProcessLimits(pid int, l Limits) error {
+	return nil
+}
+
+func setupCgroup(l Limits) error {
+	if l.Nice != 0 || len(l.CPUs) > 0 || l.Cgroup != "" {
+		return fmt.Errorf("ffmpeg nice, CPU affinity, and cgroup limits are only supported on Linux")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package ffmpeg
+
+import "fmt"
+
+// Transform corrects the orientation and framing of a source, e.g. a camera
+// mounted sideways on a ceiling. The crop is in source pixels and applied
+// before the rotation.
+type Transform struct {
+	// Rotate turns the picture clockwise by 0, 90, 180, or 270 degrees
+	Rotate int   `json:"rotate"`
+	Crop   *Crop `json:"crop,omitempty"`
+}
+
+// Crop keeps the Width x Height rectangle whose top left corner is at X, Y.
+type Crop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (t Transform) Validate() error {
+	switch t.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("rotation must be 0, 90, 180, or 270 degrees")
+	}
+	if c := t.Crop; c != nil {
+		if c.X < 0 || c.Y < 0 || c.Width <= 0 || c.Height <= 0 {
+			return fmt.Errorf("crop must have a positive size and a non-negative position")
+		}
+		if c.Width%2 != 0 || c.Height%2 != 0 {
+			return fmt.Errorf("crop width and height must be even")
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether the transform leaves the picture unchanged.
+func (t Transform) IsZero() bool {
+	return t.Rotate == 0 && t.Crop == nil
+}
+
+// Filters returns the video filters applying the transform.
+func (t Transform) Filters() []string {
+	var filters []string
+	if c := t.Crop; c != nil {
+		filters = append(filters, fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y))
+	}
+	switch t.Rotate {
+	case 90:
+		filters = append(filters, "transpose=clock")
+	case 180:
+		filters = append(filters, "hflip", "vflip")
+	case 270:
+		filters = append(filters, "transpose=cclock")
+	}
+	return filters
+}
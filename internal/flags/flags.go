@@ -0,0 +1,275 @@
+// Package flags gates experimental subsystems, so they can ship disabled by
+// default and be turned on per deployment, at startup or at runtime.
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/state"
+)
+
+// Flag names an experimental subsystem.
+type Flag string
+
+// Flags of the experimental subsystems
+const (
+	// WHIPIngest accepts streams published over WHIP
+	WHIPIngest Flag = "whip_ingest"
+	// UplinkIngest accepts streams pushed by edge instances
+	UplinkIngest Flag = "uplink_ingest"
+	// SIP takes and places door station calls
+	SIP Flag = "sip"
+	// Analytics feeds frames to analytics sidecars and draws their
+	// detections
+	Analytics Flag = "analytics"
+)
+
+// Definition describes a flag.
+type Definition struct {
+	Name        Flag
+	Description string
+	// Default is whether the flag is on unless configured
+	Default bool
+}
+
+// Known are the flags that can be set. Each subsystem also has to be
+// configured to run, so all are on by default; turning one off stops it
+// without touching its configuration.
+var Known = []Definition{
+	{Name: WHIPIngest, Description: "Streams published over WHIP", Default: true},
+	{Name: UplinkIngest, Description: "Streams pushed by edge instances", Default: true},
+	{Name: SIP, Description: "Door station calls over SIP", Default: true},
+	{Name: Analytics, Description: "Frames for analytics sidecars and their detections", Default: true},
+}
+
+func lookup(name Flag) (Definition, bool) {
+	for _, def := range Known {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Where a flag's value comes from
+const (
+	SourceDefault = "default"
+	SourceConfig  = "config"
+	SourceRuntime = "runtime"
+)
+
+// Status reports a flag and where its value comes from.
+type Status struct {
+	Name        Flag   `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	// Source is "default", "config", or "runtime"
+	Source    string     `json:"source"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// override is a flag set at runtime, persisted across restarts.
+type override struct {
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Parse parses flags written as "name=true,name2=false"; a bare name turns
+// the flag on.
+func Parse(spec string) (map[Flag]bool, error) {
+	flags := make(map[Flag]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		flag := Flag(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := lookup(flag); !ok {
+			return nil, fmt.Errorf("unknown feature flag %q", name)
+		}
+		enabled := true
+		if found {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of feature flag %s: %q", flag, value)
+			}
+			enabled = parsed
+		}
+		flags[flag] = enabled
+	}
+	return flags, nil
+}
+
+// Set holds the value of every flag: set at runtime, else configured, else
+// its default. Subsystems check Enabled when they start, or Watch a flag to
+// follow it while they run.
+type Set struct {
+	db        *state.Store
+	config    map[Flag]bool
+	overrides map[Flag]override
+	watchers  map[Flag][]func(bool)
+	mu        sync.RWMutex
+}
+
+// NewSet loads the flags set at runtime from db, which may be nil to keep
+// them in memory only, on top of the configured ones.
+func NewSet(db *state.Store, config map[Flag]bool) (*Set, error) {
+	s := &Set{
+		db:        db,
+		config:    config,
+		overrides: make(map[Flag]override),
+		watchers:  make(map[Flag][]func(bool)),
+	}
+	if db == nil {
+		return s, nil
+	}
+
+	raw, err := db.List(state.BucketFlags)
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range raw {
+		if _, ok := lookup(Flag(name)); !ok {
+			// A flag of a subsystem that has since graduated or been removed
+			continue
+		}
+		var o override
+		if err := json.Unmarshal(data, &o); err != nil {
+			return nil, fmt.Errorf("failed to parse feature flag %s: %w", name, err)
+		}
+		s.overrides[Flag(name)] = o
+	}
+	return s, nil
+}
+
+// Enabled reports whether a flag is on. A nil Set has every flag at its
+// default.
+func (s *Set) Enabled(flag Flag) bool {
+	if s == nil {
+		def, _ := lookup(flag)
+		return def.Default
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statusLocked(flag).Enabled
+}
+
+// Watch calls fn whenever a flag changes at runtime.
+func (s *Set) Watch(flag Flag, fn func(enabled bool)) {
+	s.mu.Lock()
+	s.watchers[flag] = append(s.watchers[flag], fn)
+	s.mu.Unlock()
+}
+
+// Get reports a flag.
+func (s *Set) Get(flag Flag) (Status, error) {
+	if _, ok := lookup(flag); !ok {
+		return Status{}, fmt.Errorf("unknown feature flag %q", flag)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statusLocked(flag), nil
+}
+
+// List reports every flag, by name.
+func (s *Set) List() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Status, 0, len(Known))
+	for _, def := range Known {
+		list = append(list, s.statusLocked(def.Name))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Update sets a flag at runtime, overriding its configured value until
+// Reset, also across restarts.
+func (s *Set) Update(flag Flag, enabled bool) (Status, error) {
+	if _, ok := lookup(flag); !ok {
+		return Status{}, fmt.Errorf("unknown feature flag %q", flag)
+	}
+	o := override{Enabled: enabled, UpdatedAt: time.Now().UTC()}
+
+	s.mu.Lock()
+	if s.db != nil {
+		if err := s.db.Put(state.BucketFlags, string(flag), o); err != nil {
+			s.mu.Unlock()
+			return Status{}, err
+		}
+	}
+	was := s.statusLocked(flag).Enabled
+	s.overrides[flag] = o
+	status := s.statusLocked(flag)
+	watchers := s.watchers[flag]
+	s.mu.Unlock()
+
+	if status.Enabled != was {
+		notify(watchers, status.Enabled)
+	}
+	return status, nil
+}
+
+// Reset drops the runtime value of a flag, bringing back its configured
+// value or default.
+func (s *Set) Reset(flag Flag) (Status, error) {
+	if _, ok := lookup(flag); !ok {
+		return Status{}, fmt.Errorf("unknown feature flag %q", flag)
+	}
+
+	s.mu.Lock()
+	if s.db != nil {
+		if err := s.db.Delete(state.BucketFlags, string(flag)); err != nil {
+			s.mu.Unlock()
+			return Status{}, err
+		}
+	}
+	was := s.statusLocked(flag).Enabled
+	delete(s.overrides, flag)
+	status := s.statusLocked(flag)
+	watchers := s.watchers[flag]
+	s.mu.Unlock()
+
+	if status.Enabled != was {
+		notify(watchers, status.Enabled)
+	}
+	return status, nil
+}
+
+func notify(watchers []func(bool), enabled bool) {
+	for _, fn := range watchers {
+		fn(enabled)
+	}
+}
+
+// statusLocked reports a known flag. Callers must hold mu.
+func (s *Set) statusLocked(flag Flag) Status {
+	def, _ := lookup(flag)
+	status := Status{
+		Name:        flag,
+		Description: def.Description,
+		Enabled:     def.Default,
+		Default:     def.Default,
+		Source:      SourceDefault,
+	}
+	if enabled, ok := s.config[flag]; ok {
+		status.Enabled = enabled
+		status.Source = SourceConfig
+	}
+	if o, ok := s.overrides[flag]; ok {
+		updatedAt := o.UpdatedAt
+		status.Enabled = o.Enabled
+		status.Source = SourceRuntime
+		status.UpdatedAt = &updatedAt
+	}
+	return status
+}
@@ -0,0 +1,246 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/stats"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config controls scoring frequency, thresholds, and alerting.
+type Config struct {
+	Interval           time.Duration
+	DegradedThreshold  float64
+	UnhealthyThreshold float64
+	// Window is how far back restarts and stalls count against the score
+	Window time.Duration
+	// WebhookURL receives a POST whenever a stream changes status
+	WebhookURL string
+}
+
+// Report is the latest health evaluation of one stream.
+type Report struct {
+	Score      float64    `json:"score"`
+	Status     Status     `json:"status"`
+	Components Components `json:"components"`
+	Since      time.Time  `json:"since"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Alert is the webhook payload sent on a status change.
+type Alert struct {
+	Stream     string     `json:"stream"`
+	Status     Status     `json:"status"`
+	Previous   Status     `json:"previous"`
+	Score      float64    `json:"score"`
+	Components Components `json:"components"`
+	Time       time.Time  `json:"time"`
+}
+
+// Collector returns the current source statistics per stream and the viewer
+// loss of each stream's peers.
+type Collector func() (sources map[string]stats.Snapshot, viewerLoss map[string]float64)
+
+// Monitor periodically scores every stream and raises alerts on transitions.
+type Monitor struct {
+	cfg     Config
+	collect Collector
+	client  *http.Client
+	reports map[string]Report
+	// Counter values at each evaluation, used to count recent events
+	history map[string][]sample
+	events  *events.Bus
+	mu      sync.RWMutex
+}
+
+type sample struct {
+	at       time.Time
+	restarts uint64
+	stalls   uint64
+}
+
+func NewMonitor(cfg Config, collect Collector) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Minute
+	}
+	return &Monitor{
+		cfg:     cfg,
+		collect: collect,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		reports: make(map[string]Report),
+		history: make(map[string][]sample),
+	}
+}
+
+// SetEvents publishes status changes on bus in addition to the webhook.
+func (m *Monitor) SetEvents(bus *events.Bus) {
+	m.mu.Lock()
+	m.events = bus
+	m.mu.Unlock()
+}
+
+// Run evaluates health every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	m.Evaluate()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Evaluate()
+		}
+	}
+}
+
+// Evaluate scores all streams now and sends alerts for status changes.
+func (m *Monitor) Evaluate() {
+	sources, loss := m.collect()
+	now := time.Now()
+
+	var alerts []Alert
+	m.mu.Lock()
+	// Streams no longer reported (e.g. idle) keep no stale score
+	for id := range m.reports {
+		if _, ok := sources[id]; !ok {
+			delete(m.reports, id)
+			delete(m.history, id)
+		}
+	}
+	for id, snap := range sources {
+		restarts, stalls := m.recentEvents(id, snap, now)
+		score, components := Score(Input{
+			Source:         snap,
+			RecentRestarts: restarts,
+			RecentStalls:   stalls,
+			ViewerLoss:     loss[id],
+		})
+		status := m.status(score)
+
+		prev, seen := m.reports[id]
+		report := Report{Score: score, Status: status, Components: components, Since: now, UpdatedAt: now}
+		if seen && prev.Status == status {
+			report.Since = prev.Since
+		}
+		m.reports[id] = report
+
+		// Streams start out healthy, so a first unhealthy reading still alerts
+		previous := StatusHealthy
+		if seen {
+			previous = prev.Status
+		}
+		if status != previous {
+			alerts = append(alerts, Alert{
+				Stream:     id,
+				Status:     status,
+				Previous:   previous,
+				Score:      score,
+				Components: components,
+				Time:       now,
+			})
+		}
+	}
+	bus := m.events
+	m.mu.Unlock()
+
+	for _, alert := range alerts {
+		logrus.Warnf("🩺 Stream %s health %s -> %s (score %.0f)", alert.Stream, alert.Previous, alert.Status, alert.Score)
+		bus.Publish(events.Event{
+			Type:   events.HealthChanged,
+			Stream: alert.Stream,
+			Time:   alert.Time,
+			Data: map[string]interface{}{
+				"status":     alert.Status,
+				"previous":   alert.Previous,
+				"score":      alert.Score,
+				"components": alert.Components,
+			},
+		})
+		if m.cfg.WebhookURL != "" {
+			go m.sendAlert(alert)
+		}
+	}
+}
+
+// Reports returns the latest report of every stream.
+func (m *Monitor) Reports() map[string]Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[string]Report, len(m.reports))
+	for id, report := range m.reports {
+		out[id] = report
+	}
+	return out
+}
+
+// Report returns the latest report of one stream.
+func (m *Monitor) Report(streamID string) (Report, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	report, ok := m.reports[streamID]
+	return report, ok
+}
+
+func (m *Monitor) status(score float64) Status {
+	switch {
+	case score < m.cfg.UnhealthyThreshold:
+		return StatusUnhealthy
+	case score < m.cfg.DegradedThreshold:
+		return StatusDegraded
+	}
+	return StatusHealthy
+}
+
+// recentEvents records the stream's counters and returns how many restarts
+// and stalls happened within the window. Callers must hold mu.
+func (m *Monitor) recentEvents(id string, snap stats.Snapshot, now time.Time) (int, int) {
+	history := append(m.history[id], sample{at: now, restarts: snap.Restarts, stalls: snap.Stalls})
+	cutoff := now.Add(-m.cfg.Window)
+	first := sort.Search(len(history), func(i int) bool { return !history[i].at.Before(cutoff) })
+	history = history[first:]
+	m.history[id] = history
+
+	// Counters go backwards when a source client is recreated
+	oldest := history[0]
+	restarts, stalls := snap.Restarts, snap.Stalls
+	if restarts >= oldest.restarts {
+		restarts -= oldest.restarts
+	}
+	if stalls >= oldest.stalls {
+		stalls -= oldest.stalls
+	}
+	return int(restarts), int(stalls)
+}
+
+func (m *Monitor) sendAlert(alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		logrus.Errorf("Failed to encode health alert: %v", err)
+		return
+	}
+
+	resp, err := m.client.Post(m.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logrus.Errorf("Failed to send health alert for %s: %v", alert.Stream, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		logrus.Errorf("Health alert webhook for %s returned %s", alert.Stream, resp.Status)
+	}
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"math"
+
+	"golang-webrtc-streaming/internal/stats"
+)
+
+// Status buckets a score against the configured thresholds.
+type Status string
+
+const (
+	StatusHealthy   Status = "healthy"
+	StatusDegraded  Status = "degraded"
+	StatusUnhealthy Status = "unhealthy"
+)
+
+// Input is everything the score is computed from for one stream.
+type Input struct {
+	Source stats.Snapshot
+	// RecentRestarts and RecentStalls count events within the scoring window
+	RecentRestarts int
+	RecentStalls   int
+	// ViewerLoss is the average fraction of packets lost by viewers (0-1)
+	ViewerLoss float64
+}
+
+// Components are the individual 0-100 scores that make up the total.
+type Components struct {
+	Continuity      float64 `json:"continuity"`
+	KeyframeCadence float64 `json:"keyframe_cadence"`
+	Stability       float64 `json:"stability"`
+	ViewerLoss      float64 `json:"viewer_loss"`
+}
+
+// Component weights; they sum to 1
+const (
+	continuityWeight = 0.4
+	keyframeWeight   = 0.2
+	stabilityWeight  = 0.2
+	lossWeight       = 0.2
+)
+
+// Score computes a 0-100 health score. A stopped source scores zero.
+func Score(in Input) (float64, Components) {
+	var c Components
+	if !in.Source.Running {
+		return 0, c
+	}
+
+	// Fresh frames score fully; a feed silent for 5s scores nothing. Each
+	// recent stall costs a further 10 points.
+	c.Continuity = clamp(linear(in.Source.LastFrameAgeSeconds, 1, 5) - 10*float64(in.RecentStalls))
+
+	// Keyframes every 2s or better are ideal; 10s or worse means slow joins
+	// and long recovery after loss
+	switch {
+	case in.Source.KeyframeIntervalSeconds > 0:
+		c.KeyframeCadence = linear(in.Source.KeyframeIntervalSeconds, 2, 10)
+	case in.Source.Keyframes > 0:
+		c.KeyframeCadence = 100
+	default:
+		c.KeyframeCadence = 0
+	}
+
+	c.Stability = clamp(100 - 25*float64(in.RecentRestarts))
+
+	// 10% loss or more makes video unwatchable
+	c.ViewerLoss = linear(in.ViewerLoss, 0, 0.1)
+
+	total := continuityWeight*c.Continuity +
+		keyframeWeight*c.KeyframeCadence +
+		stabilityWeight*c.Stability +
+		lossWeight*c.ViewerLoss
+	return math.Round(total), c
+}
+
+// linear maps v to 100 at or below good, 0 at or above bad.
+func linear(v, good, bad float64) float64 {
+	if v <= good {
+		return 100
+	}
+	if v >= bad {
+		return 0
+	}
+	return 100 * (bad - v) / (bad - good)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(100, v))
+}
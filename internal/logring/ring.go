@@ -0,0 +1,66 @@
+// Package logring keeps the latest log lines of the process in memory, so
+// they can be downloaded when the logs themselves are out of reach.
+package logring
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSize is how many lines a ring keeps unless told otherwise
+const DefaultSize = 5000
+
+// Ring is a logrus hook keeping the latest formatted lines of every entry.
+// Added after the redact hook, it keeps lines with their credentials masked.
+type Ring struct {
+	// formatter leaves out colors, which the process' own output may have
+	formatter logrus.Formatter
+	lines     []string
+	next      int
+	size      int
+	mu        sync.Mutex
+}
+
+// New returns a ring of size lines, or DefaultSize if size is not positive.
+func New(size int) *Ring {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Ring{
+		formatter: &logrus.TextFormatter{FullTimestamp: true, DisableColors: true},
+		size:      size,
+	}
+}
+
+func (r *Ring) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *Ring) Fire(entry *logrus.Entry) error {
+	data, err := r.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(string(data), "\n")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) < r.size {
+		r.lines = append(r.lines, line)
+		return nil
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % r.size
+	return nil
+}
+
+// Lines returns the kept lines, oldest first.
+func (r *Ring) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
@@ -0,0 +1,104 @@
+package media
+
+import "golang-webrtc-streaming/internal/stats"
+
+// AccessUnit is one H.264 access unit in Annex B format as read from a source.
+type AccessUnit struct {
+	Data []byte
+	// Timestamp is the wall-clock capture time in milliseconds
+	Timestamp uint32
+	// Keyframe is set for IDR slices and parameter sets that start a GOP
+	Keyframe bool
+}
+
+// NewAccessUnit copies data into an access unit so the caller may reuse its buffer.
+func NewAccessUnit(data []byte, timestamp uint32) AccessUnit {
+	nalType := stats.NALType(data)
+	return AccessUnit{
+		Data:      append([]byte(nil), data...),
+		Timestamp: timestamp,
+		Keyframe:  nalType == 5 || nalType == 7,
+	}
+}
+
+// FrameBuffer is the channel capacity sources use for their access units,
+// about one second of video at 30fps.
+const FrameBuffer = 32
+
+// Send delivers au without blocking, dropping it if ch is full so a slow
+// consumer cannot stall the reader of a source.
+func Send(ch chan<- AccessUnit, au AccessUnit) bool {
+	select {
+	case ch <- au:
+		return true
+	default:
+		return false
+	}
+}
+
+// AudioSample is one 20ms Opus packet as read from a source.
+type AudioSample struct {
+	Data []byte
+	// Timestamp is the wall-clock capture time in milliseconds, comparable
+	// to the timestamps of the source's access units
+	Timestamp uint32
+}
+
+// AudioBuffer is the channel capacity sources use for their audio samples,
+// about one second of audio.
+const AudioBuffer = 50
+
+// SendAudio delivers sample without blocking, like Send.
+func SendAudio(ch chan<- AudioSample, sample AudioSample) bool {
+	select {
+	case ch <- sample:
+		return true
+	default:
+		return false
+	}
+}
+
+// SplitH264Frames is a bufio.SplitFunc that splits an H.264 bytestream into
+// NAL units delimited by start codes.
+func SplitH264Frames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	startCode1 := []byte{0x00, 0x00, 0x00, 0x01}
+	startCode2 := []byte{0x00, 0x00, 0x01}
+
+	startPos := -1
+	for i := 0; i < len(data)-3; i++ {
+		if (i+4 <= len(data) && data[i] == startCode1[0] && data[i+1] == startCode1[1] && data[i+2] == startCode1[2] && data[i+3] == startCode1[3]) ||
+			(i+3 <= len(data) && data[i] == startCode2[0] && data[i+1] == startCode2[1] && data[i+2] == startCode2[2]) {
+			startPos = i
+			break
+		}
+	}
+
+	if startPos == -1 {
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	nextStartPos := -1
+	for i := startPos + 4; i < len(data)-3; i++ {
+		if (i+4 <= len(data) && data[i] == startCode1[0] && data[i+1] == startCode1[1] && data[i+2] == startCode1[2] && data[i+3] == startCode1[3]) ||
+			(i+3 <= len(data) && data[i] == startCode2[0] && data[i+1] == startCode2[1] && data[i+2] == startCode2[2]) {
+			nextStartPos = i
+			break
+		}
+	}
+
+	if nextStartPos == -1 {
+		if atEOF {
+			return len(data), data[startPos:], nil
+		}
+		return startPos, nil, nil
+	}
+
+	return nextStartPos, data[startPos:nextStartPos], nil
+}
@@ -0,0 +1,80 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/state"
+)
+
+// Metadata holds operator-supplied, human-friendly information about a stream.
+type Metadata struct {
+	Title     string          `json:"title,omitempty"`
+	Location  string          `json:"location,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Custom    json.RawMessage `json:"custom,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Store keeps per-stream metadata in memory and persists every change to
+// the state store.
+type Store struct {
+	db      *state.Store
+	entries map[string]Metadata
+	mu      sync.RWMutex
+}
+
+// NewStore loads all metadata from db.
+func NewStore(db *state.Store) (*Store, error) {
+	s := &Store{
+		db:      db,
+		entries: make(map[string]Metadata),
+	}
+
+	raw, err := db.List(state.BucketMetadata)
+	if err != nil {
+		return nil, err
+	}
+	for id, data := range raw {
+		var md Metadata
+		if err := json.Unmarshal(data, &md); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %s: %w", id, err)
+		}
+		s.entries[id] = md
+	}
+	return s, nil
+}
+
+func (s *Store) Get(streamID string) (Metadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	md, ok := s.entries[streamID]
+	return md, ok
+}
+
+// All returns a copy of every stored entry keyed by stream ID.
+func (s *Store) All() map[string]Metadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string]Metadata, len(s.entries))
+	for id, md := range s.entries {
+		all[id] = md
+	}
+	return all
+}
+
+// Set replaces the metadata of a stream and persists it.
+func (s *Store) Set(streamID string, md Metadata) (Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md.UpdatedAt = time.Now().UTC()
+	if err := s.db.Put(state.BucketMetadata, streamID, md); err != nil {
+		return md, err
+	}
+	s.entries[streamID] = md
+	return md, nil
+}
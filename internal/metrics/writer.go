@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Writer renders metrics in the Prometheus text exposition format.
+// Samples are grouped by metric name and written on Flush, so callers may
+// emit them in any order.
+type Writer struct {
+	w        io.Writer
+	families map[string]*family
+	order    []string
+}
+
+type family struct {
+	help    string
+	kind    string
+	samples []string
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, families: make(map[string]*family)}
+}
+
+// Counter records a counter sample. labels is a flat list of name/value pairs.
+func (mw *Writer) Counter(name, help string, value float64, labels ...string) {
+	mw.sample(name, help, "counter", value, labels)
+}
+
+// Gauge records a gauge sample. labels is a flat list of name/value pairs.
+func (mw *Writer) Gauge(name, help string, value float64, labels ...string) {
+	mw.sample(name, help, "gauge", value, labels)
+}
+
+// Histogram records a histogram with its cumulative buckets, sum, and count.
+func (mw *Writer) Histogram(name, help string, h *Histogram, labels ...string) {
+	bounds, counts, sum, count := h.snapshot()
+
+	f := mw.family(name, help, "histogram")
+	for i, bound := range bounds {
+		le := append(append([]string(nil), labels...), "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		f.samples = append(f.samples, fmt.Sprintf("%s_bucket%s %d\n", name, formatLabels(le), counts[i]))
+	}
+	inf := append(append([]string(nil), labels...), "le", "+Inf")
+	f.samples = append(f.samples,
+		fmt.Sprintf("%s_bucket%s %d\n", name, formatLabels(inf), count),
+		fmt.Sprintf("%s_sum%s %v\n", name, formatLabels(labels), sum),
+		fmt.Sprintf("%s_count%s %d\n", name, formatLabels(labels), count),
+	)
+}
+
+// Histogram counts observations into fixed buckets. It is safe for
+// concurrent use.
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+	mu     sync.Mutex
+}
+
+// NewHistogram creates a histogram with the given ascending upper bounds.
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// Observe adds one observation.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) snapshot() (bounds []float64, counts []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.bounds, append([]uint64(nil), h.counts...), h.sum, h.count
+}
+
+// Flush writes all recorded families to the underlying writer.
+func (mw *Writer) Flush() error {
+	for _, name := range mw.order {
+		f := mw.families[name]
+		if _, err := fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind); err != nil {
+			return err
+		}
+		for _, sample := range f.samples {
+			if _, err := io.WriteString(mw.w, sample); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (mw *Writer) sample(name, help, kind string, value float64, labels []string) {
+	f := mw.family(name, help, kind)
+	f.samples = append(f.samples, fmt.Sprintf("%s%s %v\n", name, formatLabels(labels), value))
+}
+
+func (mw *Writer) family(name, help, kind string) *family {
+	f, ok := mw.families[name]
+	if !ok {
+		f = &family{help: help, kind: kind}
+		mw.families[name] = f
+		mw.order = append(mw.order, name)
+	}
+	return f
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
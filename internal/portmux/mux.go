@@ -0,0 +1,136 @@
+// Package portmux shares one TCP listener between HTTP(S) and ICE-TCP, so
+// signaling and media can be exposed on a single port such as 443.
+package portmux
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sniffTimeout bounds how long a new connection may take to send its first byte
+const sniffTimeout = 10 * time.Second
+
+// tlsHandshake is the record type that opens every TLS connection
+const tlsHandshake = 0x16
+
+// Mux accepts connections from a shared listener and hands each one to the
+// HTTP or the ICE listener depending on its first byte.
+type Mux struct {
+	root net.Listener
+	http *listener
+	ice  *listener
+}
+
+// New starts demultiplexing connections accepted from root.
+func New(root net.Listener) *Mux {
+	m := &Mux{
+		root: root,
+		http: newListener(root.Addr()),
+		ice:  newListener(root.Addr()),
+	}
+	go m.serve()
+	return m
+}
+
+// HTTP returns the listener receiving TLS and plain HTTP connections.
+func (m *Mux) HTTP() net.Listener { return m.http }
+
+// ICE returns the listener receiving RFC 4571 framed ICE-TCP connections.
+func (m *Mux) ICE() net.Listener { return m.ice }
+
+// Close stops accepting connections on the shared listener.
+func (m *Mux) Close() error {
+	err := m.root.Close()
+	m.http.Close()
+	m.ice.Close()
+	return err
+}
+
+func (m *Mux) serve() {
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.Errorf("Shared port accept failed: %v", err)
+			}
+			m.http.Close()
+			m.ice.Close()
+			return
+		}
+		go m.route(conn)
+	}
+}
+
+// route peeks at the first byte: TLS handshakes and ASCII request lines are
+// HTTP, anything else is the length prefix of a framed STUN message.
+func (m *Mux) route(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	first, err := reader.Peek(1)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	target := m.ice
+	if first[0] == tlsHandshake || (first[0] >= 'A' && first[0] <= 'Z') {
+		target = m.http
+	}
+	target.deliver(&peekedConn{Conn: conn, reader: reader})
+}
+
+// peekedConn replays the bytes buffered while sniffing.
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// listener is a net.Listener fed by the mux.
+type listener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	done   chan struct{}
+	closed sync.Once
+}
+
+func newListener(addr net.Addr) *listener {
+	return &listener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *listener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closed.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
@@ -0,0 +1,98 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+)
+
+// Format is an animated image container.
+type Format string
+
+const (
+	FormatGIF  Format = "gif"
+	FormatWebP Format = "webp"
+)
+
+// Options controls the size and smoothness of a preview.
+type Options struct {
+	Seconds float64
+	FPS     int
+	Width   int
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == FormatWebP {
+		return "image/webp"
+	}
+	return "image/gif"
+}
+
+// Render turns Annex B H.264 into a looping animated image covering the last
+// opts.Seconds of the input. sourceFPS is the rate the H.264 was captured at;
+// raw H.264 carries no timestamps, so ffmpeg needs it to pace the input.
+func Render(ctx context.Context, h264 []byte, sourceFPS float64, format Format, opts Options) ([]byte, error) {
+	if sourceFPS <= 0 {
+		sourceFPS = 30
+	}
+
+	inputDuration := 0.0
+	if frames := countPictures(h264); frames > 0 {
+		inputDuration = float64(frames) / sourceFPS
+	}
+	// The buffer starts at a keyframe before the requested window
+	skip := inputDuration - opts.Seconds
+	if skip < 0 {
+		skip = 0
+	}
+
+	scale := fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", opts.FPS, opts.Width)
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "h264", "-r", fmt.Sprintf("%.3f", sourceFPS), "-i", "pipe:0",
+		"-ss", fmt.Sprintf("%.3f", skip), "-t", fmt.Sprintf("%.3f", opts.Seconds),
+		"-an",
+	}
+	switch format {
+	case FormatWebP:
+		args = append(args, "-vf", scale, "-c:v", "libwebp", "-quality", "70", "-loop", "0", "-f", "webp", "pipe:1")
+	default:
+		// A per-clip palette keeps GIF colour banding down
+		args = append(args,
+			"-filter_complex", scale+",split[a][b];[a]palettegen=stats_mode=diff[p];[b][p]paletteuse=dither=bayer",
+			"-loop", "0", "-f", "gif", "pipe:1")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := ffmpeg.CommandContext(ctx, args...)
+	cmd.Stdin = bytes.NewReader(h264)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := ffmpeg.Run(cmd); err != nil {
+		return nil, fmt.Errorf("ffmpeg preview failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg produced an empty preview")
+	}
+	return stdout.Bytes(), nil
+}
+
+// countPictures counts coded pictures by their first slice in Annex B data.
+func countPictures(data []byte) int {
+	count := 0
+	for i := 0; i+4 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		header, slice := data[i+3], data[i+4]
+		if nalType := header & 0x1F; (nalType == 1 || nalType == 5) && slice&0x80 != 0 {
+			count++
+		}
+		i += 2
+	}
+	return count
+}
@@ -0,0 +1,197 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxClipDuration bounds a single export
+const maxClipDuration = time.Hour
+
+// ClipRequest describes a clip to cut from recorded segments.
+type ClipRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Overlay burns the wall-clock time and Label into the video
+	Overlay bool   `json:"overlay"`
+	Label   string `json:"label,omitempty"`
+}
+
+// Clip is an exported MP4 file.
+type Clip struct {
+	Name      string    `json:"name"`
+	StreamID  string    `json:"stream_id"`
+	Path      string    `json:"-"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Overlay   bool      `json:"overlay"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// ExportClip cuts [From, To) of a stream's recordings into a single MP4. Without
+// an overlay the video is stream-copied and cut on keyframes; with an overlay it
+// is re-encoded so the timestamp can be drawn on every frame.
+func (m *Manager) ExportClip(ctx context.Context, streamID string, req ClipRequest) (Clip, error) {
+	if !req.To.After(req.From) {
+		return Clip{}, fmt.Errorf("clip end must be after start")
+	}
+	if req.To.Sub(req.From) > maxClipDuration {
+		return Clip{}, fmt.Errorf("clip longer than %s", maxClipDuration)
+	}
+
+	m.mu.Lock()
+	guard := m.startGuard
+	m.mu.Unlock()
+	if guard != nil {
+		if err := guard(); err != nil {
+			return Clip{}, err
+		}
+	}
+
+	segments, err := m.Segments(streamID, req.From, req.To)
+	if err != nil {
+		return Clip{}, err
+	}
+	if len(segments) == 0 {
+		return Clip{}, fmt.Errorf("no recordings of %s between %s and %s", streamID, req.From.Format(time.RFC3339), req.To.Format(time.RFC3339))
+	}
+
+	dir := filepath.Join(m.cfg.ClipsDir, streamID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Clip{}, fmt.Errorf("failed to create clips directory: %w", err)
+	}
+
+	listFile, err := writeConcatList(segments)
+	if err != nil {
+		return Clip{}, err
+	}
+	defer os.Remove(listFile)
+
+	// Clamp to what was actually recorded so the overlay clock stays correct
+	from := req.From
+	if segments[0].Start.After(from) {
+		from = segments[0].Start
+	}
+	offset := from.Sub(segments[0].Start).Seconds()
+	duration := req.To.Sub(from).Seconds()
+	if !req.Overlay {
+		// A stream copy starts on the keyframe at or before the offset, so
+		// that is the wall-clock time of the clip's first frame
+		from = segments[0].Start.Add(time.Duration(SeekOffset(segments, offset) * float64(time.Second)))
+	}
+
+	clip := Clip{
+		Name:     fmt.Sprintf("%s-%s.mp4", from.UTC().Format(segmentTimeLayout), req.To.UTC().Format(segmentTimeLayout)),
+		StreamID: streamID,
+		From:     from,
+		To:       req.To,
+		Overlay:  req.Overlay,
+	}
+	if req.Overlay {
+		clip.Name = strings.TrimSuffix(clip.Name, ".mp4") + "-ts.mp4"
+	}
+	clip.Path = filepath.Join(dir, clip.Name)
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-ss", fmt.Sprintf("%.3f", offset),
+		"-f", "concat", "-safe", "0", "-i", listFile,
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-map", "0:v:0", "-map", "0:a?",
+	}
+	if req.Overlay {
+		textFile, err := writeOverlayText(req.Label, from)
+		if err != nil {
+			return Clip{}, err
+		}
+		defer os.Remove(textFile)
+
+		args = append(args,
+			"-vf", "drawtext=textfile='"+textFile+"':x=10:y=10:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=6",
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "20",
+			"-c:a", "aac",
+		)
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	// Stamp the absolute time of the first frame, so the clip keeps it
+	// wherever it is copied to
+	args = append(args,
+		"-metadata", "creation_time="+from.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		"-movflags", "+faststart",
+		clip.Path,
+	)
+
+	var output bytes.Buffer
+	cmd := ffmpeg.CommandContext(ctx, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := ffmpeg.Run(cmd); err != nil {
+		os.Remove(clip.Path)
+		return Clip{}, fmt.Errorf("ffmpeg clip export failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	if info, err := os.Stat(clip.Path); err == nil {
+		clip.SizeBytes = info.Size()
+	}
+	logrus.Infof("🎞️ Exported clip %s of %s (%.0fs, overlay=%v)", clip.Name, streamID, duration, req.Overlay)
+	return clip, nil
+}
+
+// ClipPath resolves an exported clip by stream and file name.
+func (m *Manager) ClipPath(streamID, name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".mp4") {
+		return "", fmt.Errorf("invalid clip name")
+	}
+	path := filepath.Join(m.cfg.ClipsDir, streamID, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("clip %s not found", name)
+	}
+	return path, nil
+}
+
+func writeConcatList(segments []Segment) (string, error) {
+	f, err := os.CreateTemp("", "clip-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create concat list: %w", err)
+	}
+	defer f.Close()
+
+	for _, seg := range segments {
+		path, err := filepath.Abs(seg.Path)
+		if err != nil {
+			path = seg.Path
+		}
+		fmt.Fprintf(f, "file '%s'\n", strings.ReplaceAll(path, "'", `'\''`))
+	}
+	return f.Name(), nil
+}
+
+// writeOverlayText builds the drawtext text: the label followed by the frame's
+// wall-clock time (pts offset by the clip start). It is stored in a file so
+// the label needs no filtergraph escaping, only drawtext's own.
+func writeOverlayText(label string, start time.Time) (string, error) {
+	f, err := os.CreateTemp("", "clip-text-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create overlay text: %w", err)
+	}
+	defer f.Close()
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`).Replace(label)
+	if escaped != "" {
+		escaped += "  "
+	}
+	if _, err := f.WriteString(escaped + fmt.Sprintf("%%{pts:localtime:%.3f}", float64(start.UnixMilli())/1000)); err != nil {
+		return "", fmt.Errorf("failed to write overlay text: %w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,179 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Segment is one recorded file as stored in the index.
+type Segment struct {
+	ID              int64     `json:"id"`
+	StreamID        string    `json:"stream_id"`
+	Path            string    `json:"path"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	SizeBytes       int64     `json:"size_bytes"`
+	// KeyframeOffsets are keyframe positions in seconds from the segment start
+	KeyframeOffsets []float64 `json:"keyframe_offsets"`
+}
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS segments (
+	id               INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream_id        TEXT    NOT NULL,
+	path             TEXT    NOT NULL UNIQUE,
+	start_unix_ms    INTEGER NOT NULL,
+	end_unix_ms      INTEGER NOT NULL,
+	duration_seconds REAL    NOT NULL,
+	size_bytes       INTEGER NOT NULL,
+	keyframe_offsets TEXT    NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS segments_stream_time ON segments (stream_id, start_unix_ms, end_unix_ms);
+`
+
+// Index is a SQLite catalogue of recorded segments, so time-range queries do
+// not need to scan the filesystem.
+type Index struct {
+	db *sql.DB
+}
+
+func OpenIndex(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording index: %w", err)
+	}
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create recording index schema: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// Add inserts or replaces a segment and returns its ID.
+func (ix *Index) Add(seg Segment) (int64, error) {
+	offsets, err := json.Marshal(seg.KeyframeOffsets)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := ix.db.Exec(`INSERT OR REPLACE INTO segments
+		(stream_id, path, start_unix_ms, end_unix_ms, duration_seconds, size_bytes, keyframe_offsets)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		seg.StreamID, seg.Path, seg.Start.UnixMilli(), seg.End.UnixMilli(), seg.DurationSeconds, seg.SizeBytes, string(offsets))
+	if err != nil {
+		return 0, fmt.Errorf("failed to index segment: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// Get returns a segment by ID.
+func (ix *Index) Get(id int64) (Segment, error) {
+	segs, err := ix.query(`WHERE id = ?`, id)
+	if err != nil {
+		return Segment{}, err
+	}
+	if len(segs) == 0 {
+		return Segment{}, fmt.Errorf("segment %d not found", id)
+	}
+	return segs[0], nil
+}
+
+// Query returns the segments of a stream overlapping [from, to), oldest first.
+// A zero from or to leaves that side of the range open.
+func (ix *Index) Query(streamID string, from, to time.Time) ([]Segment, error) {
+	var endMS int64 = 1<<63 - 1
+	if !to.IsZero() {
+		endMS = to.UnixMilli()
+	}
+	return ix.query(`WHERE stream_id = ? AND end_unix_ms > ? AND start_unix_ms < ? ORDER BY start_unix_ms`,
+		streamID, from.UnixMilli(), endMS)
+}
+
+// DeleteByPath removes the entry for a file that no longer exists.
+func (ix *Index) DeleteByPath(path string) error {
+	_, err := ix.db.Exec(`DELETE FROM segments WHERE path = ?`, path)
+	return err
+}
+
+func (ix *Index) query(where string, args ...interface{}) ([]Segment, error) {
+	rows, err := ix.db.Query(`SELECT id, stream_id, path, start_unix_ms, end_unix_ms, duration_seconds, size_bytes, keyframe_offsets
+		FROM segments `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recording index: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Segment
+	for rows.Next() {
+		var seg Segment
+		var startMS, endMS int64
+		var offsets string
+		if err := rows.Scan(&seg.ID, &seg.StreamID, &seg.Path, &startMS, &endMS, &seg.DurationSeconds, &seg.SizeBytes, &offsets); err != nil {
+			return nil, err
+		}
+		seg.Start = time.UnixMilli(startMS)
+		seg.End = time.UnixMilli(endMS)
+		_ = json.Unmarshal([]byte(offsets), &seg.KeyframeOffsets)
+		out = append(out, seg)
+	}
+	return out, rows.Err()
+}
+
+// probeKeyframes returns keyframe offsets in seconds relative to the first video packet.
+func probeKeyframes(path string) ([]float64, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		path,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	offsets := []float64{}
+	first := -1.0
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 2 {
+			continue
+		}
+		pts, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		if first < 0 {
+			first = pts
+		}
+		if strings.Contains(fields[1], "K") {
+			offsets = append(offsets, pts-first)
+		}
+	}
+	return offsets, nil
+}
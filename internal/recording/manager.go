@@ -0,0 +1,406 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scheduleCheckInterval is how often schedules are evaluated
+const scheduleCheckInterval = 15 * time.Second
+
+// Config controls where and how recordings are written.
+type Config struct {
+	Dir            string
+	ClipsDir       string
+	SegmentSeconds int
+	// State persists schedules changed through the API
+	State *state.Store
+	// Schedules from static configuration; persisted API changes take precedence
+	Schedules map[string]Schedule
+	// Renditions of streams recorded differently from their live output
+	Renditions map[string]Rendition
+	// Time-lapses are assembled every TimelapseAssembleEvery and played at
+	// TimelapseFPS sampled frames per second
+	TimelapseDir           string
+	TimelapseAssembleEvery time.Duration
+	TimelapseFPS           int
+}
+
+// Manager owns the recorders of all streams and drives them from schedules.
+type Manager struct {
+	cfg        Config
+	resolveURL func(streamID string) (string, error)
+	ctx        context.Context
+	recorders  map[string]*Recorder
+	scheduled  map[string]bool
+	schedules  map[string]Schedule
+	startGuard func() error
+	// Streams whose recorders hold off because they are blacked out
+	blackouts map[string]bool
+	index     *Index
+	events    *events.Bus
+	mu        sync.Mutex
+}
+
+// NewManager creates a recording manager. resolveURL maps a stream ID to the
+// URL ffmpeg should record from, unless its rendition has a URL of its own.
+func NewManager(cfg Config, resolveURL func(streamID string) (string, error)) (*Manager, error) {
+	if cfg.SegmentSeconds <= 0 {
+		cfg.SegmentSeconds = 60
+	}
+	if cfg.TimelapseAssembleEvery <= 0 {
+		cfg.TimelapseAssembleEvery = time.Hour
+	}
+	if cfg.TimelapseFPS <= 0 {
+		cfg.TimelapseFPS = 30
+	}
+
+	m := &Manager{
+		cfg:        cfg,
+		resolveURL: resolveURL,
+		recorders:  make(map[string]*Recorder),
+		scheduled:  make(map[string]bool),
+		schedules:  make(map[string]Schedule),
+		blackouts:  make(map[string]bool),
+	}
+	for id, schedule := range cfg.Schedules {
+		m.schedules[id] = schedule
+	}
+
+	if err := m.loadSchedules(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run evaluates schedules until ctx is cancelled, then stops all recorders.
+func (m *Manager) Run(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	m.applySchedules()
+	for {
+		select {
+		case <-ctx.Done():
+			m.StopAll()
+			return
+		case <-ticker.C:
+			m.applySchedules()
+		}
+	}
+}
+
+// Start begins a manual recording of a stream.
+func (m *Manager) Start(streamID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.startLocked(streamID, false)
+}
+
+// Stop ends the recording of a stream, whether manual or scheduled.
+func (m *Manager) Stop(streamID string) error {
+	m.mu.Lock()
+	recorder, ok := m.recorders[streamID]
+	delete(m.recorders, streamID)
+	delete(m.scheduled, streamID)
+	bus := m.events
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("stream %s is not being recorded", streamID)
+	}
+	recorder.stop()
+	bus.Publish(events.Event{Type: events.RecordingStopped, Stream: streamID})
+	return nil
+}
+
+// Pause stops writing a stream's recording, finalizing the current segment,
+// without ending it; a schedule neither resumes nor restarts it.
+func (m *Manager) Pause(streamID string) error {
+	return m.control(streamID, (*Recorder).pause, events.RecordingPaused)
+}
+
+// Resume continues a paused recording in a new segment.
+func (m *Manager) Resume(streamID string) error {
+	return m.control(streamID, (*Recorder).unpause, events.RecordingResumed)
+}
+
+// Split ends the current segment of a recording and starts the next one, so
+// segments can be aligned to shifts or events.
+func (m *Manager) Split(streamID string) error {
+	return m.control(streamID, (*Recorder).split, events.RecordingSplit)
+}
+
+func (m *Manager) control(streamID string, action func(*Recorder) error, eventType events.Type) error {
+	m.mu.Lock()
+	recorder, ok := m.recorders[streamID]
+	bus := m.events
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("stream %s is not being recorded", streamID)
+	}
+	if err := action(recorder); err != nil {
+		return err
+	}
+	bus.Publish(events.Event{Type: eventType, Stream: streamID})
+	return nil
+}
+
+// SetBlackout holds off the recording of a stream while it is blacked out,
+// including recordings started meanwhile, and continues it afterwards.
+func (m *Manager) SetBlackout(streamID string, on bool) {
+	m.mu.Lock()
+	if on {
+		m.blackouts[streamID] = true
+	} else {
+		delete(m.blackouts, streamID)
+	}
+	recorder := m.recorders[streamID]
+	m.mu.Unlock()
+
+	if recorder != nil {
+		recorder.setBlackout(on)
+	}
+}
+
+// IsRecording reports whether a stream is being recorded, manually or on schedule.
+func (m *Manager) IsRecording(streamID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.recorders[streamID]
+	return ok
+}
+
+// SetStartGuard installs a check that must pass before any recorder starts,
+// e.g. a storage quota.
+func (m *Manager) SetStartGuard(guard func() error) {
+	m.mu.Lock()
+	m.startGuard = guard
+	m.mu.Unlock()
+}
+
+// SetEvents publishes recording starts and stops on bus.
+func (m *Manager) SetEvents(bus *events.Bus) {
+	m.mu.Lock()
+	m.events = bus
+	m.mu.Unlock()
+}
+
+// SetIndex enables cataloguing of completed segments.
+func (m *Manager) SetIndex(index *Index) {
+	m.mu.Lock()
+	m.index = index
+	m.mu.Unlock()
+}
+
+// Segments returns indexed segments of a stream overlapping [from, to).
+func (m *Manager) Segments(streamID string, from, to time.Time) ([]Segment, error) {
+	m.mu.Lock()
+	index := m.index
+	m.mu.Unlock()
+
+	if index == nil {
+		return nil, fmt.Errorf("recording index not enabled")
+	}
+	return index.Query(streamID, from, to)
+}
+
+// indexSegment records a completed segment with its size and keyframe positions.
+func (m *Manager) indexSegment(seg Segment) {
+	m.mu.Lock()
+	index := m.index
+	m.mu.Unlock()
+	if index == nil {
+		return
+	}
+
+	if info, err := os.Stat(seg.Path); err == nil {
+		seg.SizeBytes = info.Size()
+	}
+	offsets, err := probeKeyframes(seg.Path)
+	if err != nil {
+		logrus.Warnf("Failed to probe keyframes of %s: %v", seg.Path, err)
+		offsets = []float64{}
+	}
+	seg.KeyframeOffsets = offsets
+
+	if _, err := index.Add(seg); err != nil {
+		logrus.Errorf("Failed to index segment %s: %v", seg.Path, err)
+		return
+	}
+	logrus.Debugf("Indexed segment %s (%.1fs, %d keyframes)", seg.Path, seg.DurationSeconds, len(offsets))
+}
+
+// Active lists the recorders that are currently running.
+func (m *Manager) Active() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Status, 0, len(m.recorders))
+	for id, recorder := range m.recorders {
+		recorder.mu.RLock()
+		out = append(out, Status{
+			StreamID:  id,
+			Directory: recorder.dir,
+			StartedAt: recorder.startedAt,
+			Scheduled: m.scheduled[id],
+			Rendition: recorder.rendition.String(),
+			Paused:    recorder.paused,
+		})
+		if recorder.paused {
+			out[len(out)-1].PausedAt = recorder.pausedAt
+		}
+		recorder.mu.RUnlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StreamID < out[j].StreamID })
+	return out
+}
+
+func (m *Manager) GetSchedule(streamID string) (Schedule, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule, ok := m.schedules[streamID]
+	return schedule, ok
+}
+
+// SetSchedule replaces a stream's schedule, persists it, and applies it immediately.
+func (m *Manager) SetSchedule(streamID string, schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.schedules[streamID] = schedule
+	err := m.saveSchedule(streamID)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.applySchedules()
+	return nil
+}
+
+func (m *Manager) startLocked(streamID string, scheduled bool) error {
+	if m.ctx == nil {
+		return fmt.Errorf("recording manager is not running")
+	}
+	if _, ok := m.recorders[streamID]; ok {
+		return fmt.Errorf("stream %s is already being recorded", streamID)
+	}
+	if m.startGuard != nil {
+		if err := m.startGuard(); err != nil {
+			return err
+		}
+	}
+
+	rendition := m.cfg.Renditions[streamID]
+	url := rendition.URL
+	if url == "" {
+		var err error
+		if url, err = m.resolveURL(streamID); err != nil {
+			return err
+		}
+	}
+
+	recorder := newRecorder(streamID, url, rendition, filepath.Join(m.cfg.Dir, streamID), m.cfg.SegmentSeconds, func(seg Segment) {
+		go m.indexSegment(seg)
+	})
+	recorder.setBlackout(m.blackouts[streamID])
+	if err := recorder.start(m.ctx); err != nil {
+		return err
+	}
+	m.recorders[streamID] = recorder
+	m.scheduled[streamID] = scheduled
+	m.events.Publish(events.Event{
+		Type:   events.RecordingStarted,
+		Stream: streamID,
+		Data:   map[string]interface{}{"scheduled": scheduled},
+	})
+	return nil
+}
+
+// applySchedules starts recorders whose window opened and stops scheduled
+// recorders whose window closed. Manual recordings are left alone.
+func (m *Manager) applySchedules() {
+	now := time.Now()
+
+	m.mu.Lock()
+	var toStop []string
+	for id, schedule := range m.schedules {
+		_, recording := m.recorders[id]
+		active := schedule.Active(now)
+		switch {
+		case active && !recording:
+			if err := m.startLocked(id, true); err != nil {
+				logrus.Errorf("Failed to start scheduled recording of %s: %v", id, err)
+			}
+		case !active && recording && m.scheduled[id]:
+			toStop = append(toStop, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range toStop {
+		if err := m.Stop(id); err != nil {
+			logrus.Warnf("Failed to stop scheduled recording of %s: %v", id, err)
+		}
+	}
+}
+
+// StopAll stops every running recorder.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	recorders := m.recorders
+	m.recorders = make(map[string]*Recorder)
+	m.scheduled = make(map[string]bool)
+	bus := m.events
+	m.mu.Unlock()
+
+	for id, recorder := range recorders {
+		recorder.stop()
+		bus.Publish(events.Event{Type: events.RecordingStopped, Stream: id})
+	}
+}
+
+func (m *Manager) loadSchedules() error {
+	if m.cfg.State == nil {
+		return nil
+	}
+
+	persisted, err := m.cfg.State.List(state.BucketSchedules)
+	if err != nil {
+		return err
+	}
+	for id, data := range persisted {
+		var schedule Schedule
+		if err := json.Unmarshal(data, &schedule); err != nil {
+			return fmt.Errorf("failed to parse schedule of %s: %w", id, err)
+		}
+		m.schedules[id] = schedule
+	}
+	return nil
+}
+
+func (m *Manager) saveSchedule(streamID string) error {
+	if m.cfg.State == nil {
+		return nil
+	}
+	return m.cfg.State.Put(state.BucketSchedules, streamID, m.schedules[streamID])
+}
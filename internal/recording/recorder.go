@@ -0,0 +1,364 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Recorder writes one stream to disk as fixed-length MPEG-TS segments in
+// its rendition, by default using ffmpeg stream copy. The process is
+// restarted with backoff if it exits.
+type Recorder struct {
+	streamID       string
+	url            string
+	rendition      Rendition
+	dir            string
+	segmentSeconds int
+	onSegment      func(Segment)
+	startedAt      time.Time
+	cancel         context.CancelFunc
+	done           chan struct{}
+	// cancelRun ends the current ffmpeg run, finalizing its segment
+	cancelRun context.CancelFunc
+	// lastRunAt is when ffmpeg was last started; segment file names only
+	// have whole seconds, so runs never start within the same second
+	lastRunAt time.Time
+	// While paused or blacked out no ffmpeg runs; resume is closed when
+	// neither is left
+	paused     bool
+	pausedAt   time.Time
+	blackedOut bool
+	resume     chan struct{}
+	mu         sync.RWMutex
+}
+
+func newRecorder(streamID, url string, rendition Rendition, dir string, segmentSeconds int, onSegment func(Segment)) *Recorder {
+	return &Recorder{
+		streamID:       streamID,
+		url:            url,
+		rendition:      rendition,
+		dir:            dir,
+		segmentSeconds: segmentSeconds,
+		onSegment:      onSegment,
+	}
+}
+
+func (r *Recorder) start(ctx context.Context) error {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	r.startedAt = time.Now()
+	r.mu.Unlock()
+
+	go r.supervise(ctx)
+	logrus.Infof("⏺️ Started recording %s (%s) into %s", r.streamID, r.rendition, r.dir)
+	return nil
+}
+
+// stop terminates ffmpeg and waits for the current segment to be finalized.
+func (r *Recorder) stop() {
+	r.mu.RLock()
+	cancel, done := r.cancel, r.done
+	r.mu.RUnlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	logrus.Infof("⏹️ Stopped recording %s", r.streamID)
+}
+
+// pause ends the current segment and stops writing until resume.
+func (r *Recorder) pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		return fmt.Errorf("recording of %s is already paused", r.streamID)
+	}
+	r.paused = true
+	r.pausedAt = time.Now()
+	if !r.blackedOut {
+		r.resume = make(chan struct{})
+		if r.cancelRun != nil {
+			r.cancelRun()
+		}
+	}
+	logrus.Infof("⏸️ Paused recording %s", r.streamID)
+	return nil
+}
+
+func (r *Recorder) unpause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused {
+		return fmt.Errorf("recording of %s is not paused", r.streamID)
+	}
+	r.paused = false
+	if !r.blackedOut {
+		close(r.resume)
+	}
+	logrus.Infof("⏺️ Resumed recording %s", r.streamID)
+	return nil
+}
+
+// setBlackout stops writing while the stream is blacked out, so the live
+// media it replaces is not recorded either. It is independent of pause.
+func (r *Recorder) setBlackout(on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blackedOut == on {
+		return
+	}
+	r.blackedOut = on
+	if r.paused {
+		return
+	}
+	if on {
+		r.resume = make(chan struct{})
+		if r.cancelRun != nil {
+			r.cancelRun()
+		}
+		logrus.Infof("⏸️ Holding recording %s during blackout", r.streamID)
+	} else {
+		close(r.resume)
+		logrus.Infof("⏺️ Continuing recording %s after blackout", r.streamID)
+	}
+}
+
+// split ends the current segment early; the next one starts right away.
+func (r *Recorder) split() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused || r.blackedOut {
+		return fmt.Errorf("recording of %s is paused", r.streamID)
+	}
+	if r.cancelRun != nil {
+		r.cancelRun()
+	}
+	logrus.Infof("✂️ Splitting recording %s", r.streamID)
+	return nil
+}
+
+func (r *Recorder) supervise(ctx context.Context) {
+	defer close(r.done)
+
+	backoff := time.Second * 2
+	const maxBackoff = time.Second * 30
+
+	for {
+		r.mu.RLock()
+		paused, resume, lastRunAt := r.paused || r.blackedOut, r.resume, r.lastRunAt
+		r.mu.RUnlock()
+		if paused {
+			select {
+			case <-ctx.Done():
+				return
+			case <-resume:
+			}
+			continue
+		}
+		// Wait for the next second so the new segment gets a file name of its own
+		if wait := time.Until(lastRunAt.Truncate(time.Second).Add(time.Second)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		runCtx, cancelRun := context.WithCancel(ctx)
+		r.mu.Lock()
+		if r.paused || r.blackedOut {
+			// Paused between the check above and now
+			r.mu.Unlock()
+			cancelRun()
+			continue
+		}
+		r.cancelRun = cancelRun
+		r.lastRunAt = time.Now()
+		r.mu.Unlock()
+
+		err := r.runOnce(runCtx)
+		interrupted := runCtx.Err() != nil
+		cancelRun()
+		if err != nil {
+			logrus.Errorf("Recording %s error: %v", r.streamID, err)
+		}
+		if interrupted && ctx.Err() == nil {
+			// Paused or split, not failed
+			backoff = time.Second * 2
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+func (r *Recorder) runOnce(ctx context.Context) error {
+	args := []string{"-hide_banner", "-loglevel", "warning"}
+	if strings.HasPrefix(r.url, "rtsp://") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args, "-i", r.url)
+	args = append(args, r.rendition.inputArgs()...)
+	args = append(args, r.rendition.videoArgs()...)
+	args = append(args,
+		"-map", "0:a?",
+		"-c:a", "aac",
+		"-f", "segment",
+		"-segment_time", fmt.Sprint(r.segmentSeconds),
+		"-segment_format", "mpegts",
+		"-strftime", "1",
+		// Completed segments are announced on stdout as "file,start,end"
+		"-segment_list", "pipe:1",
+		"-segment_list_type", "csv",
+		filepath.Join(r.dir, segmentTimeFormat+".ts"),
+	)
+
+	// Not CommandContext: on stop ffmpeg gets SIGINT so it can finish the segment
+	cmd := ffmpeg.Command(args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	go func() {
+		// Timestamps restart with every ffmpeg run
+		clock := &ptsClock{}
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if seg, ok := r.parseSegmentEntry(scanner.Text(), clock, time.Now()); ok && r.onSegment != nil {
+				r.onSegment(seg)
+			}
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Warnf("FFmpeg (record %s): %s", r.streamID, scanner.Text())
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			return fmt.Errorf("ffmpeg exited: %w", err)
+		}
+		return fmt.Errorf("ffmpeg exited unexpectedly")
+	case <-ctx.Done():
+		_ = cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}
+}
+
+// segmentTimeFormat is the strftime pattern of segment file names; the
+// matching Go layout is segmentTimeLayout
+const (
+	segmentTimeFormat = "%Y%m%d-%H%M%S"
+	segmentTimeLayout = "20060102-150405"
+)
+
+// ptsClock maps the muxer timestamps of one ffmpeg run to wall-clock time.
+// A segment is announced once its last frame has been written, so the time
+// it arrives minus its end timestamp bounds the wall-clock time of
+// timestamp zero from above; the earliest bound seen is the closest, as
+// pipeline delays only ever push it later.
+type ptsClock struct {
+	origin time.Time
+}
+
+func (c *ptsClock) observe(endPTS float64, now time.Time) {
+	candidate := now.Add(-time.Duration(endPTS * float64(time.Second)))
+	if c.origin.IsZero() || candidate.Before(c.origin) {
+		c.origin = candidate
+	}
+}
+
+func (c *ptsClock) at(pts float64) time.Time {
+	return c.origin.Add(time.Duration(pts * float64(time.Second))).Round(time.Millisecond)
+}
+
+// parseSegmentEntry converts a segment list line, announced at now, into a
+// Segment. Its wall-clock start and end are placed on clock with millisecond
+// precision, rather than taken from the whole-second file name.
+func (r *Recorder) parseSegmentEntry(line string, clock *ptsClock, now time.Time) (Segment, bool) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) < 3 {
+		return Segment{}, false
+	}
+	startPTS, err1 := strconv.ParseFloat(fields[1], 64)
+	endPTS, err2 := strconv.ParseFloat(fields[2], 64)
+	if err1 != nil || err2 != nil {
+		return Segment{}, false
+	}
+
+	name := filepath.Base(fields[0])
+	if _, err := time.ParseInLocation(segmentTimeLayout, strings.TrimSuffix(name, filepath.Ext(name)), time.Local); err != nil {
+		return Segment{}, false
+	}
+	clock.observe(endPTS, now)
+
+	return Segment{
+		StreamID:        r.streamID,
+		Path:            filepath.Join(r.dir, name),
+		Start:           clock.at(startPTS),
+		End:             clock.at(endPTS),
+		DurationSeconds: endPTS - startPTS,
+	}, true
+}
+
+// Status describes an active recorder.
+type Status struct {
+	StreamID  string    `json:"stream_id"`
+	Directory string    `json:"directory"`
+	StartedAt time.Time `json:"started_at"`
+	Scheduled bool      `json:"scheduled"`
+	// Rendition is "copy" or the size and bitrate the recording is transcoded to
+	Rendition string    `json:"rendition"`
+	Paused    bool      `json:"paused"`
+	PausedAt  time.Time `json:"paused_at,omitempty"`
+}
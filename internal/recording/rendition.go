@@ -0,0 +1,155 @@
+package recording
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+)
+
+// Rendition is the quality a stream is recorded in, independent of what
+// viewers get. The zero value stream-copies the stream's own upstream.
+type Rendition struct {
+	// URL records from another upstream than the live stream, e.g. a
+	// camera's main stream while viewers watch its substream
+	URL string `json:"-"`
+	// Encoding transcodes the recording; nil stream-copies it
+	Encoding *ffmpeg.Encoding `json:"encoding,omitempty"`
+	// Overlay is an image composited onto a transcoded recording, such as
+	// the stream's analytics overlay; stream copies cannot have one
+	Overlay string `json:"-"`
+}
+
+// String describes the rendition as written in RECORDING_RENDITIONS.
+func (r Rendition) String() string {
+	if r.Encoding == nil {
+		return "copy"
+	}
+	var s string
+	if r.Encoding.Width > 0 || r.Encoding.Height > 0 {
+		s = fmt.Sprintf("%dx%d", r.Encoding.Width, r.Encoding.Height)
+	}
+	if r.Encoding.BitrateKbps > 0 {
+		s += fmt.Sprintf("@%d", r.Encoding.BitrateKbps)
+	}
+	return s
+}
+
+// inputArgs returns the ffmpeg input arguments the rendition needs besides
+// the stream itself.
+func (r Rendition) inputArgs() []string {
+	if r.Encoding == nil || r.Overlay == "" {
+		return nil
+	}
+	return ffmpeg.OverlayInputArgs(r.Overlay)
+}
+
+// videoArgs returns the ffmpeg output arguments mapping and encoding the
+// recorded video.
+func (r Rendition) videoArgs() []string {
+	if r.Encoding == nil {
+		return []string{"-map", "0:v:0", "-c:v", "copy"}
+	}
+	if r.Overlay != "" {
+		return r.Encoding.OverlayArgs()
+	}
+	return append([]string{"-map", "0:v:0"}, r.Encoding.Args()...)
+}
+
+// ParseRenditions parses per-stream renditions written as
+// "stream=copy,stream2=1280x720@2500" and per-stream recording URLs written
+// as "stream=url,stream2=url". A transcoded rendition is "<width>x<height>",
+// "@<kbps>", or both; a zero or missing side follows the aspect ratio. A
+// ":<encoder>" suffix, e.g. ":auto", picks the encoder.
+func ParseRenditions(profiles, urls string) (map[string]Rendition, error) {
+	renditions := make(map[string]Rendition)
+	for _, entry := range strings.Split(profiles, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rendition %q, expected stream=profile", entry)
+		}
+		stream := strings.ToLower(strings.TrimSpace(kv[0]))
+		enc, err := parseEncoding(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("rendition of stream %s: %w", stream, err)
+		}
+		rendition := renditions[stream]
+		rendition.Encoding = enc
+		renditions[stream] = rendition
+	}
+
+	for _, entry := range strings.Split(urls, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid recording URL %q, expected stream=url", entry)
+		}
+		stream := strings.ToLower(strings.TrimSpace(kv[0]))
+		rawURL := strings.TrimSpace(kv[1])
+		if u, err := url.Parse(rawURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid recording URL of stream %s", stream)
+		}
+		rendition := renditions[stream]
+		rendition.URL = rawURL
+		renditions[stream] = rendition
+	}
+	return renditions, nil
+}
+
+// parseEncoding parses "copy" or "[<width>x<height>][@<kbps>][:<encoder>]".
+func parseEncoding(profile string) (*ffmpeg.Encoding, error) {
+	if strings.EqualFold(profile, "copy") {
+		return nil, nil
+	}
+
+	var enc ffmpeg.Encoding
+	profile, enc.Encoder, _ = strings.Cut(profile, ":")
+	size, rate, hasRate := strings.Cut(profile, "@")
+	if size != "" {
+		width, height, ok := strings.Cut(size, "x")
+		if !ok {
+			return nil, fmt.Errorf("invalid size %q, expected <width>x<height>", size)
+		}
+		var err error
+		if enc.Width, err = parseDimension(width); err != nil {
+			return nil, err
+		}
+		if enc.Height, err = parseDimension(height); err != nil {
+			return nil, err
+		}
+	}
+	if hasRate {
+		kbps, err := strconv.Atoi(rate)
+		if err != nil || kbps <= 0 {
+			return nil, fmt.Errorf("invalid bitrate %q", rate)
+		}
+		enc.BitrateKbps = kbps
+	}
+	if enc == (ffmpeg.Encoding{}) {
+		return nil, fmt.Errorf("invalid profile %q, expected copy, <width>x<height>, @<kbps>, or :<encoder>", profile)
+	}
+	if err := enc.Validate(); err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+func parseDimension(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid dimension %q", s)
+	}
+	return n, nil
+}
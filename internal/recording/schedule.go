@@ -0,0 +1,176 @@
+package recording
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring daily time range during which a stream is recorded.
+// Windows whose end is before their start wrap past midnight.
+type Window struct {
+	Days  []string `json:"days"`  // "mon".."sun"; empty means every day
+	Start string   `json:"start"` // "HH:MM"
+	End   string   `json:"end"`   // "HH:MM"
+}
+
+// Schedule is the set of recording windows for one stream.
+type Schedule struct {
+	Enabled bool     `json:"enabled"`
+	Windows []Window `json:"windows"`
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Validate checks day names and clock times.
+func (s Schedule) Validate() error {
+	for i, w := range s.Windows {
+		for _, day := range w.Days {
+			if dayIndex(day) < 0 {
+				return fmt.Errorf("window %d: unknown day %q", i, day)
+			}
+		}
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("window %d: invalid start: %w", i, err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("window %d: invalid end: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Active reports whether t falls inside any window of an enabled schedule.
+func (s Schedule) Active(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	for _, w := range s.Windows {
+		if w.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) active(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if start <= end {
+		return w.onDay(t.Weekday()) && now >= start && now < end
+	}
+	// Overnight window: the tail belongs to the previous day's window
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.onDay(t.Weekday()) && now >= start) || (w.onDay(yesterday) && now < end)
+}
+
+func (w Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if dayIndex(d) == int(day) {
+			return true
+		}
+	}
+	return false
+}
+
+func dayIndex(name string) int {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, d := range dayNames {
+		if strings.HasPrefix(name, d) {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseSchedules parses the RECORDING_SCHEDULES config format:
+//
+//	stream=days HH:MM-HH:MM|days HH:MM-HH:MM;stream2=...
+//
+// where days is a comma-separated list or a range such as "mon-fri".
+func ParseSchedules(spec string) (map[string]Schedule, error) {
+	schedules := make(map[string]Schedule)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid schedule entry %q", entry)
+		}
+
+		schedule := Schedule{Enabled: true}
+		for _, spec := range strings.Split(kv[1], "|") {
+			window, err := parseWindow(strings.TrimSpace(spec))
+			if err != nil {
+				return nil, fmt.Errorf("stream %s: %w", kv[0], err)
+			}
+			schedule.Windows = append(schedule.Windows, window)
+		}
+		if err := schedule.Validate(); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", kv[0], err)
+		}
+		schedules[strings.TrimSpace(kv[0])] = schedule
+	}
+	return schedules, nil
+}
+
+func parseWindow(spec string) (Window, error) {
+	fields := strings.Fields(spec)
+	var days, times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+	case 2:
+		days, times = fields[0], fields[1]
+	default:
+		return Window{}, fmt.Errorf("invalid window %q", spec)
+	}
+
+	bounds := strings.SplitN(times, "-", 2)
+	if len(bounds) != 2 {
+		return Window{}, fmt.Errorf("invalid time range %q", times)
+	}
+	window := Window{Start: bounds[0], End: bounds[1]}
+
+	for _, part := range strings.Split(days, ",") {
+		if part == "" {
+			continue
+		}
+		if r := strings.SplitN(part, "-", 2); len(r) == 2 {
+			from, to := dayIndex(r[0]), dayIndex(r[1])
+			if from < 0 || to < 0 {
+				return Window{}, fmt.Errorf("invalid day range %q", part)
+			}
+			for i := from; ; i = (i + 1) % 7 {
+				window.Days = append(window.Days, dayNames[i])
+				if i == to {
+					break
+				}
+			}
+			continue
+		}
+		window.Days = append(window.Days, part)
+	}
+	return window, nil
+}
@@ -0,0 +1,35 @@
+package recording
+
+import "context"
+
+// Sink exposes the recording of one stream as a source output so it can be
+// enabled and disabled alongside the stream's other sinks. Recorders read the
+// upstream URL themselves, as they keep the audio the media bus does not carry.
+type Sink struct {
+	manager  *Manager
+	streamID string
+}
+
+// NewSink returns the recording output of a stream.
+func NewSink(manager *Manager, streamID string) *Sink {
+	return &Sink{manager: manager, streamID: streamID}
+}
+
+func (s *Sink) Name() string { return "recorder" }
+
+func (s *Sink) Start(ctx context.Context) error {
+	return s.manager.Start(s.streamID)
+}
+
+func (s *Sink) Stop() error {
+	return s.manager.Stop(s.streamID)
+}
+
+func (s *Sink) IsRunning() bool {
+	return s.manager.IsRecording(s.streamID)
+}
+
+// SetBlackout holds off the recording while the stream is blacked out.
+func (s *Sink) SetBlackout(on bool) {
+	s.manager.SetBlackout(s.streamID, on)
+}
@@ -0,0 +1,367 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxTimelapsePictureNALs bounds how many NAL units of one keyframe are
+// collected, in case a stream has no other pictures to end it
+const maxTimelapsePictureNALs = 64
+
+// Timelapse is an MP4 assembled from frames sampled from a stream.
+type Timelapse struct {
+	Name      string    `json:"name"`
+	StreamID  string    `json:"stream_id"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// ParseTimelapseIntervals parses per-stream sampling intervals written as
+// "stream=seconds,stream2=seconds".
+func ParseTimelapseIntervals(spec string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid time-lapse interval %q, expected stream=seconds", entry)
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid time-lapse interval of stream %s: %q", kv[0], kv[1])
+		}
+		intervals[strings.ToLower(strings.TrimSpace(kv[0]))] = time.Duration(seconds) * time.Second
+	}
+	return intervals, nil
+}
+
+// TimelapseSink samples one keyframe of a stream every interval from its
+// media bus, so the samples are rotated and cropped like the live video, and
+// periodically assembles them into an MP4.
+type TimelapseSink struct {
+	manager  *Manager
+	streamID string
+	interval time.Duration
+	// acquire keeps the source running while sampling
+	acquire func(streamID, consumer string) (func(), error)
+
+	release func()
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// pictures has room for one keyframe, sent when a sample is complete
+	pictures chan []byte
+
+	// Sampling state, guarded by mu
+	sps, pps   []byte
+	picture    [][]byte
+	collecting bool
+	nextSample time.Time
+	mu         sync.Mutex
+}
+
+// NewTimelapseSink returns the time-lapse output of a stream, sampling a
+// frame every interval.
+func NewTimelapseSink(manager *Manager, streamID string, interval time.Duration, acquire func(streamID, consumer string) (func(), error)) *TimelapseSink {
+	return &TimelapseSink{manager: manager, streamID: streamID, interval: interval, acquire: acquire}
+}
+
+func (s *TimelapseSink) Name() string { return "timelapse" }
+
+func (s *TimelapseSink) Start(ctx context.Context) error {
+	release, err := s.acquire(s.streamID, "timelapse")
+	if err != nil {
+		return err
+	}
+	dir := s.manager.timelapseFramesDir(s.streamID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		release()
+		return fmt.Errorf("failed to create time-lapse directory: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.release = release
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.pictures = make(chan []byte, 1)
+	s.collecting = false
+	s.nextSample = time.Time{}
+	done, pictures := s.done, s.pictures
+	s.mu.Unlock()
+
+	go s.run(ctx, pictures, done)
+	logrus.Infof("⏱️ Started time-lapse of %s, one frame every %s", s.streamID, s.interval)
+	return nil
+}
+
+// Stop ends sampling and assembles the frames taken since the last time-lapse.
+func (s *TimelapseSink) Stop() error {
+	s.mu.Lock()
+	cancel, done, release := s.cancel, s.done, s.release
+	s.cancel, s.release = nil, nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+	release()
+	logrus.Infof("⏹️ Stopped time-lapse of %s", s.streamID)
+	return nil
+}
+
+func (s *TimelapseSink) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancel != nil
+}
+
+// WriteAccessUnit collects the first keyframe after a sample is due and
+// hands it to the sampling goroutine once its last slice has arrived.
+func (s *TimelapseSink) WriteAccessUnit(au media.AccessUnit) {
+	nalType, firstSlice := nalHeader(au.Data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return
+	}
+	switch nalType {
+	case 7:
+		s.sps = au.Data
+	case 8:
+		s.pps = au.Data
+	}
+
+	if s.collecting {
+		if nalType == 5 && !firstSlice && len(s.picture) < maxTimelapsePictureNALs {
+			s.picture = append(s.picture, au.Data)
+			return
+		}
+		s.collecting = false
+		select {
+		case s.pictures <- bytes.Join(s.picture, nil):
+		default:
+			// Still busy with the previous sample
+		}
+		s.picture = nil
+	}
+
+	now := time.Now()
+	if nalType != 5 || !firstSlice || now.Before(s.nextSample) || s.sps == nil || s.pps == nil {
+		return
+	}
+	s.collecting = true
+	s.picture = [][]byte{s.sps, s.pps, au.Data}
+	s.nextSample = now.Add(s.interval)
+}
+
+// run saves sampled keyframes as JPEG and assembles them periodically and
+// when sampling stops.
+func (s *TimelapseSink) run(ctx context.Context, pictures <-chan []byte, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.manager.cfg.TimelapseAssembleEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.manager.assembleTimelapse(s.streamID)
+			return
+		case picture := <-pictures:
+			if err := s.manager.saveTimelapseFrame(ctx, s.streamID, picture, time.Now()); err != nil && ctx.Err() == nil {
+				logrus.Warnf("Failed to sample time-lapse frame of %s: %v", s.streamID, err)
+			}
+		case <-ticker.C:
+			s.manager.assembleTimelapse(s.streamID)
+		}
+	}
+}
+
+// nalHeader returns the type of an Annex B NAL unit and, for coded slices,
+// whether it starts a picture: its first_mb_in_slice, the leading Exp-Golomb
+// value of the slice header, is zero and so encoded as a single set bit.
+func nalHeader(data []byte) (byte, bool) {
+	nalType := stats.NALType(data)
+	payload := data
+	switch {
+	case bytes.HasPrefix(data, []byte{0, 0, 0, 1}):
+		payload = data[4:]
+	case bytes.HasPrefix(data, []byte{0, 0, 1}):
+		payload = data[3:]
+	}
+	return nalType, len(payload) >= 2 && payload[1]&0x80 != 0
+}
+
+func (m *Manager) timelapseDir(streamID string) string {
+	return filepath.Join(m.cfg.TimelapseDir, streamID)
+}
+
+func (m *Manager) timelapseFramesDir(streamID string) string {
+	return filepath.Join(m.timelapseDir(streamID), "frames")
+}
+
+// saveTimelapseFrame decodes a keyframe into a JPEG named after the time it
+// was sampled.
+func (m *Manager) saveTimelapseFrame(ctx context.Context, streamID string, picture []byte, at time.Time) error {
+	path := filepath.Join(m.timelapseFramesDir(streamID), at.Format(segmentTimeLayout)+".jpg")
+
+	var output bytes.Buffer
+	cmd := ffmpeg.CommandContext(ctx,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "h264", "-i", "pipe:0",
+		"-frames:v", "1", "-q:v", "3",
+		path,
+	)
+	cmd.Stdin = bytes.NewReader(picture)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := ffmpeg.Run(cmd); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// assembleTimelapse turns the frames sampled since the last time-lapse into
+// an MP4 named after the first and last of them, then deletes them. A single
+// frame is kept for the next time-lapse.
+func (m *Manager) assembleTimelapse(streamID string) {
+	framesDir := m.timelapseFramesDir(streamID)
+	frames, err := filepath.Glob(filepath.Join(framesDir, "*.jpg"))
+	if err != nil || len(frames) < 2 {
+		return
+	}
+	sort.Strings(frames)
+
+	from, errFrom := time.ParseInLocation(segmentTimeLayout, strings.TrimSuffix(filepath.Base(frames[0]), ".jpg"), time.Local)
+	to, errTo := time.ParseInLocation(segmentTimeLayout, strings.TrimSuffix(filepath.Base(frames[len(frames)-1]), ".jpg"), time.Local)
+	if errFrom != nil || errTo != nil {
+		logrus.Warnf("Skipping time-lapse of %s: unexpected frame names in %s", streamID, framesDir)
+		return
+	}
+
+	listFile, err := writeFrameList(frames, m.cfg.TimelapseFPS)
+	if err != nil {
+		logrus.Errorf("Failed to assemble time-lapse of %s: %v", streamID, err)
+		return
+	}
+	defer os.Remove(listFile)
+
+	name := from.Format(segmentTimeLayout) + "-" + to.Format(segmentTimeLayout) + ".mp4"
+	path := filepath.Join(m.timelapseDir(streamID), name)
+	var output bytes.Buffer
+	cmd := ffmpeg.Command(
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "concat", "-safe", "0", "-i", listFile,
+		// Frames keep the stream's size, which H.264 needs to be even
+		"-vf", fmt.Sprintf("fps=%d,scale=trunc(iw/2)*2:trunc(ih/2)*2", m.cfg.TimelapseFPS),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-metadata", "creation_time="+from.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		"-movflags", "+faststart",
+		path,
+	)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := ffmpeg.Run(cmd); err != nil {
+		os.Remove(path)
+		logrus.Errorf("Failed to assemble time-lapse of %s: %v: %s", streamID, err, strings.TrimSpace(output.String()))
+		return
+	}
+
+	for _, frame := range frames {
+		os.Remove(frame)
+	}
+	logrus.Infof("⏱️ Assembled time-lapse %s of %s from %d frames", name, streamID, len(frames))
+}
+
+// writeFrameList writes an ffmpeg concat list showing each frame for one
+// frame's time at fps.
+func writeFrameList(frames []string, fps int) (string, error) {
+	f, err := os.CreateTemp("", "timelapse-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create frame list: %w", err)
+	}
+	defer f.Close()
+
+	duration := 1 / float64(fps)
+	for _, frame := range frames {
+		path, err := filepath.Abs(frame)
+		if err != nil {
+			path = frame
+		}
+		fmt.Fprintf(f, "file '%s'\nduration %.6f\n", strings.ReplaceAll(path, "'", `'\''`), duration)
+	}
+	// The concat demuxer ignores the duration of the last entry unless it
+	// is repeated
+	last, _ := filepath.Abs(frames[len(frames)-1])
+	fmt.Fprintf(f, "file '%s'\n", strings.ReplaceAll(last, "'", `'\''`))
+	return f.Name(), nil
+}
+
+// Timelapses lists the assembled time-lapses of a stream, oldest first.
+func (m *Manager) Timelapses(streamID string) ([]Timelapse, error) {
+	entries, err := os.ReadDir(m.timelapseDir(streamID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Timelapse{}, nil
+		}
+		return nil, err
+	}
+
+	out := []Timelapse{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".mp4") {
+			continue
+		}
+		times := strings.TrimSuffix(name, ".mp4")
+		if len(times) != 2*len(segmentTimeLayout)+1 {
+			continue
+		}
+		from, errFrom := time.ParseInLocation(segmentTimeLayout, times[:len(segmentTimeLayout)], time.Local)
+		to, errTo := time.ParseInLocation(segmentTimeLayout, times[len(segmentTimeLayout)+1:], time.Local)
+		if errFrom != nil || errTo != nil {
+			continue
+		}
+		timelapse := Timelapse{Name: name, StreamID: streamID, From: from, To: to}
+		if info, err := entry.Info(); err == nil {
+			timelapse.SizeBytes = info.Size()
+		}
+		out = append(out, timelapse)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].From.Before(out[j].From) })
+	return out, nil
+}
+
+// TimelapsePath resolves an assembled time-lapse by stream and file name.
+func (m *Manager) TimelapsePath(streamID, name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".mp4") {
+		return "", fmt.Errorf("invalid time-lapse name")
+	}
+	path := filepath.Join(m.timelapseDir(streamID), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("time-lapse %s not found", name)
+	}
+	return path, nil
+}
@@ -0,0 +1,106 @@
+package recording
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// maxVODDuration bounds how many contiguous segments one VOD playlist covers
+	maxVODDuration = 6 * time.Hour
+	// contiguityTolerance is the largest gap between segments still treated as continuous
+	contiguityTolerance = 2 * time.Second
+)
+
+// Recording returns the contiguous run of segments starting at segmentID.
+// A recording ends at the first gap (e.g. recorder restart) or after maxVODDuration.
+func (m *Manager) Recording(segmentID int64) ([]Segment, error) {
+	m.mu.Lock()
+	index := m.index
+	m.mu.Unlock()
+	if index == nil {
+		return nil, fmt.Errorf("recording index not enabled")
+	}
+
+	first, err := index.Get(segmentID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := index.Query(first.StreamID, first.Start, first.Start.Add(maxVODDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	run := []Segment{first}
+	for _, seg := range candidates {
+		last := run[len(run)-1]
+		if !seg.Start.After(last.Start) {
+			continue
+		}
+		if seg.Start.Sub(last.End) > contiguityTolerance {
+			break
+		}
+		run = append(run, seg)
+	}
+	return run, nil
+}
+
+// Segment returns a single indexed segment.
+func (m *Manager) Segment(segmentID int64) (Segment, error) {
+	m.mu.Lock()
+	index := m.index
+	m.mu.Unlock()
+	if index == nil {
+		return Segment{}, fmt.Errorf("recording index not enabled")
+	}
+	return index.Get(segmentID)
+}
+
+// SeekOffset returns the playlist time of the last keyframe at or before
+// offset seconds from the start of the recording, so playback can start on a
+// decodable picture.
+func SeekOffset(segments []Segment, offset float64) float64 {
+	elapsed := 0.0
+	for _, seg := range segments {
+		if offset < elapsed+seg.DurationSeconds {
+			best := 0.0
+			for _, kf := range seg.KeyframeOffsets {
+				if kf <= offset-elapsed {
+					best = kf
+				}
+			}
+			return elapsed + best
+		}
+		elapsed += seg.DurationSeconds
+	}
+	return elapsed
+}
+
+// VODPlaylist renders an HLS VOD media playlist for segments. startOffset,
+// when non-negative, is emitted as EXT-X-START so players open at that point.
+func VODPlaylist(segments []Segment, startOffset float64, segmentURL func(Segment) string) string {
+	target := 1.0
+	for _, seg := range segments {
+		target = math.Max(target, math.Ceil(seg.DurationSeconds))
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(target))
+	if startOffset >= 0 {
+		fmt.Fprintf(&b, "#EXT-X-START:TIME-OFFSET=%.3f,PRECISE=YES\n", startOffset)
+	}
+
+	for i, seg := range segments {
+		// Segments from different recorder runs do not share a timeline
+		if i > 0 && seg.Start.Sub(segments[i-1].End) > time.Second {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", seg.Start.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", seg.DurationSeconds, segmentURL(seg))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
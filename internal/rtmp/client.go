@@ -5,31 +5,43 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
-	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
 
 	"github.com/sirupsen/logrus"
 )
 
 type RTMPClient struct {
-	url           string
-	webrtcManager *webrtcmanager.Manager
-	cmd           *exec.Cmd
-	isRunning     bool
-	mu            sync.RWMutex
-	shouldWrite   func() bool
+	url       string
+	cmd       *exec.Cmd
+	isRunning bool
+	mu        sync.RWMutex
+	stats     *stats.SourceStats
+	frames    chan media.AccessUnit
+	cancel    context.CancelFunc
+	// opus, once set through SetOpus, transcodes the stream's audio for
+	// viewers in the same ffmpeg as its video
+	opus         *audio.OpusOptions
+	audioSamples chan media.AudioSample
+	audioFeed    *audio.Feed
 }
 
-func NewClient(rtmpURL string, webrtcManager *webrtcmanager.Manager, shouldWrite func() bool) *RTMPClient {
+func NewClient(rtmpURL string) *RTMPClient {
 	return &RTMPClient{
-		url:           rtmpURL,
-		webrtcManager: webrtcManager,
-		shouldWrite:   shouldWrite,
-		isRunning:     false,
+		url:          rtmpURL,
+		isRunning:    false,
+		stats:        stats.NewSourceStats(),
+		frames:       make(chan media.AccessUnit, media.FrameBuffer),
+		audioSamples: make(chan media.AudioSample, media.AudioBuffer),
+		audioFeed:    audio.NewFeed(),
 	}
 }
 
@@ -42,23 +54,47 @@ func (c *RTMPClient) Start(ctx context.Context) error {
 	}
 
 	logrus.Infof("Starting RTMP client for: %s", c.url)
+	c.stats.MarkStarted()
+
+	// Stop cancels the context so ffmpeg and test video mode both end
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	// Audio is encoded by the same ffmpeg as the video, so the stream is
+	// pulled once; a stream without audio gets no audio output, which would
+	// fail ffmpeg
+	withAudio := false
+	if c.opus != nil {
+		hasAudio, err := audio.HasAudio(ctx, []string{"-i", c.url})
+		if err != nil {
+			logrus.Warnf("Failed to probe RTMP stream audio, leaving it out: %v", err)
+		}
+		withAudio = hasAudio
+	}
+	args := []string{"-i", c.url}
+	if withAudio {
+		args = append(args, audio.OpusOutputArgs(*c.opus)...)
+	}
+	args = append(args,
+		"-c", "copy", // copy all streams
+		"-f", "h264", // output H.264 format
+		"-an",
+		"pipe:1",
+	)
 
 	// Try to connect to RTMP stream with retries
 	var cmd *exec.Cmd
 	var stdout, stderr io.ReadCloser
+	var audioOut *os.File
 	var err error
 
 	for retries := 0; retries < 3; retries++ {
 		logrus.Infof("Attempting RTMP connection (attempt %d): %s", retries+1, c.url)
+		if retries > 0 {
+			c.stats.MarkRestart()
+		}
 
 		// Use FFmpeg to convert RTMP to H.264 stream
-		cmd = exec.CommandContext(ctx, "ffmpeg",
-			"-i", c.url,
-			"-c", "copy", // copy all streams
-			"-f", "h264", // output H.264 format
-			"-an", // no audio
-			"pipe:1",
-		)
+		cmd = ffmpeg.CommandContext(ctx, args...)
 
 		// Get stdout pipe
 		stdout, err = cmd.StdoutPipe()
@@ -74,9 +110,27 @@ func (c *RTMPClient) Start(ctx context.Context) error {
 			continue
 		}
 
+		var audioIn *os.File
+		if withAudio {
+			if audioOut, audioIn, err = os.Pipe(); err != nil {
+				logrus.Errorf("Failed to create audio pipe (attempt %d): %v", retries+1, err)
+				continue
+			}
+			cmd.ExtraFiles = []*os.File{audioIn}
+		}
+
 		// Start the command
-		if err = cmd.Start(); err != nil {
+		err = ffmpeg.Start(cmd)
+		if audioIn != nil {
+			// ffmpeg holds the write end now; reads end when it exits
+			audioIn.Close()
+		}
+		if err != nil {
 			logrus.Errorf("Failed to start ffmpeg (attempt %d): %v", retries+1, err)
+			if audioOut != nil {
+				audioOut.Close()
+				audioOut = nil
+			}
 			if retries < 2 {
 				time.Sleep(time.Second * 3)
 			}
@@ -89,6 +143,10 @@ func (c *RTMPClient) Start(ctx context.Context) error {
 		// Check if the process is still running
 		if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
 			logrus.Errorf("FFmpeg process exited early (attempt %d)", retries+1)
+			if audioOut != nil {
+				audioOut.Close()
+				audioOut = nil
+			}
 			if retries < 2 {
 				time.Sleep(time.Second * 3)
 			}
@@ -101,22 +159,43 @@ func (c *RTMPClient) Start(ctx context.Context) error {
 
 	if err != nil {
 		logrus.Errorf("Failed to connect to RTMP stream after 3 attempts, starting test video mode")
-		c.mu.Lock()
 		c.isRunning = true
-		c.mu.Unlock()
 		go c.startTestVideoMode(ctx)
 		return nil
 	}
 
 	c.cmd = cmd
 	c.isRunning = true
+	c.stats.SetPipeline("passthrough")
 
 	// Start streaming in goroutine
 	go c.streamLoop(ctx, stdout, stderr)
+	if audioOut != nil {
+		go c.readAudio(audioOut)
+	}
 
 	return nil
 }
 
+// readAudio reads the stream's Opus audio until its ffmpeg exits.
+func (c *RTMPClient) readAudio(r *os.File) {
+	defer r.Close()
+	err := audio.ReadOpus(r, c.audioFeed, func(sample media.AudioSample) {
+		media.SendAudio(c.audioSamples, sample)
+	})
+	if err != nil {
+		logrus.Warnf("RTMP audio unavailable: %v", err)
+	}
+}
+
+// SetOpus delivers the stream's audio encoded with opts from the next
+// start on.
+func (c *RTMPClient) SetOpus(opts audio.OpusOptions) {
+	c.mu.Lock()
+	c.opus = &opts
+	c.mu.Unlock()
+}
+
 func (c *RTMPClient) Stop() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -125,6 +204,10 @@ func (c *RTMPClient) Stop() error {
 		return nil
 	}
 
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
 	if c.cmd != nil {
 		c.cmd.Process.Kill()
 		c.cmd.Wait()
@@ -132,6 +215,7 @@ func (c *RTMPClient) Stop() error {
 	}
 
 	c.isRunning = false
+	c.stats.MarkStopped()
 	logrus.Info("RTMP client stopped")
 	return nil
 }
@@ -142,11 +226,35 @@ func (c *RTMPClient) IsRunning() bool {
 	return c.isRunning
 }
 
+// Health returns a snapshot of the client's throughput counters.
+func (c *RTMPClient) Health() stats.Snapshot {
+	return c.stats.Snapshot()
+}
+
+// Frames returns the access units read from the stream. The channel is never
+// closed; frames are dropped while nobody is reading.
+func (c *RTMPClient) Frames() <-chan media.AccessUnit {
+	return c.frames
+}
+
+// Audio returns the Opus packets of the stream's audio. Like Frames, the
+// channel is never closed.
+func (c *RTMPClient) Audio() <-chan media.AudioSample {
+	return c.audioSamples
+}
+
+// AudioFeed returns the Ogg Opus pages of the stream's audio, for decoding
+// it locally.
+func (c *RTMPClient) AudioFeed() *audio.Feed {
+	return c.audioFeed
+}
+
 func (c *RTMPClient) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 	defer func() {
 		c.mu.Lock()
 		c.isRunning = false
 		c.mu.Unlock()
+		c.stats.MarkStopped()
 	}()
 
 	// Log stderr in a separate goroutine
@@ -174,6 +282,8 @@ func (c *RTMPClient) streamLoop(ctx context.Context, stdout, stderr io.ReadClose
 				continue
 			}
 
+			c.stats.RecordFrame(frameData)
+
 			// Calculate timestamp
 			now := time.Now()
 			timestamp := uint32(now.UnixNano() / 1000000) // Convert to milliseconds
@@ -194,9 +304,7 @@ func (c *RTMPClient) streamLoop(ctx context.Context, stdout, stderr io.ReadClose
 				logrus.Infof("Frame %d first bytes: %s", frameCount, strings.Join(hexBytes, " "))
 			}
 
-			if c.shouldWrite == nil || c.shouldWrite() {
-				c.webrtcManager.WriteVideoSample(frameData, timestamp)
-			}
+			media.Send(c.frames, media.NewAccessUnit(frameData, timestamp))
 
 			frameCount++
 
@@ -295,10 +403,11 @@ func (c *RTMPClient) startTestVideoMode(ctx context.Context) {
 			// Create a simple test pattern frame
 			testFrame := c.generateTestFrame(frameCount)
 
+			c.stats.RecordFrame(testFrame)
 			timestamp := uint32(time.Now().UnixNano() / 1000000) // Current timestamp in ms
 			logrus.Infof("🎬 Sending test frame: size=%d, frame=%d, timestamp=%d", len(testFrame), frameCount, timestamp)
 
-			c.webrtcManager.WriteVideoSample(testFrame, timestamp)
+			media.Send(c.frames, media.NewAccessUnit(testFrame, timestamp))
 			frameCount++
 
 			if frameCount%300 == 0 { // Log every 10 seconds
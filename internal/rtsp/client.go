@@ -5,31 +5,86 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// keyframeRestartInterval is the minimum time between two restarts of
+	// ffmpeg for a keyframe, each of which interrupts every viewer briefly
+	keyframeRestartInterval = 10 * time.Second
+	// keyframeRestartMinInterval is about how long a restart takes to
+	// produce a keyframe; sources sending them more often are not restarted
+	keyframeRestartMinInterval = 3 * time.Second
+)
+
 type Client struct {
-	url           string
-	webrtcManager *webrtcmanager.Manager
-	cmd           *exec.Cmd
-	isRunning     bool
-	mu            sync.RWMutex
-	shouldWrite   func() bool
+	url       string
+	cmd       *exec.Cmd
+	isRunning bool
+	mu        sync.RWMutex
+	stats     *stats.SourceStats
+	frames    chan media.AccessUnit
+	cancel    context.CancelFunc
+	runCtx    context.Context
+	// opus, once set through SetOpus, transcodes the source's audio for
+	// viewers in every ffmpeg session, next to its video
+	opus         *audio.OpusOptions
+	audioSamples chan media.AudioSample
+	audioFeed    *audio.Feed
+	// Whether the source has audio, once probed
+	audioProbed bool
+	hasAudio    bool
+	// Passthrough decision for the current run, made by probing the source
+	passthroughProbed bool
+	passthroughOK     bool
+	passthroughFailed bool
+	// codec of the source once probed, and whether decoding it in hardware
+	// failed during the current run
+	codec                string
+	hardwareDecodeFailed bool
+	// encoding configures transcoding; once set through SetEncoding the
+	// source is always transcoded
+	encoding       ffmpeg.Encoding
+	customEncoding bool
+	// transform rotates and crops the picture, which also needs transcoding
+	transform ffmpeg.Transform
+	// overlay is an image composited onto the video, which also needs
+	// transcoding
+	overlay string
+	// reconfigured tells the supervisor that ffmpeg was stopped to apply new
+	// settings rather than because it failed
+	reconfigured bool
+	// transcoding tells whether the current session re-encodes, and
+	// keyframeAt when it started or was last restarted for a keyframe
+	transcoding bool
+	keyframeAt  time.Time
+	// upstreams, if set, picks a healthy restreamer for every session
+	upstreams *UpstreamPool
+	// pathTemplate, if set, rewrites the URL of every session for stream
+	pathTemplate PathTemplate
+	stream       string
 }
 
-func NewClient(rtspURL string, webrtcManager *webrtcmanager.Manager, shouldWrite func() bool) *Client {
+func NewClient(rtspURL string) *Client {
 	return &Client{
-		url:           rtspURL,
-		webrtcManager: webrtcManager,
-		shouldWrite:   shouldWrite,
+		url:          rtspURL,
+		stats:        stats.NewSourceStats(),
+		frames:       make(chan media.AccessUnit, media.FrameBuffer),
+		audioSamples: make(chan media.AudioSample, media.AudioBuffer),
+		audioFeed:    audio.NewFeed(),
 	}
 }
 
@@ -40,8 +95,12 @@ func (c *Client) Start(ctx context.Context) error {
 		return fmt.Errorf("RTSP client is already running")
 	}
 	c.isRunning = true
+	// Stop cancels the supervisor so it does not restart ffmpeg
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.runCtx = ctx
 	c.mu.Unlock()
 
+	c.stats.MarkStarted()
 	logrus.Infof("Starting RTSP client supervisor for: %s", c.url)
 
 	go c.supervise(ctx)
@@ -55,7 +114,13 @@ func (c *Client) supervise(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			c.setRunning(false)
+			// Leave the state alone if the client was restarted meanwhile
+			c.mu.Lock()
+			if c.runCtx == ctx {
+				c.isRunning = false
+				c.stats.MarkStopped()
+			}
+			c.mu.Unlock()
 			return
 		default:
 		}
@@ -65,10 +130,21 @@ func (c *Client) supervise(ctx context.Context) {
 		if err != nil {
 			logrus.Errorf("RTSP pipeline error: %v", err)
 		}
+		if ctx.Err() != nil {
+			continue
+		}
+		if c.takeReconfigured() {
+			backoff = time.Second * 2
+			continue
+		}
 
 		// Backoff before restarting
+		c.stats.MarkRestart()
 		logrus.Infof("RTSP restarting in %s...", backoff)
-		time.Sleep(backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
 		if backoff < maxBackoff {
 			backoff *= 2
 			if backoff > maxBackoff {
@@ -78,36 +154,112 @@ func (c *Client) supervise(ctx context.Context) {
 	}
 }
 
+// SetUpstreams lets the client read from any healthy member of pool when
+// its URL points at one of them.
+func (c *Client) SetUpstreams(pool *UpstreamPool) {
+	c.mu.Lock()
+	c.upstreams = pool
+	c.mu.Unlock()
+}
+
+// SetPathTemplate makes the client pull the URL template builds for stream
+// instead of its configured URL.
+func (c *Client) SetPathTemplate(stream string, template PathTemplate) {
+	c.mu.Lock()
+	c.stream = stream
+	c.pathTemplate = template
+	c.mu.Unlock()
+}
+
+// sessionURL returns the URL to read from in the next ffmpeg session.
+func (c *Client) sessionURL() string {
+	c.mu.RLock()
+	pool, template, stream := c.upstreams, c.pathTemplate, c.stream
+	c.mu.RUnlock()
+
+	sourceURL := c.url
+	if pool != nil {
+		sourceURL = pool.Resolve(c.url)
+	}
+	if template == "" {
+		return sourceURL
+	}
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		logrus.Warnf("Cannot apply path template to invalid RTSP URL: %v", err)
+		return sourceURL
+	}
+	return template.Expand(stream, u)
+}
+
 func (c *Client) runOnce(ctx context.Context) error {
-	logrus.Infof("Starting RTSP ffmpeg for: %s", c.url)
+	sourceURL := c.sessionURL()
+	logrus.Infof("Starting RTSP ffmpeg for: %s", sourceURL)
 
 	transport := os.Getenv("RTSP_TRANSPORT")
 	if transport == "" {
 		transport = "tcp"
 	}
 
-	// Force transcode to H.264 to handle non-H264 cameras reliably
-	// Handle both HEVC and H.264 input streams
-	cmd := exec.CommandContext(ctx, "ffmpeg",
+	args := []string{
 		"-rtsp_transport", transport,
 		"-fflags", "+genpts", // Generate presentation timestamps
 		"-avoid_negative_ts", "make_zero", // Handle negative timestamps
-		"-i", c.url,
-		"-an",             // No audio
-		"-c:v", "libx264", // Use H.264 encoder
-		"-preset", "veryfast", // Fast encoding
-		"-tune", "zerolatency", // Optimize for low latency
-		"-profile:v", "baseline", // Use baseline profile for compatibility
-		"-level", "3.1", // Level 3.1 for compatibility
-		"-pix_fmt", "yuv420p", // Pixel format
-		"-g", "30", // GOP size for better compatibility
-		"-keyint_min", "30", // Minimum keyframe interval
-		"-sc_threshold", "0", // Disable scene change detection
-		"-bf", "0", // No B-frames for lower latency
-		"-flags", "+low_delay", // Low delay flags
+	}
+
+	passthrough := c.usePassthrough(ctx, sourceURL, transport)
+	overlay := c.Overlay()
+	c.mu.RLock()
+	softwareDecode := c.hardwareDecodeFailed
+	c.mu.RUnlock()
+	var output []string
+	hardwareDecode := false
+	switch {
+	case passthrough:
+		// Source is already WebRTC-friendly H.264; repeat SPS/PPS at every
+		// keyframe so late joiners and the GOP cache can start decoding
+		output = []string{
+			"-c:v", "copy",
+			"-bsf:v", "dump_extra=freq=keyframe",
+		}
+		c.stats.SetPipeline("passthrough")
+	case overlay != "":
+		output = c.Encoding().OverlayArgs(c.Transform().Filters()...)
+		c.stats.SetPipeline("transcode")
+	case softwareDecode:
+		output = c.Encoding().Args(c.Transform().Filters()...)
+		c.stats.SetPipeline("transcode")
+	default:
+		// Transcode to H.264 to handle non-H264 cameras reliably, decoding
+		// in hardware where the board's pipeline can
+		var input []string
+		input, output = c.Encoding().Pipeline(c.sourceCodec(ctx, sourceURL, transport), c.Transform().Filters()...)
+		if len(input) > 0 {
+			logrus.Infof("Decoding RTSP source in hardware: %s", strings.Join(input, " "))
+			args = append(args, input...)
+			hardwareDecode = true
+		}
+		c.stats.SetPipeline("transcode")
+	}
+	args = append(args, "-i", sourceURL)
+	if !passthrough && overlay != "" {
+		args = append(args, ffmpeg.OverlayInputArgs(overlay)...)
+	}
+	// Audio is encoded by the same session as the video, so the source is
+	// pulled once and both share its clock; a source without audio gets
+	// no audio output, which would fail ffmpeg
+	opts, withAudio := c.Opus()
+	withAudio = withAudio && c.sourceHasAudio(ctx, sourceURL, transport)
+	if withAudio {
+		args = append(args, audio.OpusOutputArgs(opts)...)
+	}
+	args = append(args, "-an")
+	args = append(args, output...)
+	args = append(args,
 		"-f", "h264", // Output format
 		"pipe:1",
 	)
+	cmd := ffmpeg.CommandContext(ctx, args...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -117,17 +269,52 @@ func (c *Client) runOnce(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("stderr pipe: %w", err)
 	}
+	var audioOut, audioIn *os.File
+	if withAudio {
+		if audioOut, audioIn, err = os.Pipe(); err != nil {
+			return fmt.Errorf("audio pipe: %w", err)
+		}
+		cmd.ExtraFiles = []*os.File{audioIn}
+	}
 
-	if err := cmd.Start(); err != nil {
+	err = ffmpeg.Start(cmd)
+	if audioIn != nil {
+		// ffmpeg holds the write end now; reads end when it exits
+		audioIn.Close()
+	}
+	if err != nil {
+		if audioOut != nil {
+			audioOut.Close()
+		}
 		return fmt.Errorf("start ffmpeg: %w", err)
 	}
 
-	c.setCmd(cmd)
+	c.setCmd(cmd, !passthrough)
 	logrus.Infof("FFmpeg process started with PID: %d", cmd.Process.Pid)
+	if audioOut != nil {
+		go c.readAudio(audioOut)
+	}
 
 	// Stream loop blocks until EOF or error
+	framesBefore := c.stats.Snapshot().Frames
 	c.streamLoop(ctx, stdout, stderr)
 
+	// A passthrough session that never produced a frame means ffmpeg could
+	// not copy the stream as probed; transcode from now on
+	if passthrough && ctx.Err() == nil && c.stats.Snapshot().Frames == framesBefore {
+		logrus.Warnf("RTSP passthrough produced no video, falling back to transcoding")
+		c.mu.Lock()
+		c.passthroughFailed = true
+		c.mu.Unlock()
+	}
+	// Likewise a hardware decoder the ffmpeg build or driver lacks
+	if hardwareDecode && ctx.Err() == nil && c.stats.Snapshot().Frames == framesBefore {
+		logrus.Warnf("RTSP hardware decoding produced no video, decoding in software")
+		c.mu.Lock()
+		c.hardwareDecodeFailed = true
+		c.mu.Unlock()
+	}
+
 	// Ensure process exited
 	if err := cmd.Wait(); err != nil {
 		logrus.Warnf("FFmpeg process exited with error: %v", err)
@@ -139,9 +326,260 @@ func (c *Client) runOnce(ctx context.Context) error {
 	return nil
 }
 
-func (c *Client) setCmd(cmd *exec.Cmd) {
+// usePassthrough decides whether the source can be copied instead of
+// re-encoded. RTSP_PASSTHROUGH selects "auto" (probe the source, the
+// default), "always", or "never".
+func (c *Client) usePassthrough(ctx context.Context, sourceURL, transport string) bool {
+	switch strings.ToLower(os.Getenv("RTSP_PASSTHROUGH")) {
+	case "never", "false":
+		return false
+	case "always", "true":
+		return true
+	}
+
+	c.mu.RLock()
+	failed, probed, ok := c.passthroughFailed, c.passthroughProbed, c.passthroughOK
+	custom := c.customEncoding || !c.transform.IsZero() || c.overlay != ""
+	c.mu.RUnlock()
+	if failed || custom {
+		return false
+	}
+	if probed {
+		return ok
+	}
+
+	maxGOP := 4 * time.Second
+	if v, err := strconv.ParseFloat(os.Getenv("RTSP_PASSTHROUGH_MAX_GOP_SECONDS"), 64); err == nil && v > 0 {
+		maxGOP = time.Duration(v * float64(time.Second))
+	}
+
+	info, err := probeSource(ctx, sourceURL, transport)
+	if err != nil {
+		// Retry the probe on the next session
+		logrus.Warnf("Failed to probe RTSP source, transcoding: %v", err)
+		return false
+	}
+
+	ok, reason := info.passthroughReason(maxGOP)
+	c.mu.Lock()
+	c.passthroughProbed = true
+	c.passthroughOK = ok
+	c.codec = info.Codec
+	c.audioProbed, c.hasAudio = true, info.HasAudio
+	c.mu.Unlock()
+	if ok {
+		logrus.Infof("RTSP source is %s %s with %s GOP, using passthrough", info.Codec, info.Profile, info.MaxGOP.Round(time.Millisecond))
+	} else {
+		logrus.Infof("RTSP source needs transcoding: %s", reason)
+	}
+	return ok
+}
+
+// sourceCodec returns the codec of the source for choosing its hardware
+// decoder, probing the source unless the passthrough check did.
+func (c *Client) sourceCodec(ctx context.Context, sourceURL, transport string) string {
+	c.mu.RLock()
+	codec := c.codec
+	c.mu.RUnlock()
+	if codec != "" {
+		return codec
+	}
+
+	info, err := probeSource(ctx, sourceURL, transport)
+	if err != nil {
+		logrus.Warnf("Failed to probe RTSP source codec: %v", err)
+		return ""
+	}
+	c.mu.Lock()
+	c.codec = info.Codec
+	c.audioProbed, c.hasAudio = true, info.HasAudio
+	c.mu.Unlock()
+	return info.Codec
+}
+
+// sourceHasAudio reports whether the source has audio to encode, probing
+// it unless an earlier probe did. Audio is left out of sessions while the
+// probe fails.
+func (c *Client) sourceHasAudio(ctx context.Context, sourceURL, transport string) bool {
+	c.mu.RLock()
+	probed, hasAudio := c.audioProbed, c.hasAudio
+	c.mu.RUnlock()
+	if probed {
+		return hasAudio
+	}
+
+	info, err := probeSource(ctx, sourceURL, transport)
+	if err != nil {
+		logrus.Warnf("Failed to probe RTSP source audio, leaving it out: %v", err)
+		return false
+	}
+	c.mu.Lock()
+	c.codec = info.Codec
+	c.audioProbed, c.hasAudio = true, info.HasAudio
+	c.mu.Unlock()
+	if !info.HasAudio {
+		logrus.Infof("RTSP source has no audio")
+	}
+	return info.HasAudio
+}
+
+// readAudio reads the Opus audio of one session until its ffmpeg exits.
+func (c *Client) readAudio(r *os.File) {
+	defer r.Close()
+	err := audio.ReadOpus(r, c.audioFeed, func(sample media.AudioSample) {
+		media.SendAudio(c.audioSamples, sample)
+	})
+	if err != nil {
+		logrus.Warnf("RTSP audio unavailable until the next session: %v", err)
+	}
+}
+
+// Opus returns the options the source's audio is encoded with, and whether
+// it is delivered at all.
+func (c *Client) Opus() (audio.OpusOptions, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.opus == nil {
+		return audio.OpusOptions{}, false
+	}
+	return *c.opus, true
+}
+
+// SetOpus delivers the source's audio encoded with opts from the next
+// ffmpeg session on.
+func (c *Client) SetOpus(opts audio.OpusOptions) {
+	c.mu.Lock()
+	c.opus = &opts
+	c.mu.Unlock()
+}
+
+// Encoding returns the settings used when the source is transcoded.
+func (c *Client) Encoding() ffmpeg.Encoding {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.encoding
+}
+
+// SetEncoding changes the transcoding settings, which also stops passing the
+// source through. A running ffmpeg is restarted right away with the new
+// settings; its output starts with a keyframe.
+func (c *Client) SetEncoding(enc ffmpeg.Encoding) error {
+	if err := enc.Validate(); err != nil {
+		return err
+	}
+	if mode := strings.ToLower(os.Getenv("RTSP_PASSTHROUGH")); mode == "always" || mode == "true" {
+		return fmt.Errorf("RTSP_PASSTHROUGH=%s does not allow re-encoding", mode)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoding = enc
+	c.customEncoding = true
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.reconfigured = true
+		c.cmd.Process.Kill()
+		logrus.Infof("Restarting RTSP ffmpeg with new encoding: %+v", enc)
+	}
+	return nil
+}
+
+// Transform returns the rotation and crop applied to the source.
+func (c *Client) Transform() ffmpeg.Transform {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.transform
+}
+
+// SetTransform changes the rotation and crop; any but the identity stops
+// passing the source through. A running ffmpeg is restarted right away, as
+// with SetEncoding.
+func (c *Client) SetTransform(t ffmpeg.Transform) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if mode := strings.ToLower(os.Getenv("RTSP_PASSTHROUGH")); !t.IsZero() && (mode == "always" || mode == "true") {
+		return fmt.Errorf("RTSP_PASSTHROUGH=%s does not allow rotating or cropping", mode)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transform = t
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.reconfigured = true
+		c.cmd.Process.Kill()
+		logrus.Infof("Restarting RTSP ffmpeg with new transform: %+v", t.Filters())
+	}
+	return nil
+}
+
+// Overlay returns the path of the image composited onto the video, if any.
+func (c *Client) Overlay() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.overlay
+}
+
+// SetOverlay composites the image at path onto the video, or stops doing so
+// if path is empty. An overlay stops passing the source through; a running
+// ffmpeg is restarted right away, as with SetEncoding.
+func (c *Client) SetOverlay(path string) error {
+	if mode := strings.ToLower(os.Getenv("RTSP_PASSTHROUGH")); path != "" && (mode == "always" || mode == "true") {
+		return fmt.Errorf("RTSP_PASSTHROUGH=%s does not allow overlays", mode)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overlay == path {
+		return nil
+	}
+	c.overlay = path
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.reconfigured = true
+		c.cmd.Process.Kill()
+		logrus.Infof("Restarting RTSP ffmpeg with overlay %q", path)
+	}
+	return nil
+}
+
+// RequestKeyframe restarts a transcoding ffmpeg, as its new session starts
+// with a keyframe; ffmpeg cannot be asked for one while it runs. Restarts
+// happen at most every keyframeRestartInterval, and only when the source's
+// keyframes are further apart than keyframeRestartMinInterval, as the next
+// one would otherwise arrive before the restarted session's first. A
+// passthrough session is left alone: restarted, it would also wait for the
+// camera's next keyframe.
+func (c *Client) RequestKeyframe() {
+	interval := time.Duration(c.stats.Snapshot().KeyframeIntervalSeconds * float64(time.Second))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cmd == nil || c.cmd.Process == nil || !c.transcoding {
+		return
+	}
+	if interval <= keyframeRestartMinInterval || time.Since(c.keyframeAt) < keyframeRestartInterval {
+		return
+	}
+	c.keyframeAt = time.Now()
+	c.reconfigured = true
+	c.cmd.Process.Kill()
+	logrus.Infof("Restarting RTSP ffmpeg for a keyframe (keyframes every %s)", interval.Round(time.Millisecond))
+}
+
+// takeReconfigured reports whether the last ffmpeg session was ended by
+// SetEncoding, SetTransform, SetOverlay, or RequestKeyframe, and clears it.
+func (c *Client) takeReconfigured() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reconfigured := c.reconfigured
+	c.reconfigured = false
+	return reconfigured
+}
+
+func (c *Client) setCmd(cmd *exec.Cmd, transcoding bool) {
 	c.mu.Lock()
 	c.cmd = cmd
+	c.transcoding = transcoding
+	c.keyframeAt = time.Now()
 	c.mu.Unlock()
 }
 
@@ -165,6 +603,10 @@ func (c *Client) Stop() error {
 		return nil
 	}
 
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
 	if c.cmd != nil {
 		c.cmd.Process.Kill()
 		c.cmd.Wait()
@@ -172,6 +614,15 @@ func (c *Client) Stop() error {
 	}
 
 	c.isRunning = false
+	c.passthroughProbed = false
+	c.passthroughFailed = false
+	c.codec = ""
+	c.audioProbed = false
+	c.hardwareDecodeFailed = false
+	if c.upstreams != nil {
+		c.upstreams.Release(c.url)
+	}
+	c.stats.MarkStopped()
 	logrus.Info("RTSP client stopped")
 	return nil
 }
@@ -182,6 +633,29 @@ func (c *Client) IsRunning() bool {
 	return c.isRunning
 }
 
+// Health returns a snapshot of the client's throughput counters.
+func (c *Client) Health() stats.Snapshot {
+	return c.stats.Snapshot()
+}
+
+// Frames returns the access units read from the camera. The channel is never
+// closed; frames are dropped while nobody is reading.
+func (c *Client) Frames() <-chan media.AccessUnit {
+	return c.frames
+}
+
+// Audio returns the Opus packets of the source's audio. Like Frames, the
+// channel is never closed.
+func (c *Client) Audio() <-chan media.AudioSample {
+	return c.audioSamples
+}
+
+// AudioFeed returns the Ogg Opus pages of the source's audio, for decoding
+// it locally.
+func (c *Client) AudioFeed() *audio.Feed {
+	return c.audioFeed
+}
+
 func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 	// mark running for this session
 	c.setRunning(true)
@@ -202,7 +676,7 @@ func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 	}()
 
 	scanner := bufio.NewScanner(stdout)
-	scanner.Split(splitH264Frames)
+	scanner.Split(media.SplitH264Frames)
 
 	frameCount := 0
 	for scanner.Scan() {
@@ -216,6 +690,7 @@ func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 				continue
 			}
 
+			c.stats.RecordFrame(frameData)
 			timestamp := uint32(time.Now().UnixNano() / 1000000)
 			if frameCount < 10 && len(frameData) > 0 {
 				maxBytes := 16
@@ -240,9 +715,7 @@ func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 				}
 			}
 
-			if c.shouldWrite == nil || c.shouldWrite() {
-				c.webrtcManager.WriteVideoSample(frameData, timestamp)
-			}
+			media.Send(c.frames, media.NewAccessUnit(frameData, timestamp))
 			frameCount++
 			if frameCount%30 == 0 {
 				logrus.Infof("✅ RTSP stream: sent %d frames", frameCount)
@@ -256,47 +729,3 @@ func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
 
 	c.setRunning(false)
 }
-
-// splitH264Frames splits an H.264 bytestream into NAL units delimited by start codes
-func splitH264Frames(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-
-	startCode1 := []byte{0x00, 0x00, 0x00, 0x01}
-	startCode2 := []byte{0x00, 0x00, 0x01}
-
-	startPos := -1
-	for i := 0; i < len(data)-3; i++ {
-		if (i+4 <= len(data) && data[i] == startCode1[0] && data[i+1] == startCode1[1] && data[i+2] == startCode1[2] && data[i+3] == startCode1[3]) ||
-			(i+3 <= len(data) && data[i] == startCode2[0] && data[i+1] == startCode2[1] && data[i+2] == startCode2[2]) {
-			startPos = i
-			break
-		}
-	}
-
-	if startPos == -1 {
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	}
-
-	nextStartPos := -1
-	for i := startPos + 4; i < len(data)-3; i++ {
-		if (i+4 <= len(data) && data[i] == startCode1[0] && data[i+1] == startCode1[1] && data[i+2] == startCode1[2] && data[i+3] == startCode1[3]) ||
-			(i+3 <= len(data) && data[i] == startCode2[0] && data[i+1] == startCode2[1] && data[i+2] == startCode2[2]) {
-			nextStartPos = i
-			break
-		}
-	}
-
-	if nextStartPos == -1 {
-		if atEOF {
-			return len(data), data[startPos:], nil
-		}
-		return startPos, nil, nil
-	}
-
-	return nextStartPos, data[startPos:nextStartPos], nil
-}
@@ -0,0 +1,115 @@
+package rtsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeWindow is how much of the stream ffprobe reads to measure the GOP
+const probeWindow = 6 * time.Second
+
+// sourceInfo describes the video of an RTSP source as reported by ffprobe.
+type sourceInfo struct {
+	Codec      string
+	Profile    string
+	HasBFrames bool
+	// MaxGOP is the longest keyframe interval seen; zero if fewer than two
+	// keyframes arrived within the probe window
+	MaxGOP time.Duration
+	// HasAudio is set if the source also has an audio stream
+	HasAudio bool
+}
+
+// probeSource inspects the first video stream of url, and whether it has
+// audio.
+func probeSource(ctx context.Context, url, transport string) (sourceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeWindow+10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-rtsp_transport", transport,
+		"-read_intervals", fmt.Sprintf("%%+%d", int(probeWindow.Seconds())),
+		"-show_entries", "stream=index,codec_type,codec_name,profile,has_b_frames:packet=stream_index,pts_time,flags",
+		"-of", "json",
+		url,
+	).Output()
+	if err != nil {
+		return sourceInfo{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var result struct {
+		Streams []struct {
+			Index      int    `json:"index"`
+			CodecType  string `json:"codec_type"`
+			CodecName  string `json:"codec_name"`
+			Profile    string `json:"profile"`
+			HasBFrames int    `json:"has_b_frames"`
+		} `json:"streams"`
+		Packets []struct {
+			StreamIndex int    `json:"stream_index"`
+			PTSTime     string `json:"pts_time"`
+			Flags       string `json:"flags"`
+		} `json:"packets"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return sourceInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	video := -1
+	var info sourceInfo
+	for i, stream := range result.Streams {
+		switch {
+		case stream.CodecType == "audio":
+			info.HasAudio = true
+		case stream.CodecType == "video" && video < 0:
+			video = i
+		}
+	}
+	if video < 0 {
+		return sourceInfo{}, fmt.Errorf("no video stream found")
+	}
+	info.Codec = result.Streams[video].CodecName
+	info.Profile = result.Streams[video].Profile
+	info.HasBFrames = result.Streams[video].HasBFrames > 0
+
+	last := -1.0
+	for _, pkt := range result.Packets {
+		if pkt.StreamIndex != result.Streams[video].Index || !strings.Contains(pkt.Flags, "K") {
+			continue
+		}
+		pts, err := strconv.ParseFloat(pkt.PTSTime, 64)
+		if err != nil {
+			continue
+		}
+		if last >= 0 {
+			if gop := time.Duration((pts - last) * float64(time.Second)); gop > info.MaxGOP {
+				info.MaxGOP = gop
+			}
+		}
+		last = pts
+	}
+	return info, nil
+}
+
+// passthroughReason reports whether the source can be forwarded without
+// re-encoding, and why not if it cannot.
+func (i sourceInfo) passthroughReason(maxGOP time.Duration) (bool, string) {
+	switch {
+	case i.Codec != "h264":
+		return false, fmt.Sprintf("codec is %s", i.Codec)
+	case i.Profile != "Baseline" && i.Profile != "Constrained Baseline" && i.Profile != "Main":
+		return false, fmt.Sprintf("profile is %s", i.Profile)
+	case i.HasBFrames:
+		return false, "stream uses B-frames"
+	case i.MaxGOP == 0:
+		return false, fmt.Sprintf("fewer than two keyframes within %s", probeWindow)
+	case i.MaxGOP > maxGOP:
+		return false, fmt.Sprintf("keyframe interval %s exceeds %s", i.MaxGOP.Round(time.Millisecond), maxGOP)
+	}
+	return true, ""
+}
@@ -0,0 +1,69 @@
+package rtsp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PathTemplate builds the URL a source pulls from, for restreamers whose
+// path layout or credentials differ from the URL the source was configured
+// with, e.g. "rtsp://{host}:{port}/cameras/{path}?user={user}&pass={password}".
+//
+// {host} and {port} come from the selected upstream, or from the configured
+// URL without RTSP_UPSTREAMS; {path} is the configured path without its
+// leading slash; {user} and {password} are its credentials, query-escaped;
+// {stream} is the stream ID.
+type PathTemplate string
+
+// Validate checks that the template expands to an RTSP URL.
+func (t PathTemplate) Validate() error {
+	sample := t.Expand("stream", &url.URL{Scheme: "rtsp", Host: "host:554", Path: "/path", User: url.UserPassword("user", "password")})
+	u, err := url.Parse(sample)
+	if err != nil {
+		return fmt.Errorf("invalid path template %q: %w", string(t), err)
+	}
+	if (u.Scheme != "rtsp" && u.Scheme != "rtsps") || u.Host == "" {
+		return fmt.Errorf("path template %q must expand to an rtsp:// URL with a host", string(t))
+	}
+	return nil
+}
+
+// Expand fills the template in for a stream reading from source.
+func (t PathTemplate) Expand(stream string, source *url.URL) string {
+	port := source.Port()
+	if port == "" {
+		port = "554"
+	}
+	password, _ := source.User.Password()
+	return strings.NewReplacer(
+		"{host}", source.Hostname(),
+		"{port}", port,
+		"{path}", strings.TrimPrefix(source.EscapedPath(), "/"),
+		"{user}", url.QueryEscape(source.User.Username()),
+		"{password}", url.QueryEscape(password),
+		"{stream}", url.PathEscape(stream),
+	).Replace(string(t))
+}
+
+// ParsePathTemplates parses per-stream templates written as
+// "stream=template,stream2=template".
+func ParsePathTemplates(spec string) (map[string]PathTemplate, error) {
+	templates := make(map[string]PathTemplate)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid path template %q, expected stream=template", entry)
+		}
+		template := PathTemplate(strings.TrimSpace(kv[1]))
+		if err := template.Validate(); err != nil {
+			return nil, err
+		}
+		templates[strings.ToLower(strings.TrimSpace(kv[0]))] = template
+	}
+	return templates, nil
+}
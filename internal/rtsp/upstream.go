@@ -0,0 +1,240 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upstreamCheckTimeout bounds one health check of an upstream
+const upstreamCheckTimeout = 3 * time.Second
+
+// UpstreamStatus is the health of one restreamer.
+type UpstreamStatus struct {
+	Host      string    `json:"host"`
+	Healthy   bool      `json:"healthy"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	// Streams is how many sources currently read from this upstream
+	Streams int `json:"streams"`
+}
+
+// UpstreamPool is a set of interchangeable RTSP restreamers, such as several
+// MediaMTX instances serving the same paths. Sources whose URL points at any
+// of them are moved to a healthy one whenever they (re)connect.
+type UpstreamPool struct {
+	hosts  []string
+	status map[string]*UpstreamStatus
+	// assigned maps a source URL to the upstream it reads from
+	assigned map[string]string
+	mu       sync.Mutex
+}
+
+// ParseUpstreams reads a comma-separated list of "host:port" or
+// "rtsp://host:port" entries; the port defaults to 554.
+func ParseUpstreams(list string) ([]string, error) {
+	var hosts []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "://") {
+			entry = "rtsp://" + entry
+		}
+		u, err := url.Parse(entry)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid upstream %q", entry)
+		}
+		if u.Scheme != "rtsp" {
+			return nil, fmt.Errorf("upstream %q must use rtsp", entry)
+		}
+		hosts = append(hosts, hostPort(u))
+	}
+	return hosts, nil
+}
+
+// hostPort returns the host of an RTSP URL with its port made explicit.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "554"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// NewUpstreamPool creates a pool of hosts, all considered healthy until
+// they are first checked.
+func NewUpstreamPool(hosts []string) *UpstreamPool {
+	p := &UpstreamPool{
+		hosts:    hosts,
+		status:   make(map[string]*UpstreamStatus),
+		assigned: make(map[string]string),
+	}
+	for _, host := range hosts {
+		p.status[host] = &UpstreamStatus{Host: host, Healthy: true}
+	}
+	return p
+}
+
+// Run checks every upstream each interval until ctx is cancelled.
+func (p *UpstreamPool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *UpstreamPool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, host := range p.hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			started := time.Now()
+			err := checkUpstream(ctx, host)
+			p.record(host, started, err)
+		}(host)
+	}
+	wg.Wait()
+}
+
+func (p *UpstreamPool) record(host string, started time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.status[host]
+	healthy := err == nil
+	if healthy != st.Healthy {
+		if healthy {
+			logrus.Infof("RTSP upstream %s is healthy again", host)
+		} else {
+			logrus.Warnf("RTSP upstream %s is unhealthy: %v", host, err)
+		}
+	}
+	st.Healthy = healthy
+	st.CheckedAt = started
+	st.LatencyMS = time.Since(started).Milliseconds()
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
+
+// checkUpstream sends an RTSP OPTIONS request; any RTSP response, even an
+// authentication challenge, shows the server is up.
+func checkUpstream(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, upstreamCheckTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if _, err := fmt.Fprintf(conn, "OPTIONS rtsp://%s/ RTSP/1.0\r\nCSeq: 1\r\n\r\n", host); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no RTSP response: %w", err)
+	}
+	if !strings.HasPrefix(line, "RTSP/1.0 ") {
+		return fmt.Errorf("unexpected response %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// Resolve returns the URL a source should connect to. URLs of other hosts
+// are returned unchanged; URLs of a pooled upstream keep their upstream
+// while it is healthy and otherwise move to the healthy upstream serving
+// the fewest sources. Without any healthy upstream the URL is kept.
+func (p *UpstreamPool) Resolve(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "rtsp" || !p.contains(hostPort(u)) {
+		return rawURL
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current, ok := p.assigned[rawURL]
+	if !ok || !p.status[current].Healthy {
+		best, bestCount := "", 0
+		for _, host := range p.hosts {
+			if !p.status[host].Healthy {
+				continue
+			}
+			if count := p.streamCount(host); best == "" || count < bestCount {
+				best, bestCount = host, count
+			}
+		}
+		if best == "" {
+			best = hostPort(u)
+		}
+		if ok && best != current {
+			logrus.Infof("Moving RTSP source %s from upstream %s to %s", u.Path, current, best)
+		}
+		current = best
+		p.assigned[rawURL] = current
+	}
+
+	u.Host = current
+	return u.String()
+}
+
+// Release forgets the upstream of a source that stopped reading.
+func (p *UpstreamPool) Release(rawURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.assigned, rawURL)
+}
+
+func (p *UpstreamPool) contains(host string) bool {
+	for _, h := range p.hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// streamCount returns how many sources read from host. Callers must hold p.mu.
+func (p *UpstreamPool) streamCount(host string) int {
+	count := 0
+	for _, h := range p.assigned {
+		if h == host {
+			count++
+		}
+	}
+	return count
+}
+
+// Status returns the health of every upstream in configured order.
+func (p *UpstreamPool) Status() []UpstreamStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := make([]UpstreamStatus, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		st := *p.status[host]
+		st.Streams = p.streamCount(host)
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
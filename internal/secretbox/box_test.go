@@ -0,0 +1,118 @@
+package secretbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testBox(t *testing.T) *Box {
+	t.Helper()
+	b, err := New(bytes.Repeat([]byte{7}, KeySize))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return b
+}
+
+func TestSealOpen(t *testing.T) {
+	b := testBox(t)
+	for _, plaintext := range []string{"", "hunter2", "pässwörd with spaces"} {
+		sealed, err := b.Seal(plaintext)
+		if err != nil {
+			t.Fatalf("Seal(%q) error = %v", plaintext, err)
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Errorf("Seal(%q) = %q contains the plaintext", plaintext, sealed)
+		}
+		got, err := b.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open(Seal(%q)) error = %v", plaintext, err)
+		}
+		if got != plaintext {
+			t.Errorf("Open(Seal(%q)) = %q", plaintext, got)
+		}
+	}
+
+	// Every seal has a nonce of its own
+	first, _ := b.Seal("hunter2")
+	second, _ := b.Seal("hunter2")
+	if first == second {
+		t.Error("sealing the same secret twice gave the same value")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	b := testBox(t)
+	sealed, err := b.Seal("hunter2")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(sealed)
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-1] ^= 1
+
+	other, err := New(bytes.Repeat([]byte{8}, KeySize))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		box    *Box
+		sealed string
+	}{
+		{"flipped bit", b, base64.StdEncoding.EncodeToString(flipped)},
+		{"truncated", b, base64.StdEncoding.EncodeToString(data[:len(data)-1])},
+		{"shorter than nonce", b, base64.StdEncoding.EncodeToString(data[:4])},
+		{"not base64", b, "not base64!"},
+		{"wrong key", other, sealed},
+	}
+	for _, tt := range tests {
+		if got, err := tt.box.Open(tt.sealed); err == nil {
+			t.Errorf("%s: Open() = %q, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestNewRejectsShortKey(t *testing.T) {
+	if _, err := New(make([]byte, 16)); err == nil {
+		t.Error("New() accepted a 16-byte key")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "secret.key")
+	key, err := LoadKey("", path)
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	if len(key) != KeySize {
+		t.Fatalf("LoadKey() generated %d bytes, want %d", len(key), KeySize)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file has mode %o, want 600", perm)
+	}
+
+	again, err := LoadKey("", path)
+	if err != nil {
+		t.Fatalf("LoadKey() of the existing file error = %v", err)
+	}
+	if !bytes.Equal(again, key) {
+		t.Error("LoadKey() did not read back the generated key")
+	}
+
+	value := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	if got, err := LoadKey(value, path); err != nil || !bytes.Equal(got, bytes.Repeat([]byte{1}, KeySize)) {
+		t.Errorf("LoadKey(value) = %x, %v; want the value's key", got, err)
+	}
+	if _, err := LoadKey(base64.StdEncoding.EncodeToString([]byte("short")), path); err == nil {
+		t.Error("LoadKey() accepted a short key")
+	}
+}
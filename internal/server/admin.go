@@ -0,0 +1,26 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// authorizeAdmin writes the error response and returns false unless the
+// request carries ADMIN_TOKEN. Without one configured, the endpoints it
+// guards are disabled.
+func (s *Server) authorizeAdmin(c *gin.Context, feature string) bool {
+	if s.config == nil || s.config.Auth.AdminToken == "" {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": feature})
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(requestToken(c)), []byte(s.config.Auth.AdminToken)) != 1 {
+		logrus.Warnf("Refused %s request from %s", feature, c.ClientIP())
+		c.Header("WWW-Authenticate", "Bearer")
+		respondError(c, http.StatusUnauthorized, MsgAccessDenied, nil)
+		return false
+	}
+	return true
+}
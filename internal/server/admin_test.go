@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"golang-webrtc-streaming/internal/config"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// adminServer returns a server whose only configuration is its admin token.
+func adminServer(adminToken string) *Server {
+	return &Server{config: &config.Config{Auth: config.AuthConfig{AdminToken: adminToken}}}
+}
+
+// adminRequest runs handler for a request carrying the given Authorization
+// header and returns the response.
+func adminRequest(handler gin.HandlerFunc, method, target, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		c.Request.Header.Set("Authorization", authorization)
+	}
+	handler(c)
+	return w
+}
+
+func TestAuthorizeAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		target        string
+		authorization string
+		wantOK        bool
+		wantStatus    int
+	}{
+		{"no admin token configured", "", "/", "Bearer anything", false, http.StatusServiceUnavailable},
+		{"missing token", "s3cret-admin", "/", "", false, http.StatusUnauthorized},
+		{"wrong token", "s3cret-admin", "/", "Bearer s3cret-admi", false, http.StatusUnauthorized},
+		{"not a bearer token", "s3cret-admin", "/", "Basic s3cret-admin", false, http.StatusUnauthorized},
+		{"bearer token", "s3cret-admin", "/", "Bearer s3cret-admin", true, http.StatusOK},
+		{"query token", "s3cret-admin", "/?token=s3cret-admin", "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := adminServer(tt.adminToken)
+			var ok bool
+			w := adminRequest(func(c *gin.Context) {
+				if ok = s.authorizeAdmin(c, "test"); ok {
+					c.Status(http.StatusOK)
+				}
+			}, http.MethodGet, tt.target, tt.authorization)
+			if ok != tt.wantOK || w.Code != tt.wantStatus {
+				t.Errorf("authorizeAdmin() = %v with status %d, want %v with %d", ok, w.Code, tt.wantOK, tt.wantStatus)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("refusal does not ask for a bearer token")
+			}
+		})
+	}
+}
+
+func TestAdminEndpointsRequireToken(t *testing.T) {
+	s := adminServer("s3cret-admin")
+	endpoints := []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+	}{
+		{"debug bundle", s.handleDebugBundle, http.MethodGet},
+		{"peer log", s.handlePeerLog, http.MethodGet},
+		{"maintenance", s.handlePutMaintenance, http.MethodPut},
+		{"set flag", s.handlePutFlag, http.MethodPut},
+		{"reset flag", s.handleResetFlag, http.MethodDelete},
+		{"impairment", s.handlePutImpairment, http.MethodPut},
+	}
+	for _, e := range endpoints {
+		if w := adminRequest(e.handler, e.method, "/", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without a token answered %d, want 401", e.name, w.Code)
+		}
+		if w := adminRequest(e.handler, e.method, "/", "Bearer wrong"); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s with a wrong token answered %d, want 401", e.name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-webrtc-streaming/internal/analytics"
+	"golang-webrtc-streaming/internal/flags"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// analyticsWriteTimeout bounds sending a single frame to a sidecar
+const analyticsWriteTimeout = 10 * time.Second
+
+// AnalyticsFrameMessage carries a decoded frame to a sidecar; JPEG is base64
+// in JSON.
+type AnalyticsFrameMessage struct {
+	Type      string    `json:"type"`
+	Stream    string    `json:"stream"`
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	JPEG      []byte    `json:"jpeg"`
+}
+
+// AnalyticsReportMessage is what a sidecar sends back for a frame; it
+// echoes the frame's sequence number and, optionally, its timestamp.
+type AnalyticsReportMessage struct {
+	Type       string                `json:"type"`
+	Seq        uint64                `json:"seq"`
+	Timestamp  time.Time             `json:"timestamp"`
+	Detections []analytics.Detection `json:"detections"`
+}
+
+// DetectionsMessage is delivered to peers of the active stream over the data channel.
+type DetectionsMessage struct {
+	Type string `json:"type"`
+	analytics.Detections
+}
+
+// forwardDetections sends a stream's detections to its viewers while it is
+// the active stream.
+func (s *Server) forwardDetections(d analytics.Detections) {
+	if s.sourceManager.GetCurrentSource() == d.Stream {
+		s.webrtcManager.Broadcast(DetectionsMessage{Type: "detections", Detections: d})
+	}
+}
+
+// handleAnalyticsFeed connects an analytics sidecar to a stream: it receives
+// {"type":"frame"} messages at ?fps, scaled to ?width, and answers with
+// {"type":"detections"} messages for the frames it analysed.
+func (s *Server) handleAnalyticsFeed(c *gin.Context) {
+	if s.analytics == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "analytics"})
+		return
+	}
+	if !s.flagEnabled(c, flags.Analytics) {
+		return
+	}
+	streamID := c.Query("stream")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+	if _, ok := s.authorizeSession(c, streamID, "analytics"); !ok {
+		return
+	}
+
+	opts := s.analytics.Defaults()
+	if v := c.Query("fps"); v != "" {
+		fps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "fps"})
+			return
+		}
+		opts.FPS = fps
+	}
+	if v := c.Query("width"); v != "" {
+		width, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "width"})
+			return
+		}
+		opts.Width = width
+	}
+	if err := opts.Validate(); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	server := websocket.Server{
+		// The API allows any origin, and the sidecar is authorized above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			s.serveSidecar(ws, c.ClientIP(), streamID, opts)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveSidecar exchanges frames and detections with a sidecar at the remote
+// address until either side goes away.
+func (s *Server) serveSidecar(ws *websocket.Conn, remote, streamID string, opts analytics.Options) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames, err := s.analytics.Subscribe(ctx, streamID, opts)
+	if err != nil {
+		logrus.Warnf("Failed to start analytics of %s for %s: %v", streamID, remote, err)
+		websocket.JSON.Send(ws, gin.H{"type": "error", "error": err.Error()})
+		return
+	}
+	logrus.Infof("🔍 Analytics sidecar %s subscribed to %s at %g fps", remote, streamID, opts.FPS)
+	defer logrus.Infof("Analytics sidecar %s left %s", remote, streamID)
+
+	go func() {
+		defer cancel()
+		for {
+			var msg AnalyticsReportMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if msg.Type != "detections" {
+				continue
+			}
+			err := s.analytics.Report(analytics.Detections{
+				Stream:     streamID,
+				Seq:        msg.Seq,
+				Timestamp:  msg.Timestamp,
+				Detections: msg.Detections,
+			})
+			if err != nil {
+				logrus.Debugf("Rejected detections from %s: %v", remote, err)
+				websocket.JSON.Send(ws, gin.H{"type": "error", "seq": msg.Seq, "error": err.Error()})
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(analyticsWriteTimeout))
+			if err := websocket.JSON.Send(ws, AnalyticsFrameMessage{
+				Type:      "frame",
+				Stream:    streamID,
+				Seq:       frame.Seq,
+				Timestamp: frame.Timestamp,
+				JPEG:      frame.JPEG,
+			}); err != nil {
+				logrus.Debugf("Failed to send frame %d to %s: %v", frame.Seq, remote, err)
+				return
+			}
+		}
+	}
+}
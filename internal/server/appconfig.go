@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAPIBase is where the web client finds the API unless configured.
+const DefaultAPIBase = "/api"
+
+// AppConfig is what the web client learns about the server at runtime.
+type AppConfig struct {
+	// APIBase is prefixed to API paths, e.g. when the API sits behind
+	// another path or host than the page
+	APIBase string `json:"api_base"`
+	// Features are the optional parts of the server that are available
+	Features map[string]bool `json:"features"`
+}
+
+// ParseFeatures parses feature flags written as "name=true,name2=false"; a
+// bare name turns the feature on.
+func ParseFeatures(spec string) (map[string]bool, error) {
+	features := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		enabled := true
+		if found {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of feature %s: %q", name, value)
+			}
+			enabled = parsed
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid feature %q, expected name=true|false", entry)
+		}
+		features[name] = enabled
+	}
+	return features, nil
+}
+
+// SetAppConfig sets the API base handed to the web client and overrides
+// its feature flags. It must be called before Start.
+func (s *Server) SetAppConfig(apiBase string, features map[string]bool) {
+	s.apiBase = strings.TrimSuffix(apiBase, "/")
+	s.featureOverrides = features
+}
+
+// handleAppConfig tells the web client where the API is and which features
+// to show. Features follow the services the server runs and the feature
+// flags unless overridden.
+func (s *Server) handleAppConfig(c *gin.Context) {
+	features := map[string]bool{
+		"recording":     s.recordingManager != nil,
+		"cameras":       s.cameras != nil,
+		"events":        s.events != nil,
+		"analytics":     s.analytics != nil,
+		"usage":         s.usage != nil,
+		"audio_streams": s.audio != nil,
+		"auth":          s.offerAuth != nil,
+	}
+	if s.flags != nil {
+		for _, flag := range s.flags.List() {
+			// A flag cannot turn on a service the server does not run
+			if running, ok := features[string(flag.Name)]; ok {
+				features[string(flag.Name)] = running && flag.Enabled
+			} else {
+				features[string(flag.Name)] = flag.Enabled
+			}
+		}
+	}
+	for name, enabled := range s.featureOverrides {
+		features[name] = enabled
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, AppConfig{APIBase: s.apiBase, Features: features})
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultStaticMaxAge is how long browsers reuse static assets before
+// revalidating them.
+const DefaultStaticMaxAge = time.Hour
+
+// minCompressBytes is the size below which assets are not gzipped, as the
+// savings would not make up for the overhead
+const minCompressBytes = 512
+
+// assetEncodings are the content codings assets are served in, most
+// preferred first.
+var assetEncodings = []string{"br", "gzip"}
+
+// staticAsset is a file of the web client held in memory together with its
+// compressed forms.
+type staticAsset struct {
+	name        string
+	contentType string
+	// hash identifies the file's contents in the ETags of all its forms
+	hash string
+	// bodies and etags by content coding; "" is the file itself
+	bodies map[string][]byte
+	etags  map[string]string
+}
+
+// loadWebAssets reads the static assets of the web client and renders its
+// page, by URL path. Files named like an asset plus .br or .gz are served
+// as its compressed forms; assets without a .gz are gzipped here.
+func loadWebAssets(files fs.FS, page gin.H) (map[string]*staticAsset, error) {
+	assets := make(map[string]*staticAsset)
+	err := fs.WalkDir(files, "static", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if ext := path.Ext(name); ext == ".br" || ext == ".gz" {
+			return nil
+		}
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		asset := newStaticAsset(name, mime.TypeByExtension(path.Ext(name)), body)
+		if br, err := fs.ReadFile(files, name+".br"); err == nil {
+			asset.addEncoding("br", br)
+		}
+		if gz, err := fs.ReadFile(files, name+".gz"); err == nil {
+			asset.addEncoding("gzip", gz)
+		} else {
+			asset.gzip()
+		}
+		assets["/"+name] = asset
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load static assets: %w", err)
+	}
+
+	// The page only depends on fixed data, so it is rendered once
+	templates, err := template.ParseFS(files, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	var index bytes.Buffer
+	if err := templates.ExecuteTemplate(&index, "index.html", page); err != nil {
+		return nil, fmt.Errorf("failed to render index page: %w", err)
+	}
+	asset := newStaticAsset("index.html", "text/html; charset=utf-8", index.Bytes())
+	asset.gzip()
+	assets["/"] = asset
+	return assets, nil
+}
+
+func newStaticAsset(name, contentType string, body []byte) *staticAsset {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	sum := sha256.Sum256(body)
+	asset := &staticAsset{
+		name:        name,
+		contentType: contentType,
+		hash:        hex.EncodeToString(sum[:8]),
+		bodies:      make(map[string][]byte),
+		etags:       make(map[string]string),
+	}
+	asset.addEncoding("", body)
+	return asset
+}
+
+// addEncoding adds the asset compressed in a content coding. Each form has
+// an ETag of its own, as they are different bytes.
+func (a *staticAsset) addEncoding(encoding string, body []byte) {
+	etag := a.hash
+	if encoding != "" {
+		etag += "-" + encoding
+	}
+	a.bodies[encoding] = body
+	a.etags[encoding] = strconv.Quote(etag)
+}
+
+// gzip adds the gzip form of compressible assets that it makes smaller.
+func (a *staticAsset) gzip() {
+	body := a.bodies[""]
+	if len(body) < minCompressBytes || !compressible(a.contentType) {
+		return
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return
+	}
+	if _, err := zw.Write(body); err != nil {
+		return
+	}
+	if err := zw.Close(); err != nil || buf.Len() >= len(body) {
+		return
+	}
+	a.addEncoding("gzip", buf.Bytes())
+}
+
+// compressible reports whether a content type is text, which compresses
+// well, rather than already compressed media.
+func compressible(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasSuffix(contentType, "javascript") ||
+		strings.HasSuffix(contentType, "json") ||
+		strings.HasSuffix(contentType, "xml") ||
+		contentType == "image/svg+xml"
+}
+
+// serve writes the asset in the best content coding the client accepts. A
+// matching If-None-Match is answered with 304 Not Modified.
+func (a *staticAsset) serve(c *gin.Context, cacheControl string) {
+	encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), a.bodies)
+	header := c.Writer.Header()
+	header.Set("Content-Type", a.contentType)
+	header.Set("Cache-Control", cacheControl)
+	header.Set("ETag", a.etags[encoding])
+	if len(a.bodies) > 1 {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	http.ServeContent(c.Writer, c.Request, a.name, time.Time{}, bytes.NewReader(a.bodies[encoding]))
+}
+
+// negotiateEncoding picks the content coding of an Accept-Encoding header
+// among those available, or "" for none.
+func negotiateEncoding(accept string, available map[string][]byte) string {
+	qualities := make(map[string]float64)
+	for _, entry := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[strings.ToLower(coding)] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range assetEncodings {
+		if _, ok := available[encoding]; !ok {
+			continue
+		}
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// handleStaticAsset serves the web client's static assets. Browsers reuse
+// them for the static max age, then revalidate them by ETag.
+func (s *Server) handleStaticAsset(c *gin.Context) {
+	asset, ok := s.assets["/static"+c.Param("filepath")]
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	asset.serve(c, fmt.Sprintf("public, max-age=%d", int(s.staticMaxAge/time.Second)))
+}
+
+// handleIndex serves the web client's page. It is revalidated on every
+// load, so a new release reaches browsers right away.
+func (s *Server) handleIndex(c *gin.Context) {
+	asset, ok := s.assets["/"]
+	if !ok {
+		c.String(http.StatusInternalServerError, "Web client is not available")
+		return
+	}
+	asset.serve(c, "no-cache")
+}
+
+// SetStaticMaxAge sets how long browsers reuse static assets before
+// revalidating them. It must be called before Start.
+func (s *Server) SetStaticMaxAge(maxAge time.Duration) {
+	s.staticMaxAge = maxAge
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-webrtc-streaming/internal/audio"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioStartTimeout is how long a listener waits for the first audio before
+// the stream is reported as having none
+const audioStartTimeout = 10 * time.Second
+
+func (s *Server) handleAudioMP3(c *gin.Context) {
+	s.handleAudioStream(c, audio.FormatMP3)
+}
+
+func (s *Server) handleAudioAAC(c *gin.Context) {
+	s.handleAudioStream(c, audio.FormatAAC)
+}
+
+// handleAudioStream serves the audio of a stream as an endless MP3 or AAC
+// HTTP stream, Icecast style, for audio monitoring where video cannot be
+// played.
+func (s *Server) handleAudioStream(c *gin.Context, format audio.Format) {
+	if s.audio == nil {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "audio_streams"})
+		return
+	}
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+	// Only camera and RTMP sources carry audio; the others deliver bare video
+	feed, err := s.sourceManager.AudioFeed(streamID)
+	if err != nil {
+		respondError(c, http.StatusConflict, MsgNoAudio, nil)
+		return
+	}
+	if _, ok := s.authorizeSession(c, streamID, "audio"); !ok {
+		return
+	}
+	if s.sourceManager.IsBlackedOut(streamID) {
+		respondError(c, http.StatusServiceUnavailable, MsgStreamBlackedOut, nil)
+		return
+	}
+
+	chunks, stop := s.audio.Listen(streamID, feed, format)
+	defer stop()
+
+	// Answer with an error rather than an empty stream if no audio comes
+	var first []byte
+	select {
+	case chunk, ok := <-chunks:
+		if !ok {
+			respondError(c, http.StatusServiceUnavailable, MsgNoAudio, nil)
+			return
+		}
+		first = chunk
+	case <-time.After(audioStartTimeout):
+		respondError(c, http.StatusServiceUnavailable, MsgNoAudio, nil)
+		return
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Cache-Control", "no-store")
+	c.Header("icy-name", streamID)
+	c.Header("icy-br", strconv.Itoa(s.audio.BitrateKbps()))
+	c.Status(http.StatusOK)
+	w := c.Writer
+	for chunk := first; ; {
+		// Listeners hear nothing while the stream is blacked out
+		if !s.sourceManager.IsBlackedOut(streamID) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.Flush()
+		}
+
+		var ok bool
+		select {
+		case chunk, ok = <-chunks:
+			if !ok {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"golang-webrtc-streaming/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// authorizeSession runs the offer auth hook for a new viewer session. It
+// writes the error response and returns false when the session is refused.
+func (s *Server) authorizeSession(c *gin.Context, stream, endpoint string) (auth.Decision, bool) {
+	if s.offerAuth == nil {
+		return auth.Allow(), true
+	}
+
+	decision, err := s.offerAuth.Authorize(c.Request.Context(), auth.Request{
+		Stream:   stream,
+		ClientIP: c.ClientIP(),
+		Token:    requestToken(c),
+		Endpoint: endpoint,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to authorize %s request from %s: %v", endpoint, c.ClientIP(), err)
+		respondError(c, http.StatusServiceUnavailable, MsgAuthUnavailable, nil)
+		return decision, false
+	}
+	if !decision.Allow {
+		logrus.Warnf("Refused %s request for %s from %s: %s", endpoint, stream, c.ClientIP(), decision.Reason)
+		// The reason comes from the authorization webhook, for the client
+		body := errorBody(MsgAccessDenied, nil)
+		if decision.Reason != "" {
+			body["detail"] = decision.Reason
+		}
+		c.JSON(http.StatusForbidden, body)
+		return decision, false
+	}
+	return decision, true
+}
+
+// requestToken returns the bearer token of a request, or its token query parameter.
+func requestToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return c.Query("token")
+}
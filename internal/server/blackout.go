@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+
+	"golang-webrtc-streaming/internal/source"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBlackoutBodyBytes bounds a blackout request, whose slate image is
+// base64 encoded
+const maxBlackoutBodyBytes = 8 << 20
+
+// BlackoutRequest sets the slate shown while a stream is blacked out.
+type BlackoutRequest struct {
+	Message string `json:"message"`
+	// Image is a base64 encoded PNG or JPEG; without one the slate is black
+	Image  []byte `json:"image"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func (s *Server) handleGetBlackout(c *gin.Context) {
+	status, err := s.sourceManager.Blackout(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handleStartBlackout replaces a stream's media with a slate for all of its
+// outputs, e.g. while a camera shows something it must not; viewers stay
+// connected and the source keeps running.
+func (s *Server) handleStartBlackout(c *gin.Context) {
+	if _, err := s.sourceManager.Blackout(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+
+	// The body is optional
+	var req BlackoutRequest
+	if c.Request.ContentLength != 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBlackoutBodyBytes)
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+			return
+		}
+	}
+	settings := source.Blackout{Message: req.Message, Image: req.Image, Width: req.Width, Height: req.Height}
+	if err := settings.Validate(); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	status, err := s.sourceManager.StartBlackout(c.Param("id"), settings)
+	if err != nil {
+		respondErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handleEndBlackout brings back a stream's live media.
+func (s *Server) handleEndBlackout(c *gin.Context) {
+	if _, err := s.sourceManager.Blackout(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	status, err := s.sourceManager.EndBlackout(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
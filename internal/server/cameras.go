@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang-webrtc-streaming/internal/camera"
+	"golang-webrtc-streaming/internal/source"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxImportBytes bounds the size of a camera import file
+const maxImportBytes = 4 << 20
+
+func (s *Server) handleListCameras(c *gin.Context) {
+	cameras := s.cameras.List()
+	for i := range cameras {
+		cameras[i] = cameras[i].Redacted()
+	}
+	c.JSON(http.StatusOK, gin.H{"cameras": cameras})
+}
+
+func (s *Server) handleGetCamera(c *gin.Context) {
+	cam, ok := s.cameras.Get(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgCameraNotFound, nil)
+		return
+	}
+	c.JSON(http.StatusOK, cam.Redacted())
+}
+
+func (s *Server) handleCreateCamera(c *gin.Context) {
+	var req camera.Camera
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if err := validateCameraStream(req.Stream); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	cam, err := s.cameras.Create(req)
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.feedStream(cam); err != nil {
+		if _, derr := s.cameras.Delete(cam.ID); derr != nil {
+			logrus.Errorf("Failed to roll back camera %s: %v", cam.ID, derr)
+		}
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusCreated, cam.Redacted())
+}
+
+func (s *Server) handleUpdateCamera(c *gin.Context) {
+	var req camera.Camera
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if err := validateCameraStream(req.Stream); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	previous, ok := s.cameras.Get(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgCameraNotFound, nil)
+		return
+	}
+	cam, err := s.cameras.Update(previous.ID, req)
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if previous.Stream != "" && previous.Stream != cam.Stream {
+		s.stopFeeding(previous)
+	}
+	if err := s.feedStream(cam); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, cam.Redacted())
+}
+
+func (s *Server) handleDeleteCamera(c *gin.Context) {
+	cam, err := s.cameras.Delete(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	if cam.Stream != "" {
+		s.stopFeeding(cam)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// feedStream points the camera's stream, if any, at the camera.
+func (s *Server) feedStream(cam camera.Camera) error {
+	if cam.Stream == "" {
+		return nil
+	}
+	url, err := cam.URL()
+	if err != nil {
+		return err
+	}
+	if err := s.sourceManager.SetSourceURL(cam.Stream, url); err != nil {
+		return fmt.Errorf("failed to feed %s from camera: %w", cam.Stream, err)
+	}
+	return nil
+}
+
+// stopFeeding removes the source a camera was feeding.
+func (s *Server) stopFeeding(cam camera.Camera) {
+	if err := s.sourceManager.RemoveSource(cam.Stream); err != nil {
+		logrus.Warnf("Failed to remove %s source of camera %s: %v", cam.Stream, cam.Name, err)
+	}
+}
+
+func validateCameraStream(stream string) error {
+	if stream == "" {
+		return nil
+	}
+	for _, t := range source.Types() {
+		if t == stream {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown stream: %s", stream)
+}
+
+// handleImportCameras registers a batch of cameras from CSV or a MediaMTX
+// configuration in one operation. The format comes from ?format= or the
+// Content-Type header.
+func (s *Server) handleImportCameras(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		switch contentType := c.ContentType(); {
+		case strings.Contains(contentType, "csv"):
+			format = "csv"
+		case strings.Contains(contentType, "yaml"), strings.Contains(contentType, "yml"):
+			format = "mediamtx"
+		}
+	}
+
+	var (
+		cameras []camera.Camera
+		err     error
+	)
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	switch format {
+	case "csv":
+		cameras, err = camera.ParseCSV(body)
+	case "mediamtx":
+		cameras, err = camera.ParseMediaMTX(body)
+	default:
+		respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "format"})
+		return
+	}
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if len(cameras) == 0 {
+		respondError(c, http.StatusBadRequest, MsgNoCameras, nil)
+		return
+	}
+	for i, cam := range cameras {
+		if err := validateCameraStream(cam.Stream); err != nil {
+			body := errorBody(MsgInvalidCamera, map[string]string{"index": strconv.Itoa(i + 1), "name": cam.Name})
+			body["detail"] = err.Error()
+			c.JSON(http.StatusBadRequest, body)
+			return
+		}
+	}
+
+	previous := make(map[string]camera.Camera)
+	for _, cam := range s.cameras.List() {
+		previous[cam.ID] = cam
+	}
+	result, err := s.cameras.Import(cameras)
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, cam := range result.Updated {
+		if old := previous[cam.ID]; old.Stream != "" && old.Stream != cam.Stream {
+			s.stopFeeding(old)
+		}
+	}
+	feedErrors := []string{}
+	for _, cam := range append(result.Created, result.Updated...) {
+		if err := s.feedStream(cam); err != nil {
+			feedErrors = append(feedErrors, err.Error())
+		}
+	}
+	for i := range result.Created {
+		result.Created[i] = result.Created[i].Redacted()
+	}
+	for i := range result.Updated {
+		result.Updated[i] = result.Updated[i].Redacted()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"created":     result.Created,
+		"updated":     result.Updated,
+		"feed_errors": feedErrors,
+	})
+}
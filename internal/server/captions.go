@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/captions"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CaptionRequest struct {
+	Text       string `json:"text"`
+	Language   string `json:"language"`
+	DurationMS int    `json:"duration_ms"`
+}
+
+// CaptionMessage is delivered to peers of the active stream over the data channel.
+type CaptionMessage struct {
+	Type       string    `json:"type"`
+	Stream     string    `json:"stream"`
+	Text       string    `json:"text"`
+	Language   string    `json:"language,omitempty"`
+	Start      time.Time `json:"start"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+const defaultCaptionDuration = 3 * time.Second
+
+func (s *Server) handlePostCaption(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	var req CaptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	cue := captions.Cue{
+		Text:     strings.TrimSpace(req.Text),
+		Language: req.Language,
+		Start:    time.Now(),
+		Duration: time.Duration(req.DurationMS) * time.Millisecond,
+	}
+	if cue.Duration <= 0 {
+		cue.Duration = defaultCaptionDuration
+	}
+	s.captions.Add(streamID, cue)
+
+	if s.sourceManager.GetCurrentSource() == streamID {
+		s.webrtcManager.Broadcast(CaptionMessage{
+			Type:       "caption",
+			Stream:     streamID,
+			Text:       cue.Text,
+			Language:   cue.Language,
+			Start:      cue.Start,
+			DurationMS: cue.Duration.Milliseconds(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handleGetCaptionsVTT(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	window := 5 * time.Minute
+	if v := c.Query("seconds"); v != "" {
+		if d, err := time.ParseDuration(v + "s"); err == nil && d > 0 {
+			window = d
+		}
+	}
+	origin := time.Now().Add(-window)
+
+	c.Header("Content-Type", "text/vtt; charset=utf-8")
+	c.String(http.StatusOK, captions.WebVTT(s.captions.Since(streamID, origin), origin))
+}
+
+// streamExists reports whether id names a configured stream.
+func (s *Server) streamExists(id string) bool {
+	for _, available := range s.sourceManager.GetAvailableSources() {
+		if available == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// signalingTimeout bounds answering an offer, most of which is waiting
+	// for ICE gathering, including the authorization of the session
+	signalingTimeout = 15 * time.Second
+	// snapshotTimeout covers waiting for a keyframe and decoding it
+	snapshotTimeout = 15 * time.Second
+)
+
+// withDeadline bounds the handlers of a route: the request's context ends
+// after timeout, or as soon as the client goes away. Anything a request
+// starts that must outlive it, like sources and sinks, runs on a context of
+// its own rather than this one.
+func withDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// respondDeadline answers a request whose deadline passed before err and
+// reports whether it did.
+func respondDeadline(c *gin.Context, err error) bool {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	respondError(c, http.StatusGatewayTimeout, MsgTimedOut, nil)
+	return true
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/config"
+	"golang-webrtc-streaming/internal/redact"
+)
+
+// versionInfo identifies the build and the process a debug bundle comes
+// from.
+type versionInfo struct {
+	GoVersion     string    `json:"go_version"`
+	Module        string    `json:"module,omitempty"`
+	ModuleVersion string    `json:"module_version,omitempty"`
+	Revision      string    `json:"revision,omitempty"`
+	RevisionTime  string    `json:"revision_time,omitempty"`
+	Modified      bool      `json:"modified,omitempty"`
+	OS            string    `json:"os"`
+	Arch          string    `json:"arch"`
+	Hostname      string    `json:"hostname,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	Goroutines    int       `json:"goroutines"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// handleDebugBundle downloads a zip of what support needs to look into a
+// misbehaving install: recent logs, the configuration, every peer with its
+// log and SDP, the streams with their health, and version information.
+// Credentials are masked throughout. It requires the admin token.
+func (s *Server) handleDebugBundle(c *gin.Context) {
+	if !s.authorizeAdmin(c, "debug_bundle") {
+		return
+	}
+	now := time.Now()
+	hostname, _ := os.Hostname()
+	name := "debug-bundle-" + now.UTC().Format("20060102-150405")
+	if hostname != "" {
+		name = "debug-bundle-" + hostname + "-" + now.UTC().Format("20060102-150405")
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	if err := s.writeDebugBundle(zw, name, hostname, now); err != nil {
+		// The response is under way, so the archive is left truncated
+		logrus.Errorf("Failed to write debug bundle: %v", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		logrus.Errorf("Failed to write debug bundle: %v", err)
+		return
+	}
+	logrus.Infof("Debug bundle downloaded by %s", c.ClientIP())
+}
+
+func (s *Server) writeDebugBundle(zw *zip.Writer, dir, hostname string, now time.Time) error {
+	add := func(path, content string) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: dir + "/" + path, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(redact.String(content)))
+		return err
+	}
+	addJSON := func(path string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", path, err)
+		}
+		return add(path, string(data)+"\n")
+	}
+
+	if err := addJSON("version.json", s.versionInfo(hostname, now)); err != nil {
+		return err
+	}
+	if s.config != nil {
+		if err := addJSON("config.json", bundleConfig(*s.config)); err != nil {
+			return err
+		}
+	}
+	if s.logs != nil {
+		if err := add("logs.txt", strings.Join(s.logs.Lines(), "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	if err := addJSON("streams.json", gin.H{
+		"active":  s.sourceManager.GetCurrentSource(),
+		"streams": s.sourceManager.Streams(),
+		"health":  s.healthMonitor.Reports(),
+	}); err != nil {
+		return err
+	}
+
+	peers := s.peerList()
+	if err := addJSON("peers.json", gin.H{"peers": peers, "count": len(peers)}); err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		id, _ := peer["id"].(string)
+		if lines, ok := s.webrtcManager.PeerLog(id); ok {
+			if err := addJSON("peers/"+id+"/log.json", lines); err != nil {
+				return err
+			}
+		}
+		local, remote, ok := s.webrtcManager.PeerDescriptions(id)
+		if !ok {
+			continue
+		}
+		if err := add("peers/"+id+"/local.sdp", redactSDP(local)); err != nil {
+			return err
+		}
+		if err := add("peers/"+id+"/remote.sdp", redactSDP(remote)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iceCredentials matches the ICE username fragment and password of an SDP,
+// which let anyone holding them take over the session's connection
+var iceCredentials = regexp.MustCompile(`(?m)^(a=ice-(?:ufrag|pwd):)[^\r\n]*`)
+
+// redactSDP masks the ICE credentials of an SDP.
+func redactSDP(sdp string) string {
+	return iceCredentials.ReplaceAllString(sdp, "${1}"+redact.Mask)
+}
+
+// bundleConfig returns the configuration as put in debug bundles. Secrets
+// are never encoded; webhook URLs are cut down to their origin, as their
+// paths often carry credentials.
+func bundleConfig(cfg config.Config) config.Config {
+	cfg.Health.WebhookURL = urlOrigin(cfg.Health.WebhookURL)
+	cfg.Events.WebhookURL = urlOrigin(cfg.Events.WebhookURL)
+	cfg.Auth.WebhookURL = urlOrigin(cfg.Auth.WebhookURL)
+	return cfg
+}
+
+// urlOrigin returns the scheme and host of a URL, masking the rest.
+func urlOrigin(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		if raw == "" {
+			return ""
+		}
+		return redact.Mask
+	}
+	if u.Path == "" && u.RawQuery == "" && u.User == nil {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/" + redact.Mask
+}
+
+func (s *Server) versionInfo(hostname string, now time.Time) versionInfo {
+	info := versionInfo{
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Hostname:      hostname,
+		StartedAt:     s.startedAt,
+		UptimeSeconds: now.Sub(s.startedAt).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		GeneratedAt:   now,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	info.ModuleVersion = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleGetEncoding(c *gin.Context) {
+	if _, err := s.sourceManager.GetSourceURL(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	enc, err := s.sourceManager.Encoding(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, enc)
+}
+
+// handlePutEncoding changes the bitrate, resolution, GOP, or encoder of a
+// stream's transcode; connected viewers stay connected.
+func (s *Server) handlePutEncoding(c *gin.Context) {
+	if _, err := s.sourceManager.GetSourceURL(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+
+	var enc ffmpeg.Encoding
+	if err := c.ShouldBindJSON(&enc); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if err := enc.Validate(); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := ffmpeg.CheckEncoder(enc.Encoder); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.sourceManager.SetEncoding(c.Param("id"), enc); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, enc)
+}
+
+// handleCapabilities reports the hardware encoders and decoders found at
+// startup, and which encoder "auto" selects.
+func (s *Server) handleCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, ffmpeg.CurrentCapabilities())
+}
+
+func (s *Server) handleGetTransform(c *gin.Context) {
+	if _, err := s.sourceManager.GetSourceURL(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	t, err := s.sourceManager.Transform(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// handlePutTransform rotates and crops a stream, e.g. a camera mounted
+// sideways; connected viewers stay connected.
+func (s *Server) handlePutTransform(c *gin.Context) {
+	if _, err := s.sourceManager.GetSourceURL(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+
+	var t ffmpeg.Transform
+	if err := c.ShouldBindJSON(&t); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if err := t.Validate(); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.sourceManager.SetTransform(c.Param("id"), t); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
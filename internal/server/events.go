@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// defaultEventsLimit is how many events /api/events returns without ?limit
+const defaultEventsLimit = 100
+
+const (
+	// eventFeedBuffer is how many events may queue for a slow WebSocket client
+	// before it starts missing them
+	eventFeedBuffer = 64
+	// eventFeedWriteTimeout bounds a single write to a WebSocket client
+	eventFeedWriteTimeout = 10 * time.Second
+)
+
+func (s *Server) handleListEvents(c *gin.Context) {
+	limit := defaultEventsLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "limit"})
+			return
+		}
+		limit = n
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":  s.events.Recent(limit, events.ParseTypes(c.Query("type"))...),
+		"dropped": s.events.Dropped(),
+	})
+}
+
+// handleEventFeed streams events to a WebSocket client as they are published,
+// one JSON message per event, optionally filtered by ?type. Browsers cannot
+// set headers on WebSockets, so the token is usually passed as ?token.
+func (s *Server) handleEventFeed(c *gin.Context) {
+	if s.events == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "events"})
+		return
+	}
+	if _, ok := s.authorizeSession(c, "", "events"); !ok {
+		return
+	}
+	types := events.ParseTypes(c.Query("type"))
+
+	server := websocket.Server{
+		// The API allows any origin, and the feed is authorized above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			s.streamEvents(ws, c.ClientIP(), types)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// streamEvents writes events to ws until the client at the remote address
+// goes away.
+func (s *Server) streamEvents(ws *websocket.Conn, remote string, types []events.Type) {
+	ch, unsubscribe := s.events.Subscribe(eventFeedBuffer, types...)
+	defer unsubscribe()
+
+	// Clients are not expected to send anything; reading only notices them leave
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	logrus.Debugf("Event feed client %s connected", remote)
+	defer logrus.Debugf("Event feed client %s disconnected", remote)
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev := <-ch:
+			ws.SetWriteDeadline(time.Now().Add(eventFeedWriteTimeout))
+			if err := websocket.JSON.Send(ws, ev); err != nil {
+				logrus.Debugf("Failed to send %s event to %s: %v", ev.Type, remote, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/flags"
+)
+
+// FlagRequest turns a feature flag on or off at runtime.
+type FlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// handleListFlags reports every feature flag and where its value comes
+// from.
+func (s *Server) handleListFlags(c *gin.Context) {
+	if s.flags == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "feature_flags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"flags": s.flags.List()})
+}
+
+func (s *Server) handleGetFlag(c *gin.Context) {
+	if s.flags == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "feature_flags"})
+		return
+	}
+	status, err := s.flags.Get(flags.Flag(c.Param("name")))
+	if err != nil {
+		respondError(c, http.StatusNotFound, MsgFlagNotFound, map[string]string{"flag": c.Param("name")})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handlePutFlag sets a feature flag at runtime. It overrides FEATURE_FLAGS,
+// also across restarts, until it is reset. It requires the admin token.
+func (s *Server) handlePutFlag(c *gin.Context) {
+	if !s.authorizeAdmin(c, "feature_flags") {
+		return
+	}
+	if s.flags == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "feature_flags"})
+		return
+	}
+	var req FlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	flag := flags.Flag(c.Param("name"))
+	if _, err := s.flags.Get(flag); err != nil {
+		respondError(c, http.StatusNotFound, MsgFlagNotFound, map[string]string{"flag": c.Param("name")})
+		return
+	}
+	status, err := s.flags.Update(flag, *req.Enabled)
+	if err != nil {
+		respondErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	s.flagChanged(status)
+	c.JSON(http.StatusOK, status)
+}
+
+// handleResetFlag drops the runtime value of a feature flag, bringing back
+// its configured value or default. It requires the admin token.
+func (s *Server) handleResetFlag(c *gin.Context) {
+	if !s.authorizeAdmin(c, "feature_flags") {
+		return
+	}
+	if s.flags == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "feature_flags"})
+		return
+	}
+	flag := flags.Flag(c.Param("name"))
+	if _, err := s.flags.Get(flag); err != nil {
+		respondError(c, http.StatusNotFound, MsgFlagNotFound, map[string]string{"flag": c.Param("name")})
+		return
+	}
+	status, err := s.flags.Reset(flag)
+	if err != nil {
+		respondErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	s.flagChanged(status)
+	c.JSON(http.StatusOK, status)
+}
+
+// flagEnabled writes the error response and returns false while a flag
+// turns its subsystem off.
+func (s *Server) flagEnabled(c *gin.Context, flag flags.Flag) bool {
+	if s.flags.Enabled(flag) {
+		return true
+	}
+	respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": string(flag)})
+	return false
+}
+
+func (s *Server) flagChanged(status flags.Status) {
+	state := "off"
+	if status.Enabled {
+		state = "on"
+	}
+	logrus.Infof("🚩 Feature flag %s is %s (%s)", status.Name, state, status.Source)
+	if s.events != nil {
+		s.events.Publish(events.Event{Type: events.FlagChanged, Data: map[string]interface{}{
+			"flag":    string(status.Name),
+			"enabled": status.Enabled,
+			"source":  status.Source,
+		}})
+	}
+}
@@ -2,47 +2,162 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"golang-webrtc-streaming/internal/analytics"
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/auth"
+	"golang-webrtc-streaming/internal/camera"
+	"golang-webrtc-streaming/internal/captions"
+	"golang-webrtc-streaming/internal/config"
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/flags"
+	"golang-webrtc-streaming/internal/health"
+	"golang-webrtc-streaming/internal/logring"
+	"golang-webrtc-streaming/internal/metadata"
+	"golang-webrtc-streaming/internal/metrics"
+	"golang-webrtc-streaming/internal/recording"
+	"golang-webrtc-streaming/internal/rtsp"
+	"golang-webrtc-streaming/internal/sip"
 	"golang-webrtc-streaming/internal/source"
+	"golang-webrtc-streaming/internal/storage"
+	"golang-webrtc-streaming/internal/uplink"
+	"golang-webrtc-streaming/internal/usage"
 	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+	"golang-webrtc-streaming/web"
 
 	"github.com/gin-gonic/gin"
-	"github.com/pion/webrtc/v3"
 	"github.com/sirupsen/logrus"
 )
 
 type Server struct {
-	port          int
-	webrtcManager *webrtcmanager.Manager
-	sourceManager *source.Manager
-	router        *gin.Engine
-	server        *http.Server
-	isRunning     bool
-	mu            sync.RWMutex
+	port             int
+	webrtcManager    *webrtcmanager.Manager
+	sourceManager    *source.Manager
+	captions         *captions.Store
+	metadata         *metadata.Store
+	recordingManager *recording.Manager
+	storageMonitor   *storage.Monitor
+	healthMonitor    *health.Monitor
+	events           *events.Bus
+	cameras          *camera.Store
+	upstreams        *rtsp.UpstreamPool
+	analytics        *analytics.Hub
+	usage            *usage.Ledger
+	audio            *audio.Broadcaster
+	offerAuth        auth.Hook
+	flags            *flags.Set
+	uplink           *webrtcmanager.Uplink
+	uplinkIngest     *uplink.Ingest
+	whipIngest       *uplink.Ingest
+	sip              *sip.Agent
+	config           *config.Config
+	logs             *logring.Ring
+	startedAt        time.Time
+	// WHEP sessions by resource ID
+	whepSessions map[string]*whepSession
+	whepMu       sync.Mutex
+	router       *gin.Engine
+	server       *http.Server
+	listener     net.Listener
+	tlsCertFile  string
+	tlsKeyFile   string
+	// Web client files by URL path, and what the client is told at runtime
+	assets           map[string]*staticAsset
+	staticMaxAge     time.Duration
+	apiBase          string
+	featureOverrides map[string]bool
+	// requireSelfTest keeps /readyz failing until the startup self-test passed
+	requireSelfTest bool
+	isRunning       bool
+	mu              sync.RWMutex
+}
+
+// Services bundles the optional subsystems exposed through the HTTP API.
+type Services struct {
+	Metadata  *metadata.Store
+	Recording *recording.Manager
+	Storage   *storage.Monitor
+	Health    *health.Monitor
+	Events    *events.Bus
+	Cameras   *camera.Store
+	// Upstreams is set when RTSP sources fail over between restreamers
+	Upstreams *rtsp.UpstreamPool
+	Analytics *analytics.Hub
+	Usage     *usage.Ledger
+	// Audio serves the audio-only MP3/AAC streams
+	Audio *audio.Broadcaster
+	// OfferAuth, if set, must allow every new viewer session
+	OfferAuth auth.Hook
+	// Flags gate experimental subsystems
+	Flags *flags.Set
+	// Uplink is set on edge instances pushing streams to a central one, and
+	// UplinkIngest on central instances accepting them
+	Uplink       *webrtcmanager.Uplink
+	UplinkIngest *uplink.Ingest
+	// WHIPIngest accepts streams published over WHIP
+	WHIPIngest *uplink.Ingest
+	// SIP bridges door stations' calls into a stream
+	SIP *sip.Agent
+	// Config and Logs go into debug bundles
+	Config *config.Config
+	Logs   *logring.Ring
 }
 
 type OfferRequest struct {
-	SDP webrtc.SessionDescription `json:"sdp"`
+	SDP        webrtcmanager.SessionDescription `json:"sdp"`
+	AudioTrack string                           `json:"audio_track,omitempty"`
+	// Stream picks the stream to watch; without it the viewer follows the
+	// active source as it switches
+	Stream string `json:"stream,omitempty"`
+	// RelayOnly asks for a TURN-only connection; streams in RELAY_ONLY_STREAMS always get one
+	RelayOnly bool `json:"relay_only,omitempty"`
+	// MaxBitrateKbps lets metered viewers lower their video bitrate cap
+	MaxBitrateKbps int `json:"max_bitrate_kbps,omitempty"`
+	// LiveEdge asks to drop video the viewer falls behind on rather than delay it
+	LiveEdge bool `json:"live_edge,omitempty"`
+	// ResumeToken re-attaches to the session of an earlier offer that lost
+	// its connection, if it is still within PEER_RESUME_GRACE_SECONDS
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Trickle returns the answer before ICE gathering completes; the
+	// candidates follow on /api/events/candidates
+	Trickle bool `json:"trickle,omitempty"`
 }
 
 type OfferResponse struct {
 	SDP string `json:"sdp"`
+	// ResumeToken, if set, resumes this session after a disconnect
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Resumed is set when the offer re-attached to a detached session
+	Resumed bool `json:"resumed,omitempty"`
+	// SessionExpiresAt, if set, is when the client must re-authenticate
+	SessionExpiresAt *time.Time `json:"session_expires_at,omitempty"`
+	// PeerID identifies the session on the peer endpoints
+	PeerID string `json:"peer_id"`
+	// TrickleKey authorizes the candidate endpoints when the offer asked to
+	// trickle
+	TrickleKey string `json:"trickle_key,omitempty"`
 }
 
 type SnapshotResponse struct {
-	Success bool   `json:"success"`
-	Data    string `json:"data,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success bool        `json:"success"`
+	Data    string      `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Code    MessageCode `json:"code,omitempty"`
 }
 
 type StatusResponse struct {
 	WebRTC struct {
 		ConnectedPeers int `json:"connected_peers"`
 		TotalPeers     int `json:"total_peers"`
+		RelayedPeers   int `json:"relayed_peers"`
+		DirectPeers    int `json:"direct_peers"`
 	} `json:"webrtc"`
 	Source struct {
 		Type      string   `json:"type"`
@@ -53,13 +168,16 @@ type StatusResponse struct {
 		RTMP bool `json:"rtmp"`
 		RTSP bool `json:"rtsp"`
 	} `json:"streams"`
+	Metadata map[string]metadata.Metadata `json:"metadata"`
+	Health   map[string]health.Report     `json:"health"`
+	AVSync   webrtcmanager.AVSyncStatus   `json:"av_sync"`
 }
 
 type SourceSwitchRequest struct {
 	Type string `json:"type"`
 }
 
-func NewServer(port int, webrtcManager *webrtcmanager.Manager, sourceManager *source.Manager) *Server {
+func NewServer(port int, webrtcManager *webrtcmanager.Manager, sourceManager *source.Manager, services Services) *Server {
 	// Set Gin to release mode for production
 	gin.SetMode(gin.ReleaseMode)
 
@@ -68,8 +186,10 @@ func NewServer(port int, webrtcManager *webrtcmanager.Manager, sourceManager *so
 	// Enable CORS
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		// WHEP players read the session's URL and ICE servers from headers
+		c.Header("Access-Control-Expose-Headers", "Location, ETag, Link, Accept-Patch")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -80,12 +200,44 @@ func NewServer(port int, webrtcManager *webrtcmanager.Manager, sourceManager *so
 	})
 
 	server := &Server{
-		port:          port,
-		webrtcManager: webrtcManager,
-		sourceManager: sourceManager,
-		router:        router,
+		port:             port,
+		webrtcManager:    webrtcManager,
+		sourceManager:    sourceManager,
+		captions:         captions.NewStore(),
+		metadata:         services.Metadata,
+		recordingManager: services.Recording,
+		storageMonitor:   services.Storage,
+		healthMonitor:    services.Health,
+		events:           services.Events,
+		cameras:          services.Cameras,
+		upstreams:        services.Upstreams,
+		analytics:        services.Analytics,
+		usage:            services.Usage,
+		audio:            services.Audio,
+		offerAuth:        services.OfferAuth,
+		flags:            services.Flags,
+		uplink:           services.Uplink,
+		uplinkIngest:     services.UplinkIngest,
+		whipIngest:       services.WHIPIngest,
+		sip:              services.SIP,
+		config:           services.Config,
+		logs:             services.Logs,
+		startedAt:        time.Now(),
+		router:           router,
+		staticMaxAge:     DefaultStaticMaxAge,
+		apiBase:          DefaultAPIBase,
+	}
+
+	assets, err := loadWebAssets(web.Files, gin.H{"title": "Go WebRTC Streaming"})
+	if err != nil {
+		logrus.Errorf("Failed to load web client: %v", err)
 	}
+	server.assets = assets
 
+	if server.analytics != nil {
+		server.analytics.OnDetections(server.forwardDetections)
+	}
+	webrtcManager.RegisterMessageHandler("reauth", server.handleReauthMessage)
 	server.setupRoutes()
 	return server
 }
@@ -94,18 +246,129 @@ func (s *Server) setupRoutes() {
 	// API routes
 	api := s.router.Group("/api")
 	{
-		api.POST("/offer", s.handleOffer)
-		api.GET("/snapshot", s.handleSnapshot)
+		api.POST("/offer", withDeadline(signalingTimeout), s.handleOffer)
+		api.POST("/offer/dry-run", withDeadline(signalingTimeout), s.handleDryRunOffer)
+		api.GET("/snapshot", withDeadline(snapshotTimeout), s.handleSnapshot)
 		api.GET("/status", s.handleStatus)
+		api.GET("/capabilities", s.handleCapabilities)
 		api.GET("/peers", s.handlePeers)
+		api.POST("/peers/:id/ice-restart", withDeadline(signalingTimeout), s.handleICERestart)
+		api.POST("/peers/:id/candidates", s.handlePostCandidate)
+		api.POST("/ice-candidate", s.handleICECandidate)
+		api.GET("/ice-candidate", s.handleCandidateEvents)
+		api.GET("/peers/:id/log", s.handlePeerLog)
+		api.GET("/audio-tracks", s.handleAudioTracks)
+		api.GET("/webrtc-config", s.handleWebRTCConfig)
+		api.GET("/debug/impairment", s.handleGetImpairment)
+		api.PUT("/debug/impairment", s.handlePutImpairment)
 		api.GET("/source", s.handleGetSource)
 		api.POST("/source", s.handleSwitchSource)
+		api.GET("/cameras", s.handleListCameras)
+		api.POST("/cameras", s.handleCreateCamera)
+		api.POST("/cameras/import", s.handleImportCameras)
+		api.GET("/cameras/:id", s.handleGetCamera)
+		api.PUT("/cameras/:id", s.handleUpdateCamera)
+		api.DELETE("/cameras/:id", s.handleDeleteCamera)
+		api.POST("/sources", s.handleRegisterSource)
+		api.DELETE("/sources/:id", s.handleUnregisterSource)
+		api.GET("/sources/:id/stats", s.handleSourceStats)
+		api.GET("/streams", s.handleListStreams)
+		api.GET("/streams/:id/health", s.handleStreamHealth)
+		api.POST("/streams/:id/prewarm", s.handlePrewarm)
+		api.GET("/streams/:id/blackout", s.handleGetBlackout)
+		api.POST("/streams/:id/blackout", s.handleStartBlackout)
+		api.DELETE("/streams/:id/blackout", s.handleEndBlackout)
+		api.GET("/streams/:id/encoding", s.handleGetEncoding)
+		api.PUT("/streams/:id/encoding", s.handlePutEncoding)
+		api.GET("/streams/:id/transform", s.handleGetTransform)
+		api.PUT("/streams/:id/transform", s.handlePutTransform)
+		api.GET("/streams/:id/sinks", s.handleListSinks)
+		api.POST("/streams/:id/sinks/:name/enable", s.handleEnableSink)
+		api.POST("/streams/:id/sinks/:name/disable", s.handleDisableSink)
+		api.POST("/streams/:id/captions", s.handlePostCaption)
+		api.GET("/streams/:id/captions.vtt", s.handleGetCaptionsVTT)
+		api.GET("/streams/:id/metadata", s.handleGetMetadata)
+		api.PUT("/streams/:id/metadata", s.handlePutMetadata)
+		api.GET("/streams/:id/schedule", s.handleGetSchedule)
+		api.PUT("/streams/:id/schedule", s.handlePutSchedule)
+		api.POST("/streams/:id/recording/start", s.handleStartRecording)
+		api.POST("/streams/:id/recording/stop", s.handleStopRecording)
+		api.GET("/streams/:id/segments", s.handleListSegments)
+		api.POST("/streams/:id/clips", s.handleExportClip)
+		api.GET("/streams/:id/clips/:name", s.handleGetClip)
+		api.GET("/streams/:id/timelapses", s.handleListTimelapses)
+		api.GET("/streams/:id/timelapses/:name", s.handleGetTimelapse)
+		api.GET("/streams/:id/preview.gif", s.handlePreviewGIF)
+		api.GET("/streams/:id/preview.webp", s.handlePreviewWebP)
+		api.GET("/streams/:id/audio.mp3", s.handleAudioMP3)
+		api.GET("/streams/:id/audio.aac", s.handleAudioAAC)
+		api.GET("/recordings", s.handleListRecordings)
+		api.POST("/recordings/:id/pause", s.handlePauseRecording)
+		api.POST("/recordings/:id/resume", s.handleResumeRecording)
+		api.POST("/recordings/:id/split", s.handleSplitRecording)
+		api.GET("/storage", s.handleStorage)
+		api.GET("/upstreams", s.handleUpstreams)
+		api.GET("/events", s.handleListEvents)
+		api.GET("/events/candidates", s.handleCandidateEvents)
+		api.GET("/usage", s.handleUsage)
+		api.DELETE("/usage", s.handleResetUsage)
+		api.GET("/admin/maintenance", s.handleGetMaintenance)
+		api.PUT("/admin/maintenance", s.handlePutMaintenance)
+		api.GET("/admin/debug-bundle", s.handleDebugBundle)
+		api.GET("/messages", s.handleMessages)
+		api.GET("/flags", s.handleListFlags)
+		api.GET("/flags/:name", s.handleGetFlag)
+		api.PUT("/flags/:name", s.handlePutFlag)
+		api.DELETE("/flags/:name", s.handleResetFlag)
+		api.GET("/uplink", s.handleUplinkStatus)
+		api.POST("/uplink", withDeadline(signalingTimeout), s.handleUplinkOffer)
+		api.POST("/uplink/:stream", withDeadline(signalingTimeout), s.handleUplinkOffer)
+		api.GET("/uplink/sessions", s.handleListUplinkSessions)
+		api.DELETE("/uplink/sessions/:id", s.handleDeleteUplinkSession)
+		api.GET("/whip/sessions", s.handleListWHIPSessions)
+		api.GET("/sip", s.handleSIPStatus)
+		api.POST("/sip/calls", s.handleSIPDial)
+		api.POST("/sip/calls/:id/answer", s.handleSIPAnswer)
+		api.DELETE("/sip/calls/:id", s.handleSIPHangup)
+		api.GET("/sip/calls/:id/audio.wav", s.handleSIPAudio)
 	}
 
-	// Static files
-	s.router.Static("/static", "./web/static")
-	s.router.LoadHTMLGlob("web/templates/*")
+	s.router.GET("/ws/events", s.handleEventFeed)
+	s.router.GET("/ws/analytics", s.handleAnalyticsFeed)
+	s.router.GET("/ws/sip/talkback", s.handleSIPTalkback)
+	s.router.GET("/metrics", s.handleMetrics)
+	s.router.GET("/readyz", s.handleReadyz)
+
+	// Recorded content as on-demand HLS
+	vod := s.router.Group("/vod/:id")
+	{
+		vod.GET("/index.m3u8", s.handleVODPlaylist)
+		vod.GET("/segments/:segment", s.handleVODSegment)
+	}
+
+	// WHEP playback for standard players
+	whep := s.router.Group("/whep")
+	{
+		whep.POST("", withDeadline(signalingTimeout), s.handleWHEPOffer)
+		whep.PATCH("/sessions/:id", withDeadline(signalingTimeout), s.handleWHEPPatch)
+		whep.DELETE("/sessions/:id", s.handleWHEPDelete)
+	}
+
+	// WHIP publishing into whip sources
+	whip := s.router.Group("/whip")
+	{
+		whip.POST("", withDeadline(signalingTimeout), s.handleWHIPOffer)
+		whip.POST("/:stream", withDeadline(signalingTimeout), s.handleWHIPOffer)
+		whip.PATCH("/sessions/:id", s.handleWHIPPatch)
+		whip.DELETE("/sessions/:id", s.handleWHIPDelete)
+	}
+
+	// Web client
+	s.router.GET("/static/*filepath", s.handleStaticAsset)
+	s.router.HEAD("/static/*filepath", s.handleStaticAsset)
 	s.router.GET("/", s.handleIndex)
+	s.router.HEAD("/", s.handleIndex)
+	s.router.GET("/app-config.json", s.handleAppConfig)
 }
 
 func (s *Server) Start(ctx context.Context) error {
@@ -123,13 +386,17 @@ func (s *Server) Start(ctx context.Context) error {
 
 	// Start server in goroutine
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.serve(); err != nil && err != http.ErrServerClosed {
 			logrus.Errorf("HTTP server error: %v", err)
 		}
 	}()
 
 	s.isRunning = true
-	logrus.Infof("HTTP server started on port %d", s.port)
+	if s.listener != nil {
+		logrus.Infof("HTTP server started on %s", s.listener.Addr())
+	} else {
+		logrus.Infof("HTTP server started on port %d", s.port)
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -147,6 +414,59 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// SetListener serves on l, e.g. a port shared with WebRTC media, instead of
+// listening on the configured port. It must be called before Start.
+func (s *Server) SetListener(l net.Listener) {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+}
+
+// SetTLS serves HTTPS with the given certificate and key files. It must be
+// called before Start.
+func (s *Server) SetTLS(certFile, keyFile string) {
+	s.mu.Lock()
+	s.tlsCertFile, s.tlsKeyFile = certFile, keyFile
+	s.mu.Unlock()
+}
+
+// SetTrustedProxies sets the reverse proxies, as IPs or CIDRs, whose
+// headers name the client's address: the first of headers a trusted proxy
+// set is used, X-Forwarded-For from its rightmost untrusted hop. Requests
+// from anywhere else are attributed to their connection's address. It must
+// be called before Start.
+func (s *Server) SetTrustedProxies(proxies, headers []string) error {
+	if err := s.router.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	s.router.ForwardedByClientIP = len(headers) > 0
+	s.router.RemoteIPHeaders = headers
+	return nil
+}
+
+// RequireSelfTest reports the server as not ready until the startup
+// self-test passed. It must be called before Start.
+func (s *Server) RequireSelfTest() {
+	s.mu.Lock()
+	s.requireSelfTest = true
+	s.mu.Unlock()
+}
+
+// serve blocks serving HTTP or HTTPS on the configured listener or port.
+func (s *Server) serve() error {
+	useTLS := s.tlsCertFile != "" || s.tlsKeyFile != ""
+	switch {
+	case s.listener != nil && useTLS:
+		return s.server.ServeTLS(s.listener, s.tlsCertFile, s.tlsKeyFile)
+	case s.listener != nil:
+		return s.server.Serve(s.listener)
+	case useTLS:
+		return s.server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	default:
+		return s.server.ListenAndServe()
+	}
+}
+
 func (s *Server) Stop() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -167,68 +487,277 @@ func (s *Server) Stop() error {
 	return nil
 }
 
-func (s *Server) handleIndex(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title": "Go WebRTC Streaming",
-	})
-}
-
 func (s *Server) handleOffer(c *gin.Context) {
+	receivedAt := time.Now()
 	var req OfferRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindOffer(c, &req) {
 		return
 	}
 
 	// Parse the offer
 	offer := req.SDP
+	if req.MaxBitrateKbps < 0 {
+		respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "max_bitrate_kbps"})
+		return
+	}
 
-	// Generate peer ID
-	peerID := fmt.Sprintf("peer_%d", time.Now().UnixNano())
+	stream, pinned, ok := s.offerStream(c, req.Stream)
+	if !ok {
+		return
+	}
+	var opts webrtcmanager.PeerOptions
+	var peerID string
+	if session, ok := s.webrtcManager.DetachedSession(req.ResumeToken); ok && session.Pinned == pinned && (!pinned || strings.EqualFold(session.Stream, stream)) {
+		// The token stands for the session's authorization; the offer can
+		// only lower its bitrate cap and pick another audio program
+		peerID = session.PeerID
+		opts = webrtcmanager.PeerOptions{
+			Stream:         stream,
+			Pinned:         pinned,
+			RelayOnly:      session.RelayOnly || req.RelayOnly || s.webrtcManager.RelayRequired(stream),
+			Tags:           session.Tags,
+			MaxBitrateKbps: webrtcmanager.LowestBitrate(req.MaxBitrateKbps, session.MaxBitrateKbps),
+			LiveEdge:       session.LiveEdge,
+			ResumeToken:    req.ResumeToken,
+		}
+		if req.AudioTrack == "" {
+			req.AudioTrack = session.AudioTrack
+		}
+	} else {
+		// Unknown and expired tokens, and sessions of another stream, start over
+		decision, ok := s.authorizeSession(c, stream, "offer")
+		if !ok {
+			return
+		}
 
-	// Create peer
-	_, err := s.webrtcManager.CreatePeer(peerID)
+		peerID = webrtcmanager.NewPeerID("peer")
+
+		// Relay through TURN if the viewer or the stream's policy asks for it
+		opts = webrtcmanager.PeerOptions{
+			Stream:         stream,
+			Pinned:         pinned,
+			RelayOnly:      req.RelayOnly || s.webrtcManager.RelayRequired(stream),
+			Tags:           decision.Tags,
+			MaxBitrateKbps: webrtcmanager.LowestBitrate(req.MaxBitrateKbps, decision.MaxBitrateKbps),
+			LiveEdge:       req.LiveEdge,
+		}
+	}
+	opts.OfferReceivedAt = receivedAt
+	opts.RemoteIP = c.ClientIP()
+	opts.Trickle = req.Trickle
+
+	peer, err := s.webrtcManager.CreatePeerWithOptions(peerID, opts)
 	if err != nil {
-		logrus.Errorf("Failed to create peer: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create peer"})
+		respondPeerError(c, err)
 		return
 	}
 
+	// Apply the requested audio program before media starts flowing
+	if req.AudioTrack != "" {
+		if err := s.webrtcManager.SelectAudioTrack(peerID, req.AudioTrack); err != nil {
+			s.webrtcManager.RemovePeer(peerID)
+			respondErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	// Handle the offer
-	answer, err := s.webrtcManager.HandleOffer(peerID, offer)
+	answer, err := s.webrtcManager.HandleOffer(c.Request.Context(), peerID, offer)
 	if err != nil {
 		logrus.Errorf("Failed to handle offer: %v", err)
 		s.webrtcManager.RemovePeer(peerID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle offer"})
+		if !respondDeadline(c, err) {
+			respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		}
 		return
 	}
 
 	// Return the answer directly without double JSON encoding
 	response := OfferResponse{
-		SDP: answer.SDP,
+		SDP:         answer.SDP,
+		PeerID:      peerID,
+		ResumeToken: peer.ResumeToken(),
+		Resumed:     opts.ResumeToken != "",
 	}
+	if expiresAt, ok := s.webrtcManager.SessionExpiresAt(peerID); ok {
+		response.SessionExpiresAt = &expiresAt
+	}
+	response.TrickleKey = peer.TrickleKey()
 
 	c.JSON(http.StatusOK, response)
 }
 
+// offerStream resolves the stream a viewer asks to watch: the named one,
+// which it is pinned to, or without a name the active source, which it
+// follows. It writes the error response if the stream does not exist.
+func (s *Server) offerStream(c *gin.Context, name string) (stream string, pinned, ok bool) {
+	if name == "" {
+		return s.sourceManager.GetCurrentSource(), false, true
+	}
+	stream = strings.ToLower(strings.TrimSpace(name))
+	if !s.streamExists(stream) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": name})
+		return "", false, false
+	}
+	return stream, true, true
+}
+
+// respondPeerError answers a request whose viewer session could not be
+// created.
+func respondPeerError(c *gin.Context, err error) {
+	if errors.Is(err, webrtcmanager.ErrResumeExpired) {
+		respondError(c, http.StatusGone, MsgResumeExpired, nil)
+		return
+	}
+	if errors.Is(err, webrtcmanager.ErrPeerExists) {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	var maintenanceErr *webrtcmanager.MaintenanceError
+	if errors.As(err, &maintenanceErr) {
+		body := errorBody(webrtcmanager.LimitMaintenance, nil)
+		body["message"] = maintenanceErr.Message
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	var limitErr *webrtcmanager.ViewerLimitError
+	if errors.As(err, &limitErr) {
+		logrus.Warnf("Refused viewer from %s: %v", c.ClientIP(), err)
+		body := errorBody(MessageCode(limitErr.Code), map[string]string{"stream": limitErr.Stream})
+		body["stream"] = limitErr.Stream
+		body["limit"] = limitErr.Limit
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	logrus.Errorf("Failed to create peer: %v", err)
+	respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+}
+
+// handleDryRunOffer answers an offer like handleOffer without creating a
+// session, so clients and tests can check compatibility.
+func (s *Server) handleDryRunOffer(c *gin.Context) {
+	var req OfferRequest
+	if !bindOffer(c, &req) {
+		return
+	}
+	if req.MaxBitrateKbps < 0 {
+		respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "max_bitrate_kbps"})
+		return
+	}
+
+	stream, _, ok := s.offerStream(c, req.Stream)
+	if !ok {
+		return
+	}
+	decision, ok := s.authorizeSession(c, stream, "dry-run")
+	if !ok {
+		return
+	}
+
+	answer, err := s.webrtcManager.DryRunOffer(c.Request.Context(), req.SDP, webrtcmanager.PeerOptions{
+		Stream:         stream,
+		RelayOnly:      req.RelayOnly || s.webrtcManager.RelayRequired(stream),
+		MaxBitrateKbps: webrtcmanager.LowestBitrate(req.MaxBitrateKbps, decision.MaxBitrateKbps),
+	})
+	if err != nil {
+		logrus.Warnf("Dry-run offer failed: %v", err)
+		if !respondDeadline(c, err) {
+			respondErr(c, http.StatusUnprocessableEntity, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, OfferResponse{SDP: answer.SDP})
+}
+
+// maxOfferBodyBytes leaves room for JSON escaping around the largest accepted SDP
+const maxOfferBodyBytes = 2 * webrtcmanager.MaxOfferSDPBytes
+
+// bindOffer decodes and validates an offer request. It writes the error
+// response, with a code for SDP problems, and returns false if the offer
+// cannot be negotiated.
+func bindOffer(c *gin.Context, req *OfferRequest) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxOfferBodyBytes)
+	if err := c.ShouldBindJSON(req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, webrtcmanager.OfferTooLarge, nil)
+			return false
+		}
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return false
+	}
+
+	if err := webrtcmanager.ValidateOffer(req.SDP); err != nil {
+		var offerErr *webrtcmanager.OfferError
+		if errors.As(err, &offerErr) {
+			status := http.StatusBadRequest
+			if offerErr.Code == webrtcmanager.OfferTooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			body := errorBody(MessageCode(offerErr.Code), nil)
+			body["detail"] = offerErr.Message
+			c.JSON(status, body)
+			return false
+		}
+		respondErr(c, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// handleICERestart answers a client's ICE restart offer for an existing peer,
+// typically after the server asked for one over the data channel.
+func (s *Server) handleICERestart(c *gin.Context) {
+	var req OfferRequest
+	if !bindOffer(c, &req) {
+		return
+	}
+
+	peerID := c.Param("id")
+	if _, ok := s.webrtcManager.GetPeer(peerID); !ok {
+		respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+		return
+	}
+
+	answer, err := s.webrtcManager.RestartICE(c.Request.Context(), peerID, req.SDP)
+	if err != nil {
+		logrus.Errorf("Failed to restart ICE of peer %s: %v", peerID, err)
+		if !respondDeadline(c, err) {
+			respondErr(c, http.StatusConflict, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, OfferResponse{SDP: answer.SDP})
+}
+
+// handleSnapshot captures a picture of the stream named by the stream query
+// parameter, or of the active source.
 func (s *Server) handleSnapshot(c *gin.Context) {
-	// Check if there are active streams
-	peers := s.webrtcManager.GetAllPeers()
-	if len(peers) == 0 {
-		c.JSON(http.StatusServiceUnavailable, SnapshotResponse{
-			Success: false,
-			Error:   "No active streams available",
-		})
+	stream := c.Query("stream")
+	if stream != "" && !s.streamExists(strings.ToLower(stream)) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": stream})
 		return
 	}
 
-	// Capture snapshot from the latest video frame
-	snapshotData, err := s.webrtcManager.CaptureSnapshot()
+	// Capture snapshot from the cached GOP, which is kept whether or not
+	// anyone views the stream
+	snapshotData, err := s.webrtcManager.CaptureSnapshot(c.Request.Context(), stream)
 	if err != nil {
 		logrus.Errorf("Failed to capture snapshot: %v", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusGatewayTimeout, SnapshotResponse{
+				Success: false,
+				Error:   message(MsgTimedOut, nil),
+				Code:    MsgTimedOut,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, SnapshotResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to capture snapshot: %v", err),
+			Error:   message(MsgSnapshotFailed, nil),
+			Code:    MsgSnapshotFailed,
 		})
 		return
 	}
@@ -244,14 +773,19 @@ func (s *Server) handleSnapshot(c *gin.Context) {
 func (s *Server) handleStatus(c *gin.Context) {
 	peers := s.webrtcManager.GetAllPeers()
 	connectedPeers := s.webrtcManager.GetConnectedPeersCount()
+	relayed, direct := s.webrtcManager.RouteCounts()
 
 	response := StatusResponse{
 		WebRTC: struct {
 			ConnectedPeers int `json:"connected_peers"`
 			TotalPeers     int `json:"total_peers"`
+			RelayedPeers   int `json:"relayed_peers"`
+			DirectPeers    int `json:"direct_peers"`
 		}{
 			ConnectedPeers: connectedPeers,
 			TotalPeers:     len(peers),
+			RelayedPeers:   relayed,
+			DirectPeers:    direct,
 		},
 		Source: struct {
 			Type      string   `json:"type"`
@@ -269,6 +803,9 @@ func (s *Server) handleStatus(c *gin.Context) {
 			RTMP: s.sourceManager != nil && len(filter(s.sourceManager.GetAvailableSources(), "rtmp")) > 0,
 			RTSP: s.sourceManager != nil && len(filter(s.sourceManager.GetAvailableSources(), "rtsp")) > 0,
 		},
+		Metadata: s.metadata.All(),
+		Health:   s.healthMonitor.Reports(),
+		AVSync:   s.webrtcManager.AVSync(),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -285,21 +822,74 @@ func filter(arr []string, v string) []string {
 	return out
 }
 
+// handlePeerLog returns the recent log lines of a peer session, including
+// sessions that ended recently. It requires the admin token.
+func (s *Server) handlePeerLog(c *gin.Context) {
+	if !s.authorizeAdmin(c, "peer_log") {
+		return
+	}
+	lines, ok := s.webrtcManager.PeerLog(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"peer": c.Param("id"), "lines": lines})
+}
+
 func (s *Server) handlePeers(c *gin.Context) {
-	peers := s.webrtcManager.GetAllPeers()
+	peerList := s.peerList()
+	c.JSON(http.StatusOK, gin.H{
+		"peers": peerList,
+		"count": len(peerList),
+	})
+}
 
+// peerList describes every peer as listed by /api/peers.
+func (s *Server) peerList() []gin.H {
+	peers := s.webrtcManager.GetAllPeers()
 	peerList := make([]gin.H, 0, len(peers))
 	for id, peer := range peers {
-		peerList = append(peerList, gin.H{
+		entry := gin.H{
 			"id":               id,
 			"connected":        peer.IsConnected,
 			"connection_state": peer.Connection.ConnectionState().String(),
-		})
+			"stream":           peer.Stream,
+			"relay_only":       peer.RelayOnly,
+			"bytes_sent":       peer.BytesSent(),
+		}
+		if len(peer.Tags) > 0 {
+			entry["tags"] = peer.Tags
+		}
+		if quality, ok := s.webrtcManager.PeerQuality(id); ok {
+			entry["quality"] = quality
+		}
+		if pair, ok := s.webrtcManager.PeerCandidatePair(id); ok {
+			entry["candidate_pair"] = pair
+		}
+		if bandwidth, ok := s.webrtcManager.PeerBandwidth(id); ok {
+			entry["bandwidth"] = bandwidth
+		}
+		if liveEdge, ok := s.webrtcManager.PeerLiveEdge(id); ok {
+			entry["live_edge"] = liveEdge
+		}
+		if rendition, ok := s.webrtcManager.PeerRendition(id); ok {
+			entry["rendition"] = rendition
+		}
+		if ttff, ok := s.webrtcManager.PeerTimeToFirstFrame(id); ok {
+			entry["time_to_first_frame_ms"] = ttff.Milliseconds()
+		}
+		if expiresAt, ok := s.webrtcManager.SessionExpiresAt(id); ok {
+			entry["session_expires_at"] = expiresAt
+		}
+		entry["stale"] = s.webrtcManager.PeerStale(id)
+		peerList = append(peerList, entry)
 	}
+	return peerList
+}
 
+func (s *Server) handleAudioTracks(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"peers": peerList,
-		"count": len(peers),
+		"tracks": s.webrtcManager.GetAudioTracks(),
 	})
 }
 
@@ -315,23 +905,139 @@ func (s *Server) handleGetSource(c *gin.Context) {
 func (s *Server) handleSwitchSource(c *gin.Context) {
 	var req SourceSwitchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
 		return
 	}
 
-	// Switch source (case-insensitive, with lazy init in manager)
-	if err := s.sourceManager.StartSource(c.Request.Context(), req.Type); err != nil {
+	// Switch source (case-insensitive, with lazy init in manager). The source
+	// keeps running after this request, so it is not bound to its context.
+	if err := s.sourceManager.StartSource(req.Type); err != nil {
 		logrus.Errorf("Failed to switch to %s source: %v", req.Type, err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     fmt.Sprintf("Failed to switch to %s: %v", req.Type, err),
-			"available": s.sourceManager.GetAvailableSources(),
-		})
+		body := errorBody(MsgSwitchFailed, map[string]string{"source": req.Type})
+		body["detail"] = err.Error()
+		body["available"] = s.sourceManager.GetAvailableSources()
+		c.JSON(http.StatusBadRequest, body)
 		return
 	}
 
+	params := map[string]string{"source": req.Type}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": fmt.Sprintf("Switched to %s source", req.Type),
+		"message": message(MsgSourceSwitched, params),
+		"code":    MsgSourceSwitched,
+		"params":  params,
 		"type":    req.Type,
 	})
 }
+
+func (s *Server) handleSourceStats(c *gin.Context) {
+	snapshot, err := s.sourceManager.GetSourceStats(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (s *Server) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	mw := metrics.NewWriter(c.Writer)
+
+	mw.Gauge("webrtc_peers_connected", "Number of connected WebRTC peers", float64(s.webrtcManager.GetConnectedPeersCount()))
+	relayed, direct := s.webrtcManager.RouteCounts()
+	mw.Gauge("webrtc_peers_by_route", "Connected peers by ICE route", float64(relayed), "route", "relay")
+	mw.Gauge("webrtc_peers_by_route", "Connected peers by ICE route", float64(direct), "route", "direct")
+
+	degraded := 0
+	for id := range s.webrtcManager.GetAllPeers() {
+		quality, ok := s.webrtcManager.PeerQuality(id)
+		if !ok {
+			continue
+		}
+		if quality.Degraded {
+			degraded++
+		}
+		mw.Gauge("webrtc_peer_decoded_fps", "Frames per second decoded by the client", quality.DecodedFPS, "peer", id)
+		mw.Counter("webrtc_peer_freezes_total", "Video freezes reported by the client", float64(quality.FreezeCount), "peer", id)
+		mw.Gauge("webrtc_peer_jitter_buffer_delay_ms", "Average jitter buffer delay reported by the client", quality.JitterBufferDelayMS, "peer", id)
+	}
+	avSync := s.webrtcManager.AVSync()
+	mw.Gauge("webrtc_av_sync_drift_ms", "Drift of audio behind video since measuring started", float64(avSync.DriftMS))
+	mw.Gauge("webrtc_av_sync_audio_delay_ms", "How long audio is held back for A/V sync", float64(avSync.AudioDelayMS))
+	mw.Gauge("webrtc_av_sync_video_delay_ms", "How long video is held back for A/V sync", float64(avSync.VideoDelayMS))
+	mw.Gauge("webrtc_peers_quality_degraded", "Peers whose latest quality report is degraded", float64(degraded))
+	mw.Gauge("webrtc_peers_downgraded", "Peers sent the low rendition because of packet loss", float64(s.webrtcManager.DowngradedPeers()))
+	for reason, count := range s.webrtcManager.DataChannelRejections() {
+		mw.Counter("webrtc_datachannel_messages_rejected_total", "Data channel messages refused before reaching a handler", float64(count), "reason", reason)
+	}
+	mw.Histogram("webrtc_time_to_first_frame_seconds", "Time from receiving an offer to sending the first video frame", s.webrtcManager.TimeToFirstFrame())
+
+	for id, peer := range s.webrtcManager.GetAllPeers() {
+		mw.Counter("webrtc_peer_bytes_sent_total", "Media bytes sent to the peer", float64(peer.BytesSent()), "peer", id)
+		if bandwidth, ok := s.webrtcManager.PeerBandwidth(id); ok {
+			mw.Gauge("webrtc_peer_max_bitrate_kbps", "Video bitrate cap of the peer", float64(bandwidth.MaxBitrateKbps), "peer", id)
+			mw.Counter("webrtc_peer_dropped_frames_total", "Video frames dropped to keep the peer under its cap", float64(bandwidth.DroppedFrames), "peer", id)
+		}
+		if liveEdge, ok := s.webrtcManager.PeerLiveEdge(id); ok {
+			mw.Gauge("webrtc_peer_send_queue_frames", "Video frames queued for a live edge peer", float64(liveEdge.QueuedFrames), "peer", id)
+			mw.Counter("webrtc_peer_live_edge_dropped_frames_total", "Video frames dropped to keep a live edge peer current", float64(liveEdge.DroppedNonReference+liveEdge.DroppedToKeyframe), "peer", id)
+		}
+	}
+
+	for id, st := range s.sourceManager.GetAllSourceStats() {
+		mw.Counter("source_frames_total", "H.264 units read from the source", float64(st.Frames), "source", id)
+		mw.Counter("source_bytes_total", "Bytes read from the source", float64(st.Bytes), "source", id)
+		mw.Counter("source_keyframes_total", "Keyframes read from the source", float64(st.Keyframes), "source", id)
+		mw.Gauge("source_bitrate_bps", "Source bitrate over the last second", st.BitrateBps, "source", id)
+		mw.Gauge("source_keyframe_interval_seconds", "Time between the last two keyframes", st.KeyframeIntervalSeconds, "source", id)
+		mw.Gauge("source_uptime_seconds", "Time since the source client was started", st.UptimeSeconds, "source", id)
+		mw.Counter("source_restarts_total", "Restarts of the source pipeline", float64(st.Restarts), "source", id)
+		mw.Counter("source_stalls_total", "Gaps of over a second between source frames", float64(st.Stalls), "source", id)
+	}
+
+	for id, report := range s.healthMonitor.Reports() {
+		mw.Gauge("stream_health_score", "Composite stream health score (0-100)", report.Score, "stream", id)
+	}
+
+	storageUsage := s.storageMonitor.Usage()
+	for category, used := range storageUsage.Categories {
+		mw.Gauge("storage_used_bytes", "Bytes used in the media directory", float64(used), "category", category)
+	}
+	mw.Gauge("storage_free_bytes", "Free bytes on the media filesystem", float64(storageUsage.FreeBytes))
+	mw.Gauge("storage_quota_bytes", "Configured media quota, 0 when unlimited", float64(storageUsage.QuotaBytes))
+	mw.Counter("storage_rotated_bytes_total", "Bytes deleted by storage rotation", float64(storageUsage.DeletedBytes))
+
+	if s.usage != nil {
+		report := s.usage.Report()
+		for id, totals := range report.Streams {
+			mw.Counter("usage_stream_bytes_sent_total", "Media bytes sent to the viewers of the stream this accounting period", float64(totals.BytesSent), "stream", id)
+		}
+		for tenant, totals := range report.Tenants {
+			mw.Counter("usage_tenant_bytes_sent_total", "Media bytes sent to the viewers of the tenant this accounting period", float64(totals.BytesSent), "tenant", tenant)
+		}
+	}
+	if s.audio != nil {
+		for id, formats := range s.audio.Listeners() {
+			for format, listeners := range formats {
+				mw.Gauge("audio_stream_listeners", "Listeners of an audio-only HTTP stream", float64(listeners), "stream", id, "format", string(format))
+			}
+		}
+	}
+
+	if err := mw.Flush(); err != nil {
+		logrus.Errorf("Failed to write metrics: %v", err)
+	}
+}
+
+func (s *Server) handleStreamHealth(c *gin.Context) {
+	report, ok := s.healthMonitor.Report(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgNoHealthReport, map[string]string{"stream": c.Param("id")})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) handleStorage(c *gin.Context) {
+	c.JSON(http.StatusOK, s.storageMonitor.Usage())
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetImpairment returns the network impairment applied to outgoing
+// media; it only exists while IMPAIRMENT_ENABLED is set.
+func (s *Server) handleGetImpairment(c *gin.Context) {
+	cfg, ok := s.webrtcManager.Impairment()
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "impairment"})
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// handlePutImpairment changes the network impairment of all peers at once.
+// It requires the admin token.
+func (s *Server) handlePutImpairment(c *gin.Context) {
+	if !s.authorizeAdmin(c, "impairment") {
+		return
+	}
+	if _, ok := s.webrtcManager.Impairment(); !ok {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "impairment"})
+		return
+	}
+
+	var cfg webrtcmanager.ImpairmentConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if err := s.webrtcManager.SetImpairment(cfg); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
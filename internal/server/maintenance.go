@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MaintenanceRequest turns maintenance mode on or off.
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+	// CountdownSeconds tells connected viewers they are disconnected after
+	// this long; 0 lets them watch until they leave
+	CountdownSeconds int `json:"countdown_seconds"`
+}
+
+// handleGetMaintenance reports maintenance mode and the viewers left to
+// drain.
+func (s *Server) handleGetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, s.webrtcManager.Maintenance())
+}
+
+// handlePutMaintenance starts or ends maintenance mode. While it is on, new
+// viewers are refused with 503 and /readyz fails. It requires the admin
+// token.
+func (s *Server) handlePutMaintenance(c *gin.Context) {
+	if !s.authorizeAdmin(c, "maintenance") {
+		return
+	}
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	if !req.Enabled {
+		logrus.Info("Maintenance mode ended")
+		c.JSON(http.StatusOK, s.webrtcManager.StopMaintenance())
+		return
+	}
+	status, err := s.webrtcManager.StartMaintenance(req.Message, time.Duration(req.CountdownSeconds)*time.Second)
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	logrus.Warnf("Maintenance mode started with %d viewers: %s", status.Viewers, req.Message)
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// MessageCode identifies a message shown to API clients. Codes are stable,
+// so clients can localize messages by code; the English text may change.
+type MessageCode string
+
+// Codes of client-facing messages
+const (
+	MsgInvalidRequest     MessageCode = "invalid_request"
+	MsgInvalidBody        MessageCode = "invalid_body"
+	MsgInvalidParameter   MessageCode = "invalid_parameter"
+	MsgMissingFields      MessageCode = "missing_fields"
+	MsgNotFound           MessageCode = "not_found"
+	MsgStreamNotFound     MessageCode = "stream_not_found"
+	MsgPeerNotFound       MessageCode = "peer_not_found"
+	MsgCameraNotFound     MessageCode = "camera_not_found"
+	MsgFlagNotFound       MessageCode = "flag_not_found"
+	MsgConflict           MessageCode = "conflict"
+	MsgTooLarge           MessageCode = "too_large"
+	MsgUnavailable        MessageCode = "unavailable"
+	MsgFeatureUnavailable MessageCode = "feature_unavailable"
+	MsgInternalError      MessageCode = "internal_error"
+	MsgAccessDenied       MessageCode = "access_denied"
+	MsgAuthUnavailable    MessageCode = "auth_unavailable"
+	MsgInvalidTrickleKey  MessageCode = "invalid_trickle_key"
+	MsgResumeExpired      MessageCode = "resume_expired"
+	MsgNoAudio            MessageCode = "no_audio"
+	MsgNoVideoYet         MessageCode = "no_video_yet"
+	MsgNoHealthReport     MessageCode = "no_health_report"
+	MsgStreamBlackedOut   MessageCode = "stream_blacked_out"
+	MsgNoCameras          MessageCode = "no_cameras"
+	MsgInvalidCamera      MessageCode = "invalid_camera"
+	MsgSnapshotFailed     MessageCode = "snapshot_failed"
+	MsgSourceSwitched     MessageCode = "source_switched"
+	MsgSwitchFailed       MessageCode = "switch_failed"
+	MsgStreamNotReady     MessageCode = "stream_not_ready"
+	MsgTimedOut           MessageCode = "timed_out"
+)
+
+// messageCatalogue holds the English text of every code. {name} is replaced
+// by the message's parameter of that name.
+var messageCatalogue = map[MessageCode]string{
+	MsgInvalidRequest:     "The request is invalid",
+	MsgInvalidBody:        "The request body is invalid",
+	MsgInvalidParameter:   "Invalid {parameter}",
+	MsgMissingFields:      "Required fields are missing: {fields}",
+	MsgNotFound:           "Not found",
+	MsgStreamNotFound:     "Stream {stream} not found",
+	MsgPeerNotFound:       "Viewer session not found",
+	MsgCameraNotFound:     "Camera not found",
+	MsgFlagNotFound:       "Unknown feature flag {flag}",
+	MsgConflict:           "The request conflicts with the current state",
+	MsgTooLarge:           "The request is too large",
+	MsgUnavailable:        "The service is unavailable, try again later",
+	MsgFeatureUnavailable: "This server does not offer {feature}",
+	MsgInternalError:      "Something went wrong on the server",
+	MsgAccessDenied:       "Access denied",
+	MsgAuthUnavailable:    "Authorization is unavailable, try again later",
+	MsgInvalidTrickleKey:  "Invalid trickle key",
+	MsgResumeExpired:      "The session can no longer be resumed, start a new one",
+	MsgNoAudio:            "The stream has no audio",
+	MsgNoVideoYet:         "No video has been received yet",
+	MsgNoHealthReport:     "No health report for stream {stream} yet",
+	MsgStreamBlackedOut:   "The stream is blacked out",
+	MsgNoCameras:          "No cameras found",
+	MsgInvalidCamera:      "Camera {index} ({name}) is invalid",
+	MsgSnapshotFailed:     "Failed to capture a snapshot",
+	MsgSourceSwitched:     "Switched to the {source} source",
+	MsgSwitchFailed:       "Failed to switch to the {source} source",
+	MsgStreamNotReady:     "Stream {stream} did not become ready in time",
+	MsgTimedOut:           "The server did not finish the request in time",
+
+	// Offers refused by the WebRTC manager
+	webrtcmanager.LimitMaintenance:       "The server is in maintenance",
+	webrtcmanager.LimitServerFull:        "The server is full, try again later",
+	webrtcmanager.LimitStreamFull:        "Stream {stream} is full, try again later",
+	webrtcmanager.OfferNotAnOffer:        "The session description is not an offer",
+	webrtcmanager.OfferTooLarge:          "The offer is too large",
+	webrtcmanager.OfferInvalidSDP:        "The offer is not valid SDP",
+	webrtcmanager.OfferNoMedia:           "The offer has no media",
+	webrtcmanager.OfferNoVideo:           "The offer does not receive video",
+	webrtcmanager.OfferNoCompatibleCodec: "The browser supports none of the server's video codecs",
+	webrtcmanager.OfferNoICECredentials:  "The offer lacks ICE credentials",
+	webrtcmanager.UplinkUnnamedTrack:     "A video track of the uplink does not name its stream",
+	webrtcmanager.UplinkDuplicateStream:  "The uplink pushes a stream twice",
+}
+
+// message renders the English text of a code with its parameters.
+func message(code MessageCode, params map[string]string) string {
+	text, ok := messageCatalogue[code]
+	if !ok {
+		return string(code)
+	}
+	for name, value := range params {
+		text = strings.ReplaceAll(text, "{"+name+"}", value)
+	}
+	return text
+}
+
+// errorBody is the body of error responses: the code clients localize by,
+// with its parameters, and the English text as "error". Callers may add
+// fields.
+func errorBody(code MessageCode, params map[string]string) gin.H {
+	body := gin.H{"error": message(code, params), "code": code}
+	if len(params) > 0 {
+		body["params"] = params
+	}
+	return body
+}
+
+// respondError writes an error response with a message of the catalogue.
+func respondError(c *gin.Context, status int, code MessageCode, params map[string]string) {
+	c.JSON(status, errorBody(code, params))
+}
+
+// respondErr writes an error response for err with the generic code of the
+// status. The error's text is passed on as "detail" only for client errors,
+// which it explains; server errors are logged instead, as their text is
+// meant for operators.
+func respondErr(c *gin.Context, status int, err error) {
+	body := errorBody(statusCode(status), nil)
+	if status < http.StatusInternalServerError {
+		body["detail"] = err.Error()
+	} else {
+		logrus.Errorf("%s %s failed: %v", c.Request.Method, c.FullPath(), err)
+	}
+	c.JSON(status, body)
+}
+
+// statusCode is the generic message code of an HTTP status.
+func statusCode(status int) MessageCode {
+	switch status {
+	case http.StatusNotFound:
+		return MsgNotFound
+	case http.StatusConflict:
+		return MsgConflict
+	case http.StatusRequestEntityTooLarge:
+		return MsgTooLarge
+	case http.StatusForbidden:
+		return MsgAccessDenied
+	case http.StatusServiceUnavailable:
+		return MsgUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return MsgInternalError
+	}
+	return MsgInvalidRequest
+}
+
+// messageEntry is a code of the catalogue with its English text.
+type messageEntry struct {
+	Code    MessageCode `json:"code"`
+	Message string      `json:"message"`
+}
+
+// handleMessages lists the message catalogue, so clients know every code
+// they may be sent and can ship translations of it.
+func (s *Server) handleMessages(c *gin.Context) {
+	entries := make([]messageEntry, 0, len(messageCatalogue))
+	for code, text := range messageCatalogue {
+		entries = append(entries, messageEntry{Code: code, Message: text})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	c.JSON(http.StatusOK, gin.H{"language": "en", "messages": entries})
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"golang-webrtc-streaming/internal/metadata"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) handleGetMetadata(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	md, _ := s.metadata.Get(streamID)
+	c.JSON(http.StatusOK, md)
+}
+
+func (s *Server) handlePutMetadata(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	var req metadata.Metadata
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	md, err := s.metadata.Set(streamID, req)
+	if err != nil {
+		logrus.Errorf("Failed to save metadata for %s: %v", streamID, err)
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+	c.JSON(http.StatusOK, md)
+}
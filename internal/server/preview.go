@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-webrtc-streaming/internal/preview"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPreviewSeconds = 5
+	maxPreviewSeconds     = 20
+	previewTimeout        = 30 * time.Second
+)
+
+func (s *Server) handlePreviewGIF(c *gin.Context) {
+	s.handlePreview(c, preview.FormatGIF)
+}
+
+func (s *Server) handlePreviewWebP(c *gin.Context) {
+	s.handlePreview(c, preview.FormatWebP)
+}
+
+// handlePreview renders a short animated preview of a stream from its
+// rolling buffer, for notifications that cannot embed video.
+func (s *Server) handlePreview(c *gin.Context, format preview.Format) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	seconds := defaultPreviewSeconds
+	if v := c.Query("seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPreviewSeconds {
+			body := errorBody(MsgInvalidParameter, map[string]string{"parameter": "seconds"})
+			body["detail"] = "seconds must be between 1 and " + strconv.Itoa(maxPreviewSeconds)
+			c.JSON(http.StatusBadRequest, body)
+			return
+		}
+		seconds = n
+	}
+
+	video, fps := s.webrtcManager.RecentVideo(streamID, time.Duration(seconds)*time.Second)
+	if len(video) == 0 {
+		respondError(c, http.StatusServiceUnavailable, MsgNoVideoYet, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), previewTimeout)
+	defer cancel()
+
+	data, err := preview.Render(ctx, video, fps, format, preview.Options{
+		Seconds: float64(seconds),
+		FPS:     10,
+		Width:   480,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to render preview of %s: %v", streamID, err)
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, format.ContentType(), data)
+}
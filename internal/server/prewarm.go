@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPrewarmTimeout = 15 * time.Second
+	maxPrewarmTimeout     = time.Minute
+	defaultPrewarmHold    = 2 * time.Minute
+	maxPrewarmHold        = 30 * time.Minute
+)
+
+// PrewarmRequest optionally overrides how long to wait for the first keyframe
+// and how long an on-demand source is kept running afterwards.
+type PrewarmRequest struct {
+	TimeoutSeconds int `json:"timeout_seconds"`
+	HoldSeconds    int `json:"hold_seconds"`
+}
+
+// handlePrewarm starts a stream's pipeline and blocks until its first
+// keyframe arrives, removing cold-start delay before an important session.
+func (s *Server) handlePrewarm(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	// The body is optional
+	var req PrewarmRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+			return
+		}
+	}
+
+	timeout := defaultPrewarmTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxPrewarmTimeout {
+		timeout = maxPrewarmTimeout
+	}
+	hold := defaultPrewarmHold
+	if req.HoldSeconds > 0 {
+		hold = time.Duration(req.HoldSeconds) * time.Second
+	}
+	if hold > maxPrewarmHold {
+		hold = maxPrewarmHold
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	waited, err := s.sourceManager.Prewarm(ctx, streamID, hold)
+	if err != nil {
+		body := errorBody(MsgStreamNotReady, map[string]string{"stream": streamID})
+		body["detail"] = err.Error()
+		body["ready"] = false
+		body["waited_ms"] = waited.Milliseconds()
+		c.JSON(http.StatusGatewayTimeout, body)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ready":     true,
+		"waited_ms": waited.Milliseconds(),
+		"hold_ms":   hold.Milliseconds(),
+	})
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleReadyz tells load balancers whether to send viewers here: not
+// until the startup self-test has pushed media through a loopback peer, nor
+// during maintenance.
+func (s *Server) handleReadyz(c *gin.Context) {
+	if maintenance := s.webrtcManager.Maintenance(); maintenance.Enabled {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "reason": "maintenance", "maintenance": maintenance})
+		return
+	}
+
+	// Set before Start, so it is read without s.mu, which Start holds
+	if !s.requireSelfTest {
+		c.JSON(http.StatusOK, gin.H{"ready": true})
+		return
+	}
+
+	result, finished := s.webrtcManager.SelfTest()
+	switch {
+	case !finished:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "reason": "self-test pending"})
+	case !result.Passed:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "reason": "self-test failed", "self_test": result})
+	default:
+		c.JSON(http.StatusOK, gin.H{"ready": true, "self_test": result})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"golang-webrtc-streaming/internal/auth"
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handleReauthMessage renews a viewer's session when the client sends a
+// fresh token over the data channel, checked like an offer (endpoint
+// "reauth"). A refused token ends the session.
+func (s *Server) handleReauthMessage(peer *webrtcmanager.Peer, payload json.RawMessage) error {
+	var msg struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("invalid reauth message: %w", err)
+	}
+
+	decision := auth.Allow()
+	if s.offerAuth != nil {
+		var err error
+		decision, err = s.offerAuth.Authorize(context.Background(), auth.Request{
+			Stream:   peer.Stream,
+			ClientIP: peer.RemoteIP(),
+			Token:    msg.Token,
+			Endpoint: "reauth",
+		})
+		if err != nil {
+			// The client may try again until its deadline
+			logrus.Errorf("Failed to authorize reauth of %s: %v", peer.ID, err)
+			return fmt.Errorf("authorization unavailable")
+		}
+	}
+	if !decision.Allow {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "Session not authorized"
+		}
+		// Not from within the data channel's own callback, which closing the
+		// connection waits for
+		go s.webrtcManager.EndSession(peer.ID, reason)
+		return nil
+	}
+
+	expiresAt, err := s.webrtcManager.RenewSession(peer.ID)
+	if err != nil {
+		return err
+	}
+	renewed := webrtcmanager.SessionMessage{Type: "reauth_ok", PeerID: peer.ID}
+	if !expiresAt.IsZero() {
+		renewed.ExpiresAt = &expiresAt
+	}
+	return peer.SendJSON(renewed)
+}
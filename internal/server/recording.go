@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"golang-webrtc-streaming/internal/recording"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) handleListRecordings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"active": s.recordingManager.Active(),
+	})
+}
+
+func (s *Server) handleStartRecording(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	if err := s.recordingManager.Start(streamID); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handleStopRecording(c *gin.Context) {
+	if err := s.recordingManager.Stop(c.Param("id")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handlePauseRecording(c *gin.Context) {
+	if err := s.recordingManager.Pause(c.Param("id")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handleResumeRecording(c *gin.Context) {
+	if err := s.recordingManager.Resume(c.Param("id")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// handleSplitRecording ends the current segment of a recording so the next
+// one starts now, e.g. at a shift change.
+func (s *Server) handleSplitRecording(c *gin.Context) {
+	if err := s.recordingManager.Split(c.Param("id")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handleGetSchedule(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	schedule, _ := s.recordingManager.GetSchedule(streamID)
+	if schedule.Windows == nil {
+		schedule.Windows = []recording.Window{}
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (s *Server) handlePutSchedule(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	var req recording.Schedule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.recordingManager.SetSchedule(streamID, req); err != nil {
+		logrus.Errorf("Failed to update schedule for %s: %v", streamID, err)
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+func (s *Server) handleListSegments(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "from"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "to"})
+			return
+		}
+	}
+
+	segments, err := s.recordingManager.Segments(streamID, from, to)
+	if err != nil {
+		logrus.Errorf("Failed to query segments of %s: %v", streamID, err)
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+	if segments == nil {
+		segments = []recording.Segment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"segments": segments})
+}
+
+// handleExportClip cuts a clip from recorded segments. With "overlay" set, the
+// wall-clock time and stream name are burned into the video.
+func (s *Server) handleExportClip(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	var req recording.ClipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	if req.Overlay && req.Label == "" {
+		req.Label = streamID
+		if md, ok := s.metadata.Get(streamID); ok && md.Title != "" {
+			req.Label = md.Title
+		}
+	}
+
+	clip, err := s.recordingManager.ExportClip(c.Request.Context(), streamID, req)
+	if err != nil {
+		logrus.Errorf("Failed to export clip of %s: %v", streamID, err)
+		respondErr(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"clip": clip,
+		"url":  "/api/streams/" + streamID + "/clips/" + clip.Name,
+	})
+}
+
+func (s *Server) handleGetClip(c *gin.Context) {
+	path, err := s.recordingManager.ClipPath(c.Param("id"), c.Param("name"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.FileAttachment(path, c.Param("name"))
+}
+
+// handleListTimelapses lists the time-lapses assembled from a stream's
+// sampled frames.
+func (s *Server) handleListTimelapses(c *gin.Context) {
+	streamID := c.Param("id")
+	if !s.streamExists(streamID) {
+		respondError(c, http.StatusNotFound, MsgStreamNotFound, map[string]string{"stream": streamID})
+		return
+	}
+
+	timelapses, err := s.recordingManager.Timelapses(streamID)
+	if err != nil {
+		respondErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"timelapses": timelapses})
+}
+
+func (s *Server) handleGetTimelapse(c *gin.Context) {
+	path, err := s.recordingManager.TimelapsePath(c.Param("id"), c.Param("name"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.FileAttachment(path, c.Param("name"))
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleListSinks(c *gin.Context) {
+	sinks, err := s.sourceManager.Sinks(c.Param("id"))
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sinks": sinks})
+}
+
+func (s *Server) handleEnableSink(c *gin.Context) {
+	if err := s.sourceManager.EnableSink(c.Param("id"), c.Param("name")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handleDisableSink(c *gin.Context) {
+	if err := s.sourceManager.DisableSink(c.Param("id"), c.Param("name")); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/flags"
+	"golang-webrtc-streaming/internal/sip"
+)
+
+// sipSampleRate is the rate of the G.711 audio of door stations
+const sipSampleRate = 8000
+
+type SIPCallRequest struct {
+	// To is the door station's SIP URI, user@host address, host, or, through
+	// a SIP server, extension
+	To string `json:"to"`
+}
+
+// handleSIPStatus shows the SIP agent's registration, its call, and the
+// calls before it.
+func (s *Server) handleSIPStatus(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	c.JSON(http.StatusOK, s.sip.Status())
+}
+
+// handleSIPDial calls a door station. The call rings in the background;
+// its state shows on /api/sip and in sip.* events.
+func (s *Server) handleSIPDial(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	if _, ok := s.authorizeSession(c, s.sip.Stream(), "sip-call"); !ok {
+		return
+	}
+	var req SIPCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.To == "" {
+		respondError(c, http.StatusBadRequest, MsgMissingFields, map[string]string{"fields": "to"})
+		return
+	}
+	call, err := s.sip.Dial(req.To)
+	if err != nil {
+		respondSIPError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, call)
+}
+
+// handleSIPAnswer answers a ringing call when calls are not answered
+// automatically.
+func (s *Server) handleSIPAnswer(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	if _, ok := s.authorizeSession(c, s.sip.Stream(), "sip-call"); !ok {
+		return
+	}
+	call, err := s.sip.Answer(c.Param("id"))
+	if err != nil {
+		respondSIPError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, call)
+}
+
+// handleSIPHangup ends a call, declining it if it is ringing.
+func (s *Server) handleSIPHangup(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	if _, ok := s.authorizeSession(c, s.sip.Stream(), "sip-call"); !ok {
+		return
+	}
+	if err := s.sip.Hangup(c.Param("id")); err != nil {
+		respondSIPError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleSIPAudio streams the door station's audio on a call as an endless
+// 8 kHz WAV, which browsers play in an audio element.
+func (s *Server) handleSIPAudio(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	if _, ok := s.authorizeSession(c, s.sip.Stream(), "sip-audio"); !ok {
+		return
+	}
+	samples, stop, err := s.sip.Listen(c.Param("id"))
+	if err != nil {
+		respondSIPError(c, err)
+		return
+	}
+	defer stop()
+
+	c.Header("Content-Type", "audio/wav")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	if _, err := w.Write(streamingWAVHeader(sipSampleRate)); err != nil {
+		return
+	}
+	w.Flush()
+	for {
+		select {
+		case frame, ok := <-samples:
+			if !ok {
+				return
+			}
+			data := make([]byte, 2*len(frame))
+			for i, sample := range frame {
+				binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+			}
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			w.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// streamingWAVHeader starts a 16-bit mono WAV of unknown length.
+func streamingWAVHeader(sampleRate int) []byte {
+	const unknownSize = 0xFFFFFFFF
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], unknownSize)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], unknownSize)
+	return header
+}
+
+// handleSIPTalkback relays a browser's microphone to the door station on
+// a call. The WebSocket carries the chunks of a MediaRecorder, which
+// ffmpeg decodes, or with format=s16le raw 8 kHz 16-bit little-endian mono
+// audio.
+func (s *Server) handleSIPTalkback(c *gin.Context) {
+	if !s.requireSIP(c) {
+		return
+	}
+	if _, ok := s.authorizeSession(c, s.sip.Stream(), "talkback"); !ok {
+		return
+	}
+	callID := c.Query("call")
+	status := s.sip.Status()
+	if status.Call == nil || status.Call.ID != callID {
+		respondSIPError(c, sip.ErrCallNotFound)
+		return
+	}
+	if status.Call.AnsweredAt == nil {
+		respondSIPError(c, sip.ErrNotAnswered)
+		return
+	}
+	raw := c.Query("format") == "s16le"
+
+	server := websocket.Server{
+		// The API allows any origin, and the talker is authorized above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			s.serveTalkback(ws, c.ClientIP(), callID, raw)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveTalkback sends the audio of ws to a call until the talker at the
+// remote address goes away or the call ends.
+func (s *Server) serveTalkback(ws *websocket.Conn, remote, callID string, raw bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var pcm io.Reader = ws
+	if !raw {
+		cmd := ffmpeg.CommandContext(ctx,
+			"-hide_banner", "-loglevel", "error",
+			"-fflags", "nobuffer",
+			"-i", "pipe:0",
+			"-f", "s16le", "-ar", "8000", "-ac", "1",
+			"pipe:1",
+		)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			logrus.Errorf("Failed to start talkback decoder: %v", err)
+			return
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			logrus.Errorf("Failed to start talkback decoder: %v", err)
+			return
+		}
+		if err := ffmpeg.Start(cmd); err != nil {
+			logrus.Errorf("Failed to start talkback decoder: %v", err)
+			return
+		}
+		defer cmd.Wait()
+		// Cancelled before the decoder is waited for
+		defer cancel()
+		go func() {
+			io.Copy(stdin, ws)
+			stdin.Close()
+		}()
+		pcm = stdout
+	}
+
+	logrus.Infof("🎙️ Talkback from %s on SIP call %s", remote, callID)
+	defer logrus.Infof("Talkback from %s on SIP call %s ended", remote, callID)
+	if err := s.sip.Talk(ctx, callID, pcm); err != nil {
+		logrus.Warnf("Talkback from %s failed: %v", remote, err)
+		websocket.JSON.Send(ws, gin.H{"type": "error", "error": err.Error()})
+	}
+}
+
+// requireSIP writes the error response and returns false unless the SIP
+// agent is configured.
+func (s *Server) requireSIP(c *gin.Context) bool {
+	if s.sip == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "sip"})
+		return false
+	}
+	return s.flagEnabled(c, flags.SIP)
+}
+
+func respondSIPError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sip.ErrCallNotFound):
+		respondError(c, http.StatusNotFound, MsgNotFound, nil)
+	case errors.Is(err, sip.ErrNotRunning):
+		respondError(c, http.StatusServiceUnavailable, MsgUnavailable, nil)
+	case errors.Is(err, sip.ErrTargetNotAllowed):
+		respondErr(c, http.StatusForbidden, err)
+	case errors.Is(err, sip.ErrNoAudio):
+		respondError(c, http.StatusConflict, MsgNoAudio, nil)
+	case errors.Is(err, sip.ErrCallActive), errors.Is(err, sip.ErrNotRinging),
+		errors.Is(err, sip.ErrNotAnswered), errors.Is(err, sip.ErrTalkbackBusy):
+		respondErr(c, http.StatusConflict, err)
+	default:
+		// Such as a door station address that does not resolve
+		respondErr(c, http.StatusBadRequest, err)
+	}
+}
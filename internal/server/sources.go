@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+
+	"golang-webrtc-streaming/internal/source"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleRegisterSource adds a source at runtime and persists it across restarts.
+func (s *Server) handleRegisterSource(c *gin.Context) {
+	var req source.Registration
+	if err := c.ShouldBindJSON(&req); err != nil || req.Type == "" || req.URL == "" {
+		respondError(c, http.StatusBadRequest, MsgMissingFields, map[string]string{"fields": "type, url"})
+		return
+	}
+
+	if err := s.sourceManager.RegisterSource(req); err != nil {
+		respondErr(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"available": s.sourceManager.GetAvailableSources(),
+	})
+}
+
+func (s *Server) handleUnregisterSource(c *gin.Context) {
+	if err := s.sourceManager.UnregisterSource(c.Param("id")); err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+
+	"golang-webrtc-streaming/internal/health"
+	"golang-webrtc-streaming/internal/metadata"
+	"golang-webrtc-streaming/internal/source"
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type streamJSON struct {
+	source.StreamInfo
+	webrtcmanager.ViewerCount
+	RelayOnly bool               `json:"relay_only"`
+	Metadata  *metadata.Metadata `json:"metadata,omitempty"`
+	Health    *health.Report     `json:"health,omitempty"`
+}
+
+// handleListStreams describes every registered stream: the state of its
+// source, its outputs, viewers, metadata, and health.
+func (s *Server) handleListStreams(c *gin.Context) {
+	viewers := s.webrtcManager.ViewerCounts()
+
+	streams := make([]streamJSON, 0)
+	for _, info := range s.sourceManager.Streams() {
+		entry := streamJSON{
+			StreamInfo:  info,
+			ViewerCount: viewers[info.ID],
+			RelayOnly:   s.webrtcManager.RelayRequired(info.ID),
+		}
+		if md, ok := s.metadata.Get(info.ID); ok {
+			entry.Metadata = &md
+		}
+		if report, ok := s.healthMonitor.Report(info.ID); ok {
+			entry.Health = &report
+		}
+		streams = append(streams, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"streams": streams,
+		"active":  s.sourceManager.GetCurrentSource(),
+	})
+}
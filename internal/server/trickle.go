@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// candidateKeepalive is how often an idle candidate stream sends a comment,
+// so proxies do not time it out
+const candidateKeepalive = 15 * time.Second
+
+// handleCandidateEvents streams the ICE candidates of a peer whose offer
+// asked to trickle as Server-Sent Events: a "candidate" event for each,
+// then "end-of-candidates". It works through proxies that block WebSockets,
+// and a reconnecting EventSource continues after the Last-Event-ID it saw.
+func (s *Server) handleCandidateEvents(c *gin.Context) {
+	peerID, key := c.Query("peer_id"), c.Query("key")
+	sent, _ := strconv.Atoi(c.GetHeader("Last-Event-ID"))
+	candidates, done, changed, err := s.webrtcManager.LocalCandidates(peerID, key, sent)
+	if err != nil {
+		trickleError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	// Keeps nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w := c.Writer
+
+	keepalive := time.NewTicker(candidateKeepalive)
+	defer keepalive.Stop()
+	for {
+		for _, candidate := range candidates {
+			data, err := json.Marshal(candidate)
+			if err != nil {
+				return
+			}
+			sent++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: candidate\ndata: %s\n\n", sent, data); err != nil {
+				return
+			}
+		}
+		if done {
+			fmt.Fprintf(w, "event: end-of-candidates\ndata: {}\n\n")
+			w.Flush()
+			return
+		}
+		w.Flush()
+
+		select {
+		case <-changed:
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+		// Ends the stream once the peer is gone
+		candidates, done, changed, err = s.webrtcManager.LocalCandidates(peerID, key, sent)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handlePostCandidate adds an ICE candidate trickled by the client, given
+// as an RTCIceCandidateInit; an empty candidate ends them.
+func (s *Server) handlePostCandidate(c *gin.Context) {
+	var candidate webrtcmanager.ICECandidateInit
+	if err := c.ShouldBindJSON(&candidate); err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+
+	s.addCandidate(c, c.Param("id"), c.Query("key"), candidate)
+}
+
+// iceCandidateRequest is the body of /api/ice-candidate: a trickled
+// candidate with the session it belongs to.
+type iceCandidateRequest struct {
+	PeerID     string `json:"peer_id"`
+	TrickleKey string `json:"trickle_key"`
+	webrtcmanager.ICECandidateInit
+}
+
+// handleICECandidate adds a candidate like handlePostCandidate, naming the
+// session in the body rather than the path.
+func (s *Server) handleICECandidate(c *gin.Context) {
+	var req iceCandidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PeerID == "" {
+		respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+		return
+	}
+	s.addCandidate(c, req.PeerID, req.TrickleKey, req.ICECandidateInit)
+}
+
+// addCandidate adds a remote candidate of a trickling peer, authorized by
+// its trickle key.
+func (s *Server) addCandidate(c *gin.Context, peerID, key string, candidate webrtcmanager.ICECandidateInit) {
+	if _, ok := s.webrtcManager.GetPeer(peerID); !ok {
+		respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+		return
+	}
+	if err := s.webrtcManager.AddRemoteCandidate(peerID, key, candidate); err != nil {
+		if errors.Is(err, webrtcmanager.ErrTrickleKey) {
+			trickleError(c, err)
+			return
+		}
+		logrus.Warnf("Failed to add candidate of peer %s: %v", peerID, err)
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func trickleError(c *gin.Context, err error) {
+	if errors.Is(err, webrtcmanager.ErrTrickleKey) {
+		respondError(c, http.StatusForbidden, MsgInvalidTrickleKey, nil)
+		return
+	}
+	respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/flags"
+	"golang-webrtc-streaming/internal/source"
+	"golang-webrtc-streaming/internal/uplink"
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// errUplinkStream refuses a pushed stream whose name is taken or unusable.
+var errUplinkStream = errors.New("stream cannot be pushed")
+
+// acceptPushFunc answers the offer of a client pushing streams, opening the
+// track of each with open.
+type acceptPushFunc func(ctx context.Context, sdp, stream, remote string, open func(stream string) (webrtcmanager.UplinkTrack, error)) (string, *webrtcmanager.SessionDescription, error)
+
+// handleUplinkStatus reports the uplink of an edge instance to its central
+// instance.
+func (s *Server) handleUplinkStatus(c *gin.Context) {
+	if s.uplink == nil {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "uplink"})
+		return
+	}
+	c.JSON(http.StatusOK, s.uplink.Status())
+}
+
+// handleUplinkOffer answers an edge instance pushing streams, as a WHIP
+// endpoint: the body is the SDP offer and the answer comes back with the
+// session's URL in Location. Streams are named by the msid of their video
+// tracks, or by the path for a single-track push.
+func (s *Server) handleUplinkOffer(c *gin.Context) {
+	if !s.authorizeUplink(c) {
+		return
+	}
+	stream := strings.ToLower(c.Param("stream"))
+	// Relative, so the URL holds behind proxies that prefix the API path
+	location := "uplink/sessions/"
+	if stream != "" {
+		location = "sessions/"
+	}
+	s.answerPush(c, s.uplinkIngest, s.webrtcManager.AcceptUplink, stream, location)
+}
+
+// answerPush answers the SDP offer of a client pushing streams into ingest
+// with accept, adding streams pushed for the first time as sources. The
+// session's ID is appended to location.
+func (s *Server) answerPush(c *gin.Context, ingest *uplink.Ingest, accept acceptPushFunc, stream, location string) {
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != "application/sdp" {
+		respondError(c, http.StatusUnsupportedMediaType, MsgInvalidBody, nil)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, webrtcmanager.MaxOfferSDPBytes))
+	if err != nil {
+		respondError(c, http.StatusRequestEntityTooLarge, webrtcmanager.OfferTooLarge, nil)
+		return
+	}
+
+	id, answer, err := accept(c.Request.Context(), string(body), stream, c.ClientIP(), func(name string) (webrtcmanager.UplinkTrack, error) {
+		return ingest.Open(name, func(src *uplink.Source) error {
+			return s.addPushedSource(name, src)
+		})
+	})
+	var offerErr *webrtcmanager.OfferError
+	switch {
+	case errors.As(err, &offerErr):
+		body := errorBody(MessageCode(offerErr.Code), nil)
+		body["detail"] = offerErr.Message
+		c.JSON(http.StatusBadRequest, body)
+		return
+	case errors.Is(err, errUplinkStream):
+		respondErr(c, http.StatusConflict, err)
+		return
+	case respondDeadline(c, err):
+		return
+	case err != nil:
+		respondErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Location", location+id)
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer.SDP))
+}
+
+// addPushedSource makes a stream pushed for the first time available like
+// any other source. Names of configured streams cannot be pushed to.
+func (s *Server) addPushedSource(name string, src *uplink.Source) error {
+	if !source.ValidStreamName(name) {
+		return fmt.Errorf("%w: invalid stream name %q, use letters, digits, '-' and '_'", errUplinkStream, name)
+	}
+	for _, t := range source.Types() {
+		if t == name {
+			return fmt.Errorf("%w: stream %s already exists on this instance", errUplinkStream, name)
+		}
+	}
+	source.RegisterType(name, func(string) source.Source { return src })
+	if err := s.sourceManager.AddSource(name, src.URL()); err != nil {
+		return fmt.Errorf("%w: %v", errUplinkStream, err)
+	}
+	logrus.Infof("🔽 Added pushed stream %s (%s)", name, src.URL())
+	return nil
+}
+
+// handleListUplinkSessions lists the edge instances pushing streams here.
+func (s *Server) handleListUplinkSessions(c *gin.Context) {
+	if !s.uplinkIngest.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "uplink_ingest"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": s.webrtcManager.Uplinks()})
+}
+
+// handleDeleteUplinkSession ends an uplink session, as edge instances do
+// when they shut down.
+func (s *Server) handleDeleteUplinkSession(c *gin.Context) {
+	if !s.authorizeUplink(c) {
+		return
+	}
+	if err := s.webrtcManager.CloseUplink(c.Param("id")); err != nil {
+		respondError(c, http.StatusNotFound, MsgNotFound, nil)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// authorizeUplink writes the error response and returns false unless this
+// instance accepts uplinks and the request carries one of their tokens.
+func (s *Server) authorizeUplink(c *gin.Context) bool {
+	if !s.uplinkIngest.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "uplink_ingest"})
+		return false
+	}
+	if !s.flagEnabled(c, flags.UplinkIngest) {
+		return false
+	}
+	if !s.uplinkIngest.Authorized(c.GetHeader("Authorization")) {
+		c.Header("WWW-Authenticate", "Bearer")
+		respondError(c, http.StatusUnauthorized, MsgAccessDenied, nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleUpstreams reports the health of the RTSP restreamers sources fail
+// over between.
+func (s *Server) handleUpstreams(c *gin.Context) {
+	if s.upstreams == nil {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "rtsp_upstreams"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"upstreams": s.upstreams.Status()})
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// handleUsage reports the media sent to viewers per stream and tenant since
+// the accounting period began.
+func (s *Server) handleUsage(c *gin.Context) {
+	if s.usage == nil {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "usage"})
+		return
+	}
+	c.JSON(http.StatusOK, s.usage.Report())
+}
+
+// handleResetUsage closes the accounting period and returns its final
+// report, e.g. at the end of a billing cycle.
+func (s *Server) handleResetUsage(c *gin.Context) {
+	if s.usage == nil {
+		respondError(c, http.StatusNotFound, MsgFeatureUnavailable, map[string]string{"feature": "usage"})
+		return
+	}
+	report, err := s.usage.Reset()
+	if err != nil {
+		logrus.Errorf("Failed to persist usage reset: %v", err)
+		body := errorBody(MsgInternalError, nil)
+		body["report"] = report
+		c.JSON(http.StatusInternalServerError, body)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/recording"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleVODPlaylist serves a recording as an HLS VOD playlist. Seeking is
+// requested with ?offset=<seconds> or ?at=<RFC3339> and snapped to the
+// preceding keyframe using the recording index.
+func (s *Server) handleVODPlaylist(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "id"})
+		return
+	}
+
+	segments, err := s.recordingManager.Recording(id)
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+
+	startOffset := -1.0
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.ParseFloat(v, 64)
+		if err != nil || offset < 0 {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "offset"})
+			return
+		}
+		startOffset = recording.SeekOffset(segments, offset)
+	} else if v := c.Query("at"); v != "" {
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "at"})
+			return
+		}
+		startOffset = recording.SeekOffset(segments, at.Sub(segments[0].Start).Seconds())
+	}
+
+	playlist := recording.VODPlaylist(segments, startOffset, func(seg recording.Segment) string {
+		return fmt.Sprintf("segments/%d.ts", seg.ID)
+	})
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.String(http.StatusOK, playlist)
+}
+
+func (s *Server) handleVODSegment(c *gin.Context) {
+	segID, err := strconv.ParseInt(strings.TrimSuffix(c.Param("segment"), ".ts"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, MsgInvalidParameter, map[string]string{"parameter": "segment"})
+		return
+	}
+
+	seg, err := s.recordingManager.Segment(segID)
+	if err != nil {
+		respondErr(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.Header("Content-Type", "video/mp2t")
+	c.File(seg.Path)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// iceServerJSON has the shape of a browser RTCIceServer
+type iceServerJSON struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+type clientStreamJSON struct {
+	ID string `json:"id"`
+	// RelayOnly streams only accept TURN relay candidates
+	RelayOnly bool `json:"relay_only"`
+}
+
+// handleWebRTCConfig returns what a client needs to set up its peer
+// connection, so clients do not duplicate the server's configuration. With
+// a TURN secret, every response carries fresh credentials of its own.
+func (s *Server) handleWebRTCConfig(c *gin.Context) {
+	iceConfig := s.webrtcManager.ICEServers()
+	session := make([]byte, 8)
+	if _, err := rand.Read(session); err != nil {
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+
+	iceServers := make([]iceServerJSON, 0)
+	for _, server := range iceConfig.Servers(hex.EncodeToString(session)) {
+		credential, _ := server.Credential.(string)
+		iceServers = append(iceServers, iceServerJSON{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: credential,
+		})
+	}
+
+	streams := make([]clientStreamJSON, 0)
+	for _, id := range s.sourceManager.GetAvailableSources() {
+		streams = append(streams, clientStreamJSON{ID: id, RelayOnly: s.webrtcManager.RelayRequired(id)})
+	}
+
+	video, audio := s.webrtcManager.Codecs()
+	response := gin.H{
+		"ice_servers":    iceServers,
+		"codecs":         gin.H{"video": video, "audio": audio},
+		"streams":        streams,
+		"current_stream": s.sourceManager.GetCurrentSource(),
+	}
+	if fingerprint := s.webrtcManager.CertificateFingerprint(); fingerprint != "" {
+		response["dtls_fingerprint"] = fingerprint
+	}
+	if iceConfig.Ephemeral() {
+		response["ice_servers_expire_at"] = time.Now().Add(iceConfig.TURNCredentialTTL).UTC()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// sdpFragType is the media type of the SDP fragments WHEP clients PATCH to
+// trickle candidates and restart ICE
+const sdpFragType = "application/trickle-ice-sdpfrag"
+
+// whepSession is a viewer session created through WHEP. Its resource ID is
+// random, as the URL alone lets a client change and end the session.
+type whepSession struct {
+	peerID string
+	// etag identifies the ICE session: the ufrag of the server's answer
+	etag string
+	// ufrag is the client's, which changes when it restarts ICE
+	ufrag string
+}
+
+// handleWHEPOffer answers a WHEP player: the body is the SDP offer, and the
+// answer comes back with its candidates and the session's URL in Location.
+// Players watch the stream named by the stream query parameter, or follow
+// the active source without one, authorized by their bearer token like the
+// viewers of /api/offer.
+func (s *Server) handleWHEPOffer(c *gin.Context) {
+	receivedAt := time.Now()
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != "application/sdp" {
+		respondError(c, http.StatusUnsupportedMediaType, MsgInvalidBody, nil)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, webrtcmanager.MaxOfferSDPBytes))
+	if err != nil {
+		respondError(c, http.StatusRequestEntityTooLarge, webrtcmanager.OfferTooLarge, nil)
+		return
+	}
+	offer := webrtcmanager.NewOffer(string(body))
+	if err := webrtcmanager.ValidateOffer(offer); err != nil {
+		var offerErr *webrtcmanager.OfferError
+		if errors.As(err, &offerErr) {
+			body := errorBody(MessageCode(offerErr.Code), nil)
+			body["detail"] = offerErr.Message
+			c.JSON(http.StatusBadRequest, body)
+			return
+		}
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	stream, pinned, ok := s.offerStream(c, c.Query("stream"))
+	if !ok {
+		return
+	}
+	decision, ok := s.authorizeSession(c, stream, "whep")
+	if !ok {
+		return
+	}
+	resourceID, err := newWHEPResourceID()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		return
+	}
+
+	peerID := webrtcmanager.NewPeerID("whep")
+	_, err = s.webrtcManager.CreatePeerWithOptions(peerID, webrtcmanager.PeerOptions{
+		Stream:          stream,
+		Pinned:          pinned,
+		RelayOnly:       s.webrtcManager.RelayRequired(stream),
+		Tags:            decision.Tags,
+		MaxBitrateKbps:  decision.MaxBitrateKbps,
+		OfferReceivedAt: receivedAt,
+		RemoteIP:        c.ClientIP(),
+	})
+	if err != nil {
+		respondPeerError(c, err)
+		return
+	}
+
+	// The answer carries all candidates, as the server cannot trickle its
+	// own to a WHEP client
+	answer, err := s.webrtcManager.HandleOffer(c.Request.Context(), peerID, offer)
+	if err != nil {
+		logrus.Errorf("Failed to handle WHEP offer: %v", err)
+		s.webrtcManager.RemovePeer(peerID)
+		if !respondDeadline(c, err) {
+			respondError(c, http.StatusInternalServerError, MsgInternalError, nil)
+		}
+		return
+	}
+
+	session := &whepSession{
+		peerID: peerID,
+		etag:   sdpAttribute(answer.SDP, "ice-ufrag"),
+		ufrag:  sdpAttribute(offer.SDP, "ice-ufrag"),
+	}
+	s.addWHEPSession(resourceID, session)
+	logrus.Infof("WHEP player %s watching %s as %s", c.ClientIP(), stream, peerID)
+
+	for _, server := range s.webrtcManager.ICEServers().Servers(peerID) {
+		c.Writer.Header().Add("Link", iceServerLinks(server.URLs, server.Username, server.Credential))
+	}
+	// Relative, so the URL holds behind proxies that prefix the path
+	c.Header("Location", "whep/sessions/"+resourceID)
+	c.Header("ETag", quoteETag(session.etag))
+	c.Header("Accept-Patch", sdpFragType)
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer.SDP))
+}
+
+// handleWHEPPatch takes the SDP fragment of a WHEP player: candidates it
+// trickles to its session, or new ICE credentials to restart ICE, which are
+// answered with the server's.
+func (s *Server) handleWHEPPatch(c *gin.Context) {
+	resourceID := c.Param("id")
+	session, ok := s.lookupWHEPSession(resourceID)
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != sdpFragType {
+		respondError(c, http.StatusUnsupportedMediaType, MsgInvalidBody, nil)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, webrtcmanager.MaxOfferSDPBytes))
+	if err != nil {
+		respondError(c, http.StatusRequestEntityTooLarge, MsgInvalidBody, nil)
+		return
+	}
+	frag := parseSDPFragment(string(body))
+
+	restart := frag.ufrag != "" && frag.ufrag != session.ufrag
+	if match := c.GetHeader("If-Match"); match != "" && match != "*" && match != quoteETag(session.etag) {
+		respondError(c, http.StatusPreconditionFailed, MsgInvalidParameter, map[string]string{"parameter": "If-Match"})
+		return
+	}
+
+	if restart {
+		if frag.pwd == "" {
+			respondError(c, http.StatusBadRequest, MsgInvalidBody, nil)
+			return
+		}
+		answer, err := s.webrtcManager.RestartICECredentials(c.Request.Context(), session.peerID, frag.ufrag, frag.pwd)
+		if err != nil {
+			logrus.Errorf("Failed to restart ICE of WHEP session %s: %v", session.peerID, err)
+			if !respondDeadline(c, err) {
+				respondErr(c, http.StatusConflict, err)
+			}
+			return
+		}
+		etag := sdpAttribute(answer.SDP, "ice-ufrag")
+		s.restartWHEPSession(resourceID, frag.ufrag, etag)
+		c.Header("ETag", quoteETag(etag))
+		c.Data(http.StatusOK, sdpFragType, []byte(sdpFragment(answer.SDP)))
+		return
+	}
+
+	for _, candidate := range frag.candidates {
+		if err := s.webrtcManager.AddICECandidate(session.peerID, candidate); err != nil {
+			logrus.Warnf("Failed to add candidate of WHEP session %s: %v", session.peerID, err)
+			respondErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleWHEPDelete ends a WHEP session, as players do when they stop.
+func (s *Server) handleWHEPDelete(c *gin.Context) {
+	session, ok := s.lookupWHEPSession(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, MsgPeerNotFound, nil)
+		return
+	}
+	s.whepMu.Lock()
+	delete(s.whepSessions, c.Param("id"))
+	s.whepMu.Unlock()
+	s.webrtcManager.RemovePeer(session.peerID)
+	c.Status(http.StatusOK)
+}
+
+// addWHEPSession records a session, forgetting those whose peer is gone.
+func (s *Server) addWHEPSession(resourceID string, session *whepSession) {
+	s.whepMu.Lock()
+	defer s.whepMu.Unlock()
+	if s.whepSessions == nil {
+		s.whepSessions = make(map[string]*whepSession)
+	}
+	for id, other := range s.whepSessions {
+		if _, ok := s.webrtcManager.GetPeer(other.peerID); !ok {
+			delete(s.whepSessions, id)
+		}
+	}
+	s.whepSessions[resourceID] = session
+}
+
+// lookupWHEPSession returns a copy of a session whose peer still exists.
+func (s *Server) lookupWHEPSession(resourceID string) (whepSession, bool) {
+	s.whepMu.Lock()
+	defer s.whepMu.Unlock()
+	session, ok := s.whepSessions[resourceID]
+	if !ok {
+		return whepSession{}, false
+	}
+	if _, ok := s.webrtcManager.GetPeer(session.peerID); !ok {
+		delete(s.whepSessions, resourceID)
+		return whepSession{}, false
+	}
+	return *session, true
+}
+
+// restartWHEPSession records the ICE credentials of a restarted session.
+func (s *Server) restartWHEPSession(resourceID, ufrag, etag string) {
+	s.whepMu.Lock()
+	defer s.whepMu.Unlock()
+	if session, ok := s.whepSessions[resourceID]; ok {
+		session.ufrag = ufrag
+		session.etag = etag
+	}
+}
+
+func newWHEPResourceID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func quoteETag(tag string) string {
+	return `"` + tag + `"`
+}
+
+// iceServerLinks formats an ICE server as Link header values, one per URL.
+func iceServerLinks(urls []string, username string, credential interface{}) string {
+	links := make([]string, 0, len(urls))
+	for _, url := range urls {
+		link := fmt.Sprintf(`<%s>; rel="ice-server"`, url)
+		if password, ok := credential.(string); ok && username != "" {
+			link += fmt.Sprintf(`; username=%q; credential=%q; credential-type="password"`, username, password)
+		}
+		links = append(links, link)
+	}
+	return strings.Join(links, ", ")
+}
+
+// sdpFragmentRequest is what a client's SDP fragment carries.
+type sdpFragmentRequest struct {
+	ufrag      string
+	pwd        string
+	candidates []webrtcmanager.ICECandidateInit
+}
+
+// parseSDPFragment reads the ICE credentials and the candidates of each
+// media section of an SDP fragment; end-of-candidates becomes an empty
+// candidate.
+func parseSDPFragment(frag string) sdpFragmentRequest {
+	var req sdpFragmentRequest
+	var mid string
+	for _, line := range strings.Split(frag, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			mid = ""
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			req.ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			req.pwd = strings.TrimPrefix(line, "a=ice-pwd:")
+		case strings.HasPrefix(line, "a=candidate:"), line == "a=end-of-candidates":
+			candidate := webrtcmanager.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a=")}
+			if line == "a=end-of-candidates" {
+				candidate.Candidate = ""
+			}
+			if mid != "" {
+				sectionMid := mid
+				candidate.SDPMid = &sectionMid
+			}
+			req.candidates = append(req.candidates, candidate)
+		}
+	}
+	return req
+}
+
+// sdpFragment returns the ICE credentials and candidates of an answer, as
+// the SDP fragment answering an ICE restart.
+func sdpFragment(sdp string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range []string{"a=ice-lite", "a=ice-ufrag:", "a=ice-pwd:", "m=", "a=mid:", "a=candidate:", "a=end-of-candidates"} {
+			if strings.HasPrefix(line, prefix) {
+				b.WriteString(line + "\r\n")
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// sdpAttribute returns the value of the first attribute of an SDP with the
+// given name.
+func sdpAttribute(sdp, name string) string {
+	for _, line := range strings.Split(sdp, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "a="+name+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
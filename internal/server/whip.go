@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/flags"
+)
+
+// defaultWHIPStream names the stream of publishers posting to /whip
+const defaultWHIPStream = "whip"
+
+// handleWHIPOffer answers a WHIP publisher, such as a browser or a hardware
+// encoder: the body is the SDP offer of its stream, named by the path or
+// "whip", and the answer comes back with the session's URL in Location.
+func (s *Server) handleWHIPOffer(c *gin.Context) {
+	if !s.authorizeWHIP(c) {
+		return
+	}
+	stream := strings.ToLower(c.Param("stream"))
+	// Relative, so the URL holds behind proxies that prefix the path
+	location := "sessions/"
+	if stream == "" {
+		stream = defaultWHIPStream
+		location = "whip/sessions/"
+	}
+	s.answerPush(c, s.whipIngest, s.webrtcManager.AcceptWHIP, stream, location)
+}
+
+// handleWHIPPatch refuses trickled candidates and ICE restarts, which WHIP
+// publishers may not use here; the answer carries all of the server's
+// candidates.
+func (s *Server) handleWHIPPatch(c *gin.Context) {
+	c.Header("Allow", "DELETE")
+	respondError(c, http.StatusMethodNotAllowed, MsgFeatureUnavailable, map[string]string{"feature": "trickle"})
+}
+
+// handleWHIPDelete ends a WHIP session, as publishers do when they stop.
+func (s *Server) handleWHIPDelete(c *gin.Context) {
+	if !s.authorizeWHIP(c) {
+		return
+	}
+	id := c.Param("id")
+	for _, session := range s.webrtcManager.WHIPSessions() {
+		if session.ID == id {
+			if err := s.webrtcManager.CloseUplink(id); err == nil {
+				c.Status(http.StatusOK)
+				return
+			}
+			break
+		}
+	}
+	respondError(c, http.StatusNotFound, MsgNotFound, nil)
+}
+
+// handleListWHIPSessions lists the WHIP publishers pushing streams here.
+func (s *Server) handleListWHIPSessions(c *gin.Context) {
+	if !s.whipIngest.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "whip"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": s.webrtcManager.WHIPSessions()})
+}
+
+// authorizeWHIP writes the error response and returns false unless this
+// instance accepts WHIP publishers and the request carries one of their
+// tokens.
+func (s *Server) authorizeWHIP(c *gin.Context) bool {
+	if !s.whipIngest.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, MsgFeatureUnavailable, map[string]string{"feature": "whip"})
+		return false
+	}
+	if !s.flagEnabled(c, flags.WHIPIngest) {
+		return false
+	}
+	if !s.whipIngest.Authorized(c.GetHeader("Authorization")) {
+		logrus.Warnf("Refused WHIP request from %s", c.ClientIP())
+		c.Header("WWW-Authenticate", "Bearer")
+		respondError(c, http.StatusUnauthorized, MsgAccessDenied, nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,559 @@
+// Package sip integrates SIP door stations and intercoms without a PBX in
+// between: a small user agent registers with a SIP server or takes calls
+// directly, bridges the door station's H.264 video into a stream and its
+// G.711 audio to listeners, and sends talkback from browsers back to it.
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+const (
+	userAgent = "golang-webrtc-streaming"
+	allow     = "INVITE, ACK, BYE, CANCEL, OPTIONS, INFO"
+
+	// t1 and t2 are the retransmission timers of RFC 3261 over UDP
+	t1                 = 500 * time.Millisecond
+	t2                 = 4 * time.Second
+	transactionTimeout = 64 * t1
+	// registerRetry is how long to wait after a failed registration
+	registerRetry = 30 * time.Second
+	// shutdownTimeout bounds hanging up and unregistering on shutdown
+	shutdownTimeout = 2 * time.Second
+	maxMessage      = 65535
+)
+
+var (
+	ErrNotRunning   = errors.New("SIP agent is not running")
+	ErrCallActive   = errors.New("a call is already in progress")
+	ErrCallNotFound = errors.New("call not found")
+	ErrNotRinging   = errors.New("call is not ringing")
+	ErrNotAnswered  = errors.New("call is not answered")
+	ErrNoAudio      = errors.New("call has no audio")
+	// ErrTargetNotAllowed refuses calls to anyone but known door stations
+	ErrTargetNotAllowed = errors.New("call target is not allowed")
+)
+
+// Config sets how the agent reaches and is reached by door stations.
+type Config struct {
+	// Listen is the UDP address SIP is received on, e.g. ":5060"
+	Listen string
+	// PublicIP is advertised in SIP and SDP; detected when empty
+	PublicIP string
+	// Server is the registrar and outbound proxy, as host[:port]; empty
+	// takes calls directly from door stations without registering
+	Server         string
+	User           string
+	Password       string
+	Domain         string
+	RegisterExpiry time.Duration
+	// AutoAnswer answers incoming calls at once; otherwise they ring until
+	// answered through the API
+	AutoAnswer bool
+	// RingTimeout ends calls that are not answered in time
+	RingTimeout time.Duration
+	// AllowedCallers are the SIP users, user@host addresses, hosts, or IP
+	// addresses calls are taken from; empty takes calls from anyone
+	AllowedCallers []string
+	// DialTargets are further SIP users, user@host addresses, hosts, or IP
+	// addresses calls may be made to, besides AllowedCallers; calls to
+	// anyone else are refused
+	DialTargets []string
+	// Stream names the stream calls are bridged into
+	Stream string
+	// Enabled, if set, refuses new calls while it returns false
+	Enabled func() bool
+}
+
+// Status describes the agent and its calls.
+type Status struct {
+	Contact       string     `json:"contact"`
+	Server        string     `json:"server,omitempty"`
+	Registered    bool       `json:"registered"`
+	RegisteredAt  *time.Time `json:"registered_at,omitempty"`
+	RegisterError string     `json:"register_error,omitempty"`
+	Stream        string     `json:"stream"`
+	AutoAnswer    bool       `json:"auto_answer"`
+	Call          *CallInfo  `json:"call,omitempty"`
+	Recent        []CallInfo `json:"recent"`
+}
+
+// Agent is a SIP user agent handling one call at a time, which is what a
+// door station makes.
+type Agent struct {
+	cfg    Config
+	source *Source
+	events *events.Bus
+
+	ctx  context.Context
+	conn net.PacketConn
+	// ip and port are advertised in SIP and SDP
+	ip   string
+	port int
+	// transactions routes responses by branch and method to the requests
+	// waiting for them
+	transactions map[string]chan *message
+
+	regCallID    string
+	regTag       string
+	regCSeq      uint32
+	registered   bool
+	registeredAt time.Time
+	registerErr  string
+
+	call    *call
+	refused lastFinal
+	history []CallInfo
+	// pending tracks the requests sent in the background, such as BYEs
+	pending sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// New returns an agent bridging calls into src.
+func New(cfg Config, src *Source) *Agent {
+	return &Agent{
+		cfg:          cfg,
+		source:       src,
+		transactions: make(map[string]chan *message),
+		regTag:       randomHex(6),
+	}
+}
+
+// SetEvents publishes calls ringing, starting, and ending on bus.
+func (a *Agent) SetEvents(bus *events.Bus) {
+	a.events = bus
+}
+
+// Run takes and makes calls until ctx is done, registering with the
+// server if one is configured.
+func (a *Agent) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", a.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", a.cfg.Listen, err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr)
+	ip := a.cfg.PublicIP
+	if ip == "" && !local.IP.IsUnspecified() {
+		ip = local.IP.String()
+	}
+	if ip == "" {
+		ip = outboundIP(a.cfg.Server)
+	}
+
+	a.mu.Lock()
+	a.ctx, a.conn, a.ip, a.port = ctx, conn, ip, local.Port
+	a.regCallID = randomHex(12) + "@" + ip
+	a.mu.Unlock()
+	logrus.Infof("📞 SIP agent listening on %s as %s", a.cfg.Listen, a.contactURI())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.serve(conn)
+	}()
+	if a.cfg.Server != "" {
+		go a.registerLoop(ctx)
+	}
+
+	<-ctx.Done()
+	a.mu.Lock()
+	if c := a.call; c != nil {
+		a.hangupLocked(c, "shutdown")
+	}
+	a.mu.Unlock()
+	// The call's BYE and the unregistration get a moment to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if a.cfg.Server != "" {
+		a.register(shutdownCtx, 0)
+	}
+	pending := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		close(pending)
+	}()
+	select {
+	case <-pending:
+	case <-shutdownCtx.Done():
+	}
+	conn.Close()
+	<-done
+	return nil
+}
+
+// outboundIP returns the local address the server, or any remote host, is
+// reached from.
+func outboundIP(server string) string {
+	target := "192.0.2.1:5060"
+	if server != "" {
+		target = uriHostPort(server)
+	}
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+func (a *Agent) hostPort() string {
+	return net.JoinHostPort(a.ip, strconv.Itoa(a.port))
+}
+
+func (a *Agent) user() string {
+	if a.cfg.User != "" {
+		return a.cfg.User
+	}
+	return a.cfg.Stream
+}
+
+func (a *Agent) domain() string {
+	switch {
+	case a.cfg.Domain != "":
+		return a.cfg.Domain
+	case a.cfg.Server != "":
+		host, _, _ := net.SplitHostPort(uriHostPort(a.cfg.Server))
+		return host
+	}
+	return a.ip
+}
+
+// aor is the address of record others call the agent at.
+func (a *Agent) aor() string {
+	return "sip:" + a.user() + "@" + a.domain()
+}
+
+func (a *Agent) contactURI() string {
+	return "sip:" + a.user() + "@" + a.hostPort()
+}
+
+// serve handles the messages received on conn until it is closed.
+func (a *Agent) serve(conn net.PacketConn) {
+	buf := make([]byte, maxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.Errorf("SIP agent stopped receiving: %v", err)
+			}
+			return
+		}
+		// Keep-alives of door stations are a bare CRLF
+		if strings.TrimSpace(string(buf[:n])) == "" {
+			continue
+		}
+		msg, err := parseMessage(buf[:n])
+		if err != nil {
+			logrus.Debugf("Ignoring SIP message from %s: %v", addr, err)
+			continue
+		}
+		if msg.isRequest() {
+			a.handleRequest(msg, addr)
+		} else {
+			a.handleResponse(msg)
+		}
+	}
+}
+
+func (a *Agent) send(msg *message, addr net.Addr) {
+	if _, err := a.conn.WriteTo(msg.bytes(), addr); err != nil {
+		logrus.Warnf("Failed to send SIP message to %s: %v", addr, err)
+	}
+}
+
+// respond answers a request with a response carrying only the headers
+// that identify it.
+func (a *Agent) respond(req *message, addr net.Addr, code int, reason, toTag string) {
+	resp := req.response(code, reason, toTag)
+	resp.add("User-Agent", userAgent)
+	a.send(resp, addr)
+}
+
+// resolve returns where a request outside of a call goes: the server if
+// one is configured, or the host of its URI.
+func (a *Agent) resolve(uri string) (net.Addr, error) {
+	target := uriHostPort(uri)
+	if a.cfg.Server != "" {
+		target = uriHostPort(a.cfg.Server)
+	}
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", target, err)
+	}
+	return addr, nil
+}
+
+// newRequest returns a request in a new transaction.
+func (a *Agent) newRequest(method, uri, callID, from, to string, cseq uint32) *message {
+	req := &message{method: method, requestURI: uri}
+	req.add("Via", fmt.Sprintf("SIP/2.0/UDP %s;branch=%s;rport", a.hostPort(), newBranch()))
+	req.add("Max-Forwards", "70")
+	req.add("From", from)
+	req.add("To", to)
+	req.add("Call-ID", callID)
+	req.add("CSeq", fmt.Sprintf("%d %s", cseq, method))
+	req.add("Contact", "<"+a.contactURI()+">")
+	req.add("User-Agent", userAgent)
+	return req
+}
+
+func newBranch() string {
+	// The magic cookie marks branches unique per transaction (RFC 3261)
+	return "z9hG4bK" + randomHex(8)
+}
+
+func transactionKey(branch, method string) string {
+	return branch + " " + method
+}
+
+// handleResponse hands a response to the request waiting for it. A 2xx
+// to an INVITE that is no longer waited for is a retransmission, which the
+// ACK is sent again for.
+func (a *Agent) handleResponse(resp *message) {
+	_, method := resp.cseq()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if ch, ok := a.transactions[transactionKey(resp.branch(), method)]; ok {
+		select {
+		case ch <- resp:
+		default:
+		}
+		return
+	}
+	c := a.call
+	if method == "INVITE" && resp.statusCode/100 == 2 && c != nil && c.ack != nil && c.callID == resp.get("Call-ID") {
+		a.send(c.ack, c.addr)
+	}
+}
+
+// request sends a request and returns its final response, retransmitting
+// it until a response comes. Provisional responses go to onProvisional;
+// after one, an INVITE waits for its final response until ctx is done. A
+// non-2xx final response to an INVITE is acknowledged.
+func (a *Agent) request(ctx context.Context, req *message, addr net.Addr, onProvisional func(*message)) (*message, error) {
+	key := transactionKey(req.branch(), req.method)
+	ch := make(chan *message, 8)
+	a.mu.Lock()
+	if a.conn == nil {
+		a.mu.Unlock()
+		return nil, ErrNotRunning
+	}
+	a.transactions[key] = ch
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.transactions, key)
+		a.mu.Unlock()
+	}()
+
+	a.send(req, addr)
+	interval := t1
+	retransmit := time.NewTimer(interval)
+	defer retransmit.Stop()
+	timeout := time.NewTimer(transactionTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, fmt.Errorf("%s to %s timed out", req.method, addr)
+		case <-retransmit.C:
+			a.send(req, addr)
+			if interval *= 2; interval > t2 && req.method != "INVITE" {
+				interval = t2
+			}
+			retransmit.Reset(interval)
+		case resp := <-ch:
+			if resp.statusCode < 200 {
+				if onProvisional != nil {
+					onProvisional(resp)
+				}
+				if req.method == "INVITE" {
+					retransmit.Stop()
+					timeout.Stop()
+				}
+				continue
+			}
+			if req.method == "INVITE" && resp.statusCode >= 300 {
+				a.send(inviteTransactionRequest(req, "ACK", resp.get("To")), addr)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// inviteTransactionRequest returns an ACK or a CANCEL in the transaction
+// of an INVITE, which answers a non-2xx response or ends the INVITE before
+// it is answered.
+func inviteTransactionRequest(invite *message, method, to string) *message {
+	req := &message{method: method, requestURI: invite.requestURI}
+	req.add("Via", invite.getAll("Via")[0])
+	req.add("Max-Forwards", "70")
+	req.add("From", invite.get("From"))
+	req.add("To", to)
+	req.add("Call-ID", invite.get("Call-ID"))
+	num, _ := invite.cseq()
+	req.add("CSeq", fmt.Sprintf("%d %s", num, method))
+	for _, route := range invite.getAll("Route") {
+		req.add("Route", route)
+	}
+	req.add("User-Agent", userAgent)
+	return req
+}
+
+// authenticated sends a request, answering a digest challenge with the
+// configured credentials once. The request is updated in place for the
+// retry, under the agent's lock, so a CANCEL can follow its transaction.
+func (a *Agent) authenticated(ctx context.Context, req *message, addr net.Addr, onProvisional func(*message)) (*message, error) {
+	resp, err := a.request(ctx, req, addr, onProvisional)
+	if err != nil || (resp.statusCode != 401 && resp.statusCode != 407) || a.cfg.Password == "" {
+		return resp, err
+	}
+	challengeHeader, authHeader := "WWW-Authenticate", "Authorization"
+	if resp.statusCode == 407 {
+		challengeHeader, authHeader = "Proxy-Authenticate", "Proxy-Authorization"
+	}
+	challenge, err := parseChallenge(resp.get(challengeHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate %s: %w", req.method, err)
+	}
+
+	a.mu.Lock()
+	num, method := req.cseq()
+	req.set(authHeader, challenge.authorization(a.user(), a.cfg.Password, req.method, req.requestURI))
+	req.set("CSeq", fmt.Sprintf("%d %s", num+1, method))
+	// The retry is a new transaction
+	for i, h := range req.headers {
+		if strings.EqualFold(h.name, "Via") {
+			req.headers[i].value = strings.Replace(h.value, req.branch(), newBranch(), 1)
+			break
+		}
+	}
+	a.mu.Unlock()
+
+	return a.request(ctx, req, addr, onProvisional)
+}
+
+// registerLoop keeps the agent registered with the server until ctx is
+// done, refreshing halfway through each registration.
+func (a *Agent) registerLoop(ctx context.Context) {
+	expiry := int(a.cfg.RegisterExpiry / time.Second)
+	for {
+		granted, err := a.register(ctx, expiry)
+		wait := time.Duration(granted) * time.Second / 2
+		a.mu.Lock()
+		if err != nil {
+			if ctx.Err() != nil {
+				a.mu.Unlock()
+				return
+			}
+			if a.registered || a.registerErr == "" {
+				logrus.Warnf("Failed to register with SIP server %s: %v", a.cfg.Server, err)
+			}
+			a.registered, a.registerErr = false, err.Error()
+			wait = registerRetry
+		} else {
+			if !a.registered {
+				logrus.Infof("📞 Registered with SIP server %s as %s", a.cfg.Server, a.aor())
+			}
+			a.registered, a.registeredAt, a.registerErr = true, time.Now(), ""
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// register binds the agent's contact to its address of record for expiry
+// seconds, or removes the binding with 0, and returns the seconds granted.
+func (a *Agent) register(ctx context.Context, expiry int) (int, error) {
+	a.mu.Lock()
+	a.regCSeq++
+	aor := "<" + a.aor() + ">"
+	req := a.newRequest("REGISTER", "sip:"+a.domain(), a.regCallID, aor+";tag="+a.regTag, aor, a.regCSeq)
+	a.mu.Unlock()
+	req.set("Expires", strconv.Itoa(expiry))
+	addr, err := a.resolve(a.cfg.Server)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := a.authenticated(ctx, req, addr, nil)
+	if err != nil {
+		return 0, err
+	}
+	// The retry with credentials took the next sequence number
+	num, _ := req.cseq()
+	a.mu.Lock()
+	if num > a.regCSeq {
+		a.regCSeq = num
+	}
+	a.mu.Unlock()
+	if resp.statusCode/100 != 2 {
+		return 0, fmt.Errorf("server answered %d %s", resp.statusCode, resp.reason)
+	}
+
+	granted := expiry
+	if value, err := strconv.Atoi(resp.get("Expires")); err == nil {
+		granted = value
+	}
+	for _, contact := range resp.getAll("Contact") {
+		if headerURI(contact) != a.contactURI() {
+			continue
+		}
+		if value, err := strconv.Atoi(headerParam(contact, "expires")); err == nil {
+			granted = value
+		}
+	}
+	if granted <= 0 && expiry > 0 {
+		granted = expiry
+	}
+	return granted, nil
+}
+
+// Stream names the stream calls are bridged into.
+func (a *Agent) Stream() string {
+	return a.cfg.Stream
+}
+
+// Status describes the agent's registration and calls.
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := Status{
+		Server:        a.cfg.Server,
+		Registered:    a.registered,
+		RegisterError: a.registerErr,
+		Stream:        a.cfg.Stream,
+		AutoAnswer:    a.cfg.AutoAnswer,
+		Recent:        append([]CallInfo{}, a.history...),
+	}
+	if a.conn != nil {
+		status.Contact = a.contactURI()
+	}
+	if a.registered {
+		registeredAt := a.registeredAt
+		status.RegisteredAt = &registeredAt
+	}
+	if a.call != nil {
+		info := a.call.info()
+		status.Call = &info
+	}
+	return status
+}
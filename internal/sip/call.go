@@ -0,0 +1,743 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+const (
+	stateCalling = "calling"
+	stateRinging = "ringing"
+	stateActive  = "active"
+	stateEnded   = "ended"
+
+	directionInbound  = "inbound"
+	directionOutbound = "outbound"
+
+	defaultRingTimeout = 60 * time.Second
+	// keyframeInterval limits how often the door station is asked for a
+	// keyframe
+	keyframeInterval = 2 * time.Second
+	// historySize is how many ended calls are listed
+	historySize = 20
+
+	// pictureFastUpdate asks for a keyframe over SIP INFO (RFC 5168), which
+	// door stations support more widely than RTCP feedback
+	pictureFastUpdate = `<?xml version="1.0" encoding="utf-8" ?>` +
+		`<media_control><vc_primitive><to_encoder><picture_fast_update/></to_encoder></vc_primitive></media_control>`
+)
+
+// CallInfo describes a call.
+type CallInfo struct {
+	ID              string     `json:"id"`
+	Direction       string     `json:"direction"`
+	Remote          string     `json:"remote"`
+	State           string     `json:"state"`
+	AudioCodec      string     `json:"audio_codec,omitempty"`
+	Video           bool       `json:"video"`
+	StartedAt       time.Time  `json:"started_at"`
+	AnsweredAt      *time.Time `json:"answered_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	EndReason       string     `json:"end_reason,omitempty"`
+	VideoPackets    uint64     `json:"video_packets"`
+	AudioPackets    uint64     `json:"audio_packets"`
+	TalkbackPackets uint64     `json:"talkback_packets"`
+}
+
+// call is a call with a door station and the dialog it is in.
+type call struct {
+	id        string
+	direction string
+	state     string
+	remoteURI string
+	startedAt time.Time
+	// answeredAt and endedAt are zero until the call is answered and ends
+	answeredAt time.Time
+	endedAt    time.Time
+	endReason  string
+
+	callID   string
+	localTag string
+	// local and remote are the From and To of requests in the dialog
+	local        string
+	remote       string
+	remoteTarget string
+	routes       []string
+	cseq         uint32
+	// addr is where requests and responses of the call go
+	addr net.Addr
+
+	invite *message
+	// answer is the 200 to an incoming INVITE, sent until it is
+	// acknowledged
+	answer *message
+	acked  bool
+	// ack acknowledges the 200 to an outgoing INVITE, again for each
+	// retransmission of the 200
+	ack *message
+	// offer is the media an incoming INVITE offered
+	offer        []sdpMedia
+	neg          negotiation
+	media        *callMedia
+	ringTimer    *time.Timer
+	lastKeyframe time.Time
+}
+
+func (c *call) info() CallInfo {
+	info := CallInfo{
+		ID:              c.id,
+		Direction:       c.direction,
+		Remote:          c.remoteURI,
+		State:           c.state,
+		AudioCodec:      c.neg.codec(),
+		Video:           c.neg.hasVideo(),
+		StartedAt:       c.startedAt,
+		EndReason:       c.endReason,
+		VideoPackets:    c.media.videoPackets.Load(),
+		AudioPackets:    c.media.audioPackets.Load(),
+		TalkbackPackets: c.media.talkPackets.Load(),
+	}
+	if !c.answeredAt.IsZero() {
+		answeredAt := c.answeredAt
+		info.AnsweredAt = &answeredAt
+	}
+	if !c.endedAt.IsZero() {
+		endedAt := c.endedAt
+		info.EndedAt = &endedAt
+	}
+	return info
+}
+
+// lastFinal is the final response to the last INVITE refused, sent again
+// when the INVITE is retransmitted.
+type lastFinal struct {
+	callID string
+	resp   *message
+}
+
+func (a *Agent) handleRequest(req *message, addr net.Addr) {
+	switch req.method {
+	case "INVITE":
+		a.handleInvite(req, addr)
+	case "ACK":
+		a.handleACK(req)
+	case "BYE":
+		a.handleBye(req, addr)
+	case "CANCEL":
+		a.handleCancel(req, addr)
+	case "OPTIONS":
+		resp := req.response(200, "OK", randomHex(6))
+		resp.add("Allow", allow)
+		resp.add("Accept", "application/sdp")
+		resp.add("User-Agent", userAgent)
+		a.send(resp, addr)
+	case "INFO":
+		// Door stations send DTMF and keyframe requests, which need no action
+		a.mu.Lock()
+		inCall := a.call != nil && a.call.callID == req.get("Call-ID")
+		a.mu.Unlock()
+		if inCall {
+			a.respond(req, addr, 200, "OK", "")
+		} else {
+			a.respond(req, addr, 481, "Call/Transaction Does Not Exist", "")
+		}
+	default:
+		resp := req.response(501, "Not Implemented", "")
+		resp.add("Allow", allow)
+		resp.add("User-Agent", userAgent)
+		a.send(resp, addr)
+	}
+}
+
+// handleInvite takes an incoming call, answering it at once or ringing
+// until it is answered through the API, or refuses it.
+func (a *Agent) handleInvite(req *message, addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	callID := req.get("Call-ID")
+	inDialog := headerParam(req.get("To"), "tag") != ""
+	if c := a.call; c != nil && c.callID == callID {
+		switch {
+		case inDialog:
+			a.handleReinviteLocked(c, req, addr)
+		case c.answer != nil:
+			a.send(c.answer, addr)
+		case c.state == stateRinging:
+			a.respond(req, addr, 180, "Ringing", c.localTag)
+		}
+		return
+	}
+	if a.refused.callID == callID && !inDialog {
+		a.send(a.refused.resp, addr)
+		return
+	}
+	if inDialog {
+		a.respond(req, addr, 481, "Call/Transaction Does Not Exist", "")
+		return
+	}
+
+	from := req.get("From")
+	if a.cfg.Enabled != nil && !a.cfg.Enabled() {
+		a.refuseLocked(req, addr, 480, "Temporarily Unavailable")
+		return
+	}
+	if !a.allowed(from, addr) {
+		logrus.Warnf("Refused SIP call from %s at %s", headerURI(from), addr)
+		a.refuseLocked(req, addr, 403, "Forbidden")
+		return
+	}
+	if a.call != nil {
+		a.refuseLocked(req, addr, 486, "Busy Here")
+		return
+	}
+	if !strings.HasPrefix(strings.ToLower(req.get("Content-Type")), "application/sdp") {
+		// Without an offer the agent would have to offer in the 200, which
+		// door stations do not need
+		a.refuseLocked(req, addr, 488, "Not Acceptable Here")
+		return
+	}
+	sdpAddr, offer, err := parseSDP(req.body)
+	if err == nil {
+		var neg negotiation
+		if neg, err = negotiate(sdpAddr, offer); err == nil {
+			a.takeCallLocked(req, addr, offer, neg)
+			return
+		}
+	}
+	logrus.Warnf("Refused SIP call from %s: %v", headerURI(from), err)
+	a.refuseLocked(req, addr, 488, "Not Acceptable Here")
+}
+
+func (a *Agent) takeCallLocked(req *message, addr net.Addr, offer []sdpMedia, neg negotiation) {
+	a.respond(req, addr, 100, "Trying", "")
+	media, err := openMedia(a.ip)
+	if err != nil {
+		logrus.Errorf("Failed to open media of SIP call: %v", err)
+		a.refuseLocked(req, addr, 500, "Server Internal Error")
+		return
+	}
+
+	c := &call{
+		id:           randomHex(8),
+		direction:    directionInbound,
+		state:        stateRinging,
+		remoteURI:    headerURI(req.get("From")),
+		startedAt:    time.Now(),
+		callID:       req.get("Call-ID"),
+		localTag:     randomHex(6),
+		remote:       req.get("From"),
+		remoteTarget: headerURI(req.get("Contact")),
+		routes:       req.getAll("Record-Route"),
+		cseq:         1,
+		// Responses and requests go back where the INVITE came from, which
+		// also works for door stations behind NAT
+		addr:   addr,
+		invite: req,
+		offer:  offer,
+		neg:    neg,
+		media:  media,
+	}
+	c.local = req.get("To") + ";tag=" + c.localTag
+	if c.remoteTarget == "" {
+		c.remoteTarget = c.remoteURI
+	}
+	a.call = c
+	logrus.Infof("📞 Incoming SIP call %s from %s", c.id, c.remoteURI)
+	a.publish(events.SIPCallRinging, c, nil)
+
+	if a.cfg.AutoAnswer {
+		a.answerLocked(c)
+		return
+	}
+	a.respond(req, addr, 180, "Ringing", c.localTag)
+	c.ringTimer = time.AfterFunc(a.ringTimeout(), func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.call == c && c.state == stateRinging {
+			a.rejectLocked(c, 480, "Temporarily Unavailable", "no answer")
+		}
+	})
+}
+
+// handleReinviteLocked keeps the media of a call as negotiated when the
+// door station refreshes the session.
+func (a *Agent) handleReinviteLocked(c *call, req *message, addr net.Addr) {
+	if c.state != stateActive {
+		a.respond(req, addr, 491, "Request Pending", "")
+		return
+	}
+	body := c.media.local.offerSDP()
+	if _, offer, err := parseSDP(req.body); err == nil {
+		body = c.media.local.answerSDP(offer, c.neg)
+	}
+	resp := req.response(200, "OK", "")
+	resp.add("Contact", "<"+a.contactURI()+">")
+	resp.add("Allow", allow)
+	resp.add("Content-Type", "application/sdp")
+	resp.add("User-Agent", userAgent)
+	resp.body = body
+	a.send(resp, addr)
+}
+
+func (a *Agent) handleACK(req *message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c := a.call; c != nil && c.callID == req.get("Call-ID") && c.answer != nil {
+		c.acked = true
+	}
+}
+
+func (a *Agent) handleBye(req *message, addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.call
+	if c == nil || c.callID != req.get("Call-ID") {
+		a.respond(req, addr, 481, "Call/Transaction Does Not Exist", "")
+		return
+	}
+	a.respond(req, addr, 200, "OK", "")
+	a.endLocked(c, "remote hung up")
+}
+
+func (a *Agent) handleCancel(req *message, addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.call
+	if c == nil || c.direction != directionInbound || c.state != stateRinging || c.invite.branch() != req.branch() {
+		a.respond(req, addr, 481, "Call/Transaction Does Not Exist", "")
+		return
+	}
+	a.respond(req, addr, 200, "OK", "")
+	a.rejectLocked(c, 487, "Request Terminated", "cancelled")
+}
+
+// refuseLocked answers an INVITE that does not become a call.
+func (a *Agent) refuseLocked(req *message, addr net.Addr, code int, reason string) {
+	resp := req.response(code, reason, randomHex(6))
+	resp.add("User-Agent", userAgent)
+	a.refused = lastFinal{callID: req.get("Call-ID"), resp: resp}
+	a.send(resp, addr)
+}
+
+// rejectLocked ends an incoming call that was not answered.
+func (a *Agent) rejectLocked(c *call, code int, reason, endReason string) {
+	resp := c.invite.response(code, reason, c.localTag)
+	resp.add("User-Agent", userAgent)
+	a.refused = lastFinal{callID: c.callID, resp: resp}
+	a.send(resp, c.addr)
+	a.endLocked(c, endReason)
+}
+
+// answerLocked answers an incoming call and starts its media. The 200 is
+// sent until the door station acknowledges it.
+func (a *Agent) answerLocked(c *call) {
+	if c.ringTimer != nil {
+		c.ringTimer.Stop()
+	}
+	c.media.start(c.neg, a.source, func() { a.requestKeyframe(c) })
+
+	resp := c.invite.response(200, "OK", c.localTag)
+	resp.add("Contact", "<"+a.contactURI()+">")
+	resp.add("Allow", allow)
+	resp.add("Content-Type", "application/sdp")
+	resp.add("User-Agent", userAgent)
+	resp.body = c.media.local.answerSDP(c.offer, c.neg)
+	c.answer = resp
+	c.state, c.answeredAt = stateActive, time.Now()
+	a.send(resp, c.addr)
+	go a.retransmitAnswer(c)
+
+	logrus.Infof("📞 Answered SIP call %s from %s into %s", c.id, c.remoteURI, a.cfg.Stream)
+	a.publish(events.SIPCallStarted, c, nil)
+}
+
+func (a *Agent) retransmitAnswer(c *call) {
+	deadline := time.Now().Add(transactionTimeout)
+	for interval := t1; ; interval = min(2*interval, t2) {
+		time.Sleep(interval)
+		a.mu.Lock()
+		if a.call != c || c.acked {
+			a.mu.Unlock()
+			return
+		}
+		if time.Now().After(deadline) {
+			logrus.Warnf("SIP call %s was not acknowledged", c.id)
+			a.hangupLocked(c, "not acknowledged")
+			a.mu.Unlock()
+			return
+		}
+		a.send(c.answer, c.addr)
+		a.mu.Unlock()
+	}
+}
+
+// endLocked ends a call on this side, whatever the other side was told.
+func (a *Agent) endLocked(c *call, reason string) {
+	if c.state == stateEnded {
+		return
+	}
+	if c.ringTimer != nil {
+		c.ringTimer.Stop()
+	}
+	answered := c.state == stateActive
+	c.state, c.endedAt, c.endReason = stateEnded, time.Now(), reason
+	c.media.close()
+	if a.call == c {
+		a.call = nil
+	}
+	a.history = append([]CallInfo{c.info()}, a.history...)
+	if len(a.history) > historySize {
+		a.history = a.history[:historySize]
+	}
+
+	data := map[string]interface{}{"reason": reason}
+	if answered {
+		data["duration_seconds"] = c.endedAt.Sub(c.answeredAt).Seconds()
+	}
+	logrus.Infof("📞 SIP call %s with %s ended: %s", c.id, c.remoteURI, reason)
+	a.publish(events.SIPCallEnded, c, data)
+}
+
+// hangupLocked ends a call, telling the other side in the way its state
+// calls for.
+func (a *Agent) hangupLocked(c *call, reason string) {
+	switch {
+	case c.state == stateEnded:
+	case c.direction == directionInbound && c.state == stateRinging:
+		a.rejectLocked(c, 603, "Decline", reason)
+	case c.state == stateActive:
+		a.background(a.inDialogRequestLocked(c, "BYE"), c.addr)
+		a.endLocked(c, reason)
+	default:
+		// An outgoing call is cancelled until it is answered
+		a.background(inviteTransactionRequest(c.invite, "CANCEL", c.invite.get("To")), c.addr)
+		a.endLocked(c, reason)
+	}
+}
+
+func (a *Agent) inDialogRequestLocked(c *call, method string) *message {
+	c.cseq++
+	req := a.newRequest(method, c.remoteTarget, c.callID, c.local, c.remote, c.cseq)
+	for _, route := range c.routes {
+		req.add("Route", route)
+	}
+	return req
+}
+
+// background sends a request without waiting for its response, logging
+// its failure.
+func (a *Agent) background(req *message, addr net.Addr) {
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), transactionTimeout)
+		defer cancel()
+		resp, err := a.request(ctx, req, addr, nil)
+		if err != nil {
+			logrus.Debugf("SIP %s failed: %v", req.method, err)
+			return
+		}
+		if resp.statusCode/100 != 2 {
+			logrus.Debugf("SIP %s answered %d %s", req.method, resp.statusCode, resp.reason)
+		}
+	}()
+}
+
+// requestKeyframe asks the door station for a keyframe, at most every
+// keyframeInterval.
+func (a *Agent) requestKeyframe(c *call) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.call != c || c.state != stateActive || time.Since(c.lastKeyframe) < keyframeInterval {
+		return
+	}
+	c.lastKeyframe = time.Now()
+	info := a.inDialogRequestLocked(c, "INFO")
+	info.add("Content-Type", "application/media_control+xml")
+	info.body = []byte(pictureFastUpdate)
+	a.background(info, c.addr)
+}
+
+// allowed reports whether calls are taken from a caller. IP addresses are
+// compared with the address the call came from, as the From header is
+// whatever the caller says it is.
+func (a *Agent) allowed(from string, addr net.Addr) bool {
+	if len(a.cfg.AllowedCallers) == 0 {
+		return true
+	}
+	uri := headerURI(from)
+	user := uriUser(uri)
+	host, _, _ := net.SplitHostPort(uriHostPort(uri))
+	var sourceIP string
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		sourceIP = udp.IP.String()
+	}
+	for _, caller := range a.cfg.AllowedCallers {
+		if net.ParseIP(caller) != nil {
+			if caller == sourceIP {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(caller, user) || strings.EqualFold(caller, user+"@"+host) || strings.EqualFold(caller, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialAllowed reports whether target is a door station calls may be made
+// to: one listed in DialTargets or AllowedCallers by user@host, host, or IP
+// address, or by user alone for extensions at the agent's own domain.
+func (a *Agent) dialAllowed(target string) bool {
+	user := uriUser(target)
+	host, _, _ := net.SplitHostPort(uriHostPort(target))
+	for _, list := range [][]string{a.cfg.DialTargets, a.cfg.AllowedCallers} {
+		for _, entry := range list {
+			switch {
+			case net.ParseIP(entry) != nil:
+				if ip := net.ParseIP(host); ip != nil && ip.Equal(net.ParseIP(entry)) {
+					return true
+				}
+			case strings.Contains(entry, "@"):
+				if user != "" && strings.EqualFold(entry, user+"@"+host) {
+					return true
+				}
+			case strings.EqualFold(entry, host):
+				return true
+			case user != "" && strings.EqualFold(entry, user) && strings.EqualFold(host, a.domain()):
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Agent) ringTimeout() time.Duration {
+	if a.cfg.RingTimeout > 0 {
+		return a.cfg.RingTimeout
+	}
+	return defaultRingTimeout
+}
+
+func (a *Agent) publish(t events.Type, c *call, data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["call"] = c.id
+	data["direction"] = c.direction
+	data["remote"] = c.remoteURI
+	a.events.Publish(events.Event{Type: t, Stream: a.cfg.Stream, Data: data})
+}
+
+// Dial calls a door station, by its SIP URI, user@host address, or host;
+// through a server, an extension alone is called in the agent's domain.
+// The call rings in the background.
+func (a *Agent) Dial(to string) (CallInfo, error) {
+	target := strings.TrimSpace(to)
+	switch {
+	case strings.HasPrefix(target, "sip:"):
+	case strings.Contains(target, "@") || a.cfg.Server == "":
+		target = "sip:" + target
+	default:
+		target = "sip:" + target + "@" + a.domain()
+	}
+	if !a.dialAllowed(target) {
+		return CallInfo{}, ErrTargetNotAllowed
+	}
+	// Resolved before locking, so a slow lookup holds up no other call
+	addr, err := a.resolve(target)
+	if err != nil {
+		return CallInfo{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return CallInfo{}, ErrNotRunning
+	}
+	if a.call != nil {
+		return CallInfo{}, ErrCallActive
+	}
+	media, err := openMedia(a.ip)
+	if err != nil {
+		return CallInfo{}, fmt.Errorf("failed to open media: %w", err)
+	}
+
+	c := &call{
+		id:           randomHex(8),
+		direction:    directionOutbound,
+		state:        stateCalling,
+		remoteURI:    target,
+		startedAt:    time.Now(),
+		callID:       randomHex(12) + "@" + a.ip,
+		localTag:     randomHex(6),
+		remoteTarget: target,
+		cseq:         1,
+		addr:         addr,
+		media:        media,
+	}
+	c.local = "<" + a.aor() + ">;tag=" + c.localTag
+	c.remote = "<" + target + ">"
+	c.invite = a.newRequest("INVITE", target, c.callID, c.local, c.remote, c.cseq)
+	c.invite.add("Allow", allow)
+	c.invite.add("Content-Type", "application/sdp")
+	c.invite.body = media.local.offerSDP()
+	a.call = c
+	logrus.Infof("📞 Calling %s over SIP as call %s", target, c.id)
+
+	go a.dial(c)
+	return c.info(), nil
+}
+
+// dial waits for an outgoing call to be answered, and starts its media.
+func (a *Agent) dial(c *call) {
+	ctx, cancel := context.WithTimeout(a.ctx, a.ringTimeout())
+	defer cancel()
+	resp, err := a.authenticated(ctx, c.invite, c.addr, func(provisional *message) {
+		if provisional.statusCode == 180 || provisional.statusCode == 183 {
+			a.mu.Lock()
+			if c.state == stateCalling {
+				c.state = stateRinging
+			}
+			a.mu.Unlock()
+		}
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case err != nil && a.call == c:
+		if ctx.Err() != nil {
+			a.hangupLocked(c, "no answer")
+		} else {
+			a.endLocked(c, err.Error())
+		}
+		return
+	case err != nil:
+		return
+	case resp.statusCode >= 300:
+		a.endLocked(c, fmt.Sprintf("%d %s", resp.statusCode, resp.reason))
+		return
+	}
+
+	c.remote = resp.get("To")
+	if contact := resp.get("Contact"); contact != "" {
+		c.remoteTarget = headerURI(contact)
+	}
+	// A UAC's route set is the Record-Route of the 2xx in reverse
+	c.routes = resp.getAll("Record-Route")
+	slices.Reverse(c.routes)
+	if len(c.routes) > 0 {
+		if addr, err := net.ResolveUDPAddr("udp", uriHostPort(headerURI(c.routes[0]))); err == nil {
+			c.addr = addr
+		}
+	} else if a.cfg.Server == "" {
+		if addr, err := net.ResolveUDPAddr("udp", uriHostPort(c.remoteTarget)); err == nil {
+			c.addr = addr
+		}
+	}
+	c.cseq, _ = c.invite.cseq()
+	c.ack = a.newRequest("ACK", c.remoteTarget, c.callID, c.local, c.remote, c.cseq)
+	for _, route := range c.routes {
+		c.ack.add("Route", route)
+	}
+	a.send(c.ack, c.addr)
+
+	if c.state == stateEnded {
+		// Hung up while the door station answered
+		a.background(a.inDialogRequestLocked(c, "BYE"), c.addr)
+		return
+	}
+	sdpAddr, answer, err := parseSDP(resp.body)
+	if err == nil {
+		c.neg, err = negotiate(sdpAddr, answer)
+	}
+	if err != nil {
+		a.background(a.inDialogRequestLocked(c, "BYE"), c.addr)
+		a.endLocked(c, "no usable media: "+err.Error())
+		return
+	}
+	c.media.start(c.neg, a.source, func() { a.requestKeyframe(c) })
+	c.state, c.answeredAt = stateActive, time.Now()
+	logrus.Infof("📞 SIP call %s answered by %s into %s", c.id, c.remoteURI, a.cfg.Stream)
+	a.publish(events.SIPCallStarted, c, nil)
+}
+
+// Answer answers an incoming call that is ringing.
+func (a *Agent) Answer(id string) (CallInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.call
+	if c == nil || c.id != id {
+		return CallInfo{}, ErrCallNotFound
+	}
+	if c.direction != directionInbound || c.state != stateRinging {
+		return CallInfo{}, ErrNotRinging
+	}
+	a.answerLocked(c)
+	return c.info(), nil
+}
+
+// Hangup ends a call, declining it if it is ringing.
+func (a *Agent) Hangup(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.call
+	if c == nil || c.id != id {
+		return ErrCallNotFound
+	}
+	a.hangupLocked(c, "hung up")
+	return nil
+}
+
+// answered returns a call that is answered.
+func (a *Agent) answered(id string) (*call, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.call
+	if c == nil || c.id != id {
+		return nil, ErrCallNotFound
+	}
+	if c.state != stateActive {
+		return nil, ErrNotAnswered
+	}
+	return c, nil
+}
+
+// Listen returns the door station's audio on a call as 8 kHz samples, and
+// a function to stop listening. The channel is closed when the call ends.
+func (a *Agent) Listen(id string) (<-chan []int16, func(), error) {
+	c, err := a.answered(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.neg.hasAudio() {
+		return nil, nil, ErrNoAudio
+	}
+	ch, stop := c.media.listen()
+	return ch, stop, nil
+}
+
+// Talk sends 8 kHz 16-bit little-endian mono audio from r to the door
+// station on a call, in real time, until r ends, ctx is done, or the call
+// ends. One talker at a time is heard.
+func (a *Agent) Talk(ctx context.Context, id string, r io.Reader) error {
+	c, err := a.answered(id)
+	if err != nil {
+		return err
+	}
+	if !c.neg.hasAudio() {
+		return ErrNoAudio
+	}
+	return c.media.talk(ctx, r)
+}
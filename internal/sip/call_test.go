@@ -0,0 +1,34 @@
+package sip
+
+import "testing"
+
+func TestDialAllowed(t *testing.T) {
+	a := &Agent{cfg: Config{
+		Server:         "pbx.example.com",
+		AllowedCallers: []string{"gate", "10.0.0.5"},
+		DialTargets:    []string{"door@10.0.0.6", "intercom.example.com"},
+	}}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "sip:gate@pbx.example.com", want: true},
+		{target: "sip:GATE@PBX.example.com", want: true},
+		{target: "sip:gate@attacker.example.com", want: false},
+		{target: "sip:10.0.0.5", want: true},
+		{target: "sip:anyone@10.0.0.5:5080", want: true},
+		{target: "sip:door@10.0.0.6", want: true},
+		{target: "sip:other@10.0.0.6", want: false},
+		{target: "sip:lobby@intercom.example.com", want: true},
+		{target: "sip:+15551234567@pbx.example.com", want: false},
+		{target: "sip:10.0.0.7", want: false},
+	}
+	for _, tt := range tests {
+		if got := a.dialAllowed(tt.target); got != tt.want {
+			t.Errorf("dialAllowed(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+	if (&Agent{}).dialAllowed("sip:door@10.0.0.6") {
+		t.Error("dialAllowed() without door stations configured allowed a call")
+	}
+}
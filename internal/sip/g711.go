@@ -0,0 +1,79 @@
+package sip
+
+// G.711 µ-law and A-law, the audio codecs every SIP door station speaks.
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+func ulawDecode(u byte) int16 {
+	u = ^u
+	t := (int16(u&0x0F) << 3) + ulawBias
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return ulawBias - t
+	}
+	return t - ulawBias
+}
+
+func ulawEncode(sample int16) byte {
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > ulawClip {
+		s = ulawClip
+	}
+	s += ulawBias
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+func alawEncode(sample int16) byte {
+	s := int(sample)
+	mask := 0xD5
+	if s < 0 {
+		mask = 0x55
+		s = -s - 1
+	}
+	if s > 32767 {
+		s = 32767
+	}
+	var encoded int
+	if s < 256 {
+		encoded = s >> 4
+	} else {
+		seg := 1
+		for v := s >> 8; v > 1; v >>= 1 {
+			seg++
+		}
+		encoded = seg<<4 | (s>>(seg+3))&0x0F
+	}
+	return byte(encoded ^ mask)
+}
@@ -0,0 +1,340 @@
+package sip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// audioFrameSamples is 20 ms of 8 kHz audio, the packet size of G.711
+	audioFrameSamples = 160
+	audioFrameTime    = 20 * time.Millisecond
+	// talkbackBuffer bounds the talkback queued ahead of playback, in
+	// frames; a browser that sends faster than real time loses the rest
+	// rather than building up delay
+	talkbackBuffer = 50
+	// listenerBuffer is how many frames of door audio a slow listener may
+	// fall behind before it misses some
+	listenerBuffer = 50
+	maxRTPPacket   = 1500
+)
+
+// ErrTalkbackBusy is returned when someone else is already talking on the
+// call.
+var ErrTalkbackBusy = errors.New("talkback is already in use on this call")
+
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// callMedia exchanges the RTP of a call with the door station: its video
+// goes to the source, its audio to listeners, and talkback back to it.
+type callMedia struct {
+	audioConn net.PacketConn
+	videoConn net.PacketConn
+	local     localMedia
+	neg       negotiation
+	// audioDest follows the address the door station's audio comes from,
+	// which differs from its SDP behind NAT
+	audioDest net.Addr
+	listeners map[chan []int16]struct{}
+	talking   bool
+	mu        sync.Mutex
+
+	videoPackets atomic.Uint64
+	audioPackets atomic.Uint64
+	talkPackets  atomic.Uint64
+	closeOnce    sync.Once
+	done         chan struct{}
+}
+
+// openMedia listens for the media of a call on two free UDP ports.
+func openMedia(ip string) (*callMedia, error) {
+	audioConn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	videoConn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		audioConn.Close()
+		return nil, err
+	}
+	return &callMedia{
+		audioConn: audioConn,
+		videoConn: videoConn,
+		local: localMedia{
+			ip:        ip,
+			audioPort: audioConn.LocalAddr().(*net.UDPAddr).Port,
+			videoPort: videoConn.LocalAddr().(*net.UDPAddr).Port,
+			sessionID: time.Now().Unix(),
+		},
+		listeners: make(map[chan []int16]struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// start exchanges the negotiated media until the media is closed. The
+// door station's video goes to src, and keyframes are asked for with
+// requestKeyframe.
+func (m *callMedia) start(n negotiation, src *Source, requestKeyframe func()) {
+	m.mu.Lock()
+	m.neg = n
+	if n.hasAudio() {
+		m.audioDest, _ = net.ResolveUDPAddr("udp", net.JoinHostPort(n.audioAddr, strconv.Itoa(n.audioPort)))
+	}
+	m.mu.Unlock()
+	if n.hasAudio() {
+		go m.readAudio()
+	}
+	if n.hasVideo() {
+		go m.readVideo(src, requestKeyframe)
+	}
+}
+
+func (m *callMedia) close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.audioConn.Close()
+		m.videoConn.Close()
+		m.mu.Lock()
+		for ch := range m.listeners {
+			close(ch)
+		}
+		m.listeners = nil
+		m.mu.Unlock()
+	})
+}
+
+// readVideo depacketizes the door station's H.264 into src. A keyframe is
+// requested when the video starts and after every gap, as the pictures
+// after a lost packet cannot be decoded.
+func (m *callMedia) readVideo(src *Source, requestKeyframe func()) {
+	src.begin(requestKeyframe)
+	defer src.end()
+
+	// Door stations often give their parameter sets only in the SDP; they
+	// are sent ahead of keyframes unless the video carries its own
+	params := parameterSets(m.neg.videoFmtp)
+	inBand := false
+
+	var (
+		depacketizer h264Depacketizer
+		lastSeq      uint16
+		started      bool
+	)
+	buf := make([]byte, maxRTPPacket)
+	for {
+		n, _, err := m.videoConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		packet, err := parseRTP(buf[:n])
+		if err != nil || int(packet.payloadType) != m.neg.videoPT {
+			continue
+		}
+		m.videoPackets.Add(1)
+		if !started {
+			requestKeyframe()
+		} else if packet.seq != lastSeq+1 {
+			depacketizer.reset()
+			requestKeyframe()
+		}
+		started, lastSeq = true, packet.seq
+
+		for _, nalUnit := range depacketizer.push(packet.payload) {
+			switch nalUnit[0] & 0x1F {
+			case 7:
+				inBand = true
+			case 5:
+				if !inBand {
+					for _, param := range params {
+						src.writeNAL(append(append([]byte(nil), startCode...), param...))
+					}
+				}
+			}
+			src.writeNAL(append(append([]byte(nil), startCode...), nalUnit...))
+		}
+	}
+}
+
+// parameterSets decodes the sprop-parameter-sets of an H.264 fmtp.
+func parameterSets(fmtp string) [][]byte {
+	var sets [][]byte
+	for _, param := range strings.Split(fmtp, ";") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(param), "sprop-parameter-sets=")
+		if !ok {
+			continue
+		}
+		for _, encoded := range strings.Split(value, ",") {
+			if set, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(set) > 0 {
+				sets = append(sets, set)
+			}
+		}
+	}
+	return sets
+}
+
+// readAudio decodes the door station's G.711 for the listeners.
+func (m *callMedia) readAudio() {
+	buf := make([]byte, maxRTPPacket)
+	for {
+		n, addr, err := m.audioConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		packet, err := parseRTP(buf[:n])
+		if err != nil || int(packet.payloadType) != m.neg.audioPT {
+			continue
+		}
+		m.audioPackets.Add(1)
+
+		samples := make([]int16, len(packet.payload))
+		for i, b := range packet.payload {
+			if m.neg.alaw {
+				samples[i] = alawDecode(b)
+			} else {
+				samples[i] = ulawDecode(b)
+			}
+		}
+		m.mu.Lock()
+		m.audioDest = addr
+		for ch := range m.listeners {
+			select {
+			case ch <- samples:
+			default:
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// listen returns the door station's audio as 8 kHz samples, and a function
+// to stop listening. The channel is closed when the call ends.
+func (m *callMedia) listen() (<-chan []int16, func()) {
+	ch := make(chan []int16, listenerBuffer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listeners == nil {
+		close(ch)
+		return ch, func() {}
+	}
+	m.listeners[ch] = struct{}{}
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.listeners[ch]; ok {
+			delete(m.listeners, ch)
+			close(ch)
+		}
+	}
+}
+
+// talk sends 8 kHz 16-bit little-endian mono audio from r to the door
+// station in real time, until r ends, ctx is done, or the call ends.
+func (m *callMedia) talk(ctx context.Context, r io.Reader) error {
+	m.mu.Lock()
+	if m.talking {
+		m.mu.Unlock()
+		return ErrTalkbackBusy
+	}
+	m.talking = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.talking = false
+		m.mu.Unlock()
+	}()
+
+	frames := make(chan []byte, talkbackBuffer)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(frames)
+		for {
+			frame := make([]byte, 2*audioFrameSamples)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					readErr <- err
+				}
+				return
+			}
+			select {
+			case frames <- frame:
+			default:
+			}
+		}
+	}()
+
+	var header [10]byte
+	rand.Read(header[:])
+	packet := rtpPacket{
+		payloadType: uint8(m.neg.audioPT),
+		seq:         binary.BigEndian.Uint16(header[0:2]),
+		timestamp:   binary.BigEndian.Uint32(header[2:6]),
+		ssrc:        binary.BigEndian.Uint32(header[6:10]),
+		marker:      true,
+	}
+	ticker := time.NewTicker(audioFrameTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.done:
+			return nil
+		case <-ticker.C:
+		}
+		// The timestamp runs on through silence, which the next packet
+		// marks as the start of a talkspurt
+		packet.timestamp += audioFrameSamples
+		var frame []byte
+		var ok bool
+		select {
+		case frame, ok = <-frames:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+					return nil
+				}
+			}
+		default:
+			packet.marker = true
+			continue
+		}
+
+		payload := make([]byte, audioFrameSamples)
+		for i := range payload {
+			sample := int16(binary.LittleEndian.Uint16(frame[2*i:]))
+			if m.neg.alaw {
+				payload[i] = alawEncode(sample)
+			} else {
+				payload[i] = ulawEncode(sample)
+			}
+		}
+		packet.payload = payload
+		packet.seq++
+
+		m.mu.Lock()
+		dest := m.audioDest
+		m.mu.Unlock()
+		if dest == nil {
+			continue
+		}
+		if _, err := m.audioConn.WriteTo(packet.marshal(), dest); err != nil {
+			logrus.Debugf("Failed to send talkback: %v", err)
+		}
+		m.talkPackets.Add(1)
+		packet.marker = false
+	}
+}
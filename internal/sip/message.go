@@ -0,0 +1,269 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compactHeaders maps the compact forms of header names to their full
+// names (RFC 3261 section 7.3.3)
+var compactHeaders = map[string]string{
+	"v": "Via",
+	"f": "From",
+	"t": "To",
+	"i": "Call-ID",
+	"m": "Contact",
+	"l": "Content-Length",
+	"c": "Content-Type",
+	"k": "Supported",
+}
+
+type header struct {
+	name  string
+	value string
+}
+
+// message is a SIP request or response.
+type message struct {
+	method     string
+	requestURI string
+	statusCode int
+	reason     string
+	headers    []header
+	body       []byte
+}
+
+func (m *message) isRequest() bool {
+	return m.method != ""
+}
+
+// parseMessage reads a SIP message received over UDP.
+func parseMessage(data []byte) (*message, error) {
+	head, body, found := bytes.Cut(data, []byte("\r\n\r\n"))
+	if !found {
+		head, body, found = bytes.Cut(data, []byte("\n\n"))
+	}
+	if !found {
+		return nil, fmt.Errorf("message has no end of headers")
+	}
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+
+	m := &message{}
+	start := strings.SplitN(lines[0], " ", 3)
+	if len(start) != 3 {
+		return nil, fmt.Errorf("invalid start line %q", lines[0])
+	}
+	if strings.HasPrefix(start[0], "SIP/") {
+		code, err := strconv.Atoi(start[1])
+		if err != nil || code < 100 || code > 699 {
+			return nil, fmt.Errorf("invalid status line %q", lines[0])
+		}
+		m.statusCode, m.reason = code, start[2]
+	} else {
+		if start[2] != "SIP/2.0" {
+			return nil, fmt.Errorf("invalid request line %q", lines[0])
+		}
+		m.method, m.requestURI = start[0], start[1]
+	}
+
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		// Folded lines continue the previous header
+		if (line[0] == ' ' || line[0] == '\t') && len(m.headers) > 0 {
+			m.headers[len(m.headers)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", line)
+		}
+		name = strings.TrimSpace(name)
+		if full, ok := compactHeaders[strings.ToLower(name)]; ok {
+			name = full
+		}
+		m.headers = append(m.headers, header{name: name, value: strings.TrimSpace(value)})
+	}
+
+	if length := m.get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > len(body) {
+			return nil, fmt.Errorf("invalid Content-Length %q", length)
+		}
+		body = body[:n]
+	}
+	m.body = append([]byte(nil), body...)
+	return m, nil
+}
+
+// get returns the first value of a header.
+func (m *message) get(name string) string {
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, name) {
+			return h.value
+		}
+	}
+	return ""
+}
+
+// getAll returns every value of a header, splitting comma-separated ones.
+func (m *message) getAll(name string) []string {
+	var values []string
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, name) {
+			for _, v := range splitHeaderValues(h.value) {
+				values = append(values, strings.TrimSpace(v))
+			}
+		}
+	}
+	return values
+}
+
+func (m *message) add(name, value string) {
+	m.headers = append(m.headers, header{name: name, value: value})
+}
+
+// set replaces every value of a header with one.
+func (m *message) set(name, value string) {
+	m.del(name)
+	m.add(name, value)
+}
+
+func (m *message) del(name string) {
+	kept := m.headers[:0]
+	for _, h := range m.headers {
+		if !strings.EqualFold(h.name, name) {
+			kept = append(kept, h)
+		}
+	}
+	m.headers = kept
+}
+
+// cseq returns the sequence number and method of the CSeq header.
+func (m *message) cseq() (uint32, string) {
+	num, method, _ := strings.Cut(m.get("CSeq"), " ")
+	n, _ := strconv.ParseUint(strings.TrimSpace(num), 10, 32)
+	return uint32(n), strings.TrimSpace(method)
+}
+
+// branch returns the branch parameter of the top Via header.
+func (m *message) branch() string {
+	vias := m.getAll("Via")
+	if len(vias) == 0 {
+		return ""
+	}
+	return headerParam(vias[0], "branch")
+}
+
+func (m *message) bytes() []byte {
+	var b bytes.Buffer
+	if m.isRequest() {
+		fmt.Fprintf(&b, "%s %s SIP/2.0\r\n", m.method, m.requestURI)
+	} else {
+		fmt.Fprintf(&b, "SIP/2.0 %d %s\r\n", m.statusCode, m.reason)
+	}
+	for _, h := range m.headers {
+		if strings.EqualFold(h.name, "Content-Length") {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", h.name, h.value)
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(m.body))
+	b.Write(m.body)
+	return b.Bytes()
+}
+
+// response returns a response to a request, copying the headers that
+// identify its transaction. A tag is added to To if it has none.
+func (m *message) response(code int, reason, toTag string) *message {
+	resp := &message{statusCode: code, reason: reason}
+	for _, h := range m.headers {
+		switch strings.ToLower(h.name) {
+		case "via", "from", "call-id", "cseq", "record-route":
+			resp.add(h.name, h.value)
+		}
+	}
+	to := m.get("To")
+	if toTag != "" && headerParam(to, "tag") == "" && code > 100 {
+		to += ";tag=" + toTag
+	}
+	resp.add("To", to)
+	return resp
+}
+
+// splitHeaderValues splits a header on the commas that separate values,
+// leaving those inside quotes and angle brackets.
+func splitHeaderValues(value string) []string {
+	var values []string
+	var quoted, bracketed bool
+	start := 0
+	for i, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '<' && !quoted:
+			bracketed = true
+		case r == '>' && !quoted:
+			bracketed = false
+		case r == ',' && !quoted && !bracketed:
+			values = append(values, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, value[start:])
+}
+
+// headerParam returns a parameter of a header value such as a Via or a
+// From, outside its URI.
+func headerParam(value, name string) string {
+	if end := strings.LastIndex(value, ">"); end >= 0 {
+		value = value[end+1:]
+	}
+	for _, param := range strings.Split(value, ";")[1:] {
+		key, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(key, name) {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// headerURI returns the URI of a From, To, or Contact value.
+func headerURI(value string) string {
+	if start := strings.Index(value, "<"); start >= 0 {
+		if end := strings.Index(value[start:], ">"); end >= 0 {
+			return value[start+1 : start+end]
+		}
+	}
+	uri, _, _ := strings.Cut(value, ";")
+	return strings.TrimSpace(uri)
+}
+
+// uriUser returns the user part of a SIP URI, e.g. "door" of
+// "sip:door@10.0.0.5:5060".
+func uriUser(uri string) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(uri, "sips:"), "sip:")
+	user, _, found := strings.Cut(rest, "@")
+	if !found {
+		return ""
+	}
+	return user
+}
+
+// uriHostPort returns the host and port of a SIP URI, with port 5060 if it
+// has none.
+func uriHostPort(uri string) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(uri, "sips:"), "sip:")
+	if _, host, found := strings.Cut(rest, "@"); found {
+		rest = host
+	}
+	rest, _, _ = strings.Cut(rest, ";")
+	rest, _, _ = strings.Cut(rest, "?")
+	if !strings.Contains(rest, ":") || strings.HasSuffix(rest, "]") {
+		rest += ":5060"
+	}
+	return rest
+}
@@ -0,0 +1,114 @@
+package sip
+
+import "testing"
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "request", data: "OPTIONS sip:door@10.0.0.5 SIP/2.0\r\nCall-ID: a\r\nContent-Length: 0\r\n\r\n"},
+		{name: "response", data: "SIP/2.0 200 OK\r\nCSeq: 1 INVITE\r\n\r\n"},
+		{name: "bare newlines", data: "BYE sip:door@10.0.0.5 SIP/2.0\ni: a\n\n"},
+		{name: "empty", data: "", wantErr: true},
+		{name: "no end of headers", data: "OPTIONS sip:door@10.0.0.5 SIP/2.0\r\nCall-ID: a\r\n", wantErr: true},
+		{name: "only end of headers", data: "\r\n\r\n", wantErr: true},
+		{name: "short start line", data: "OPTIONS sip:door\r\n\r\n", wantErr: true},
+		{name: "wrong version", data: "OPTIONS sip:door@10.0.0.5 SIP/1.0\r\n\r\n", wantErr: true},
+		{name: "status not a number", data: "SIP/2.0 abc OK\r\n\r\n", wantErr: true},
+		{name: "status out of range", data: "SIP/2.0 99 Odd\r\n\r\n", wantErr: true},
+		{name: "header without colon", data: "SIP/2.0 200 OK\r\nCSeq\r\n\r\n", wantErr: true},
+		{name: "leading folded line", data: "SIP/2.0 200 OK\r\n folded\r\n\r\n", wantErr: true},
+		{name: "negative Content-Length", data: "SIP/2.0 200 OK\r\nl: -1\r\n\r\n", wantErr: true},
+		{name: "Content-Length past body", data: "SIP/2.0 200 OK\r\nContent-Length: 10\r\n\r\nv=0", wantErr: true},
+		{name: "Content-Length not a number", data: "SIP/2.0 200 OK\r\nContent-Length: x\r\n\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseMessage([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && m == nil {
+				t.Fatal("parseMessage() returned no message")
+			}
+		})
+	}
+}
+
+func TestParseMessageHeaders(t *testing.T) {
+	data := "INVITE sip:door@10.0.0.5 SIP/2.0\r\n" +
+		"v: SIP/2.0/UDP 10.0.0.9;branch=z9hG4bK1\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.8;branch=z9hG4bK2\r\n" +
+		"f: \"Gate\" <sip:gate@10.0.0.9>;tag=1\r\n" +
+		"Subject: a\r\n  folded\r\n" +
+		"CSeq: 7 INVITE\r\n" +
+		"Content-Length: 3\r\n\r\nv=0trailing"
+	m, err := parseMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if !m.isRequest() || m.method != "INVITE" || m.requestURI != "sip:door@10.0.0.5" {
+		t.Errorf("request line = %q %q", m.method, m.requestURI)
+	}
+	if got := m.branch(); got != "z9hG4bK1" {
+		t.Errorf("branch() = %q, want z9hG4bK1", got)
+	}
+	if got := len(m.getAll("Via")); got != 2 {
+		t.Errorf("getAll(Via) has %d values, want 2", got)
+	}
+	if got := headerURI(m.get("From")); got != "sip:gate@10.0.0.9" {
+		t.Errorf("From URI = %q", got)
+	}
+	if got := m.get("Subject"); got != "a folded" {
+		t.Errorf("folded Subject = %q", got)
+	}
+	if seq, method := m.cseq(); seq != 7 || method != "INVITE" {
+		t.Errorf("cseq() = %d %q", seq, method)
+	}
+	if string(m.body) != "v=0" {
+		t.Errorf("body = %q, want the Content-Length bytes", m.body)
+	}
+}
+
+func TestMalformedHeaders(t *testing.T) {
+	m := &message{headers: []header{{name: "CSeq", value: "x INVITE"}, {name: "Via", value: ""}}}
+	if seq, _ := m.cseq(); seq != 0 {
+		t.Errorf("cseq() of an invalid number = %d, want 0", seq)
+	}
+	if got := m.branch(); got != "" {
+		t.Errorf("branch() without one = %q", got)
+	}
+	if got := (&message{}).branch(); got != "" {
+		t.Errorf("branch() without Via = %q", got)
+	}
+	for _, value := range []string{"", "<", ">", "<sip:a", ";tag=1", "\"a,b\" <sip:a@b>"} {
+		headerURI(value)
+		headerParam(value, "tag")
+		splitHeaderValues(value)
+	}
+}
+
+func TestURIParts(t *testing.T) {
+	tests := []struct {
+		uri      string
+		user     string
+		hostPort string
+	}{
+		{uri: "sip:door@10.0.0.5", user: "door", hostPort: "10.0.0.5:5060"},
+		{uri: "sips:door@example.com:5061;transport=tls", user: "door", hostPort: "example.com:5061"},
+		{uri: "sip:10.0.0.5?subject=a", hostPort: "10.0.0.5:5060"},
+		{uri: "sip:door@[2001:db8::1]", user: "door", hostPort: "[2001:db8::1]:5060"},
+		{uri: "", hostPort: ":5060"},
+		{uri: "sip:@", hostPort: ":5060"},
+	}
+	for _, tt := range tests {
+		if got := uriUser(tt.uri); got != tt.user {
+			t.Errorf("uriUser(%q) = %q, want %q", tt.uri, got, tt.user)
+		}
+		if got := uriHostPort(tt.uri); got != tt.hostPort {
+			t.Errorf("uriHostPort(%q) = %q, want %q", tt.uri, got, tt.hostPort)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sip
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// rtpPacket is the part of an RTP packet the call media needs.
+type rtpPacket struct {
+	payloadType uint8
+	marker      bool
+	seq         uint16
+	timestamp   uint32
+	ssrc        uint32
+	payload     []byte
+}
+
+// parseRTP reads an RTP packet, skipping its CSRCs, header extension, and
+// padding.
+func parseRTP(data []byte) (rtpPacket, error) {
+	if len(data) < 12 || data[0]>>6 != 2 {
+		return rtpPacket{}, fmt.Errorf("not an RTP packet")
+	}
+	p := rtpPacket{
+		payloadType: data[1] & 0x7F,
+		marker:      data[1]&0x80 != 0,
+		seq:         binary.BigEndian.Uint16(data[2:4]),
+		timestamp:   binary.BigEndian.Uint32(data[4:8]),
+		ssrc:        binary.BigEndian.Uint32(data[8:12]),
+	}
+	offset := 12 + 4*int(data[0]&0x0F)
+	if data[0]&0x10 != 0 {
+		if len(data) < offset+4 {
+			return rtpPacket{}, fmt.Errorf("truncated RTP header extension")
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(data[offset+2:offset+4]))
+	}
+	end := len(data)
+	if data[0]&0x20 != 0 && end > 0 {
+		end -= int(data[end-1])
+	}
+	if offset > end {
+		return rtpPacket{}, fmt.Errorf("truncated RTP packet")
+	}
+	p.payload = data[offset:end]
+	return p, nil
+}
+
+func (p rtpPacket) marshal() []byte {
+	data := make([]byte, 12+len(p.payload))
+	data[0] = 0x80
+	data[1] = p.payloadType
+	if p.marker {
+		data[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(data[2:4], p.seq)
+	binary.BigEndian.PutUint32(data[4:8], p.timestamp)
+	binary.BigEndian.PutUint32(data[8:12], p.ssrc)
+	copy(data[12:], p.payload)
+	return data
+}
+
+// h264Depacketizer reassembles the NAL units of H.264 RTP payloads
+// (RFC 6184): single NAL units, STAP-A aggregates, and FU-A fragments.
+type h264Depacketizer struct {
+	fragment []byte
+	// skipping drops the rest of a fragmented NAL unit after a gap
+	skipping bool
+}
+
+// reset drops the NAL unit being reassembled, after a lost packet.
+func (d *h264Depacketizer) reset() {
+	d.fragment = nil
+	d.skipping = true
+}
+
+// push returns the NAL units completed by a payload.
+func (d *h264Depacketizer) push(payload []byte) [][]byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	const (
+		stapA = 24
+		fuA   = 28
+	)
+	switch nalType := payload[0] & 0x1F; {
+	case nalType >= 1 && nalType <= 23:
+		d.fragment, d.skipping = nil, false
+		return [][]byte{append([]byte(nil), payload...)}
+
+	case nalType == stapA:
+		d.fragment, d.skipping = nil, false
+		var nalUnits [][]byte
+		for rest := payload[1:]; len(rest) > 2; {
+			size := int(binary.BigEndian.Uint16(rest))
+			if size == 0 || len(rest) < 2+size {
+				break
+			}
+			nalUnits = append(nalUnits, append([]byte(nil), rest[2:2+size]...))
+			rest = rest[2+size:]
+		}
+		return nalUnits
+
+	case nalType == fuA:
+		if len(payload) < 3 {
+			return nil
+		}
+		start, end := payload[1]&0x80 != 0, payload[1]&0x40 != 0
+		if start {
+			header := payload[0]&0xE0 | payload[1]&0x1F
+			d.fragment, d.skipping = []byte{header}, false
+		}
+		if d.skipping || d.fragment == nil {
+			return nil
+		}
+		d.fragment = append(d.fragment, payload[2:]...)
+		if !end {
+			return nil
+		}
+		nalUnit := d.fragment
+		d.fragment = nil
+		return [][]byte{nalUnit}
+	}
+	return nil
+}
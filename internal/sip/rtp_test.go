@@ -0,0 +1,112 @@
+package sip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseRTP(t *testing.T) {
+	header := []byte{0x80, 0xE0, 0x00, 0x01, 0, 0, 0, 2, 0, 0, 0, 3}
+	with := func(first byte, rest ...byte) []byte {
+		data := append([]byte{first}, header[1:]...)
+		return append(data, rest...)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		payload []byte
+		wantErr bool
+	}{
+		{name: "payload", data: with(0x80, 1, 2, 3), payload: []byte{1, 2, 3}},
+		{name: "no payload", data: header, payload: []byte{}},
+		{name: "CSRC", data: with(0x81, 9, 9, 9, 9, 1), payload: []byte{1}},
+		{name: "extension", data: with(0x90, 0, 0, 0, 1, 9, 9, 9, 9, 1), payload: []byte{1}},
+		{name: "padding", data: with(0xA0, 1, 0, 2), payload: []byte{1}},
+		{name: "empty", data: nil, wantErr: true},
+		{name: "short", data: header[:11], wantErr: true},
+		{name: "version 1", data: with(0x40), wantErr: true},
+		{name: "missing CSRCs", data: with(0x8F, 1), wantErr: true},
+		{name: "missing extension header", data: with(0x90, 0, 0), wantErr: true},
+		{name: "extension past end", data: with(0x90, 0, 0, 0xFF, 0xFF), wantErr: true},
+		{name: "padding past end", data: with(0xA0, 1, 0xFF), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseRTP(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(p.payload, tt.payload) {
+				t.Errorf("payload = %v, want %v", p.payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestRTPRoundTrip(t *testing.T) {
+	want := rtpPacket{payloadType: 96, marker: true, seq: 65535, timestamp: 90000, ssrc: 7, payload: []byte{0x65, 1}}
+	got, err := parseRTP(want.marshal())
+	if err != nil {
+		t.Fatalf("parseRTP() error = %v", err)
+	}
+	if got.payloadType != want.payloadType || got.marker != want.marker || got.seq != want.seq ||
+		got.timestamp != want.timestamp || got.ssrc != want.ssrc || !bytes.Equal(got.payload, want.payload) {
+		t.Errorf("parseRTP(marshal()) = %+v, want %+v", got, want)
+	}
+}
+
+func TestH264Depacketizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		payloads [][]byte
+		want     [][]byte
+	}{
+		{name: "single NAL unit", payloads: [][]byte{{0x65, 1, 2}}, want: [][]byte{{0x65, 1, 2}}},
+		{name: "empty", payloads: [][]byte{{}}},
+		{name: "reserved type", payloads: [][]byte{{0x1F, 1}}},
+		{
+			name:     "STAP-A",
+			payloads: [][]byte{{0x18, 0, 2, 0x67, 1, 0, 1, 0x68}},
+			want:     [][]byte{{0x67, 1}, {0x68}},
+		},
+		{name: "STAP-A size past end", payloads: [][]byte{{0x18, 0, 9, 0x67}}},
+		{name: "STAP-A zero size", payloads: [][]byte{{0x18, 0, 0, 0x67}}},
+		{name: "STAP-A truncated size", payloads: [][]byte{{0x18, 0}}},
+		{
+			name:     "FU-A",
+			payloads: [][]byte{{0x7C, 0x85, 1}, {0x7C, 0x05, 2}, {0x7C, 0x45, 3}},
+			want:     [][]byte{{0x65, 1, 2, 3}},
+		},
+		{name: "FU-A short", payloads: [][]byte{{0x7C, 0x85}}},
+		{name: "FU-A without start", payloads: [][]byte{{0x7C, 0x05, 2}, {0x7C, 0x45, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d h264Depacketizer
+			var got [][]byte
+			for _, payload := range tt.payloads {
+				got = append(got, d.push(payload)...)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("push() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("NAL unit %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestH264DepacketizerReset(t *testing.T) {
+	var d h264Depacketizer
+	d.push([]byte{0x7C, 0x85, 1})
+	d.reset()
+	if got := d.push([]byte{0x7C, 0x45, 3}); got != nil {
+		t.Errorf("push() after a gap = %v, want the fragment dropped", got)
+	}
+	if got := d.push([]byte{0x7C, 0xC5, 4}); len(got) != 1 {
+		t.Errorf("push() of the next whole fragment = %v", got)
+	}
+}
@@ -0,0 +1,269 @@
+package sip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Payload types of the codecs the agent offers. Door stations send their
+// audio as G.711 and their video as H.264, which the streams carry as is.
+const (
+	payloadPCMU           = 0
+	payloadPCMA           = 8
+	payloadH264           = 96
+	payloadTelephoneEvent = 101
+)
+
+// sdpMedia is a media section of a session description.
+type sdpMedia struct {
+	kind    string
+	port    int
+	proto   string
+	formats []string
+	// rtpmap and fmtp are keyed by payload type
+	rtpmap    map[string]string
+	fmtp      map[string]string
+	direction string
+	addr      string
+}
+
+// parseSDP reads the connection address and media sections of a session
+// description.
+func parseSDP(body []byte) (string, []sdpMedia, error) {
+	var addr string
+	var media []sdpMedia
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		value := line[2:]
+		var current *sdpMedia
+		if len(media) > 0 {
+			current = &media[len(media)-1]
+		}
+		switch line[0] {
+		case 'c':
+			fields := strings.Fields(value)
+			if len(fields) != 3 {
+				return "", nil, fmt.Errorf("invalid connection line %q", line)
+			}
+			if current != nil {
+				current.addr = fields[2]
+			} else {
+				addr = fields[2]
+			}
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return "", nil, fmt.Errorf("invalid media line %q", line)
+			}
+			portField, _, _ := strings.Cut(fields[1], "/")
+			port, err := strconv.Atoi(portField)
+			if err != nil || port < 0 || port > 65535 {
+				return "", nil, fmt.Errorf("invalid media line %q", line)
+			}
+			media = append(media, sdpMedia{
+				kind:      fields[0],
+				port:      port,
+				proto:     fields[2],
+				formats:   fields[3:],
+				rtpmap:    make(map[string]string),
+				fmtp:      make(map[string]string),
+				direction: "sendrecv",
+			})
+		case 'a':
+			if current == nil {
+				continue
+			}
+			name, attr, _ := strings.Cut(value, ":")
+			switch name {
+			case "rtpmap", "fmtp":
+				format, params, _ := strings.Cut(attr, " ")
+				if name == "rtpmap" {
+					current.rtpmap[format] = params
+				} else {
+					current.fmtp[format] = params
+				}
+			case "sendrecv", "sendonly", "recvonly", "inactive":
+				current.direction = name
+			}
+		}
+	}
+	if len(media) == 0 {
+		return "", nil, fmt.Errorf("session description has no media")
+	}
+	return addr, media, nil
+}
+
+// negotiation is the media a call exchanges: the door station's audio,
+// which talkback is sent back to, and its video.
+type negotiation struct {
+	audioAddr string
+	audioPort int
+	audioPT   int
+	// alaw is set when the audio is PCMA rather than PCMU
+	alaw      bool
+	videoAddr string
+	videoPort int
+	videoPT   int
+	videoFmtp string
+	// dtmfPT is the telephone-event payload type, -1 if none
+	dtmfPT int
+}
+
+func (n negotiation) hasAudio() bool { return n.audioPort > 0 }
+func (n negotiation) hasVideo() bool { return n.videoPort > 0 }
+
+// codec names the negotiated audio codec.
+func (n negotiation) codec() string {
+	switch {
+	case !n.hasAudio():
+		return ""
+	case n.alaw:
+		return "PCMA"
+	default:
+		return "PCMU"
+	}
+}
+
+// negotiate picks the first G.711 codec of the first audio section and the
+// first H.264 format of the first video section, as the remote party
+// listed them in order of preference.
+func negotiate(addr string, media []sdpMedia) (negotiation, error) {
+	n := negotiation{audioPT: -1, videoPT: -1, dtmfPT: -1}
+	for _, m := range media {
+		if m.port == 0 || m.proto != "RTP/AVP" || m.direction == "inactive" {
+			continue
+		}
+		mediaAddr := m.addr
+		if mediaAddr == "" {
+			mediaAddr = addr
+		}
+		switch {
+		case m.kind == "audio" && !n.hasAudio():
+			for _, format := range m.formats {
+				pt, err := strconv.Atoi(format)
+				if err != nil || pt < 0 || pt > 127 {
+					continue
+				}
+				encoding := strings.ToUpper(m.rtpmap[format])
+				switch {
+				case n.audioPT >= 0:
+				case strings.HasPrefix(encoding, "PCMU/"), encoding == "" && pt == payloadPCMU:
+					n.audioPT = pt
+				case strings.HasPrefix(encoding, "PCMA/"), encoding == "" && pt == payloadPCMA:
+					n.audioPT, n.alaw = pt, true
+				}
+				if strings.HasPrefix(encoding, "TELEPHONE-EVENT/8000") {
+					n.dtmfPT = pt
+				}
+			}
+			if n.audioPT >= 0 {
+				n.audioAddr, n.audioPort = mediaAddr, m.port
+			}
+		case m.kind == "video" && !n.hasVideo() && m.direction != "recvonly":
+			for _, format := range m.formats {
+				pt, err := strconv.Atoi(format)
+				if err != nil || pt < 0 || pt > 127 {
+					continue
+				}
+				if strings.HasPrefix(strings.ToUpper(m.rtpmap[format]), "H264/") {
+					n.videoPT = pt
+					n.videoFmtp = m.fmtp[format]
+					n.videoAddr, n.videoPort = mediaAddr, m.port
+					break
+				}
+			}
+		}
+	}
+	if !n.hasAudio() && !n.hasVideo() {
+		return n, fmt.Errorf("no G.711 audio or H.264 video offered")
+	}
+	return n, nil
+}
+
+// localMedia is where the agent receives a call's media.
+type localMedia struct {
+	ip        string
+	audioPort int
+	videoPort int
+	// sessionID is also the version of the description, which stays the
+	// same for the whole call
+	sessionID int64
+}
+
+func (l localMedia) header(b *strings.Builder) {
+	family := "IP4"
+	if strings.Contains(l.ip, ":") {
+		family = "IP6"
+	}
+	fmt.Fprintf(b, "v=0\r\no=- %d %d IN %s %s\r\ns=%s\r\nc=IN %s %s\r\nt=0 0\r\n",
+		l.sessionID, l.sessionID, family, l.ip, userAgent, family, l.ip)
+}
+
+// offerSDP describes the media of an outgoing call: G.711 audio both ways
+// and H.264 video from the door station.
+func (l localMedia) offerSDP() []byte {
+	var b strings.Builder
+	l.header(&b)
+	fmt.Fprintf(&b, "m=audio %d RTP/AVP %d %d %d\r\n", l.audioPort, payloadPCMU, payloadPCMA, payloadTelephoneEvent)
+	fmt.Fprintf(&b, "a=rtpmap:%d PCMU/8000\r\na=rtpmap:%d PCMA/8000\r\n", payloadPCMU, payloadPCMA)
+	fmt.Fprintf(&b, "a=rtpmap:%d telephone-event/8000\r\na=fmtp:%d 0-15\r\n", payloadTelephoneEvent, payloadTelephoneEvent)
+	b.WriteString("a=ptime:20\r\na=sendrecv\r\n")
+	fmt.Fprintf(&b, "m=video %d RTP/AVP %d\r\n", l.videoPort, payloadH264)
+	fmt.Fprintf(&b, "a=rtpmap:%d H264/90000\r\n", payloadH264)
+	fmt.Fprintf(&b, "a=fmtp:%d profile-level-id=42e01f;packetization-mode=1\r\n", payloadH264)
+	b.WriteString("a=recvonly\r\n")
+	return []byte(b.String())
+}
+
+// answerSDP answers an offer with the negotiated media, refusing the other
+// sections with port 0 as RFC 3264 requires.
+func (l localMedia) answerSDP(media []sdpMedia, n negotiation) []byte {
+	var b strings.Builder
+	l.header(&b)
+	audioDone, videoDone := false, false
+	for _, m := range media {
+		switch {
+		case m.kind == "audio" && n.hasAudio() && !audioDone && m.port == n.audioPort:
+			audioDone = true
+			if n.dtmfPT >= 0 {
+				fmt.Fprintf(&b, "m=audio %d RTP/AVP %d %d\r\n", l.audioPort, n.audioPT, n.dtmfPT)
+				fmt.Fprintf(&b, "a=rtpmap:%d %s/8000\r\n", n.audioPT, n.codec())
+				fmt.Fprintf(&b, "a=rtpmap:%d telephone-event/8000\r\na=fmtp:%d 0-15\r\n", n.dtmfPT, n.dtmfPT)
+			} else {
+				fmt.Fprintf(&b, "m=audio %d RTP/AVP %d\r\n", l.audioPort, n.audioPT)
+				fmt.Fprintf(&b, "a=rtpmap:%d %s/8000\r\n", n.audioPT, n.codec())
+			}
+			b.WriteString("a=ptime:20\r\n")
+			b.WriteString("a=" + answerDirection(m.direction, "sendrecv") + "\r\n")
+		case m.kind == "video" && n.hasVideo() && !videoDone && m.port == n.videoPort:
+			videoDone = true
+			fmt.Fprintf(&b, "m=video %d RTP/AVP %d\r\n", l.videoPort, n.videoPT)
+			fmt.Fprintf(&b, "a=rtpmap:%d H264/90000\r\n", n.videoPT)
+			if n.videoFmtp != "" {
+				fmt.Fprintf(&b, "a=fmtp:%d %s\r\n", n.videoPT, n.videoFmtp)
+			}
+			b.WriteString("a=" + answerDirection(m.direction, "recvonly") + "\r\n")
+		default:
+			fmt.Fprintf(&b, "m=%s 0 %s %s\r\n", m.kind, m.proto, m.formats[0])
+		}
+	}
+	return []byte(b.String())
+}
+
+// answerDirection answers the direction of an offered section, given the
+// one the agent wants.
+func answerDirection(offered, wanted string) string {
+	switch {
+	case offered == "sendonly" && wanted != "sendonly":
+		return "recvonly"
+	case offered == "recvonly" && wanted == "recvonly":
+		return "inactive"
+	case offered == "recvonly":
+		return "sendonly"
+	}
+	return wanted
+}
@@ -0,0 +1,89 @@
+package sip
+
+import "testing"
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		addr    string
+		media   int
+		wantErr bool
+	}{
+		{
+			name:  "audio and video",
+			body:  "v=0\r\nc=IN IP4 10.0.0.5\r\nm=audio 4000 RTP/AVP 0 8\r\nm=video 4002 RTP/AVP 96\r\nc=IN IP4 10.0.0.6\r\n",
+			addr:  "10.0.0.5",
+			media: 2,
+		},
+		{name: "port count", body: "m=audio 4000/2 RTP/AVP 0\n", media: 1},
+		{name: "junk lines", body: "x\n=\nab\nm=audio 4000 RTP/AVP 0\n", media: 1},
+		{name: "attribute before media", body: "a=rtpmap:0 PCMU/8000\nm=audio 4000 RTP/AVP 0\n", media: 1},
+		{name: "empty", body: "", wantErr: true},
+		{name: "no media", body: "v=0\nc=IN IP4 10.0.0.5\n", wantErr: true},
+		{name: "short connection", body: "c=IN IP4\nm=audio 4000 RTP/AVP 0\n", wantErr: true},
+		{name: "short media", body: "m=audio 4000 RTP/AVP\n", wantErr: true},
+		{name: "port not a number", body: "m=audio x RTP/AVP 0\n", wantErr: true},
+		{name: "port out of range", body: "m=audio 70000 RTP/AVP 0\n", wantErr: true},
+		{name: "negative port", body: "m=audio -1 RTP/AVP 0\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, media, err := parseSDP([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSDP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if addr != tt.addr || len(media) != tt.media {
+				t.Errorf("parseSDP() = %q with %d media, want %q with %d", addr, len(media), tt.addr, tt.media)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    negotiation
+		wantErr bool
+	}{
+		{
+			name: "PCMA preferred with video",
+			body: "c=IN IP4 10.0.0.5\nm=audio 4000 RTP/AVP 8 0 101\na=rtpmap:101 telephone-event/8000\n" +
+				"m=video 4002 RTP/AVP 97\na=rtpmap:97 H264/90000\na=fmtp:97 packetization-mode=1\n",
+			want: negotiation{
+				audioAddr: "10.0.0.5", audioPort: 4000, audioPT: 8, alaw: true,
+				videoAddr: "10.0.0.5", videoPort: 4002, videoPT: 97, videoFmtp: "packetization-mode=1", dtmfPT: 101,
+			},
+		},
+		{
+			name: "dynamic PCMU",
+			body: "c=IN IP4 10.0.0.5\nm=audio 4000 RTP/AVP 110\na=rtpmap:110 pcmu/8000\n",
+			want: negotiation{audioAddr: "10.0.0.5", audioPort: 4000, audioPT: 110, videoPT: -1, dtmfPT: -1},
+		},
+		{name: "only Opus", body: "m=audio 4000 RTP/AVP 111\na=rtpmap:111 opus/48000/2\n", wantErr: true},
+		{name: "rejected stream", body: "m=audio 0 RTP/AVP 0\n", wantErr: true},
+		{name: "secure profile", body: "m=audio 4000 RTP/SAVP 0\n", wantErr: true},
+		{name: "inactive", body: "m=audio 4000 RTP/AVP 0\na=inactive\n", wantErr: true},
+		{name: "receive-only video", body: "m=video 4002 RTP/AVP 96\na=rtpmap:96 H264/90000\na=recvonly\n", wantErr: true},
+		{name: "format not a number", body: "m=audio 4000 RTP/AVP x\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, media, err := parseSDP([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseSDP() error = %v", err)
+			}
+			got, err := negotiate(addr, media)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("negotiate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
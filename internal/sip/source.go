@@ -0,0 +1,90 @@
+package sip
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
+)
+
+// Source is the stream of the door station on a call. It runs while a call
+// brings video; the agent answers and ends calls, so Start and Stop do
+// nothing.
+type Source struct {
+	stream  string
+	frames  chan media.AccessUnit
+	stats   *stats.SourceStats
+	running bool
+	// requestKeyframe asks the door station on the call for a keyframe
+	requestKeyframe func()
+	mu              sync.Mutex
+}
+
+// NewSource returns the source of the stream calls are bridged into.
+func NewSource(stream string) *Source {
+	return &Source{
+		stream: stream,
+		frames: make(chan media.AccessUnit, media.FrameBuffer),
+		stats:  stats.NewSourceStats(),
+	}
+}
+
+// URL is how the source is listed.
+func (s *Source) URL() string {
+	return "sip://" + s.stream
+}
+
+func (s *Source) Start(ctx context.Context) error { return nil }
+
+func (s *Source) Stop() error { return nil }
+
+// IsRunning reports whether a call is bringing video.
+func (s *Source) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *Source) Frames() <-chan media.AccessUnit {
+	return s.frames
+}
+
+func (s *Source) Health() stats.Snapshot {
+	return s.stats.Snapshot()
+}
+
+// RequestKeyframe asks the door station on the call for a keyframe.
+func (s *Source) RequestKeyframe() {
+	s.mu.Lock()
+	request := s.requestKeyframe
+	s.mu.Unlock()
+	if request != nil {
+		request()
+	}
+}
+
+func (s *Source) begin(requestKeyframe func()) {
+	s.mu.Lock()
+	s.running, s.requestKeyframe = true, requestKeyframe
+	s.mu.Unlock()
+	s.stats.MarkStarted()
+	s.stats.SetPipeline("sip")
+}
+
+func (s *Source) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.running, s.requestKeyframe = false, nil
+		s.stats.MarkStopped()
+	}
+}
+
+// writeNAL sends a NAL unit of the call's video, with its start code.
+func (s *Source) writeNAL(nalUnit []byte) {
+	s.stats.RecordFrame(nalUnit)
+	timestamp := uint32(time.Now().UnixNano() / 1000000)
+	media.Send(s.frames, media.NewAccessUnit(nalUnit, timestamp))
+}
@@ -0,0 +1,184 @@
+// Package slate renders the still picture streams show instead of their
+// video while they are blacked out.
+package slate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+)
+
+const (
+	// DefaultWidth and DefaultHeight are the size of a slate unless set
+	DefaultWidth  = 1280
+	DefaultHeight = 720
+	// FPS is the frame rate slates are encoded at; a still picture needs few
+	FPS = 5
+	// MaxImageBytes bounds the image a slate is made of
+	MaxImageBytes = 5 << 20
+	// MaxMessageLength bounds the message written on a slate
+	MaxMessageLength = 200
+)
+
+// Options describe a slate.
+type Options struct {
+	// Image is a PNG or JPEG scaled to fit; without one the slate is black
+	Image []byte
+	// Message is written across the slate
+	Message string
+	Width   int
+	Height  int
+}
+
+func (o Options) Validate() error {
+	if len(o.Image) > MaxImageBytes {
+		return fmt.Errorf("slate image exceeds %d bytes", MaxImageBytes)
+	}
+	if len(o.Message) > MaxMessageLength {
+		return fmt.Errorf("slate message exceeds %d characters", MaxMessageLength)
+	}
+	if o.Width < 0 || o.Height < 0 || o.Width > 3840 || o.Height > 2160 {
+		return fmt.Errorf("slate size must be at most 3840x2160")
+	}
+	if o.Width%2 != 0 || o.Height%2 != 0 {
+		return fmt.Errorf("slate width and height must be even")
+	}
+	return nil
+}
+
+// Slate is one second of H.264 that can be looped: a GOP of FPS pictures,
+// each a list of Annex B NAL units.
+type Slate struct {
+	Pictures [][][]byte
+}
+
+// Render encodes a slate with ffmpeg.
+func Render(ctx context.Context, opts Options) (*Slate, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	width, height := opts.Width, opts.Height
+	if width == 0 {
+		width = DefaultWidth
+	}
+	if height == 0 {
+		height = DefaultHeight
+	}
+
+	dir, err := os.MkdirTemp("", "slate-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slate directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if len(opts.Image) > 0 {
+		image := filepath.Join(dir, "image")
+		if err := os.WriteFile(image, opts.Image, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write slate image: %w", err)
+		}
+		args = append(args, "-loop", "1", "-framerate", strconv.Itoa(FPS), "-i", image)
+	} else {
+		args = append(args, "-f", "lavfi", "-i", fmt.Sprintf("color=c=black:s=%dx%d:r=%d", width, height, FPS))
+	}
+
+	filters := []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height),
+		fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=black", width, height),
+	}
+	if opts.Message != "" {
+		// A file spares the message filtergraph escaping; expansion is off,
+		// so drawtext takes it literally
+		textFile := filepath.Join(dir, "message.txt")
+		if err := os.WriteFile(textFile, []byte(opts.Message), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write slate message: %w", err)
+		}
+		y := "(h-text_h)/2"
+		if len(opts.Image) > 0 {
+			y = "h-text_h-h/10"
+		}
+		filters = append(filters, fmt.Sprintf(
+			"drawtext=textfile='%s':expansion=none:fontsize=%d:fontcolor=white:box=1:boxcolor=black@0.6:boxborderw=%d:x=(w-text_w)/2:y=%s",
+			textFile, height/18, height/72, y))
+	}
+	args = append(args, ffmpeg.Encoding{GOPFrames: FPS}.Args(filters...)...)
+	args = append(args, "-frames:v", strconv.Itoa(FPS), "-an", "-f", "h264", "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := ffmpeg.CommandContext(ctx, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := ffmpeg.Run(cmd); err != nil {
+		return nil, fmt.Errorf("ffmpeg slate failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	slate := &Slate{Pictures: pictures(stdout.Bytes())}
+	if len(slate.Pictures) == 0 || !startsWithKeyframe(slate.Pictures[0]) {
+		return nil, fmt.Errorf("ffmpeg produced no slate keyframe")
+	}
+	return slate, nil
+}
+
+// pictures groups an Annex B bytestream into the NAL units of each picture.
+// A picture ends before a parameter set or SEI following a slice, or before
+// a slice that starts over at the first macroblock.
+func pictures(h264 []byte) [][][]byte {
+	var out [][][]byte
+	var current [][]byte
+	hasSlice := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(h264))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(h264)+1)
+	scanner.Split(media.SplitH264Frames)
+	for scanner.Scan() {
+		nalUnit := append([]byte(nil), scanner.Bytes()...)
+		header, payload := nalHeader(nalUnit)
+		if header < 0 {
+			continue
+		}
+		slice := header == 1 || header == 5
+		// first_mb_in_slice is 0 when the slice header starts with a 1 bit
+		newPicture := !slice || (len(payload) > 0 && payload[0]&0x80 != 0)
+		if hasSlice && newPicture {
+			out = append(out, current)
+			current, hasSlice = nil, false
+		}
+		current = append(current, nalUnit)
+		hasSlice = hasSlice || slice
+	}
+	if hasSlice {
+		out = append(out, current)
+	}
+	return out
+}
+
+// nalHeader returns the type of a NAL unit with its start code and the
+// bytes after its header, or -1 if it has none.
+func nalHeader(nalUnit []byte) (int, []byte) {
+	for i := 0; i+2 < len(nalUnit); i++ {
+		if nalUnit[i] == 0 && nalUnit[i+1] == 0 && nalUnit[i+2] == 1 {
+			if i+3 >= len(nalUnit) {
+				return -1, nil
+			}
+			return int(nalUnit[i+3] & 0x1F), nalUnit[i+4:]
+		}
+	}
+	return -1, nil
+}
+
+func startsWithKeyframe(picture [][]byte) bool {
+	for _, nalUnit := range picture {
+		if t, _ := nalHeader(nalUnit); t == 5 || t == 7 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/slate"
+	"golang-webrtc-streaming/internal/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slateRenderTimeout bounds encoding a slate with ffmpeg
+const slateRenderTimeout = 30 * time.Second
+
+// BlackoutSink is a sink that reads the upstream itself, rather than the
+// media bus, and so must be told when its stream is blacked out.
+type BlackoutSink interface {
+	Sink
+	SetBlackout(on bool)
+}
+
+// Blackout replaces a stream's media with a slate. It is persisted, so a
+// blacked out stream stays so across restarts.
+type Blackout struct {
+	Message string `json:"message,omitempty"`
+	// Image is a PNG or JPEG, base64 encoded in JSON
+	Image  []byte    `json:"image,omitempty"`
+	Width  int       `json:"width,omitempty"`
+	Height int       `json:"height,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+func (b Blackout) Validate() error {
+	return b.slateOptions().Validate()
+}
+
+func (b Blackout) slateOptions() slate.Options {
+	return slate.Options{Image: b.Image, Message: b.Message, Width: b.Width, Height: b.Height}
+}
+
+// BlackoutStatus reports whether a stream is blacked out.
+type BlackoutStatus struct {
+	Stream     string     `json:"stream"`
+	BlackedOut bool       `json:"blacked_out"`
+	Message    string     `json:"message,omitempty"`
+	HasImage   bool       `json:"has_image,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// blackout is a stream's blackout in effect; the slate plays until stop is
+// closed.
+type blackout struct {
+	settings Blackout
+	stop     chan struct{}
+}
+
+// Blackout reports whether a stream is blacked out.
+func (m *Manager) Blackout(streamID string) (BlackoutStatus, error) {
+	st := normalize(streamID)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, err := m.lookup(st); err != nil {
+		return BlackoutStatus{}, err
+	}
+	return m.blackoutStatusLocked(st), nil
+}
+
+// IsBlackedOut reports whether a stream's media is replaced by a slate.
+func (m *Manager) IsBlackedOut(streamID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.blackouts[normalize(streamID)] != nil
+}
+
+// blackoutStatusLocked describes the blackout of a known stream. Callers
+// must hold mu.
+func (m *Manager) blackoutStatusLocked(st string) BlackoutStatus {
+	status := BlackoutStatus{Stream: st}
+	if b := m.blackouts[st]; b != nil {
+		since := b.settings.Since
+		status.BlackedOut = true
+		status.Message = b.settings.Message
+		status.HasImage = len(b.settings.Image) > 0
+		status.Since = &since
+	}
+	return status
+}
+
+// StartBlackout replaces a stream's media with a slate of the image and
+// message for every output until EndBlackout: bus sinks and viewers get the
+// slate, and sinks reading the upstream themselves, such as the recorder,
+// hold off. Viewers stay connected and the source keeps running. Starting it
+// again replaces the slate.
+func (m *Manager) StartBlackout(streamID string, settings Blackout) (BlackoutStatus, error) {
+	st := normalize(streamID)
+	m.mu.RLock()
+	_, err := m.lookup(st)
+	db := m.state
+	m.mu.RUnlock()
+	if err != nil {
+		return BlackoutStatus{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), slateRenderTimeout)
+	defer cancel()
+	rendered, err := slate.Render(ctx, settings.slateOptions())
+	if err != nil {
+		return BlackoutStatus{}, err
+	}
+
+	settings.Since = time.Now()
+	if db != nil {
+		if err := db.Put(state.BucketBlackouts, st, settings); err != nil {
+			return BlackoutStatus{}, err
+		}
+	}
+	b := m.setBlackout(st, settings)
+	if b == nil {
+		return BlackoutStatus{}, fmt.Errorf("%s source was removed", st)
+	}
+	go m.playSlate(st, rendered, b.stop)
+
+	logrus.Warnf("⬛ Blacked out %s: %s", st, settings.Message)
+	m.publish(events.StreamBlackedOut, st, map[string]interface{}{"message": settings.Message})
+	return m.Blackout(st)
+}
+
+// EndBlackout brings back a stream's media. Its bus sinks and viewers are
+// held until the source's next keyframe, so they never decode pictures
+// referencing the slate.
+func (m *Manager) EndBlackout(streamID string) (BlackoutStatus, error) {
+	st := normalize(streamID)
+
+	m.mu.Lock()
+	if _, err := m.lookup(st); err != nil {
+		m.mu.Unlock()
+		return BlackoutStatus{}, err
+	}
+	b := m.blackouts[st]
+	if b == nil {
+		m.mu.Unlock()
+		return BlackoutStatus{}, fmt.Errorf("stream %s is not blacked out", st)
+	}
+	close(b.stop)
+	delete(m.blackouts, st)
+	m.awaitingKeyframe[st] = true
+	sinks := append([]Sink(nil), m.sinks[st]...)
+	db := m.state
+	m.mu.Unlock()
+
+	if db != nil {
+		if err := db.Delete(state.BucketBlackouts, st); err != nil {
+			logrus.Warnf("Failed to forget blackout of %s: %v", st, err)
+		}
+	}
+	for _, sink := range sinks {
+		if bs, ok := sink.(BlackoutSink); ok {
+			bs.SetBlackout(false)
+		}
+	}
+	m.webrtcManager.ResyncVideo(st, fmt.Sprintf("%s blackout ended", st))
+
+	logrus.Infof("▶️ Ended blackout of %s", st)
+	m.publish(events.StreamResumed, st, map[string]interface{}{"blacked_out_seconds": int(time.Since(b.settings.Since) / time.Second)})
+	return m.Blackout(st)
+}
+
+// setBlackout puts a blackout in effect, replacing the slate of a previous
+// one, and holds off the sinks that read the upstream. It returns nil if the
+// stream no longer exists.
+func (m *Manager) setBlackout(st string, settings Blackout) *blackout {
+	m.mu.Lock()
+	if _, ok := m.sources[st]; !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	if previous := m.blackouts[st]; previous != nil {
+		close(previous.stop)
+	}
+	b := &blackout{settings: settings, stop: make(chan struct{})}
+	m.blackouts[st] = b
+	delete(m.awaitingKeyframe, st)
+	sinks := append([]Sink(nil), m.sinks[st]...)
+	m.mu.Unlock()
+
+	for _, sink := range sinks {
+		if bs, ok := sink.(BlackoutSink); ok {
+			bs.SetBlackout(true)
+		}
+	}
+	// Drops the cached live GOP; the slate starts with a keyframe
+	m.webrtcManager.ResyncVideo(st, fmt.Sprintf("%s blacked out", st))
+	return b
+}
+
+// dropLive reports whether the media bus must drop a frame of the source:
+// while the stream is blacked out, and after that until its next keyframe.
+func (m *Manager) dropLive(st string, keyframe bool) bool {
+	m.mu.RLock()
+	blackedOut, awaiting := m.blackouts[st] != nil, m.awaitingKeyframe[st]
+	m.mu.RUnlock()
+	if blackedOut {
+		return true
+	}
+	if !awaiting {
+		return false
+	}
+	if !keyframe {
+		return true
+	}
+	m.mu.Lock()
+	delete(m.awaitingKeyframe, st)
+	m.mu.Unlock()
+	return false
+}
+
+// playSlate loops a slate through a stream's bus sinks until stop is closed.
+func (m *Manager) playSlate(st string, s *slate.Slate, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second / slate.FPS)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		// Ended while the slate was rendered
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		timestamp := uint32(time.Now().UnixNano() / 1000000)
+		sinks := m.frameSinks(st)
+		for _, nalUnit := range s.Pictures[i%len(s.Pictures)] {
+			au := media.NewAccessUnit(nalUnit, timestamp)
+			for _, sink := range sinks {
+				sink.WriteAccessUnit(au)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// restoreBlackout puts the persisted blackout of a new stream back in
+// effect. Live media is dropped right away; the slate follows once it is
+// rendered.
+func (m *Manager) restoreBlackout(st string) {
+	m.mu.RLock()
+	db := m.state
+	m.mu.RUnlock()
+	if db == nil {
+		return
+	}
+
+	var settings Blackout
+	found, err := db.Get(state.BucketBlackouts, st, &settings)
+	if err != nil {
+		logrus.Warnf("Failed to load blackout of %s: %v", st, err)
+		return
+	}
+	if !found {
+		return
+	}
+	b := m.setBlackout(st, settings)
+	if b == nil {
+		return
+	}
+	logrus.Warnf("⬛ %s stays blacked out: %s", st, settings.Message)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), slateRenderTimeout)
+		defer cancel()
+		rendered, err := slate.Render(ctx, settings.slateOptions())
+		if err != nil {
+			// Outputs get no video rather than the live one
+			logrus.Errorf("Failed to render slate of %s: %v", st, err)
+			return
+		}
+		m.playSlate(st, rendered, b.stop)
+	}()
+}
@@ -0,0 +1,177 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EnableOnDemand makes sources run only while they have consumers: viewers
+// of the stream, including those following the active source while it is
+// the active one, or anything holding a reference from Acquire. Sources
+// are started lazily on first demand and stopped once they have had no
+// consumers for idleTimeout.
+func (m *Manager) EnableOnDemand(ctx context.Context, idleTimeout time.Duration) {
+	m.mu.Lock()
+	m.onDemand = true
+	m.ctx = ctx
+	m.idleTimeout = idleTimeout
+	m.mu.Unlock()
+
+	m.webrtcManager.OnPeersChanged(m.reconcileDemand)
+	logrus.Info("Sources will start on demand")
+	m.reconcileDemand()
+}
+
+// Acquire registers a consumer of a source and starts it if needed. The
+// returned release function must be called once the consumer is done.
+func (m *Manager) Acquire(sourceType, consumer string) (func(), error) {
+	st := normalize(sourceType)
+	if _, err := m.GetSourceURL(st); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.demand[st]++
+	m.mu.Unlock()
+	logrus.Debugf("%s acquired %s source", consumer, st)
+	m.reconcileDemand()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			m.demand[st]--
+			m.mu.Unlock()
+			logrus.Debugf("%s released %s source", consumer, st)
+			m.reconcileDemand()
+		})
+	}, nil
+}
+
+// IsIdle reports whether a source is stopped for lack of consumers.
+func (m *Manager) IsIdle(sourceType string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.onDemand && !m.wanted[normalize(sourceType)]
+}
+
+// reconcileDemand works out which sources are needed and starts them, or
+// arms an idle timer for sources that are no longer needed.
+func (m *Manager) reconcileDemand() {
+	viewers := m.webrtcManager.StreamPeerCounts()
+
+	m.mu.Lock()
+	if !m.onDemand {
+		m.mu.Unlock()
+		return
+	}
+	var changed []string
+	for _, st := range m.sourceTypes() {
+		needed := m.neededLocked(st, viewers)
+		timer := m.idleTimers[st]
+		switch {
+		case needed:
+			// New demand cancels a pending idle shutdown
+			if timer != nil {
+				timer.Stop()
+				delete(m.idleTimers, st)
+			}
+			if !m.wanted[st] {
+				m.wanted[st] = true
+				changed = append(changed, st)
+			}
+		case m.wanted[st] && timer == nil:
+			if m.idleTimeout <= 0 {
+				m.wanted[st] = false
+				changed = append(changed, st)
+				continue
+			}
+			st, timerID := st, m.nextTimerID
+			m.nextTimerID++
+			m.idleTimerIDs[st] = timerID
+			m.idleTimers[st] = time.AfterFunc(m.idleTimeout, func() { m.idleShutdown(st, timerID) })
+			logrus.Infof("%s source has no consumers, stopping in %s", st, m.idleTimeout)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, st := range changed {
+		go m.applyDemand(st)
+	}
+}
+
+// idleShutdown stops a source whose idle timer expired, unless demand
+// returned in the meantime.
+func (m *Manager) idleShutdown(sourceType string, timerID uint64) {
+	viewers := m.webrtcManager.StreamPeerCounts()
+
+	m.mu.Lock()
+	// The timer was cancelled or replaced after it fired
+	if _, ok := m.idleTimers[sourceType]; !ok || m.idleTimerIDs[sourceType] != timerID {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.idleTimers, sourceType)
+	needed := m.neededLocked(sourceType, viewers)
+	stop := !needed && m.wanted[sourceType]
+	if stop {
+		m.wanted[sourceType] = false
+	}
+	m.mu.Unlock()
+
+	if stop {
+		m.applyDemand(sourceType)
+	}
+}
+
+// neededLocked reports whether a source has consumers, given the viewers of
+// every stream as counted by StreamPeerCounts. Callers must hold mu.
+func (m *Manager) neededLocked(st string, viewers map[string]int) bool {
+	return m.demand[st] > 0 || viewers[st] > 0 || (st == m.currentSource && viewers[""] > 0)
+}
+
+// applyDemand brings one source client in line with the wanted state.
+// Transitions of a source are serialized so a slow start cannot race a stop.
+func (m *Manager) applyDemand(sourceType string) {
+	m.mu.Lock()
+	lock, ok := m.transitions[sourceType]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.transitions[sourceType] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.mu.RLock()
+	want := m.wanted[sourceType]
+	client := m.sources[sourceType]
+	ctx := m.lifetimeLocked()
+	m.mu.RUnlock()
+	if client == nil {
+		return
+	}
+
+	switch {
+	case want && !client.IsRunning():
+		logrus.Infof("▶️ Starting %s source on demand", sourceType)
+		if err := client.Start(ctx); err != nil {
+			logrus.Errorf("Failed to start %s source on demand: %v", sourceType, err)
+			return
+		}
+		m.publish(events.SourceStarted, sourceType, map[string]interface{}{"on_demand": true})
+	case !want && client.IsRunning():
+		logrus.Infof("⏸️ Stopping %s source, no consumers left", sourceType)
+		if err := client.Stop(); err != nil {
+			logrus.Errorf("Failed to stop %s source: %v", sourceType, err)
+			return
+		}
+		m.publish(events.SourceStopped, sourceType, map[string]interface{}{"reason": "idle"})
+	}
+}
@@ -0,0 +1,69 @@
+package source
+
+import (
+	"fmt"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+)
+
+// Encoder is a source that re-encodes its input and can change its encoder
+// settings while running, restarting its pipeline behind the scenes.
+type Encoder interface {
+	Encoding() ffmpeg.Encoding
+	SetEncoding(enc ffmpeg.Encoding) error
+}
+
+// encoder returns the source of a stream if it supports encoder settings.
+// Callers must hold mu.
+func (m *Manager) encoder(st string) (Encoder, error) {
+	src, err := m.lookup(st)
+	if err != nil {
+		return nil, err
+	}
+	enc, ok := src.(Encoder)
+	if !ok {
+		return nil, fmt.Errorf("%s source does not support encoder settings", st)
+	}
+	return enc, nil
+}
+
+// Encoding returns the encoder settings of a stream.
+func (m *Manager) Encoding(streamID string) (ffmpeg.Encoding, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	enc, err := m.encoder(normalize(streamID))
+	if err != nil {
+		return ffmpeg.Encoding{}, err
+	}
+	return enc.Encoding(), nil
+}
+
+// SetEncoding changes the encoder settings of a stream. A running pipeline
+// restarts with them while viewers stay connected: their video is held at
+// the last picture until the new pipeline's first keyframe. The settings
+// also apply when the stream's URL changes.
+func (m *Manager) SetEncoding(streamID string, settings ffmpeg.Encoding) error {
+	st := normalize(streamID)
+
+	m.mu.Lock()
+	enc, err := m.encoder(st)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	restart := m.sources[st].IsRunning()
+	m.mu.Unlock()
+
+	if restart {
+		m.webrtcManager.ResyncVideo(st, fmt.Sprintf("%s encoding changed", st))
+	}
+	if err := enc.SetEncoding(settings); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.encodings[st] = settings
+	m.mu.Unlock()
+	return nil
+}
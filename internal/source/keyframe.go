@@ -0,0 +1,27 @@
+package source
+
+import "github.com/sirupsen/logrus"
+
+// KeyframeRequester is implemented by sources that send a keyframe when
+// asked, such as WebRTC publishers, SIP calls, and RTSP clients, which
+// restart a transcoding ffmpeg. Sources copying their input, such as RTMP
+// clients, send keyframes at the upstream's interval and are not asked.
+type KeyframeRequester interface {
+	RequestKeyframe()
+}
+
+// RequestKeyframe asks the source of a stream for a keyframe, reporting
+// whether it can be asked.
+func (m *Manager) RequestKeyframe(sourceType string) bool {
+	st := normalize(sourceType)
+	m.mu.RLock()
+	src := m.sources[st]
+	m.mu.RUnlock()
+	requester, ok := src.(KeyframeRequester)
+	if !ok || !src.IsRunning() {
+		return false
+	}
+	logrus.Debugf("Requesting a keyframe of the %s source", st)
+	requester.RequestKeyframe()
+	return true
+}
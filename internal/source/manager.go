@@ -3,10 +3,17 @@ package source
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
-	"golang-webrtc-streaming/internal/rtmp"
-	"golang-webrtc-streaming/internal/rtsp"
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/redact"
+	"golang-webrtc-streaming/internal/state"
+	"golang-webrtc-streaming/internal/stats"
 	"golang-webrtc-streaming/internal/webrtc"
 
 	"github.com/sirupsen/logrus"
@@ -14,126 +21,424 @@ import (
 
 type Manager struct {
 	webrtcManager *webrtc.Manager
-	rtmpClient    *rtmp.RTMPClient
-	rtspClient    *rtsp.Client
+	sources       map[string]Source
+	urls          map[string]string
+	sinks         map[string][]Sink
+	// forwarders are closed to end a removed source's media bus
+	forwarders map[string]chan struct{}
+	// Encoder settings changed through SetEncoding, kept for new URLs
+	encodings     map[string]ffmpeg.Encoding
+	events        *events.Bus
+	state         *state.Store
 	currentSource string
-	rtmpURL       string
-	rtspURL       string
-	mu            sync.RWMutex
+	audioMonitors map[string]*audio.Monitor
+	// Level metering settings, kept so sources added later are metered too
+	audioCtx context.Context
+	audioCfg *audio.MeterConfig
+	// Opus encoder options of viewer audio, kept for sources added later
+	opus *audio.OpusOptions
+	// Called with the ID of every source added
+	onSourceAdded []func(string)
+	// Lifetime of the sources and sinks started, never that of the request
+	// that started them; see SetContext
+	ctx context.Context
+	// On-demand operation: consumers per source besides viewers, and which
+	// sources should currently be running
+	onDemand    bool
+	demand      map[string]int
+	wanted      map[string]bool
+	transitions map[string]*sync.Mutex
+	idleTimeout time.Duration
+	idleTimers  map[string]*time.Timer
+	// idleTimerIDs tell a firing timer whether it is still the current one
+	idleTimerIDs map[string]uint64
+	nextTimerID  uint64
+	// Streams whose media is replaced by a slate, and those that were until
+	// the source's next keyframe
+	blackouts        map[string]*blackout
+	awaitingKeyframe map[string]bool
+	mu               sync.RWMutex
+}
+
+// AudioLevelMessage is broadcast to peers over the data channel for the active source.
+type AudioLevelMessage struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	audio.Level
 }
 
 func NewManager(webrtcManager *webrtc.Manager) *Manager {
-	return &Manager{
+	m := &Manager{
 		webrtcManager: webrtcManager,
+		sources:       make(map[string]Source),
+		urls:          make(map[string]string),
+		sinks:         make(map[string][]Sink),
+		forwarders:    make(map[string]chan struct{}),
+		encodings:     make(map[string]ffmpeg.Encoding),
 		currentSource: "",
+		audioMonitors: make(map[string]*audio.Monitor),
+		demand:        make(map[string]int),
+		wanted:        make(map[string]bool),
+		transitions:   make(map[string]*sync.Mutex),
+		idleTimers:    make(map[string]*time.Timer),
+		idleTimerIDs:  make(map[string]uint64),
+
+		blackouts:        make(map[string]*blackout),
+		awaitingKeyframe: make(map[string]bool),
 	}
+	// Viewers that find no GOP cached ask the source for a keyframe
+	webrtcManager.OnKeyframeNeeded(func(stream string) { m.RequestKeyframe(stream) })
+	return m
 }
 
-func (m *Manager) InitializeSources(rtmpURL, rtspURL string) {
+// SetEvents publishes source and sink lifecycle changes on bus.
+func (m *Manager) SetEvents(bus *events.Bus) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.events = bus
+	m.mu.Unlock()
+}
 
-	m.rtmpURL = rtmpURL
-	m.rtspURL = rtspURL
+// publish sends an event about a stream. Callers must not hold mu.
+func (m *Manager) publish(t events.Type, streamID string, data map[string]interface{}) {
+	m.mu.RLock()
+	bus := m.events
+	m.mu.RUnlock()
+	bus.Publish(events.Event{Type: t, Stream: streamID, Data: data})
+}
 
-	if rtmpURL != "" {
-		m.rtmpClient = rtmp.NewClient(rtmpURL, m.webrtcManager, func() bool {
-			m.mu.RLock()
-			defer m.mu.RUnlock()
-			return m.currentSource == "rtmp"
-		})
-		logrus.Infof("Initialized RTMP client with URL: %s", rtmpURL)
+// switchTo makes st the active source and reports whether it changed.
+// Callers must hold mu.
+func (m *Manager) switchTo(st string) (string, bool) {
+	previous := m.currentSource
+	m.currentSource = st
+	if previous != st {
+		m.webrtcManager.SetActiveStream(st)
 	}
+	return previous, previous != st
+}
 
-	if rtspURL != "" {
-		m.rtspClient = rtsp.NewClient(rtspURL, m.webrtcManager, func() bool {
-			m.mu.RLock()
-			defer m.mu.RUnlock()
-			return m.currentSource == "rtsp"
-		})
-		logrus.Infof("Initialized RTSP client with URL: %s", rtspURL)
+func (m *Manager) publishSwitch(st, previous string) {
+	m.publish(events.SourceSwitched, st, map[string]interface{}{"previous": previous})
+}
+
+func (m *Manager) InitializeSources(rtmpURL, rtspURL string) {
+	for sourceType, url := range map[string]string{"rtmp": rtmpURL, "rtsp": rtspURL} {
+		if url == "" {
+			continue
+		}
+		if err := m.AddSource(sourceType, url); err != nil {
+			logrus.Errorf("Failed to initialize %s source: %v", sourceType, err)
+		}
+	}
+}
+
+// AddSource creates a source of a registered type reading from url, with a
+// WebRTC sink attached that fans it out to its viewers.
+func (m *Manager) AddSource(sourceType, url string) error {
+	st := normalize(sourceType)
+	src, err := newSource(st, url)
+	if err != nil {
+		return err
+	}
+	m.restoreTransform(st, src)
+	m.applyOpus(src)
+
+	m.mu.Lock()
+	if _, exists := m.sources[st]; exists {
+		m.mu.Unlock()
+		return fmt.Errorf("%s source already initialized", st)
+	}
+	m.sources[st] = src
+	m.urls[st] = url
+	m.sinks[st] = []Sink{newWebRTCSink(m.webrtcManager, st)}
+	done := make(chan struct{})
+	m.forwarders[st] = done
+	hooks := append([]func(string){}, m.onSourceAdded...)
+	audioCtx, audioCfg := m.audioCtx, m.audioCfg
+	m.mu.Unlock()
+
+	m.restoreBlackout(st)
+	go m.forward(st, src, done)
+	logrus.Infof("Initialized %s source with URL: %s", strings.ToUpper(st), redactURL(url))
+	for _, hook := range hooks {
+		hook(st)
 	}
+	if audioCfg != nil {
+		m.EnableAudioLevels(audioCtx, *audioCfg)
+	}
+	return nil
 }
 
-func (m *Manager) StartSource(ctx context.Context, sourceType string) error {
+// OnSourceAdded registers a callback for every source added from now on and
+// runs it for the sources that already exist, e.g. to attach sinks.
+func (m *Manager) OnSourceAdded(hook func(sourceType string)) {
 	m.mu.Lock()
-	// Do not stop others; both run concurrently. Just switch active selector.
+	m.onSourceAdded = append(m.onSourceAdded, hook)
+	existing := m.sourceTypes()
+	m.mu.Unlock()
 
-	switch normalize(sourceType) {
-	case "rtmp":
-		if m.rtmpClient == nil {
-			if m.rtmpURL == "" {
-				return fmt.Errorf("RTMP source not configured")
-			}
-			m.rtmpClient = rtmp.NewClient(m.rtmpURL, m.webrtcManager, func() bool {
-				m.mu.RLock()
-				defer m.mu.RUnlock()
-				return m.currentSource == "rtmp"
-			})
+	for _, st := range existing {
+		hook(st)
+	}
+}
+
+// SetSourceURL points a source at url, adding it if it does not exist yet.
+// Sinks stay attached, and a source that was running restarts on the new URL
+// without disconnecting its viewers.
+func (m *Manager) SetSourceURL(sourceType, url string) error {
+	st := normalize(sourceType)
+
+	m.mu.RLock()
+	old, exists := m.sources[st]
+	unchanged := m.urls[st] == url
+	m.mu.RUnlock()
+	if !exists {
+		return m.AddSource(st, url)
+	}
+	if unchanged {
+		return nil
+	}
+
+	src, err := newSource(st, url)
+	if err != nil {
+		return err
+	}
+	m.mu.RLock()
+	settings, customEncoding := m.encodings[st]
+	m.mu.RUnlock()
+	if enc, ok := src.(Encoder); ok && customEncoding {
+		if err := enc.SetEncoding(settings); err != nil {
+			return err
 		}
-		// Start if not running
-		if !m.rtmpClient.IsRunning() {
-			if err := m.rtmpClient.Start(ctx); err != nil {
-				m.mu.Unlock()
-				return fmt.Errorf("failed to start RTMP client: %w", err)
-			}
+	}
+	m.restoreTransform(st, src)
+	m.applyOpus(src)
+	wasRunning := old.IsRunning()
+	if wasRunning {
+		old.Stop()
+	}
+
+	m.mu.Lock()
+	close(m.forwarders[st])
+	done := make(chan struct{})
+	m.forwarders[st] = done
+	m.sources[st] = src
+	m.urls[st] = url
+	monitor := m.audioMonitors[st]
+	delete(m.audioMonitors, st)
+	onDemand, wanted, ctx := m.onDemand, m.wanted[st], m.lifetimeLocked()
+	audioCtx, audioCfg := m.audioCtx, m.audioCfg
+	m.mu.Unlock()
+
+	// Viewers of the stream freeze on its last picture until the new
+	// pipeline's first keyframe rather than seeing it mixed with the old one
+	if wasRunning || onDemand && wanted {
+		m.webrtcManager.ResyncVideo(st, fmt.Sprintf("%s source restarting", st))
+	}
+	go m.forward(st, src, done)
+	logrus.Infof("Switched %s source to URL: %s", strings.ToUpper(st), redactURL(url))
+	if monitor != nil {
+		monitor.Stop()
+	}
+	if audioCfg != nil {
+		m.EnableAudioLevels(audioCtx, *audioCfg)
+	}
+
+	switch {
+	case onDemand && wanted:
+		go m.applyDemand(st)
+	case !onDemand && wasRunning:
+		if err := src.Start(ctx); err != nil {
+			return fmt.Errorf("failed to restart %s client: %w", strings.ToUpper(st), err)
 		}
-		m.currentSource = "rtmp"
-		logrus.Info("✅ Started RTMP source")
+		m.publish(events.SourceStarted, st, nil)
+	}
+	return nil
+}
 
-	case "rtsp":
-		if m.rtspClient == nil {
-			if m.rtspURL == "" {
-				return fmt.Errorf("RTSP source not configured")
+// RemoveSource stops a source and its sinks and forgets it.
+func (m *Manager) RemoveSource(sourceType string) error {
+	st := normalize(sourceType)
+
+	m.mu.Lock()
+	src, err := m.lookup(st)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	sinks := m.sinks[st]
+	monitor := m.audioMonitors[st]
+	close(m.forwarders[st])
+	delete(m.sources, st)
+	delete(m.urls, st)
+	delete(m.sinks, st)
+	delete(m.forwarders, st)
+	delete(m.encodings, st)
+	delete(m.audioMonitors, st)
+	delete(m.wanted, st)
+	if b := m.blackouts[st]; b != nil {
+		close(b.stop)
+		delete(m.blackouts, st)
+	}
+	delete(m.awaitingKeyframe, st)
+	if timer := m.idleTimers[st]; timer != nil {
+		timer.Stop()
+		delete(m.idleTimers, st)
+	}
+	wasCurrent := m.currentSource == st
+	if wasCurrent {
+		m.currentSource = ""
+		m.webrtcManager.SetActiveStream("")
+	}
+	m.mu.Unlock()
+
+	for _, sink := range sinks {
+		if sink.IsRunning() {
+			if err := sink.Stop(); err != nil {
+				logrus.Warnf("Failed to stop %s sink of %s: %v", sink.Name(), st, err)
 			}
-			m.rtspClient = rtsp.NewClient(m.rtspURL, m.webrtcManager, func() bool {
-				m.mu.RLock()
-				defer m.mu.RUnlock()
-				return m.currentSource == "rtsp"
-			})
 		}
-		if !m.rtspClient.IsRunning() {
-			if err := m.rtspClient.Start(ctx); err != nil {
-				m.mu.Unlock()
-				return fmt.Errorf("failed to start RTSP client: %w", err)
+	}
+	if monitor != nil {
+		monitor.Stop()
+	}
+	if src.IsRunning() {
+		src.Stop()
+		m.publish(events.SourceStopped, st, map[string]interface{}{"reason": "removed"})
+	}
+	logrus.Infof("Removed %s source", strings.ToUpper(st))
+	return nil
+}
+
+// forward is the media bus of a stream: it hands every frame and audio
+// sample of the source to the running sinks that read from it until done is
+// closed, except while the stream is blacked out.
+func (m *Manager) forward(sourceType string, src Source, done <-chan struct{}) {
+	frames := src.Frames()
+	// Stays nil, never ready, for sources without audio
+	var samples <-chan AudioSample
+	if as, ok := src.(AudioSource); ok {
+		samples = as.Audio()
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case au := <-frames:
+			if m.dropLive(sourceType, au.Keyframe) {
+				continue
+			}
+			for _, sink := range m.frameSinks(sourceType) {
+				sink.WriteAccessUnit(au)
+			}
+		case sample := <-samples:
+			if m.IsBlackedOut(sourceType) {
+				continue
+			}
+			for _, sink := range m.frameSinks(sourceType) {
+				if as, ok := sink.(AudioSink); ok {
+					as.WriteAudio(sample)
+				}
 			}
 		}
-		m.currentSource = "rtsp"
-		logrus.Info("✅ Started RTSP source")
+	}
+}
 
-	default:
+// lookup returns the source of a type, distinguishing unknown types from
+// known ones that are not configured. Callers must hold mu.
+func (m *Manager) lookup(sourceType string) (Source, error) {
+	if src, ok := m.sources[sourceType]; ok {
+		return src, nil
+	}
+	for _, name := range Types() {
+		if name == sourceType {
+			return nil, fmt.Errorf("%s source not configured", strings.ToUpper(sourceType))
+		}
+	}
+	return nil, fmt.Errorf("unknown source type: %s", sourceType)
+}
+
+// sourceTypes returns the initialized source types in sorted order.
+// Callers must hold mu.
+func (m *Manager) sourceTypes() []string {
+	names := make([]string, 0, len(m.sources))
+	for name := range m.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartSource makes a source the active one, starting it unless sources
+// run on demand. It runs until stopped or until the context of SetContext
+// ends, however short the request that started it.
+func (m *Manager) StartSource(sourceType string) error {
+	st := normalize(sourceType)
+
+	m.mu.Lock()
+	// Do not stop others; all run concurrently. Just switch active selector.
+	src, err := m.lookup(st)
+	if err != nil {
 		m.mu.Unlock()
-		return fmt.Errorf("unknown source type: %s", sourceType)
+		return err
 	}
 
+	if m.onDemand {
+		// The source is started by reconcileDemand once viewers need it
+		previous, switched := m.switchTo(st)
+		m.mu.Unlock()
+		if switched {
+			m.publishSwitch(st, previous)
+		}
+		m.reconcileDemand()
+		return nil
+	}
+
+	// Start if not running
+	started := false
+	if !src.IsRunning() {
+		if err := src.Start(m.lifetimeLocked()); err != nil {
+			m.mu.Unlock()
+			return fmt.Errorf("failed to start %s client: %w", strings.ToUpper(st), err)
+		}
+		started = true
+	}
+	previous, switched := m.switchTo(st)
 	m.mu.Unlock()
+	logrus.Infof("✅ Started %s source", strings.ToUpper(st))
+	if started {
+		m.publish(events.SourceStarted, st, nil)
+	}
+	if switched {
+		m.publishSwitch(st, previous)
+	}
 	return nil
 }
 
 func (m *Manager) StopCurrentSource() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.stopCurrentSource()
+	st := m.stopCurrentSource()
+	m.mu.Unlock()
+	if st != "" {
+		m.publish(events.SourceStopped, st, nil)
+	}
 }
 
-func (m *Manager) stopCurrentSource() {
-	if m.currentSource == "" {
-		return
+// stopCurrentSource stops the active source and returns the one it stopped.
+// Callers must hold mu.
+func (m *Manager) stopCurrentSource() string {
+	st := m.currentSource
+	if st == "" {
+		return ""
 	}
 
-	switch m.currentSource {
-	case "rtmp":
-		if m.rtmpClient != nil {
-			m.rtmpClient.Stop()
-			logrus.Info("🛑 Stopped RTMP source")
-		}
-	case "rtsp":
-		if m.rtspClient != nil {
-			m.rtspClient.Stop()
-			logrus.Info("🛑 Stopped RTSP source")
-		}
-	}
 	m.currentSource = ""
+	if src, ok := m.sources[st]; ok {
+		src.Stop()
+		logrus.Infof("🛑 Stopped %s source", strings.ToUpper(st))
+		return st
+	}
+	return ""
 }
 
 func (m *Manager) GetCurrentSource() string {
@@ -145,89 +450,229 @@ func (m *Manager) GetCurrentSource() string {
 func (m *Manager) GetAvailableSources() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.sourceTypes()
+}
+
+func (m *Manager) IsSourceRunning() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	src, ok := m.sources[m.currentSource]
+	return ok && src.IsRunning()
+}
+
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	var sources []string
-	if m.rtmpClient != nil || m.rtmpURL != "" {
-		sources = append(sources, "rtmp")
+	for _, src := range m.sources {
+		src.Stop()
 	}
-	if m.rtspClient != nil || m.rtspURL != "" {
-		sources = append(sources, "rtsp")
+	for _, monitor := range m.audioMonitors {
+		monitor.Stop()
 	}
-	return sources
+	m.currentSource = ""
 }
 
-func (m *Manager) IsSourceRunning() bool {
+// EnableOpus delivers the audio of sources that can transcode it to
+// viewers, encoded with opts. Running sources pick it up when their
+// pipeline next starts.
+func (m *Manager) EnableOpus(opts audio.OpusOptions) {
+	m.mu.Lock()
+	m.opus = &opts
+	sources := make([]Source, 0, len(m.sources))
+	for _, src := range m.sources {
+		sources = append(sources, src)
+	}
+	m.mu.Unlock()
+
+	for _, src := range sources {
+		m.applyOpus(src)
+	}
+}
+
+// AudioFeed returns the Ogg Opus pages of a source's audio. Sources carry
+// audio only once EnableOpus was called, and only RTSP and RTMP ones.
+func (m *Manager) AudioFeed(sourceType string) (*audio.Feed, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.currentSource == "" {
-		return false
+	st := normalize(sourceType)
+	src, err := m.lookup(st)
+	if err != nil {
+		return nil, err
+	}
+	as, ok := src.(AudioSource)
+	if !ok || m.opus == nil {
+		return nil, fmt.Errorf("%s source has no audio", strings.ToUpper(st))
 	}
+	return as.AudioFeed(), nil
+}
 
-	switch m.currentSource {
-	case "rtmp":
-		return m.rtmpClient != nil && m.rtmpClient.IsRunning()
-	case "rtsp":
-		return m.rtspClient != nil && m.rtspClient.IsRunning()
+// applyOpus passes the Opus options, if any, to a source.
+func (m *Manager) applyOpus(src Source) {
+	as, ok := src.(AudioSource)
+	if !ok {
+		return
+	}
+	m.mu.RLock()
+	opts := m.opus
+	m.mu.RUnlock()
+	if opts != nil {
+		as.SetOpus(*opts)
 	}
-	return false
 }
 
-func (m *Manager) Stop() {
+// EnableAudioLevels starts an audio level monitor for every configured source
+// with audio, metering the audio it delivers to viewers. Levels of the
+// active source are broadcast to peers over the data channel.
+func (m *Manager) EnableAudioLevels(ctx context.Context, cfg audio.MeterConfig) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.audioCtx, m.audioCfg = ctx, &cfg
+
+	for sourceType, src := range m.sources {
+		as, ok := src.(AudioSource)
+		if !ok || m.urls[sourceType] == "" || m.audioMonitors[sourceType] != nil {
+			continue
+		}
 
-	if m.rtmpClient != nil {
-		m.rtmpClient.Stop()
+		sourceType := sourceType
+		wasSilent := false
+		meter := audio.NewMeter(cfg, func(level audio.Level) {
+			if level.Silent != wasSilent {
+				wasSilent = level.Silent
+				if level.Silent {
+					logrus.Warnf("🔇 %s audio silent for at least %s", sourceType, cfg.SilenceDuration)
+				} else {
+					logrus.Infof("🔊 %s audio resumed", sourceType)
+				}
+			}
+			if m.GetCurrentSource() != sourceType {
+				return
+			}
+			m.webrtcManager.Broadcast(AudioLevelMessage{Type: "audio_level", Source: sourceType, Level: level})
+		})
+
+		monitor := audio.NewMonitor(as.AudioFeed(), meter)
+		if err := monitor.Start(ctx); err != nil {
+			logrus.Errorf("Failed to start %s audio level monitor: %v", sourceType, err)
+			continue
+		}
+		m.audioMonitors[sourceType] = monitor
+		logrus.Infof("Started %s audio level monitor (interval %s)", sourceType, cfg.Interval.Round(time.Millisecond))
 	}
-	if m.rtspClient != nil {
-		m.rtspClient.Stop()
+}
+
+// SetContext sets the context sources and sinks started from now on run
+// under, whether by StartAll, on demand, or for an API request, so they
+// stop with the server rather than with the request.
+func (m *Manager) SetContext(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+}
+
+// lifetimeLocked returns the context sources and sinks are started with.
+// Callers must hold mu.
+func (m *Manager) lifetimeLocked() context.Context {
+	if m.ctx == nil {
+		return context.Background()
 	}
-	m.currentSource = ""
+	return m.ctx
 }
 
-// StartAll starts both sources if configured. Active output is controlled by currentSource.
+// StartAll starts every configured source. Active output is controlled by currentSource.
+// It does nothing when sources run on demand.
 func (m *Manager) StartAll(ctx context.Context) {
 	m.mu.Lock()
-	rtsp := m.rtspClient
-	rtmpc := m.rtmpClient
+	if m.ctx == nil {
+		m.ctx = ctx
+	}
+	sources := make(map[string]Source, len(m.sources))
+	for st, src := range m.sources {
+		sources[st] = src
+	}
+	onDemand := m.onDemand
 	m.mu.Unlock()
 
-	if rtmpc != nil && !rtmpc.IsRunning() {
-		go func() {
-			if err := rtmpc.Start(ctx); err != nil {
-				logrus.Errorf("RTMP client start error: %v", err)
-			}
-		}()
+	if onDemand {
+		return
 	}
-	if rtsp != nil && !rtsp.IsRunning() {
+
+	for st, src := range sources {
+		if src.IsRunning() {
+			continue
+		}
+		st, src := st, src
 		go func() {
-			if err := rtsp.Start(ctx); err != nil {
-				logrus.Errorf("RTSP client start error: %v", err)
+			if err := src.Start(ctx); err != nil {
+				logrus.Errorf("%s client start error: %v", strings.ToUpper(st), err)
+				return
 			}
+			m.publish(events.SourceStarted, st, nil)
 		}()
 	}
 }
 
+// GetSourceURL returns the upstream URL configured for a source.
+func (m *Manager) GetSourceURL(sourceType string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	st := normalize(sourceType)
+	if _, err := m.lookup(st); err != nil {
+		return "", err
+	}
+	return m.urls[st], nil
+}
+
+// GetSourceStats returns throughput counters for the named source client.
+func (m *Manager) GetSourceStats(sourceType string) (stats.Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	src, err := m.lookup(normalize(sourceType))
+	if err != nil {
+		return stats.Snapshot{}, err
+	}
+	return src.Health(), nil
+}
+
+// GetAllSourceStats returns throughput counters keyed by source type for every initialized client.
+func (m *Manager) GetAllSourceStats() map[string]stats.Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make(map[string]stats.Snapshot)
+	for st, src := range m.sources {
+		all[st] = src.Health()
+	}
+	return all
+}
+
 // SetActiveSource switches the active output without starting/stopping clients.
 func (m *Manager) SetActiveSource(sourceType string) error {
 	st := normalize(sourceType)
-	if st != "rtsp" && st != "rtmp" {
-		return fmt.Errorf("unknown source type: %s", sourceType)
-	}
 	m.mu.Lock()
-	m.currentSource = st
+	if _, err := m.lookup(st); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	previous, switched := m.switchTo(st)
 	m.mu.Unlock()
+	if switched {
+		m.publishSwitch(st, previous)
+	}
+	m.reconcileDemand()
 	return nil
 }
 
+// redactURL hides the credentials of a URL for logging and the API.
+func redactURL(raw string) string {
+	return redact.String(raw)
+}
+
 func normalize(s string) string {
-	switch s {
-	case "RTMP", "rtmp", "Rtmp":
-		return "rtmp"
-	case "RTSP", "rtsp", "Rtsp":
-		return "rtsp"
-	default:
-		return s
-	}
+	return strings.ToLower(strings.TrimSpace(s))
 }
@@ -0,0 +1,72 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+
+	"github.com/sirupsen/logrus"
+)
+
+// prewarmPollInterval is how often Prewarm checks for the first keyframe
+const prewarmPollInterval = 100 * time.Millisecond
+
+// Prewarm starts a source if needed and waits until it has produced a
+// keyframe or ctx expires. In on-demand mode the source is held running for
+// hold afterwards, so viewers arriving within that time join instantly;
+// otherwise a stopped source is started and keeps running like any other.
+func (m *Manager) Prewarm(ctx context.Context, sourceType string, hold time.Duration) (time.Duration, error) {
+	st := normalize(sourceType)
+	started := time.Now()
+
+	m.mu.RLock()
+	onDemand := m.onDemand
+	m.mu.RUnlock()
+
+	if onDemand {
+		release, err := m.Acquire(st, "prewarm")
+		if err != nil {
+			return 0, err
+		}
+		time.AfterFunc(hold, release)
+	} else if err := m.startStopped(st); err != nil {
+		return 0, err
+	}
+
+	ticker := time.NewTicker(prewarmPollInterval)
+	defer ticker.Stop()
+	for {
+		snap, err := m.GetSourceStats(st)
+		if err == nil && snap.Running && snap.Keyframes > 0 {
+			return time.Since(started), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return time.Since(started), fmt.Errorf("no keyframe from %s source within %s", st, time.Since(started).Round(time.Millisecond))
+		case <-ticker.C:
+		}
+	}
+}
+
+// startStopped starts a source that is not running, without making it the
+// active one.
+func (m *Manager) startStopped(st string) error {
+	m.mu.Lock()
+	src, err := m.lookup(st)
+	if err != nil || src.IsRunning() {
+		m.mu.Unlock()
+		return err
+	}
+	err = src.Start(m.lifetimeLocked())
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to start %s client: %w", strings.ToUpper(st), err)
+	}
+	logrus.Infof("✅ Started %s source to prewarm it", strings.ToUpper(st))
+	m.publish(events.SourceStarted, st, map[string]interface{}{"prewarm": true})
+	return nil
+}
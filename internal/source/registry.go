@@ -0,0 +1,160 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang-webrtc-streaming/internal/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Registration is a source added through the API, persisted so it is
+// restored on the next start.
+type Registration struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// streamNamePattern keeps configured stream names usable in API paths
+var streamNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidStreamName reports whether a name is usable for a stream, in API
+// paths among others.
+func ValidStreamName(name string) bool {
+	return streamNamePattern.MatchString(name)
+}
+
+// ParseStreams reads streams configured as "name=url,name2=url2". Names are
+// case-insensitive and URLs must be RTSP or RTMP.
+func ParseStreams(spec string) ([]Registration, error) {
+	var streams []Registration
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		name := normalize(kv[0])
+		if len(kv) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid stream %q, expected name=url", entry)
+		}
+		if !streamNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid stream name %q, use letters, digits, '-' and '_'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("stream %s is listed twice", name)
+		}
+		seen[name] = true
+
+		rawURL := strings.TrimSpace(kv[1])
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL of stream %s", name)
+		}
+		switch u.Scheme {
+		case "rtsp", "rtsps", "rtmp", "rtmps":
+		default:
+			return nil, fmt.Errorf("stream %s must use an rtsp:// or rtmp:// URL", name)
+		}
+		streams = append(streams, Registration{Type: name, URL: rawURL})
+	}
+	return streams, nil
+}
+
+// InitializeStreams adds the streams configured at startup. Like sources
+// from RTSP_URL and RTMP_URL they are not persisted, and take precedence
+// over persisted registrations of the same name.
+func (m *Manager) InitializeStreams(streams []Registration) {
+	for _, reg := range streams {
+		if err := m.AddSource(reg.Type, reg.URL); err != nil {
+			logrus.Errorf("Failed to initialize stream %s: %v", reg.Type, err)
+		}
+	}
+}
+
+// SetState persists sources registered through the API in db.
+func (m *Manager) SetState(db *state.Store) {
+	m.mu.Lock()
+	m.state = db
+	m.mu.Unlock()
+}
+
+// RestoreSources adds every persisted registration whose type is not
+// already configured, e.g. through environment variables.
+func (m *Manager) RestoreSources() error {
+	m.mu.RLock()
+	db := m.state
+	m.mu.RUnlock()
+	if db == nil {
+		return nil
+	}
+
+	persisted, err := db.List(state.BucketSources)
+	if err != nil {
+		return err
+	}
+	for id, data := range persisted {
+		var reg Registration
+		if err := json.Unmarshal(data, &reg); err != nil {
+			logrus.Warnf("Skipping unreadable source registration %s: %v", id, err)
+			continue
+		}
+		if _, err := m.GetSourceURL(reg.Type); err == nil {
+			logrus.Warnf("Persisted %s source ignored, it is already configured", reg.Type)
+			continue
+		}
+		if err := m.AddSource(reg.Type, reg.URL); err != nil {
+			logrus.Warnf("Failed to restore %s source: %v", reg.Type, err)
+		}
+	}
+	return nil
+}
+
+// RegisterSource adds a source and persists it.
+func (m *Manager) RegisterSource(reg Registration) error {
+	reg.Type = normalize(reg.Type)
+	if err := m.AddSource(reg.Type, reg.URL); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	db := m.state
+	m.mu.RUnlock()
+	if db == nil {
+		return nil
+	}
+	if err := db.Put(state.BucketSources, reg.Type, reg); err != nil {
+		m.RemoveSource(reg.Type)
+		return err
+	}
+	return nil
+}
+
+// UnregisterSource removes a source, its persisted registration, its
+// transform, and its blackout. Sources
+// configured through the environment come back on the next start.
+func (m *Manager) UnregisterSource(sourceType string) error {
+	st := normalize(sourceType)
+	if err := m.RemoveSource(st); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	db := m.state
+	m.mu.RUnlock()
+	if db == nil {
+		return nil
+	}
+	if err := db.Delete(state.BucketTransforms, st); err != nil {
+		return err
+	}
+	if err := db.Delete(state.BucketBlackouts, st); err != nil {
+		return err
+	}
+	return db.Delete(state.BucketSources, st)
+}
@@ -0,0 +1,211 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink is an output attached to one stream, such as WebRTC fan-out or the
+// recorder. Sinks are enabled and disabled independently of each other and
+// of the source feeding them.
+type Sink interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop() error
+	IsRunning() bool
+}
+
+// FrameSink is a sink fed from the stream's media bus. WriteAccessUnit is
+// called for every access unit of the source, in order, and must not block.
+// Sinks that only implement Sink read the upstream themselves, e.g. because
+// they need audio as well.
+type FrameSink interface {
+	Sink
+	WriteAccessUnit(au AccessUnit)
+}
+
+// AudioSink is a frame sink that is also fed the audio of sources that
+// deliver it. WriteAudio must not block either.
+type AudioSink interface {
+	FrameSink
+	WriteAudio(sample AudioSample)
+}
+
+// SinkStatus describes a sink attached to a stream.
+type SinkStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	// Bus is set for sinks fed from the source's frames
+	Bus bool `json:"bus"`
+}
+
+// AttachSink adds an output to a stream. Attaching neither starts nor stops
+// the sink.
+func (m *Manager) AttachSink(streamID string, sink Sink) error {
+	st := normalize(streamID)
+
+	m.mu.Lock()
+	if _, err := m.lookup(st); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	for _, existing := range m.sinks[st] {
+		if existing.Name() == sink.Name() {
+			m.mu.Unlock()
+			return fmt.Errorf("sink %s already attached to %s", sink.Name(), st)
+		}
+	}
+	m.sinks[st] = append(m.sinks[st], sink)
+	sort.Slice(m.sinks[st], func(i, j int) bool { return m.sinks[st][i].Name() < m.sinks[st][j].Name() })
+	blackedOut := m.blackouts[st] != nil
+	m.mu.Unlock()
+
+	if bs, ok := sink.(BlackoutSink); ok && blackedOut {
+		bs.SetBlackout(true)
+	}
+	logrus.Infof("Attached %s sink to %s", sink.Name(), st)
+	return nil
+}
+
+// EnableSink starts a sink attached to a stream. The sink lives until it is
+// disabled, not just for the caller's request.
+func (m *Manager) EnableSink(streamID, name string) error {
+	sink, err := m.sink(streamID, name)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	ctx := m.lifetimeLocked()
+	m.mu.RUnlock()
+	if sink.IsRunning() {
+		return nil
+	}
+	if err := sink.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start %s sink: %w", name, err)
+	}
+	logrus.Infof("▶️ Enabled %s sink of %s", name, normalize(streamID))
+	m.publish(events.SinkEnabled, normalize(streamID), map[string]interface{}{"sink": name})
+	return nil
+}
+
+// DisableSink stops a sink attached to a stream without affecting its other
+// outputs or the source.
+func (m *Manager) DisableSink(streamID, name string) error {
+	sink, err := m.sink(streamID, name)
+	if err != nil {
+		return err
+	}
+	if !sink.IsRunning() {
+		return nil
+	}
+	if err := sink.Stop(); err != nil {
+		return fmt.Errorf("failed to stop %s sink: %w", name, err)
+	}
+	logrus.Infof("⏹️ Disabled %s sink of %s", name, normalize(streamID))
+	m.publish(events.SinkDisabled, normalize(streamID), map[string]interface{}{"sink": name})
+	return nil
+}
+
+// Sinks lists the outputs attached to a stream.
+func (m *Manager) Sinks(streamID string) ([]SinkStatus, error) {
+	st := normalize(streamID)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, err := m.lookup(st); err != nil {
+		return nil, err
+	}
+	return m.sinkStatuses(st), nil
+}
+
+// sinkStatuses lists the outputs of a known stream. Callers must hold mu.
+func (m *Manager) sinkStatuses(st string) []SinkStatus {
+	out := make([]SinkStatus, 0, len(m.sinks[st]))
+	for _, sink := range m.sinks[st] {
+		_, bus := sink.(FrameSink)
+		out = append(out, SinkStatus{Name: sink.Name(), Running: sink.IsRunning(), Bus: bus})
+	}
+	return out
+}
+
+func (m *Manager) sink(streamID, name string) (Sink, error) {
+	st := normalize(streamID)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, err := m.lookup(st); err != nil {
+		return nil, err
+	}
+	for _, sink := range m.sinks[st] {
+		if sink.Name() == name {
+			return sink, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s sink attached to %s", name, st)
+}
+
+// frameSinks returns the running sinks of a stream that read its frames.
+func (m *Manager) frameSinks(streamID string) []FrameSink {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []FrameSink
+	for _, sink := range m.sinks[streamID] {
+		if fs, ok := sink.(FrameSink); ok && fs.IsRunning() {
+			out = append(out, fs)
+		}
+	}
+	return out
+}
+
+// webrtcSink fans a stream out to the WebRTC peers watching it.
+type webrtcSink struct {
+	manager *webrtc.Manager
+	stream  string
+	mu      sync.RWMutex
+	enabled bool
+}
+
+func newWebRTCSink(manager *webrtc.Manager, stream string) *webrtcSink {
+	return &webrtcSink{manager: manager, stream: stream, enabled: true}
+}
+
+func (s *webrtcSink) Name() string { return "webrtc" }
+
+func (s *webrtcSink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.enabled = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *webrtcSink) Stop() error {
+	s.mu.Lock()
+	s.enabled = false
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *webrtcSink) IsRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled
+}
+
+func (s *webrtcSink) WriteAccessUnit(au AccessUnit) {
+	s.manager.WriteStreamVideoSample(s.stream, au.Data, au.Timestamp)
+}
+
+func (s *webrtcSink) WriteAudio(sample AudioSample) {
+	s.manager.WriteStreamAudioSample(s.stream, sample.Data, sample.Timestamp)
+}
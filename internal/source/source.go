@@ -0,0 +1,86 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/rtmp"
+	"golang-webrtc-streaming/internal/rtsp"
+	"golang-webrtc-streaming/internal/stats"
+	"golang-webrtc-streaming/internal/stdin"
+)
+
+// AccessUnit is one unit of video produced by a source.
+type AccessUnit = media.AccessUnit
+
+// AudioSample is one Opus packet of audio produced by a source.
+type AudioSample = media.AudioSample
+
+// Source is an ingest pipeline the manager can switch between. Frames must
+// return the same channel for the lifetime of the source; it is read for as
+// long as the manager runs, across restarts.
+type Source interface {
+	Start(ctx context.Context) error
+	Stop() error
+	IsRunning() bool
+	Frames() <-chan AccessUnit
+	Health() stats.Snapshot
+}
+
+// AudioSource is a source that can transcode its audio to Opus for viewers
+// once given encoder options. Audio must return the same channel for the
+// lifetime of the source, like Frames, and AudioFeed the same feed of the
+// Ogg pages the packets came in, which the level meter and audio-only
+// streams decode.
+type AudioSource interface {
+	SetOpus(opts audio.OpusOptions)
+	Audio() <-chan AudioSample
+	AudioFeed() *audio.Feed
+}
+
+// Factory creates a source reading from url.
+type Factory func(url string) Source
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		"rtmp":  func(url string) Source { return rtmp.NewClient(url) },
+		"rtsp":  func(url string) Source { return rtsp.NewClient(url) },
+		"stdin": func(url string) Source { return stdin.NewClient(url) },
+	}
+)
+
+// RegisterType makes a source type available to every manager. Registering
+// an existing name replaces its factory.
+func RegisterType(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[normalize(name)] = factory
+}
+
+// Types returns the registered source type names in sorted order.
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newSource(sourceType, url string) (Source, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[sourceType]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type: %s", sourceType)
+	}
+	return factory(url), nil
+}
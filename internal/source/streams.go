@@ -0,0 +1,56 @@
+package source
+
+import (
+	"golang-webrtc-streaming/internal/stats"
+)
+
+// Stream states reported by Streams
+const (
+	StreamRunning = "running"
+	StreamStopped = "stopped"
+	// StreamIdle is an on-demand stream that nothing currently needs
+	StreamIdle = "idle"
+)
+
+// StreamInfo describes a stream and the source feeding it.
+type StreamInfo struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Active is set for the stream new viewers are given
+	Active bool `json:"active"`
+	// URL is the source's upstream URL with its password redacted
+	URL   string         `json:"url"`
+	Stats stats.Snapshot `json:"stats"`
+	Sinks []SinkStatus   `json:"sinks"`
+	// BlackedOut is set while the stream's media is replaced by a slate
+	BlackedOut bool `json:"blacked_out"`
+}
+
+// Streams describes every stream, sorted by ID.
+func (m *Manager) Streams() []StreamInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]StreamInfo, 0, len(m.sources))
+	for _, st := range m.sourceTypes() {
+		src := m.sources[st]
+		state := StreamStopped
+		switch {
+		case src.IsRunning():
+			state = StreamRunning
+		case m.onDemand && !m.wanted[st]:
+			state = StreamIdle
+		}
+		out = append(out, StreamInfo{
+			ID:     st,
+			State:  state,
+			Active: st == m.currentSource,
+			URL:    redactURL(m.urls[st]),
+			Stats:  src.Health(),
+			Sinks:  m.sinkStatuses(st),
+
+			BlackedOut: m.blackouts[st] != nil,
+		})
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"fmt"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transformer is a source that can rotate and crop its picture while
+// running, restarting its pipeline behind the scenes.
+type Transformer interface {
+	Transform() ffmpeg.Transform
+	SetTransform(t ffmpeg.Transform) error
+}
+
+// transformer returns the source of a stream if it supports transforms.
+// Callers must hold mu.
+func (m *Manager) transformer(st string) (Transformer, error) {
+	src, err := m.lookup(st)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := src.(Transformer)
+	if !ok {
+		return nil, fmt.Errorf("%s source does not support rotation and cropping", st)
+	}
+	return t, nil
+}
+
+// Transform returns the rotation and crop of a stream.
+func (m *Manager) Transform(streamID string) (ffmpeg.Transform, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, err := m.transformer(normalize(streamID))
+	if err != nil {
+		return ffmpeg.Transform{}, err
+	}
+	return t.Transform(), nil
+}
+
+// SetTransform changes the rotation and crop of a stream and persists them,
+// so they also apply after a restart or when the stream's URL changes. As
+// with SetEncoding, viewers stay connected while the pipeline restarts.
+func (m *Manager) SetTransform(streamID string, transform ffmpeg.Transform) error {
+	st := normalize(streamID)
+	if err := transform.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	t, err := m.transformer(st)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	restart := m.sources[st].IsRunning()
+	db := m.state
+	m.mu.Unlock()
+
+	if db != nil {
+		if transform.IsZero() {
+			err = db.Delete(state.BucketTransforms, st)
+		} else {
+			err = db.Put(state.BucketTransforms, st, transform)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if restart {
+		m.webrtcManager.ResyncVideo(st, fmt.Sprintf("%s transform changed", st))
+	}
+	return t.SetTransform(transform)
+}
+
+// restoreTransform applies the persisted transform of a stream to a new
+// source of it.
+func (m *Manager) restoreTransform(st string, src Source) {
+	t, ok := src.(Transformer)
+	if !ok {
+		return
+	}
+	m.mu.RLock()
+	db := m.state
+	m.mu.RUnlock()
+	if db == nil {
+		return
+	}
+
+	var transform ffmpeg.Transform
+	found, err := db.Get(state.BucketTransforms, st, &transform)
+	if err != nil {
+		logrus.Warnf("Failed to load transform of %s: %v", st, err)
+		return
+	}
+	if !found {
+		return
+	}
+	if err := t.SetTransform(transform); err != nil {
+		logrus.Warnf("Failed to apply transform of %s: %v", st, err)
+	}
+}
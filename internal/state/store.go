@@ -0,0 +1,186 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// Buckets used by the server's components
+const (
+	BucketSources    = "sources"
+	BucketMetadata   = "metadata"
+	BucketSchedules  = "schedules"
+	BucketCameras    = "cameras"
+	BucketTransforms = "transforms"
+	BucketUsage      = "usage"
+	BucketBlackouts  = "blackouts"
+	BucketFlags      = "flags"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS entries (
+	bucket          TEXT    NOT NULL,
+	key             TEXT    NOT NULL,
+	value           TEXT    NOT NULL,
+	updated_unix_ms INTEGER NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+`
+
+// Store persists runtime configuration as JSON values grouped in buckets, so
+// changes made through the API survive restarts.
+type Store struct {
+	db *sql.DB
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store: %w", err)
+	}
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create state store schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put stores v as JSON under key, replacing any previous value.
+func (s *Store) Put(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", bucket, key, err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO entries (bucket, key, value, updated_unix_ms) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value, updated_unix_ms = excluded.updated_unix_ms`,
+		bucket, key, string(data), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Get decodes the value under key into v and reports whether it exists.
+func (s *Store) Get(bucket, key string, v interface{}) (bool, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT value FROM entries WHERE bucket = ? AND key = ?`, bucket, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load %s/%s: %w", bucket, key, err)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, fmt.Errorf("failed to decode %s/%s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Delete removes key from a bucket. Deleting a missing key is not an error.
+func (s *Store) Delete(bucket, key string) error {
+	if _, err := s.db.Exec(`DELETE FROM entries WHERE bucket = ? AND key = ?`, bucket, key); err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// List returns the raw JSON values of a bucket keyed by key.
+func (s *Store) List(bucket string) (map[string]json.RawMessage, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM entries WHERE bucket = ?`, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", bucket, err)
+		}
+		out[key] = json.RawMessage(value)
+	}
+	return out, rows.Err()
+}
+
+// ImportJSONFile moves the entries of a legacy JSON object file into a
+// bucket, keeping values already in the store, and renames the file so the
+// import runs once. A missing file is not an error.
+func (s *Store) ImportJSONFile(bucket, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for key, value := range entries {
+		_, err := s.db.Exec(
+			`INSERT INTO entries (bucket, key, value, updated_unix_ms) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (bucket, key) DO NOTHING`,
+			bucket, key, string(value), time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to import %s/%s: %w", bucket, key, err)
+		}
+	}
+
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return fmt.Errorf("failed to rename %s after import: %w", path, err)
+	}
+	logrus.Infof("Imported %d %s entries from %s", len(entries), bucket, path)
+	return nil
+}
+
+// PutAll stores several values of a bucket in one transaction, so either
+// all of them are saved or none are.
+func (s *Store) PutAll(bucket string, values map[string]interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin %s transaction: %w", bucket, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	for key, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s/%s: %w", bucket, key, err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO entries (bucket, key, value, updated_unix_ms) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value, updated_unix_ms = excluded.updated_unix_ms`,
+			bucket, key, string(data), now)
+		if err != nil {
+			return fmt.Errorf("failed to save %s/%s: %w", bucket, key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s transaction: %w", bucket, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// SourceStats tracks throughput counters for a single source client.
+// All methods are safe for concurrent use.
+type SourceStats struct {
+	mu               sync.Mutex
+	startedAt        time.Time
+	frames           uint64
+	bytes            uint64
+	keyframes        uint64
+	lastFrameAt      time.Time
+	lastKeyframeAt   time.Time
+	keyframeInterval time.Duration
+	inKeyframe       bool
+	// Restarts and stalls survive MarkStarted so they reflect the source's history
+	restarts uint64
+	stalls   uint64
+	pipeline string
+	// Bitrate is measured over rolling one-second windows
+	windowStart time.Time
+	windowBytes uint64
+	bitrate     float64
+}
+
+// Snapshot is a point-in-time copy of SourceStats suitable for JSON encoding.
+type Snapshot struct {
+	Running                 bool    `json:"running"`
+	Frames                  uint64  `json:"frames"`
+	Bytes                   uint64  `json:"bytes"`
+	Keyframes               uint64  `json:"keyframes"`
+	BitrateBps              float64 `json:"bitrate_bps"`
+	KeyframeIntervalSeconds float64 `json:"keyframe_interval_seconds"`
+	UptimeSeconds           float64 `json:"uptime_seconds"`
+	LastFrameAgeSeconds     float64 `json:"last_frame_age_seconds"`
+	Restarts                uint64  `json:"restarts"`
+	Stalls                  uint64  `json:"stalls"`
+	// Pipeline is "passthrough" when the source is copied, "transcode" when re-encoded
+	Pipeline string `json:"pipeline,omitempty"`
+}
+
+// stallGap is the inter-frame gap counted as a break in frame continuity
+const stallGap = time.Second
+
+func NewSourceStats() *SourceStats {
+	return &SourceStats{}
+}
+
+// MarkStarted resets the counters and starts the uptime clock.
+func (s *SourceStats) MarkStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.startedAt = now
+	s.frames = 0
+	s.bytes = 0
+	s.keyframes = 0
+	s.lastFrameAt = time.Time{}
+	s.lastKeyframeAt = time.Time{}
+	s.keyframeInterval = 0
+	s.inKeyframe = false
+	s.windowStart = now
+	s.windowBytes = 0
+	s.bitrate = 0
+	s.pipeline = ""
+}
+
+// MarkRestart counts a restart of the source pipeline after a failure.
+func (s *SourceStats) MarkRestart() {
+	s.mu.Lock()
+	s.restarts++
+	s.mu.Unlock()
+}
+
+// MarkStopped stops the uptime clock but keeps the counters for inspection.
+func (s *SourceStats) MarkStopped() {
+	s.mu.Lock()
+	s.startedAt = time.Time{}
+	s.bitrate = 0
+	s.mu.Unlock()
+}
+
+// SetPipeline records how the source is being processed.
+func (s *SourceStats) SetPipeline(pipeline string) {
+	s.mu.Lock()
+	s.pipeline = pipeline
+	s.mu.Unlock()
+}
+
+// RecordFrame accounts for one H.264 unit read from the source pipeline.
+func (s *SourceStats) RecordFrame(data []byte) {
+	now := time.Now()
+	nalType := NALType(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastFrameAt.IsZero() && now.Sub(s.lastFrameAt) > stallGap {
+		s.stalls++
+	}
+	s.frames++
+	s.bytes += uint64(len(data))
+	s.lastFrameAt = now
+
+	// Consecutive IDR slices belong to the same keyframe
+	switch {
+	case nalType == 5 && !s.inKeyframe:
+		s.keyframes++
+		if !s.lastKeyframeAt.IsZero() {
+			s.keyframeInterval = now.Sub(s.lastKeyframeAt)
+		}
+		s.lastKeyframeAt = now
+		s.inKeyframe = true
+	case nalType >= 1 && nalType <= 4:
+		s.inKeyframe = false
+	}
+
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	s.windowBytes += uint64(len(data))
+	if elapsed := now.Sub(s.windowStart); elapsed >= time.Second {
+		s.bitrate = float64(s.windowBytes*8) / elapsed.Seconds()
+		s.windowStart = now
+		s.windowBytes = 0
+	}
+}
+
+func (s *SourceStats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := Snapshot{
+		Running:                 !s.startedAt.IsZero(),
+		Frames:                  s.frames,
+		Bytes:                   s.bytes,
+		Keyframes:               s.keyframes,
+		BitrateBps:              s.bitrate,
+		KeyframeIntervalSeconds: s.keyframeInterval.Seconds(),
+		Restarts:                s.restarts,
+		Stalls:                  s.stalls,
+		Pipeline:                s.pipeline,
+	}
+	if !s.startedAt.IsZero() {
+		snap.UptimeSeconds = time.Since(s.startedAt).Seconds()
+	}
+	if !s.lastFrameAt.IsZero() {
+		snap.LastFrameAgeSeconds = time.Since(s.lastFrameAt).Seconds()
+	}
+	return snap
+}
+
+// NALType returns the H.264 NAL unit type of data, skipping a leading start
+// code if present. It returns 0 when data is too short.
+func NALType(data []byte) byte {
+	switch {
+	case len(data) >= 5 && data[0] == 0x00 && data[1] == 0x00 && data[2] == 0x00 && data[3] == 0x01:
+		return data[4] & 0x1F
+	case len(data) >= 4 && data[0] == 0x00 && data[1] == 0x00 && data[2] == 0x01:
+		return data[3] & 0x1F
+	case len(data) >= 1:
+		return data[0] & 0x1F
+	}
+	return 0
+}
@@ -0,0 +1,308 @@
+// Package stdin reads H.264 pushed by a local process, over the server's
+// standard input or a named pipe, so capture tools need no network protocol.
+package stdin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Client reads an H.264 elementary stream or MPEG-TS from standard input or
+// a named pipe. Video is copied, never transcoded.
+type Client struct {
+	// path is a named pipe, or empty for standard input
+	path      string
+	cmd       *exec.Cmd
+	isRunning bool
+	// stdinClosed is set once standard input ended; it cannot be reopened
+	stdinClosed bool
+	mu          sync.RWMutex
+	stats       *stats.SourceStats
+	frames      chan media.AccessUnit
+	cancel      context.CancelFunc
+	runCtx      context.Context
+}
+
+// NewClient reads from the named pipe at path, or from standard input if
+// path is "-" or "stdin".
+func NewClient(path string) *Client {
+	path = strings.TrimPrefix(path, "file://")
+	if path == "-" || strings.EqualFold(path, "stdin") {
+		path = ""
+	}
+	return &Client{
+		path:   path,
+		stats:  stats.NewSourceStats(),
+		frames: make(chan media.AccessUnit, media.FrameBuffer),
+	}
+}
+
+func (c *Client) name() string {
+	if c.path == "" {
+		return "standard input"
+	}
+	return c.path
+}
+
+func (c *Client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.isRunning {
+		c.mu.Unlock()
+		return fmt.Errorf("stdin client is already running")
+	}
+	if c.stdinClosed {
+		c.mu.Unlock()
+		return fmt.Errorf("standard input is closed")
+	}
+	if c.path != "" {
+		info, err := os.Stat(c.path)
+		if err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("open named pipe: %w", err)
+		}
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			c.mu.Unlock()
+			return fmt.Errorf("%s is not a named pipe", c.path)
+		}
+	}
+	c.isRunning = true
+	// Stop cancels the supervisor so it does not restart ffmpeg
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.runCtx = ctx
+	c.mu.Unlock()
+
+	c.stats.MarkStarted()
+	c.stats.SetPipeline("passthrough")
+	logrus.Infof("Starting stdin client for: %s", c.name())
+
+	go c.supervise(ctx)
+	return nil
+}
+
+// supervise restarts ffmpeg whenever it exits, e.g. because the writer of
+// the pipe went away; opening the pipe again waits for the next writer.
+// Standard input cannot be reopened, so the client stops once it ends.
+func (c *Client) supervise(ctx context.Context) {
+	defer func() {
+		// Leave the state alone if the client was restarted meanwhile
+		c.mu.Lock()
+		if c.runCtx == ctx {
+			c.isRunning = false
+			c.stats.MarkStopped()
+		}
+		c.mu.Unlock()
+	}()
+
+	backoff := time.Second
+	const maxBackoff = time.Second * 10
+
+	for {
+		framesBefore := c.stats.Snapshot().Frames
+		if err := c.runOnce(ctx); err != nil {
+			logrus.Errorf("Stdin pipeline error: %v", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		c.mu.RLock()
+		closed := c.stdinClosed
+		c.mu.RUnlock()
+		if closed {
+			logrus.Infof("Standard input closed, stdin source stopped")
+			return
+		}
+		// A writer that delivered video may simply have reconnected
+		if c.stats.Snapshot().Frames > framesBefore {
+			backoff = time.Second
+		}
+
+		c.stats.MarkRestart()
+		logrus.Infof("Stdin source restarting in %s...", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+func (c *Client) runOnce(ctx context.Context) error {
+	input := c.path
+	if input == "" {
+		input = "pipe:0"
+	}
+	// ffmpeg probes whether the input is an elementary stream or MPEG-TS;
+	// SPS/PPS are repeated at every keyframe so late joiners can decode
+	cmd := ffmpeg.CommandContext(ctx,
+		"-fflags", "+genpts",
+		"-i", input,
+		"-an",
+		"-c:v", "copy",
+		"-bsf:v", "dump_extra=freq=keyframe",
+		"-f", "h264",
+		"pipe:1",
+	)
+	var in *eofReader
+	if c.path == "" {
+		in = &eofReader{r: os.Stdin}
+		cmd.Stdin = in
+		// Copying to ffmpeg blocks in a read of standard input; do not wait
+		// for it once ffmpeg exited
+		cmd.WaitDelay = time.Second
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+	c.setCmd(cmd)
+	logrus.Infof("FFmpeg process started with PID: %d", cmd.Process.Pid)
+
+	c.streamLoop(ctx, stdout, stderr)
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Warnf("FFmpeg process exited with error: %v", err)
+	}
+	c.clearCmd()
+
+	if in != nil && in.done() {
+		c.mu.Lock()
+		c.stdinClosed = true
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *Client) setCmd(cmd *exec.Cmd) {
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+}
+
+func (c *Client) clearCmd() {
+	c.mu.Lock()
+	c.cmd = nil
+	c.mu.Unlock()
+}
+
+func (c *Client) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isRunning {
+		return nil
+	}
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	if c.cmd != nil {
+		c.cmd.Process.Kill()
+		c.cmd = nil
+	}
+
+	c.isRunning = false
+	c.stats.MarkStopped()
+	logrus.Info("Stdin client stopped")
+	return nil
+}
+
+func (c *Client) IsRunning() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isRunning
+}
+
+// Health returns a snapshot of the client's throughput counters.
+func (c *Client) Health() stats.Snapshot {
+	return c.stats.Snapshot()
+}
+
+// Frames returns the access units read from the input. The channel is never
+// closed; frames are dropped while nobody is reading.
+func (c *Client) Frames() <-chan media.AccessUnit {
+	return c.frames
+}
+
+func (c *Client) streamLoop(ctx context.Context, stdout, stderr io.ReadCloser) {
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Debugf("FFmpeg (stdin): %s", scanner.Text())
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(media.SplitH264Frames)
+
+	frameCount := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		frameData := scanner.Bytes()
+		if len(frameData) == 0 {
+			continue
+		}
+		c.stats.RecordFrame(frameData)
+		timestamp := uint32(time.Now().UnixNano() / 1000000)
+		media.Send(c.frames, media.NewAccessUnit(frameData, timestamp))
+		frameCount++
+		if frameCount%300 == 0 {
+			logrus.Infof("✅ Stdin stream: sent %d frames", frameCount)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Errorf("Error reading from FFmpeg stdout (stdin): %v", err)
+	}
+}
+
+// eofReader notes when standard input reached its end, as opposed to ffmpeg
+// exiting while more input was coming.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+	mu  sync.Mutex
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		e.mu.Lock()
+		e.eof = true
+		e.mu.Unlock()
+	}
+	return n, err
+}
+
+func (e *eofReader) done() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.eof
+}
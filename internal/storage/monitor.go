@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PolicyRotate deletes the oldest media files until usage is back under the limits
+	PolicyRotate = "rotate"
+	// PolicyStop stops recordings and refuses new ones until space is freed
+	PolicyStop = "stop"
+
+	scanInterval = 30 * time.Second
+)
+
+// Config controls the limits enforced on the media directory.
+type Config struct {
+	MediaDir     string
+	QuotaBytes   uint64 // 0 disables the quota
+	MinFreeBytes uint64 // 0 disables the free-space floor
+	Policy       string
+}
+
+// Usage is the result of the most recent scan of the media directory.
+type Usage struct {
+	UsedBytes     uint64            `json:"used_bytes"`
+	Categories    map[string]uint64 `json:"categories"`
+	Files         int               `json:"files"`
+	FreeBytes     uint64            `json:"free_bytes"`
+	QuotaBytes    uint64            `json:"quota_bytes"`
+	MinFreeBytes  uint64            `json:"min_free_bytes"`
+	Policy        string            `json:"policy"`
+	OverLimit     bool              `json:"over_limit"`
+	DeletedFiles  uint64            `json:"deleted_files"`
+	DeletedBytes  uint64            `json:"deleted_bytes"`
+	LastScan      time.Time         `json:"last_scan"`
+	LastScanError string            `json:"last_scan_error,omitempty"`
+}
+
+// Monitor periodically measures the media directory and enforces the quota.
+type Monitor struct {
+	cfg      Config
+	onFull   func()
+	onDelete func(path string)
+	usage    Usage
+	mu       sync.RWMutex
+}
+
+// NewMonitor creates a storage monitor. onFull is called when limits are
+// exceeded under the stop policy.
+func NewMonitor(cfg Config, onFull func()) *Monitor {
+	if cfg.Policy != PolicyStop {
+		cfg.Policy = PolicyRotate
+	}
+	return &Monitor{cfg: cfg, onFull: onFull}
+}
+
+// SetDeleteHook installs a callback invoked for every file removed by rotation.
+func (m *Monitor) SetDeleteHook(onDelete func(path string)) {
+	m.mu.Lock()
+	m.onDelete = onDelete
+	m.mu.Unlock()
+}
+
+// Run scans the media directory until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+
+	m.Check()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
+
+// Usage returns the result of the most recent scan.
+func (m *Monitor) Usage() Usage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := m.usage
+	usage.Categories = make(map[string]uint64, len(m.usage.Categories))
+	for k, v := range m.usage.Categories {
+		usage.Categories[k] = v
+	}
+	return usage
+}
+
+// CanWrite returns an error when new media must not be written.
+func (m *Monitor) CanWrite() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cfg.Policy == PolicyStop && m.usage.OverLimit {
+		return fmt.Errorf("media storage limit reached")
+	}
+	return nil
+}
+
+// Check scans the media directory and enforces limits.
+func (m *Monitor) Check() {
+	files, usage, err := m.scan()
+	if err != nil {
+		m.mu.Lock()
+		m.usage.LastScan = time.Now()
+		m.usage.LastScanError = err.Error()
+		m.mu.Unlock()
+		logrus.Warnf("Storage scan failed: %v", err)
+		return
+	}
+
+	overLimit := m.overLimit(usage)
+	if overLimit && m.cfg.Policy == PolicyRotate {
+		deletedFiles, deletedBytes := m.rotate(files, &usage)
+		usage.DeletedFiles += deletedFiles
+		usage.DeletedBytes += deletedBytes
+		overLimit = m.overLimit(usage)
+	}
+	usage.OverLimit = overLimit
+
+	m.mu.Lock()
+	wasOver := m.usage.OverLimit
+	usage.DeletedFiles += m.usage.DeletedFiles
+	usage.DeletedBytes += m.usage.DeletedBytes
+	m.usage = usage
+	m.mu.Unlock()
+
+	if overLimit && !wasOver {
+		logrus.Warnf("💾 Media storage limit reached: used=%d bytes, free=%d bytes", usage.UsedBytes, usage.FreeBytes)
+		if m.cfg.Policy == PolicyStop && m.onFull != nil {
+			m.onFull()
+		}
+	} else if !overLimit && wasOver {
+		logrus.Info("💾 Media storage back under limits")
+	}
+}
+
+type mediaFile struct {
+	path    string
+	size    uint64
+	modTime time.Time
+}
+
+func (m *Monitor) scan() ([]mediaFile, Usage, error) {
+	usage := Usage{
+		Categories:   make(map[string]uint64),
+		QuotaBytes:   m.cfg.QuotaBytes,
+		MinFreeBytes: m.cfg.MinFreeBytes,
+		Policy:       m.cfg.Policy,
+		LastScan:     time.Now(),
+	}
+
+	if err := os.MkdirAll(m.cfg.MediaDir, 0o755); err != nil {
+		return nil, usage, err
+	}
+
+	var files []mediaFile
+	err := filepath.WalkDir(m.cfg.MediaDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // file vanished during the walk
+		}
+
+		size := uint64(info.Size())
+		usage.UsedBytes += size
+		usage.Files++
+		if rel, err := filepath.Rel(m.cfg.MediaDir, path); err == nil {
+			usage.Categories[strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]] += size
+		}
+		files = append(files, mediaFile{path: path, size: size, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, usage, err
+	}
+
+	if free, err := freeSpace(m.cfg.MediaDir); err == nil {
+		usage.FreeBytes = free
+	}
+	return files, usage, nil
+}
+
+func (m *Monitor) overLimit(usage Usage) bool {
+	if m.cfg.QuotaBytes > 0 && usage.UsedBytes > m.cfg.QuotaBytes {
+		return true
+	}
+	return m.cfg.MinFreeBytes > 0 && usage.FreeBytes > 0 && usage.FreeBytes < m.cfg.MinFreeBytes
+}
+
+// rotate deletes the oldest files until usage is under the limits. The newest
+// file of each directory is skipped because a recorder may still be writing it.
+func (m *Monitor) rotate(files []mediaFile, usage *Usage) (uint64, uint64) {
+	newest := make(map[string]time.Time)
+	for _, f := range files {
+		dir := filepath.Dir(f.path)
+		if f.modTime.After(newest[dir]) {
+			newest[dir] = f.modTime
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	m.mu.RLock()
+	onDelete := m.onDelete
+	m.mu.RUnlock()
+
+	var deletedFiles, deletedBytes uint64
+	for _, f := range files {
+		if !m.overLimit(*usage) {
+			break
+		}
+		if f.modTime.Equal(newest[filepath.Dir(f.path)]) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			logrus.Warnf("Failed to delete %s during storage rotation: %v", f.path, err)
+			continue
+		}
+
+		if onDelete != nil {
+			onDelete(f.path)
+		}
+
+		usage.UsedBytes -= f.size
+		usage.Files--
+		usage.FreeBytes += f.size
+		if rel, err := filepath.Rel(m.cfg.MediaDir, f.path); err == nil {
+			usage.Categories[strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]] -= f.size
+		}
+		deletedFiles++
+		deletedBytes += f.size
+		logrus.Infof("🗑️ Rotated out %s (%d bytes)", f.path, f.size)
+	}
+	return deletedFiles, deletedBytes
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package storage
+
+import "errors"
+
+// freeSpace is not implemented on Windows; the free-space floor is not enforced there.
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space detection not supported on windows")
+}
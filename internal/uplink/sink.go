@@ -0,0 +1,66 @@
+package uplink
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/media"
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// Sink feeds a stream of an edge instance into its uplink to the central
+// instance.
+type Sink struct {
+	uplink   *webrtcmanager.Uplink
+	streamID string
+	// acquire keeps the source running while the stream is pushed
+	acquire func(streamID, consumer string) (func(), error)
+	release func()
+	mu      sync.Mutex
+}
+
+// NewSink returns the uplink output of a stream.
+func NewSink(uplink *webrtcmanager.Uplink, streamID string, acquire func(streamID, consumer string) (func(), error)) *Sink {
+	return &Sink{uplink: uplink, streamID: streamID, acquire: acquire}
+}
+
+func (s *Sink) Name() string { return "uplink" }
+
+func (s *Sink) Start(ctx context.Context) error {
+	release, err := s.acquire(s.streamID, "uplink")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.release = release
+	s.mu.Unlock()
+	logrus.Infof("🔼 Pushing %s over the uplink", s.streamID)
+	return nil
+}
+
+func (s *Sink) Stop() error {
+	s.mu.Lock()
+	release := s.release
+	s.release = nil
+	s.mu.Unlock()
+	if release != nil {
+		release()
+		logrus.Infof("Stopped pushing %s over the uplink", s.streamID)
+	}
+	return nil
+}
+
+func (s *Sink) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.release != nil
+}
+
+func (s *Sink) WriteAccessUnit(au media.AccessUnit) {
+	if !s.IsRunning() {
+		return
+	}
+	s.uplink.WriteVideo(s.streamID, au.Data)
+}
@@ -0,0 +1,222 @@
+// Package uplink connects edge instances to a central one: an edge ingests
+// its local cameras and pushes selected streams over a single outbound
+// WebRTC connection, and the central instance serves all of their viewers.
+// WHIP publishers push their streams through the same ingest.
+package uplink
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/media"
+	"golang-webrtc-streaming/internal/stats"
+	webrtcmanager "golang-webrtc-streaming/internal/webrtc"
+)
+
+// ParseStreams reads the streams an edge pushes, configured as
+// "local=remote,local2": each local stream with its name on the central
+// instance, which defaults to the local name.
+func ParseStreams(spec string) (map[string]string, error) {
+	streams := make(map[string]string)
+	remotes := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		local, remote, mapped := strings.Cut(entry, "=")
+		local = strings.ToLower(strings.TrimSpace(local))
+		remote = strings.ToLower(strings.TrimSpace(remote))
+		if !mapped {
+			remote = local
+		}
+		if local == "" || remote == "" {
+			return nil, fmt.Errorf("invalid uplink stream %q, expected local[=remote]", entry)
+		}
+		if _, ok := streams[local]; ok {
+			return nil, fmt.Errorf("stream %s is listed twice", local)
+		}
+		if remotes[remote] {
+			return nil, fmt.Errorf("two streams are pushed as %s", remote)
+		}
+		streams[local] = remote
+		remotes[remote] = true
+	}
+	return streams, nil
+}
+
+// Ingest keeps the streams edge instances push to a central instance, or
+// WHIP publishers to any. A stream's source is created the first time it is
+// pushed and stays, so its sinks and viewers carry over when the client
+// reconnects.
+type Ingest struct {
+	// pipeline names the ingest in the stats of its sources
+	pipeline string
+	tokens   []string
+	sources  map[string]*Source
+	mu       sync.Mutex
+}
+
+// NewIngest accepts pushes presenting one of a comma-separated list of
+// tokens, showing pipeline in the stats of their sources.
+func NewIngest(pipeline, list string) *Ingest {
+	i := &Ingest{pipeline: pipeline, sources: make(map[string]*Source)}
+	for _, token := range strings.Split(list, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			i.tokens = append(i.tokens, token)
+		}
+	}
+	return i
+}
+
+// Enabled reports whether any token is configured; without one, pushes
+// are not accepted.
+func (i *Ingest) Enabled() bool {
+	return i != nil && len(i.tokens) > 0
+}
+
+// Authorized reports whether an Authorization header carries a valid
+// bearer token.
+func (i *Ingest) Authorized(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, t := range i.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns the track a pushed stream's video goes to, creating its
+// source with add the first time the stream is pushed. A new push of a
+// stream takes over from the previous one, which may not have timed out
+// yet when the edge reconnects.
+func (i *Ingest) Open(stream string, add func(*Source) error) (webrtcmanager.UplinkTrack, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	src, ok := i.sources[stream]
+	if !ok {
+		src = NewSource(stream, i.pipeline)
+		if err := add(src); err != nil {
+			return nil, err
+		}
+		i.sources[stream] = src
+	}
+	return src.attach(), nil
+}
+
+// Source is a stream pushed by an edge instance or a WHIP publisher. It
+// runs while the client pushes it; this instance cannot start or stop the
+// client, so Start and Stop do nothing.
+type Source struct {
+	stream   string
+	pipeline string
+	frames   chan media.AccessUnit
+	stats    *stats.SourceStats
+	// current is the track of the push in progress, nil when none
+	current *track
+	mu      sync.Mutex
+}
+
+// NewSource returns the source of a pushed stream, showing pipeline in its
+// stats.
+func NewSource(stream, pipeline string) *Source {
+	return &Source{
+		stream:   stream,
+		pipeline: pipeline,
+		frames:   make(chan media.AccessUnit, media.FrameBuffer),
+		stats:    stats.NewSourceStats(),
+	}
+}
+
+// URL is how the source is listed: the ingest's pipeline and the stream.
+func (s *Source) URL() string {
+	return s.pipeline + "://" + s.stream
+}
+
+func (s *Source) Start(ctx context.Context) error { return nil }
+
+func (s *Source) Stop() error { return nil }
+
+// IsRunning reports whether a client is pushing the stream.
+func (s *Source) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current != nil
+}
+
+func (s *Source) Frames() <-chan media.AccessUnit {
+	return s.frames
+}
+
+func (s *Source) Health() stats.Snapshot {
+	return s.stats.Snapshot()
+}
+
+func (s *Source) attach() *track {
+	t := &track{src: s}
+	s.mu.Lock()
+	s.current = t
+	s.mu.Unlock()
+	s.stats.MarkStarted()
+	s.stats.SetPipeline(s.pipeline)
+	return t
+}
+
+// RequestKeyframe asks the client pushing the stream for a keyframe.
+func (s *Source) RequestKeyframe() {
+	s.mu.Lock()
+	var request func()
+	if s.current != nil {
+		request = s.current.requestKeyframe
+	}
+	s.mu.Unlock()
+	if request != nil {
+		request()
+	}
+}
+
+// track is one push of a stream. Video of a push that was taken over is
+// dropped.
+type track struct {
+	src *Source
+	// requestKeyframe asks the client for a keyframe, guarded by the
+	// source's mu
+	requestKeyframe func()
+}
+
+func (t *track) SetKeyframeRequester(request func()) {
+	t.src.mu.Lock()
+	t.requestKeyframe = request
+	t.src.mu.Unlock()
+}
+
+func (t *track) WriteNAL(nalUnit []byte) {
+	s := t.src
+	s.mu.Lock()
+	current := s.current == t
+	s.mu.Unlock()
+	if !current {
+		return
+	}
+	s.stats.RecordFrame(nalUnit)
+	timestamp := uint32(time.Now().UnixNano() / 1000000)
+	media.Send(s.frames, media.NewAccessUnit(nalUnit, timestamp))
+}
+
+func (t *track) Close() {
+	s := t.src
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == t {
+		s.current = nil
+		s.stats.MarkStopped()
+	}
+}
@@ -0,0 +1,213 @@
+// Package usage accounts the media sent to viewers per stream and per
+// tenant, for chargeback and capacity planning.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/state"
+	"golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reportKey holds the persisted totals in state.BucketUsage
+const reportKey = "totals"
+
+// Totals is what was sent to the viewers of a stream or tenant.
+type Totals struct {
+	BytesSent uint64 `json:"bytes_sent"`
+	// Sessions counts the viewer sessions that ended
+	Sessions uint64 `json:"sessions"`
+}
+
+func (t *Totals) add(u webrtc.PeerUsage) {
+	t.BytesSent += u.BytesSent
+	if u.Gone {
+		t.Sessions++
+	}
+}
+
+// PeerTotals is what a current viewer was sent this period.
+type PeerTotals struct {
+	Stream    string `json:"stream"`
+	Tenant    string `json:"tenant,omitempty"`
+	BytesSent uint64 `json:"bytes_sent"`
+}
+
+// Report is the usage accounted since Since. Viewers without a tenant only
+// count towards the stream and overall totals.
+type Report struct {
+	Since     time.Time         `json:"since"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Total     Totals            `json:"total"`
+	Streams   map[string]Totals `json:"streams"`
+	Tenants   map[string]Totals `json:"tenants"`
+	// Peers are the current viewers; they are not persisted
+	Peers map[string]PeerTotals `json:"peers,omitempty"`
+}
+
+func newReport(now time.Time) Report {
+	return Report{
+		Since:     now,
+		UpdatedAt: now,
+		Streams:   make(map[string]Totals),
+		Tenants:   make(map[string]Totals),
+		Peers:     make(map[string]PeerTotals),
+	}
+}
+
+// copy returns a report sharing no maps with r.
+func (r Report) copy() Report {
+	out := r
+	out.Streams = make(map[string]Totals, len(r.Streams))
+	for k, v := range r.Streams {
+		out.Streams[k] = v
+	}
+	out.Tenants = make(map[string]Totals, len(r.Tenants))
+	for k, v := range r.Tenants {
+		out.Tenants[k] = v
+	}
+	out.Peers = make(map[string]PeerTotals, len(r.Peers))
+	for k, v := range r.Peers {
+		out.Peers[k] = v
+	}
+	return out
+}
+
+// Ledger adds up the usage collected from the WebRTC manager and persists
+// it, so totals survive restarts.
+type Ledger struct {
+	collect func() []webrtc.PeerUsage
+	// tenantTag is the session tag naming a viewer's tenant
+	tenantTag string
+	db        *state.Store
+	report    Report
+	mu        sync.Mutex
+	// saveMu keeps an older report from being persisted over a newer one
+	saveMu sync.Mutex
+}
+
+// NewLedger continues the persisted totals in db, if any. collect returns
+// the usage since its previous call, like webrtc.Manager.CollectUsage.
+func NewLedger(db *state.Store, tenantTag string, collect func() []webrtc.PeerUsage) (*Ledger, error) {
+	l := &Ledger{collect: collect, tenantTag: tenantTag, db: db, report: newReport(time.Now())}
+	if db == nil {
+		return l, nil
+	}
+	var report Report
+	found, err := db.Get(state.BucketUsage, reportKey, &report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage: %w", err)
+	}
+	if found {
+		if report.Streams == nil {
+			report.Streams = make(map[string]Totals)
+		}
+		if report.Tenants == nil {
+			report.Tenants = make(map[string]Totals)
+		}
+		report.Peers = make(map[string]PeerTotals)
+		l.report = report
+	}
+	return l, nil
+}
+
+// Run collects and persists usage every interval until ctx is done, and
+// once more then; with no interval only then.
+func (l *Ledger) Run(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			l.Collect()
+			l.save()
+			return
+		case <-tick:
+			l.Collect()
+			l.save()
+		}
+	}
+}
+
+// Collect adds the usage since the previous collection to the totals.
+func (l *Ledger) Collect() {
+	usage := l.collect()
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, u := range usage {
+		tenant := u.Tags[l.tenantTag]
+		l.report.Total.add(u)
+		stream := l.report.Streams[u.Stream]
+		stream.add(u)
+		l.report.Streams[u.Stream] = stream
+		if tenant != "" {
+			totals := l.report.Tenants[tenant]
+			totals.add(u)
+			l.report.Tenants[tenant] = totals
+		}
+		if u.Gone {
+			delete(l.report.Peers, u.PeerID)
+		} else {
+			peer := l.report.Peers[u.PeerID]
+			peer.Stream, peer.Tenant = u.Stream, tenant
+			peer.BytesSent += u.BytesSent
+			l.report.Peers[u.PeerID] = peer
+		}
+	}
+	l.report.UpdatedAt = now
+}
+
+// Report returns the usage up to now.
+func (l *Ledger) Report() Report {
+	l.Collect()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.report.copy()
+}
+
+// Reset closes the accounting period, e.g. at the end of a billing cycle,
+// and returns its final report. Current viewers carry on in the new period
+// with what they are sent from now on.
+func (l *Ledger) Reset() (Report, error) {
+	l.Collect()
+	l.mu.Lock()
+	closed := l.report
+	l.report = newReport(time.Now())
+	l.mu.Unlock()
+
+	if err := l.save(); err != nil {
+		return closed, err
+	}
+	logrus.Infof("Usage period since %s closed: %d bytes sent", closed.Since.Format(time.RFC3339), closed.Total.BytesSent)
+	return closed, nil
+}
+
+// save persists the totals; current viewers are not kept.
+func (l *Ledger) save() error {
+	if l.db == nil {
+		return nil
+	}
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+	l.mu.Lock()
+	report := l.report.copy()
+	l.mu.Unlock()
+	report.Peers = nil
+
+	if err := l.db.Put(state.BucketUsage, reportKey, report); err != nil {
+		logrus.Warnf("Failed to persist usage: %v", err)
+		return err
+	}
+	return nil
+}
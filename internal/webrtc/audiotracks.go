@@ -0,0 +1,157 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// AudioTrackInfo describes one selectable audio program of the current source.
+type AudioTrackInfo struct {
+	ID       string `json:"id"`
+	Language string `json:"language,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+// DefaultAudioTrack is used when the source exposes a single unnamed audio program.
+const DefaultAudioTrack = "default"
+
+type selectAudioTrackMessage struct {
+	Track string `json:"track"`
+}
+
+type audioTrackSelectedMessage struct {
+	Type  string `json:"type"`
+	Track string `json:"track"`
+}
+
+// SetAudioTracks replaces the list of selectable audio programs. Peers whose
+// selection no longer exists fall back to the first track.
+func (m *Manager) SetAudioTracks(tracks []AudioTrackInfo) {
+	m.audioTracksLock.Lock()
+	m.audioTracks = append([]AudioTrackInfo(nil), tracks...)
+	m.audioTracksLock.Unlock()
+
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	for _, peer := range m.peers {
+		peer.mu.Lock()
+		if !m.hasAudioTrack(peer.audioTrackID) {
+			peer.audioTrackID = ""
+		}
+		peer.mu.Unlock()
+	}
+}
+
+// GetAudioTracks returns the selectable audio programs of the current source.
+func (m *Manager) GetAudioTracks() []AudioTrackInfo {
+	m.audioTracksLock.RLock()
+	defer m.audioTracksLock.RUnlock()
+	return append([]AudioTrackInfo(nil), m.audioTracks...)
+}
+
+// SelectAudioTrack switches the audio program a peer receives.
+func (m *Manager) SelectAudioTrack(peerID, trackID string) error {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return fmt.Errorf("peer not found: %s", peerID)
+	}
+	return m.selectAudioTrack(peer, trackID)
+}
+
+func (m *Manager) selectAudioTrack(peer *Peer, trackID string) error {
+	if !m.hasAudioTrack(trackID) {
+		return fmt.Errorf("unknown audio track: %s", trackID)
+	}
+
+	peer.mu.Lock()
+	peer.audioTrackID = trackID
+	peer.mu.Unlock()
+
+	peer.log.Infof("Selected audio track %s", trackID)
+	return nil
+}
+
+func (m *Manager) hasAudioTrack(trackID string) bool {
+	m.audioTracksLock.RLock()
+	defer m.audioTracksLock.RUnlock()
+
+	if trackID == "" {
+		return true
+	}
+	for _, track := range m.audioTracks {
+		if track.ID == trackID {
+			return true
+		}
+	}
+	return trackID == DefaultAudioTrack && len(m.audioTracks) == 0
+}
+
+// defaultAudioTrackID is the track received by peers that made no selection.
+func (m *Manager) defaultAudioTrackID() string {
+	m.audioTracksLock.RLock()
+	defer m.audioTracksLock.RUnlock()
+
+	if len(m.audioTracks) == 0 {
+		return DefaultAudioTrack
+	}
+	return m.audioTracks[0].ID
+}
+
+// WriteAudioTrackSample writes an audio sample of one program of the active
+// stream to every viewer that selected it, held back as long as A/V sync
+// requires.
+func (m *Manager) WriteAudioTrackSample(trackID string, data []byte, timestamp uint32) {
+	m.writeSynced(m.ActiveStream(), false, data, timestamp, func(data []byte) {
+		m.writeAudioTrackSample("", trackID, data, timestamp)
+	})
+}
+
+// writeAudioTrackSample writes an audio sample to the viewers of a stream,
+// "" meaning the active one. Programs are those of the active stream; an
+// empty trackID goes to every viewer.
+func (m *Manager) writeAudioTrackSample(stream, trackID string, data []byte, timestamp uint32) {
+	defaultTrack := m.defaultAudioTrackID()
+
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	if stream == "" {
+		stream = m.activeStream
+	}
+
+	m.forEachViewerLocked(stream, func(peer *Peer) {
+		peer.mu.RLock()
+		selected := peer.audioTrackID
+		if selected == "" {
+			selected = defaultTrack
+		}
+		if peer.IsConnected && peer.AudioTrack != nil && (trackID == "" || selected == trackID) {
+			sample := media.Sample{
+				Data:     data,
+				Duration: time.Millisecond * 20, // ~50fps for audio
+			}
+			if timestamp > 0 {
+				sample.PacketTimestamp = timestamp
+			}
+			if err := peer.AudioTrack.WriteSample(sample); err != nil {
+				peer.log.Errorf("Failed to write audio sample: %v", err)
+			} else {
+				peer.countSent(len(data))
+			}
+		}
+		peer.mu.RUnlock()
+	})
+}
+
+func (m *Manager) handleSelectAudioTrack(peer *Peer, payload json.RawMessage) error {
+	var msg selectAudioTrackMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("invalid select_audio_track message: %w", err)
+	}
+	if err := m.selectAudioTrack(peer, msg.Track); err != nil {
+		return err
+	}
+	return peer.SendJSON(audioTrackSelectedMessage{Type: "audio_track_selected", Track: msg.Track})
+}
@@ -0,0 +1,374 @@
+package webrtc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxAVOffset bounds configured offsets; anything larger is a mistake
+	maxAVOffset = 5 * time.Second
+	// avSyncWindow is how long each path's lag is measured for; the
+	// smallest lag of a window filters out jitter, which only ever adds
+	avSyncWindow = 5 * time.Second
+	// avSyncStep is how far the drift correction moves per window, small
+	// enough that the change goes unnoticed
+	avSyncStep = 10 * time.Millisecond
+	// audioActiveTimeout is how long after the last audio sample offsets
+	// still apply; without audio there is nothing to sync video to
+	audioActiveTimeout = 2 * time.Second
+)
+
+// AVSyncConfig aligns audio with video for viewers, as the transcode and
+// packetization latencies of the two paths differ.
+type AVSyncConfig struct {
+	// Offset delays audio relative to video; negative values delay video
+	Offset time.Duration
+	// AutoCorrect follows the drift between the two paths, measured from
+	// the source timestamps of their samples
+	AutoCorrect bool
+	// MaxCorrection bounds the automatic correction either way
+	MaxCorrection time.Duration
+}
+
+func (c AVSyncConfig) Validate() error {
+	if c.Offset < -maxAVOffset || c.Offset > maxAVOffset {
+		return fmt.Errorf("A/V offset must be within %s", maxAVOffset)
+	}
+	if c.MaxCorrection < 0 || c.MaxCorrection > maxAVOffset {
+		return fmt.Errorf("maximum A/V correction must be between 0 and %s", maxAVOffset)
+	}
+	return nil
+}
+
+// ParseAVOffsets parses per-stream A/V offsets written as
+// "stream=ms,stream2=ms"; positive values delay audio.
+func ParseAVOffsets(spec string) (map[string]time.Duration, error) {
+	offsets := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid A/V offset %q, expected stream=ms", entry)
+		}
+		ms, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid A/V offset of stream %s: %q", kv[0], kv[1])
+		}
+		offsets[strings.ToLower(strings.TrimSpace(kv[0]))] = time.Duration(ms) * time.Millisecond
+	}
+	return offsets, nil
+}
+
+// AVSyncStatus describes how a stream's audio and video are aligned.
+type AVSyncStatus struct {
+	Stream   string `json:"stream"`
+	OffsetMS int64  `json:"offset_ms"`
+	// DriftMS is how much later audio arrives relative to video than when
+	// measuring started
+	DriftMS      int64 `json:"drift_ms"`
+	CorrectionMS int64 `json:"correction_ms"`
+	AudioDelayMS int64 `json:"audio_delay_ms"`
+	VideoDelayMS int64 `json:"video_delay_ms"`
+	AudioActive  bool  `json:"audio_active"`
+}
+
+// lagWindow tracks the smallest lag of a path over the current window and
+// the one before.
+type lagWindow struct {
+	current, last time.Duration
+	hasCurrent    bool
+	hasLast       bool
+}
+
+func (w *lagWindow) observe(lag time.Duration) {
+	if !w.hasCurrent || lag < w.current {
+		w.current = lag
+		w.hasCurrent = true
+	}
+}
+
+func (w *lagWindow) rotate() {
+	if w.hasCurrent {
+		w.last, w.hasLast = w.current, true
+	}
+	w.hasCurrent = false
+}
+
+// avSync measures the lag of both paths of a stream and holds its samples
+// back accordingly.
+type avSync struct {
+	cfg    AVSyncConfig
+	stream string
+	offset time.Duration
+
+	video, audio lagWindow
+	windowStart  time.Time
+	// baseline is the audio lag minus the video lag when first measured
+	baseline    time.Duration
+	hasBaseline bool
+	drift       time.Duration
+	correction  time.Duration
+	lastAudioAt time.Time
+	mu          sync.Mutex
+
+	audioDelay, videoDelay delayLine
+}
+
+// sampleLag is how long after its source timestamp, in milliseconds on a
+// wrapping 32-bit clock, a sample arrived. Only changes of it are
+// meaningful, as the source clock may be unrelated to ours.
+func sampleLag(timestamp uint32, now time.Time) time.Duration {
+	return time.Duration(int32(uint32(now.UnixMilli())-timestamp)) * time.Millisecond
+}
+
+func (s *avSync) observe(video bool, timestamp uint32, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !video {
+		s.lastAudioAt = now
+	}
+	if timestamp == 0 || !s.cfg.AutoCorrect {
+		return
+	}
+	if video {
+		s.video.observe(sampleLag(timestamp, now))
+	} else {
+		s.audio.observe(sampleLag(timestamp, now))
+	}
+
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	if now.Sub(s.windowStart) < avSyncWindow {
+		return
+	}
+	s.windowStart = now
+	s.video.rotate()
+	s.audio.rotate()
+	if !s.video.hasLast || !s.audio.hasLast {
+		return
+	}
+
+	difference := s.audio.last - s.video.last
+	if !s.hasBaseline {
+		s.baseline, s.hasBaseline = difference, true
+		return
+	}
+	s.drift = difference - s.baseline
+
+	// Audio arriving later than it used to needs less delay, and vice versa
+	target := -s.drift
+	if target > s.cfg.MaxCorrection {
+		target = s.cfg.MaxCorrection
+	} else if target < -s.cfg.MaxCorrection {
+		target = -s.cfg.MaxCorrection
+	}
+	previous := s.correction
+	switch {
+	case target > s.correction+avSyncStep:
+		s.correction += avSyncStep
+	case target < s.correction-avSyncStep:
+		s.correction -= avSyncStep
+	default:
+		s.correction = target
+	}
+	if s.correction != previous {
+		logrus.Debugf("A/V drift of %s is %s, correcting audio by %s", s.stream, s.drift, s.correction)
+	}
+}
+
+// delays returns how long audio and video are held back now.
+func (s *avSync) delays(now time.Time) (audio, video time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastAudioAt.IsZero() || now.Sub(s.lastAudioAt) > audioActiveTimeout {
+		return 0, 0
+	}
+	total := s.offset + s.correction
+	if total > 0 {
+		return total, 0
+	}
+	return 0, -total
+}
+
+// reset forgets the measurements, e.g. when timestamps restart with a new
+// pipeline. Callers must hold mu.
+func (s *avSync) reset() {
+	s.video, s.audio = lagWindow{}, lagWindow{}
+	s.windowStart = time.Time{}
+	s.hasBaseline = false
+	s.drift = 0
+	s.correction = 0
+}
+
+// delayLine holds samples of one path back by a delay, keeping their order.
+type delayLine struct {
+	queue   []delayedWrite
+	running bool
+	mu      sync.Mutex
+}
+
+type delayedWrite struct {
+	due   time.Time
+	write func()
+}
+
+// push runs write after delay, or right away if there is no delay and
+// nothing is waiting ahead of it.
+func (d *delayLine) push(delay time.Duration, write func()) {
+	d.mu.Lock()
+	if delay <= 0 && len(d.queue) == 0 {
+		d.mu.Unlock()
+		write()
+		return
+	}
+	due := time.Now().Add(delay)
+	// A shrinking delay must not let samples overtake each other
+	if n := len(d.queue); n > 0 && due.Before(d.queue[n-1].due) {
+		due = d.queue[n-1].due
+	}
+	d.queue = append(d.queue, delayedWrite{due: due, write: write})
+	start := !d.running
+	d.running = true
+	d.mu.Unlock()
+
+	if start {
+		go d.drain()
+	}
+}
+
+func (d *delayLine) drain() {
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			d.running = false
+			d.mu.Unlock()
+			return
+		}
+		next := d.queue[0]
+		d.mu.Unlock()
+
+		time.Sleep(time.Until(next.due))
+		next.write()
+
+		d.mu.Lock()
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+	}
+}
+
+// configure applies the settings of the stream and restarts measuring.
+func (s *avSync) configure(cfg AVSyncConfig, offsets map[string]time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+	s.offset = cfg.Offset
+	if offset, ok := offsets[s.stream]; ok {
+		s.offset = offset
+	}
+	s.reset()
+}
+
+// streamAVSync returns the A/V alignment of a stream, creating it with the
+// current settings on first use.
+func (m *Manager) streamAVSync(stream string) *avSync {
+	m.avSyncLock.RLock()
+	s, ok := m.avSyncs[stream]
+	m.avSyncLock.RUnlock()
+	if ok {
+		return s
+	}
+
+	m.avSyncLock.Lock()
+	defer m.avSyncLock.Unlock()
+	if s, ok := m.avSyncs[stream]; ok {
+		return s
+	}
+	s = &avSync{stream: stream}
+	s.configure(m.avSyncCfg, m.avSyncOffsets)
+	m.avSyncs[stream] = s
+	return s
+}
+
+// restartAVSync forgets the measurements of a stream, whose timestamps
+// restart with a new pipeline.
+func (m *Manager) restartAVSync(stream string) {
+	s := m.streamAVSync(stream)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+// writeSynced measures a sample's lag and writes it once its path's delay
+// in the stream has passed. data is copied if the write is deferred.
+func (m *Manager) writeSynced(stream string, video bool, data []byte, timestamp uint32, write func(data []byte)) {
+	s := m.streamAVSync(stream)
+	now := time.Now()
+	s.observe(video, timestamp, now)
+	audioDelay, videoDelay := s.delays(now)
+
+	line, delay := &s.audioDelay, audioDelay
+	if video {
+		line, delay = &s.videoDelay, videoDelay
+	}
+	line.mu.Lock()
+	direct := delay <= 0 && len(line.queue) == 0
+	line.mu.Unlock()
+	if direct {
+		write(data)
+		return
+	}
+	data = append([]byte(nil), data...)
+	line.push(delay, func() { write(data) })
+}
+
+// SetAVSync configures A/V alignment: cfg applies to every stream, with
+// offsets overriding its offset per stream.
+func (m *Manager) SetAVSync(cfg AVSyncConfig, offsets map[string]time.Duration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	for stream, offset := range offsets {
+		if err := (AVSyncConfig{Offset: offset}).Validate(); err != nil {
+			return fmt.Errorf("stream %s: %w", stream, err)
+		}
+	}
+
+	m.avSyncLock.Lock()
+	defer m.avSyncLock.Unlock()
+	m.avSyncCfg, m.avSyncOffsets = cfg, offsets
+	for _, s := range m.avSyncs {
+		s.configure(cfg, offsets)
+	}
+	return nil
+}
+
+// AVSync returns the current alignment of the active stream's audio and
+// video.
+func (m *Manager) AVSync() AVSyncStatus {
+	s := m.streamAVSync(m.ActiveStream())
+	now := time.Now()
+	audioDelay, videoDelay := s.delays(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return AVSyncStatus{
+		Stream:       s.stream,
+		OffsetMS:     s.offset.Milliseconds(),
+		DriftMS:      s.drift.Milliseconds(),
+		CorrectionMS: s.correction.Milliseconds(),
+		AudioDelayMS: audioDelay.Milliseconds(),
+		VideoDelayMS: videoDelay.Milliseconds(),
+		AudioActive:  !s.lastAudioAt.IsZero() && now.Sub(s.lastAudioAt) <= audioActiveTimeout,
+	}
+}
@@ -0,0 +1,81 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAVSyncOffsetsApplyPerStream(t *testing.T) {
+	m := NewManager()
+	m.SetActiveStream("cam")
+	if err := m.SetAVSync(AVSyncConfig{Offset: 40 * time.Millisecond}, map[string]time.Duration{
+		"lobby": 200 * time.Millisecond,
+		"gate":  -80 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("SetAVSync() error = %v", err)
+	}
+
+	// Only pinned viewers watch lobby and gate; all three carry audio
+	for _, stream := range []string{"cam", "lobby", "gate"} {
+		m.WriteStreamAudioSample(stream, []byte{0xF8}, 0)
+	}
+	now := time.Now()
+	tests := []struct {
+		stream     string
+		wantAudio  time.Duration
+		wantVideo  time.Duration
+		wantOffset time.Duration
+	}{
+		{"cam", 40 * time.Millisecond, 0, 40 * time.Millisecond},
+		{"lobby", 200 * time.Millisecond, 0, 200 * time.Millisecond},
+		{"gate", 0, 80 * time.Millisecond, -80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		s := m.streamAVSync(tt.stream)
+		audio, video := s.delays(now)
+		if audio != tt.wantAudio || video != tt.wantVideo {
+			t.Errorf("delays of %s = %s, %s; want %s, %s", tt.stream, audio, video, tt.wantAudio, tt.wantVideo)
+		}
+		s.mu.Lock()
+		offset := s.offset
+		s.mu.Unlock()
+		if offset != tt.wantOffset {
+			t.Errorf("offset of %s = %s, want %s", tt.stream, offset, tt.wantOffset)
+		}
+	}
+
+	if status := m.AVSync(); status.Stream != "cam" || status.OffsetMS != 40 || !status.AudioActive {
+		t.Errorf("AVSync() = %+v, want the active stream cam with its audio", status)
+	}
+}
+
+func TestAVSyncWithoutAudioDoesNotDelay(t *testing.T) {
+	m := NewManager()
+	if err := m.SetAVSync(AVSyncConfig{}, map[string]time.Duration{"lobby": 300 * time.Millisecond}); err != nil {
+		t.Fatalf("SetAVSync() error = %v", err)
+	}
+	written := false
+	m.writeSynced("lobby", true, []byte{0, 0, 0, 1, 0x65}, 0, func([]byte) { written = true })
+	if !written {
+		t.Error("video of a stream without audio was held back")
+	}
+}
+
+func TestDelayLineKeepsOrder(t *testing.T) {
+	var line delayLine
+	done := make(chan int, 3)
+	line.push(30*time.Millisecond, func() { done <- 1 })
+	// A shorter delay must not overtake the sample ahead of it
+	line.push(0, func() { done <- 2 })
+	line.push(10*time.Millisecond, func() { done <- 3 })
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("write %d ran in position %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("write %d did not run", want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package webrtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// bandwidthBurst is how much unused budget a capped peer may save up, so
+// keyframes larger than the per-frame average still pass
+const bandwidthBurst = 2 * time.Second
+
+// BandwidthStats describes the send cap of a peer.
+type BandwidthStats struct {
+	MaxBitrateKbps int    `json:"max_bitrate_kbps"`
+	DroppedFrames  uint64 `json:"dropped_frames"`
+}
+
+// bandwidthLimiter keeps a peer's video under its cap with a token bucket.
+// Sources are not transcoded, so frames over budget are dropped and sending
+// only resumes at the next keyframe, keeping the decoder's references intact.
+// Guarded by the peer's mutex; a nil limiter allows everything.
+type bandwidthLimiter struct {
+	maxBitrateKbps int
+	bytesPerSecond float64
+	tokens         float64
+	last           time.Time
+	skipping       bool
+	dropped        uint64
+}
+
+func newBandwidthLimiter(maxBitrateKbps int) *bandwidthLimiter {
+	if maxBitrateKbps <= 0 {
+		return nil
+	}
+	rate := float64(maxBitrateKbps) * 1000 / 8
+	return &bandwidthLimiter{
+		maxBitrateKbps: maxBitrateKbps,
+		bytesPerSecond: rate,
+		tokens:         rate * bandwidthBurst.Seconds(),
+	}
+}
+
+// allow reports whether a frame of size bytes may be sent now and charges it.
+func (l *bandwidthLimiter) allow(size int, keyframe bool, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSecond
+		if burst := l.bytesPerSecond * bandwidthBurst.Seconds(); l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+
+	if l.skipping && !keyframe {
+		l.dropped++
+		return false
+	}
+	if l.tokens <= 0 {
+		l.skipping = true
+		l.dropped++
+		return false
+	}
+	l.skipping = false
+	l.tokens -= float64(size)
+	return true
+}
+
+// SetPeerMaxBitrate caps the video bitrate sent to each new peer; 0 means
+// unlimited. Caps requested per peer can only lower it.
+func (m *Manager) SetPeerMaxBitrate(kbps int) {
+	m.peersLock.Lock()
+	m.peerMaxBitrateKbps = kbps
+	m.peersLock.Unlock()
+}
+
+// PeerBandwidth returns the send cap of a peer, if it has one.
+func (m *Manager) PeerBandwidth(peerID string) (BandwidthStats, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return BandwidthStats{}, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	if peer.limiter == nil {
+		return BandwidthStats{}, false
+	}
+	return BandwidthStats{
+		MaxBitrateKbps: peer.limiter.maxBitrateKbps,
+		DroppedFrames:  peer.limiter.dropped,
+	}, true
+}
+
+// LowestBitrate returns the lowest positive cap, or 0 when none is set.
+func LowestBitrate(caps ...int) int {
+	lowest := 0
+	for _, kbps := range caps {
+		if kbps > 0 && (lowest == 0 || kbps < lowest) {
+			lowest = kbps
+		}
+	}
+	return lowest
+}
+
+// limitAnswerBitrate announces a cap in the video sections of an answer as
+// b=AS (kbps) and b=TIAS (bps).
+func limitAnswerBitrate(answer webrtc.SessionDescription, kbps int) (webrtc.SessionDescription, error) {
+	parsed, err := answer.Unmarshal()
+	if err != nil {
+		return answer, fmt.Errorf("failed to parse answer: %w", err)
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != "video" {
+			continue
+		}
+		media.Bandwidth = append(media.Bandwidth,
+			sdp.Bandwidth{Type: "AS", Bandwidth: uint64(kbps)},
+			sdp.Bandwidth{Type: "TIAS", Bandwidth: uint64(kbps) * 1000},
+		)
+	}
+	raw, err := parsed.Marshal()
+	if err != nil {
+		return answer, fmt.Errorf("failed to encode answer: %w", err)
+	}
+	answer.SDP = string(raw)
+	return answer, nil
+}
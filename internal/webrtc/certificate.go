@@ -0,0 +1,134 @@
+package webrtc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// certificateValidity is how long generated DTLS certificates are valid.
+// Browsers only check the fingerprint, so it is long to keep it stable.
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// LoadCertificate reads the DTLS certificate and private key PEM blocks in
+// path. With generate, a missing or expired certificate is replaced by a new
+// one written to path; otherwise both are errors.
+func LoadCertificate(path string, generate bool) (*Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) || !generate {
+			return nil, fmt.Errorf("failed to read DTLS certificate: %w", err)
+		}
+		return generateCertificate(path)
+	}
+
+	pair, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DTLS certificate %s: %w", path, err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DTLS certificate %s: %w", path, err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		if !generate {
+			return nil, fmt.Errorf("DTLS certificate %s expired on %s", path, leaf.NotAfter.Format(time.RFC3339))
+		}
+		logrus.Warnf("DTLS certificate %s expired, generating a new one", path)
+		return generateCertificate(path)
+	}
+
+	cert := webrtc.CertificateFromX509(pair.PrivateKey, leaf)
+	return &cert, nil
+}
+
+// generateCertificate creates a self-signed ECDSA certificate and stores it
+// in path with owner-only permissions.
+func generateCertificate(path string) (*webrtc.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DTLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DTLS certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "WebRTC"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DTLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DTLS certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DTLS key: %w", err)
+	}
+
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create DTLS certificate directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write DTLS certificate: %w", err)
+	}
+	logrus.Infof("Generated a new DTLS certificate in %s", path)
+
+	cert := webrtc.CertificateFromX509(key, leaf)
+	return &cert, nil
+}
+
+// SetCertificate makes new peers use cert for DTLS, so the fingerprint in
+// their SDP stays the same across restarts.
+func (m *Manager) SetCertificate(cert *Certificate) {
+	m.peersLock.Lock()
+	m.certificate = cert
+	m.peersLock.Unlock()
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the configured
+// DTLS certificate, e.g. "sha-256 AB:CD:...", or "" when each peer
+// generates its own.
+func (m *Manager) CertificateFingerprint() string {
+	m.peersLock.RLock()
+	cert := m.certificate
+	m.peersLock.RUnlock()
+	if cert == nil {
+		return ""
+	}
+
+	fingerprints, err := cert.GetFingerprints()
+	if err != nil {
+		logrus.Errorf("Failed to compute DTLS fingerprint: %v", err)
+		return ""
+	}
+	for _, fp := range fingerprints {
+		if fp.Algorithm == "sha-256" {
+			return fp.Algorithm + " " + strings.ToUpper(fp.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package webrtc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+// firstVideoPayloadType is assigned to the first configured video codec
+const firstVideoPayloadType = 102
+
+var (
+	profileLevelIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+	// videoRTCPFeedback matches pion's defaults, so NACK and PLI keep working
+	videoRTCPFeedback = []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+)
+
+// defaultVideoCodec and defaultAudioCodec are used unless codecs are configured.
+var (
+	defaultVideoCodec = webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "profile-level-id=42e01f;packetization-mode=1",
+	}
+	defaultAudioCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}
+)
+
+// CodecConfig lists the codecs negotiated with viewers, most preferred first.
+type CodecConfig struct {
+	Video []webrtc.RTPCodecParameters
+	Audio []webrtc.RTPCodecParameters
+}
+
+// NewCodecConfig builds a codec configuration from a video preference list
+// (see ParseVideoCodecs) and the fmtp parameters of Opus.
+func NewCodecConfig(videoList, opusFmtp string) (CodecConfig, error) {
+	video, err := ParseVideoCodecs(videoList)
+	if err != nil {
+		return CodecConfig{}, err
+	}
+	if len(video) == 0 {
+		return CodecConfig{}, fmt.Errorf("no video codecs configured")
+	}
+	return CodecConfig{Video: video, Audio: []webrtc.RTPCodecParameters{OpusCodec(opusFmtp)}}, nil
+}
+
+// ParseVideoCodecs parses a comma-separated preference list of H.264
+// variants written as h264:<profile-level-id>[:<packetization-mode>], e.g.
+// "h264:640c1f,h264:42e01f". Sources are delivered as H.264, so other video
+// codecs cannot be sent and are rejected.
+func ParseVideoCodecs(list string) ([]RTPCodecParameters, error) {
+	var codecs []webrtc.RTPCodecParameters
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		switch name := strings.ToLower(parts[0]); name {
+		case "h264":
+		case "vp8", "vp9", "av1":
+			return nil, fmt.Errorf("video codec %s is not supported: sources are delivered as H.264", name)
+		default:
+			return nil, fmt.Errorf("unknown video codec %q", parts[0])
+		}
+		if len(parts) < 2 || len(parts) > 3 || !profileLevelIDPattern.MatchString(parts[1]) {
+			return nil, fmt.Errorf("invalid H.264 codec %q, expected h264:<profile-level-id>[:<packetization-mode>]", entry)
+		}
+		mode := "1"
+		if len(parts) == 3 {
+			if parts[2] != "0" && parts[2] != "1" {
+				return nil, fmt.Errorf("invalid packetization mode in %q", entry)
+			}
+			mode = parts[2]
+		}
+
+		codecs = append(codecs, webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     webrtc.MimeTypeH264,
+				ClockRate:    90000,
+				SDPFmtpLine:  fmt.Sprintf("level-asymmetry-allowed=1;packetization-mode=%s;profile-level-id=%s", mode, strings.ToLower(parts[1])),
+				RTCPFeedback: videoRTCPFeedback,
+			},
+			PayloadType: webrtc.PayloadType(firstVideoPayloadType + len(codecs)),
+		})
+	}
+	return codecs, nil
+}
+
+// OpusCodec returns Opus with the given fmtp parameters, e.g.
+// "minptime=10;useinbandfec=1".
+func OpusCodec(fmtp string) RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeOpus,
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: fmtp,
+		},
+		PayloadType: 111,
+	}
+}
+
+// SetCodecs restricts negotiation to the given codecs in order of
+// preference. Peers created earlier keep their codecs.
+func (m *Manager) SetCodecs(cfg CodecConfig) error {
+	if len(cfg.Video) == 0 || len(cfg.Audio) == 0 {
+		return fmt.Errorf("at least one video and one audio codec are required")
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.codecs = &cfg
+	return m.rebuildAPI()
+}
+
+// rebuildAPI creates the pion API from the configured codecs, settings, ICE
+// timeouts, RTCP intervals, and impairment. Without any, peers use pion's
+// defaults. Callers must hold peersLock.
+func (m *Manager) rebuildAPI() error {
+	if m.codecs == nil && m.settings == nil && !m.ice.custom() && m.impairment == nil && m.rtcp == nil {
+		m.api = nil
+		return nil
+	}
+
+	mediaEngine := &webrtc.MediaEngine{}
+	if m.codecs == nil {
+		if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+			return fmt.Errorf("failed to register codecs: %w", err)
+		}
+	} else {
+		for _, codec := range m.codecs.Video {
+			if err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
+				return fmt.Errorf("failed to register %s: %w", codec.SDPFmtpLine, err)
+			}
+		}
+		for _, codec := range m.codecs.Audio {
+			if err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
+				return fmt.Errorf("failed to register %s: %w", codec.MimeType, err)
+			}
+		}
+	}
+	registry := &interceptor.Registry{}
+	// Added first so it sits closest to the transport
+	if m.impairment != nil {
+		registry.Add(m.impairment)
+	}
+	if err := m.registerInterceptors(mediaEngine, registry); err != nil {
+		return fmt.Errorf("failed to register interceptors: %w", err)
+	}
+
+	options := []func(*webrtc.API){webrtc.WithMediaEngine(mediaEngine), webrtc.WithInterceptorRegistry(registry)}
+	settings := webrtc.SettingEngine{}
+	if m.settings != nil {
+		settings = *m.settings
+	}
+	if m.ice.custom() {
+		settings.SetICETimeouts(m.ice.timeouts())
+	}
+	options = append(options, webrtc.WithSettingEngine(settings))
+	m.api = webrtc.NewAPI(options...)
+	return nil
+}
+
+// CodecInfo describes a negotiable codec to clients.
+type CodecInfo struct {
+	MimeType    string `json:"mime_type"`
+	ClockRate   uint32 `json:"clock_rate"`
+	Channels    uint16 `json:"channels,omitempty"`
+	SDPFmtpLine string `json:"sdp_fmtp_line,omitempty"`
+}
+
+// Codecs lists the codecs offered to viewers, most preferred first.
+func (m *Manager) Codecs() (video, audio []CodecInfo) {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	if m.codecs == nil {
+		return []CodecInfo{{MimeType: defaultVideoCodec.MimeType, ClockRate: defaultVideoCodec.ClockRate, SDPFmtpLine: defaultVideoCodec.SDPFmtpLine}},
+			[]CodecInfo{{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}}
+	}
+	for _, codec := range m.codecs.Video {
+		video = append(video, codecInfo(codec.RTPCodecCapability))
+	}
+	for _, codec := range m.codecs.Audio {
+		audio = append(audio, codecInfo(codec.RTPCodecCapability))
+	}
+	return video, audio
+}
+
+func codecInfo(c webrtc.RTPCodecCapability) CodecInfo {
+	return CodecInfo{MimeType: c.MimeType, ClockRate: c.ClockRate, Channels: c.Channels, SDPFmtpLine: c.SDPFmtpLine}
+}
+
+// trackCodecs returns the capabilities of new video and audio tracks: the
+// most preferred configured codecs. Callers must hold peersLock.
+func (m *Manager) trackCodecs() (video, audio webrtc.RTPCodecCapability) {
+	if m.codecs == nil {
+		return defaultVideoCodec, defaultAudioCodec
+	}
+	return m.codecs.Video[0].RTPCodecCapability, m.codecs.Audio[0].RTPCodecCapability
+}
+
+// applyCodecPreferences orders the codecs negotiated with a peer's offer
+// by the configured preference, so the answer and the tracks use the most
+// preferred codec the peer supports. It must run after the remote
+// description is set, when the negotiated codecs carry the peer's payload types.
+func (m *Manager) applyCodecPreferences(pc *webrtc.PeerConnection) error {
+	m.peersLock.RLock()
+	codecs := m.codecs
+	m.peersLock.RUnlock()
+	if codecs == nil {
+		return nil
+	}
+
+	for _, transceiver := range pc.GetTransceivers() {
+		sender := transceiver.Sender()
+		if sender == nil {
+			continue
+		}
+		preferred := codecs.Audio
+		if transceiver.Kind() == webrtc.RTPCodecTypeVideo {
+			preferred = codecs.Video
+		}
+
+		ordered := orderCodecs(sender.GetParameters().Codecs, preferred)
+		if len(ordered) == 0 {
+			continue
+		}
+		if err := transceiver.SetCodecPreferences(ordered); err != nil {
+			return fmt.Errorf("failed to set %s codec preferences: %w", transceiver.Kind(), err)
+		}
+	}
+	return nil
+}
+
+// orderCodecs returns the negotiated codecs matching a preferred one, in
+// preference order.
+func orderCodecs(negotiated, preferred []webrtc.RTPCodecParameters) []webrtc.RTPCodecParameters {
+	var ordered []webrtc.RTPCodecParameters
+	used := make(map[webrtc.PayloadType]bool)
+	for _, want := range preferred {
+		for _, have := range negotiated {
+			if !used[have.PayloadType] && sameCodec(want.RTPCodecCapability, have.RTPCodecCapability) {
+				ordered = append(ordered, have)
+				used[have.PayloadType] = true
+			}
+		}
+	}
+	return ordered
+}
+
+// sameCodec compares H.264 variants by profile and packetization mode,
+// ignoring the level; other codecs only by MIME type.
+func sameCodec(a, b webrtc.RTPCodecCapability) bool {
+	if !strings.EqualFold(a.MimeType, b.MimeType) {
+		return false
+	}
+	if !strings.EqualFold(a.MimeType, webrtc.MimeTypeH264) {
+		return true
+	}
+	pa, pb := fmtpParams(a.SDPFmtpLine), fmtpParams(b.SDPFmtpLine)
+	profileA, profileB := pa["profile-level-id"], pb["profile-level-id"]
+	return len(profileA) == 6 && len(profileB) == 6 &&
+		strings.EqualFold(profileA[:4], profileB[:4]) &&
+		packetizationMode(pa) == packetizationMode(pb)
+}
+
+func fmtpParams(line string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(line, ";") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return params
+}
+
+func packetizationMode(params map[string]string) string {
+	if mode := params["packetization-mode"]; mode != "" {
+		return mode
+	}
+	return "0"
+}
@@ -0,0 +1,191 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// MessageHandler handles one type of JSON message received from a peer's data channel.
+type MessageHandler func(peer *Peer, payload json.RawMessage) error
+
+// ErrorMessage is sent back to a peer when one of its messages cannot be handled.
+type ErrorMessage struct {
+	Type    string `json:"type"`
+	Request string `json:"request,omitempty"`
+	Error   string `json:"error"`
+	// Code is set for messages refused before reaching a handler
+	Code string `json:"code,omitempty"`
+}
+
+// DataChannelLimits bound what a peer may send over its data channels, so
+// a misbehaving client cannot keep the server busy with messages.
+type DataChannelLimits struct {
+	// MaxMessageBytes refuses larger messages; 0 is unlimited
+	MaxMessageBytes int
+	// RatePerSecond and Burst bound the messages a peer may send, as a token
+	// bucket; a zero rate is unlimited
+	RatePerSecond float64
+	Burst         int
+	// MaxViolations ends the session of a peer after this many refused
+	// messages; 0 never does
+	MaxViolations int
+}
+
+func (l DataChannelLimits) Validate() error {
+	if l.MaxMessageBytes < 0 || l.RatePerSecond < 0 || l.Burst < 0 || l.MaxViolations < 0 {
+		return fmt.Errorf("data channel limits must not be negative")
+	}
+	if l.RatePerSecond > 0 && l.Burst < 1 {
+		return fmt.Errorf("data channel burst must be at least 1 when the rate is limited")
+	}
+	return nil
+}
+
+// Reasons data channel messages are refused
+const (
+	rejectTooLarge    = "too_large"
+	rejectRateLimited = "rate_limited"
+	rejectInvalid     = "invalid_message"
+	rejectUnknownType = "unknown_type"
+)
+
+// dataChannelState is the token bucket and refusal count of a peer,
+// guarded by its mu.
+type dataChannelState struct {
+	tokens     float64
+	refilledAt time.Time
+	violations int
+	// rateLimitedAt throttles the errors sent for rate limited messages
+	rateLimitedAt time.Time
+}
+
+// SetDataChannelLimits bounds the size and rate of data channel messages
+// of all peers.
+func (m *Manager) SetDataChannelLimits(limits DataChannelLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	m.peersLock.Lock()
+	m.dataChannelLimits = limits
+	m.peersLock.Unlock()
+	return nil
+}
+
+// DataChannelRejections counts the data channel messages refused since
+// start, by reason.
+func (m *Manager) DataChannelRejections() map[string]uint64 {
+	m.rejectionsMu.Lock()
+	defer m.rejectionsMu.Unlock()
+	counts := make(map[string]uint64, len(m.rejections))
+	for reason, count := range m.rejections {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// RegisterMessageHandler installs the handler for data channel messages of the given type.
+func (m *Manager) RegisterMessageHandler(messageType string, handler MessageHandler) {
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.messageHandlers[messageType] = handler
+}
+
+// attachDataChannel routes messages from a data channel to the registered
+// handlers. Every message must be a JSON object whose "type" has a handler,
+// within the size and rate limits.
+func (m *Manager) attachDataChannel(peer *Peer, dc *webrtc.DataChannel) {
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		m.handleDataChannelMessage(peer, msg)
+	})
+}
+
+func (m *Manager) handleDataChannelMessage(peer *Peer, msg webrtc.DataChannelMessage) {
+	m.peersLock.RLock()
+	limits := m.dataChannelLimits
+	m.peersLock.RUnlock()
+
+	if !peer.allowMessage(limits, time.Now()) {
+		m.rejectMessage(peer, limits, rejectRateLimited, "", "too many messages")
+		return
+	}
+	if limits.MaxMessageBytes > 0 && len(msg.Data) > limits.MaxMessageBytes {
+		m.rejectMessage(peer, limits, rejectTooLarge, "", fmt.Sprintf("message exceeds %d bytes", limits.MaxMessageBytes))
+		return
+	}
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if !msg.IsString || json.Unmarshal(msg.Data, &envelope) != nil || envelope.Type == "" {
+		m.rejectMessage(peer, limits, rejectInvalid, "", `messages must be JSON objects with a "type"`)
+		return
+	}
+
+	m.handlersLock.RLock()
+	handler, ok := m.messageHandlers[envelope.Type]
+	m.handlersLock.RUnlock()
+	if !ok {
+		m.rejectMessage(peer, limits, rejectUnknownType, envelope.Type, fmt.Sprintf("unknown message type %q", envelope.Type))
+		return
+	}
+
+	if err := handler(peer, msg.Data); err != nil {
+		peer.log.Warnf("Data channel message %q failed: %v", envelope.Type, err)
+		_ = peer.SendJSON(ErrorMessage{Type: "error", Request: envelope.Type, Error: err.Error()})
+	}
+}
+
+// allowMessage takes a token from the peer's bucket, if the rate is limited.
+func (p *Peer) allowMessage(limits DataChannelLimits, now time.Time) bool {
+	if limits.RatePerSecond <= 0 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dc := &p.dataChannel
+	if dc.refilledAt.IsZero() {
+		dc.tokens = float64(limits.Burst)
+	} else {
+		dc.tokens = min(float64(limits.Burst), dc.tokens+now.Sub(dc.refilledAt).Seconds()*limits.RatePerSecond)
+	}
+	dc.refilledAt = now
+	if dc.tokens < 1 {
+		return false
+	}
+	dc.tokens--
+	return true
+}
+
+// rejectMessage answers a refused message and counts it against the peer,
+// ending its session once it reached the limit. Rate limited messages are
+// answered at most once per second, so flooding does not double the traffic.
+func (m *Manager) rejectMessage(peer *Peer, limits DataChannelLimits, reason, request, text string) {
+	m.rejectionsMu.Lock()
+	if m.rejections == nil {
+		m.rejections = make(map[string]uint64)
+	}
+	m.rejections[reason]++
+	m.rejectionsMu.Unlock()
+
+	now := time.Now()
+	peer.mu.Lock()
+	peer.dataChannel.violations++
+	violations := peer.dataChannel.violations
+	answer := reason != rejectRateLimited || now.Sub(peer.dataChannel.rateLimitedAt) >= time.Second
+	if reason == rejectRateLimited && answer {
+		peer.dataChannel.rateLimitedAt = now
+	}
+	peer.mu.Unlock()
+
+	peer.log.Debugf("Refused data channel message (%s): %s", reason, text)
+	if limits.MaxViolations > 0 && violations == limits.MaxViolations {
+		// Not from within the data channel callback, which closing waits for
+		go m.EndSession(peer.ID, "too many refused data channel messages")
+		return
+	}
+	if answer {
+		_ = peer.SendJSON(ErrorMessage{Type: "error", Request: request, Error: text, Code: reason})
+	}
+}
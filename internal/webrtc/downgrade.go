@@ -0,0 +1,393 @@
+package webrtc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/media"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxRecoverShift bounds how much longer, up to 8 times, a peer
+	// downgraded again and again must stay loss-free before it is sent the
+	// main rendition once more
+	maxRecoverShift = 3
+	// lowRenditionStale is how long the low rendition may go without video
+	// before its peers fall back to the main one
+	lowRenditionStale = 3 * time.Second
+)
+
+// DowngradeConfig controls when lossy peers are switched to a low rendition
+// of the video, and back.
+type DowngradeConfig struct {
+	Interval time.Duration
+	// A peer is downgraded when its reported loss stays at or above
+	// LossThreshold for LossDuration, and upgraded again after reporting
+	// less for RecoverDuration, doubled for every further downgrade
+	LossThreshold   float64
+	LossDuration    time.Duration
+	RecoverDuration time.Duration
+	// Encoding of the low rendition, transcoded from the active source while
+	// a peer is downgraded
+	Encoding ffmpeg.Encoding
+}
+
+func (c DowngradeConfig) Validate() error {
+	if c.LossThreshold <= 0 || c.LossThreshold > 1 {
+		return fmt.Errorf("downgrade loss threshold must be between 0 and 1")
+	}
+	if c.LossDuration < 0 || c.RecoverDuration < 0 {
+		return fmt.Errorf("downgrade durations must not be negative")
+	}
+	return c.Encoding.Validate()
+}
+
+// RenditionMessage tells a client which rendition it is switched to, "low"
+// or "main".
+type RenditionMessage struct {
+	Type      string `json:"type"`
+	PeerID    string `json:"peer_id"`
+	Rendition string `json:"rendition"`
+	Reason    string `json:"reason"`
+}
+
+// RenditionStats describes the rendition a peer is sent.
+type RenditionStats struct {
+	// Rendition is "low" while the peer is downgraded, else "main"
+	Rendition string `json:"rendition"`
+	// Pending is set until the switch to the other rendition, which waits
+	// for its next keyframe
+	Pending    bool `json:"pending,omitempty"`
+	Downgrades int  `json:"downgrades"`
+}
+
+// downgradeState tracks a peer's rendition, guarded by Peer.mu.
+type downgradeState struct {
+	// low is set while the peer is sent the low rendition, wantLow as soon
+	// as it should be; it switches over at the next keyframe
+	low        bool
+	wantLow    bool
+	lossySince time.Time
+	cleanSince time.Time
+	downgrades int
+}
+
+// RunDowngrade checks peers every interval until ctx is cancelled, sending
+// the low rendition to those with persistent loss instead of letting them
+// freeze on the full-rate video. The low rendition is only transcoded while
+// a peer needs it.
+func (m *Manager) RunDowngrade(ctx context.Context, cfg DowngradeConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	low := &lowRendition{enc: cfg.Encoding, write: m.writeLowVideoSample}
+	m.peersLock.Lock()
+	m.low = low
+	m.peersLock.Unlock()
+	defer low.stop()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if m.checkDowngrade(cfg, now) {
+				low.start(ctx)
+			} else {
+				low.stop()
+			}
+		}
+	}
+}
+
+// checkDowngrade moves peers between renditions and reports whether any
+// should be sent the low one.
+func (m *Manager) checkDowngrade(cfg DowngradeConfig, now time.Time) bool {
+	wanted := false
+	for _, peer := range m.GetAllPeers() {
+		peer.mu.Lock()
+		changed, reason := peer.updateRendition(cfg, now)
+		wantLow := peer.downgrade.wantLow
+		peer.mu.Unlock()
+		if wantLow {
+			wanted = true
+		}
+		if !changed {
+			continue
+		}
+
+		rendition, eventType := "main", events.PeerUpgraded
+		if wantLow {
+			rendition, eventType = "low", events.PeerDowngraded
+			peer.log.Warnf("📉 Switching peer to the low rendition: %s", reason)
+		} else {
+			peer.log.Infof("📈 Switching peer back to the main rendition: %s", reason)
+		}
+		m.eventBus().Publish(events.Event{Type: eventType, Stream: peer.Stream, Peer: peer.ID, Data: map[string]interface{}{"reason": reason}})
+		if err := peer.SendJSON(RenditionMessage{Type: "rendition", PeerID: peer.ID, Rendition: rendition, Reason: reason}); err != nil {
+			peer.log.Debugf("Could not send rendition change: %v", err)
+		}
+	}
+	return wanted
+}
+
+// updateRendition decides which rendition a peer should be sent, reporting
+// whether that changed and why. Callers must hold p.mu.
+func (p *Peer) updateRendition(cfg DowngradeConfig, now time.Time) (bool, string) {
+	d := &p.downgrade
+	fresh := now.Sub(p.lastReportAt) < lossReportMaxAge
+	lossy := fresh && p.fractionLost >= cfg.LossThreshold
+	if lossy {
+		d.cleanSince = time.Time{}
+		if d.lossySince.IsZero() {
+			d.lossySince = now
+		}
+	} else {
+		d.lossySince = time.Time{}
+		// Without reports there is no telling whether the loss is gone
+		if !fresh {
+			d.cleanSince = time.Time{}
+		} else if d.cleanSince.IsZero() {
+			d.cleanSince = now
+		}
+	}
+
+	switch {
+	case !d.wantLow && lossy && now.Sub(d.lossySince) >= cfg.LossDuration:
+		d.wantLow = true
+		d.downgrades++
+		return true, fmt.Sprintf("%.0f%% packet loss", p.fractionLost*100)
+	case d.wantLow && !d.cleanSince.IsZero():
+		// Peers that keep losing packets on the main rendition wait longer
+		hold := cfg.RecoverDuration << min(d.downgrades-1, maxRecoverShift)
+		if now.Sub(d.cleanSince) >= hold {
+			d.wantLow = false
+			return true, fmt.Sprintf("no packet loss for %s", hold)
+		}
+	}
+	return false, ""
+}
+
+// takesRendition reports whether a peer is sent a frame of the low or main
+// rendition, switching it over at a keyframe of the one it should be on.
+// fallback switches it over even if it should not be, because the other
+// rendition has no video.
+func (p *Peer) takesRendition(low, keyframe, fallback bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := &p.downgrade
+	if d.low != low && keyframe && (d.wantLow == low || fallback) {
+		d.low = low
+	}
+	return d.low == low
+}
+
+// PeerRendition returns the rendition a peer is sent.
+func (m *Manager) PeerRendition(peerID string) (RenditionStats, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return RenditionStats{}, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	d := peer.downgrade
+	stats := RenditionStats{Rendition: "main", Pending: d.low != d.wantLow, Downgrades: d.downgrades}
+	if d.low {
+		stats.Rendition = "low"
+	}
+	return stats, true
+}
+
+// DowngradedPeers returns how many peers are sent the low rendition.
+func (m *Manager) DowngradedPeers() int {
+	count := 0
+	for _, peer := range m.GetAllPeers() {
+		peer.mu.RLock()
+		if peer.downgrade.low {
+			count++
+		}
+		peer.mu.RUnlock()
+	}
+	return count
+}
+
+// writeLowVideoSample writes an access unit of the low rendition to the
+// viewers of the active stream on it. It is serialized with the main
+// rendition by gopMu, so a peer switching over never gets the two
+// interleaved.
+func (m *Manager) writeLowVideoSample(data []byte, timestamp uint32) {
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	nalUnits, err := m.parseH264NALUnits(data)
+	if err != nil {
+		logrus.Errorf("Failed to parse H.264 NAL units of the low rendition: %v", err)
+		return
+	}
+	keyframe := containsKeyframe(nalUnits)
+	now := time.Now()
+	m.lowFrameAt = now
+	var queued *queuedFrame
+	m.forEachViewerLocked(m.activeStream, func(peer *Peer) {
+		if peer.takesRendition(true, keyframe, false) {
+			m.sendVideo(peer, nalUnits, len(data), keyframe, timestamp, now, &queued)
+		}
+	})
+}
+
+// containsKeyframe reports whether NAL units include an IDR slice or SPS.
+func containsKeyframe(nalUnits [][]byte) bool {
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) > 0 && (nalUnit[0]&0x1F == 5 || nalUnit[0]&0x1F == 7) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowRendition transcodes the video of the active source, as it is written
+// to peers, to the low rendition with an ffmpeg process.
+type lowRendition struct {
+	enc   ffmpeg.Encoding
+	write func(data []byte, timestamp uint32)
+	// input is set while ffmpeg runs; started once it was fed a keyframe,
+	// as nothing before one can be decoded
+	input   chan []byte
+	started bool
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+}
+
+// start runs ffmpeg unless it is running already.
+func (r *lowRendition) start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.input != nil {
+		return
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.input = make(chan []byte, media.FrameBuffer)
+	r.started = false
+	go r.run(ctx, r.input)
+}
+
+func (r *lowRendition) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.input == nil {
+		return
+	}
+	r.cancel()
+	r.input = nil
+	logrus.Info("Stopped low rendition, no peer is downgraded")
+}
+
+// feed queues an access unit of the main rendition without blocking.
+func (r *lowRendition) feed(data []byte, keyframe bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.input == nil || (!r.started && !keyframe) {
+		return
+	}
+	r.started = true
+	select {
+	case r.input <- append([]byte(nil), data...):
+	default:
+		// ffmpeg is behind; it resynchronizes at the next keyframe
+	}
+}
+
+func (r *lowRendition) run(ctx context.Context, input chan []byte) {
+	defer func() {
+		// A failed ffmpeg is started again by the next check
+		r.mu.Lock()
+		if r.input == input {
+			r.cancel()
+			r.input = nil
+		}
+		r.mu.Unlock()
+	}()
+
+	// Raw H.264 has no timestamps; frames are timed as they arrive
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "h264",
+		"-use_wallclock_as_timestamps", "1",
+		"-fflags", "nobuffer",
+		"-i", "pipe:0",
+	}
+	args = append(args, r.enc.Args()...)
+	args = append(args, "-f", "h264", "pipe:1")
+	cmd := ffmpeg.CommandContext(ctx, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logrus.Errorf("Low rendition: stdin pipe: %v", err)
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logrus.Errorf("Low rendition: stdout pipe: %v", err)
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		logrus.Errorf("Low rendition: stderr pipe: %v", err)
+		return
+	}
+	if err := ffmpeg.Start(cmd); err != nil {
+		logrus.Errorf("Low rendition: start ffmpeg: %v", err)
+		return
+	}
+	logrus.Infof("Started low rendition (%+v) with PID: %d", r.enc, cmd.Process.Pid)
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logrus.Debugf("FFmpeg (low rendition): %s", scanner.Text())
+		}
+	}()
+	go feedLowRendition(ctx, input, stdin)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(media.SplitH264Frames)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r.write(scanner.Bytes(), uint32(time.Now().UnixNano()/1000000))
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Warnf("FFmpeg process of the low rendition exited: %v", err)
+	}
+}
+
+// feedLowRendition writes queued access units to ffmpeg until ctx is done.
+func feedLowRendition(ctx context.Context, input chan []byte, stdin io.WriteCloser) {
+	defer stdin.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-input:
+			if _, err := stdin.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package webrtc
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DryRunOffer answers an offer on a throwaway peer connection that is
+// closed right away, so clients can check codec and ICE compatibility. The
+// peer is not registered, receives no media, and does not count against
+// viewer limits.
+func (m *Manager) DryRunOffer(ctx context.Context, offer SessionDescription, opts PeerOptions) (*SessionDescription, error) {
+	peerID := NewPeerID("dryrun")
+
+	m.peersLock.RLock()
+	media, err := m.newMediaConnection(peerID, opts.RelayOnly)
+	maxBitrateKbps := LowestBitrate(m.peerMaxBitrateKbps, opts.MaxBitrateKbps)
+	m.peersLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer media.pc.Close()
+
+	return m.answerOffer(ctx, logrus.WithField("peer", peerID), media.pc, offer, maxBitrateKbps, true)
+}
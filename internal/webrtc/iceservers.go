@@ -0,0 +1,86 @@
+package webrtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ICEServerConfig describes the STUN and TURN servers shared by the server
+// and its viewers.
+type ICEServerConfig struct {
+	// STUNURLs is a comma-separated list
+	STUNURLs     string
+	TURNURL      string
+	TURNUsername string
+	TURNPassword string
+	// TURNSecret replaces the static TURN credentials with ephemeral ones
+	// valid for TURNCredentialTTL
+	TURNSecret        string
+	TURNCredentialTTL time.Duration
+}
+
+// Ephemeral reports whether TURN credentials are generated per session.
+func (c ICEServerConfig) Ephemeral() bool {
+	return c.TURNURL != "" && c.TURNSecret != ""
+}
+
+// Servers returns the configured servers in pion's form, with TURN
+// credentials for the session of user.
+func (c ICEServerConfig) Servers(user string) []webrtc.ICEServer {
+	var servers []webrtc.ICEServer
+	for _, url := range strings.Split(c.STUNURLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			servers = append(servers, webrtc.ICEServer{URLs: []string{url}})
+		}
+	}
+	if c.TURNURL != "" {
+		username, password := c.TURNUsername, c.TURNPassword
+		if c.Ephemeral() {
+			username, password = turnRESTCredentials(c.TURNSecret, user, time.Now().Add(c.TURNCredentialTTL))
+		}
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       []string{c.TURNURL},
+			Username:   username,
+			Credential: password,
+		})
+	}
+	return servers
+}
+
+// turnRESTCredentials follows coturn's REST API convention (use-auth-secret):
+// the username is "<expiry unix time>:<user>" and the password the base64
+// HMAC-SHA1 of the username keyed with the shared secret.
+func turnRESTCredentials(secret, user string, expires time.Time) (username, password string) {
+	username = fmt.Sprintf("%d:%s", expires.Unix(), user)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// defaultICEServers is the development setup: public STUN and a local TURN server
+var defaultICEServers = ICEServerConfig{
+	STUNURLs:     "stun:stun.l.google.com:19302,stun:stun1.l.google.com:19302,stun:stun2.l.google.com:19302,stun:stun3.l.google.com:19302,stun:stun4.l.google.com:19302",
+	TURNURL:      "turn:127.0.0.1:3478",
+	TURNUsername: "webrtc",
+	TURNPassword: "webrtc123",
+}
+
+// SetICEServers replaces the STUN and TURN servers of new peers.
+func (m *Manager) SetICEServers(cfg ICEServerConfig) {
+	m.peersLock.Lock()
+	m.iceServers = cfg
+	m.peersLock.Unlock()
+}
+
+// ICEServers returns the STUN and TURN servers viewers should use.
+func (m *Manager) ICEServers() ICEServerConfig {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	return m.iceServers
+}
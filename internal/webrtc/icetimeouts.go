@@ -0,0 +1,70 @@
+package webrtc
+
+import (
+	"fmt"
+	"time"
+)
+
+// pion's ICE timing, kept for settings left at zero
+const (
+	defaultICEDisconnectedTimeout = 5 * time.Second
+	defaultICEFailedTimeout       = 25 * time.Second
+	defaultICEKeepaliveInterval   = 2 * time.Second
+)
+
+// ICEConfig tunes ICE of new peers, e.g. to notice lost viewers sooner on
+// networks where short outages are rare.
+type ICEConfig struct {
+	// DisconnectedTimeout is how long a connection may go without traffic
+	// before it is disconnected; zero keeps pion's 5s
+	DisconnectedTimeout time.Duration
+	// FailedTimeout is how much longer a disconnected connection has before
+	// it fails and is closed; zero keeps pion's 25s
+	FailedTimeout time.Duration
+	// KeepaliveInterval is how often STUN binding requests keep an idle
+	// connection alive; zero keeps pion's 2s
+	KeepaliveInterval time.Duration
+}
+
+func (c ICEConfig) Validate() error {
+	if c.DisconnectedTimeout < 0 || c.FailedTimeout < 0 || c.KeepaliveInterval < 0 {
+		return fmt.Errorf("ICE timeouts must not be negative")
+	}
+	disconnected, _, keepalive := c.timeouts()
+	if keepalive >= disconnected {
+		return fmt.Errorf("ICE keepalive interval (%s) must be shorter than the disconnected timeout (%s)", keepalive, disconnected)
+	}
+	return nil
+}
+
+// timeouts returns the settings with pion's defaults filled in.
+func (c ICEConfig) timeouts() (disconnected, failed, keepalive time.Duration) {
+	disconnected, failed, keepalive = c.DisconnectedTimeout, c.FailedTimeout, c.KeepaliveInterval
+	if disconnected == 0 {
+		disconnected = defaultICEDisconnectedTimeout
+	}
+	if failed == 0 {
+		failed = defaultICEFailedTimeout
+	}
+	if keepalive == 0 {
+		keepalive = defaultICEKeepaliveInterval
+	}
+	return disconnected, failed, keepalive
+}
+
+// custom reports whether any timing differs from pion's defaults.
+func (c ICEConfig) custom() bool {
+	return c.DisconnectedTimeout != 0 || c.FailedTimeout != 0 || c.KeepaliveInterval != 0
+}
+
+// SetICEConfig changes the ICE timeouts of peers created from now on.
+func (m *Manager) SetICEConfig(cfg ICEConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.ice = cfg
+	return m.rebuildAPI()
+}
@@ -0,0 +1,136 @@
+package webrtc
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+)
+
+// ImpairmentConfig degrades outgoing media to emulate a poor network.
+type ImpairmentConfig struct {
+	LossPercent float64 `json:"loss_percent"`
+	LatencyMS   int     `json:"latency_ms"`
+	// JitterMS varies each packet's latency by up to this much either way,
+	// which also reorders packets
+	JitterMS int `json:"jitter_ms"`
+}
+
+func (c ImpairmentConfig) Validate() error {
+	if c.LossPercent < 0 || c.LossPercent > 100 {
+		return fmt.Errorf("loss_percent must be between 0 and 100")
+	}
+	if c.LatencyMS < 0 || c.JitterMS < 0 {
+		return fmt.Errorf("latency_ms and jitter_ms must not be negative")
+	}
+	return nil
+}
+
+// delay returns the latency of one packet.
+func (c ImpairmentConfig) delay() time.Duration {
+	ms := c.LatencyMS
+	if c.JitterMS > 0 {
+		ms += rand.Intn(2*c.JitterMS+1) - c.JitterMS
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// impairment holds the settings shared by the interceptors of all peers, so
+// they can be changed while peers are connected.
+type impairment struct {
+	cfg ImpairmentConfig
+	mu  sync.RWMutex
+}
+
+func (i *impairment) get() ImpairmentConfig {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.cfg
+}
+
+// NewInterceptor implements interceptor.Factory.
+func (i *impairment) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return &impairmentInterceptor{impairment: i}, nil
+}
+
+// impairmentInterceptor drops and delays RTP packets on their way to the
+// transport. It is registered before pion's interceptors, so NACK
+// retransmissions are impaired as well.
+type impairmentInterceptor struct {
+	interceptor.NoOp
+	impairment *impairment
+}
+
+func (i *impairmentInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		cfg := i.impairment.get()
+		size := header.MarshalSize() + len(payload)
+		if cfg.LossPercent > 0 && rand.Float64()*100 < cfg.LossPercent {
+			return size, nil
+		}
+
+		delay := cfg.delay()
+		if delay == 0 {
+			return writer.Write(header, payload, attributes)
+		}
+		// The caller reuses its buffers once Write returns
+		delayedHeader := header.Clone()
+		delayedPayload := append([]byte(nil), payload...)
+		time.AfterFunc(delay, func() {
+			if _, err := writer.Write(&delayedHeader, delayedPayload, attributes); err != nil {
+				logrus.Debugf("Failed to write delayed packet: %v", err)
+			}
+		})
+		return size, nil
+	})
+}
+
+// EnableImpairment installs network impairment on the media of peers created
+// from now on. It is meant for testing player resilience, never for production.
+func (m *Manager) EnableImpairment(cfg ImpairmentConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.impairment = &impairment{cfg: cfg}
+	return m.rebuildAPI()
+}
+
+// Impairment returns the current impairment settings, if impairment is enabled.
+func (m *Manager) Impairment() (ImpairmentConfig, bool) {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	if m.impairment == nil {
+		return ImpairmentConfig{}, false
+	}
+	return m.impairment.get(), true
+}
+
+// SetImpairment changes the impairment of all peers, including connected ones.
+func (m *Manager) SetImpairment(cfg ImpairmentConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.peersLock.RLock()
+	imp := m.impairment
+	m.peersLock.RUnlock()
+	if imp == nil {
+		return fmt.Errorf("network impairment is not enabled")
+	}
+
+	imp.mu.Lock()
+	imp.cfg = cfg
+	imp.mu.Unlock()
+	logrus.Warnf("Network impairment set to %.1f%% loss, %dms latency, %dms jitter", cfg.LossPercent, cfg.LatencyMS, cfg.JitterMS)
+	return nil
+}
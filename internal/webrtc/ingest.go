@@ -0,0 +1,405 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// Uplink offer error codes returned to edge instances.
+const (
+	UplinkUnnamedTrack    = "unnamed_uplink_track"
+	UplinkDuplicateStream = "duplicate_uplink_stream"
+)
+
+// ErrUplinkNotFound is returned for an uplink session that does not exist.
+var ErrUplinkNotFound = errors.New("uplink session not found")
+
+// Kinds of clients pushing streams to this instance.
+const (
+	// IngestUplink is an edge instance's uplink
+	IngestUplink = "uplink"
+	// IngestWHIP is a browser or encoder publishing over WHIP
+	IngestWHIP = "whip"
+)
+
+// ingestLabels name the kinds of pushing clients in logs
+var ingestLabels = map[string]string{IngestUplink: "Uplink", IngestWHIP: "WHIP publisher"}
+
+// ingestEvents are the connected and disconnected events of each kind
+var ingestEvents = map[string][2]events.Type{
+	IngestUplink: {events.UplinkConnected, events.UplinkDisconnected},
+	IngestWHIP:   {events.WHIPConnected, events.WHIPDisconnected},
+}
+
+// uplinkConnectTimeout is how long an accepted uplink may take to connect
+// before it is given up
+const uplinkConnectTimeout = 30 * time.Second
+
+// uplinkKeyframeInterval is the minimum time between two keyframe requests
+// sent for a stream of an uplink
+const uplinkKeyframeInterval = time.Second
+
+// UplinkTrack receives the video of one stream pushed over an uplink.
+type UplinkTrack interface {
+	// WriteNAL is called with every H.264 NAL unit, in Annex B format
+	WriteNAL(nalUnit []byte)
+	// SetKeyframeRequester is called with a function that asks the client
+	// for a keyframe, for viewers that need one
+	SetKeyframeRequester(request func())
+	// Close is called once the uplink no longer carries the stream
+	Close()
+}
+
+// UplinkSession describes an uplink or a WHIP publisher pushing streams to
+// this instance.
+type UplinkSession struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Remote string `json:"remote"`
+	// Streams are the names of the pushed streams on this instance
+	Streams     []string   `json:"streams"`
+	State       string     `json:"state"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+}
+
+type uplinkSession struct {
+	info   UplinkSession
+	pc     *webrtc.PeerConnection
+	tracks map[string]UplinkTrack
+	once   sync.Once
+}
+
+// UplinkStreams validates an uplink offer and returns the streams it
+// pushes: one per sending video section, named by the stream ID of its
+// msid. A non-empty stream names the only video section instead, for
+// clients that do not choose their msid.
+func UplinkStreams(offer SessionDescription, stream string) ([]string, error) {
+	if len(offer.SDP) > MaxOfferSDPBytes {
+		return nil, &OfferError{OfferTooLarge, fmt.Sprintf("SDP is %d bytes, the limit is %d", len(offer.SDP), MaxOfferSDPBytes)}
+	}
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		return nil, &OfferError{OfferInvalidSDP, err.Error()}
+	}
+	if len(parsed.MediaDescriptions) == 0 {
+		return nil, &OfferError{OfferNoMedia, "the offer has no media sections"}
+	}
+
+	_, sessionUfrag := parsed.Attribute("ice-ufrag")
+	var streams []string
+	seen := make(map[string]bool)
+	for _, media := range parsed.MediaDescriptions {
+		if !sessionUfrag {
+			if _, ok := media.Attribute("ice-ufrag"); !ok {
+				return nil, &OfferError{OfferNoICECredentials, fmt.Sprintf("%s section has no ice-ufrag", media.MediaName.Media)}
+			}
+		}
+		if media.MediaName.Media != "video" || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		if direction := mediaDirection(media.Attributes); direction == "recvonly" || direction == "inactive" {
+			continue
+		}
+		hasH264 := false
+		for _, attr := range media.Attributes {
+			if attr.Key == "rtpmap" && strings.Contains(strings.ToUpper(attr.Value), " H264/90000") {
+				hasH264 = true
+			}
+		}
+		if !hasH264 {
+			return nil, &OfferError{OfferNoCompatibleCodec, "a video section does not offer H.264, the only codec this server takes"}
+		}
+
+		name := stream
+		if name == "" {
+			msid, ok := media.Attribute("msid")
+			if fields := strings.Fields(msid); ok && len(fields) > 0 {
+				name = strings.ToLower(fields[0])
+			}
+		}
+		if name == "" || name == "-" {
+			return nil, &OfferError{UplinkUnnamedTrack, "a video section has no msid naming its stream"}
+		}
+		if seen[name] {
+			return nil, &OfferError{UplinkDuplicateStream, fmt.Sprintf("stream %s is pushed twice", name)}
+		}
+		seen[name] = true
+		streams = append(streams, name)
+	}
+	if len(streams) == 0 {
+		return nil, &OfferError{OfferNoVideo, "the offer sends no video"}
+	}
+	return streams, nil
+}
+
+// AcceptUplink answers the SDP offer of an edge instance pushing streams to
+// this one, as returned by UplinkStreams. open is called for each stream
+// before the offer is answered and returns the track its video goes to; an
+// error refuses the whole offer. The tracks are closed when the uplink
+// disconnects or is closed. ctx bounds the wait for ICE gathering, not the
+// uplink.
+func (m *Manager) AcceptUplink(ctx context.Context, sdp, stream, remote string, open func(stream string) (UplinkTrack, error)) (string, *SessionDescription, error) {
+	return m.acceptIngest(ctx, IngestUplink, sdp, stream, remote, open)
+}
+
+// AcceptWHIP answers the SDP offer of a WHIP publisher, whose only video
+// track is the stream. It is otherwise accepted like an uplink, and is
+// ended with CloseUplink.
+func (m *Manager) AcceptWHIP(ctx context.Context, sdp, stream, remote string, open func(stream string) (UplinkTrack, error)) (string, *SessionDescription, error) {
+	return m.acceptIngest(ctx, IngestWHIP, sdp, stream, remote, open)
+}
+
+func (m *Manager) acceptIngest(ctx context.Context, kind, sdp, stream, remote string, open func(stream string) (UplinkTrack, error)) (string, *SessionDescription, error) {
+	offer := SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}
+	streams, err := UplinkStreams(offer, stream)
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := &uplinkSession{
+		info: UplinkSession{
+			ID:        newResumeToken(),
+			Kind:      kind,
+			Remote:    remote,
+			Streams:   streams,
+			State:     webrtc.PeerConnectionStateNew.String(),
+			CreatedAt: time.Now(),
+		},
+		tracks: make(map[string]UplinkTrack, len(streams)),
+	}
+	for _, name := range streams {
+		track, err := open(name)
+		if err != nil {
+			session.closeTracks()
+			return "", nil, err
+		}
+		session.tracks[name] = track
+	}
+
+	m.peersLock.RLock()
+	config := webrtc.Configuration{
+		ICEServers:   m.iceServers.Servers(session.info.ID),
+		BundlePolicy: webrtc.BundlePolicyMaxBundle,
+	}
+	if m.certificate != nil {
+		config.Certificates = []webrtc.Certificate{*m.certificate}
+	}
+	m.peersLock.RUnlock()
+
+	pc, err := m.newPeerConnection(config)
+	if err != nil {
+		session.closeTracks()
+		return "", nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	session.pc = pc
+	log := logrus.WithField(kind, session.info.ID)
+
+	pc.OnTrack(func(remoteTrack *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		name := stream
+		if name == "" {
+			name = strings.ToLower(remoteTrack.StreamID())
+		}
+		track := session.tracks[name]
+		if remoteTrack.Kind() != webrtc.RTPCodecTypeVideo || track == nil {
+			// Audio and unexpected tracks are read only to be discarded
+			go func() {
+				for {
+					if _, _, err := remoteTrack.ReadRTP(); err != nil {
+						return
+					}
+				}
+			}()
+			return
+		}
+		log.Infof("Receiving stream %s (%s)", name, remoteTrack.Codec().MimeType)
+		go m.readUplinkTrack(pc, remoteTrack, track)
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		m.uplinksMu.Lock()
+		session.info.State = state.String()
+		if state == webrtc.PeerConnectionStateConnected && session.info.ConnectedAt == nil {
+			now := time.Now()
+			session.info.ConnectedAt = &now
+		}
+		m.uplinksMu.Unlock()
+
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			log.Infof("%s from %s connected, pushing %s", ingestLabels[kind], remote, strings.Join(streams, ", "))
+			m.eventBus().Publish(events.Event{Type: ingestEvents[kind][0], Data: map[string]interface{}{
+				"session": session.info.ID,
+				"remote":  remote,
+				"streams": streams,
+			}})
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			m.closeUplink(session, state.String())
+		}
+	})
+
+	m.uplinksMu.Lock()
+	if m.uplinks == nil {
+		m.uplinks = make(map[string]*uplinkSession)
+	}
+	m.uplinks[session.info.ID] = session
+	m.uplinksMu.Unlock()
+
+	answer, err := m.answerOffer(ctx, log, pc, offer, 0, true)
+	if err != nil {
+		m.closeUplink(session, "negotiation failed")
+		return "", nil, err
+	}
+
+	time.AfterFunc(uplinkConnectTimeout, func() {
+		if pc.ConnectionState() != webrtc.PeerConnectionStateConnected {
+			log.Warnf("%s from %s did not connect within %s", ingestLabels[kind], remote, uplinkConnectTimeout)
+			m.closeUplink(session, "connect timeout")
+		}
+	})
+	return session.info.ID, answer, nil
+}
+
+// CloseUplink ends an uplink or WHIP session, as when its client deletes it.
+func (m *Manager) CloseUplink(id string) error {
+	m.uplinksMu.Lock()
+	session, ok := m.uplinks[id]
+	m.uplinksMu.Unlock()
+	if !ok {
+		return ErrUplinkNotFound
+	}
+	m.closeUplink(session, "closed")
+	return nil
+}
+
+// Uplinks lists the uplink sessions pushing streams to this instance.
+func (m *Manager) Uplinks() []UplinkSession {
+	return m.ingestSessions(IngestUplink)
+}
+
+// WHIPSessions lists the WHIP publishers pushing streams to this instance.
+func (m *Manager) WHIPSessions() []UplinkSession {
+	return m.ingestSessions(IngestWHIP)
+}
+
+func (m *Manager) ingestSessions(kind string) []UplinkSession {
+	m.uplinksMu.Lock()
+	defer m.uplinksMu.Unlock()
+	sessions := make([]UplinkSession, 0, len(m.uplinks))
+	for _, session := range m.uplinks {
+		if session.info.Kind == kind {
+			sessions = append(sessions, session.info)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// closeUplink tears a session down once, closing its tracks.
+func (m *Manager) closeUplink(session *uplinkSession, reason string) {
+	session.once.Do(func() {
+		m.uplinksMu.Lock()
+		delete(m.uplinks, session.info.ID)
+		wasConnected := session.info.ConnectedAt != nil
+		m.uplinksMu.Unlock()
+
+		session.closeTracks()
+		// Closing may wait for ICE, which must not hold up pion's callbacks
+		go session.pc.Close()
+		kind := session.info.Kind
+		logrus.WithField(kind, session.info.ID).Infof("%s from %s ended: %s", ingestLabels[kind], session.info.Remote, reason)
+		if wasConnected {
+			m.eventBus().Publish(events.Event{Type: ingestEvents[kind][1], Data: map[string]interface{}{
+				"session": session.info.ID,
+				"remote":  session.info.Remote,
+				"streams": session.info.Streams,
+				"reason":  reason,
+			}})
+		}
+	})
+}
+
+func (s *uplinkSession) closeTracks() {
+	for _, track := range s.tracks {
+		track.Close()
+	}
+}
+
+// readUplinkTrack depacketizes the video of a pushed stream into its track.
+// A keyframe is requested when the stream starts and after every gap, as
+// the NAL unit a lost packet belonged to is dropped and the pictures after
+// it cannot be decoded.
+func (m *Manager) readUplinkTrack(pc *webrtc.PeerConnection, remote *webrtc.TrackRemote, track UplinkTrack) {
+	var (
+		depacketizer codecs.H264Packet
+		lastSeq      uint16
+		started      bool
+		// skipping drops the rest of a fragmented NAL unit after a gap
+		skipping      bool
+		lastRequestAt time.Time
+		requestMu     sync.Mutex
+	)
+	// Viewers ask for keyframes from other goroutines
+	requestKeyframe := func() {
+		requestMu.Lock()
+		defer requestMu.Unlock()
+		if time.Since(lastRequestAt) < uplinkKeyframeInterval {
+			return
+		}
+		lastRequestAt = time.Now()
+		if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(remote.SSRC())}}); err != nil {
+			logrus.Debugf("Failed to request a keyframe of uplink stream %s: %v", remote.StreamID(), err)
+		}
+	}
+	requestKeyframe()
+	track.SetKeyframeRequester(requestKeyframe)
+
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		if started && packet.SequenceNumber != lastSeq+1 {
+			depacketizer = codecs.H264Packet{}
+			skipping = true
+			requestKeyframe()
+		}
+		started, lastSeq = true, packet.SequenceNumber
+		if skipping {
+			if continuesFragment(packet.Payload) {
+				continue
+			}
+			skipping = false
+		}
+
+		annexB, err := depacketizer.Unmarshal(packet.Payload)
+		if err != nil || len(annexB) == 0 {
+			continue
+		}
+		nalUnits, _ := m.parseH264NALUnits(annexB)
+		for _, nalUnit := range nalUnits {
+			if len(nalUnit) > 0 {
+				track.WriteNAL(append(append([]byte(nil), startCode...), nalUnit...))
+			}
+		}
+	}
+}
+
+// continuesFragment reports whether an H.264 RTP payload is a part of a
+// fragmented NAL unit other than its first.
+func continuesFragment(payload []byte) bool {
+	const fuA = 28
+	return len(payload) >= 2 && payload[0]&0x1F == fuA && payload[1]&0x80 == 0
+}
@@ -0,0 +1,141 @@
+package webrtc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/report"
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// sourceKeyframeInterval is the minimum time between two keyframe requests
+// passed on to the source
+const sourceKeyframeInterval = time.Second
+
+// RTCPConfig trades how quickly viewers recover from loss against the extra
+// traffic of doing so.
+type RTCPConfig struct {
+	// SenderReportInterval is how often RTCP sender reports go out; zero
+	// keeps pion's default of one second
+	SenderReportInterval time.Duration
+	// KeyframeRequestInterval is the minimum time between two PLI or FIR
+	// requests of a peer that are answered
+	KeyframeRequestInterval time.Duration
+	// MinKeyframeDistance ignores requests of peers that received a
+	// keyframe less than this long ago
+	MinKeyframeDistance time.Duration
+}
+
+func (c RTCPConfig) Validate() error {
+	if c.SenderReportInterval < 0 || c.KeyframeRequestInterval < 0 || c.MinKeyframeDistance < 0 {
+		return fmt.Errorf("RTCP intervals must not be negative")
+	}
+	return nil
+}
+
+// SetRTCPConfig changes the RTCP behaviour of peers created from now on;
+// keyframe request limits apply to connected peers right away.
+func (m *Manager) SetRTCPConfig(cfg RTCPConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.rtcp = &cfg
+	return m.rebuildAPI()
+}
+
+// registerInterceptors adds pion's NACK, report, and TWCC interceptors,
+// sending reports at the configured interval. Callers must hold peersLock.
+func (m *Manager) registerInterceptors(mediaEngine *webrtc.MediaEngine, registry *interceptor.Registry) error {
+	if m.rtcp == nil || m.rtcp.SenderReportInterval == 0 {
+		return webrtc.RegisterDefaultInterceptors(mediaEngine, registry)
+	}
+
+	if err := webrtc.ConfigureNack(mediaEngine, registry); err != nil {
+		return err
+	}
+	receiver, err := report.NewReceiverInterceptor()
+	if err != nil {
+		return err
+	}
+	sender, err := report.NewSenderInterceptor(report.SenderInterval(m.rtcp.SenderReportInterval))
+	if err != nil {
+		return err
+	}
+	registry.Add(receiver)
+	registry.Add(sender)
+	return webrtc.ConfigureTWCCSender(mediaEngine, registry)
+}
+
+// handleKeyframeRequest answers a viewer's PLI or FIR by asking the source
+// of its stream for a keyframe, which reaches every viewer of the stream.
+// Replaying the cached GOP instead would take the viewer back in time.
+// Requests are throttled per peer, and passed on at most every
+// sourceKeyframeInterval per stream.
+func (m *Manager) handleKeyframeRequest(peer *Peer) {
+	m.peersLock.RLock()
+	var cfg RTCPConfig
+	if m.rtcp != nil {
+		cfg = *m.rtcp
+	}
+	stream := m.peerStreamLocked(peer)
+	m.peersLock.RUnlock()
+
+	now := time.Now()
+	peer.mu.Lock()
+	var ignored string
+	switch {
+	case peer.VideoTrack == nil || !peer.primed:
+		// Nothing to send yet, or the GOP starting at a keyframe is already
+		// on its way
+		ignored = "peer is not receiving video yet"
+	case now.Sub(peer.lastKeyframeRequestAt) < cfg.KeyframeRequestInterval:
+		ignored = "throttled"
+	case now.Sub(peer.lastKeyframeAt) < cfg.MinKeyframeDistance:
+		ignored = fmt.Sprintf("keyframe sent %s ago", now.Sub(peer.lastKeyframeAt).Round(time.Millisecond))
+	default:
+		peer.lastKeyframeRequestAt = now
+	}
+	peer.mu.Unlock()
+
+	if ignored != "" {
+		peer.log.Debugf("Ignoring keyframe request: %s", ignored)
+		return
+	}
+	peer.log.Debugf("Passing keyframe request on to the %s source", stream)
+	m.gopMu.Lock()
+	m.requestSourceKeyframeLocked(stream)
+	m.gopMu.Unlock()
+}
+
+// OnKeyframeNeeded registers a callback asking a stream's source for a
+// keyframe, run when a viewer lost its picture, or joins and no GOP is
+// cached to replay. Sources that cannot be asked, such as ffmpeg pipelines
+// copying their input, ignore it.
+func (m *Manager) OnKeyframeNeeded(handler func(stream string)) {
+	m.peersLock.Lock()
+	m.onKeyframeNeeded = handler
+	m.peersLock.Unlock()
+}
+
+// requestSourceKeyframeLocked asks the source of a stream for a keyframe,
+// at most every sourceKeyframeInterval. Callers must hold gopMu.
+func (m *Manager) requestSourceKeyframeLocked(stream string) {
+	sm := m.mediaLocked(stream)
+	if time.Since(sm.sourceKeyframeAt) < sourceKeyframeInterval {
+		return
+	}
+	sm.sourceKeyframeAt = time.Now()
+	m.peersLock.RLock()
+	handler := m.onKeyframeNeeded
+	m.peersLock.RUnlock()
+	if handler == nil {
+		return
+	}
+	logrus.Debugf("Asking the %s source for a keyframe", stream)
+	go handler(stream)
+}
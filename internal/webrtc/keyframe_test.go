@@ -0,0 +1,45 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+)
+
+func TestKeyframeRequestAsksSourceWithoutRewinding(t *testing.T) {
+	m := NewManager()
+	requested := make(chan string, 2)
+	m.OnKeyframeNeeded(func(stream string) { requested <- stream })
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}, "video", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &Peer{ID: "viewer", VideoTrack: track, Stream: "cam", Pinned: true, primed: true, log: logrus.WithField("peer", "viewer")}
+
+	m.handleKeyframeRequest(peer)
+	select {
+	case stream := <-requested:
+		if stream != "cam" {
+			t.Errorf("keyframe requested of %q, want cam", stream)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("keyframe request not passed on to the source")
+	}
+	peer.mu.RLock()
+	primed := peer.primed
+	peer.mu.RUnlock()
+	if !primed {
+		t.Error("keyframe request rewound the peer to the cached GOP")
+	}
+
+	// The source was asked a moment ago
+	m.handleKeyframeRequest(peer)
+	select {
+	case <-requested:
+		t.Error("second request within sourceKeyframeInterval passed on")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,124 @@
+package webrtc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// Viewer limit error codes returned to clients.
+const (
+	LimitStreamFull = "stream_full"
+	LimitServerFull = "server_full"
+)
+
+// ViewerLimitError is returned when a new peer would exceed a viewer limit.
+type ViewerLimitError struct {
+	Code    string
+	Stream  string
+	Limit   int
+	Viewers int
+}
+
+func (e *ViewerLimitError) Error() string {
+	if e.Code == LimitServerFull {
+		return fmt.Sprintf("server is full: %d of %d viewers", e.Viewers, e.Limit)
+	}
+	return fmt.Sprintf("stream %s is full: %d of %d viewers", e.Stream, e.Viewers, e.Limit)
+}
+
+// ParseStreamLimits parses per-stream viewer limits written as
+// "stream=N,stream2=M".
+func ParseStreamLimits(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid viewer limit %q, expected stream=N", entry)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid viewer limit of stream %s: %q", kv[0], kv[1])
+		}
+		limits[strings.ToLower(strings.TrimSpace(kv[0]))] = limit
+	}
+	return limits, nil
+}
+
+// SetViewerLimits bounds the number of peers on the whole server and per
+// stream; 0 means unlimited. A stream's limit applies in addition to the
+// global one.
+func (m *Manager) SetViewerLimits(global int, streams map[string]int) {
+	m.peersLock.Lock()
+	m.maxViewers = global
+	m.maxStreamViewers = streams
+	m.peersLock.Unlock()
+}
+
+// ViewerCount is the number of peers watching a stream.
+type ViewerCount struct {
+	// Viewers includes peers that are still connecting
+	Viewers   int `json:"viewers"`
+	Connected int `json:"connected"`
+}
+
+// ViewerCounts returns the viewers of every stream that has any, keyed by
+// lower-case stream ID.
+func (m *Manager) ViewerCounts() map[string]ViewerCount {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	counts := make(map[string]ViewerCount)
+	for _, peer := range m.peers {
+		stream := strings.ToLower(peer.Stream)
+		count := counts[stream]
+		count.Viewers++
+		peer.mu.RLock()
+		if peer.IsConnected {
+			count.Connected++
+		}
+		peer.mu.RUnlock()
+		counts[stream] = count
+	}
+	return counts
+}
+
+// admitViewerLocked checks the viewer limits before a peer of stream is
+// added, publishing an event when it is refused. Detached peers keep their
+// slots. Callers hold peersLock.
+func (m *Manager) admitViewerLocked(stream string) error {
+	var limitErr *ViewerLimitError
+	if total := len(m.peers) + m.detachedViewersLocked(""); m.maxViewers > 0 && total >= m.maxViewers {
+		limitErr = &ViewerLimitError{Code: LimitServerFull, Stream: stream, Limit: m.maxViewers, Viewers: total}
+	} else if limit := m.maxStreamViewers[strings.ToLower(stream)]; limit > 0 {
+		viewers := m.detachedViewersLocked(stream)
+		for _, peer := range m.peers {
+			if strings.EqualFold(peer.Stream, stream) {
+				viewers++
+			}
+		}
+		if viewers >= limit {
+			limitErr = &ViewerLimitError{Code: LimitStreamFull, Stream: stream, Limit: limit, Viewers: viewers}
+		}
+	}
+	if limitErr == nil {
+		return nil
+	}
+
+	m.events.Publish(events.Event{
+		Type:   events.PeerRejected,
+		Stream: stream,
+		Data: map[string]interface{}{
+			"code":    limitErr.Code,
+			"limit":   limitErr.Limit,
+			"viewers": limitErr.Viewers,
+		},
+	})
+	return limitErr
+}
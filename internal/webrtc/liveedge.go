@@ -0,0 +1,249 @@
+package webrtc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// LiveEdgeConfig keeps a viewer close to the live edge by dropping video it
+// cannot send in time, preferring fresh pictures over complete playback.
+type LiveEdgeConfig struct {
+	// DropNonReferenceAt is the queue depth, in frames, from which frames no
+	// other frame depends on are dropped, queued ones included; a keyframe
+	// arriving at this depth replaces everything queued before it
+	DropNonReferenceAt int
+	// MaxQueuedFrames is the depth at which all video is dropped until the
+	// next keyframe
+	MaxQueuedFrames int
+}
+
+func (c LiveEdgeConfig) Validate() error {
+	if c.DropNonReferenceAt <= 0 || c.MaxQueuedFrames <= 0 {
+		return fmt.Errorf("live edge queue depths must be positive")
+	}
+	if c.DropNonReferenceAt > c.MaxQueuedFrames {
+		return fmt.Errorf("live edge non-reference drop depth must not exceed the queue limit")
+	}
+	return nil
+}
+
+// defaultLiveEdge allows about 100ms of queued video before shedding frames
+// and a second before skipping to the next keyframe, at 30fps
+var defaultLiveEdge = LiveEdgeConfig{DropNonReferenceAt: 3, MaxQueuedFrames: 30}
+
+// LiveEdgeStats describes the send queue of a live edge peer.
+type LiveEdgeStats struct {
+	QueuedFrames int `json:"queued_frames"`
+	MaxQueued    int `json:"max_queued"`
+	// DroppedNonReference counts frames dropped without affecting decoding
+	DroppedNonReference uint64 `json:"dropped_non_reference"`
+	// DroppedToKeyframe counts frames dropped while waiting for a keyframe
+	DroppedToKeyframe uint64 `json:"dropped_to_keyframe"`
+}
+
+// queuedFrame is one access unit waiting to be sent.
+type queuedFrame struct {
+	nalUnits  [][]byte
+	keyframe  bool
+	reference bool
+}
+
+// newQueuedFrame copies a frame's NAL units, which are shared by every queue
+// and outlive the source's buffer.
+func newQueuedFrame(nalUnits [][]byte, keyframe bool) *queuedFrame {
+	frame := &queuedFrame{keyframe: keyframe}
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) == 0 {
+			continue
+		}
+		// nal_ref_idc is zero for NAL units no other picture refers to
+		if nalUnit[0]&0x60 != 0 {
+			frame.reference = true
+		}
+		frame.nalUnits = append(frame.nalUnits, append([]byte(nil), nalUnit...))
+	}
+	return frame
+}
+
+// sendQueue decouples a live edge peer from the source: frames are written
+// to it by WriteVideoSample and sent by the peer's own goroutine, so a slow
+// viewer sheds frames instead of building up delay.
+type sendQueue struct {
+	cfg      LiveEdgeConfig
+	frames   []*queuedFrame
+	skipping bool
+	stats    LiveEdgeStats
+	// wake has room for one signal, sent whenever frames are queued
+	wake chan struct{}
+	done chan struct{}
+	// writeMu is held while a frame goes out, so a GOP replay never
+	// interleaves with queued video
+	writeMu sync.Mutex
+	mu      sync.Mutex
+}
+
+func newSendQueue(cfg LiveEdgeConfig) *sendQueue {
+	return &sendQueue{
+		cfg:   cfg,
+		stats: LiveEdgeStats{MaxQueued: cfg.MaxQueuedFrames},
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// push queues a frame, dropping frames as the queue deepens.
+func (q *sendQueue) push(frame *queuedFrame) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.skipping && !frame.keyframe {
+		q.stats.DroppedToKeyframe++
+		return
+	}
+	q.skipping = false
+
+	if len(q.frames) >= q.cfg.DropNonReferenceAt {
+		if frame.keyframe {
+			// Nothing queued is needed to decode the keyframe, except
+			// parameter sets sent in samples of their own just before it
+			start := len(q.frames)
+			for start > 0 && q.frames[start-1].keyframe {
+				start--
+			}
+			q.stats.DroppedToKeyframe += uint64(start)
+			q.frames = append(q.frames[:0], q.frames[start:]...)
+		} else {
+			kept := q.frames[:0]
+			for _, queued := range q.frames {
+				if queued.reference {
+					kept = append(kept, queued)
+				} else {
+					q.stats.DroppedNonReference++
+				}
+			}
+			q.frames = kept
+			if !frame.reference {
+				q.stats.DroppedNonReference++
+				return
+			}
+		}
+	}
+	if len(q.frames) >= q.cfg.MaxQueuedFrames {
+		q.skipping = true
+		q.stats.DroppedToKeyframe++
+		return
+	}
+
+	q.frames = append(q.frames, frame)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the oldest queued frame, or nil if there is none.
+func (q *sendQueue) pop() *queuedFrame {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.frames) == 0 {
+		return nil
+	}
+	frame := q.frames[0]
+	q.frames[0] = nil
+	q.frames = q.frames[1:]
+	return frame
+}
+
+// clear drops every queued frame, as a GOP replay is about to supersede them.
+func (q *sendQueue) clear() {
+	q.mu.Lock()
+	q.frames = nil
+	q.skipping = false
+	q.mu.Unlock()
+}
+
+func (q *sendQueue) close() {
+	close(q.done)
+}
+
+func (q *sendQueue) snapshot() LiveEdgeStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.QueuedFrames = len(q.frames)
+	return stats
+}
+
+// sendQueued writes a live edge peer's queued frames until it is removed.
+func (m *Manager) sendQueued(peer *Peer, q *sendQueue) {
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		}
+		for frame := q.pop(); frame != nil; frame = q.pop() {
+			m.writeQueuedFrame(peer, q, frame)
+		}
+	}
+}
+
+func (m *Manager) writeQueuedFrame(peer *Peer, q *sendQueue, frame *queuedFrame) {
+	q.writeMu.Lock()
+	defer q.writeMu.Unlock()
+
+	peer.mu.Lock()
+	// A keyframe request may have un-primed the peer since the frame was queued
+	send := peer.primed
+	firstFrame := peer.firstFrameAt.IsZero()
+	if send && frame.keyframe {
+		peer.lastKeyframeAt = time.Now()
+	}
+	peer.mu.Unlock()
+	if !send {
+		return
+	}
+
+	for _, nalUnit := range frame.nalUnits {
+		sample := media.Sample{
+			Data:     nalUnit,
+			Duration: time.Millisecond * 33, // ~30fps
+		}
+		if err := peer.VideoTrack.WriteSample(sample); err != nil {
+			peer.log.Errorf("Failed to write video sample: %v", err)
+			continue
+		}
+		peer.countSent(len(nalUnit))
+		if firstFrame {
+			m.markFirstFrame(peer)
+			firstFrame = false
+		}
+	}
+}
+
+// SetLiveEdge sets the queue depths of live edge peers created from now on.
+// With allPeers every new peer is in live edge mode, otherwise only those
+// whose viewer asks for it.
+func (m *Manager) SetLiveEdge(cfg LiveEdgeConfig, allPeers bool) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.liveEdge = cfg
+	m.liveEdgeAllPeers = allPeers
+	return nil
+}
+
+// PeerLiveEdge returns the send queue of a peer, if it is in live edge mode.
+func (m *Manager) PeerLiveEdge(peerID string) (LiveEdgeStats, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists || peer.sendQueue == nil {
+		return LiveEdgeStats{}, false
+	}
+	return peer.sendQueue.snapshot(), true
+}
@@ -0,0 +1,191 @@
+package webrtc
+
+import (
+	"fmt"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// LimitMaintenance is the code of offers refused during maintenance.
+const LimitMaintenance = "maintenance"
+
+// MaintenanceError is returned for new peers while maintenance mode is on.
+type MaintenanceError struct {
+	Message string
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Message == "" {
+		return "server is in maintenance"
+	}
+	return "server is in maintenance: " + e.Message
+}
+
+// MaintenanceMessage tells viewers about maintenance over the data channel.
+// "maintenance" carries the deadline after which they are disconnected;
+// "maintenance_ended" cancels it.
+type MaintenanceMessage struct {
+	Type             string     `json:"type"`
+	Message          string     `json:"message,omitempty"`
+	Deadline         *time.Time `json:"deadline,omitempty"`
+	SecondsRemaining int        `json:"seconds_remaining,omitempty"`
+}
+
+// MaintenanceStatus reports maintenance mode and how far viewers drained.
+type MaintenanceStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Message   string     `json:"message,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Deadline is when remaining viewers are disconnected, if they were
+	// given a countdown
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// ViewersAtStart and Viewers include detached sessions, which keep
+	// their slots until they expire
+	ViewersAtStart int  `json:"viewers_at_start,omitempty"`
+	Viewers        int  `json:"viewers"`
+	Drained        bool `json:"drained"`
+}
+
+// maintenanceState is the maintenance mode in effect, guarded by peersLock.
+type maintenanceState struct {
+	message        string
+	startedAt      time.Time
+	deadline       time.Time
+	viewersAtStart int
+	timer          *time.Timer
+}
+
+// StartMaintenance stops admitting viewers, including resumed sessions, so
+// the server can be drained. With a countdown, connected viewers are told
+// the deadline and disconnected when it passes; otherwise they keep watching
+// until they leave. Starting it again replaces the message and countdown.
+func (m *Manager) StartMaintenance(message string, countdown time.Duration) (MaintenanceStatus, error) {
+	if countdown < 0 {
+		return MaintenanceStatus{}, fmt.Errorf("maintenance countdown must not be negative")
+	}
+
+	m.peersLock.Lock()
+	now := time.Now()
+	state := m.maintenance
+	if state == nil {
+		state = &maintenanceState{startedAt: now, viewersAtStart: len(m.peers) + m.detachedViewersLocked("")}
+		m.maintenance = state
+	} else if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.message = message
+	state.deadline = time.Time{}
+	state.timer = nil
+	if countdown > 0 {
+		state.deadline = now.Add(countdown)
+		state.timer = time.AfterFunc(countdown, func() { m.endMaintenanceSessions(state) })
+	}
+	peers := make([]*Peer, 0, len(m.peers))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	m.peersLock.Unlock()
+
+	if countdown > 0 {
+		deadline := state.deadline
+		notice := MaintenanceMessage{Type: "maintenance", Message: message, Deadline: &deadline, SecondsRemaining: int(countdown.Round(time.Second) / time.Second)}
+		for _, peer := range peers {
+			if err := peer.SendJSON(notice); err != nil {
+				peer.log.Debugf("Could not send maintenance notice: %v", err)
+			}
+		}
+	}
+	m.eventBus().Publish(events.Event{Type: events.MaintenanceStarted, Data: map[string]interface{}{
+		"message":           message,
+		"countdown_seconds": int(countdown / time.Second),
+		"viewers":           len(peers),
+	}})
+	return m.Maintenance(), nil
+}
+
+// StopMaintenance admits viewers again and cancels a pending countdown.
+func (m *Manager) StopMaintenance() MaintenanceStatus {
+	m.peersLock.Lock()
+	state := m.maintenance
+	m.maintenance = nil
+	notify := state != nil && state.timer != nil && state.timer.Stop()
+	peers := make([]*Peer, 0, len(m.peers))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	m.peersLock.Unlock()
+
+	if state == nil {
+		return m.Maintenance()
+	}
+	// Only viewers still waiting for the deadline were told about it
+	if notify {
+		for _, peer := range peers {
+			_ = peer.SendJSON(MaintenanceMessage{Type: "maintenance_ended"})
+		}
+	}
+	m.eventBus().Publish(events.Event{Type: events.MaintenanceEnded, Data: map[string]interface{}{
+		"duration_seconds": int(time.Since(state.startedAt) / time.Second),
+	}})
+	return m.Maintenance()
+}
+
+// Maintenance reports whether maintenance mode is on and the viewers left.
+func (m *Manager) Maintenance() MaintenanceStatus {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	status := MaintenanceStatus{Viewers: len(m.peers) + m.detachedViewersLocked("")}
+	if state := m.maintenance; state != nil {
+		startedAt := state.startedAt
+		status.Enabled = true
+		status.Message = state.message
+		status.StartedAt = &startedAt
+		status.ViewersAtStart = state.viewersAtStart
+		status.Drained = status.Viewers == 0
+		if !state.deadline.IsZero() {
+			deadline := state.deadline
+			status.Deadline = &deadline
+		}
+	}
+	return status
+}
+
+// endMaintenanceSessions disconnects the viewers left when the countdown of
+// state passes, unless maintenance was stopped or restarted meanwhile.
+func (m *Manager) endMaintenanceSessions(state *maintenanceState) {
+	m.peersLock.RLock()
+	current := m.maintenance == state && !state.deadline.IsZero() && !time.Now().Before(state.deadline)
+	message := state.message
+	ids := make([]string, 0, len(m.peers))
+	for id := range m.peers {
+		ids = append(ids, id)
+	}
+	m.peersLock.RUnlock()
+	if !current {
+		return
+	}
+
+	reason := "server maintenance"
+	if message != "" {
+		reason += ": " + message
+	}
+	for _, id := range ids {
+		m.EndSession(id, reason)
+	}
+}
+
+// admitDuringMaintenanceLocked refuses new peers while maintenance mode is
+// on. Callers hold peersLock.
+func (m *Manager) admitDuringMaintenanceLocked(stream string) error {
+	if m.maintenance == nil {
+		return nil
+	}
+	m.events.Publish(events.Event{
+		Type:   events.PeerRejected,
+		Stream: stream,
+		Data:   map[string]interface{}{"code": LimitMaintenance},
+	})
+	return &MaintenanceError{Message: m.maintenance.message}
+}
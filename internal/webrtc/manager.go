@@ -2,34 +2,127 @@ package webrtc
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/pion/webrtc/v3"
-	"github.com/pion/webrtc/v3/pkg/media"
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/metrics"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
 	"github.com/sirupsen/logrus"
 )
 
 type Manager struct {
 	peers     map[string]*Peer
 	peersLock sync.RWMutex
-	// RTP packetization state
-	rtpSequenceNumber uint16
-	rtpTimestamp      uint32
-	rtpSSRC           uint32
-	// Real-time snapshot capture
-	snapshotRequest chan bool
-	snapshotData    chan []byte
-	snapshotReady   bool
+	// Peers that lost their connection, by resume token, and how long they
+	// are kept; guarded by peersLock
+	detached    map[string]*detachedPeer
+	resumeGrace time.Duration
+	// Usage of peers removed since it was last collected
+	removedUsage []PeerUsage
+	usageMu      sync.Mutex
+	// Video state of every stream written, by name; guarded by gopMu,
+	// which serializes the video path
+	gopMu   sync.Mutex
+	streams map[string]*streamMedia
+	// Peers by the stream they watch, "" for those following the active
+	// stream, and the active stream; guarded by peersLock
+	groups       map[string]map[string]*Peer
+	activeStream string
+	// Transcoder of the low rendition sent to downgraded peers, guarded by
+	// peersLock, and when it last produced video, guarded by gopMu
+	low        *lowRendition
+	lowFrameAt time.Time
+	// Selectable audio programs of the current source
+	audioTracks     []AudioTrackInfo
+	audioTracksLock sync.RWMutex
+	// Handlers for JSON messages received over peer data channels
+	messageHandlers map[string]MessageHandler
+	handlersLock    sync.RWMutex
+	// Size and rate limits of data channel messages, guarded by peersLock,
+	// and the messages refused by reason
+	dataChannelLimits DataChannelLimits
+	rejections        map[string]uint64
+	rejectionsMu      sync.Mutex
+	// maintenance refuses new peers while set, guarded by peersLock
+	maintenance *maintenanceState
+	// Called whenever a peer is added or removed
+	onPeersChanged func()
+	// Asks a stream's source for a keyframe, guarded by peersLock
+	onKeyframeNeeded func(stream string)
+	// Peer lifecycle events are published here, guarded by peersLock
+	events *events.Bus
+	// When client quality reports raise alerts, guarded by peersLock
+	qualityThresholds QualityThresholds
+	// Streams whose viewers may only connect through TURN, guarded by peersLock
+	relayOnlyStreams map[string]bool
+	// STUN and TURN servers of new peers, guarded by peersLock
+	iceServers ICEServerConfig
+	// ICE candidate pool size and timeouts of new peers, guarded by peersLock
+	ice ICEConfig
+	// DTLS certificate of new peers, guarded by peersLock; nil generates one per peer
+	certificate *webrtc.Certificate
+	// Default video bitrate cap of new peers, guarded by peersLock; 0 is unlimited
+	peerMaxBitrateKbps int
+	// Sender report interval and keyframe request limits, guarded by
+	// peersLock; nil means pion's defaults and unthrottled requests
+	rtcp *RTCPConfig
+	// Queue depths of live edge peers, and whether every peer is one; guarded by peersLock
+	liveEdge         LiveEdgeConfig
+	liveEdgeAllPeers bool
+	// Viewer limits of the server and per stream, guarded by peersLock; 0 is unlimited
+	maxViewers       int
+	maxStreamViewers map[string]int
+	// Session length before viewers must re-authenticate, guarded by
+	// peersLock; 0 is unlimited
+	sessionLimit time.Duration
+	// Latest startup self-test result, guarded by peersLock; nil until one finished
+	selfTestResult *SelfTestResult
+	// Uplinks of edge instances pushing streams here, by session ID
+	uplinks   map[string]*uplinkSession
+	uplinksMu sync.Mutex
+	// Configured codecs, ICE settings, and test impairment, and the API built from them; all
+	// guarded by peersLock, nil means pion's defaults
+	codecs     *CodecConfig
+	settings   *webrtc.SettingEngine
+	impairment *impairment
+	api        *webrtc.API
+	// Time from offer to first video frame of every peer
+	ttff *metrics.Histogram
+	// A/V alignment settings, and the alignment of each stream
+	avSyncCfg     AVSyncConfig
+	avSyncOffsets map[string]time.Duration
+	avSyncs       map[string]*avSync
+	avSyncLock    sync.RWMutex
 }
 
+const (
+	// maxGOPBytes bounds the replay buffer when keyframes are far apart
+	maxGOPBytes = 8 * 1024 * 1024
+	// gopReplaySampleDuration is the timestamp step used while bursting the
+	// cached GOP over the uplink, so the central instance decodes it faster
+	// than real time and catches up with the live edge
+	gopReplaySampleDuration = time.Millisecond
+	// gopReplaySpeedup is how much faster than real time the cached GOP is
+	// paced to a joining peer after its keyframe, so it catches up with the
+	// live edge
+	gopReplaySpeedup = 4
+)
+
 type Peer struct {
 	ID          string
 	Connection  *webrtc.PeerConnection
@@ -37,7 +130,65 @@ type Peer struct {
 	AudioTrack  *webrtc.TrackLocalStaticSample
 	DataChannel *webrtc.DataChannel
 	IsConnected bool
-	mu          sync.RWMutex
+	// Stream the peer was admitted to watch
+	Stream string
+	// Pinned peers keep watching Stream; the others follow the active
+	// stream when it switches
+	Pinned bool
+	// RelayOnly peers only gather and accept TURN relay candidates
+	RelayOnly bool
+	// Tags were attached when the session was authorized
+	Tags map[string]string
+	// remoteIP is the client's address when it made the offer
+	remoteIP string
+	// authorizedAt is when the session was last authorized; reauthDeadline
+	// is set while the client is asked to authenticate again
+	authorizedAt   time.Time
+	reauthDeadline time.Time
+	// resumeToken lets the client re-attach after losing its connection
+	resumeToken string
+	// trickle buffers the candidates of a peer that trickles them; nil
+	// when its answer carries all of them
+	trickle *trickleState
+	// primed is set once the cached GOP has been replayed; live video is only
+	// written to primed peers so replayed and live frames never interleave
+	primed bool
+	// audioTrackID is the selected audio program; empty means the default
+	audioTrackID string
+	// Loss from the peer's latest RTCP receiver report
+	fractionLost float64
+	lastReportAt time.Time
+	recovery     recoveryState
+	// lastRTCPAt is when the peer last sent any RTCP; staleSince is set while
+	// it has been silent for too long
+	lastRTCPAt time.Time
+	staleSince time.Time
+	// When the peer was last sent a keyframe and last had a keyframe
+	// request answered
+	lastKeyframeAt        time.Time
+	lastKeyframeRequestAt time.Time
+	// Latest playback quality reported by the client
+	quality *PeerQuality
+	// ICE candidate pair media currently flows over
+	candidatePair *CandidatePair
+	// When the offer arrived and when the first video frame was sent
+	offerAt      time.Time
+	firstFrameAt time.Time
+	// limiter enforces the peer's bitrate cap; nil when uncapped
+	limiter *bandwidthLimiter
+	// downgrade tracks whether the peer is sent the low rendition
+	downgrade downgradeState
+	// dataChannel rate limits the peer's data channel messages
+	dataChannel dataChannelState
+	// sendQueue carries the video of live edge peers; nil sends directly
+	sendQueue *sendQueue
+	// bytesSent counts the media written to the tracks; bytesCollected is
+	// the part already collected, guarded by the manager's usageMu
+	bytesSent      atomic.Uint64
+	bytesCollected uint64
+	// log carries the peer ID, stream, and remote IP on every line of the session
+	log *logrus.Entry
+	mu  sync.RWMutex
 }
 
 type OfferRequest struct {
@@ -49,101 +200,98 @@ type OfferResponse struct {
 }
 
 func NewManager() *Manager {
-	return &Manager{
-		peers:             make(map[string]*Peer),
-		rtpSequenceNumber: 0,
-		rtpTimestamp:      0,
-		rtpSSRC:           0x12345678, // Random SSRC
-		snapshotRequest:   make(chan bool, 1),
-		snapshotData:      make(chan []byte, 1),
-		snapshotReady:     false,
+	m := &Manager{
+		peers:           make(map[string]*Peer),
+		streams:         make(map[string]*streamMedia),
+		groups:          make(map[string]map[string]*Peer),
+		detached:        make(map[string]*detachedPeer),
+		messageHandlers: make(map[string]MessageHandler),
+		iceServers:      defaultICEServers,
+		liveEdge:        defaultLiveEdge,
+		avSyncs:         make(map[string]*avSync),
+		ttff:            metrics.NewHistogram(timeToFirstFrameBuckets...),
 	}
+	m.RegisterMessageHandler("select_audio_track", m.handleSelectAudioTrack)
+	m.RegisterMessageHandler("quality_report", m.handleQualityReport)
+	return m
+}
+
+// PeerOptions adjusts how a single peer connection is set up.
+type PeerOptions struct {
+	// Stream is counted against its viewer limit
+	Stream string
+	// Pinned keeps the peer on Stream; otherwise it watches the active
+	// stream, whichever that is
+	Pinned bool
+	// RelayOnly restricts ICE to TURN relay candidates, so neither side's
+	// host or server-reflexive addresses are exposed
+	RelayOnly bool
+	// Tags label the session, e.g. with the tenant or user that authorized it
+	Tags map[string]string
+	// MaxBitrateKbps caps the video sent to the peer; the lower of it and
+	// the manager's default applies
+	MaxBitrateKbps int
+	// OfferReceivedAt starts the peer's time to first frame; zero means now
+	OfferReceivedAt time.Time
+	// RemoteIP is the client's address, added to the peer's log lines
+	RemoteIP string
+	// LiveEdge drops video the peer falls behind on, to keep its latency low
+	LiveEdge bool
+	// ResumeToken re-attaches to the detached peer it was issued to, which
+	// must have the same ID; its selections and statistics carry over
+	ResumeToken string
+	// Trickle answers the offer right away and trickles the ICE candidates
+	// afterwards, instead of waiting for all of them
+	Trickle bool
 }
 
 func (m *Manager) CreatePeer(peerID string) (*Peer, error) {
+	return m.CreatePeerWithOptions(peerID, PeerOptions{})
+}
+
+// CreatePeerWithOptions creates a peer like CreatePeer with per-peer options.
+func (m *Manager) CreatePeerWithOptions(peerID string, opts PeerOptions) (*Peer, error) {
+	// Deferred first so it runs after peersLock is released
+	defer m.notifyPeersChanged()
 	m.peersLock.Lock()
 	defer m.peersLock.Unlock()
 
-	// Create WebRTC configuration optimized for local development
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-			{
-				URLs: []string{"stun:stun1.l.google.com:19302"},
-			},
-			{
-				URLs: []string{"stun:stun2.l.google.com:19302"},
-			},
-			{
-				URLs: []string{"stun:stun3.l.google.com:19302"},
-			},
-			{
-				URLs: []string{"stun:stun4.l.google.com:19302"},
-			},
-			// Local TURN server for development
-			{
-				URLs:       []string{"turn:127.0.0.1:3478"},
-				Username:   "webrtc",
-				Credential: "webrtc123",
-			},
-			{
-				URLs:       []string{"turn:127.0.0.1:3478"},
-				Username:   "test",
-				Credential: "test123",
-			},
-		},
-		ICETransportPolicy:   webrtc.ICETransportPolicyAll,
-		BundlePolicy:         webrtc.BundlePolicyBalanced,
-		RTCPMuxPolicy:        webrtc.RTCPMuxPolicyRequire,
-		ICECandidatePoolSize: 10,
+	// A resumed peer takes the slot its detached session kept
+	var resumed *detachedPeer
+	if opts.ResumeToken != "" {
+		d, err := m.claimDetachedLocked(opts.ResumeToken)
+		if err != nil {
+			return nil, err
+		}
+		resumed = d
 	}
-
-	// Create peer connection
-	peerConnection, err := webrtc.NewPeerConnection(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	// keepDetached leaves the session for another attempt when this one fails
+	keepDetached := func() {
+		if resumed != nil {
+			m.detached[opts.ResumeToken] = resumed
+			resumed.timer.Reset(time.Until(resumed.detachedAt.Add(m.resumeGrace)))
+		}
 	}
-
-	// Create video track - use H.264 for better compatibility with RTMP streams
-	videoTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{
-			MimeType:     webrtc.MimeTypeH264,
-			ClockRate:    90000,
-			Channels:     0,
-			SDPFmtpLine:  "profile-level-id=42e01f;packetization-mode=1",
-			RTCPFeedback: nil,
-		},
-		"video",
-		"stream",
-	)
-	if err != nil {
-		peerConnection.Close()
-		return nil, fmt.Errorf("failed to create video track: %w", err)
+	// A resumed peer's own session was claimed above, so its ID is free
+	if m.peerIDTakenLocked(peerID) {
+		keepDetached()
+		return nil, fmt.Errorf("%w: %s", ErrPeerExists, peerID)
 	}
-
-	// Create audio track
-	audioTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
-		"audio",
-		"stream",
-	)
-	if err != nil {
-		peerConnection.Close()
-		return nil, fmt.Errorf("failed to create audio track: %w", err)
+	if err := m.admitDuringMaintenanceLocked(opts.Stream); err != nil {
+		keepDetached()
+		return nil, err
 	}
-
-	// Add tracks to peer connection
-	if _, err = peerConnection.AddTrack(videoTrack); err != nil {
-		peerConnection.Close()
-		return nil, fmt.Errorf("failed to add video track: %w", err)
+	if err := m.admitViewerLocked(opts.Stream); err != nil {
+		keepDetached()
+		return nil, err
 	}
 
-	if _, err = peerConnection.AddTrack(audioTrack); err != nil {
-		peerConnection.Close()
-		return nil, fmt.Errorf("failed to add audio track: %w", err)
+	media, err := m.newMediaConnection(peerID, opts.RelayOnly)
+	if err != nil {
+		keepDetached()
+		return nil, err
 	}
+	peerConnection, videoTrack, audioTrack := media.pc, media.video, media.audio
 
 	// Create data channel for signaling
 	dataChannel, err := peerConnection.CreateDataChannel("signaling", nil)
@@ -151,53 +299,212 @@ func (m *Manager) CreatePeer(peerID string) (*Peer, error) {
 		logrus.Warnf("Failed to create data channel: %v", err)
 	}
 
+	offerAt := opts.OfferReceivedAt
+	if offerAt.IsZero() {
+		offerAt = time.Now()
+	}
+
 	peer := &Peer{
-		ID:          peerID,
-		Connection:  peerConnection,
-		VideoTrack:  videoTrack,
-		AudioTrack:  audioTrack,
-		DataChannel: dataChannel,
-		IsConnected: false,
+		ID:           peerID,
+		Connection:   peerConnection,
+		VideoTrack:   videoTrack,
+		AudioTrack:   audioTrack,
+		DataChannel:  dataChannel,
+		IsConnected:  false,
+		Stream:       opts.Stream,
+		Pinned:       opts.Pinned,
+		RelayOnly:    opts.RelayOnly,
+		Tags:         opts.Tags,
+		remoteIP:     opts.RemoteIP,
+		authorizedAt: offerAt,
+		limiter:      newBandwidthLimiter(LowestBitrate(m.peerMaxBitrateKbps, opts.MaxBitrateKbps)),
+		offerAt:      offerAt,
+		log:          newPeerLog(peerID, opts.Stream, opts.RemoteIP),
+	}
+	if resumed != nil {
+		peer.resumeToken = opts.ResumeToken
+		peer.resumeFrom(resumed.peer)
+		m.moveUsage(resumed.peer, peer)
+	} else if m.resumeGrace > 0 {
+		peer.resumeToken = newResumeToken()
+	}
+	if opts.Trickle {
+		peer.trickle = newTrickleState()
+	}
+	if opts.LiveEdge || m.liveEdgeAllPeers {
+		peer.sendQueue = newSendQueue(m.liveEdge)
+		go m.sendQueued(peer, peer.sendQueue)
 	}
 
+	go m.readRTCP(peer, media.videoSender)
+	m.watchCandidatePair(peer)
+
+	// Accept commands both on our channel and on channels opened by the client
+	if dataChannel != nil {
+		m.attachDataChannel(peer, dataChannel)
+	}
+	peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
+		m.attachDataChannel(peer, dc)
+	})
+
 	// Set up connection state change handler
 	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		peer.mu.Lock()
 		peer.IsConnected = (state == webrtc.PeerConnectionStateConnected)
 		peer.mu.Unlock()
 
-		logrus.Infof("Peer %s connection state: %s", peerID, state.String())
+		peer.log.Infof("Connection state: %s", state.String())
+
+		if state == webrtc.PeerConnectionStateConnected {
+			go m.replayGOP(peer)
+			ev := events.Event{Type: events.PeerConnected, Peer: peerID}
+			if len(peer.Tags) > 0 {
+				ev.Data = map[string]interface{}{"tags": peer.Tags}
+			}
+			m.eventBus().Publish(ev)
+		}
 
 		if state == webrtc.PeerConnectionStateClosed || state == webrtc.PeerConnectionStateFailed {
-			m.RemovePeer(peerID)
+			m.detachPeer(peer)
 		}
 	})
 
 	// Set up ICE connection state change handler
 	peerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
-		logrus.Infof("Peer %s ICE connection state: %s", peerID, state.String())
+		peer.log.Infof("ICE connection state: %s", state.String())
+		peer.setICEState(state)
 	})
 
 	// Set up ICE candidate handler for local development
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate != nil {
-			logrus.Infof("Peer %s ICE candidate: %s", peerID, candidate.String())
+			peer.log.Infof("ICE candidate: %s", candidate.String())
 		} else {
-			logrus.Infof("Peer %s ICE gathering complete", peerID)
+			peer.log.Info("ICE gathering complete")
+		}
+		if peer.trickle != nil {
+			peer.trickle.add(candidate)
 		}
 	})
 
 	// Set up ICE gathering state change handler
-	peerConnection.OnICEGatheringStateChange(func(state webrtc.ICEGathererState) {
-		logrus.Infof("Peer %s ICE gathering state: %s", peerID, state.String())
+	peerConnection.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
+		peer.log.Infof("ICE gathering state: %s", state.String())
 	})
 
 	m.peers[peerID] = peer
-	logrus.Infof("Created peer: %s", peerID)
+	m.joinGroupLocked(peer)
+	if resumed != nil {
+		detached := time.Since(resumed.detachedAt)
+		peer.log.Infof("Resumed peer after %s", detached.Round(time.Millisecond))
+		m.events.Publish(events.Event{
+			Type:   events.PeerResumed,
+			Peer:   peerID,
+			Stream: opts.Stream,
+			Data:   map[string]interface{}{"detached_seconds": detached.Seconds()},
+		})
+		return peer, nil
+	}
+	peer.log.Info("Created peer")
 
 	return peer, nil
 }
 
+// mediaConnection is a peer connection carrying the video and audio tracks.
+type mediaConnection struct {
+	pc          *webrtc.PeerConnection
+	video       *webrtc.TrackLocalStaticSample
+	audio       *webrtc.TrackLocalStaticSample
+	videoSender *webrtc.RTPSender
+}
+
+// maxSSRCAttempts bounds the peer connections created to draw distinct
+// video and audio SSRCs.
+const maxSSRCAttempts = 3
+
+// newMediaConnection creates a peer connection with the configured ICE
+// servers and adds the video and audio tracks. Callers must hold peersLock.
+//
+// RTP state is kept per track of each peer: every track packetizes its own
+// samples, with a sequence number and timestamp that keep counting up for
+// the life of the peer, across restarts and switches of the source, and
+// its sender has an SSRC of its own.
+func (m *Manager) newMediaConnection(peerID string, relayOnly bool) (*mediaConnection, error) {
+	return m.newMediaConnectionAttempt(peerID, relayOnly, 1)
+}
+
+func (m *Manager) newMediaConnectionAttempt(peerID string, relayOnly bool, attempt int) (*mediaConnection, error) {
+	// Create WebRTC configuration
+	config := webrtc.Configuration{
+		ICEServers:           m.iceServers.Servers(peerID),
+		ICETransportPolicy:   webrtc.ICETransportPolicyAll,
+		BundlePolicy:         webrtc.BundlePolicyBalanced,
+		RTCPMuxPolicy:        webrtc.RTCPMuxPolicyRequire,
+		ICECandidatePoolSize: 10,
+	}
+	if relayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	if m.certificate != nil {
+		config.Certificates = []webrtc.Certificate{*m.certificate}
+	}
+
+	// Create peer connection
+	peerConnection, err := m.newPeerConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+
+	// Create video track in the most preferred H.264 variant
+	videoCodec, audioCodec := m.trackCodecs()
+	videoTrack, err := webrtc.NewTrackLocalStaticSample(videoCodec, "video", "stream")
+	if err != nil {
+		peerConnection.Close()
+		return nil, fmt.Errorf("failed to create video track: %w", err)
+	}
+
+	// Create audio track
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(audioCodec, "audio", "stream")
+	if err != nil {
+		peerConnection.Close()
+		return nil, fmt.Errorf("failed to create audio track: %w", err)
+	}
+
+	// Add tracks to peer connection
+	videoSender, err := peerConnection.AddTrack(videoTrack)
+	if err != nil {
+		peerConnection.Close()
+		return nil, fmt.Errorf("failed to add video track: %w", err)
+	}
+
+	audioSender, err := peerConnection.AddTrack(audioTrack)
+	if err != nil {
+		peerConnection.Close()
+		return nil, fmt.Errorf("failed to add audio track: %w", err)
+	}
+
+	// Senders draw their SSRCs at random; bundled on one transport, the
+	// tracks must not share one
+	if senderSSRC(videoSender) == senderSSRC(audioSender) {
+		peerConnection.Close()
+		if attempt < maxSSRCAttempts {
+			return m.newMediaConnectionAttempt(peerID, relayOnly, attempt+1)
+		}
+		return nil, fmt.Errorf("failed to assign distinct SSRCs to the video and audio tracks")
+	}
+
+	return &mediaConnection{pc: peerConnection, video: videoTrack, audio: audioTrack, videoSender: videoSender}, nil
+}
+
+// senderSSRC returns the SSRC a sender sends its track with.
+func senderSSRC(sender *webrtc.RTPSender) webrtc.SSRC {
+	encodings := sender.GetParameters().Encodings
+	if len(encodings) == 0 {
+		return 0
+	}
+	return encodings[0].SSRC
+}
+
 func (m *Manager) GetPeer(peerID string) (*Peer, bool) {
 	m.peersLock.RLock()
 	defer m.peersLock.RUnlock()
@@ -205,69 +512,175 @@ func (m *Manager) GetPeer(peerID string) (*Peer, bool) {
 	return peer, exists
 }
 
+// SetEvents publishes peer connects and disconnects on bus.
+func (m *Manager) SetEvents(bus *events.Bus) {
+	m.peersLock.Lock()
+	m.events = bus
+	m.peersLock.Unlock()
+}
+
+func (m *Manager) eventBus() *events.Bus {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	return m.events
+}
+
+// OnPeersChanged registers a callback run after a peer is added or removed,
+// used to start and stop sources on demand.
+func (m *Manager) OnPeersChanged(handler func()) {
+	m.peersLock.Lock()
+	m.onPeersChanged = handler
+	m.peersLock.Unlock()
+}
+
+func (m *Manager) notifyPeersChanged() {
+	m.peersLock.RLock()
+	handler := m.onPeersChanged
+	m.peersLock.RUnlock()
+	if handler != nil {
+		handler()
+	}
+}
+
 func (m *Manager) RemovePeer(peerID string) {
+	defer m.notifyPeersChanged()
 	m.peersLock.Lock()
-	defer m.peersLock.Unlock()
+	peer, exists := m.peers[peerID]
+	if exists {
+		delete(m.peers, peerID)
+		m.leaveGroupLocked(peer)
+	}
+	bus := m.events
+	m.peersLock.Unlock()
 
-	if peer, exists := m.peers[peerID]; exists {
+	if exists {
+		if peer.sendQueue != nil {
+			peer.sendQueue.close()
+		}
 		peer.Connection.Close()
-		delete(m.peers, peerID)
-		logrus.Infof("Removed peer: %s", peerID)
+		peer.log.Info("Removed peer")
+		closePeerLog(peerID)
+		m.retireUsage(peer)
+		bus.Publish(events.Event{
+			Type: events.PeerDisconnected,
+			Peer: peerID,
+			Data: map[string]interface{}{"bytes_sent": peer.BytesSent()},
+		})
 	}
 }
 
-func (m *Manager) HandleOffer(peerID string, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+// HandleOffer answers a peer's offer. Peers created with Trickle are
+// answered before their ICE candidates are gathered; for the others, ctx
+// bounds the wait for them.
+func (m *Manager) HandleOffer(ctx context.Context, peerID string, offer SessionDescription) (*SessionDescription, error) {
 	peer, exists := m.GetPeer(peerID)
 	if !exists {
 		return nil, fmt.Errorf("peer not found: %s", peerID)
 	}
+	return m.handleOffer(ctx, peer, offer, peer.trickle == nil)
+}
 
-	logrus.Infof("Handling offer for peer %s: %+v", peerID, offer)
+func (m *Manager) handleOffer(ctx context.Context, peer *Peer, offer webrtc.SessionDescription, waitGathering bool) (*webrtc.SessionDescription, error) {
+	maxBitrateKbps := 0
+	if stats, capped := m.PeerBandwidth(peer.ID); capped {
+		maxBitrateKbps = stats.MaxBitrateKbps
+	}
+	local, err := m.answerOffer(ctx, peer.log, peer.Connection, offer, maxBitrateKbps, waitGathering)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark peer as connected after successful SDP negotiation
+	peer.mu.Lock()
+	peer.IsConnected = true
+	peer.mu.Unlock()
+	peer.log.Info("Marked as connected after SDP negotiation")
+
+	return local, nil
+}
+
+// answerOffer negotiates an offer on pc and returns the answer, once ICE
+// gathering has completed if waitGathering is set, unless ctx is done first.
+// A positive maxBitrateKbps is announced in it.
+func (m *Manager) answerOffer(ctx context.Context, log *logrus.Entry, pc *webrtc.PeerConnection, offer webrtc.SessionDescription, maxBitrateKbps int, waitGathering bool) (*webrtc.SessionDescription, error) {
+	// Only the size: the SDP carries the ICE password, and logs end up in
+	// peer logs and debug bundles
+	log.Infof("Handling %s of %d bytes", offer.Type, len(offer.SDP))
 
 	// Set remote description
-	if err := peer.Connection.SetRemoteDescription(offer); err != nil {
-		logrus.Errorf("Failed to set remote description: %v", err)
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		log.Errorf("Failed to set remote description: %v", err)
 		return nil, fmt.Errorf("failed to set remote description: %w", err)
 	}
 
-	logrus.Infof("Remote description set successfully for peer %s", peerID)
+	log.Info("Remote description set successfully")
+
+	if err := m.applyCodecPreferences(pc); err != nil {
+		return nil, err
+	}
 
 	// Create answer
-	answer, err := peer.Connection.CreateAnswer(nil)
+	answer, err := pc.CreateAnswer(nil)
 	if err != nil {
-		logrus.Errorf("Failed to create answer: %v", err)
+		log.Errorf("Failed to create answer: %v", err)
 		return nil, fmt.Errorf("failed to create answer: %w", err)
 	}
 
-	logrus.Infof("Answer created successfully for peer %s", peerID)
+	log.Info("Answer created successfully")
 
 	// Set local description
-	if err := peer.Connection.SetLocalDescription(answer); err != nil {
-		logrus.Errorf("Failed to set local description: %v", err)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		log.Errorf("Failed to set local description: %v", err)
 		return nil, fmt.Errorf("failed to set local description: %w", err)
 	}
 
-	logrus.Infof("Local description set successfully for peer %s", peerID)
+	log.Info("Local description set successfully")
 
 	// Wait for ICE gathering to complete so the client receives a full, non-trickle SDP
-	iceComplete := webrtc.GatheringCompletePromise(peer.Connection)
-	<-iceComplete
-	local := peer.Connection.LocalDescription()
-
-	// Mark peer as connected after successful SDP negotiation
-	peer.mu.Lock()
-	peer.IsConnected = true
-	peer.mu.Unlock()
-	logrus.Infof("Peer %s marked as connected after SDP negotiation", peerID)
+	if waitGathering {
+		select {
+		case <-webrtc.GatheringCompletePromise(pc):
+		case <-ctx.Done():
+			log.Warnf("ICE gathering did not complete: %v", ctx.Err())
+			return nil, fmt.Errorf("ICE gathering did not complete: %w", ctx.Err())
+		}
+	}
+	local := pc.LocalDescription()
 
+	// pion refuses a modified answer, so the cap is only added to the copy
+	// sent to the client
+	if maxBitrateKbps > 0 {
+		limited, err := limitAnswerBitrate(*local, maxBitrateKbps)
+		if err != nil {
+			return nil, err
+		}
+		local = &limited
+	}
 	return local, nil
 }
 
+// WriteVideoSample writes an H.264 access unit of the active stream to its
+// viewers, held back as long as A/V sync requires.
 func (m *Manager) WriteVideoSample(data []byte, timestamp uint32) {
+	m.WriteStreamVideoSample(m.ActiveStream(), data, timestamp)
+}
+
+// WriteStreamVideoSample writes an H.264 access unit of a stream to its
+// viewers, aligned with the stream's audio.
+func (m *Manager) WriteStreamVideoSample(stream string, data []byte, timestamp uint32) {
+	stream = strings.ToLower(stream)
+	m.writeSynced(stream, true, data, timestamp, func(data []byte) {
+		m.writeVideoSample(stream, data, timestamp)
+	})
+}
+
+func (m *Manager) writeVideoSample(stream string, data []byte, timestamp uint32) {
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
 	m.peersLock.RLock()
 	defer m.peersLock.RUnlock()
 
-	logrus.Debugf("Writing video sample: size=%d, timestamp=%d, peers=%d", len(data), timestamp, len(m.peers))
+	logrus.Debugf("Writing video sample of %s: size=%d, timestamp=%d", stream, len(data), timestamp)
 
 	// Check if data has valid H.264 start codes
 	if len(data) >= 4 {
@@ -279,23 +692,6 @@ func (m *Manager) WriteVideoSample(data []byte, timestamp uint32) {
 		}
 	}
 
-	// Check if snapshot is requested and capture this frame
-	select {
-	case <-m.snapshotRequest:
-		// Capture this frame for snapshot
-		frameCopy := make([]byte, len(data))
-		copy(frameCopy, data)
-		select {
-		case m.snapshotData <- frameCopy:
-			logrus.Info("Frame captured for snapshot")
-		default:
-			// Channel is full, skip this frame
-			logrus.Warn("Snapshot channel full, skipping frame")
-		}
-	default:
-		// No snapshot request, continue normally
-	}
-
 	// Parse H.264 NAL units from the data
 	nalUnits, err := m.parseH264NALUnits(data)
 	if err != nil {
@@ -305,64 +701,308 @@ func (m *Manager) WriteVideoSample(data []byte, timestamp uint32) {
 
 	logrus.Debugf("Parsed %d NAL units from video sample", len(nalUnits))
 
-	for _, peer := range m.peers {
-		peer.mu.RLock()
-		hasVideoTrack := peer.VideoTrack != nil
-		peer.mu.RUnlock()
+	keyframe := containsKeyframe(nalUnits)
+	sm := m.mediaLocked(stream)
+	if sm.holdForResync(keyframe) {
+		return
+	}
 
-		if hasVideoTrack {
-			// Send each NAL unit as a separate sample
-			for i, nalUnit := range nalUnits {
-				if len(nalUnit) == 0 {
-					continue
-				}
+	// Waiting snapshots take the first complete IDR access unit, the
+	// earliest picture that decodes on its own
+	if keyframe && len(sm.snapshotWaiters) > 0 {
+		if frame := sm.idrSnapshot(nalUnits); frame != nil {
+			for _, waiter := range sm.snapshotWaiters {
+				waiter <- frame
+			}
+			logrus.Infof("Keyframe of %s captured for %d snapshots", stream, len(sm.snapshotWaiters))
+			sm.snapshotWaiters = nil
+		}
+	}
 
-				// Log NAL unit type for debugging
-				if len(nalUnit) > 0 {
-					nalType := nalUnit[0] & 0x1F
-					logrus.Debugf("NAL unit %d: type=%d, size=%d", i, nalType, len(nalUnit))
-				}
+	sm.cacheGOP(nalUnits)
+	// The low rendition is transcoded from the active stream only; viewers
+	// of other streams are always sent the main one
+	active := stream == m.activeStream
+	if active {
+		m.low.feed(data, keyframe)
+	}
+	now := time.Now()
+	// Shared by the send queues of live edge peers, copied on first use
+	var queued *queuedFrame
+	lowStale := !active || now.Sub(m.lowFrameAt) > lowRenditionStale
+
+	m.forEachViewerLocked(stream, func(peer *Peer) {
+		// Downgraded peers are sent the low rendition instead, unless it
+		// has no video
+		if peer.takesRendition(false, keyframe, lowStale) {
+			m.sendVideo(peer, nalUnits, len(data), keyframe, timestamp, now, &queued)
+		}
+	})
+}
 
-				sample := media.Sample{
-					Data:     nalUnit,
-					Duration: time.Millisecond * 33, // ~30fps
-				}
-				if timestamp > 0 {
-					sample.PacketTimestamp = timestamp
-				}
+// sendVideo writes an access unit to a peer, directly or through its live
+// edge queue. queued is the frame shared by the queues of all peers, created
+// on first use.
+func (m *Manager) sendVideo(peer *Peer, nalUnits [][]byte, size int, keyframe bool, timestamp uint32, now time.Time, queued **queuedFrame) {
+	// Capped peers skip frames over their budget until the next keyframe
+	peer.mu.Lock()
+	hasVideoTrack := peer.VideoTrack != nil && peer.primed && peer.limiter.allow(size, keyframe, now)
+	firstFrame := peer.firstFrameAt.IsZero()
+	if hasVideoTrack && keyframe && peer.sendQueue == nil {
+		peer.lastKeyframeAt = now
+	}
+	peer.mu.Unlock()
+
+	if hasVideoTrack && peer.sendQueue != nil {
+		if *queued == nil {
+			*queued = newQueuedFrame(nalUnits, keyframe)
+		}
+		peer.sendQueue.push(*queued)
+		return
+	}
+	if !hasVideoTrack {
+		return
+	}
+
+	// Send each NAL unit as a separate sample
+	for i, nalUnit := range nalUnits {
+		if len(nalUnit) == 0 {
+			continue
+		}
+
+		// Log NAL unit type for debugging
+		nalType := nalUnit[0] & 0x1F
+		logrus.Debugf("NAL unit %d: type=%d, size=%d", i, nalType, len(nalUnit))
+
+		sample := media.Sample{
+			Data:     nalUnit,
+			Duration: time.Millisecond * 33, // ~30fps
+		}
+		if timestamp > 0 {
+			sample.PacketTimestamp = timestamp
+		}
+
+		if err := peer.VideoTrack.WriteSample(sample); err != nil {
+			peer.log.Errorf("Failed to write video sample: %v", err)
+		} else {
+			peer.countSent(len(nalUnit))
+			logrus.Debugf("Successfully wrote NAL unit to peer %s: size=%d", peer.ID, len(nalUnit))
+			if firstFrame {
+				m.markFirstFrame(peer)
+				firstFrame = false
+			}
+		}
+	}
+}
+
+// cacheGOP appends NAL units to the replay and rolling buffers, restarting
+// the replay buffer at each keyframe. Callers must hold gopMu.
+func (s *streamMedia) cacheGOP(nalUnits [][]byte) {
+	now := time.Now()
+	copies := make([][]byte, 0, len(nalUnits))
+	starts := make([]bool, 0, len(nalUnits))
+
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) == 0 {
+			continue
+		}
+
+		nalType := nalUnit[0] & 0x1F
+		// A keyframe starts either with SPS or with the first IDR slice
+		// following non-keyframe data
+		startsGOP := nalType == 7 ||
+			(nalType == 5 && s.gopLastNALType != 5 && s.gopLastNALType != 7 && s.gopLastNALType != 8 && s.gopLastNALType != 6)
+		s.gopLastNALType = nalType
+
+		nalCopy := make([]byte, len(nalUnit))
+		copy(nalCopy, nalUnit)
+		copies = append(copies, nalCopy)
+		s.rememberParameterSets(nalCopy)
+		starts = append(starts, startsGOP)
+
+		if startsGOP {
+			s.resetGOP()
+			s.gopStarted = true
+		}
+		if !s.gopStarted {
+			continue
+		}
+
+		if s.gopBytes+len(nalUnit) > maxGOPBytes {
+			logrus.Warnf("GOP exceeds %d bytes, dropping replay buffer until next keyframe", maxGOPBytes)
+			s.resetGOP()
+			s.gopStarted = false
+			continue
+		}
+
+		s.gop = append(s.gop, nalCopy)
+		s.gopAt = append(s.gopAt, now)
+		s.gopBytes += len(nalCopy)
+	}
+
+	s.appendRolling(copies, starts, now)
+}
+
+// replayGOP sends the cached GOP of the stream a peer watches to it and
+// then lets it receive live video, so the first picture appears without
+// waiting for the next keyframe. The keyframe goes out at once and the rest
+// is paced gopReplaySpeedup times faster than real time, with the sample
+// durations the frames arrived at. gopMu is only held to copy what was
+// cached, so live video of every stream keeps flowing meanwhile; frames
+// cached during the replay are sent too, until the peer has caught up and
+// is handed over to live video under gopMu.
+func (m *Manager) replayGOP(peer *Peer) {
+	peer.mu.RLock()
+	primed := peer.primed
+	peer.mu.RUnlock()
+	if primed || peer.VideoTrack == nil {
+		return
+	}
+	if q := peer.sendQueue; q != nil {
+		q.clear()
+		q.writeMu.Lock()
+		defer q.writeMu.Unlock()
+	}
 
-				if err := peer.VideoTrack.WriteSample(sample); err != nil {
-					logrus.Errorf("Failed to write video sample to peer %s: %v", peer.ID, err)
-				} else {
-					logrus.Debugf("Successfully wrote NAL unit to peer %s: size=%d", peer.ID, len(nalUnit))
+	var (
+		stream   string
+		gen      uint64
+		next     int
+		nalUnits int
+		size     int
+		// held is the last NAL unit copied, written once the next one's
+		// arrival gives its duration
+		held   []byte
+		heldAt time.Time
+		failed bool
+	)
+	write := func(nalUnit []byte, duration time.Duration) {
+		if failed {
+			return
+		}
+		if err := peer.VideoTrack.WriteSample(media.Sample{Data: nalUnit, Duration: duration}); err != nil {
+			peer.log.Errorf("Failed to replay GOP: %v", err)
+			failed = true
+			return
+		}
+		peer.countSent(len(nalUnit))
+		if nalUnits == 0 {
+			m.markFirstFrame(peer)
+		}
+		nalUnits++
+		size += len(nalUnit)
+	}
+
+	for {
+		m.gopMu.Lock()
+		m.peersLock.RLock()
+		current := m.peerStreamLocked(peer)
+		m.peersLock.RUnlock()
+		sm := m.mediaLocked(current)
+		// A new GOP, or that of another stream, starts over at its keyframe
+		if current != stream || sm.gopGen != gen {
+			stream, gen, next = current, sm.gopGen, 0
+		}
+		closed := peer.Connection != nil && peer.Connection.ConnectionState() == webrtc.PeerConnectionStateClosed
+		if next >= len(sm.gop) || failed || closed {
+			// Caught up: the last NAL unit lasts until live video, which
+			// takes over while gopMu is held, so no frame is lost or sent
+			// twice
+			if held != nil {
+				write(held, time.Since(heldAt))
+			}
+			if nalUnits == 0 {
+				// Rather than wait out the source's GOP, ask it for a keyframe
+				m.requestSourceKeyframeLocked(stream)
+			}
+			peer.mu.Lock()
+			peer.primed = true
+			if nalUnits > 0 {
+				peer.lastKeyframeAt = time.Now()
+			}
+			peer.mu.Unlock()
+			m.gopMu.Unlock()
+			break
+		}
+		gop := append([][]byte(nil), sm.gop[next:]...)
+		arrivals := append([]time.Time(nil), sm.gopAt[next:]...)
+		next = len(sm.gop)
+		m.gopMu.Unlock()
+
+		for i, nalUnit := range gop {
+			if held != nil {
+				duration := arrivals[i].Sub(heldAt)
+				if duration < 0 {
+					duration = 0
+				}
+				write(held, duration)
+				// NAL units of one access unit arrive together; the pause
+				// comes before the next one
+				if duration > 0 {
+					time.Sleep(duration / gopReplaySpeedup)
 				}
 			}
+			held, heldAt = nalUnit, arrivals[i]
 		}
 	}
+
+	peer.log.Infof("Replayed cached GOP of %s: %d NAL units, %d bytes", stream, nalUnits, size)
 }
 
+// WriteAudioSample writes a sample of the default audio program of the
+// active stream.
 func (m *Manager) WriteAudioSample(data []byte, timestamp uint32) {
+	m.WriteAudioTrackSample(m.defaultAudioTrackID(), data, timestamp)
+}
+
+// WriteStreamAudioSample writes an audio sample of a stream to its viewers,
+// aligned with the stream's video. The active stream's is its default
+// audio program.
+func (m *Manager) WriteStreamAudioSample(stream string, data []byte, timestamp uint32) {
+	stream = strings.ToLower(stream)
+	if stream == m.ActiveStream() {
+		m.WriteAudioSample(data, timestamp)
+		return
+	}
+	m.writeSynced(stream, false, data, timestamp, func(data []byte) {
+		m.writeAudioTrackSample(stream, "", data, timestamp)
+	})
+}
+
+// Broadcast sends a JSON message to every peer with an open data channel.
+func (m *Manager) Broadcast(message interface{}) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		logrus.Errorf("Failed to encode data channel message: %v", err)
+		return
+	}
+
 	m.peersLock.RLock()
 	defer m.peersLock.RUnlock()
 
 	for _, peer := range m.peers {
-		peer.mu.RLock()
-		if peer.IsConnected && peer.AudioTrack != nil {
-			sample := media.Sample{
-				Data:     data,
-				Duration: time.Millisecond * 20, // ~50fps for audio
-			}
-			if timestamp > 0 {
-				sample.PacketTimestamp = timestamp
-			}
-			if err := peer.AudioTrack.WriteSample(sample); err != nil {
-				logrus.Errorf("Failed to write audio sample to peer %s: %v", peer.ID, err)
-			}
+		if err := peer.sendText(string(payload)); err != nil {
+			peer.log.Debugf("Failed to send data channel message: %v", err)
 		}
-		peer.mu.RUnlock()
 	}
 }
 
+// SendJSON sends a JSON message to this peer over its data channel.
+func (p *Peer) SendJSON(message interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode data channel message: %w", err)
+	}
+	return p.sendText(string(payload))
+}
+
+func (p *Peer) sendText(text string) error {
+	if p.DataChannel == nil || p.DataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("data channel not open")
+	}
+	return p.DataChannel.SendText(text)
+}
+
 func (m *Manager) GetConnectedPeersCount() int {
 	m.peersLock.RLock()
 	defer m.peersLock.RUnlock()
@@ -378,6 +1018,14 @@ func (m *Manager) GetConnectedPeersCount() int {
 	return count
 }
 
+// PeerCount returns the number of peers, including those still connecting
+// and those that may still resume.
+func (m *Manager) PeerCount() int {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	return len(m.peers) + len(m.detached)
+}
+
 func (m *Manager) GetAllPeers() map[string]*Peer {
 	m.peersLock.RLock()
 	defer m.peersLock.RUnlock()
@@ -454,99 +1102,6 @@ func (m *Manager) parseH264NALUnits(data []byte) ([][]byte, error) {
 	return nalUnits, nil
 }
 
-// packetizeNALUnit converts a NAL unit to RTP packets
-func (m *Manager) packetizeNALUnit(nalUnit []byte, timestamp uint32) [][]byte {
-	if len(nalUnit) == 0 {
-		return nil
-	}
-
-	// RTP header size
-	const rtpHeaderSize = 12
-	const maxPayloadSize = 1400 // MTU - IP - UDP - RTP headers
-
-	// Update RTP timestamp
-	if timestamp > 0 {
-		m.rtpTimestamp = timestamp * 90 // Convert ms to 90kHz clock
-	} else {
-		m.rtpTimestamp += 3000 // ~33ms at 90kHz
-	}
-
-	// Increment sequence number
-	m.rtpSequenceNumber++
-
-	// If NAL unit fits in one packet
-	if len(nalUnit) <= maxPayloadSize {
-		rtpPacket := make([]byte, rtpHeaderSize+len(nalUnit))
-
-		// RTP header
-		rtpPacket[0] = 0x80 // Version 2, no padding, no extension, no CSRC
-		rtpPacket[1] = 0x60 // Payload type 96 (H.264)
-		rtpPacket[2] = byte(m.rtpSequenceNumber >> 8)
-		rtpPacket[3] = byte(m.rtpSequenceNumber)
-		rtpPacket[4] = byte(m.rtpTimestamp >> 24)
-		rtpPacket[5] = byte(m.rtpTimestamp >> 16)
-		rtpPacket[6] = byte(m.rtpTimestamp >> 8)
-		rtpPacket[7] = byte(m.rtpTimestamp)
-		rtpPacket[8] = byte(m.rtpSSRC >> 24)
-		rtpPacket[9] = byte(m.rtpSSRC >> 16)
-		rtpPacket[10] = byte(m.rtpSSRC >> 8)
-		rtpPacket[11] = byte(m.rtpSSRC)
-
-		// Copy NAL unit
-		copy(rtpPacket[rtpHeaderSize:], nalUnit)
-
-		return [][]byte{rtpPacket}
-	}
-
-	// Fragment the NAL unit using FU-A
-	var packets [][]byte
-	nalType := nalUnit[0] & 0x1F
-	nalHeader := (nalUnit[0] & 0x60) | 28 // FU-A type
-
-	offset := 1 // Skip NAL header
-	for offset < len(nalUnit) {
-		payloadSize := maxPayloadSize - 2 // Reserve space for FU-A header
-		if offset+payloadSize > len(nalUnit) {
-			payloadSize = len(nalUnit) - offset
-		}
-
-		rtpPacket := make([]byte, rtpHeaderSize+2+payloadSize)
-
-		// RTP header
-		rtpPacket[0] = 0x80
-		rtpPacket[1] = 0x60
-		rtpPacket[2] = byte(m.rtpSequenceNumber >> 8)
-		rtpPacket[3] = byte(m.rtpSequenceNumber)
-		rtpPacket[4] = byte(m.rtpTimestamp >> 24)
-		rtpPacket[5] = byte(m.rtpTimestamp >> 16)
-		rtpPacket[6] = byte(m.rtpTimestamp >> 8)
-		rtpPacket[7] = byte(m.rtpTimestamp)
-		rtpPacket[8] = byte(m.rtpSSRC >> 24)
-		rtpPacket[9] = byte(m.rtpSSRC >> 16)
-		rtpPacket[10] = byte(m.rtpSSRC >> 8)
-		rtpPacket[11] = byte(m.rtpSSRC)
-
-		// FU-A header
-		if offset == 1 {
-			rtpPacket[12] = nalHeader | 0x80 // Start bit
-		} else if offset+payloadSize >= len(nalUnit) {
-			rtpPacket[12] = nalHeader | 0x40 // End bit
-		} else {
-			rtpPacket[12] = nalHeader
-		}
-		rtpPacket[13] = nalType
-
-		// Copy payload
-		copy(rtpPacket[rtpHeaderSize+2:], nalUnit[offset:offset+payloadSize])
-
-		packets = append(packets, rtpPacket)
-		offset += payloadSize
-		m.rtpSequenceNumber++
-	}
-
-	return packets
-}
-
 // addH264StartCode adds H.264 start code to raw NAL unit data
 func (m *Manager) addH264StartCode(data []byte) []byte {
 	if len(data) == 0 {
@@ -566,88 +1121,43 @@ func (m *Manager) addH264StartCode(data []byte) []byte {
 	return append(startCode, data...)
 }
 
-// createRTPPacket creates a simple RTP packet for H.264
-func (m *Manager) createRTPPacket(nalUnit []byte, timestamp uint32) []byte {
-	if len(nalUnit) == 0 {
-		return nil
-	}
-
-	// RTP header size
-	const rtpHeaderSize = 12
-
-	// Update RTP timestamp
-	if timestamp > 0 {
-		m.rtpTimestamp = timestamp * 90 // Convert ms to 90kHz clock
-	} else {
-		m.rtpTimestamp += 3000 // ~33ms at 90kHz
+// CaptureSnapshot captures the latest picture of a stream, "" meaning the
+// active one, as JPEG. The cached GOP is decoded up to its last picture, so
+// no frame has to be waited for; before the first keyframe has been cached,
+// it waits for one, at most 5 seconds. ctx bounds the whole capture.
+// Concurrent captures are independent of each other.
+func (m *Manager) CaptureSnapshot(ctx context.Context, stream string) (string, error) {
+	stream = m.streamName(stream)
+	frameData, pictures, waiter := m.snapshotSource(stream)
+	if waiter != nil {
+		select {
+		case frameData = <-waiter:
+			pictures = 1
+		case <-time.After(5 * time.Second):
+			m.cancelSnapshot(stream, waiter)
+			return "", fmt.Errorf("timeout waiting for a keyframe: %w", context.DeadlineExceeded)
+		case <-ctx.Done():
+			m.cancelSnapshot(stream, waiter)
+			return "", ctx.Err()
+		}
 	}
 
-	// Increment sequence number
-	m.rtpSequenceNumber++
+	logrus.Infof("Captured %d pictures for snapshot: %d bytes", pictures, len(frameData))
 
-	rtpPacket := make([]byte, rtpHeaderSize+len(nalUnit))
-
-	// RTP header
-	rtpPacket[0] = 0x80 // Version 2, no padding, no extension, no CSRC
-	rtpPacket[1] = 0x60 // Payload type 96 (H.264)
-	rtpPacket[2] = byte(m.rtpSequenceNumber >> 8)
-	rtpPacket[3] = byte(m.rtpSequenceNumber)
-	rtpPacket[4] = byte(m.rtpTimestamp >> 24)
-	rtpPacket[5] = byte(m.rtpTimestamp >> 16)
-	rtpPacket[6] = byte(m.rtpTimestamp >> 8)
-	rtpPacket[7] = byte(m.rtpTimestamp)
-	rtpPacket[8] = byte(m.rtpSSRC >> 24)
-	rtpPacket[9] = byte(m.rtpSSRC >> 16)
-	rtpPacket[10] = byte(m.rtpSSRC >> 8)
-	rtpPacket[11] = byte(m.rtpSSRC)
-
-	// Copy NAL unit
-	copy(rtpPacket[rtpHeaderSize:], nalUnit)
-
-	return rtpPacket
-}
-
-// RequestSnapshot triggers a snapshot capture from the next available video frame
-func (m *Manager) RequestSnapshot() {
-	select {
-	case m.snapshotRequest <- true:
-		logrus.Info("Snapshot request sent")
-	default:
-		logrus.Warn("Snapshot request channel full")
+	// Convert the last picture to JPEG
+	jpegData, err := m.convertH264ToJPEG(ctx, frameData, pictures)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert H.264 to JPEG: %w", err)
 	}
-}
 
-// CaptureSnapshot captures a frame from the live stream and converts it to JPEG
-func (m *Manager) CaptureSnapshot() (string, error) {
-	// Request a snapshot from the live stream
-	m.RequestSnapshot()
-
-	// Wait for the next frame to be captured (with timeout)
-	select {
-	case frameData := <-m.snapshotData:
-		if len(frameData) == 0 {
-			return "", fmt.Errorf("empty frame received")
-		}
-
-		logrus.Infof("Captured frame for snapshot: %d bytes", len(frameData))
-
-		// Convert H.264 frame to JPEG
-		jpegData, err := m.convertH264ToJPEG(frameData)
-		if err != nil {
-			return "", fmt.Errorf("failed to convert H.264 to JPEG: %w", err)
-		}
-
-		// Encode to base64
-		base64Data := base64.StdEncoding.EncodeToString(jpegData)
-		return "data:image/jpeg;base64," + base64Data, nil
-
-	case <-time.After(5 * time.Second):
-		return "", fmt.Errorf("timeout waiting for video frame")
-	}
+	// Encode to base64
+	base64Data := base64.StdEncoding.EncodeToString(jpegData)
+	return "data:image/jpeg;base64," + base64Data, nil
 }
 
-// convertH264ToJPEG converts H.264 frame to JPEG using FFmpeg
-func (m *Manager) convertH264ToJPEG(h264Data []byte) ([]byte, error) {
+// convertH264ToJPEG decodes a raw H.264 stream of the given number of
+// pictures using FFmpeg and encodes its last picture as JPEG
+func (m *Manager) convertH264ToJPEG(ctx context.Context, h264Data []byte, pictures int) ([]byte, error) {
 	// Check if FFmpeg is available
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
 		logrus.Warnf("FFmpeg not found, using placeholder image: %v", err)
@@ -677,8 +1187,9 @@ func (m *Manager) convertH264ToJPEG(h264Data []byte) ([]byte, error) {
 	outputFile.Close()
 
 	// Run FFmpeg to convert H.264 to JPEG
-	cmd := exec.Command("ffmpeg",
+	cmd := ffmpeg.CommandContext(ctx,
 		"-i", inputFile.Name(),
+		"-vf", fmt.Sprintf("select=gte(n\\,%d)", pictures-1),
 		"-vframes", "1",
 		"-f", "image2",
 		"-y", // Overwrite output file
@@ -688,7 +1199,10 @@ func (m *Manager) convertH264ToJPEG(h264Data []byte) ([]byte, error) {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := ffmpeg.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		logrus.Errorf("FFmpeg conversion failed: %v, stderr: %s", err, stderr.String())
 		// Fallback to placeholder if FFmpeg fails
 		return m.createPlaceholderJPEG()
@@ -0,0 +1,201 @@
+package webrtc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// annexB joins NAL units into one access unit with start codes.
+func annexB(nalUnits ...[]byte) []byte {
+	var data []byte
+	for _, nalUnit := range nalUnits {
+		data = append(append(data, annexBStartCode...), nalUnit...)
+	}
+	return data
+}
+
+// loopbackPeer connects a receive-only client to a peer connection set up
+// like those of viewers, and returns the server side once it is connected
+// along with the NAL unit types the client receives.
+func loopbackPeer(t *testing.T, m *Manager) (*mediaConnection, <-chan byte) {
+	t.Helper()
+	// Host candidates only, so gathering does not wait on STUN and TURN
+	m.SetICEServers(ICEServerConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m.peersLock.RLock()
+	server, err := m.newMediaConnection(NewPeerID("test"), false)
+	m.peersLock.RUnlock()
+	if err != nil {
+		t.Fatalf("newMediaConnection() error = %v", err)
+	}
+	t.Cleanup(func() { server.pc.Close() })
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("NewPeerConnection() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+		t.Fatalf("AddTransceiverFromKind() error = %v", err)
+	}
+
+	types := make(chan byte, 64)
+	client.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		var depacketizer codecs.H264Packet
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			data, err := depacketizer.Unmarshal(packet.Payload)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			nalUnits, _ := m.parseH264NALUnits(data)
+			for _, nalUnit := range nalUnits {
+				if len(nalUnit) > 0 {
+					select {
+					case types <- nalUnit[0] & 0x1F:
+					default:
+					}
+				}
+			}
+		}
+	})
+	connected := make(chan struct{})
+	server.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			close(connected)
+		}
+	})
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("CreateOffer() error = %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(client)
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatalf("SetLocalDescription() error = %v", err)
+	}
+	<-gathered
+	answer, err := m.answerOffer(ctx, logrus.WithField("peer", "test"), server.pc, *client.LocalDescription(), 0, true)
+	if err != nil {
+		t.Fatalf("answerOffer() error = %v", err)
+	}
+	if err := client.SetRemoteDescription(*answer); err != nil {
+		t.Fatalf("SetRemoteDescription() error = %v", err)
+	}
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		t.Fatal("loopback peer did not connect")
+	}
+	return server, types
+}
+
+func TestReplayGOPSendsKeyframeFirst(t *testing.T) {
+	m := NewManager()
+	// The GOP started before the viewer joined
+	m.writeVideoSample("cam", annexB(selfTestGOP[:3]...), 1)
+	for i, nalUnit := range selfTestGOP[3:] {
+		m.writeVideoSample("cam", annexB(nalUnit), uint32(i+2))
+	}
+
+	server, types := loopbackPeer(t, m)
+	peer := &Peer{
+		ID:          "late",
+		Connection:  server.pc,
+		VideoTrack:  server.video,
+		IsConnected: true,
+		Stream:      "cam",
+		Pinned:      true,
+		log:         logrus.WithField("peer", "late"),
+	}
+	m.replayGOP(peer)
+
+	peer.mu.RLock()
+	primed := peer.primed
+	peer.mu.RUnlock()
+	if !primed {
+		t.Fatal("peer is not receiving live video after the replay")
+	}
+
+	want := []byte{7, 8, 5, 1, 1, 1}
+	for i, wantType := range want {
+		select {
+		case got := <-types:
+			if got != wantType {
+				t.Fatalf("NAL unit %d has type %d, want %d", i, got, wantType)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d NAL units, want %d", i, len(want))
+		}
+	}
+}
+
+func TestReplayGOPWithoutCacheRequestsKeyframe(t *testing.T) {
+	m := NewManager()
+	requested := make(chan string, 1)
+	m.OnKeyframeNeeded(func(stream string) { requested <- stream })
+
+	server, _ := loopbackPeer(t, m)
+	peer := &Peer{ID: "early", Connection: server.pc, VideoTrack: server.video, Stream: "cam", Pinned: true, log: logrus.WithField("peer", "early")}
+	m.replayGOP(peer)
+
+	select {
+	case stream := <-requested:
+		if stream != "cam" {
+			t.Errorf("keyframe requested of %q, want cam", stream)
+		}
+	case <-time.After(time.Second):
+		t.Error("no keyframe requested without a cached GOP")
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	if !peer.primed {
+		t.Error("peer is not receiving live video")
+	}
+}
+
+func TestAnswerOfferDoesNotLogSDP(t *testing.T) {
+	m := NewManager()
+	m.SetICEServers(ICEServerConfig{})
+	m.peersLock.RLock()
+	server, err := m.newMediaConnection(NewPeerID("test"), false)
+	m.peersLock.RUnlock()
+	if err != nil {
+		t.Fatalf("newMediaConnection() error = %v", err)
+	}
+	defer server.pc.Close()
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("NewPeerConnection() error = %v", err)
+	}
+	defer client.Close()
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+		t.Fatalf("AddTransceiverFromKind() error = %v", err)
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("CreateOffer() error = %v", err)
+	}
+
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	if _, err := m.answerOffer(context.Background(), logrus.NewEntry(logger), server.pc, offer, 0, false); err != nil {
+		t.Fatalf("answerOffer() error = %v", err)
+	}
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "ice-pwd") || strings.Contains(entry.Message, "ice-ufrag") {
+			t.Errorf("logged ICE credentials: %q", entry.Message)
+		}
+	}
+}
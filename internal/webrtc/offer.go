@@ -0,0 +1,95 @@
+package webrtc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// MaxOfferSDPBytes bounds the SDP of an offer; browser offers are a few KB
+const MaxOfferSDPBytes = 32 * 1024
+
+// Offer validation error codes returned to clients.
+const (
+	OfferNotAnOffer        = "not_an_offer"
+	OfferTooLarge          = "sdp_too_large"
+	OfferInvalidSDP        = "invalid_sdp"
+	OfferNoMedia           = "no_media_sections"
+	OfferNoVideo           = "no_video_section"
+	OfferNoCompatibleCodec = "no_compatible_video_codec"
+	OfferNoICECredentials  = "missing_ice_credentials"
+)
+
+// OfferError explains why an offer cannot be negotiated.
+type OfferError struct {
+	Code    string
+	Message string
+}
+
+func (e *OfferError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ValidateOffer checks that an offer can be answered before pion processes
+// it: it must be a parseable SDP offer of bounded size that can receive
+// H.264 video and carries ICE credentials.
+func ValidateOffer(offer SessionDescription) error {
+	if offer.Type != webrtc.SDPTypeOffer {
+		return &OfferError{OfferNotAnOffer, fmt.Sprintf("expected an SDP offer, got %q", offer.Type.String())}
+	}
+	if len(offer.SDP) > MaxOfferSDPBytes {
+		return &OfferError{OfferTooLarge, fmt.Sprintf("SDP is %d bytes, the limit is %d", len(offer.SDP), MaxOfferSDPBytes)}
+	}
+
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		return &OfferError{OfferInvalidSDP, err.Error()}
+	}
+	if len(parsed.MediaDescriptions) == 0 {
+		return &OfferError{OfferNoMedia, "the offer has no media sections"}
+	}
+
+	_, sessionUfrag := parsed.Attribute("ice-ufrag")
+	hasVideo, hasH264 := false, false
+	for _, media := range parsed.MediaDescriptions {
+		if !sessionUfrag {
+			if _, ok := media.Attribute("ice-ufrag"); !ok {
+				return &OfferError{OfferNoICECredentials, fmt.Sprintf("%s section has no ice-ufrag", media.MediaName.Media)}
+			}
+		}
+		// Port 0 marks a rejected section
+		if media.MediaName.Media != "video" || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		hasVideo = true
+		if direction := mediaDirection(media.Attributes); direction == "sendonly" || direction == "inactive" {
+			continue
+		}
+		for _, attr := range media.Attributes {
+			if attr.Key == "rtpmap" && strings.Contains(strings.ToUpper(attr.Value), " H264/90000") {
+				hasH264 = true
+			}
+		}
+	}
+
+	if !hasVideo {
+		return &OfferError{OfferNoVideo, "the offer has no video section; add a recvonly video transceiver"}
+	}
+	if !hasH264 {
+		return &OfferError{OfferNoCompatibleCodec, "no receiving video section offers H.264, the only codec this server sends"}
+	}
+	return nil
+}
+
+// mediaDirection returns the direction attribute of a media section, if any.
+func mediaDirection(attributes []sdp.Attribute) string {
+	for _, attr := range attributes {
+		switch attr.Key {
+		case "sendrecv", "sendonly", "recvonly", "inactive":
+			return attr.Key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package webrtc
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrPeerExists is returned when creating a peer whose ID is already taken,
+// by a connected peer or by a session that may still resume.
+var ErrPeerExists = errors.New("peer ID already in use")
+
+// NewPeerID returns a random ID for a peer of the given kind, like
+// "peer_3f2b…", unique among all peers the server ever creates.
+func NewPeerID(kind string) string {
+	return kind + "_" + uuid.NewString()
+}
+
+// peerIDTakenLocked reports whether a connected or detached peer has the
+// ID. Callers must hold peersLock.
+func (m *Manager) peerIDTakenLocked(peerID string) bool {
+	if _, ok := m.peers[peerID]; ok {
+		return true
+	}
+	for _, d := range m.detached {
+		if d.peer.ID == peerID {
+			return true
+		}
+	}
+	return false
+}
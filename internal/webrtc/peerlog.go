@@ -0,0 +1,140 @@
+package webrtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// peerLogLines is how many recent log lines are kept per peer
+	peerLogLines = 200
+	// closedPeerLogs is how many removed peers keep their log lines, so a
+	// session can still be investigated after it ended
+	closedPeerLogs = 100
+)
+
+// LogLine is a log entry of one peer.
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// logRing keeps the latest lines of a peer.
+type logRing struct {
+	lines []LogLine
+	next  int
+	mu    sync.Mutex
+}
+
+func (r *logRing) add(line LogLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) < peerLogLines {
+		r.lines = append(r.lines, line)
+		return
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % peerLogLines
+}
+
+// snapshot returns the lines oldest first.
+func (r *logRing) snapshot() []LogLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]LogLine, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
+
+// peerLogs routes every log entry carrying a "peer" field to that peer's
+// ring. It is a single hook on the standard logger shared by all managers,
+// so entries below the logger's level are not kept either.
+var peerLogs = struct {
+	rings  map[string]*logRing
+	closed []string
+	once   sync.Once
+	mu     sync.RWMutex
+}{rings: make(map[string]*logRing)}
+
+type peerLogHook struct{}
+
+func (peerLogHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (peerLogHook) Fire(entry *logrus.Entry) error {
+	peerID, ok := entry.Data["peer"].(string)
+	if !ok {
+		return nil
+	}
+	peerLogs.mu.RLock()
+	ring := peerLogs.rings[peerID]
+	peerLogs.mu.RUnlock()
+	if ring != nil {
+		ring.add(LogLine{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message})
+	}
+	return nil
+}
+
+// newPeerLog returns the logger of a peer session, whose lines are also kept
+// for PeerLog.
+func newPeerLog(peerID, stream, remoteIP string) *logrus.Entry {
+	peerLogs.once.Do(func() { logrus.AddHook(peerLogHook{}) })
+
+	// A resumed peer keeps the lines of its earlier connection
+	peerLogs.mu.Lock()
+	if _, ok := peerLogs.rings[peerID]; !ok {
+		peerLogs.rings[peerID] = &logRing{}
+	}
+	peerLogs.mu.Unlock()
+
+	fields := logrus.Fields{"peer": peerID}
+	if stream != "" {
+		fields["stream"] = stream
+	}
+	if remoteIP != "" {
+		fields["remote_ip"] = remoteIP
+	}
+	return logrus.WithFields(fields)
+}
+
+// closePeerLog keeps the lines of a removed peer until closedPeerLogs newer
+// sessions have ended.
+func closePeerLog(peerID string) {
+	peerLogs.mu.Lock()
+	defer peerLogs.mu.Unlock()
+	peerLogs.closed = append(peerLogs.closed, peerID)
+	if len(peerLogs.closed) > closedPeerLogs {
+		delete(peerLogs.rings, peerLogs.closed[0])
+		peerLogs.closed = peerLogs.closed[1:]
+	}
+}
+
+// PeerLog returns the recent log lines of a peer, oldest first. Lines of
+// recently removed peers are still available.
+func (m *Manager) PeerLog(peerID string) ([]LogLine, bool) {
+	peerLogs.mu.RLock()
+	ring := peerLogs.rings[peerID]
+	peerLogs.mu.RUnlock()
+	if ring == nil {
+		return nil, false
+	}
+	return ring.snapshot(), true
+}
+
+// PeerDescriptions returns the current local and remote SDP of a peer, each
+// empty until it is set.
+func (m *Manager) PeerDescriptions(peerID string) (local, remote string, ok bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return "", "", false
+	}
+	if desc := peer.Connection.LocalDescription(); desc != nil {
+		local = desc.SDP
+	}
+	if desc := peer.Connection.RemoteDescription(); desc != nil {
+		remote = desc.SDP
+	}
+	return local, remote, true
+}
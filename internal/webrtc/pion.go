@@ -0,0 +1,26 @@
+package webrtc
+
+import "github.com/pion/webrtc/v4"
+
+// The Manager's API is given in the types below rather than pion's, so the
+// rest of the server never imports pion. They alias pion's types for now;
+// moving to another pion major version only changes this package.
+
+// SessionDescription is an SDP offer or answer, in the JSON form of the
+// browser's RTCSessionDescriptionInit.
+type SessionDescription = webrtc.SessionDescription
+
+// ICECandidateInit is a trickled ICE candidate, in the JSON form of the
+// browser's RTCIceCandidateInit.
+type ICECandidateInit = webrtc.ICECandidateInit
+
+// Certificate is the DTLS certificate peers are offered.
+type Certificate = webrtc.Certificate
+
+// RTPCodecParameters is a codec negotiated with viewers.
+type RTPCodecParameters = webrtc.RTPCodecParameters
+
+// NewOffer returns an offer of raw SDP, as sent by WHEP players.
+func NewOffer(sdp string) SessionDescription {
+	return SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}
+}
@@ -0,0 +1,125 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// QualityReport is the playback quality a client measured, sent periodically
+// as a "quality_report" data channel message.
+type QualityReport struct {
+	// Frames decoded per second since the previous report
+	DecodedFPS float64 `json:"decoded_fps"`
+	// Video freezes since the stream started
+	FreezeCount int `json:"freeze_count"`
+	// Average time frames spent in the jitter buffer since the previous report
+	JitterBufferDelayMS float64 `json:"jitter_buffer_delay_ms"`
+}
+
+// QualityThresholds decide when a peer's playback counts as degraded. Zero
+// values disable the corresponding check.
+type QualityThresholds struct {
+	MinFPS                 float64
+	MaxJitterBufferDelayMS float64
+}
+
+// PeerQuality is the latest quality report of a peer and its evaluation.
+type PeerQuality struct {
+	QualityReport
+	// Freezes reported since the previous report
+	NewFreezes int       `json:"new_freezes"`
+	Degraded   bool      `json:"degraded"`
+	Reasons    []string  `json:"reasons,omitempty"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// SetQualityThresholds configures when quality reports raise alerts.
+func (m *Manager) SetQualityThresholds(thresholds QualityThresholds) {
+	m.peersLock.Lock()
+	m.qualityThresholds = thresholds
+	m.peersLock.Unlock()
+}
+
+// PeerQuality returns the latest quality report of a peer, if it sent any.
+func (m *Manager) PeerQuality(peerID string) (PeerQuality, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return PeerQuality{}, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	if peer.quality == nil {
+		return PeerQuality{}, false
+	}
+	return *peer.quality, true
+}
+
+func (m *Manager) handleQualityReport(peer *Peer, payload json.RawMessage) error {
+	var report QualityReport
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return fmt.Errorf("invalid quality_report message: %w", err)
+	}
+	if !validQualityValue(report.DecodedFPS) || !validQualityValue(report.JitterBufferDelayMS) || report.FreezeCount < 0 {
+		return fmt.Errorf("quality_report values must be non-negative numbers")
+	}
+
+	m.peersLock.RLock()
+	thresholds := m.qualityThresholds
+	bus := m.events
+	m.peersLock.RUnlock()
+
+	quality := PeerQuality{QualityReport: report, ReportedAt: time.Now()}
+	peer.mu.Lock()
+	previous := peer.quality
+	if previous != nil && report.FreezeCount > previous.FreezeCount {
+		quality.NewFreezes = report.FreezeCount - previous.FreezeCount
+	}
+	quality.Reasons = thresholds.evaluate(quality)
+	quality.Degraded = len(quality.Reasons) > 0
+	peer.quality = &quality
+	peer.mu.Unlock()
+
+	wasDegraded := previous != nil && previous.Degraded
+	switch {
+	case quality.Degraded && !wasDegraded:
+		peer.log.Warnf("Playback degraded: %s", strings.Join(quality.Reasons, ", "))
+		bus.Publish(events.Event{Type: events.PeerQualityDegraded, Peer: peer.ID, Data: quality.eventData()})
+	case !quality.Degraded && wasDegraded:
+		peer.log.Info("Playback recovered")
+		bus.Publish(events.Event{Type: events.PeerQualityRecovered, Peer: peer.ID, Data: quality.eventData()})
+	}
+	return nil
+}
+
+// evaluate lists the ways a report falls short of the thresholds.
+func (t QualityThresholds) evaluate(q PeerQuality) []string {
+	var reasons []string
+	if t.MinFPS > 0 && q.DecodedFPS < t.MinFPS {
+		reasons = append(reasons, fmt.Sprintf("decoding %.1f fps", q.DecodedFPS))
+	}
+	if t.MaxJitterBufferDelayMS > 0 && q.JitterBufferDelayMS > t.MaxJitterBufferDelayMS {
+		reasons = append(reasons, fmt.Sprintf("jitter buffer delay %.0f ms", q.JitterBufferDelayMS))
+	}
+	if q.NewFreezes > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d new freezes", q.NewFreezes))
+	}
+	return reasons
+}
+
+func (q PeerQuality) eventData() map[string]interface{} {
+	return map[string]interface{}{
+		"decoded_fps":            q.DecodedFPS,
+		"freeze_count":           q.FreezeCount,
+		"jitter_buffer_delay_ms": q.JitterBufferDelayMS,
+		"reasons":                q.Reasons,
+	}
+}
+
+func validQualityValue(v float64) bool {
+	return v >= 0 && !math.IsInf(v, 0) && !math.IsNaN(v)
+}
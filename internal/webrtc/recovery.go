@@ -0,0 +1,200 @@
+package webrtc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// iceRestartCooldown is the minimum time between recovery attempts for a
+// peer, and how long it must stay healthy before its attempts are reset
+const iceRestartCooldown = 20 * time.Second
+
+// RecoveryConfig controls when degraded peers are asked to restart ICE.
+type RecoveryConfig struct {
+	Interval time.Duration
+	// A peer is degraded when its reported loss stays at or above
+	// LossThreshold for LossDuration, or ICE is disconnected for DisconnectedGrace
+	LossThreshold     float64
+	LossDuration      time.Duration
+	DisconnectedGrace time.Duration
+	// After MaxAttempts restarts without recovery the client is asked to reconnect
+	MaxAttempts int
+}
+
+// RecoveryMessage asks a client to restart ICE ("ice_restart") or to
+// renegotiate from scratch ("reconnect").
+type RecoveryMessage struct {
+	Type   string `json:"type"`
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason"`
+}
+
+// recoveryState tracks a peer's degradation, guarded by Peer.mu.
+type recoveryState struct {
+	iceState      webrtc.ICEConnectionState
+	iceStateSince time.Time
+	lossySince    time.Time
+	restarting    bool
+	attempts      int
+	lastAttemptAt time.Time
+	prompted      bool
+}
+
+// RunRecovery checks peers every interval until ctx is cancelled and asks
+// degraded ones over the data channel to restart ICE, then to reconnect.
+//
+// The restart itself is offered by the client through RestartICE: pion
+// replaces its ICE credentials as soon as it creates a restart offer, which
+// would cut off the data channel before a server offer could reach the client.
+func (m *Manager) RunRecovery(ctx context.Context, cfg RecoveryConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkRecovery(cfg, now)
+		}
+	}
+}
+
+func (m *Manager) checkRecovery(cfg RecoveryConfig, now time.Time) {
+	for _, peer := range m.GetAllPeers() {
+		peer.mu.Lock()
+		reason := peer.degradation(cfg, now)
+		rs := &peer.recovery
+		// A prompt left unanswered for a whole cooldown counts as a failed attempt
+		if rs.restarting && now.Sub(rs.lastAttemptAt) >= iceRestartCooldown {
+			rs.restarting = false
+		}
+		var message string
+		switch {
+		case reason == "":
+			// Healthy long enough after an attempt: start counting afresh
+			healthy := rs.lossySince.IsZero() && (rs.iceState == webrtc.ICEConnectionStateConnected || rs.iceState == webrtc.ICEConnectionStateCompleted)
+			if healthy && rs.attempts > 0 && !rs.restarting && now.Sub(rs.lastAttemptAt) > iceRestartCooldown {
+				rs.attempts, rs.prompted = 0, false
+			}
+		case rs.restarting || now.Sub(rs.lastAttemptAt) < iceRestartCooldown:
+		case rs.attempts < cfg.MaxAttempts:
+			rs.attempts++
+			rs.lastAttemptAt = now
+			rs.restarting = true
+			message = "ice_restart"
+		case !rs.prompted:
+			rs.prompted = true
+			rs.lastAttemptAt = now
+			message = "reconnect"
+		}
+		peer.mu.Unlock()
+
+		if message == "" {
+			continue
+		}
+		if message == "ice_restart" {
+			peer.log.Infof("🔁 Asking peer to restart ICE: %s", reason)
+			m.eventBus().Publish(events.Event{Type: events.PeerICERestart, Peer: peer.ID, Data: map[string]interface{}{"reason": reason}})
+		} else {
+			peer.log.Warnf("Still degraded after %d ICE restarts (%s), asking peer to reconnect", cfg.MaxAttempts, reason)
+		}
+		// A disconnected transport delivers the prompt once it recovers, if ever
+		if err := peer.SendJSON(RecoveryMessage{Type: message, PeerID: peer.ID, Reason: reason}); err != nil {
+			peer.log.Debugf("Could not send %s: %v", message, err)
+		}
+	}
+}
+
+// degradation returns why a peer is degraded, or "" if it is healthy.
+// Callers must hold p.mu.
+func (p *Peer) degradation(cfg RecoveryConfig, now time.Time) string {
+	rs := &p.recovery
+	if rs.iceState == webrtc.ICEConnectionStateDisconnected && now.Sub(rs.iceStateSince) >= cfg.DisconnectedGrace {
+		return fmt.Sprintf("ICE disconnected for %s", now.Sub(rs.iceStateSince).Round(time.Second))
+	}
+
+	lossy := cfg.LossThreshold > 0 && now.Sub(p.lastReportAt) < lossReportMaxAge && p.fractionLost >= cfg.LossThreshold
+	if !lossy {
+		rs.lossySince = time.Time{}
+		return ""
+	}
+	if rs.lossySince.IsZero() {
+		rs.lossySince = now
+	}
+	if now.Sub(rs.lossySince) >= cfg.LossDuration {
+		return fmt.Sprintf("%.0f%% packet loss", p.fractionLost*100)
+	}
+	return ""
+}
+
+// setICEState records an ICE connection state change for recovery checks.
+func (p *Peer) setICEState(state webrtc.ICEConnectionState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recovery.iceState = state
+	p.recovery.iceStateSince = time.Now()
+}
+
+// RestartICE renegotiates an existing peer with an offer carrying new ICE
+// credentials and returns the complete answer, gathered until ctx is done.
+func (m *Manager) RestartICE(ctx context.Context, peerID string, offer SessionDescription) (*SessionDescription, error) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return nil, fmt.Errorf("peer not found: %s", peerID)
+	}
+	if offer.Type != webrtc.SDPTypeOffer {
+		return nil, fmt.Errorf("expected an offer, got %s", offer.Type)
+	}
+	if state := peer.Connection.SignalingState(); state != webrtc.SignalingStateStable {
+		return nil, fmt.Errorf("peer %s is already negotiating (%s)", peerID, state)
+	}
+
+	// The answer carries the new candidates, even for peers that trickled
+	// the first ones
+	answer, err := m.handleOffer(ctx, peer, offer, true)
+
+	peer.mu.Lock()
+	peer.recovery.restarting = false
+	peer.mu.Unlock()
+	return answer, err
+}
+
+// RestartICECredentials restarts ICE of a peer whose client only sent its
+// new credentials, as WHEP clients do, by renegotiating the peer's last
+// offer with them. It returns the complete answer.
+func (m *Manager) RestartICECredentials(ctx context.Context, peerID, ufrag, pwd string) (*SessionDescription, error) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return nil, fmt.Errorf("peer not found: %s", peerID)
+	}
+	remote := peer.Connection.RemoteDescription()
+	if remote == nil {
+		return nil, fmt.Errorf("peer %s has not negotiated yet", peerID)
+	}
+
+	// The candidates of the previous ICE session no longer apply
+	lines := strings.Split(strings.ReplaceAll(remote.SDP, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "a=candidate:"), line == "a=end-of-candidates":
+			continue
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			line = "a=ice-ufrag:" + ufrag
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + pwd
+		}
+		kept = append(kept, line)
+	}
+	return m.RestartICE(ctx, peerID, SessionDescription{Type: webrtc.SDPTypeOffer, SDP: strings.Join(kept, "\r\n")})
+}
@@ -0,0 +1,186 @@
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// ErrResumeExpired is returned when a resume token no longer has a session.
+var ErrResumeExpired = errors.New("session can no longer be resumed")
+
+// detachedPeer is a peer that lost its connection, kept until its resume
+// grace period ends.
+type detachedPeer struct {
+	peer       *Peer
+	detachedAt time.Time
+	timer      *time.Timer
+}
+
+// DetachedSession describes what a resume token gives back: the identity,
+// authorization, and settings of the peer it was issued to.
+type DetachedSession struct {
+	PeerID         string
+	Stream         string
+	Pinned         bool
+	RelayOnly      bool
+	Tags           map[string]string
+	MaxBitrateKbps int
+	LiveEdge       bool
+	AudioTrack     string
+}
+
+// SetResumeGrace keeps the state of peers that lose their connection for
+// grace, so a client reconnecting with the peer's resume token re-attaches
+// to it instead of starting over; 0 removes them right away.
+func (m *Manager) SetResumeGrace(grace time.Duration) {
+	m.peersLock.Lock()
+	m.resumeGrace = grace
+	m.peersLock.Unlock()
+}
+
+// ResumeToken returns the token a client presents to resume the peer after
+// losing its connection; empty when peers cannot be resumed.
+func (p *Peer) ResumeToken() string {
+	return p.resumeToken
+}
+
+// DetachedSession returns the session a resume token belongs to while it
+// can be resumed.
+func (m *Manager) DetachedSession(token string) (DetachedSession, bool) {
+	m.peersLock.RLock()
+	d, ok := m.detached[token]
+	m.peersLock.RUnlock()
+	if !ok {
+		return DetachedSession{}, false
+	}
+
+	peer := d.peer
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	session := DetachedSession{
+		PeerID:     peer.ID,
+		Stream:     peer.Stream,
+		Pinned:     peer.Pinned,
+		RelayOnly:  peer.RelayOnly,
+		Tags:       peer.Tags,
+		LiveEdge:   peer.sendQueue != nil,
+		AudioTrack: peer.audioTrackID,
+	}
+	if peer.limiter != nil {
+		session.MaxBitrateKbps = peer.limiter.maxBitrateKbps
+	}
+	return session, true
+}
+
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// claimDetachedLocked takes the detached peer of a resume token, so its
+// state carries over to the new peer. Callers hold peersLock.
+func (m *Manager) claimDetachedLocked(token string) (*detachedPeer, error) {
+	d, ok := m.detached[token]
+	if !ok {
+		return nil, ErrResumeExpired
+	}
+	d.timer.Stop()
+	delete(m.detached, token)
+	return d, nil
+}
+
+// resumeFrom carries the selections and statistics of a detached peer over
+// to the peer resuming it.
+func (p *Peer) resumeFrom(old *Peer) {
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	p.audioTrackID = old.audioTrackID
+	p.quality = old.quality
+	// Resuming continues the session rather than authorizing a new one
+	p.authorizedAt = old.authorizedAt
+	p.reauthDeadline = old.reauthDeadline
+	// A viewer whose link was lossy stays downgraded
+	p.downgrade.wantLow = old.downgrade.wantLow
+	p.downgrade.downgrades = old.downgrade.downgrades
+	if p.limiter != nil && old.limiter != nil {
+		p.limiter.dropped = old.limiter.dropped
+	}
+}
+
+// detachPeer closes a peer whose connection was lost. With a resume grace
+// period its state is kept that long for the client to resume, and the
+// peer only counts as disconnected once it ends.
+func (m *Manager) detachPeer(peer *Peer) {
+	m.peersLock.Lock()
+	// The peer was removed, or replaced by a resumed session of the same ID
+	if m.peers[peer.ID] != peer {
+		m.peersLock.Unlock()
+		return
+	}
+	grace := m.resumeGrace
+	if grace <= 0 || peer.resumeToken == "" {
+		m.peersLock.Unlock()
+		m.RemovePeer(peer.ID)
+		return
+	}
+	delete(m.peers, peer.ID)
+	m.leaveGroupLocked(peer)
+	token := peer.resumeToken
+	m.detached[token] = &detachedPeer{
+		peer:       peer,
+		detachedAt: time.Now(),
+		timer:      time.AfterFunc(grace, func() { m.expireDetached(token, peer) }),
+	}
+	m.peersLock.Unlock()
+
+	if peer.sendQueue != nil {
+		peer.sendQueue.close()
+	}
+	peer.Connection.Close()
+	peer.log.Infof("Detached peer, resumable for %s", grace)
+	m.notifyPeersChanged()
+}
+
+// expireDetached removes a detached peer that was not resumed in time.
+func (m *Manager) expireDetached(token string, peer *Peer) {
+	m.peersLock.Lock()
+	d, ok := m.detached[token]
+	if !ok || d.peer != peer {
+		m.peersLock.Unlock()
+		return
+	}
+	delete(m.detached, token)
+	bus := m.events
+	m.peersLock.Unlock()
+
+	peer.log.Info("Removed peer, it was not resumed")
+	closePeerLog(peer.ID)
+	m.retireUsage(peer)
+	bus.Publish(events.Event{
+		Type: events.PeerDisconnected,
+		Peer: peer.ID,
+		Data: map[string]interface{}{"bytes_sent": peer.BytesSent()},
+	})
+	m.notifyPeersChanged()
+}
+
+// detachedViewersLocked counts the detached peers of stream, or of all
+// streams if it is empty; their slots are kept for them. Callers hold
+// peersLock.
+func (m *Manager) detachedViewersLocked(stream string) int {
+	count := 0
+	for _, d := range m.detached {
+		if stream == "" || strings.EqualFold(d.peer.Stream, stream) {
+			count++
+		}
+	}
+	return count
+}
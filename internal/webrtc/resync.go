@@ -0,0 +1,51 @@
+package webrtc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ResyncVideo holds live video of a stream back until its next keyframe. It
+// is called before the stream's source restarts, so peers stay connected and
+// keep showing the last picture instead of decoding frames that reference
+// pictures of the previous pipeline. The cached GOP and the rolling buffer
+// are dropped as well, so peers joining and previews rendered in the
+// meantime do not replay them.
+func (m *Manager) ResyncVideo(stream, reason string) {
+	stream = strings.ToLower(stream)
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
+
+	sm := m.mediaLocked(stream)
+	if sm.resyncSince.IsZero() {
+		sm.resyncSince = time.Now()
+		sm.resyncDropped = 0
+	}
+	sm.resetGOP()
+	sm.gopStarted = false
+	sm.rolling = nil
+	sm.rollingBytes = 0
+	// Timestamps restart with the new pipeline
+	m.restartAVSync(stream)
+	logrus.Infof("Holding video of %s until the next keyframe: %s", stream, reason)
+}
+
+// holdForResync reports whether a frame must be dropped while waiting for a
+// keyframe after ResyncVideo, and ends the wait at the keyframe. Callers must
+// hold gopMu.
+func (s *streamMedia) holdForResync(keyframe bool) bool {
+	if s.resyncSince.IsZero() {
+		return false
+	}
+	if !keyframe {
+		s.resyncDropped++
+		return true
+	}
+
+	logrus.Infof("Video resumed at a keyframe after %s, %d frames held back",
+		time.Since(s.resyncSince).Round(time.Millisecond), s.resyncDropped)
+	s.resyncSince = time.Time{}
+	return false
+}
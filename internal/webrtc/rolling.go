@@ -0,0 +1,90 @@
+package webrtc
+
+import (
+	"time"
+)
+
+const (
+	// rollingBufferWindow is how much recent video is kept for previews
+	rollingBufferWindow = 30 * time.Second
+	// maxRollingBufferBytes bounds the rolling buffer for high-bitrate sources
+	maxRollingBufferBytes = 32 * 1024 * 1024
+)
+
+// bufferedGOP is one keyframe-aligned group of NAL units in the rolling buffer.
+type bufferedGOP struct {
+	start  time.Time
+	nals   [][]byte
+	frames int
+	bytes  int
+}
+
+// appendRolling adds NAL units to the rolling buffer, opening a new GOP at
+// each keyframe and dropping GOPs that fell out of the window. Callers must
+// hold gopMu, and nalUnits must already be copies owned by the buffer.
+func (s *streamMedia) appendRolling(nalUnits [][]byte, startsGOP []bool, now time.Time) {
+	for i, nalUnit := range nalUnits {
+		if startsGOP[i] {
+			s.rolling = append(s.rolling, &bufferedGOP{start: now})
+		}
+		if len(s.rolling) == 0 {
+			continue
+		}
+
+		gop := s.rolling[len(s.rolling)-1]
+		gop.nals = append(gop.nals, nalUnit)
+		gop.bytes += len(nalUnit)
+		s.rollingBytes += len(nalUnit)
+		// Count the first slice of each picture
+		if nalType := nalUnit[0] & 0x1F; (nalType == 1 || nalType == 5) && len(nalUnit) > 1 && nalUnit[1]&0x80 != 0 {
+			gop.frames++
+		}
+	}
+
+	// Keep the newest GOP that starts before the window, so the buffer
+	// always covers the full window from a keyframe
+	for len(s.rolling) > 1 &&
+		(!s.rolling[1].start.After(now.Add(-rollingBufferWindow)) || s.rollingBytes > maxRollingBufferBytes) {
+		s.rollingBytes -= s.rolling[0].bytes
+		s.rolling = s.rolling[1:]
+	}
+}
+
+// RecentVideo returns Annex B H.264 covering at least the last d of video
+// of a stream, "" meaning the active one, starting at a keyframe, along with
+// the measured frame rate. It returns nil if nothing has been buffered yet.
+func (m *Manager) RecentVideo(stream string, d time.Duration) ([]byte, float64) {
+	stream = m.streamName(stream)
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
+	sm := m.mediaLocked(stream)
+
+	if len(sm.rolling) == 0 {
+		return nil, 0
+	}
+
+	cutoff := time.Now().Add(-d)
+	first := 0
+	for i, gop := range sm.rolling {
+		if gop.start.After(cutoff) {
+			break
+		}
+		first = i
+	}
+
+	var out []byte
+	frames := 0
+	for _, gop := range sm.rolling[first:] {
+		for _, nalUnit := range gop.nals {
+			out = append(out, 0x00, 0x00, 0x00, 0x01)
+			out = append(out, nalUnit...)
+		}
+		frames += gop.frames
+	}
+
+	fps := 0.0
+	if span := time.Since(sm.rolling[first].start).Seconds(); span > 0 && frames > 1 {
+		fps = float64(frames) / span
+	}
+	return out, fps
+}
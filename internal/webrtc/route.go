@@ -0,0 +1,98 @@
+package webrtc
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// CandidatePair describes the ICE candidate pair a peer's media flows over.
+type CandidatePair struct {
+	LocalType  string `json:"local_type"`
+	RemoteType string `json:"remote_type"`
+	Protocol   string `json:"protocol"`
+	// Relayed is set when either side sends through a TURN server
+	Relayed bool `json:"relayed"`
+}
+
+// watchCandidatePair records the selected candidate pair of a peer whenever
+// ICE picks a new one, including after restarts.
+func (m *Manager) watchCandidatePair(peer *Peer) {
+	peer.Connection.SCTP().Transport().ICETransport().OnSelectedCandidatePairChange(func(selected *webrtc.ICECandidatePair) {
+		if selected == nil || selected.Local == nil || selected.Remote == nil {
+			return
+		}
+		pair := CandidatePair{
+			LocalType:  selected.Local.Typ.String(),
+			RemoteType: selected.Remote.Typ.String(),
+			Protocol:   selected.Local.Protocol.String(),
+			Relayed:    selected.Local.Typ == webrtc.ICECandidateTypeRelay || selected.Remote.Typ == webrtc.ICECandidateTypeRelay,
+		}
+
+		peer.mu.Lock()
+		peer.candidatePair = &pair
+		peer.mu.Unlock()
+
+		if pair.Relayed {
+			peer.log.Infof("Relayed through TURN (%s/%s over %s)", pair.LocalType, pair.RemoteType, pair.Protocol)
+		} else {
+			peer.log.Infof("Connected directly (%s/%s over %s)", pair.LocalType, pair.RemoteType, pair.Protocol)
+		}
+	})
+}
+
+// PeerCandidatePair returns the candidate pair selected for a peer, if any.
+func (m *Manager) PeerCandidatePair(peerID string) (CandidatePair, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return CandidatePair{}, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	if peer.candidatePair == nil {
+		return CandidatePair{}, false
+	}
+	return *peer.candidatePair, true
+}
+
+// RouteCounts returns how many connected peers are relayed through TURN and
+// how many reach the server directly.
+func (m *Manager) RouteCounts() (relayed, direct int) {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if peer.IsConnected && peer.candidatePair != nil {
+			if peer.candidatePair.Relayed {
+				relayed++
+			} else {
+				direct++
+			}
+		}
+		peer.mu.RUnlock()
+	}
+	return relayed, direct
+}
+
+// SetRelayOnlyStreams makes viewers of the given streams connect only
+// through TURN; "*" applies to every stream.
+func (m *Manager) SetRelayOnlyStreams(streams []string) {
+	set := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		if stream = strings.ToLower(strings.TrimSpace(stream)); stream != "" {
+			set[stream] = true
+		}
+	}
+
+	m.peersLock.Lock()
+	m.relayOnlyStreams = set
+	m.peersLock.Unlock()
+}
+
+// RelayRequired reports whether viewers of a stream must use TURN relay.
+func (m *Manager) RelayRequired(stream string) bool {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	return m.relayOnlyStreams["*"] || m.relayOnlyStreams[strings.ToLower(stream)]
+}
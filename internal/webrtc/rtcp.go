@@ -0,0 +1,67 @@
+package webrtc
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+// lossReportMaxAge is how long a receiver report counts toward viewer loss
+const lossReportMaxAge = 30 * time.Second
+
+// readRTCP drains RTCP arriving on a sender, recording the loss viewers
+// report and that they are still there, and answering keyframe requests. Reading is also what lets the NACK
+// and report interceptors run.
+func (m *Manager) readRTCP(peer *Peer, sender *webrtc.RTPSender) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			peer.log.Debugf("RTCP reader stopped: %v", err)
+			return
+		}
+
+		peer.mu.Lock()
+		peer.lastRTCPAt = time.Now()
+		peer.mu.Unlock()
+
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				m.handleKeyframeRequest(peer)
+				continue
+			}
+			rr, ok := packet.(*rtcp.ReceiverReport)
+			if !ok {
+				continue
+			}
+			for _, report := range rr.Reports {
+				peer.mu.Lock()
+				peer.fractionLost = float64(report.FractionLost) / 256
+				peer.lastReportAt = time.Now()
+				peer.mu.Unlock()
+			}
+		}
+	}
+}
+
+// ViewerLoss returns the average fraction of packets lost across connected
+// peers, as reported in their recent RTCP receiver reports.
+func (m *Manager) ViewerLoss() float64 {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+
+	total, count := 0.0, 0
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if peer.IsConnected && time.Since(peer.lastReportAt) < lossReportMaxAge {
+			total += peer.fractionLost
+			count++
+		}
+		peer.mu.RUnlock()
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
@@ -0,0 +1,214 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+// SelfTestConfig sets how the startup self-test runs.
+type SelfTestConfig struct {
+	// Timeout bounds one attempt, from the offer to the keyframe arriving
+	Timeout time.Duration
+	// RetryInterval is the wait before another attempt after a failure
+	RetryInterval time.Duration
+}
+
+// SelfTestResult is the outcome of the latest self-test attempt.
+type SelfTestResult struct {
+	Passed     bool      `json:"passed"`
+	Error      string    `json:"error,omitempty"`
+	Attempts   int       `json:"attempts"`
+	DurationMs int64     `json:"duration_ms"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// selfTestGOP is a synthetic H.264 GOP of SPS, PPS, one IDR slice, and
+// non-IDR slices. The pipeline only packetizes it, so the slices need not
+// decode.
+var selfTestGOP = [][]byte{
+	{0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xec, 0x04, 0x40},
+	{0x68, 0xce, 0x3c, 0x80},
+	append([]byte{0x65, 0x88, 0x84}, bytes.Repeat([]byte{0xaa}, 1400)...),
+	{0x41, 0x9a, 0x02, 0x00},
+	{0x41, 0x9a, 0x04, 0x00},
+	{0x41, 0x9a, 0x06, 0x00},
+}
+
+// RunSelfTest checks that media reaches a viewer before the server admits
+// traffic, retrying until an attempt passes or ctx is cancelled. The latest
+// result is reported by SelfTest.
+func (m *Manager) RunSelfTest(ctx context.Context, cfg SelfTestConfig) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 30 * time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		err := m.selfTest(attemptCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		result := SelfTestResult{
+			Passed:     err == nil,
+			Attempts:   attempt,
+			DurationMs: time.Since(start).Milliseconds(),
+			FinishedAt: time.Now(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		m.peersLock.Lock()
+		m.selfTestResult = &result
+		m.peersLock.Unlock()
+
+		if err == nil {
+			logrus.Infof("✅ Self-test passed in %dms", result.DurationMs)
+			return
+		}
+		logrus.Errorf("Self-test failed, retrying in %s: %v", cfg.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.RetryInterval):
+		}
+	}
+}
+
+// SelfTest returns the result of the latest self-test attempt; false while
+// none has finished.
+func (m *Manager) SelfTest() (SelfTestResult, bool) {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	if m.selfTestResult == nil {
+		return SelfTestResult{}, false
+	}
+	return *m.selfTestResult, true
+}
+
+// selfTest connects a loopback viewer to a peer connection set up like
+// those of real viewers, with the same codecs, ICE settings, and
+// certificate, and pushes the test GOP to it until its keyframe arrives.
+// The peer is not registered, so viewers and the GOP cache are unaffected.
+func (m *Manager) selfTest(ctx context.Context) error {
+	peerID := NewPeerID("selftest")
+	m.peersLock.RLock()
+	server, err := m.newMediaConnection(peerID, false)
+	m.peersLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	// Closing waits for ICE gathering, which must not hold up a timed out
+	// attempt
+	defer func() { go server.pc.Close() }()
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return fmt.Errorf("failed to create loopback peer: %w", err)
+	}
+	defer client.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			return fmt.Errorf("failed to add loopback transceiver: %w", err)
+		}
+	}
+
+	keyframe := make(chan struct{})
+	client.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeVideo {
+			return
+		}
+		go m.readSelfTestVideo(track, keyframe)
+	})
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create loopback offer: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(client)
+	if err := client.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set loopback offer: %w", err)
+	}
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return errors.New("loopback peer did not gather candidates in time")
+	}
+
+	// Gathering is awaited here rather than in answerOffer, to honor ctx
+	serverGathered := webrtc.GatheringCompletePromise(server.pc)
+	if _, err := m.answerOffer(ctx, logrus.WithField("peer", peerID), server.pc, *client.LocalDescription(), 0, false); err != nil {
+		return err
+	}
+	select {
+	case <-serverGathered:
+	case <-ctx.Done():
+		return errors.New("server did not gather candidates in time")
+	}
+	if err := client.SetRemoteDescription(*server.pc.LocalDescription()); err != nil {
+		return fmt.Errorf("failed to set answer on loopback peer: %w", err)
+	}
+
+	// Samples are dropped until the connection is up, so the GOP repeats
+	ticker := time.NewTicker(33 * time.Millisecond)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		select {
+		case <-keyframe:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("no keyframe reached the loopback peer (ICE %s, connection %s)",
+				server.pc.ICEConnectionState(), server.pc.ConnectionState())
+		case <-ticker.C:
+		}
+		// SPS, PPS, and IDR make up the first frame, the rest one each
+		nalUnits := selfTestGOP[:3]
+		if i := frame % (len(selfTestGOP) - 2); i > 0 {
+			nalUnits = selfTestGOP[i+2 : i+3]
+		}
+		for _, nalUnit := range nalUnits {
+			if err := server.video.WriteSample(media.Sample{Data: nalUnit, Duration: 33 * time.Millisecond}); err != nil {
+				return fmt.Errorf("failed to write test sample: %w", err)
+			}
+		}
+	}
+}
+
+// readSelfTestVideo depacketizes the loopback peer's video, closing
+// keyframe once SPS, PPS, and an IDR slice have all arrived.
+func (m *Manager) readSelfTestVideo(track *webrtc.TrackRemote, keyframe chan struct{}) {
+	var depacketizer codecs.H264Packet
+	seen := map[byte]bool{}
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		annexB, err := depacketizer.Unmarshal(packet.Payload)
+		if err != nil || len(annexB) == 0 {
+			continue
+		}
+		nalUnits, _ := m.parseH264NALUnits(annexB)
+		for _, nalUnit := range nalUnits {
+			if len(nalUnit) > 0 {
+				seen[nalUnit[0]&0x1F] = true
+			}
+		}
+		if seen[5] && seen[7] && seen[8] {
+			close(keyframe)
+			return
+		}
+	}
+}
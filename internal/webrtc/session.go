@@ -0,0 +1,146 @@
+package webrtc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// SessionConfig limits how long a viewer session lasts without the client
+// authenticating again, for deployments that must re-check access.
+type SessionConfig struct {
+	Interval time.Duration
+	// MaxDuration is how long a session lasts from its last authorization,
+	// after which the client is asked to re-authenticate
+	MaxDuration time.Duration
+	// ReauthGrace is how long the client has to do so before it is
+	// disconnected; 0 disconnects it right away
+	ReauthGrace time.Duration
+}
+
+// ReauthRequiredMessage asks a client to authenticate again, by sending
+// {"type": "reauth", "token": "..."} before Deadline.
+type ReauthRequiredMessage struct {
+	Type     string    `json:"type"`
+	PeerID   string    `json:"peer_id"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// SessionMessage tells a client its session was renewed ("reauth_ok") or
+// ended ("session_expired").
+type SessionMessage struct {
+	Type      string     `json:"type"`
+	PeerID    string     `json:"peer_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// RunSessionLimits checks peers every interval until ctx is cancelled,
+// asking those whose session reached its maximum length to re-authenticate
+// and disconnecting those that did not in time.
+func (m *Manager) RunSessionLimits(ctx context.Context, cfg SessionConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	m.peersLock.Lock()
+	m.sessionLimit = cfg.MaxDuration
+	m.peersLock.Unlock()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkSessions(cfg, now)
+		}
+	}
+}
+
+func (m *Manager) checkSessions(cfg SessionConfig, now time.Time) {
+	if cfg.MaxDuration <= 0 {
+		return
+	}
+	for _, peer := range m.GetAllPeers() {
+		peer.mu.Lock()
+		ask, expired := false, false
+		switch {
+		case now.Before(peer.authorizedAt.Add(cfg.MaxDuration)):
+		case cfg.ReauthGrace <= 0:
+			expired = true
+		case peer.reauthDeadline.IsZero():
+			peer.reauthDeadline = now.Add(cfg.ReauthGrace)
+			ask = true
+		case !now.Before(peer.reauthDeadline):
+			expired = true
+		}
+		deadline := peer.reauthDeadline
+		peer.mu.Unlock()
+
+		switch {
+		case ask:
+			peer.log.Infof("🔑 Session reached %s, asking peer to re-authenticate within %s", cfg.MaxDuration, cfg.ReauthGrace)
+			m.eventBus().Publish(events.Event{Type: events.PeerReauthRequired, Peer: peer.ID, Stream: peer.Stream})
+			if err := peer.SendJSON(ReauthRequiredMessage{Type: "reauth_required", PeerID: peer.ID, Deadline: deadline}); err != nil {
+				peer.log.Debugf("Could not send reauth_required: %v", err)
+			}
+		case expired:
+			m.EndSession(peer.ID, "not re-authenticated in time")
+		}
+	}
+}
+
+// RenewSession restarts a peer's session after the client authenticated
+// again, returning when it expires next; zero when sessions do not expire.
+func (m *Manager) RenewSession(peerID string) (time.Time, error) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return time.Time{}, fmt.Errorf("peer not found: %s", peerID)
+	}
+	peer.mu.Lock()
+	peer.authorizedAt = time.Now()
+	peer.reauthDeadline = time.Time{}
+	peer.mu.Unlock()
+
+	peer.log.Info("Session renewed")
+	expiresAt, _ := m.SessionExpiresAt(peerID)
+	return expiresAt, nil
+}
+
+// EndSession disconnects a peer whose session ended, telling the client why
+// so it does not simply reconnect. The peer cannot be resumed.
+func (m *Manager) EndSession(peerID, reason string) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return
+	}
+	peer.log.Warnf("Ending session: %s", reason)
+	if err := peer.SendJSON(SessionMessage{Type: "session_expired", PeerID: peerID, Reason: reason}); err != nil {
+		peer.log.Debugf("Could not send session_expired: %v", err)
+	}
+	m.eventBus().Publish(events.Event{Type: events.PeerSessionExpired, Peer: peerID, Stream: peer.Stream, Data: map[string]interface{}{"reason": reason}})
+	m.RemovePeer(peerID)
+}
+
+// SessionExpiresAt returns when a peer must re-authenticate, if sessions
+// are limited.
+func (m *Manager) SessionExpiresAt(peerID string) (time.Time, bool) {
+	m.peersLock.RLock()
+	limit := m.sessionLimit
+	m.peersLock.RUnlock()
+	peer, exists := m.GetPeer(peerID)
+	if !exists || limit <= 0 {
+		return time.Time{}, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	return peer.authorizedAt.Add(limit), true
+}
+
+// RemoteIP returns the client's address when it made the offer.
+func (p *Peer) RemoteIP() string {
+	return p.remoteIP
+}
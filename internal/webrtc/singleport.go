@@ -0,0 +1,63 @@
+package webrtc
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// iceTCPReadBufferSize is how many framed packets may queue per ICE-TCP connection
+const iceTCPReadBufferSize = 8
+
+// SinglePortConfig carries the sockets that every peer shares when media is
+// served on one port.
+type SinglePortConfig struct {
+	// UDP receives all ICE/DTLS/SRTP traffic over UDP
+	UDP net.PacketConn
+	// TCP accepts ICE-TCP connections, e.g. demultiplexed from the HTTPS port
+	TCP net.Listener
+	// PublicIPs replace the host candidate addresses when the server is behind 1:1 NAT
+	PublicIPs []string
+}
+
+// EnableSinglePort makes all peers created afterwards gather host candidates
+// only on the shared UDP socket and TCP listener.
+func (m *Manager) EnableSinglePort(cfg SinglePortConfig) error {
+	settings := webrtc.SettingEngine{}
+	networks := []webrtc.NetworkType{}
+	if cfg.UDP != nil {
+		settings.SetICEUDPMux(webrtc.NewICEUDPMux(nil, cfg.UDP))
+		networks = append(networks, webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6)
+	}
+	if cfg.TCP != nil {
+		settings.SetICETCPMux(webrtc.NewICETCPMux(nil, cfg.TCP, iceTCPReadBufferSize))
+		networks = append(networks, webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6)
+	}
+	if len(networks) == 0 {
+		return fmt.Errorf("single port mode needs a UDP socket or a TCP listener")
+	}
+	settings.SetNetworkTypes(networks)
+	if len(cfg.PublicIPs) > 0 {
+		settings.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.settings = &settings
+	if err := m.rebuildAPI(); err != nil {
+		return err
+	}
+	logrus.Infof("WebRTC media multiplexed on a single port (udp=%t, tcp=%t)", cfg.UDP != nil, cfg.TCP != nil)
+	return nil
+}
+
+// newPeerConnection uses the configured API, if any, and pion's defaults
+// otherwise. Callers must hold peersLock.
+func (m *Manager) newPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	if m.api != nil {
+		return m.api.NewPeerConnection(config)
+	}
+	return webrtc.NewPeerConnection(config)
+}
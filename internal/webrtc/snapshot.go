@@ -0,0 +1,123 @@
+package webrtc
+
+import (
+	"bytes"
+)
+
+// annexBStartCode precedes every NAL unit of a raw H.264 stream
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// rememberParameterSets keeps the latest SPS and PPS, so a snapshot can be
+// decoded even when the source only sends them with its first keyframe.
+// Callers must hold gopMu.
+func (s *streamMedia) rememberParameterSets(nalUnit []byte) {
+	switch nalUnit[0] & 0x1F {
+	case 7:
+		s.sps = nalUnit
+	case 8:
+		s.pps = nalUnit
+	}
+}
+
+// parameterSetsFor returns the SPS and PPS to put in front of nalUnits if
+// they do not carry their own. Callers must hold gopMu.
+func (s *streamMedia) parameterSetsFor(nalUnits [][]byte) [][]byte {
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) > 0 && nalUnit[0]&0x1F == 7 {
+			return nil
+		}
+	}
+	if s.sps == nil || s.pps == nil {
+		return nil
+	}
+	return [][]byte{s.sps, s.pps}
+}
+
+// snapshotSource returns the cached GOP of a stream to take a snapshot
+// from, or, if none is cached, a channel that receives its next IDR access
+// unit. Checking and waiting happen under one lock, so no keyframe is missed
+// in between.
+func (m *Manager) snapshotSource(stream string) ([]byte, int, chan []byte) {
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
+	sm := m.mediaLocked(stream)
+	if data, pictures := sm.gopSnapshot(); data != nil {
+		return data, pictures, nil
+	}
+	// Buffered, so delivering never blocks the video path
+	waiter := make(chan []byte, 1)
+	sm.snapshotWaiters = append(sm.snapshotWaiters, waiter)
+	return nil, 0, waiter
+}
+
+// cancelSnapshot stops delivering to a snapshot of a stream that gave up
+// waiting.
+func (m *Manager) cancelSnapshot(stream string, waiter chan []byte) {
+	m.gopMu.Lock()
+	defer m.gopMu.Unlock()
+	sm := m.mediaLocked(stream)
+	for i, w := range sm.snapshotWaiters {
+		if w == waiter {
+			sm.snapshotWaiters = append(sm.snapshotWaiters[:i], sm.snapshotWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// gopSnapshot returns the cached GOP as a raw H.264 stream and the number of
+// pictures in it, or nil if none is cached. It starts at a keyframe, so its
+// last picture can always be decoded. Callers must hold gopMu.
+func (s *streamMedia) gopSnapshot() ([]byte, int) {
+	if !s.gopStarted || len(s.gop) == 0 {
+		return nil, 0
+	}
+
+	var stream bytes.Buffer
+	pictures := 0
+	for _, nalUnit := range append(s.parameterSetsFor(s.gop), s.gop...) {
+		stream.Write(annexBStartCode)
+		stream.Write(nalUnit)
+		if startsPicture(nalUnit) {
+			pictures++
+		}
+	}
+	if pictures == 0 {
+		return nil, 0
+	}
+	return stream.Bytes(), pictures
+}
+
+// idrSnapshot turns a keyframe access unit into a stream that decodes on its
+// own, or returns nil if it has no IDR slice. Callers must hold gopMu.
+func (s *streamMedia) idrSnapshot(nalUnits [][]byte) []byte {
+	idr := false
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) > 0 && nalUnit[0]&0x1F == 5 {
+			idr = true
+		}
+	}
+	if !idr {
+		return nil
+	}
+
+	var stream bytes.Buffer
+	for _, nalUnit := range append(s.parameterSetsFor(nalUnits), nalUnits...) {
+		if len(nalUnit) == 0 {
+			continue
+		}
+		stream.Write(annexBStartCode)
+		stream.Write(nalUnit)
+	}
+	return stream.Bytes()
+}
+
+// startsPicture reports whether a NAL unit is the first slice of a picture:
+// a coded slice whose first_mb_in_slice, the leading Exp-Golomb value of its
+// header, is zero and so encoded as a single set bit.
+func startsPicture(nalUnit []byte) bool {
+	if len(nalUnit) < 2 {
+		return false
+	}
+	nalType := nalUnit[0] & 0x1F
+	return (nalType == 1 || nalType == 5) && nalUnit[1]&0x80 != 0
+}
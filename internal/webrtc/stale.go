@@ -0,0 +1,85 @@
+package webrtc
+
+import (
+	"context"
+	"time"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// StaleConfig controls how peers that stop sending RTCP are detected, such
+// as browser tabs killed without closing their connection.
+type StaleConfig struct {
+	Interval time.Duration
+	// A peer is stale once it sent no RTCP for After, and is closed after
+	// another CloseAfter; 0 keeps stale peers until ICE fails
+	After      time.Duration
+	CloseAfter time.Duration
+}
+
+// RunStaleDetection checks peers every interval until ctx is cancelled.
+// Only peers that have sent RTCP before are checked, so viewers that never
+// received media are left to ICE.
+func (m *Manager) RunStaleDetection(ctx context.Context, cfg StaleConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkStale(cfg, now)
+		}
+	}
+}
+
+func (m *Manager) checkStale(cfg StaleConfig, now time.Time) {
+	for _, peer := range m.GetAllPeers() {
+		peer.mu.Lock()
+		silent := now.Sub(peer.lastRTCPAt)
+		becameStale, recovered, expired := false, false, false
+		switch {
+		case peer.lastRTCPAt.IsZero():
+		case silent < cfg.After:
+			recovered = !peer.staleSince.IsZero()
+			peer.staleSince = time.Time{}
+		case peer.staleSince.IsZero():
+			peer.staleSince = now
+			becameStale = true
+		default:
+			expired = cfg.CloseAfter > 0 && now.Sub(peer.staleSince) >= cfg.CloseAfter
+		}
+		peer.mu.Unlock()
+
+		switch {
+		case becameStale:
+			peer.log.Warnf("Peer is stale: no RTCP for %s", silent.Round(time.Second))
+			m.eventBus().Publish(events.Event{
+				Type:   events.PeerStale,
+				Peer:   peer.ID,
+				Stream: peer.Stream,
+				Data:   map[string]interface{}{"silent_seconds": silent.Seconds()},
+			})
+		case recovered:
+			peer.log.Info("Peer is sending RTCP again")
+		case expired:
+			peer.log.Warnf("Closing stale peer: no RTCP for %s", silent.Round(time.Second))
+			m.detachPeer(peer)
+		}
+	}
+}
+
+// PeerStale reports whether a peer has stopped sending RTCP.
+func (m *Manager) PeerStale(peerID string) bool {
+	peer, ok := m.GetPeer(peerID)
+	if !ok {
+		return false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	return !peer.staleSince.IsZero()
+}
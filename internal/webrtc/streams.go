@@ -0,0 +1,175 @@
+package webrtc
+
+import (
+	"strings"
+	"time"
+)
+
+// streamMedia is the video state kept per stream, so viewers of any stream
+// start from its own GOP and previews show its own recent video. All of it
+// is guarded by the manager's gopMu.
+type streamMedia struct {
+	// Last complete GOP, replayed to peers as soon as they connect, with
+	// when each NAL unit arrived; gopGen counts the times it restarted
+	gop            [][]byte
+	gopAt          []time.Time
+	gopBytes       int
+	gopGen         uint64
+	gopStarted     bool
+	gopLastNALType byte
+	// Latest parameter sets
+	sps []byte
+	pps []byte
+	// Recent keyframe-aligned video for previews
+	rolling      []*bufferedGOP
+	rollingBytes int
+	// While the source restarts, live video is held back until its next
+	// keyframe
+	resyncSince   time.Time
+	resyncDropped int
+	// Snapshots waiting for a keyframe while no GOP is cached, each with a
+	// channel of its own
+	snapshotWaiters []chan []byte
+	// When the stream's source was last asked for a keyframe
+	sourceKeyframeAt time.Time
+}
+
+// resetGOP empties the replay buffer. Callers must hold gopMu.
+func (s *streamMedia) resetGOP() {
+	s.gop = s.gop[:0]
+	s.gopAt = s.gopAt[:0]
+	s.gopBytes = 0
+	s.gopGen++
+}
+
+// mediaLocked returns the video state of a stream, creating it on first
+// use. Callers must hold gopMu.
+func (m *Manager) mediaLocked(stream string) *streamMedia {
+	sm, ok := m.streams[stream]
+	if !ok {
+		sm = &streamMedia{}
+		m.streams[stream] = sm
+	}
+	return sm
+}
+
+// streamName normalizes the name of a stream, resolving "" to the active
+// one. Callers must not hold peersLock.
+func (m *Manager) streamName(stream string) string {
+	if stream == "" {
+		return m.ActiveStream()
+	}
+	return strings.ToLower(stream)
+}
+
+// SetActiveStream makes stream the one watched by peers that did not pick
+// a stream of their own. Those already watching switch over right away,
+// starting from the new stream's cached GOP.
+func (m *Manager) SetActiveStream(stream string) {
+	stream = strings.ToLower(stream)
+	m.peersLock.Lock()
+	changed := m.activeStream != stream
+	m.activeStream = stream
+	followers := make([]*Peer, 0, len(m.groups[""]))
+	for _, peer := range m.groups[""] {
+		followers = append(followers, peer)
+	}
+	m.peersLock.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, peer := range followers {
+		peer.mu.Lock()
+		replay := peer.IsConnected && peer.primed
+		if replay {
+			// Live video of the new stream waits for the replay
+			peer.primed = false
+		}
+		peer.mu.Unlock()
+		if replay {
+			go m.replayGOP(peer)
+		}
+	}
+}
+
+// ActiveStream returns the stream watched by peers that did not pick one.
+func (m *Manager) ActiveStream() string {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	return m.activeStream
+}
+
+// StreamPeerCounts returns the number of peers pinned to each stream that
+// has any, and under "" the number following the active stream, including
+// those that may still resume.
+func (m *Manager) StreamPeerCounts() map[string]int {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	counts := make(map[string]int, len(m.groups))
+	for key, group := range m.groups {
+		counts[key] = len(group)
+	}
+	for _, d := range m.detached {
+		counts[d.peer.groupKey()]++
+	}
+	return counts
+}
+
+// groupKey is the group a peer is in: the stream it is pinned to, or "" if
+// it follows the active stream.
+func (p *Peer) groupKey() string {
+	if p.Pinned {
+		return strings.ToLower(p.Stream)
+	}
+	return ""
+}
+
+// joinGroupLocked adds a peer to the viewers of its stream. Callers must
+// hold peersLock.
+func (m *Manager) joinGroupLocked(peer *Peer) {
+	key := peer.groupKey()
+	group, ok := m.groups[key]
+	if !ok {
+		group = make(map[string]*Peer)
+		m.groups[key] = group
+	}
+	group[peer.ID] = peer
+}
+
+// leaveGroupLocked removes a peer from the viewers of its stream. Callers
+// must hold peersLock.
+func (m *Manager) leaveGroupLocked(peer *Peer) {
+	key := peer.groupKey()
+	if m.groups[key][peer.ID] != peer {
+		return
+	}
+	delete(m.groups[key], peer.ID)
+	if len(m.groups[key]) == 0 {
+		delete(m.groups, key)
+	}
+}
+
+// forEachViewerLocked calls fn for every peer watching a stream: those
+// pinned to it and, while it is active, those following the active stream.
+// Callers must hold peersLock.
+func (m *Manager) forEachViewerLocked(stream string, fn func(peer *Peer)) {
+	for _, peer := range m.groups[stream] {
+		fn(peer)
+	}
+	if stream != m.activeStream || stream == "" {
+		return
+	}
+	for _, peer := range m.groups[""] {
+		fn(peer)
+	}
+}
+
+// peerStreamLocked returns the stream a peer watches. Callers must hold
+// peersLock.
+func (m *Manager) peerStreamLocked(peer *Peer) string {
+	if key := peer.groupKey(); key != "" {
+		return key
+	}
+	return m.activeStream
+}
@@ -0,0 +1,115 @@
+package webrtc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// addTestPeer registers a peer with the manager as a viewer would be after
+// its offer.
+func addTestPeer(m *Manager, peer *Peer) *Peer {
+	peer.log = logrus.WithField("peer", peer.ID)
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.peers[peer.ID] = peer
+	m.joinGroupLocked(peer)
+	return peer
+}
+
+// detachTestPeer keeps a peer as a viewer that lost its connection and may
+// still resume.
+func detachTestPeer(m *Manager, token string, peer *Peer) {
+	m.peersLock.Lock()
+	defer m.peersLock.Unlock()
+	m.detached[token] = &detachedPeer{peer: peer}
+}
+
+// viewers returns the IDs of the peers watching stream.
+func viewers(m *Manager, stream string) []string {
+	m.peersLock.RLock()
+	defer m.peersLock.RUnlock()
+	var ids []string
+	m.forEachViewerLocked(stream, func(peer *Peer) { ids = append(ids, peer.ID) })
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSetActiveStreamMovesFollowers(t *testing.T) {
+	m := NewManager()
+	m.SetActiveStream("cam1")
+	follower := addTestPeer(m, &Peer{ID: "follower", Stream: "cam1"})
+	live := addTestPeer(m, &Peer{ID: "live", Stream: "cam1", IsConnected: true, primed: true})
+	pinned := addTestPeer(m, &Peer{ID: "pinned", Stream: "CAM1", Pinned: true})
+
+	m.SetActiveStream("Cam2")
+
+	if got := m.ActiveStream(); got != "cam2" {
+		t.Errorf("ActiveStream() = %q, want cam2", got)
+	}
+	m.peersLock.RLock()
+	for _, tt := range []struct {
+		peer *Peer
+		want string
+	}{
+		{follower, "cam2"},
+		{live, "cam2"},
+		{pinned, "cam1"},
+	} {
+		if got := m.peerStreamLocked(tt.peer); got != tt.want {
+			t.Errorf("peer %s watches %q, want %q", tt.peer.ID, got, tt.want)
+		}
+	}
+	m.peersLock.RUnlock()
+	if got, want := viewers(m, "cam2"), []string{"follower", "live"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("viewers of cam2 = %v, want %v", got, want)
+	}
+	if got, want := viewers(m, "cam1"), []string{"pinned"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("viewers of cam1 = %v, want %v", got, want)
+	}
+
+	// A connected follower waits for the new stream's GOP before live video
+	live.mu.RLock()
+	primed := live.primed
+	live.mu.RUnlock()
+	if primed {
+		t.Error("connected follower still receives live video without a replay")
+	}
+}
+
+func TestSetActiveStreamUnchangedKeepsPeersPrimed(t *testing.T) {
+	m := NewManager()
+	m.SetActiveStream("cam1")
+	live := addTestPeer(m, &Peer{ID: "live", Stream: "cam1", IsConnected: true, primed: true})
+
+	m.SetActiveStream("CAM1")
+
+	live.mu.RLock()
+	defer live.mu.RUnlock()
+	if !live.primed {
+		t.Error("follower was replayed to although the active stream did not change")
+	}
+}
+
+func TestStreamPeerCounts(t *testing.T) {
+	m := NewManager()
+	m.SetActiveStream("cam1")
+	addTestPeer(m, &Peer{ID: "follower", Stream: "cam1"})
+	addTestPeer(m, &Peer{ID: "pinned1", Stream: "cam1", Pinned: true})
+	addTestPeer(m, &Peer{ID: "pinned2", Stream: "Cam2", Pinned: true})
+	detachTestPeer(m, "t1", &Peer{ID: "gone-follower", Stream: "cam1"})
+	detachTestPeer(m, "t2", &Peer{ID: "gone-pinned", Stream: "cam3", Pinned: true})
+
+	want := map[string]int{"": 2, "cam1": 1, "cam2": 1, "cam3": 1}
+	if got := m.StreamPeerCounts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamPeerCounts() = %v, want %v", got, want)
+	}
+
+	// Switching the active stream moves followers, not pinned viewers
+	m.SetActiveStream("cam3")
+	if got := m.StreamPeerCounts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamPeerCounts() after switching = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package webrtc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrTrickleKey is returned when a trickle request does not carry the key
+// issued with the peer's answer.
+var ErrTrickleKey = errors.New("invalid trickle key")
+
+// trickleState buffers the local ICE candidates of a peer that trickles
+// them, so a client subscribing late still receives all of them.
+type trickleState struct {
+	key        string
+	mu         sync.Mutex
+	candidates []webrtc.ICECandidateInit
+	done       bool
+	// changed is closed and replaced whenever a candidate is added
+	changed chan struct{}
+}
+
+func newTrickleState() *trickleState {
+	return &trickleState{key: newResumeToken(), changed: make(chan struct{})}
+}
+
+// add buffers a gathered candidate; nil marks the end of candidates. Once
+// gathering completed, candidates of later ICE restarts are not trickled,
+// as their answers carry them.
+func (t *trickleState) add(candidate *webrtc.ICECandidate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	if candidate == nil {
+		t.done = true
+	} else {
+		init := candidate.ToJSON()
+		// pion leaves the mid empty, which browsers reject; the media is
+		// bundled, so the first m-line stands for all of them
+		init.SDPMid = nil
+		t.candidates = append(t.candidates, init)
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// TrickleKey returns the key a client presents to exchange ICE candidates
+// of the peer; empty when the peer does not trickle them.
+func (p *Peer) TrickleKey() string {
+	if p.trickle == nil {
+		return ""
+	}
+	return p.trickle.key
+}
+
+// LocalCandidates returns the peer's candidates gathered after the first
+// from, whether gathering completed, and a channel closed once there are
+// more.
+func (m *Manager) LocalCandidates(peerID, key string, from int) ([]ICECandidateInit, bool, <-chan struct{}, error) {
+	peer, err := m.trickledPeer(peerID, key)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	t := peer.trickle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var candidates []webrtc.ICECandidateInit
+	if from < len(t.candidates) {
+		candidates = append(candidates, t.candidates[max(from, 0):]...)
+	}
+	return candidates, t.done, t.changed, nil
+}
+
+// AddRemoteCandidate adds an ICE candidate the client trickled; an empty
+// candidate marks the end of its candidates.
+func (m *Manager) AddRemoteCandidate(peerID, key string, candidate ICECandidateInit) error {
+	peer, err := m.trickledPeer(peerID, key)
+	if err != nil {
+		return err
+	}
+	return m.addRemoteCandidate(peer, candidate)
+}
+
+// AddICECandidate adds a remote ICE candidate to any peer, for callers that
+// authorized the client themselves, such as WHEP sessions.
+func (m *Manager) AddICECandidate(peerID string, candidate ICECandidateInit) error {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return fmt.Errorf("peer not found: %s", peerID)
+	}
+	return m.addRemoteCandidate(peer, candidate)
+}
+
+func (m *Manager) addRemoteCandidate(peer *Peer, candidate ICECandidateInit) error {
+	if err := peer.Connection.AddICECandidate(candidate); err != nil {
+		return fmt.Errorf("failed to add ICE candidate: %w", err)
+	}
+	if candidate.Candidate == "" {
+		peer.log.Debug("Client finished trickling candidates")
+	} else {
+		peer.log.Debugf("Added client candidate: %s", candidate.Candidate)
+	}
+	return nil
+}
+
+func (m *Manager) trickledPeer(peerID, key string) (*Peer, error) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return nil, fmt.Errorf("peer not found: %s", peerID)
+	}
+	if peer.trickle == nil || subtle.ConstantTimeCompare([]byte(key), []byte(peer.trickle.key)) != 1 {
+		return nil, ErrTrickleKey
+	}
+	return peer, nil
+}
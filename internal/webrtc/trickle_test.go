@@ -0,0 +1,36 @@
+package webrtc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTrickledPeerChecksKey(t *testing.T) {
+	m := NewManager()
+	addTestPeer(m, &Peer{ID: "trickling", trickle: &trickleState{key: "k3y-0f-the-peer"}})
+	addTestPeer(m, &Peer{ID: "gathered"})
+
+	tests := []struct {
+		peerID  string
+		key     string
+		wantErr error
+	}{
+		{"trickling", "k3y-0f-the-peer", nil},
+		{"trickling", "k3y-0f-the-pee", ErrTrickleKey},
+		{"trickling", "k3y-0f-the-peer2", ErrTrickleKey},
+		{"trickling", "", ErrTrickleKey},
+		{"gathered", "", ErrTrickleKey},
+	}
+	for _, tt := range tests {
+		peer, err := m.trickledPeer(tt.peerID, tt.key)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("trickledPeer(%q, %q) error = %v, want %v", tt.peerID, tt.key, err, tt.wantErr)
+		}
+		if err == nil && peer.ID != tt.peerID {
+			t.Errorf("trickledPeer(%q, %q) = peer %s", tt.peerID, tt.key, peer.ID)
+		}
+	}
+	if _, err := m.trickledPeer("unknown", "k3y-0f-the-peer"); err == nil {
+		t.Error("trickledPeer() of an unknown peer succeeded")
+	}
+}
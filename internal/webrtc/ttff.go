@@ -0,0 +1,47 @@
+package webrtc
+
+import (
+	"time"
+
+	"golang-webrtc-streaming/internal/metrics"
+)
+
+// timeToFirstFrameBuckets are the histogram bounds in seconds
+var timeToFirstFrameBuckets = []float64{0.25, 0.5, 1, 1.5, 2, 3, 5, 10, 20}
+
+// TimeToFirstFrame returns the histogram of the time from receiving a
+// peer's offer to sending it the first video frame.
+func (m *Manager) TimeToFirstFrame() *metrics.Histogram {
+	return m.ttff
+}
+
+// PeerTimeToFirstFrame returns how long a peer waited for its first video
+// frame, once it has received one.
+func (m *Manager) PeerTimeToFirstFrame(peerID string) (time.Duration, bool) {
+	peer, exists := m.GetPeer(peerID)
+	if !exists {
+		return 0, false
+	}
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	if peer.firstFrameAt.IsZero() {
+		return 0, false
+	}
+	return peer.firstFrameAt.Sub(peer.offerAt), true
+}
+
+// markFirstFrame records that a video frame was sent to a peer; only the
+// first call per peer is observed.
+func (m *Manager) markFirstFrame(peer *Peer) {
+	peer.mu.Lock()
+	if !peer.firstFrameAt.IsZero() {
+		peer.mu.Unlock()
+		return
+	}
+	peer.firstFrameAt = time.Now()
+	elapsed := peer.firstFrameAt.Sub(peer.offerAt)
+	peer.mu.Unlock()
+
+	m.ttff.Observe(elapsed.Seconds())
+	peer.log.Infof("Received its first frame %s after its offer", elapsed.Round(time.Millisecond))
+}
@@ -0,0 +1,423 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/sirupsen/logrus"
+
+	"golang-webrtc-streaming/internal/events"
+)
+
+// Uplink connection states
+const (
+	UplinkConnecting   = "connecting"
+	UplinkConnected    = "connected"
+	UplinkDisconnected = "disconnected"
+)
+
+// uplinkRequestTimeout bounds the HTTP requests to the central instance
+const uplinkRequestTimeout = 15 * time.Second
+
+// maxUplinkRetryInterval caps the wait between two connection attempts
+const maxUplinkRetryInterval = 30 * time.Second
+
+// UplinkConfig sets where an edge instance pushes its streams.
+type UplinkConfig struct {
+	// URL is the uplink endpoint of the central instance, e.g.
+	// https://central.example.com/api/uplink
+	URL string
+	// Token is sent as a bearer token to the central instance
+	Token string
+	// Streams maps the local streams pushed to their names on the central
+	// instance
+	Streams map[string]string
+}
+
+// Validate checks that the central instance and the streams are set.
+func (c UplinkConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid uplink URL %q, expected http(s)://host/api/uplink", c.URL)
+	}
+	if len(c.Streams) == 0 {
+		return fmt.Errorf("no streams to push over the uplink")
+	}
+	return nil
+}
+
+// UplinkStatus reports the uplink of an edge instance.
+type UplinkStatus struct {
+	URL string `json:"url"`
+	// Streams maps the local streams pushed to their names on the central
+	// instance
+	Streams map[string]string `json:"streams"`
+	State   string            `json:"state"`
+	// Session is the URL of the session on the central instance
+	Session     string     `json:"session,omitempty"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// uplinkStream is the track of a pushed stream, with its latest GOP, which
+// is replayed whenever the central instance asks for a keyframe.
+type uplinkStream struct {
+	name        string
+	track       *webrtc.TrackLocalStaticSample
+	gop         [][]byte
+	gopBytes    int
+	gopStarted  bool
+	lastNALType byte
+	replayedAt  time.Time
+	mu          sync.Mutex
+}
+
+// Uplink pushes streams of an edge instance to a central instance over a
+// single outbound peer connection, which the central instance answers as a
+// WHIP endpoint. The edge offers and the central instance never connects
+// back, so the edge may sit behind NAT with no inbound ports open.
+type Uplink struct {
+	m       *Manager
+	cfg     UplinkConfig
+	client  *http.Client
+	streams map[string]*uplinkStream
+	status  UplinkStatus
+	mu      sync.RWMutex
+}
+
+// NewUplink prepares the uplink; Run connects it.
+func (m *Manager) NewUplink(cfg UplinkConfig) (*Uplink, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	u := &Uplink{
+		m:       m,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: uplinkRequestTimeout},
+		streams: make(map[string]*uplinkStream, len(cfg.Streams)),
+		status:  UplinkStatus{URL: cfg.URL, Streams: cfg.Streams, State: UplinkDisconnected},
+	}
+	videoCodec, _ := m.trackCodecs()
+	for local, remote := range cfg.Streams {
+		// The central instance names the stream by the track's msid
+		track, err := webrtc.NewTrackLocalStaticSample(videoCodec, remote, remote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create uplink track of %s: %w", local, err)
+		}
+		u.streams[local] = &uplinkStream{name: local, track: track}
+	}
+	return u, nil
+}
+
+// Status reports the uplink's connection.
+func (u *Uplink) Status() UplinkStatus {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.status
+}
+
+// Run keeps the uplink connected until ctx is cancelled, reconnecting with
+// backoff whenever the connection fails or the central instance refuses it.
+func (u *Uplink) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		connected, err := u.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		u.mu.Lock()
+		u.status.State = UplinkDisconnected
+		u.status.Session = ""
+		u.status.ConnectedAt = nil
+		if err != nil {
+			u.status.LastError = err.Error()
+		}
+		u.mu.Unlock()
+		if err != nil {
+			logrus.Errorf("Uplink to %s failed, retrying in %s: %v", u.cfg.URL, backoff, err)
+		} else {
+			logrus.Warnf("Uplink to %s disconnected, reconnecting in %s", u.cfg.URL, backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxUplinkRetryInterval {
+			backoff = maxUplinkRetryInterval
+		}
+	}
+}
+
+// session runs one connection to the central instance, reporting whether
+// it connected. The session is deleted on the central instance when it
+// ends, so the streams are released right away rather than on ICE timeout.
+func (u *Uplink) session(ctx context.Context) (bool, error) {
+	u.mu.Lock()
+	u.status.State = UplinkConnecting
+	u.status.Attempts++
+	u.mu.Unlock()
+
+	u.m.peersLock.RLock()
+	config := webrtc.Configuration{
+		ICEServers:   u.m.iceServers.Servers("uplink"),
+		BundlePolicy: webrtc.BundlePolicyMaxBundle,
+	}
+	if u.m.certificate != nil {
+		config.Certificates = []webrtc.Certificate{*u.m.certificate}
+	}
+	u.m.peersLock.RUnlock()
+
+	pc, err := u.m.newPeerConnection(config)
+	if err != nil {
+		return false, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	defer pc.Close()
+
+	for _, stream := range u.sortedStreams() {
+		sender, err := pc.AddTransceiverFromTrack(stream.track, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+		if err != nil {
+			return false, fmt.Errorf("failed to add track of %s: %w", stream.name, err)
+		}
+		go u.readRTCP(sender.Sender(), stream)
+	}
+
+	states := make(chan webrtc.PeerConnectionState, 8)
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		select {
+		case states <- state:
+		default:
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create offer: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return false, fmt.Errorf("failed to set offer: %w", err)
+	}
+	// The central instance takes no trickled candidates, so the offer
+	// carries all of them
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(uplinkRequestTimeout):
+		return false, fmt.Errorf("ICE gathering did not complete within %s", uplinkRequestTimeout)
+	}
+
+	answer, location, err := u.post(ctx, pc.LocalDescription().SDP)
+	if err != nil {
+		return false, err
+	}
+	defer u.delete(location)
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		return false, fmt.Errorf("failed to set answer: %w", err)
+	}
+	u.mu.Lock()
+	u.status.Session = location
+	u.mu.Unlock()
+
+	connected := false
+	timeout := time.NewTimer(uplinkConnectTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return connected, nil
+		case <-timeout.C:
+			return false, fmt.Errorf("connection not established within %s", uplinkConnectTimeout)
+		case state := <-states:
+			switch state {
+			case webrtc.PeerConnectionStateConnected:
+				connected = true
+				timeout.Stop()
+				now := time.Now()
+				u.mu.Lock()
+				u.status.State = UplinkConnected
+				u.status.ConnectedAt = &now
+				u.status.LastError = ""
+				u.mu.Unlock()
+				logrus.Infof("🔼 Uplink to %s connected, pushing %d streams", u.cfg.URL, len(u.streams))
+				u.m.eventBus().Publish(events.Event{Type: events.UplinkConnected, Data: map[string]interface{}{
+					"url":     u.cfg.URL,
+					"streams": u.cfg.Streams,
+				}})
+			case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+				if connected {
+					u.m.eventBus().Publish(events.Event{Type: events.UplinkDisconnected, Data: map[string]interface{}{
+						"url":    u.cfg.URL,
+						"reason": state.String(),
+					}})
+				}
+				return connected, nil
+			}
+		}
+	}
+}
+
+// post sends the offer to the central instance and returns its answer and
+// the URL of the session it created.
+func (u *Uplink) post(ctx context.Context, offer string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.cfg.URL, strings.NewReader(offer))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+	if u.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.cfg.Token)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to reach central instance: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxOfferSDPBytes))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("central instance refused the uplink: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	location := resp.Header.Get("Location")
+	if location != "" {
+		if ref, err := resp.Request.URL.Parse(location); err == nil {
+			location = ref.String()
+		}
+	}
+	return string(body), location, nil
+}
+
+// delete ends the session on the central instance.
+func (u *Uplink) delete(location string) {
+	if location == "" {
+		return
+	}
+	req, err := http.NewRequest(http.MethodDelete, location, nil)
+	if err != nil {
+		return
+	}
+	if u.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.cfg.Token)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		logrus.Debugf("Failed to delete uplink session %s: %v", location, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (u *Uplink) sortedStreams() []*uplinkStream {
+	streams := make([]*uplinkStream, 0, len(u.streams))
+	for _, stream := range u.streams {
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].name < streams[j].name })
+	return streams
+}
+
+// readRTCP drains RTCP of a pushed stream, answering keyframe requests of
+// the central instance with the stream's cached GOP.
+func (u *Uplink) readRTCP(sender *webrtc.RTPSender, stream *uplinkStream) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				stream.replay()
+			}
+		}
+	}
+}
+
+// WriteVideo pushes an H.264 access unit of a local stream; streams that
+// are not pushed are ignored. Video is dropped while the uplink is down.
+func (u *Uplink) WriteVideo(streamID string, data []byte) {
+	stream, ok := u.streams[streamID]
+	if !ok {
+		return
+	}
+	nalUnits, err := u.m.parseH264NALUnits(data)
+	if err != nil {
+		return
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for _, nalUnit := range nalUnits {
+		if len(nalUnit) == 0 {
+			continue
+		}
+		stream.cache(nalUnit)
+		if err := stream.track.WriteSample(media.Sample{Data: nalUnit, Duration: time.Millisecond * 33}); err != nil {
+			logrus.Debugf("Failed to push video of %s: %v", streamID, err)
+		}
+	}
+}
+
+// cache keeps the NAL units since the latest keyframe, like the GOP cache
+// of viewers. Callers must hold mu.
+func (s *uplinkStream) cache(nalUnit []byte) {
+	nalType := nalUnit[0] & 0x1F
+	startsGOP := nalType == 7 ||
+		(nalType == 5 && s.lastNALType != 5 && s.lastNALType != 7 && s.lastNALType != 8 && s.lastNALType != 6)
+	s.lastNALType = nalType
+	if startsGOP {
+		s.gop = s.gop[:0]
+		s.gopBytes = 0
+		s.gopStarted = true
+	}
+	if !s.gopStarted {
+		return
+	}
+	if s.gopBytes+len(nalUnit) > maxGOPBytes {
+		s.gop = s.gop[:0]
+		s.gopBytes = 0
+		s.gopStarted = false
+		return
+	}
+	s.gop = append(s.gop, append([]byte(nil), nalUnit...))
+	s.gopBytes += len(nalUnit)
+}
+
+// replay bursts the cached GOP, so the central instance can decode the
+// stream without waiting for the next keyframe. Requests are throttled, as
+// every answer is a burst of a whole GOP.
+func (s *uplinkStream) replay() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.replayedAt) < uplinkKeyframeInterval || len(s.gop) == 0 {
+		return
+	}
+	s.replayedAt = time.Now()
+	for _, nalUnit := range s.gop {
+		if err := s.track.WriteSample(media.Sample{Data: nalUnit, Duration: gopReplaySampleDuration}); err != nil {
+			return
+		}
+	}
+	logrus.Debugf("Replayed GOP of %s over the uplink: %d NAL units, %d bytes", s.name, len(s.gop), s.gopBytes)
+}
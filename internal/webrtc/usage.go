@@ -0,0 +1,83 @@
+package webrtc
+
+// PeerUsage is the media a peer was sent since its usage was last collected.
+// Bytes are media payload, without RTP, SRTP, and transport overhead.
+type PeerUsage struct {
+	PeerID string
+	Stream string
+	Tags   map[string]string
+	// BytesSent is new since the previous collection, TotalBytesSent counts
+	// the whole session
+	BytesSent      uint64
+	TotalBytesSent uint64
+	// Gone is set once the peer was removed; it is not collected again
+	Gone bool
+}
+
+// countSent adds media written to the peer's tracks to its usage.
+func (p *Peer) countSent(n int) {
+	p.bytesSent.Add(uint64(n))
+}
+
+// BytesSent returns the media bytes the peer was sent so far.
+func (p *Peer) BytesSent() uint64 {
+	return p.bytesSent.Load()
+}
+
+// CollectUsage returns what every peer was sent since the previous call,
+// including peers removed since then, e.g. for usage accounting.
+func (m *Manager) CollectUsage() []PeerUsage {
+	m.peersLock.RLock()
+	peers := make([]*Peer, 0, len(m.peers)+len(m.detached))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	for _, d := range m.detached {
+		peers = append(peers, d.peer)
+	}
+	m.peersLock.RUnlock()
+
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	usage := m.removedUsage
+	m.removedUsage = nil
+	for _, peer := range peers {
+		usage = append(usage, peer.collectUsageLocked(false))
+	}
+	return usage
+}
+
+// retireUsage keeps what a removed peer was sent since the last collection
+// for the next one.
+func (m *Manager) retireUsage(peer *Peer) {
+	m.usageMu.Lock()
+	m.removedUsage = append(m.removedUsage, peer.collectUsageLocked(true))
+	m.usageMu.Unlock()
+}
+
+// moveUsage carries the byte counts of a detached peer over to the peer
+// resuming it, leaving nothing to collect from the old one.
+func (m *Manager) moveUsage(from, to *Peer) {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	sent := from.bytesSent.Load()
+	to.bytesSent.Store(sent)
+	to.bytesCollected = from.bytesCollected
+	from.bytesCollected = sent
+}
+
+// collectUsageLocked returns the peer's usage since the last collection.
+// Callers hold the manager's usageMu.
+func (p *Peer) collectUsageLocked(gone bool) PeerUsage {
+	total := p.bytesSent.Load()
+	usage := PeerUsage{
+		PeerID:         p.ID,
+		Stream:         p.Stream,
+		Tags:           p.Tags,
+		BytesSent:      total - p.bytesCollected,
+		TotalBytesSent: total,
+		Gone:           gone,
+	}
+	p.bytesCollected = total
+	return usage
+}
@@ -0,0 +1,202 @@
+// Package client views streams of the streaming server from Go programs,
+// without a browser. It wraps the server's signaling API and a pion peer
+// connection: View negotiates a viewer session whose H.264 video and Opus
+// audio arrive as samples, which can be consumed directly or saved to
+// files, and Snapshot fetches a JPEG of the current picture.
+//
+// A minimal consumer:
+//
+//	c, err := client.New(client.Config{URL: "http://localhost:8080"})
+//	...
+//	session, err := c.View(ctx, client.ViewOptions{})
+//	...
+//	defer session.Close()
+//	for sample := range session.Video() {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxResponseBytes bounds the responses read from the server; an answer SDP
+// or a snapshot is well under it
+const maxResponseBytes = 16 << 20
+
+// Config sets how a Client reaches the server.
+type Config struct {
+	// URL is the server's base URL, e.g. http://localhost:8080
+	URL string
+	// Token, if set, is presented as a bearer token to servers that
+	// authorize viewers
+	Token string
+	// HTTPClient sends the API requests; http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Client calls the API of one server.
+type Client struct {
+	base  *url.URL
+	token string
+	http  *http.Client
+}
+
+// New returns a client of the server at cfg.URL.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q, expected http(s)://host[:port]", cfg.URL)
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: base, token: cfg.Token, http: httpClient}, nil
+}
+
+// APIError is an error response of the server.
+type APIError struct {
+	StatusCode int
+	// Code is the server's message code, e.g. "access_denied"
+	Code    string
+	Message string
+	// Detail explains client errors further, when the server says more
+	Detail string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("server answered %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+// do sends a request to the API, with in encoded as its JSON body if not
+// nil, and decodes the JSON response into out if not nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base.String()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var errBody struct {
+			Error  string `json:"error"`
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &errBody) == nil {
+			apiErr.Code, apiErr.Message, apiErr.Detail = errBody.Code, errBody.Error, errBody.Detail
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// ICEServer is a STUN or TURN server, as the server hands it to viewers.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// WebRTCConfig is what the server tells viewers to set up their peer
+// connection with.
+type WebRTCConfig struct {
+	ICEServers    []ICEServer `json:"ice_servers"`
+	Streams       []Stream    `json:"streams"`
+	CurrentStream string      `json:"current_stream"`
+}
+
+// Stream is a stream of the server.
+type Stream struct {
+	ID string `json:"id"`
+	// RelayOnly streams only accept TURN relay candidates
+	RelayOnly bool `json:"relay_only"`
+}
+
+// WebRTCConfig returns the server's ICE servers and streams. With a TURN
+// secret configured, each call returns fresh TURN credentials.
+func (c *Client) WebRTCConfig(ctx context.Context) (WebRTCConfig, error) {
+	var cfg WebRTCConfig
+	err := c.do(ctx, http.MethodGet, "/api/webrtc-config", nil, &cfg)
+	return cfg, err
+}
+
+// Snapshot returns a JPEG of the current picture of stream, or of the
+// active stream if stream is empty. The server decodes it from the video it
+// caches of every stream, so the stream needs no viewers; until its first
+// keyframe, the server waits up to 5 seconds for one.
+func (c *Client) Snapshot(ctx context.Context, stream string) ([]byte, error) {
+	path := "/api/snapshot"
+	if stream != "" {
+		path += "?" + url.Values{"stream": {stream}}.Encode()
+	}
+	var resp struct {
+		Data string `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	encoded, ok := strings.CutPrefix(resp.Data, "data:image/jpeg;base64,")
+	if !ok {
+		return nil, errors.New("snapshot is not a JPEG data URL")
+	}
+	jpeg, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return jpeg, nil
+}
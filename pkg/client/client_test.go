@@ -0,0 +1,280 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// testClient returns a client of a test server answering with handler.
+func testClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := New(Config{URL: server.URL, Token: "secret"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func TestSnapshot(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	var gotQuery, gotAuth string
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/snapshot" {
+			http.NotFound(w, r)
+			return
+		}
+		gotQuery, gotAuth = r.URL.RawQuery, r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"data":    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpeg),
+		})
+	}))
+
+	tests := []struct {
+		stream    string
+		wantQuery string
+	}{
+		{"", ""},
+		{"cam 1", "stream=cam+1"},
+	}
+	for _, tt := range tests {
+		got, err := c.Snapshot(context.Background(), tt.stream)
+		if err != nil {
+			t.Fatalf("Snapshot(%q) error = %v", tt.stream, err)
+		}
+		if !bytes.Equal(got, jpeg) {
+			t.Errorf("Snapshot(%q) = %x, want %x", tt.stream, got, jpeg)
+		}
+		if gotQuery != tt.wantQuery {
+			t.Errorf("Snapshot(%q) sent query %q, want %q", tt.stream, gotQuery, tt.wantQuery)
+		}
+		if gotAuth != "Bearer secret" {
+			t.Errorf("Snapshot(%q) sent Authorization %q", tt.stream, gotAuth)
+		}
+	}
+}
+
+func TestSnapshotRejectsNonJPEG(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":"data:image/png;base64,AAAA"}`))
+	}))
+	if _, err := c.Snapshot(context.Background(), ""); err == nil {
+		t.Error("Snapshot() of a PNG succeeded")
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        APIError
+	}{
+		{
+			name:   "json",
+			status: http.StatusNotFound,
+			body:   `{"success":false,"error":"Stream not found","code":"stream_not_found"}`,
+			want:   APIError{StatusCode: http.StatusNotFound, Code: "stream_not_found", Message: "Stream not found"},
+		},
+		{
+			name:   "json with detail",
+			status: http.StatusBadRequest,
+			body:   `{"error":"Invalid request","code":"invalid_request","detail":"missing sdp"}`,
+			want:   APIError{StatusCode: http.StatusBadRequest, Code: "invalid_request", Message: "Invalid request", Detail: "missing sdp"},
+		},
+		{
+			name:        "plain text",
+			status:      http.StatusBadGateway,
+			contentType: "text/plain",
+			body:        "upstream unavailable\n",
+			want:        APIError{StatusCode: http.StatusBadGateway, Message: "upstream unavailable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			_, err := c.Snapshot(context.Background(), "")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Snapshot() error = %v, want an *APIError", err)
+			}
+			if *apiErr != tt.want {
+				t.Errorf("Snapshot() error = %+v, want %+v", *apiErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	err := &APIError{StatusCode: 403, Code: "forbidden", Message: "Access denied", Detail: "token expired"}
+	want := "server answered 403: forbidden: Access denied (token expired)"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// answeringServer answers viewer offers with a peer connection sending
+// H.264 video, as the streaming server does, and returns the offers it got.
+func answeringServer(t *testing.T) (http.Handler, <-chan offerRequest) {
+	t.Helper()
+	offers := make(chan offerRequest, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/webrtc-config", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(WebRTCConfig{ICEServers: []ICEServer{}})
+	})
+	mux.HandleFunc("/api/offer", func(w http.ResponseWriter, r *http.Request) {
+		var req offerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		offers <- req
+
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.Cleanup(func() { pc.Close() })
+		track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}, "video", "test")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := pc.AddTrack(track); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+			if state == webrtc.PeerConnectionStateConnected {
+				go sendKeyframes(track, pc)
+			}
+		})
+		if err := pc.SetRemoteDescription(req.SDP); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		gathered := webrtc.GatheringCompletePromise(pc)
+		if err := pc.SetLocalDescription(answer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		<-gathered
+		json.NewEncoder(w).Encode(offerResponse{
+			SDP:         pc.LocalDescription().SDP,
+			PeerID:      "viewer-1",
+			ResumeToken: "resume-1",
+		})
+	})
+	return mux, offers
+}
+
+// sendKeyframes writes a keyframe access unit every 20ms until the
+// connection closes.
+func sendKeyframes(track *webrtc.TrackLocalStaticSample, pc *webrtc.PeerConnection) {
+	keyframe := []byte{
+		0, 0, 0, 1, 0x67, 0x42, 0xC0, 0x1E, 0xD9,
+		0, 0, 0, 1, 0x68, 0xCE, 0x3C, 0x80,
+		0, 0, 0, 1, 0x65, 0x88, 0x84, 0x00,
+	}
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if pc.ConnectionState() != webrtc.PeerConnectionStateConnected {
+			return
+		}
+		if err := track.WriteSample(media.Sample{Data: keyframe, Duration: 20 * time.Millisecond}); err != nil {
+			return
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	handler, offers := answeringServer(t)
+	c := testClient(t, handler)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := c.View(ctx, ViewOptions{Stream: "cam1", LiveEdge: true})
+	if err != nil {
+		t.Fatalf("View() error = %v", err)
+	}
+	defer session.Close()
+
+	offer := <-offers
+	if offer.Stream != "cam1" || !offer.LiveEdge {
+		t.Errorf("offer selected stream %q, live edge %v", offer.Stream, offer.LiveEdge)
+	}
+	if offer.SDP.Type != webrtc.SDPTypeOffer || !strings.Contains(offer.SDP.SDP, "a=recvonly") {
+		t.Errorf("offer is not a receive-only offer:\n%s", offer.SDP.SDP)
+	}
+	if session.PeerID() != "viewer-1" || session.ResumeToken() != "resume-1" {
+		t.Errorf("session has peer %q, resume token %q", session.PeerID(), session.ResumeToken())
+	}
+	if _, ok := session.ExpiresAt(); ok {
+		t.Error("session expires although the server set no limit")
+	}
+
+	select {
+	case sample := <-session.Video():
+		if !sample.Keyframe {
+			t.Errorf("sample %x is not a keyframe", sample.Data)
+		}
+	case <-ctx.Done():
+		t.Fatal("no video received")
+	}
+
+	session.Close()
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not end after Close")
+	}
+	if err := session.Err(); err != nil {
+		t.Errorf("Err() after Close = %v, want nil", err)
+	}
+}
+
+func TestViewReturnsAPIError(t *testing.T) {
+	c := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/offer" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"Too many viewers","code":"viewer_limit"}`))
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := c.View(ctx, ViewOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != "viewer_limit" {
+		t.Errorf("View() error = %v, want a 429 viewer_limit APIError", err)
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// opusSampleRate and opusChannels describe the Opus audio of the server
+const (
+	opusSampleRate = 48000
+	opusChannels   = 2
+)
+
+// SaveVideo writes the session's video to w as a raw H.264 Annex B
+// stream, starting at a keyframe, until ctx is done or the session ends.
+// ffmpeg and most players read the result, e.g. as a .h264 file.
+func (s *Session) SaveVideo(ctx context.Context, w io.Writer) error {
+	keyframe := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sample, ok := <-s.video:
+			if !ok {
+				return nil
+			}
+			if !keyframe && !sample.Keyframe {
+				continue
+			}
+			keyframe = true
+			if _, err := w.Write(sample.Data); err != nil {
+				return fmt.Errorf("failed to write video: %w", err)
+			}
+		}
+	}
+}
+
+// SaveAudio writes the session's audio to w as an Ogg Opus stream until
+// ctx is done or the session ends.
+func (s *Session) SaveAudio(ctx context.Context, w io.Writer) error {
+	// The writer closes writers it is given, which are the caller's to close
+	ogg, err := oggwriter.NewWith(struct{ io.Writer }{w}, opusSampleRate, opusChannels)
+	if err != nil {
+		return fmt.Errorf("failed to start Ogg stream: %w", err)
+	}
+	defer ogg.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sample, ok := <-s.audio:
+			if !ok {
+				return nil
+			}
+			if err := ogg.WriteRTP(rtpPacket(sample)); err != nil {
+				return fmt.Errorf("failed to write audio: %w", err)
+			}
+		}
+	}
+}
+
+// Save records the session into a .h264 video file and, if audioPath is
+// set, an .ogg audio file, until ctx is done or the session ends.
+func (s *Session) Save(ctx context.Context, videoPath, audioPath string) error {
+	videoFile, err := os.Create(videoPath)
+	if err != nil {
+		return fmt.Errorf("failed to create video file: %w", err)
+	}
+	defer videoFile.Close()
+	var audioFile *os.File
+	if audioPath != "" {
+		if audioFile, err = os.Create(audioPath); err != nil {
+			return fmt.Errorf("failed to create audio file: %w", err)
+		}
+		defer audioFile.Close()
+	}
+
+	// Either file failing stops the other
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	audioErr := make(chan error, 1)
+	if audioFile != nil {
+		go func() {
+			err := s.SaveAudio(ctx, audioFile)
+			if err != nil {
+				cancel()
+			}
+			audioErr <- err
+		}()
+	} else {
+		audioErr <- nil
+	}
+	err = s.SaveVideo(ctx, videoFile)
+	cancel()
+	if audioErr := <-audioErr; err == nil {
+		err = audioErr
+	}
+	if err != nil {
+		return err
+	}
+	if audioFile != nil {
+		if err := audioFile.Close(); err != nil {
+			return err
+		}
+	}
+	return videoFile.Close()
+}
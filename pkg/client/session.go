@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	// sampleBuffer is how many samples of each kind a slow consumer may fall
+	// behind before it misses some
+	sampleBuffer = 128
+	// maxLateVideo and maxLateAudio are how many packets are held back to
+	// reorder before a sample with a missing packet is given up
+	maxLateVideo = 256
+	maxLateAudio = 32
+)
+
+// ViewOptions are the optional fields of a viewer's offer.
+type ViewOptions struct {
+	// Stream picks the stream to watch; empty follows the active source
+	Stream string
+	// AudioTrack picks an audio program of the stream
+	AudioTrack string
+	// RelayOnly connects through TURN only
+	RelayOnly bool
+	// MaxBitrateKbps lowers the video bitrate cap of the session
+	MaxBitrateKbps int
+	// LiveEdge drops video the viewer falls behind on rather than delay it
+	LiveEdge bool
+	// ResumeToken re-attaches to the session of an earlier View that lost
+	// its connection
+	ResumeToken string
+}
+
+// offerRequest and offerResponse are the bodies of /api/offer.
+type offerRequest struct {
+	SDP            webrtc.SessionDescription `json:"sdp"`
+	Stream         string                    `json:"stream,omitempty"`
+	AudioTrack     string                    `json:"audio_track,omitempty"`
+	RelayOnly      bool                      `json:"relay_only,omitempty"`
+	MaxBitrateKbps int                       `json:"max_bitrate_kbps,omitempty"`
+	LiveEdge       bool                      `json:"live_edge,omitempty"`
+	ResumeToken    string                    `json:"resume_token,omitempty"`
+}
+
+type offerResponse struct {
+	SDP              string     `json:"sdp"`
+	PeerID           string     `json:"peer_id"`
+	ResumeToken      string     `json:"resume_token"`
+	Resumed          bool       `json:"resumed"`
+	SessionExpiresAt *time.Time `json:"session_expires_at"`
+}
+
+// Sample is a picture of the video or a packet of the audio.
+type Sample struct {
+	// Data is an H.264 access unit in Annex B form, with start codes, or
+	// an Opus packet
+	Data []byte
+	// Timestamp is the sample's RTP timestamp, on a 90 kHz clock for video
+	// and a 48 kHz clock for audio
+	Timestamp uint32
+	Duration  time.Duration
+	// Keyframe is set on video samples that start with an IDR picture or
+	// its parameter sets
+	Keyframe bool
+}
+
+// Session is a viewer session of the stream.
+type Session struct {
+	pc          *webrtc.PeerConnection
+	video       chan Sample
+	audio       chan Sample
+	peerID      string
+	resumeToken string
+	expiresAt   *time.Time
+
+	readers   sync.WaitGroup
+	closed    bool
+	err       error
+	mu        sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// View starts a viewer session of the stream, returning once its peer
+// connection is up or ctx is done. The session runs until it is closed or
+// its connection fails.
+func (c *Client) View(ctx context.Context, opts ViewOptions) (*Session, error) {
+	// The ICE servers are the server's, as a browser viewer would use;
+	// without them host candidates still reach servers on the same network
+	var iceServers []webrtc.ICEServer
+	if cfg, err := c.WebRTCConfig(ctx); err == nil {
+		for _, server := range cfg.ICEServers {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs:       server.URLs,
+				Username:   server.Username,
+				Credential: server.Credential,
+			})
+		}
+	}
+	config := webrtc.Configuration{ICEServers: iceServers}
+	if opts.RelayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	pc, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	s := &Session{
+		pc:    pc,
+		video: make(chan Sample, sampleBuffer),
+		audio: make(chan Sample, sampleBuffer),
+		done:  make(chan struct{}),
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to add transceiver: %w", err)
+		}
+	}
+	pc.OnTrack(s.onTrack)
+
+	connected := make(chan struct{})
+	var connectedOnce sync.Once
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			connectedOnce.Do(func() { close(connected) })
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			go s.closeWithError(fmt.Errorf("connection %s", state))
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to create offer: %w", err)
+	}
+	// The offer carries all candidates, as the server answers with all of
+	// its own
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to set offer: %w", err)
+	}
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		s.Close()
+		return nil, ctx.Err()
+	}
+
+	var resp offerResponse
+	err = c.do(ctx, http.MethodPost, "/api/offer", offerRequest{
+		SDP:            *pc.LocalDescription(),
+		Stream:         opts.Stream,
+		AudioTrack:     opts.AudioTrack,
+		RelayOnly:      opts.RelayOnly,
+		MaxBitrateKbps: opts.MaxBitrateKbps,
+		LiveEdge:       opts.LiveEdge,
+		ResumeToken:    opts.ResumeToken,
+	}, &resp)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.peerID, s.resumeToken, s.expiresAt = resp.PeerID, resp.ResumeToken, resp.SessionExpiresAt
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: resp.SDP}); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to set answer: %w", err)
+	}
+
+	select {
+	case <-connected:
+		return s, nil
+	case <-s.done:
+		return nil, s.Err()
+	case <-ctx.Done():
+		s.Close()
+		return nil, fmt.Errorf("connection did not come up (ICE %s): %w", pc.ICEConnectionState(), ctx.Err())
+	}
+}
+
+func (s *Session) onTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.readers.Add(1)
+	switch track.Kind() {
+	case webrtc.RTPCodecTypeVideo:
+		go s.read(track, samplebuilder.New(maxLateVideo, &codecs.H264Packet{}, track.Codec().ClockRate), s.video, true)
+	default:
+		go s.read(track, samplebuilder.New(maxLateAudio, &codecs.OpusPacket{}, track.Codec().ClockRate), s.audio, false)
+	}
+}
+
+// read builds the samples of a track until the session closes. Samples a
+// consumer has no room for are dropped.
+func (s *Session) read(track *webrtc.TrackRemote, builder *samplebuilder.SampleBuilder, out chan<- Sample, video bool) {
+	defer s.readers.Done()
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		builder.Push(packet)
+		for {
+			sample := builder.Pop()
+			if sample == nil {
+				break
+			}
+			next := Sample{Data: sample.Data, Timestamp: sample.PacketTimestamp, Duration: sample.Duration}
+			if video {
+				next.Keyframe = isKeyframe(sample.Data)
+			}
+			select {
+			case out <- next:
+			default:
+			}
+		}
+	}
+}
+
+// isKeyframe reports whether an Annex B access unit holds an IDR slice or
+// a sequence parameter set.
+func isKeyframe(annexB []byte) bool {
+	for i := 0; i+3 < len(annexB); i++ {
+		if annexB[i] != 0 || annexB[i+1] != 0 || annexB[i+2] != 1 {
+			continue
+		}
+		switch annexB[i+3] & 0x1F {
+		case 5, 7:
+			return true
+		}
+	}
+	return false
+}
+
+// Video returns the session's pictures. The channel is closed when the
+// session ends.
+func (s *Session) Video() <-chan Sample {
+	return s.video
+}
+
+// Audio returns the session's Opus packets. The channel is closed when the
+// session ends.
+func (s *Session) Audio() <-chan Sample {
+	return s.audio
+}
+
+// RequestKeyframe asks the server for a keyframe with an RTCP picture loss
+// indication.
+func (s *Session) RequestKeyframe() error {
+	for _, receiver := range s.pc.GetReceivers() {
+		if track := receiver.Track(); track != nil && track.Kind() == webrtc.RTPCodecTypeVideo && track.SSRC() != 0 {
+			return s.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
+		}
+	}
+	return errors.New("no video track")
+}
+
+// PeerID returns the ID of the session on the server, which its peer
+// endpoints take.
+func (s *Session) PeerID() string {
+	return s.peerID
+}
+
+// ResumeToken returns the token a later View re-attaches to this session
+// with after a disconnect, if the server allows resuming.
+func (s *Session) ResumeToken() string {
+	return s.resumeToken
+}
+
+// ExpiresAt returns when the session must re-authenticate, if the server
+// limits sessions.
+func (s *Session) ExpiresAt() (time.Time, bool) {
+	if s.expiresAt == nil {
+		return time.Time{}, false
+	}
+	return *s.expiresAt, true
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended: nil while it runs or if it was
+// closed.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the session.
+func (s *Session) Close() error {
+	s.closeWithError(nil)
+	return nil
+}
+
+func (s *Session) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed, s.err = true, err
+		s.mu.Unlock()
+		s.pc.Close()
+		// The readers stop once their tracks are closed with the connection
+		s.readers.Wait()
+		close(s.video)
+		close(s.audio)
+		close(s.done)
+	})
+}
+
+// rtpPacket wraps a sample for pion's media writers, which take RTP.
+func rtpPacket(sample Sample) *rtp.Packet {
+	return &rtp.Packet{Header: rtp.Header{Timestamp: sample.Timestamp}, Payload: sample.Data}
+}
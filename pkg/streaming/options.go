@@ -0,0 +1,111 @@
+package streaming
+
+import (
+	"io"
+
+	"golang-webrtc-streaming/internal/auth"
+	"golang-webrtc-streaming/internal/source"
+	"golang-webrtc-streaming/internal/stats"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Types an embedding program implements to extend the server.
+type (
+	// Source is an ingest pipeline feeding a stream; see WithSource
+	Source = source.Source
+	// Factory creates a source reading from a URL
+	Factory = source.Factory
+	// AccessUnit is one unit of H.264 video of a source
+	AccessUnit = source.AccessUnit
+	// AudioSample is one Opus packet of a source's audio
+	AudioSample = source.AudioSample
+	// SourceHealth is what a source reports of its throughput
+	SourceHealth = stats.Snapshot
+	// Sink is an output attached to a stream; see WithSink
+	Sink = source.Sink
+	// FrameSink is a sink fed every access unit of its stream
+	FrameSink = source.FrameSink
+	// AudioSink is a frame sink also fed its stream's audio
+	AudioSink = source.AudioSink
+	// AuthHook decides whether a viewer may start a session
+	AuthHook = auth.Hook
+	// AuthRequest describes a viewer asking to start a session
+	AuthRequest = auth.Request
+	// AuthDecision is an AuthHook's verdict
+	AuthDecision = auth.Decision
+)
+
+// Option customizes an embedded server.
+type Option func(*options)
+
+type options struct {
+	sources   []customSource
+	sinks     []func(stream string) Sink
+	authHooks []AuthHook
+	logger    *logrus.Logger
+	banner    io.Writer
+}
+
+type customSource struct {
+	name    string
+	url     string
+	factory Factory
+}
+
+// WithSource adds a stream named name, fed by the source factory creates
+// from url. Sources are added in order after those of the configuration;
+// the first becomes active if the configuration selects none.
+func WithSource(name, url string, factory Factory) Option {
+	return func(o *options) {
+		o.sources = append(o.sources, customSource{name: name, url: url, factory: factory})
+	}
+}
+
+// WithSink attaches the sink newSink returns to every stream, including
+// those added at runtime, and starts it. Returning nil skips a stream.
+func WithSink(newSink func(stream string) Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, newSink)
+	}
+}
+
+// WithAuthHook requires hook to allow every new viewer session, after the
+// token and webhook checks of the configuration.
+func WithAuthHook(hook AuthHook) Option {
+	return func(o *options) {
+		o.authHooks = append(o.authHooks, hook)
+	}
+}
+
+// WithLogger sends the server's logs through logger's output, formatter,
+// level, and hooks. The server logs through logrus' standard logger, which
+// is configured to match.
+func WithLogger(logger *logrus.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithBanner prints the addresses the server listens on to w once it is up,
+// as the server binary does on its standard output.
+func WithBanner(w io.Writer) Option {
+	return func(o *options) {
+		o.banner = w
+	}
+}
+
+// useLogger configures the standard logger like logger.
+func useLogger(logger *logrus.Logger) {
+	std := logrus.StandardLogger()
+	std.SetOutput(logger.Out)
+	std.SetFormatter(logger.Formatter)
+	std.SetLevel(logger.GetLevel())
+	std.SetReportCaller(logger.ReportCaller)
+	// A copy, as the server adds hooks of its own
+	hooks := make(logrus.LevelHooks, len(logger.Hooks))
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	std.ReplaceHooks(hooks)
+}
@@ -0,0 +1,895 @@
+// Package streaming embeds the whole streaming server in other Go
+// programs. New wires every subsystem from a Config the way the server
+// binary does, and Run serves until its context is done:
+//
+//	cfg, err := streaming.LoadConfig()
+//	...
+//	srv := streaming.New(cfg,
+//		streaming.WithSource("lab", "", func(string) streaming.Source { return labCamera }),
+//		streaming.WithAuthHook(myHook),
+//	)
+//	err = srv.Run(ctx)
+//
+// Options inject custom sources, sinks, viewer authorization, and logging.
+// Source types, ffmpeg limits, and logging are process-wide, so a program
+// runs one Server at a time.
+package streaming
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-webrtc-streaming/internal/analytics"
+	"golang-webrtc-streaming/internal/audio"
+	"golang-webrtc-streaming/internal/auth"
+	"golang-webrtc-streaming/internal/camera"
+	"golang-webrtc-streaming/internal/composite"
+	"golang-webrtc-streaming/internal/config"
+	"golang-webrtc-streaming/internal/events"
+	"golang-webrtc-streaming/internal/ffmpeg"
+	"golang-webrtc-streaming/internal/flags"
+	"golang-webrtc-streaming/internal/health"
+	"golang-webrtc-streaming/internal/logring"
+	"golang-webrtc-streaming/internal/metadata"
+	"golang-webrtc-streaming/internal/portmux"
+	"golang-webrtc-streaming/internal/recording"
+	"golang-webrtc-streaming/internal/redact"
+	"golang-webrtc-streaming/internal/rtmp"
+	"golang-webrtc-streaming/internal/rtsp"
+	"golang-webrtc-streaming/internal/secretbox"
+	"golang-webrtc-streaming/internal/server"
+	"golang-webrtc-streaming/internal/sip"
+	"golang-webrtc-streaming/internal/source"
+	"golang-webrtc-streaming/internal/state"
+	"golang-webrtc-streaming/internal/stats"
+	"golang-webrtc-streaming/internal/storage"
+	"golang-webrtc-streaming/internal/uplink"
+	"golang-webrtc-streaming/internal/usage"
+	"golang-webrtc-streaming/internal/webrtc"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the server's configuration, as read from the environment by
+// LoadConfig.
+type Config = config.Config
+
+// LoadConfig reads the configuration from the environment, with the
+// defaults of the server binary.
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// Server is one embedded streaming server.
+type Server struct {
+	cfg     *Config
+	options options
+}
+
+// New creates a server from cfg; nothing runs until Run.
+func New(cfg *Config, opts ...Option) *Server {
+	s := &Server{cfg: cfg}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return s
+}
+
+// Run starts every configured subsystem and serves until ctx is done, then
+// shuts down. It returns early with an error if the configuration is
+// invalid or a subsystem fails to start.
+func (s *Server) Run(ctx context.Context) error {
+	cfg := s.cfg
+	if s.options.logger != nil {
+		useLogger(s.options.logger)
+	}
+	// Source URLs and ffmpeg output carry camera credentials
+	logrus.AddHook(redact.Hook{})
+	// Kept for debug bundles, after the redact hook masked them
+	recentLogs := logring.New(logring.DefaultSize)
+	logrus.AddHook(recentLogs)
+	redact.Register(cfg.Secrets()...)
+
+	// Everything started below stops once Run returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Constrain every ffmpeg child before any is spawned
+	cpus, err := ffmpeg.ParseCPUList(cfg.FFmpeg.CPUAffinity)
+	if err != nil {
+		return fmt.Errorf("invalid FFMPEG_CPU_AFFINITY: %w", err)
+	}
+	if err := ffmpeg.Configure(ffmpeg.Limits{
+		Nice:            cfg.FFmpeg.Nice,
+		CPUs:            cpus,
+		Threads:         cfg.FFmpeg.Threads,
+		Cgroup:          cfg.FFmpeg.Cgroup,
+		CgroupCPUMax:    cfg.FFmpeg.CgroupCPUMax,
+		CgroupMemoryMax: cfg.FFmpeg.CgroupMemoryMax,
+	}); err != nil {
+		return fmt.Errorf("invalid ffmpeg limits: %w", err)
+	}
+
+	// Find the hardware encoders before any stream picks one
+	board, err := ffmpeg.ParseBoard(cfg.FFmpeg.Board)
+	if err != nil {
+		return fmt.Errorf("invalid FFMPEG_BOARD: %w", err)
+	}
+	caps := ffmpeg.DetectCapabilities(ctx, board)
+	logrus.Infof("🎛️  Video encoders on %s (%s board): auto selects %s", caps.Platform, caps.Board, caps.Auto)
+	if err := ffmpeg.SetDefaultEncoder(cfg.FFmpeg.Encoder); err != nil {
+		return fmt.Errorf("invalid VIDEO_ENCODER: %w", err)
+	}
+
+	// Lifecycle events of sources, sinks, peers, recordings, and health
+	eventBus := events.NewBus(cfg.Events.HistorySize)
+	if cfg.Events.WebhookURL != "" {
+		go events.RunWebhook(ctx, eventBus, cfg.Events.WebhookURL, events.ParseTypes(cfg.Events.WebhookTypes)...)
+	}
+
+	// Runtime configuration changed through the API; JSON files written by
+	// earlier versions are imported once
+	stateStore, err := state.Open(filepath.Join(cfg.Storage.DataDir, "state.db"))
+	if err != nil {
+		return fmt.Errorf("failed to open state store: %w", err)
+	}
+	defer stateStore.Close()
+	for bucket, file := range map[string]string{
+		state.BucketMetadata:  "metadata.json",
+		state.BucketSchedules: "schedules.json",
+	} {
+		if err := stateStore.ImportJSONFile(bucket, filepath.Join(cfg.Storage.DataDir, file)); err != nil {
+			return fmt.Errorf("failed to import %s: %w", file, err)
+		}
+	}
+
+	// Experimental subsystems, off unless turned on here or through the API
+	configuredFlags, err := flags.Parse(cfg.FeatureFlags)
+	if err != nil {
+		return fmt.Errorf("invalid FEATURE_FLAGS: %w", err)
+	}
+	featureFlags, err := flags.NewSet(stateStore, configuredFlags)
+	if err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	// Initialize WebRTC manager
+	webrtcManager := webrtc.NewManager()
+	webrtcManager.SetEvents(eventBus)
+	opusOptions := audio.OpusOptions{
+		BitrateKbps:         cfg.Audio.OpusBitrateKbps,
+		FEC:                 cfg.Audio.OpusFEC,
+		ExpectedLossPercent: cfg.Audio.OpusExpectedLossPercent,
+		DTX:                 cfg.Audio.OpusDTX,
+		Stereo:              cfg.Audio.OpusStereo,
+	}
+	if err := opusOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid Opus options: %w", err)
+	}
+	opusFmtp := cfg.WebRTC.OpusFmtp
+	if opusFmtp == "" {
+		opusFmtp = opusOptions.Fmtp()
+	}
+	codecs, err := webrtc.NewCodecConfig(cfg.WebRTC.VideoCodecs, opusFmtp)
+	if err != nil {
+		return fmt.Errorf("invalid WEBRTC_VIDEO_CODECS: %w", err)
+	}
+	if err := webrtcManager.SetCodecs(codecs); err != nil {
+		return fmt.Errorf("invalid codec configuration: %w", err)
+	}
+	webrtcManager.SetQualityThresholds(webrtc.QualityThresholds{
+		MinFPS:                 cfg.WebRTC.QualityMinFPS,
+		MaxJitterBufferDelayMS: cfg.WebRTC.QualityMaxJitterBufferMS,
+	})
+	webrtcManager.SetRelayOnlyStreams(strings.Split(cfg.WebRTC.RelayOnlyStreams, ","))
+	// A certificate of our own is regenerated when it expires; a configured one never is
+	dtlsCertFile := cfg.WebRTC.DTLSCertFile
+	if dtlsCertFile == "" {
+		dtlsCertFile = filepath.Join(cfg.Storage.DataDir, "dtls.pem")
+	}
+	dtlsCert, err := webrtc.LoadCertificate(dtlsCertFile, cfg.WebRTC.DTLSCertFile == "")
+	if err != nil {
+		return fmt.Errorf("failed to load DTLS certificate: %w", err)
+	}
+	webrtcManager.SetCertificate(dtlsCert)
+	logrus.Infof("DTLS certificate fingerprint: %s", webrtcManager.CertificateFingerprint())
+	webrtcManager.SetPeerMaxBitrate(cfg.WebRTC.PeerMaxBitrateKbps)
+	webrtcManager.SetResumeGrace(time.Duration(cfg.WebRTC.PeerResumeGraceSeconds) * time.Second)
+	avOffsets, err := webrtc.ParseAVOffsets(cfg.Audio.AVSyncStreamOffsets)
+	if err != nil {
+		return fmt.Errorf("invalid AV_SYNC_STREAM_OFFSETS: %w", err)
+	}
+	if err := webrtcManager.SetAVSync(webrtc.AVSyncConfig{
+		Offset:        time.Duration(cfg.Audio.AVSyncOffsetMS) * time.Millisecond,
+		AutoCorrect:   cfg.Audio.AVSyncAutoCorrect,
+		MaxCorrection: time.Duration(cfg.Audio.AVSyncMaxCorrectionMS) * time.Millisecond,
+	}, avOffsets); err != nil {
+		return fmt.Errorf("invalid A/V sync configuration: %w", err)
+	}
+	if err := webrtcManager.SetLiveEdge(webrtc.LiveEdgeConfig{
+		DropNonReferenceAt: cfg.WebRTC.LiveEdgeDropNonReference,
+		MaxQueuedFrames:    cfg.WebRTC.LiveEdgeMaxQueuedFrames,
+	}, cfg.WebRTC.LiveEdgeEnabled); err != nil {
+		return fmt.Errorf("invalid live edge configuration: %w", err)
+	}
+	if err := webrtcManager.SetICEConfig(webrtc.ICEConfig{
+		DisconnectedTimeout: time.Duration(cfg.WebRTC.ICEDisconnectedTimeoutMS) * time.Millisecond,
+		FailedTimeout:       time.Duration(cfg.WebRTC.ICEFailedTimeoutMS) * time.Millisecond,
+		KeepaliveInterval:   time.Duration(cfg.WebRTC.ICEKeepaliveIntervalMS) * time.Millisecond,
+	}); err != nil {
+		return fmt.Errorf("invalid ICE configuration: %w", err)
+	}
+	if err := webrtcManager.SetDataChannelLimits(webrtc.DataChannelLimits{
+		MaxMessageBytes: cfg.WebRTC.DataChannelMaxMessageBytes,
+		RatePerSecond:   cfg.WebRTC.DataChannelRatePerSecond,
+		Burst:           cfg.WebRTC.DataChannelBurst,
+		MaxViolations:   cfg.WebRTC.DataChannelMaxViolations,
+	}); err != nil {
+		return fmt.Errorf("invalid data channel limits: %w", err)
+	}
+	if err := webrtcManager.SetRTCPConfig(webrtc.RTCPConfig{
+		SenderReportInterval:    time.Duration(cfg.WebRTC.RTCPSenderReportIntervalMS) * time.Millisecond,
+		KeyframeRequestInterval: time.Duration(cfg.WebRTC.KeyframeRequestIntervalMS) * time.Millisecond,
+		MinKeyframeDistance:     time.Duration(cfg.WebRTC.KeyframeMinDistanceMS) * time.Millisecond,
+	}); err != nil {
+		return fmt.Errorf("invalid RTCP configuration: %w", err)
+	}
+	if cfg.WebRTC.ImpairmentEnabled {
+		impairment := webrtc.ImpairmentConfig{
+			LossPercent: cfg.WebRTC.ImpairmentLossPercent,
+			LatencyMS:   cfg.WebRTC.ImpairmentLatencyMS,
+			JitterMS:    cfg.WebRTC.ImpairmentJitterMS,
+		}
+		if err := webrtcManager.EnableImpairment(impairment); err != nil {
+			return fmt.Errorf("invalid network impairment: %w", err)
+		}
+		logrus.Warnf("⚠️ Network impairment enabled (%.1f%% loss, %dms latency, %dms jitter); for testing only",
+			impairment.LossPercent, impairment.LatencyMS, impairment.JitterMS)
+	}
+	if cfg.WebRTC.TURNSecret != "" && cfg.WebRTC.TURNCredentialTTLSeconds <= 0 {
+		return errors.New("TURN_CREDENTIAL_TTL_SECONDS must be positive when TURN_SECRET is set")
+	}
+	webrtcManager.SetICEServers(webrtc.ICEServerConfig{
+		STUNURLs:          cfg.WebRTC.STUNURLs,
+		TURNURL:           cfg.WebRTC.TURNURL,
+		TURNUsername:      cfg.WebRTC.TURNUsername,
+		TURNPassword:      cfg.WebRTC.TURNPassword,
+		TURNSecret:        cfg.WebRTC.TURNSecret,
+		TURNCredentialTTL: time.Duration(cfg.WebRTC.TURNCredentialTTLSeconds) * time.Second,
+	})
+	streamLimits, err := webrtc.ParseStreamLimits(cfg.WebRTC.StreamMaxViewers)
+	if err != nil {
+		return fmt.Errorf("invalid STREAM_MAX_VIEWERS: %w", err)
+	}
+	webrtcManager.SetViewerLimits(cfg.WebRTC.MaxViewers, streamLimits)
+	if cfg.WebRTC.ICERestartEnabled {
+		go webrtcManager.RunRecovery(ctx, webrtc.RecoveryConfig{
+			Interval:          2 * time.Second,
+			LossThreshold:     cfg.WebRTC.ICERestartLossThreshold,
+			LossDuration:      time.Duration(cfg.WebRTC.ICERestartLossSeconds) * time.Second,
+			DisconnectedGrace: time.Duration(cfg.WebRTC.ICERestartDisconnectedSeconds) * time.Second,
+			MaxAttempts:       cfg.WebRTC.ICERestartMaxAttempts,
+		})
+	}
+	if cfg.Auth.SessionMaxSeconds > 0 {
+		go webrtcManager.RunSessionLimits(ctx, webrtc.SessionConfig{
+			Interval:    time.Second,
+			MaxDuration: time.Duration(cfg.Auth.SessionMaxSeconds) * time.Second,
+			ReauthGrace: time.Duration(cfg.Auth.SessionReauthGraceSeconds) * time.Second,
+		})
+	}
+	if cfg.WebRTC.DowngradeEnabled {
+		downgrade := webrtc.DowngradeConfig{
+			Interval:        time.Second,
+			LossThreshold:   cfg.WebRTC.DowngradeLossThreshold,
+			LossDuration:    time.Duration(cfg.WebRTC.DowngradeLossSeconds) * time.Second,
+			RecoverDuration: time.Duration(cfg.WebRTC.DowngradeRecoverSeconds) * time.Second,
+			Encoding:        ffmpeg.Encoding{Width: cfg.WebRTC.DowngradeWidth, BitrateKbps: cfg.WebRTC.DowngradeBitrateKbps},
+		}
+		if err := downgrade.Validate(); err != nil {
+			return fmt.Errorf("invalid downgrade configuration: %w", err)
+		}
+		go webrtcManager.RunDowngrade(ctx, downgrade)
+	}
+	if cfg.WebRTC.RTCPStaleSeconds > 0 {
+		go webrtcManager.RunStaleDetection(ctx, webrtc.StaleConfig{
+			Interval:   time.Second,
+			After:      time.Duration(cfg.WebRTC.RTCPStaleSeconds) * time.Second,
+			CloseAfter: time.Duration(cfg.WebRTC.RTCPStaleCloseSeconds) * time.Second,
+		})
+	}
+
+	// RTSP sources pointing at any pooled restreamer fail over between them
+	var upstreams *rtsp.UpstreamPool
+	if cfg.RTSP.Upstreams != "" {
+		hosts, err := rtsp.ParseUpstreams(cfg.RTSP.Upstreams)
+		if err != nil {
+			return fmt.Errorf("invalid RTSP_UPSTREAMS: %w", err)
+		}
+		if cfg.RTSP.UpstreamCheckSeconds <= 0 {
+			return errors.New("RTSP_UPSTREAM_CHECK_SECONDS must be positive")
+		}
+		upstreams = rtsp.NewUpstreamPool(hosts)
+		go upstreams.Run(ctx, time.Duration(cfg.RTSP.UpstreamCheckSeconds)*time.Second)
+		logrus.Infof("RTSP upstreams: %s", strings.Join(hosts, ", "))
+	}
+	// Streams with an analytics overlay are transcoded with their
+	// detections composited onto the video
+	analyticsOverlay, err := analytics.NewOverlay(
+		filepath.Join(cfg.Storage.DataDir, "overlays"),
+		strings.Split(cfg.Analytics.OverlayStreams, ","),
+		time.Duration(cfg.Analytics.OverlaySeconds*float64(time.Second)),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid ANALYTICS_OVERLAY_SECONDS: %w", err)
+	}
+	// Every stream with a path template is an RTSP source type of its own
+	pathTemplates, err := rtsp.ParsePathTemplates(cfg.RTSP.StreamPathTemplates)
+	if err != nil {
+		return fmt.Errorf("invalid RTSP_STREAM_PATH_TEMPLATES: %w", err)
+	}
+	if _, ok := pathTemplates["rtsp"]; !ok {
+		template := rtsp.PathTemplate(cfg.RTSP.PathTemplate)
+		if template != "" {
+			if err := template.Validate(); err != nil {
+				return fmt.Errorf("invalid RTSP_PATH_TEMPLATE: %w", err)
+			}
+		}
+		// An empty template still lets the rtsp stream use the upstreams
+		// and its overlay
+		if template != "" || upstreams != nil || analyticsOverlay.Enabled("rtsp") {
+			pathTemplates["rtsp"] = template
+		}
+	}
+	rtspFactory := func(stream string, template rtsp.PathTemplate) source.Factory {
+		return func(url string) source.Source {
+			client := rtsp.NewClient(url)
+			client.SetUpstreams(upstreams)
+			client.SetPathTemplate(stream, template)
+			if analyticsOverlay.Enabled(stream) {
+				if path, err := analyticsOverlay.Path(stream); err != nil {
+					logrus.Warnf("Failed to create analytics overlay of %s: %v", stream, err)
+				} else if err := client.SetOverlay(path); err != nil {
+					logrus.Warnf("Analytics overlay of %s disabled: %v", stream, err)
+				}
+			}
+			return client
+		}
+	}
+	for stream, template := range pathTemplates {
+		source.RegisterType(stream, rtspFactory(stream, template))
+	}
+	// Every stream of STREAMS is a source type of its own, read by the
+	// client matching its URL
+	streams, err := source.ParseStreams(cfg.Source.Streams)
+	if err != nil {
+		return fmt.Errorf("invalid STREAMS: %w", err)
+	}
+	for _, stream := range streams {
+		if _, ok := pathTemplates[stream.Type]; ok {
+			continue
+		}
+		if strings.HasPrefix(stream.URL, "rtmp") {
+			source.RegisterType(stream.Type, func(url string) source.Source { return rtmp.NewClient(url) })
+		} else {
+			source.RegisterType(stream.Type, rtspFactory(stream.Type, ""))
+		}
+	}
+
+	// Initialize source manager
+	sourceManager := source.NewManager(webrtcManager)
+	sourceManager.SetContext(ctx)
+	sourceManager.SetEvents(eventBus)
+	sourceManager.SetState(stateStore)
+	if cfg.Audio.OpusEnabled {
+		sourceManager.EnableOpus(opusOptions)
+	}
+	sourceManager.InitializeSources(cfg.RTMP.URL, cfg.RTSP.URL)
+	sourceManager.InitializeStreams(streams)
+	if cfg.Source.StdinPath != "" {
+		if err := sourceManager.AddSource("stdin", cfg.Source.StdinPath); err != nil {
+			logrus.Errorf("Failed to initialize stdin source: %v", err)
+		}
+	}
+	// Sources of the embedding program are types of their own
+	for _, custom := range s.options.sources {
+		name := strings.ToLower(custom.name)
+		if slices.Contains(source.Types(), name) {
+			return fmt.Errorf("source %s has the name of another stream", name)
+		}
+		source.RegisterType(name, custom.factory)
+		if err := sourceManager.AddSource(name, custom.url); err != nil {
+			return fmt.Errorf("failed to initialize source %s: %w", name, err)
+		}
+	}
+
+	// Composite streams combine others into a mosaic or picture-in-picture,
+	// fed by a sink on each input
+	composites, err := composite.ParseSpecs(cfg.Source.Composites)
+	if err != nil {
+		return fmt.Errorf("invalid COMPOSITES: %w", err)
+	}
+	for _, spec := range composites {
+		if slices.Contains(source.Types(), spec.Name) {
+			return fmt.Errorf("composite %s has the name of another stream", spec.Name)
+		}
+		compositor, err := composite.New(spec, cfg.Source.CompositeFPS, sourceManager.Acquire)
+		if err != nil {
+			return fmt.Errorf("invalid COMPOSITES: %w", err)
+		}
+		source.RegisterType(spec.Name, func(string) source.Source { return compositor })
+		if err := sourceManager.AddSource(spec.Name, spec.String()); err != nil {
+			logrus.Errorf("Failed to initialize composite %s: %v", spec.Name, err)
+			continue
+		}
+		sourceManager.OnSourceAdded(func(id string) {
+			if sink := compositor.Sink(id); sink != nil {
+				if err := sourceManager.AttachSink(id, sink); err != nil {
+					logrus.Warnf("Failed to attach %s sink: %v", sink.Name(), err)
+				}
+			}
+		})
+	}
+	// Door stations calling over SIP feed a stream of their own while a
+	// call is up
+	var sipAgent *sip.Agent
+	if cfg.SIP.Enabled {
+		stream := strings.ToLower(cfg.SIP.Stream)
+		if slices.Contains(source.Types(), stream) {
+			return fmt.Errorf("SIP_STREAM %s has the name of another stream", stream)
+		}
+		sipSource := sip.NewSource(stream)
+		source.RegisterType(stream, func(string) source.Source { return sipSource })
+		if err := sourceManager.AddSource(stream, sipSource.URL()); err != nil {
+			return fmt.Errorf("failed to initialize SIP stream %s: %w", stream, err)
+		}
+		sipAgent = sip.New(sip.Config{
+			Listen:         cfg.SIP.Listen,
+			PublicIP:       cfg.SIP.PublicIP,
+			Server:         cfg.SIP.Server,
+			User:           cfg.SIP.User,
+			Password:       cfg.SIP.Password,
+			Domain:         cfg.SIP.Domain,
+			RegisterExpiry: time.Duration(cfg.SIP.RegisterExpirySeconds) * time.Second,
+			AutoAnswer:     cfg.SIP.AutoAnswer,
+			RingTimeout:    time.Duration(cfg.SIP.RingTimeoutSeconds) * time.Second,
+			AllowedCallers: commaList(cfg.SIP.AllowedCallers),
+			DialTargets:    commaList(cfg.SIP.DialTargets),
+			Stream:         stream,
+			Enabled:        func() bool { return featureFlags.Enabled(flags.SIP) },
+		}, sipSource)
+		sipAgent.SetEvents(eventBus)
+		go func() {
+			if err := sipAgent.Run(ctx); err != nil {
+				logrus.Errorf("SIP agent failed: %v", err)
+			}
+		}()
+	}
+	if err := sourceManager.RestoreSources(); err != nil {
+		logrus.Errorf("Failed to restore registered sources: %v", err)
+	}
+
+	// Initialize RTMP server
+	rtmpServer := rtmp.NewServer(cfg.RTMP.Port, webrtcManager)
+
+	// Load persisted stream metadata
+	metadataStore, err := metadata.NewStore(stateStore)
+	if err != nil {
+		return fmt.Errorf("failed to load stream metadata: %w", err)
+	}
+
+	// Initialize recording manager and its scheduler
+	schedules, err := recording.ParseSchedules(cfg.Recording.Schedules)
+	if err != nil {
+		return fmt.Errorf("invalid RECORDING_SCHEDULES: %w", err)
+	}
+	renditions, err := recording.ParseRenditions(cfg.Recording.Renditions, cfg.Recording.URLs)
+	if err != nil {
+		return fmt.Errorf("invalid RECORDING_RENDITIONS or RECORDING_URLS: %w", err)
+	}
+	for stream, rendition := range renditions {
+		if rendition.Encoding == nil {
+			continue
+		}
+		if err := ffmpeg.CheckEncoder(rendition.Encoding.Encoder); err != nil {
+			return fmt.Errorf("invalid RECORDING_RENDITIONS of %s: %w", stream, err)
+		}
+		if !analyticsOverlay.Enabled(stream) {
+			continue
+		}
+		if rendition.Overlay, err = analyticsOverlay.Path(stream); err != nil {
+			return fmt.Errorf("failed to create analytics overlay of %s: %w", stream, err)
+		}
+		renditions[stream] = rendition
+	}
+	timelapseIntervals, err := recording.ParseTimelapseIntervals(cfg.Recording.TimelapseStreams)
+	if err != nil {
+		return fmt.Errorf("invalid TIMELAPSE_STREAMS: %w", err)
+	}
+	if cfg.Recording.TimelapseIntervalSeconds <= 0 {
+		return errors.New("TIMELAPSE_INTERVAL_SECONDS must be positive")
+	}
+	recordingManager, err := recording.NewManager(recording.Config{
+		Dir:            filepath.Join(cfg.Storage.MediaDir, "recordings"),
+		ClipsDir:       filepath.Join(cfg.Storage.MediaDir, "clips"),
+		SegmentSeconds: cfg.Recording.SegmentSeconds,
+		State:          stateStore,
+		Schedules:      schedules,
+		Renditions:     renditions,
+
+		TimelapseDir:           filepath.Join(cfg.Storage.MediaDir, "timelapses"),
+		TimelapseAssembleEvery: time.Duration(cfg.Recording.TimelapseAssembleMinutes) * time.Minute,
+		TimelapseFPS:           cfg.Recording.TimelapseFPS,
+	}, sourceManager.GetSourceURL)
+	if err != nil {
+		return fmt.Errorf("failed to initialize recording manager: %w", err)
+	}
+	recordingIndex, err := recording.OpenIndex(filepath.Join(cfg.Storage.DataDir, "recordings.db"))
+	if err != nil {
+		return fmt.Errorf("failed to open recording index: %w", err)
+	}
+	defer recordingIndex.Close()
+	recordingManager.SetIndex(recordingIndex)
+	recordingManager.SetEvents(eventBus)
+	go recordingManager.Run(ctx)
+	analyticsHub, err := analytics.NewHub(analytics.Options{FPS: cfg.Analytics.FPS, Width: cfg.Analytics.Width}, sourceManager.Acquire)
+	if err != nil {
+		return fmt.Errorf("invalid ANALYTICS_FPS or ANALYTICS_WIDTH: %w", err)
+	}
+	analyticsHub.SetEvents(eventBus)
+	analyticsHub.SetOverlay(analyticsOverlay)
+	sourceManager.OnSourceAdded(func(id string) {
+		if err := sourceManager.AttachSink(id, analyticsHub.Sink(id)); err != nil {
+			logrus.Warnf("Failed to attach analytics to %s: %v", id, err)
+		}
+		if err := sourceManager.AttachSink(id, recording.NewSink(recordingManager, id)); err != nil {
+			logrus.Warnf("Failed to attach recorder to %s: %v", id, err)
+		}
+		interval, sampled := timelapseIntervals[id]
+		if !sampled {
+			interval = time.Duration(cfg.Recording.TimelapseIntervalSeconds) * time.Second
+		}
+		if err := sourceManager.AttachSink(id, recording.NewTimelapseSink(recordingManager, id, interval, sourceManager.Acquire)); err != nil {
+			logrus.Warnf("Failed to attach time-lapse to %s: %v", id, err)
+			return
+		}
+		if sampled {
+			if err := sourceManager.EnableSink(id, "timelapse"); err != nil {
+				logrus.Warnf("Failed to start time-lapse of %s: %v", id, err)
+			}
+		}
+	})
+	// Sinks of the embedding program run on every stream they accept
+	for _, newSink := range s.options.sinks {
+		newSink := newSink
+		sourceManager.OnSourceAdded(func(id string) {
+			sink := newSink(id)
+			if sink == nil {
+				return
+			}
+			if err := sourceManager.AttachSink(id, sink); err != nil {
+				logrus.Warnf("Failed to attach %s sink to %s: %v", sink.Name(), id, err)
+				return
+			}
+			if err := sourceManager.EnableSink(id, sink.Name()); err != nil {
+				logrus.Warnf("Failed to start %s sink of %s: %v", sink.Name(), id, err)
+			}
+		})
+	}
+
+	// Edge instances push the selected streams to a central instance, which
+	// serves their viewers
+	var edgeUplink *webrtc.Uplink
+	if cfg.Uplink.URL != "" {
+		uplinkStreams, err := uplink.ParseStreams(cfg.Uplink.Streams)
+		if err != nil {
+			return fmt.Errorf("invalid UPLINK_STREAMS: %w", err)
+		}
+		edgeUplink, err = webrtcManager.NewUplink(webrtc.UplinkConfig{
+			URL:     cfg.Uplink.URL,
+			Token:   cfg.Uplink.Token,
+			Streams: uplinkStreams,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid uplink settings: %w", err)
+		}
+		sourceManager.OnSourceAdded(func(id string) {
+			if _, pushed := uplinkStreams[id]; !pushed {
+				return
+			}
+			if err := sourceManager.AttachSink(id, uplink.NewSink(edgeUplink, id, sourceManager.Acquire)); err != nil {
+				logrus.Warnf("Failed to attach uplink to %s: %v", id, err)
+				return
+			}
+			if err := sourceManager.EnableSink(id, "uplink"); err != nil {
+				logrus.Warnf("Failed to push %s over the uplink: %v", id, err)
+			}
+		})
+		go edgeUplink.Run(ctx)
+	}
+
+	// Cameras assigned to a stream feed it, taking precedence over RTSP_URL/RTMP_URL
+	var secretKey []byte
+	if cfg.Storage.SecretKeyCommand != "" {
+		if cfg.Storage.SecretKey != "" {
+			return errors.New("set either SECRET_KEY or SECRET_KEY_COMMAND, not both")
+		}
+		secretKey, err = secretbox.KeyFromCommand(ctx, cfg.Storage.SecretKeyCommand)
+	} else {
+		secretKey, err = secretbox.LoadKey(cfg.Storage.SecretKey, filepath.Join(cfg.Storage.DataDir, "secret.key"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load secret key: %w", err)
+	}
+	redact.Register(base64.StdEncoding.EncodeToString(secretKey))
+	secrets, err := secretbox.New(secretKey)
+	if err != nil {
+		return fmt.Errorf("invalid secret key: %w", err)
+	}
+	cameraStore, err := camera.NewStore(stateStore, secrets)
+	if err != nil {
+		return fmt.Errorf("failed to load camera inventory: %w", err)
+	}
+	for _, cam := range cameraStore.List() {
+		if cam.Stream == "" {
+			continue
+		}
+		url, err := cam.URL()
+		if err == nil {
+			err = sourceManager.SetSourceURL(cam.Stream, url)
+		}
+		if err != nil {
+			logrus.Errorf("Failed to feed %s from camera %s: %v", cam.Stream, cam.Name, err)
+		}
+	}
+
+	// Monitor media disk usage and enforce the quota
+	storageMonitor := storage.NewMonitor(storage.Config{
+		MediaDir:     cfg.Storage.MediaDir,
+		QuotaBytes:   uint64(cfg.Storage.QuotaMB) * 1024 * 1024,
+		MinFreeBytes: uint64(cfg.Storage.MinFreeMB) * 1024 * 1024,
+		Policy:       cfg.Storage.Policy,
+	}, recordingManager.StopAll)
+	recordingManager.SetStartGuard(storageMonitor.CanWrite)
+	storageMonitor.SetDeleteHook(func(path string) {
+		if err := recordingIndex.DeleteByPath(path); err != nil {
+			logrus.Warnf("Failed to remove %s from recording index: %v", path, err)
+		}
+	})
+	go storageMonitor.Run(ctx)
+
+	// Score stream health and alert on status changes
+	healthMonitor := health.NewMonitor(health.Config{
+		Interval:           time.Duration(cfg.Health.IntervalSeconds) * time.Second,
+		DegradedThreshold:  cfg.Health.DegradedThreshold,
+		UnhealthyThreshold: cfg.Health.UnhealthyThreshold,
+		WebhookURL:         cfg.Health.WebhookURL,
+	}, func() (map[string]stats.Snapshot, map[string]float64) {
+		// Viewers only watch the active source; idle on-demand sources are not scored
+		loss := map[string]float64{sourceManager.GetCurrentSource(): webrtcManager.ViewerLoss()}
+		sources := sourceManager.GetAllSourceStats()
+		for id := range sources {
+			if sourceManager.IsIdle(id) {
+				delete(sources, id)
+			}
+		}
+		return sources, loss
+	})
+	healthMonitor.SetEvents(eventBus)
+	go healthMonitor.Run(ctx)
+
+	// Account the media sent to viewers for chargeback and capacity planning
+	usageLedger, err := usage.NewLedger(stateStore, cfg.Usage.TenantTag, webrtcManager.CollectUsage)
+	if err != nil {
+		return fmt.Errorf("failed to load usage: %w", err)
+	}
+	go usageLedger.Run(ctx, time.Duration(cfg.Usage.PersistSeconds)*time.Second)
+
+	// Audio-only MP3/AAC streams for listeners without video playback
+	audioBroadcaster, err := audio.NewBroadcaster(cfg.Audio.StreamBitrateKbps)
+	if err != nil {
+		return fmt.Errorf("invalid audio stream settings: %w", err)
+	}
+
+	// Viewers must pass every configured check before a session starts
+	var offerAuth auth.Chain
+	if cfg.Auth.Tokens != "" {
+		offerAuth = append(offerAuth, auth.NewTokenHook(cfg.Auth.Tokens))
+	}
+	if cfg.Auth.WebhookURL != "" {
+		offerAuth = append(offerAuth, auth.NewWebhookHook(cfg.Auth.WebhookURL, time.Duration(cfg.Auth.WebhookTimeoutSeconds)*time.Second))
+	}
+	offerAuth = append(offerAuth, s.options.authHooks...)
+	services := server.Services{
+		Metadata:  metadataStore,
+		Recording: recordingManager,
+		Storage:   storageMonitor,
+		Health:    healthMonitor,
+		Events:    eventBus,
+		Cameras:   cameraStore,
+		Upstreams: upstreams,
+		Analytics: analyticsHub,
+		Usage:     usageLedger,
+		Audio:     audioBroadcaster,
+		Flags:     featureFlags,
+		Config:    cfg,
+		Logs:      recentLogs,
+	}
+	if edgeUplink != nil {
+		services.Uplink = edgeUplink
+	}
+	if cfg.Uplink.IngestTokens != "" {
+		services.UplinkIngest = uplink.NewIngest("uplink", cfg.Uplink.IngestTokens)
+	}
+	if cfg.WHIP.Tokens != "" {
+		services.WHIPIngest = uplink.NewIngest("whip", cfg.WHIP.Tokens)
+	}
+	if sipAgent != nil {
+		services.SIP = sipAgent
+	}
+	if len(offerAuth) > 0 {
+		services.OfferAuth = offerAuth
+	}
+
+	// Initialize HTTP server with source manager
+	httpServer := server.NewServer(cfg.HTTP.Port, webrtcManager, sourceManager, services)
+	httpServer.SetTLS(cfg.HTTP.TLSCertFile, cfg.HTTP.TLSKeyFile)
+	if err := httpServer.SetTrustedProxies(commaList(cfg.HTTP.TrustedProxies), commaList(cfg.HTTP.RealIPHeaders)); err != nil {
+		return fmt.Errorf("failed to configure HTTP server: %w", err)
+	}
+	appFeatures, err := server.ParseFeatures(cfg.HTTP.AppFeatures)
+	if err != nil {
+		return fmt.Errorf("invalid APP_FEATURES: %w", err)
+	}
+	httpServer.SetAppConfig(cfg.HTTP.AppAPIBase, appFeatures)
+	httpServer.SetStaticMaxAge(time.Duration(cfg.HTTP.StaticCacheSeconds) * time.Second)
+
+	// Signaling and media share one port, for networks where only e.g. 443 is reachable
+	if cfg.HTTP.SinglePort > 0 {
+		addr := fmt.Sprintf(":%d", cfg.HTTP.SinglePort)
+		udpConn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on UDP %s: %w", addr, err)
+		}
+		defer udpConn.Close()
+		tcpListener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on TCP %s: %w", addr, err)
+		}
+		shared := portmux.New(tcpListener)
+		defer shared.Close()
+
+		var publicIPs []string
+		if cfg.HTTP.SinglePortPublicIPs != "" {
+			publicIPs = strings.Split(cfg.HTTP.SinglePortPublicIPs, ",")
+		}
+		if err := webrtcManager.EnableSinglePort(webrtc.SinglePortConfig{
+			UDP:       udpConn,
+			TCP:       shared.ICE(),
+			PublicIPs: publicIPs,
+		}); err != nil {
+			return fmt.Errorf("failed to enable single port mode: %w", err)
+		}
+		httpServer.SetListener(shared.HTTP())
+	}
+
+	// Check that media reaches a loopback viewer, once the peer connections
+	// are fully configured, before /readyz admits traffic
+	if cfg.WebRTC.SelfTestEnabled {
+		httpServer.RequireSelfTest()
+		go webrtcManager.RunSelfTest(ctx, webrtc.SelfTestConfig{
+			Timeout:       time.Duration(cfg.WebRTC.SelfTestTimeoutSeconds) * time.Second,
+			RetryInterval: time.Duration(cfg.WebRTC.SelfTestRetrySeconds) * time.Second,
+		})
+	}
+
+	// Start all configured sources, or only as viewers need them, and select
+	// the active type if provided
+	if cfg.Source.OnDemand {
+		sourceManager.EnableOnDemand(ctx, time.Duration(cfg.Source.IdleTimeoutSeconds)*time.Second)
+	}
+	sourceManager.StartAll(ctx)
+	if cfg.Source.Type != "" {
+		if err := sourceManager.SetActiveSource(cfg.Source.Type); err != nil {
+			logrus.Warnf("Failed to set active source from config: %v", err)
+		}
+	} else if cfg.RTSP.URL != "" {
+		_ = sourceManager.SetActiveSource("rtsp")
+	} else if cfg.RTMP.URL != "" {
+		_ = sourceManager.SetActiveSource("rtmp")
+	} else if cfg.Source.StdinPath != "" {
+		_ = sourceManager.SetActiveSource("stdin")
+	} else if len(streams) > 0 {
+		_ = sourceManager.SetActiveSource(streams[0].Type)
+	} else if len(s.options.sources) > 0 {
+		_ = sourceManager.SetActiveSource(s.options.sources[0].name)
+	}
+
+	// Start audio level monitoring
+	if cfg.Audio.LevelsEnabled {
+		sourceManager.EnableAudioLevels(ctx, audio.MeterConfig{
+			Interval:         time.Duration(cfg.Audio.LevelIntervalMS) * time.Millisecond,
+			SilenceThreshold: cfg.Audio.SilenceThreshold,
+			SilenceDuration:  time.Duration(cfg.Audio.SilenceSeconds) * time.Second,
+		})
+	}
+
+	// Start RTMP server
+	go func() {
+		if err := rtmpServer.Start(ctx); err != nil {
+			logrus.Errorf("RTMP server error: %v", err)
+		}
+	}()
+
+	// Start HTTP server
+	go func() {
+		if err := httpServer.Start(ctx); err != nil {
+			logrus.Errorf("HTTP server error: %v", err)
+		}
+	}()
+
+	// Print startup information
+	if s.options.banner != nil {
+		printStartupInfo(s.options.banner, cfg, streams)
+	}
+
+	// Wait until the embedding program or a signal ends the server
+	<-ctx.Done()
+
+	logrus.Info("Shutting down gracefully...")
+	cancel()
+
+	// Give services time to shutdown
+	time.Sleep(2 * time.Second)
+	logrus.Info("Shutdown complete")
+	return nil
+}
+
+// commaList splits a comma-separated setting, dropping blank entries.
+func commaList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func printStartupInfo(w io.Writer, cfg *config.Config, streams []source.Registration) {
+	fmt.Fprintln(w, "🚀 Go WebRTC Streaming Server Started")
+	fmt.Fprintln(w, "=====================================")
+	if cfg.HTTP.SinglePort > 0 {
+		fmt.Fprintf(w, "📡 HTTP Server and WebRTC media: port %d (TCP and UDP)\n", cfg.HTTP.SinglePort)
+	} else {
+		fmt.Fprintf(w, "📡 HTTP Server: http://localhost:%d\n", cfg.HTTP.Port)
+	}
+	fmt.Fprintf(w, "📺 RTMP Server: rtmp://localhost:%d/live\n", cfg.RTMP.Port)
+
+	// Show available sources
+	if cfg.RTMP.URL != "" {
+		fmt.Fprintf(w, "📹 RTMP Source: %s\n", redact.String(cfg.RTMP.URL))
+	}
+	if cfg.RTSP.URL != "" {
+		fmt.Fprintf(w, "📹 RTSP Source: %s\n", redact.String(cfg.RTSP.URL))
+	}
+	for _, stream := range streams {
+		fmt.Fprintf(w, "📹 Stream %s: %s\n", stream.Type, redact.String(stream.URL))
+	}
+	if cfg.Source.URL != "" {
+		fmt.Fprintf(w, "🎯 Active Source: %s (%s)\n", cfg.Source.Type, redact.String(cfg.Source.URL))
+	}
+
+	fmt.Fprintln(w, "🌐 Web Client: http://localhost:8080")
+	fmt.Fprintln(w, "📸 Snapshot API: http://localhost:8080/api/snapshot")
+	fmt.Fprintln(w, "🔄 Switch Source API: http://localhost:8080/api/source")
+	fmt.Fprintln(w, "=====================================")
+}
@@ -0,0 +1,11 @@
+// Package web holds the browser client, embedded into the server binary so
+// it can run from any working directory.
+package web
+
+import "embed"
+
+// Files are the page templates and the static assets, including any .gz
+// and .br files compressed ahead of time next to them.
+//
+//go:embed templates static
+var Files embed.FS